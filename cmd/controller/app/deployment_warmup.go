@@ -0,0 +1,107 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"strings"
+
+	"github.com/golang/glog"
+	v1alpha1 "github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha1"
+	"github.com/senthilrch/kube-fledged/pkg/images"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// eventReasonImageWarmUp is the reason of the event of a Deployment whose new images are being cached
+const eventReasonImageWarmUp = "ImageWarmUp"
+
+// warmUpDeployment caches the new images of the pod template of a Deployment opted in to warm-up in the
+// nodes selected by the node selector of the pod template, when its images change, so that the images are
+// cached in the nodes as soon as the Deployment rolls out. The images are pulled by transient image work
+// requests of a synthetic image cache named after the Deployment, whose results are only logged. The image
+// pull secrets of the Deployment are used only if jobs are created in the namespace of the Deployment
+func (c *Controller) warmUpDeployment(old, new *appsv1.Deployment) {
+	if new.Annotations[v1alpha1.DeploymentWarmUpAnnotationKey] != "true" || !c.watched(new) {
+		return
+	}
+	newImages := changedImages(old.Spec.Template.Spec, new.Spec.Template.Spec)
+	if len(newImages) == 0 {
+		return
+	}
+	nodes, err := c.selectNodes(new.Spec.Template.Spec.NodeSelector)
+	if err != nil {
+		return
+	}
+	imageCache := &v1alpha1.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      images.WarmUpImageCachePrefix + new.Name,
+			Namespace: new.Namespace,
+		},
+		Spec: v1alpha1.ImageCacheSpec{
+			Tolerations: new.Spec.Template.Spec.Tolerations,
+		},
+	}
+	var imagePullSecrets []corev1.LocalObjectReference
+	if c.jobsInImageCacheNamespace {
+		imagePullSecrets = new.Spec.Template.Spec.ImagePullSecrets
+	}
+	warmedUpNodes := 0
+	for _, n := range nodes {
+		if !c.nodeCachable(n) {
+			continue
+		}
+		warmedUpNodes++
+		for _, image := range newImages {
+			c.imageworkqueue.AddRateLimited(images.ImageWorkRequest{
+				Image:                   image,
+				Node:                    n,
+				ContainerRuntimeVersion: n.Status.NodeInfo.ContainerRuntimeVersion,
+				WorkType:                images.ImageCacheCreate,
+				Imagecache:              imageCache,
+				ImagePullSecrets:        &imagePullSecrets,
+				Tolerations:             &imageCache.Spec.Tolerations,
+				ContainerdNamespace:     c.containerdNamespace,
+				WarmUp:                  true,
+			})
+		}
+	}
+	if warmedUpNodes == 0 {
+		glog.Infof("No nodes to warm up with images %s of deployment %s/%s", strings.Join(newImages, ", "), new.Namespace, new.Name)
+		return
+	}
+	c.imageworkqueue.AddRateLimited(images.ImageWorkRequest{WorkType: images.ImageCacheCreate, Imagecache: imageCache, WarmUp: true})
+	glog.Infof("Warming up %d nodes with images %s of deployment %s/%s", warmedUpNodes, strings.Join(newImages, ", "), new.Namespace, new.Name)
+	c.recorder.Eventf(new, corev1.EventTypeNormal, eventReasonImageWarmUp, "Caching images %s in %d nodes", strings.Join(newImages, ", "), warmedUpNodes)
+}
+
+// changedImages returns the images of the containers and init containers of the new pod spec that
+// are not images of the old pod spec
+func changedImages(old, new corev1.PodSpec) []string {
+	oldImages := map[string]bool{}
+	for _, container := range append(append([]corev1.Container{}, old.InitContainers...), old.Containers...) {
+		oldImages[container.Image] = true
+	}
+	newImages := []string{}
+	for _, container := range append(append([]corev1.Container{}, new.InitContainers...), new.Containers...) {
+		if !oldImages[container.Image] {
+			oldImages[container.Image] = true
+			newImages = append(newImages, container.Image)
+		}
+	}
+	return newImages
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"path"
+	"sort"
+
+	v1alpha1 "github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha1"
+)
+
+// imageExcluded returns true if the image matches any of the exclusions, each either the image itself or
+// a pattern with '*' wildcards e.g. "myrepo/*:debug". Wildcards do not match the '/' separators of images
+func imageExcluded(image string, exclusions []string) bool {
+	for _, e := range exclusions {
+		if e == image {
+			return true
+		}
+		if matched, err := path.Match(e, image); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// excludeImages removes the images matching the exclusions from the image lists of the expanded cache spec,
+// so that they are neither cached nor purged. It returns the images excluded, sorted
+func excludeImages(cacheSpec []v1alpha1.CacheSpecImages, exclusions []string) []string {
+	if len(exclusions) == 0 {
+		return nil
+	}
+	excluded := map[string]bool{}
+	for k := range cacheSpec {
+		var images []string
+		for _, image := range cacheSpec[k].Images {
+			if imageExcluded(image, exclusions) {
+				excluded[image] = true
+				continue
+			}
+			images = append(images, image)
+		}
+		cacheSpec[k].Images = images
+	}
+	if len(excluded) == 0 {
+		return nil
+	}
+	excludedImages := make([]string, 0, len(excluded))
+	for image := range excluded {
+		excludedImages = append(excludedImages, image)
+	}
+	sort.Strings(excludedImages)
+	return excludedImages
+}
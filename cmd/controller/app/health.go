@@ -0,0 +1,110 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// LivenessHandler returns an HTTP handler that reports the controller as unhealthy if the workers of its
+// work queues made no progress within the stall threshold, or if its informer caches did not sync within
+// the stall threshold of the start of the controller. This lets kubernetes restart a wedged controller
+func (c *Controller) LivenessHandler(stallThreshold time.Duration) http.Handler {
+	return healthHandler(func() error {
+		return c.healthy(stallThreshold)
+	})
+}
+
+// ReadinessHandler returns an HTTP handler that reports the controller as ready once its informer caches synced
+func (c *Controller) ReadinessHandler() http.Handler {
+	return healthHandler(func() error {
+		if standby, _ := c.leadership(); standby {
+			return nil
+		}
+		if !c.informersSynced() {
+			return fmt.Errorf("informer caches not synced")
+		}
+		return nil
+	})
+}
+
+// StandBy marks the controller as standing by for leadership, with leader election enabled. The workers
+// and the informers of the image manager are run only once the controller is elected the leader, so the
+// probes pass while the controller stands by
+func (c *Controller) StandBy() {
+	c.leaderLock.Lock()
+	defer c.leaderLock.Unlock()
+	c.standby = true
+}
+
+// Lead marks the controller as elected the leader. The informer caches must sync within the stall
+// threshold of the election, instead of the start of the controller
+func (c *Controller) Lead() {
+	c.leaderLock.Lock()
+	defer c.leaderLock.Unlock()
+	c.standby, c.leaderSince = false, time.Now()
+}
+
+// leadership returns whether the controller stands by for leadership, and the time it was last elected the leader
+func (c *Controller) leadership() (bool, time.Time) {
+	c.leaderLock.RLock()
+	defer c.leaderLock.RUnlock()
+	return c.standby, c.leaderSince
+}
+
+// healthy returns an error if the controller is wedged
+func (c *Controller) healthy(stallThreshold time.Duration) error {
+	standby, leaderSince := c.leadership()
+	if standby {
+		return nil
+	}
+	started := c.startTime
+	if leaderSince.After(started) {
+		started = leaderSince
+	}
+	if err := c.queueProgress.Stalled(c.workqueue.Len(), stallThreshold); err != nil {
+		return fmt.Errorf("image cache work queue stalled: %v", err)
+	}
+	if err := c.imageManager.Stalled(stallThreshold); err != nil {
+		return fmt.Errorf("image work queue stalled: %v", err)
+	}
+	if !c.informersSynced() && time.Since(started) > stallThreshold {
+		return fmt.Errorf("informer caches not synced in %s", stallThreshold)
+	}
+	return nil
+}
+
+// informersSynced returns true once the informer caches of the controller and the image manager have synced
+func (c *Controller) informersSynced() bool {
+	return c.nodesSynced() && c.imageCachesSynced() && c.configMapsSynced() && c.deploymentsSynced() && c.imageManager.InformersSynced()
+}
+
+// healthHandler serves the result of the check: 200 "ok" if the check passes, 503 with the error otherwise
+func healthHandler(check func() error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := check(); err != nil {
+			glog.Warningf("Health check %s failed: %v", r.URL.Path, err)
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+}
@@ -0,0 +1,212 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution/reference"
+	"github.com/golang/glog"
+	v1alpha1 "github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha1"
+	"github.com/senthilrch/kube-fledged/pkg/images"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// digestResolveTimeout is the max. duration of resolving the digests of the images of an image cache
+const digestResolveTimeout = time.Minute
+
+// resolveImageDigests resolves the images of the image lists of the image cache to the digests of their
+// manifests in their registries, using the credentials in the image pull secrets of the image list and the
+// image cache. Images whose digest could not be resolved, e.g. due to a registry error, are not included,
+// so that they are pulled as usual
+func (c *Controller) resolveImageDigests(imageCache *v1alpha1.ImageCache, cacheSpec []v1alpha1.CacheSpecImages) map[string]string {
+	ctx, cancel := context.WithTimeout(context.Background(), digestResolveTimeout)
+	defer cancel()
+	digests := map[string]string{}
+	failed := map[string]bool{}
+	secrets := map[string]*corev1.Secret{}
+	for _, i := range cacheSpec {
+		if i.ImageArchive != nil {
+			continue
+		}
+		for _, image := range i.Images {
+			if _, ok := digests[image]; ok || failed[image] {
+				continue
+			}
+			digest, err := c.registryClient.ImageDigest(ctx, image, c.registryCredentials(imageCache, i.ImagePullSecrets, secrets))
+			if err != nil {
+				glog.Warningf("Error resolving digest of image %s of image cache %s/%s: %v", image, imageCache.Namespace, imageCache.Name, err)
+				failed[image] = true
+				continue
+			}
+			digests[image] = digest
+		}
+	}
+	return digests
+}
+
+// deduplicatePulls returns the image work with the pulls of the same content to the same node, i.e. of images
+// resolving to the same digest for the same platform, merged into a single pull. The pull of a tagged image is
+// kept in preference to the one of an image referenced by digest, since the digest of a pulled tag is also
+// present in the node. The images of the merged pulls are the aliases of the kept pull, which is optional only
+// if all the merged pulls are
+func deduplicatePulls(work []images.ImageWorkRequest, digests map[string]string) []images.ImageWorkRequest {
+	deduplicated := []images.ImageWorkRequest{}
+	kept := map[string]int{}
+	for _, ipr := range work {
+		digest, ok := digests[ipr.Image]
+		if !ok || ipr.WorkType == images.ImageCachePurge || ipr.ImageArchive != nil {
+			deduplicated = append(deduplicated, ipr)
+			continue
+		}
+		key := ipr.Node.Labels["kubernetes.io/hostname"] + "/" + ipr.Platform + "@" + digest
+		k, ok := kept[key]
+		if !ok {
+			kept[key] = len(deduplicated)
+			deduplicated = append(deduplicated, ipr)
+			continue
+		}
+		primary := deduplicated[k]
+		if containsString(requestImages(primary), ipr.Image) {
+			continue
+		}
+		aliases := requestImages(primary)[1:]
+		if strings.Contains(primary.Image, "@") && !strings.Contains(ipr.Image, "@") {
+			aliases = append(aliases, primary.Image)
+			ipr.Optional = ipr.Optional && primary.Optional
+			primary = ipr
+		} else {
+			aliases = append(aliases, ipr.Image)
+			primary.Optional = primary.Optional && ipr.Optional
+		}
+		primary.Aliases = &aliases
+		glog.V(4).Infof("Image %s pulled to node %s along with %v (digest: %s)", primary.Image, ipr.Node.Labels["kubernetes.io/hostname"], aliases, digest)
+		deduplicated[k] = primary
+	}
+	return deduplicated
+}
+
+// requestImages returns the image of the image work request, followed by its aliases, if any
+func requestImages(iwr images.ImageWorkRequest) []string {
+	names := []string{iwr.Image}
+	if iwr.Aliases != nil {
+		names = append(names, *iwr.Aliases...)
+	}
+	return names
+}
+
+// statusImages returns the image of the image status, followed by its aliases, if any
+func statusImages(s v1alpha1.ImageNodeStatus) []string {
+	return append([]string{s.Image}, s.Aliases...)
+}
+
+// imageIdentity returns the identity of the image of the image status, i.e. its repository and the digest
+// it resolves to: the digest it is referenced by, or else the digest it was pulled with. An empty string is
+// returned if the digest is not known, e.g. the image is yet to be pulled
+func imageIdentity(s v1alpha1.ImageNodeStatus) string {
+	named, err := reference.ParseNormalizedNamed(s.Image)
+	if err != nil {
+		return ""
+	}
+	digest := s.Digest
+	if digested, ok := named.(reference.Digested); ok {
+		digest = digested.Digest().String()
+	}
+	if digest == "" {
+		return ""
+	}
+	return named.Name() + "@" + digest
+}
+
+// imagePhaseRanks orders the phases of images from the worst to the best, so that the status of images of the
+// same identity reports a failed or pending image rather than a cached one
+var imagePhaseRanks = map[v1alpha1.ImagePhase]int{
+	v1alpha1.ImagePhaseFailed:  0,
+	v1alpha1.ImagePhaseQueued:  1,
+	v1alpha1.ImagePhaseDeleted: 2,
+	v1alpha1.ImagePhaseCached:  3,
+}
+
+// expandImageIdentities returns the image statuses with the aliases of each status expanded into
+// statuses of their own, so that the status of each image can be updated separately
+func expandImageIdentities(statuses []v1alpha1.ImageNodeStatus) []v1alpha1.ImageNodeStatus {
+	expanded := []v1alpha1.ImageNodeStatus{}
+	for _, s := range statuses {
+		for _, image := range statusImages(s) {
+			e := *s.DeepCopy()
+			e.Image, e.Aliases = image, nil
+			expanded = append(expanded, e)
+		}
+	}
+	return expanded
+}
+
+// collapseImageIdentities returns the image statuses with the statuses of images of the same identity on the
+// same node, e.g. an image referenced by digest in an image list and by tag in another, collapsed into a single
+// status, sorted by image and node. The image of the collapsed status is the first tagged image, the others are
+// its aliases, and its phase is the worst of their phases. Statuses of images whose identity is not known are kept
+func collapseImageIdentities(statuses []v1alpha1.ImageNodeStatus) []v1alpha1.ImageNodeStatus {
+	collapsed := []v1alpha1.ImageNodeStatus{}
+	groups := map[string][]v1alpha1.ImageNodeStatus{}
+	var keys []string
+	for _, s := range expandImageIdentities(statuses) {
+		identity := imageIdentity(s)
+		if identity == "" {
+			collapsed = append(collapsed, s)
+			continue
+		}
+		key := s.Node + "/" + identity
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], s)
+	}
+	for _, key := range keys {
+		group := groups[key]
+		sort.SliceStable(group, func(i, j int) bool {
+			if digested := strings.Contains(group[i].Image, "@"); digested != strings.Contains(group[j].Image, "@") {
+				return !digested
+			}
+			return group[i].Image < group[j].Image
+		})
+		worst := group[0]
+		var aliases []string
+		for _, s := range group[1:] {
+			if s.Image != group[0].Image && !containsString(aliases, s.Image) {
+				aliases = append(aliases, s.Image)
+			}
+			if imagePhaseRanks[s.Phase] < imagePhaseRanks[worst.Phase] {
+				worst = s
+			}
+		}
+		if worst.Digest == "" {
+			worst.Digest = group[0].Digest
+		}
+		worst.Image, worst.Aliases = group[0].Image, aliases
+		collapsed = append(collapsed, worst)
+	}
+	sort.Slice(collapsed, func(i, j int) bool {
+		if collapsed[i].Image != collapsed[j].Image {
+			return collapsed[i].Image < collapsed[j].Image
+		}
+		return collapsed[i].Node < collapsed[j].Node
+	})
+	return collapsed
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/docker/distribution/reference"
+	"github.com/golang/glog"
+	v1alpha1 "github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha1"
+	"github.com/senthilrch/kube-fledged/pkg/registry"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// imagePatternTimeout is the max. duration of resolving the image patterns of an image cache
+const imagePatternTimeout = time.Minute
+
+// hasImagePatterns returns true if any image list of the image cache has image patterns
+func hasImagePatterns(imageCache *v1alpha1.ImageCache) bool {
+	for _, i := range imageCache.Spec.CacheSpec {
+		if len(i.ImagePatterns) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveImagePatterns resolves the image patterns of the image lists of the image cache to the images of
+// the tags matching the patterns, listed from the registries of their repositories using the credentials
+// in the image pull secrets of the image list and the image cache. Tags that are not valid in an image are
+// skipped. Patterns whose tags could not be listed are returned as failed
+func (c *Controller) resolveImagePatterns(imageCache *v1alpha1.ImageCache) ([]v1alpha1.ResolvedImagePattern, []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), imagePatternTimeout)
+	defer cancel()
+	resolved := []v1alpha1.ResolvedImagePattern{}
+	failed := []string{}
+	secrets := map[string]*corev1.Secret{}
+	now := metav1.Now()
+	for _, i := range imageCache.Spec.CacheSpec {
+		for _, pattern := range i.ImagePatterns {
+			if resolvedImages(resolved, pattern) != nil || containsString(failed, pattern) {
+				continue
+			}
+			repository, tagPattern, err := registry.ParseImagePattern(pattern)
+			if err != nil {
+				glog.Errorf("Invalid image pattern %s of image cache %s/%s: %v", pattern, imageCache.Namespace, imageCache.Name, err)
+				failed = append(failed, pattern)
+				continue
+			}
+			tags, err := c.registryClient.ListTags(ctx, repository, c.registryCredentials(imageCache, i.ImagePullSecrets, secrets))
+			if err != nil {
+				glog.Errorf("Error listing tags of image pattern %s of image cache %s/%s: %v", pattern, imageCache.Namespace, imageCache.Name, err)
+				failed = append(failed, pattern)
+				continue
+			}
+			images := []string{}
+			for _, tag := range tags {
+				if matched, _ := path.Match(tagPattern, tag); !matched {
+					continue
+				}
+				// Tags are listed by the registry, and the images end up in the commands of the jobs
+				image := repository + ":" + tag
+				if _, err := reference.ParseNormalizedNamed(image); err != nil {
+					glog.Warningf("Invalid tag %q of image pattern %s of image cache %s/%s skipped: %v", tag, pattern, imageCache.Namespace, imageCache.Name, err)
+					continue
+				}
+				images = append(images, image)
+			}
+			sort.Strings(images)
+			glog.Infof("Image pattern %s of image cache %s/%s resolved to %d images", pattern, imageCache.Namespace, imageCache.Name, len(images))
+			resolved = append(resolved, v1alpha1.ResolvedImagePattern{Pattern: pattern, Images: images, ResolvedTime: now})
+		}
+	}
+	return resolved, failed
+}
+
+// expandImagePatterns adds the images the image patterns of each image list resolved to, to the images of
+// the image list. Patterns not resolved are skipped
+func expandImagePatterns(cacheSpec []v1alpha1.CacheSpecImages, resolved []v1alpha1.ResolvedImagePattern) {
+	for k := range cacheSpec {
+		for _, pattern := range cacheSpec[k].ImagePatterns {
+			for _, image := range resolvedImages(resolved, pattern) {
+				if !containsString(cacheSpec[k].Images, image) {
+					cacheSpec[k].Images = append(cacheSpec[k].Images, image)
+				}
+			}
+		}
+	}
+}
+
+// resolvedImages returns the images the image pattern resolved to, nil if it is not resolved
+func resolvedImages(resolved []v1alpha1.ResolvedImagePattern, pattern string) []string {
+	for _, r := range resolved {
+		if r.Pattern == pattern {
+			if r.Images == nil {
+				return []string{}
+			}
+			return r.Images
+		}
+	}
+	return nil
+}
+
+// containsString returns true if the list contains the value
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
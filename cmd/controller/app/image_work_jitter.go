@@ -0,0 +1,55 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/senthilrch/kube-fledged/pkg/images"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// imageWorkJitterRateLimiter delays each image work request queued with AddRateLimited by a random
+// jitter within the window, on top of the delay of the rate limiter, so that the pulls and deletes of
+// image caches created together are spread over the window rather than all done at once. The request
+// signalling that all image work requests of an image cache are queued is delayed by the whole window,
+// so that it is still processed after them
+type imageWorkJitterRateLimiter struct {
+	workqueue.RateLimiter
+	window time.Duration
+}
+
+// newImageWorkJitterRateLimiter returns the rate limiter, or the given rate limiter if the window is 0
+func newImageWorkJitterRateLimiter(rateLimiter workqueue.RateLimiter, window time.Duration) workqueue.RateLimiter {
+	if window <= 0 {
+		return rateLimiter
+	}
+	return &imageWorkJitterRateLimiter{RateLimiter: rateLimiter, window: window}
+}
+
+func (r *imageWorkJitterRateLimiter) When(item interface{}) time.Duration {
+	delay := r.RateLimiter.When(item)
+	iwr, ok := item.(images.ImageWorkRequest)
+	if !ok {
+		return delay
+	}
+	if iwr.Image == "" && iwr.Node == nil {
+		return delay + r.window
+	}
+	return delay + time.Duration(rand.Int63n(int64(r.window)))
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"strings"
+
+	"github.com/docker/distribution/reference"
+	"github.com/golang/glog"
+	v1alpha1 "github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha1"
+	"github.com/senthilrch/kube-fledged/pkg/images"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+// expandCacheSpec returns the cache spec of the image cache with the images of each image list
+// expanded to include the images listed in the ConfigMap referenced by the image list, if any.
+// ConfigMaps (or keys) that are not found are returned as missing, in name/key format, unless
+// the reference is optional. Lines of the ConfigMaps that are not valid image references are
+// dropped, and returned as invalid in name/key: line format
+func (c *Controller) expandCacheSpec(imageCache *v1alpha1.ImageCache) ([]v1alpha1.CacheSpecImages, []string, []string, error) {
+	cacheSpec := make([]v1alpha1.CacheSpecImages, len(imageCache.Spec.CacheSpec))
+	missing := []string{}
+	invalid := []string{}
+	for k := range imageCache.Spec.CacheSpec {
+		imageCache.Spec.CacheSpec[k].DeepCopyInto(&cacheSpec[k])
+		ref := cacheSpec[k].ImagesFrom
+		if ref == nil {
+			continue
+		}
+		optional := ref.Optional != nil && *ref.Optional
+		configMap, err := c.configMapsLister.ConfigMaps(c.fledgedNameSpace).Get(ref.Name)
+		if err != nil && !apierrors.IsNotFound(err) {
+			glog.Errorf("Error getting configmap %s: %v", ref.Name, err)
+			return nil, nil, nil, err
+		}
+		value, ok := "", false
+		if err == nil {
+			value, ok = configMap.Data[ref.Key]
+		}
+		if !ok {
+			if !optional {
+				missing = append(missing, ref.Name+"/"+ref.Key)
+			}
+			continue
+		}
+		imageList, invalidLines := parseImageList(value)
+		for _, line := range invalidLines {
+			invalid = append(invalid, ref.Name+"/"+ref.Key+": "+line)
+		}
+		for _, image := range imageList {
+			duplicate := false
+			for _, i := range cacheSpec[k].Images {
+				if i == image {
+					duplicate = true
+					break
+				}
+			}
+			if !duplicate {
+				cacheSpec[k].Images = append(cacheSpec[k].Images, image)
+			}
+		}
+	}
+	return cacheSpec, missing, invalid, nil
+}
+
+// parseImageList returns the images of a newline separated list of images. Surrounding
+// whitespace is trimmed, and blank lines and lines starting with '#' are ignored. Lines
+// that are not valid image references are returned separately, since the images end up
+// in the commands of the jobs
+func parseImageList(value string) ([]string, []string) {
+	imageList, invalid := []string{}, []string{}
+	for _, line := range strings.Split(value, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, err := reference.ParseNormalizedNamed(line); err != nil {
+			invalid = append(invalid, line)
+			continue
+		}
+		imageList = append(imageList, line)
+	}
+	return imageList, invalid
+}
+
+// enqueueImageCachesOfConfigMap refreshes the image caches that list images in the ConfigMap, so
+// that the images added to the ConfigMap are pulled. Images removed from the ConfigMap are not purged.
+// When the ConfigMap is added (which includes existing ConfigMaps when the controller starts), only
+// the image caches that failed since the ConfigMap was not found are refreshed
+func (c *Controller) enqueueImageCachesOfConfigMap(obj interface{}, added bool) {
+	var configMap *corev1.ConfigMap
+	switch obj := obj.(type) {
+	case *corev1.ConfigMap:
+		configMap = obj
+	case cache.DeletedFinalStateUnknown:
+		if configMap, _ = obj.Obj.(*corev1.ConfigMap); configMap == nil {
+			return
+		}
+	default:
+		return
+	}
+	if configMap.Namespace != c.fledgedNameSpace {
+		return
+	}
+	imageCaches, err := c.imageCachesLister.List(labels.Everything())
+	if err != nil {
+		glog.Errorf("Error listing image caches: %v", err)
+		return
+	}
+	for _, imageCache := range imageCaches {
+		if !c.watched(imageCache) || !refreshable(imageCache) || !listsImagesOf(imageCache, configMap.Name) {
+			continue
+		}
+		if added && imageCache.Status.Reason != v1alpha1.ImageCacheReasonImagesConfigMapNotFound {
+			continue
+		}
+		glog.Infof("ConfigMap %s of images changed, so refreshing image cache %s/%s", configMap.Name, imageCache.Namespace, imageCache.Name)
+		c.enqueueImageCache(images.ImageCacheRefresh, imageCache, nil)
+	}
+}
+
+// listsImagesOf returns true if an image list of the image cache references the ConfigMap
+func listsImagesOf(imageCache *v1alpha1.ImageCache, configMapName string) bool {
+	for _, i := range imageCache.Spec.CacheSpec {
+		if i.ImagesFrom != nil && i.ImagesFrom.Name == configMapName {
+			return true
+		}
+	}
+	return false
+}
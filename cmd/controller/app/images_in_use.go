@@ -0,0 +1,56 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"github.com/golang/glog"
+	"github.com/senthilrch/kube-fledged/pkg/images"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// podNodeNameIndex is the index of pods by the name of their node
+const podNodeNameIndex = "nodeName"
+
+// podNodeName is the index function of pods by the name of their node
+func podNodeName(obj interface{}) ([]string, error) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok || pod.Spec.NodeName == "" {
+		return nil, nil
+	}
+	return []string{pod.Spec.NodeName}, nil
+}
+
+// podUsingImage returns the pod (namespace/name) that runs or ran the image in the node e.g. a pod of a
+// DaemonSet, if any. Empty string is returned if there is none, or pods are not watched by the controller
+func (c *Controller) podUsingImage(image string, node *corev1.Node) string {
+	if c.podIndexer == nil {
+		glog.Warningf("Image %s not checked for use by pods in node %s, since pods are not watched (--check-images-in-use)", image, node.Name)
+		return ""
+	}
+	objs, err := c.podIndexer.ByIndex(podNodeNameIndex, node.Name)
+	if err != nil {
+		glog.Errorf("Error listing pods of node %s: %v", node.Name, err)
+		return ""
+	}
+	for _, obj := range objs {
+		pod := obj.(*corev1.Pod)
+		if used, err := images.ImageUsedByPod(image, pod); err == nil && used {
+			return pod.Namespace + "/" + pod.Name
+		}
+	}
+	return ""
+}
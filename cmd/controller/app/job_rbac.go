@@ -0,0 +1,147 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"reflect"
+
+	"github.com/golang/glog"
+	v1alpha1 "github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// jobRBACName returns the name of the Role and RoleBinding of the service account of the image pull jobs of
+// the image cache. The namespace of the image cache is part of the name unless the jobs run in that namespace
+func (c *Controller) jobRBACName(imageCache *v1alpha1.ImageCache) string {
+	if c.jobNamespace(imageCache) == imageCache.Namespace {
+		return "kubefledged-imagecache-" + imageCache.Name
+	}
+	return "kubefledged-imagecache-" + imageCache.Namespace + "-" + imageCache.Name
+}
+
+// newJobRBAC returns the Role allowing the use of the pod security policy of jobs (--job-pod-security-policy), which
+// permits the hostPath mounts of the container runtime socket, and the RoleBinding of the Role to the service
+// account of the image cache, in the namespace of the jobs. The image cache owns them if in the same namespace,
+// so that they are garbage collected along with it
+func (c *Controller) newJobRBAC(imageCache *v1alpha1.ImageCache) (*rbacv1.Role, *rbacv1.RoleBinding) {
+	namespace, name := c.jobNamespace(imageCache), c.jobRBACName(imageCache)
+	meta := metav1.ObjectMeta{
+		Name:      name,
+		Namespace: namespace,
+		Labels:    map[string]string{"app": "imagecache", "imagecache": imageCache.Name, "controller": controllerAgentName},
+	}
+	if namespace == imageCache.Namespace {
+		meta.OwnerReferences = []metav1.OwnerReference{
+			*metav1.NewControllerRef(imageCache, v1alpha1.SchemeGroupVersion.WithKind("ImageCache")),
+		}
+	}
+	role := &rbacv1.Role{
+		ObjectMeta: meta,
+		Rules: []rbacv1.PolicyRule{
+			{
+				APIGroups:     []string{"policy"},
+				Resources:     []string{"podsecuritypolicies"},
+				Verbs:         []string{"use"},
+				ResourceNames: []string{c.jobPodSecurityPolicy},
+			},
+		},
+	}
+	roleBinding := &rbacv1.RoleBinding{
+		ObjectMeta: *meta.DeepCopy(),
+		Subjects: []rbacv1.Subject{
+			{Kind: rbacv1.ServiceAccountKind, Name: imageCache.Spec.ServiceAccountName, Namespace: namespace},
+		},
+		RoleRef: rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: name},
+	}
+	return role, roleBinding
+}
+
+// jobServiceAccountApproved returns true if the service account of the image cache is approved by the operator
+// (--job-service-accounts) to be bound to the pod security policy of jobs
+func (c *Controller) jobServiceAccountApproved(imageCache *v1alpha1.ImageCache) bool {
+	for _, serviceAccount := range c.jobServiceAccounts {
+		if serviceAccount == imageCache.Spec.ServiceAccountName {
+			return true
+		}
+	}
+	return false
+}
+
+// syncJobRBAC creates or updates the Role and RoleBinding of the service account of the image pull jobs of the
+// image cache, if the pod security policy of jobs is set. They are deleted if the image cache no longer has a
+// service account, or if its service account is not approved by the operator
+func (c *Controller) syncJobRBAC(imageCache *v1alpha1.ImageCache) error {
+	if c.jobPodSecurityPolicy == "" {
+		return nil
+	}
+	if imageCache.Spec.ServiceAccountName == "" {
+		return c.deleteJobRBAC(imageCache)
+	}
+	if !c.jobServiceAccountApproved(imageCache) {
+		glog.Warningf("Service account %s of imagecache(%s) is not approved (--job-service-accounts), so not binding it to pod security policy %s",
+			imageCache.Spec.ServiceAccountName, imageCache.Name, c.jobPodSecurityPolicy)
+		c.recorder.Event(imageCache, corev1.EventTypeWarning, v1alpha1.ImageCacheReasonJobServiceAccountNotApproved,
+			v1alpha1.ImageCacheMessageJobServiceAccountNotApproved+imageCache.Spec.ServiceAccountName)
+		return c.deleteJobRBAC(imageCache)
+	}
+	role, roleBinding := c.newJobRBAC(imageCache)
+	roles := c.kubeclientset.RbacV1().Roles(role.Namespace)
+	existingRole, err := roles.Get(role.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = roles.Create(role)
+	} else if err == nil && !reflect.DeepEqual(existingRole.Rules, role.Rules) {
+		existingRole = existingRole.DeepCopy()
+		existingRole.Rules = role.Rules
+		_, err = roles.Update(existingRole)
+	}
+	if err != nil {
+		glog.Errorf("Error syncing role %s/%s of imagecache(%s): %v", role.Namespace, role.Name, imageCache.Name, err)
+		return err
+	}
+	roleBindings := c.kubeclientset.RbacV1().RoleBindings(roleBinding.Namespace)
+	existingRoleBinding, err := roleBindings.Get(roleBinding.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = roleBindings.Create(roleBinding)
+	} else if err == nil && !reflect.DeepEqual(existingRoleBinding.Subjects, roleBinding.Subjects) {
+		existingRoleBinding = existingRoleBinding.DeepCopy()
+		existingRoleBinding.Subjects = roleBinding.Subjects
+		_, err = roleBindings.Update(existingRoleBinding)
+	}
+	if err != nil {
+		glog.Errorf("Error syncing role binding %s/%s of imagecache(%s): %v", roleBinding.Namespace, roleBinding.Name, imageCache.Name, err)
+		return err
+	}
+	return nil
+}
+
+// deleteJobRBAC deletes the Role and RoleBinding of the service account of the image pull jobs of the image
+// cache, if any. Those owned by the image cache are otherwise garbage collected once it is deleted
+func (c *Controller) deleteJobRBAC(imageCache *v1alpha1.ImageCache) error {
+	namespace, name := c.jobNamespace(imageCache), c.jobRBACName(imageCache)
+	if err := c.kubeclientset.RbacV1().RoleBindings(namespace).Delete(name, &metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		glog.Errorf("Error deleting role binding %s/%s of imagecache(%s): %v", namespace, name, imageCache.Name, err)
+		return err
+	}
+	if err := c.kubeclientset.RbacV1().Roles(namespace).Delete(name, &metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		glog.Errorf("Error deleting role %s/%s of imagecache(%s): %v", namespace, name, imageCache.Name, err)
+		return err
+	}
+	return nil
+}
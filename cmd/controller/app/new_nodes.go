@@ -0,0 +1,126 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"reflect"
+
+	"github.com/golang/glog"
+	v1alpha1 "github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha1"
+	"github.com/senthilrch/kube-fledged/pkg/images"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+// enqueueImageCachesOfNode queues the image caches whose images are to be cached in the node, when
+// the node joins the cluster or becomes cachable (e.g. its not-ready taint is removed once it is ready),
+// or when its labels change to be selected by an image list. Nodes listed when the controller starts
+// are not new, their images are cached when the image caches are refreshed
+func (c *Controller) enqueueImageCachesOfNode(old, new *corev1.Node) {
+	if old == nil && new.CreationTimestamp.Time.Before(c.startTime) {
+		return
+	}
+	if !c.nodeCachable(new) {
+		return
+	}
+	hostname := new.Labels["kubernetes.io/hostname"]
+	if hostname == "" {
+		return
+	}
+	imageCaches, err := c.imageCachesLister.List(labels.Everything())
+	if err != nil {
+		glog.Errorf("Error listing image caches: %v", err)
+		return
+	}
+	for _, imageCache := range imageCaches {
+		if !c.watched(imageCache) || imageCache.Spec.Paused || imageCache.DeletionTimestamp != nil ||
+			reflect.DeepEqual(imageCache.Status, v1alpha1.ImageCacheStatus{}) ||
+			imageCache.Status.Reason == v1alpha1.ImageCacheReasonImageCachePurge {
+			continue
+		}
+		newlySelected := false
+		for _, i := range imageCache.Spec.CacheSpec {
+			if selectsNode(i, new) && (old == nil || !c.nodeCachable(old) || !selectsNode(i, old)) {
+				newlySelected = true
+				break
+			}
+		}
+		if !newlySelected {
+			continue
+		}
+		key, err := cache.MetaNamespaceKeyFunc(imageCache)
+		if err != nil {
+			glog.Errorf("Error getting key of image cache %s: %v", imageCache.Name, err)
+			continue
+		}
+		glog.Infof("Node %s is cachable, so caching images of image cache %s in it", hostname, key)
+		c.workqueue.AddRateLimited(images.WorkQueueKey{WorkType: images.ImageCacheRefresh, ObjKey: key, Node: hostname})
+	}
+}
+
+// nodeCachable returns true if images can be cached in the node i.e. if it is schedulable and ready,
+// unless images are cached in unschedulable and not ready nodes as well
+func (c *Controller) nodeCachable(node *corev1.Node) bool {
+	return c.includeUnschedulableNodes || (!node.Spec.Unschedulable && nodeReady(node))
+}
+
+// selectsNode returns true if the node selector of an image list selects the node, and the node
+// is one of the node names of the image list, if any
+func selectsNode(imageList v1alpha1.CacheSpecImages, node *corev1.Node) bool {
+	if !labels.Set(imageList.NodeSelector).AsSelector().Matches(labels.Set(node.Labels)) {
+		return false
+	}
+	if len(imageList.NodeNames) == 0 {
+		return true
+	}
+	for _, name := range imageList.NodeNames {
+		if node.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// cachableInNode returns true if images of the image lists are to be cached in the node with the
+// hostname i.e. if the node is cachable and selected by an image list having images
+func (c *Controller) cachableInNode(cacheSpec []v1alpha1.CacheSpecImages, hostname string) (bool, error) {
+	nodes, err := c.selectNodes(map[string]string{"kubernetes.io/hostname": hostname})
+	if err != nil {
+		return false, err
+	}
+	if len(nodes) != 1 || !c.nodeCachable(nodes[0]) {
+		return false, nil
+	}
+	for _, i := range cacheSpec {
+		if len(i.Images) > 0 && selectsNode(i, nodes[0]) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// nodesWithHostname returns the nodes with the hostname
+func nodesWithHostname(nodes []*corev1.Node, hostname string) []*corev1.Node {
+	selected := []*corev1.Node{}
+	for _, n := range nodes {
+		if n.Labels["kubernetes.io/hostname"] == hostname {
+			selected = append(selected, n)
+		}
+	}
+	return selected
+}
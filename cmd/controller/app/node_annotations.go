@@ -0,0 +1,121 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+
+	"github.com/golang/glog"
+	v1alpha1 "github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/util/retry"
+)
+
+// cachedImagesByNode returns the images of the image statuses cached in each node, by hostname
+func cachedImagesByNode(statuses []v1alpha1.ImageNodeStatus) map[string][]string {
+	cached := map[string][]string{}
+	for _, s := range statuses {
+		if s.Phase == v1alpha1.ImagePhaseCached {
+			cached[s.Node] = append(cached[s.Node], statusImages(s)...)
+		}
+	}
+	for node := range cached {
+		sort.Strings(cached[node])
+	}
+	return cached
+}
+
+// nodeCachedImages returns the images cached in the node by each image cache, from the
+// cached images annotation of the node. An invalid annotation is treated as empty
+func nodeCachedImages(node *corev1.Node) map[string][]string {
+	cached := map[string][]string{}
+	value, ok := node.Annotations[v1alpha1.NodeCachedImagesAnnotationKey]
+	if !ok {
+		return cached
+	}
+	if err := json.Unmarshal([]byte(value), &cached); err != nil {
+		glog.Warningf("Ignoring invalid annotation %s of node %s: %v", v1alpha1.NodeCachedImagesAnnotationKey, node.Name, err)
+		return map[string][]string{}
+	}
+	return cached
+}
+
+// annotateNodes updates the entries of the image cache in the cached images annotation of the nodes
+// to the images cached in each node, as per the image statuses. Entries are removed from nodes where
+// no images of the image cache are cached, and from all nodes once the image cache is deleted. Entries
+// of other image caches are retained. Errors are logged, and do not fail the reconcile
+func (c *Controller) annotateNodes(imageCache *v1alpha1.ImageCache, statuses []v1alpha1.ImageNodeStatus) {
+	if !c.nodeAnnotations {
+		return
+	}
+	key := imageCache.Namespace + "/" + imageCache.Name
+	cached := map[string][]string{}
+	if imageCache.DeletionTimestamp == nil {
+		cached = cachedImagesByNode(statuses)
+	}
+	nodes, err := c.nodesLister.List(labels.Everything())
+	if err != nil {
+		glog.Errorf("Error listing nodes to annotate with cached images of image cache %s: %v", key, err)
+		return
+	}
+	for _, node := range nodes {
+		images := cached[node.Labels["kubernetes.io/hostname"]]
+		if current := nodeCachedImages(node)[key]; reflect.DeepEqual(current, images) || (len(current) == 0 && len(images) == 0) {
+			continue
+		}
+		if err := c.updateNodeCachedImages(node.Name, key, images); err != nil {
+			glog.Errorf("Error annotating node %s with cached images of image cache %s: %v", node.Name, key, err)
+		}
+	}
+}
+
+// updateNodeCachedImages sets the entry of the image cache in the cached images annotation of the node
+// to the images, or removes the entry if there are no images. The annotation is read from the node before
+// it is updated, and the update is retried on conflicts, so that entries of other image caches are merged
+func (c *Controller) updateNodeCachedImages(nodeName, key string, images []string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		node, err := c.kubeclientset.CoreV1().Nodes().Get(nodeName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		cached := nodeCachedImages(node)
+		if len(images) > 0 {
+			cached[key] = images
+		} else {
+			delete(cached, key)
+		}
+		nodeCopy := node.DeepCopy()
+		if len(cached) == 0 {
+			delete(nodeCopy.Annotations, v1alpha1.NodeCachedImagesAnnotationKey)
+		} else {
+			value, err := json.Marshal(cached)
+			if err != nil {
+				return err
+			}
+			if nodeCopy.Annotations == nil {
+				nodeCopy.Annotations = map[string]string{}
+			}
+			nodeCopy.Annotations[v1alpha1.NodeCachedImagesAnnotationKey] = string(value)
+		}
+		_, err = c.kubeclientset.CoreV1().Nodes().Update(nodeCopy)
+		return err
+	})
+}
@@ -0,0 +1,239 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/golang/glog"
+	v1alpha1 "github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha1"
+	"github.com/senthilrch/kube-fledged/pkg/images"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+// validateImagesFromPods returns an error if an image list of the image cache has the images of the pods of
+// a namespace other than the namespace of the image cache, unless allowed by the controller
+// (--images-from-pods-any-namespace), since the image cache would otherwise purge the images of other teams
+func (c *Controller) validateImagesFromPods(imageCache *v1alpha1.ImageCache) error {
+	if c.imagesFromPodsAnyNamespace {
+		return nil
+	}
+	for k, i := range imageCache.Spec.CacheSpec {
+		if i.ImagesFromPods != nil && i.ImagesFromPods.Namespace != imageCache.Namespace {
+			return fmt.Errorf("Namespace %s of imagesFromPods within image list %d is not the namespace of the image cache (see --images-from-pods-any-namespace)", i.ImagesFromPods.Namespace, k)
+		}
+	}
+	return nil
+}
+
+// podImagePurgeable returns false if the image of the image list at index k of the image cache was discovered
+// from pods rather than listed, and is not for the image cache to purge from the node (see pulledImageUnused).
+// Images of purge-only image caches are always purged
+func (c *Controller) podImagePurgeable(imageCache *v1alpha1.ImageCache, k int, image string, node *corev1.Node) bool {
+	if imageCache.Spec.PurgeOnly || k >= len(imageCache.Spec.CacheSpec) || imageCache.Spec.CacheSpec[k].ImagesFromPods == nil ||
+		containsString(imageCache.Spec.CacheSpec[k].Images, image) {
+		return true
+	}
+	return c.pulledImageUnused(imageCache, image, node)
+}
+
+// pulledImageUnused returns true if the image discovered from pods was pulled to the node by the image cache,
+// and no pod of the cluster needs it. Images present on the node before the image cache cached them, and
+// images needed by pods of any namespace, including pending pods, are not for the image cache to purge
+func (c *Controller) pulledImageUnused(imageCache *v1alpha1.ImageCache, image string, node *corev1.Node) bool {
+	if !imagePulled(imageCache.Status.Images, image, node.Labels["kubernetes.io/hostname"]) {
+		glog.Infof("Image %s of imagecache(%s/%s) was not pulled to node %s by kube-fledged, so not purging it", image, imageCache.Namespace, imageCache.Name, node.Name)
+		return false
+	}
+	if pod := c.podNeedingImage(image); pod != "" {
+		glog.Infof("Image %s of imagecache(%s/%s) is needed by pod %s, so not purging it from node %s", image, imageCache.Namespace, imageCache.Name, pod, node.Name)
+		return false
+	}
+	return true
+}
+
+// podNeedingImage returns a pod (namespace/name) of the cluster, in any namespace, that runs or is about to
+// run the image, including pending pods whose containers are being created. Empty string is returned if there
+// is none. If pods are not watched by the controller, every image is assumed to be needed
+func (c *Controller) podNeedingImage(image string) string {
+	if c.podIndexer == nil {
+		return "unknown (pods are not watched)"
+	}
+	for _, obj := range c.podIndexer.List() {
+		pod := obj.(*corev1.Pod)
+		if needed, err := images.ImageNeededByPod(image, pod); err == nil && needed {
+			return pod.Namespace + "/" + pod.Name
+		}
+	}
+	return ""
+}
+
+// discoverPodImages discovers the images of the running pods of the namespaces referenced by the image lists
+// of the image cache. If pods are not watched by the controller, or the pods of a namespace could not be
+// listed, the images last discovered in the namespace are retained
+func (c *Controller) discoverPodImages(imageCache *v1alpha1.ImageCache) []v1alpha1.DiscoveredPodImages {
+	discovered := []v1alpha1.DiscoveredPodImages{}
+	now := metav1.Now()
+	for _, i := range imageCache.Spec.CacheSpec {
+		if i.ImagesFromPods == nil || discoveredImages(discovered, i.ImagesFromPods.Namespace) != nil {
+			continue
+		}
+		namespace := i.ImagesFromPods.Namespace
+		if c.podIndexer == nil {
+			glog.Warningf("Images of pods of namespace %s not discovered for image cache %s/%s, since pods are not watched (--images-from-pods)", namespace, imageCache.Namespace, imageCache.Name)
+			discovered = append(discovered, lastDiscoveredPodImages(imageCache, namespace)...)
+			continue
+		}
+		objs, err := c.podIndexer.ByIndex(cache.NamespaceIndex, namespace)
+		if err != nil {
+			glog.Errorf("Error listing pods of namespace %s: %v", namespace, err)
+			discovered = append(discovered, lastDiscoveredPodImages(imageCache, namespace)...)
+			continue
+		}
+		podImageList := []string{}
+		for _, obj := range objs {
+			for _, image := range runningPodImages(obj.(*corev1.Pod)) {
+				if !containsString(podImageList, image) {
+					podImageList = append(podImageList, image)
+				}
+			}
+		}
+		sort.Strings(podImageList)
+		glog.Infof("Discovered %d images of pods of namespace %s for image cache %s/%s", len(podImageList), namespace, imageCache.Namespace, imageCache.Name)
+		discovered = append(discovered, v1alpha1.DiscoveredPodImages{Namespace: namespace, Images: podImageList, DiscoveredTime: now})
+	}
+	return discovered
+}
+
+// lastDiscoveredPodImages returns the images last discovered in the namespace for the image cache, if any
+func lastDiscoveredPodImages(imageCache *v1alpha1.ImageCache, namespace string) []v1alpha1.DiscoveredPodImages {
+	for _, d := range imageCache.Status.PodImages {
+		if d.Namespace == namespace {
+			return []v1alpha1.DiscoveredPodImages{*d.DeepCopy()}
+		}
+	}
+	return nil
+}
+
+// runningPodImages returns the images of the containers and init containers of the pod, if it is running
+func runningPodImages(pod *corev1.Pod) []string {
+	if pod.Status.Phase != corev1.PodRunning {
+		return nil
+	}
+	podImageList := []string{}
+	for _, container := range append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...) {
+		if container.Image != "" && !containsString(podImageList, container.Image) {
+			podImageList = append(podImageList, container.Image)
+		}
+	}
+	return podImageList
+}
+
+// expandPodImages adds the images discovered in the namespace of the pods of each image list, to the
+// images of the image list. Namespaces not discovered are skipped
+func expandPodImages(cacheSpec []v1alpha1.CacheSpecImages, discovered []v1alpha1.DiscoveredPodImages) {
+	for k := range cacheSpec {
+		if cacheSpec[k].ImagesFromPods == nil {
+			continue
+		}
+		for _, image := range discoveredImages(discovered, cacheSpec[k].ImagesFromPods.Namespace) {
+			if !containsString(cacheSpec[k].Images, image) {
+				cacheSpec[k].Images = append(cacheSpec[k].Images, image)
+			}
+		}
+	}
+}
+
+// discoveredImages returns the images discovered in the namespace, nil if it is not discovered
+func discoveredImages(discovered []v1alpha1.DiscoveredPodImages, namespace string) []string {
+	for _, d := range discovered {
+		if d.Namespace == namespace {
+			if d.Images == nil {
+				return []string{}
+			}
+			return d.Images
+		}
+	}
+	return nil
+}
+
+// unusedPodImages returns the images last discovered in the namespace of the pods of the image list at index
+// k of the image cache (or of the old image cache, if it is updated), that are not images of the image list
+// anymore i.e. images no longer used by the pods. Images excluded from the image cache were not cached
+func unusedPodImages(imageCache, oldImageCache *v1alpha1.ImageCache, k int, imageList []string) []string {
+	source := imageCache
+	if oldImageCache != nil {
+		source = oldImageCache
+	}
+	if k >= len(source.Spec.CacheSpec) || source.Spec.CacheSpec[k].ImagesFromPods == nil {
+		return nil
+	}
+	var unused []string
+	for _, image := range discoveredImages(imageCache.Status.PodImages, source.Spec.CacheSpec[k].ImagesFromPods.Namespace) {
+		if !containsString(imageList, image) && !imageExcluded(image, source.Spec.ExcludeImages) {
+			unused = append(unused, image)
+		}
+	}
+	return unused
+}
+
+// enqueueImageCachesOfPod refreshes the image caches with images of the pods of the namespace of the pod,
+// if the pod is running images not discovered when the image cache was last synced, so that the images
+// are cached. Images no longer used once pods are deleted are purged when the image cache is refreshed
+func (c *Controller) enqueueImageCachesOfPod(obj interface{}) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return
+	}
+	podImageList := runningPodImages(pod)
+	if len(podImageList) == 0 {
+		return
+	}
+	imageCaches, err := c.imageCachesLister.List(labels.Everything())
+	if err != nil {
+		glog.Errorf("Error listing image caches: %v", err)
+		return
+	}
+	for _, imageCache := range imageCaches {
+		if !c.watched(imageCache) || !refreshable(imageCache) || !newPodImages(imageCache, pod.Namespace, podImageList) {
+			continue
+		}
+		glog.Infof("Pod %s/%s runs images not cached by image cache %s/%s, so refreshing it", pod.Namespace, pod.Name, imageCache.Namespace, imageCache.Name)
+		c.enqueueImageCache(images.ImageCacheRefresh, imageCache, nil)
+	}
+}
+
+// newPodImages returns true if an image list of the image cache has images of the pods of the namespace,
+// and any of the images of a pod of the namespace were not discovered when the image cache was last synced
+func newPodImages(imageCache *v1alpha1.ImageCache, namespace string, podImageList []string) bool {
+	for _, i := range imageCache.Spec.CacheSpec {
+		if i.ImagesFromPods == nil || i.ImagesFromPods.Namespace != namespace {
+			continue
+		}
+		discovered := discoveredImages(imageCache.Status.PodImages, namespace)
+		for _, image := range podImageList {
+			if !containsString(discovered, image) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"sort"
+
+	"github.com/golang/glog"
+	v1alpha1 "github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha1"
+	"github.com/senthilrch/kube-fledged/pkg/images"
+	"github.com/senthilrch/kube-fledged/pkg/registry"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// estimatePulls estimates the bytes to be pulled to each node by the image pulls of the image cache,
+// from the sizes of the images in the manifests in their registries. Images already present in a node
+// are not counted. The estimate is best-effort: images whose size could not be queried, e.g. due to a
+// registry error or the estimate timing out, are counted as unknown images of the node
+func (c *Controller) estimatePulls(imageCache *v1alpha1.ImageCache, pulls []images.ImageWorkRequest) []v1alpha1.NodePullEstimate {
+	if c.pullEstimateTimeout == 0 || len(pulls) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.pullEstimateTimeout)
+	defer cancel()
+	type sizeKey struct {
+		image    string
+		platform registry.Platform
+	}
+	sizes := map[sizeKey]int64{}
+	failed := map[sizeKey]bool{}
+	secrets := map[string]*corev1.Secret{}
+	estimates := map[string]*v1alpha1.NodePullEstimate{}
+	for _, iwr := range pulls {
+		node := iwr.Node.Labels["kubernetes.io/hostname"]
+		if estimates[node] == nil {
+			estimates[node] = &v1alpha1.NodePullEstimate{Node: node}
+		}
+		if present, err := images.ImageAlreadyPresentInNode(iwr.Image, iwr.Node); err == nil && present {
+			continue
+		}
+		key := sizeKey{image: iwr.Image, platform: nodePlatform(iwr)}
+		size, ok := sizes[key]
+		if !ok && !failed[key] {
+			var err error
+			var listSecrets []corev1.LocalObjectReference
+			if iwr.ImagePullSecrets != nil {
+				listSecrets = *iwr.ImagePullSecrets
+			}
+			size, err = c.registryClient.ImageSize(ctx, iwr.Image, key.platform, c.registryCredentials(imageCache, listSecrets, secrets))
+			if err != nil {
+				glog.Warningf("Error estimating size of image %s of image cache %s/%s: %v", iwr.Image, imageCache.Namespace, imageCache.Name, err)
+				failed[key] = true
+			} else {
+				sizes[key], ok = size, true
+			}
+		}
+		if ok {
+			estimates[node].Bytes += size
+		} else {
+			estimates[node].UnknownImages++
+		}
+	}
+	pullEstimates := make([]v1alpha1.NodePullEstimate, 0, len(estimates))
+	for _, e := range estimates {
+		pullEstimates = append(pullEstimates, *e)
+	}
+	sort.Slice(pullEstimates, func(i, j int) bool {
+		return pullEstimates[i].Node < pullEstimates[j].Node
+	})
+	return pullEstimates
+}
+
+// nodePlatform returns the platform of the image pulled to the node i.e. the platform of
+// the image list, if specified, or else the OS and architecture of the node
+func nodePlatform(iwr images.ImageWorkRequest) registry.Platform {
+	if iwr.Platform != "" {
+		return registry.ParsePlatform(iwr.Platform)
+	}
+	return registry.Platform{OS: iwr.Node.Status.NodeInfo.OperatingSystem, Architecture: iwr.Node.Status.NodeInfo.Architecture}
+}
+
+// registryCredentials returns the credentials of registries in the image pull secrets of an image list
+// and of the image cache, or else in the default pull secret, as used by the image pull jobs of the image
+// list. Secrets are got only once, and secrets that could not be got are skipped
+func (c *Controller) registryCredentials(imageCache *v1alpha1.ImageCache, imageListSecrets []corev1.LocalObjectReference, secrets map[string]*corev1.Secret) map[string]registry.Credentials {
+	var refs []corev1.LocalObjectReference
+	refs = append(refs, imageListSecrets...)
+	refs = append(refs, imageCache.Spec.ImagePullSecrets...)
+	if len(refs) == 0 && c.defaultPullSecret != "" {
+		refs = append(refs, corev1.LocalObjectReference{Name: c.defaultPullSecret})
+	}
+	var pullSecrets []*corev1.Secret
+	for _, ref := range refs {
+		secret, ok := secrets[ref.Name]
+		if !ok {
+			var err error
+			if secret, err = c.kubeclientset.CoreV1().Secrets(c.jobNamespace(imageCache)).Get(ref.Name, metav1.GetOptions{}); err != nil {
+				glog.Warningf("Error getting image pull secret %s: %v", ref.Name, err)
+				secret = nil
+			}
+			secrets[ref.Name] = secret
+		}
+		if secret != nil {
+			pullSecrets = append(pullSecrets, secret)
+		}
+	}
+	return registry.CredentialsFromSecrets(pullSecrets)
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+// reconcileBackoffBaseDelay is the backoff after the first failure of an image cache
+const reconcileBackoffBaseDelay = 5 * time.Second
+
+// reconcileBackoff is the exponential backoff of image caches that fail persistently. Failed image
+// caches are reconciled (i.e. synced again, or refreshed periodically) only once their backoff expires.
+// The backoff of an image cache doubles with each failure, up to a max, and is reset once it succeeds
+type reconcileBackoff struct {
+	rateLimiter workqueue.RateLimiter
+	// until is the time till which each failed image cache, keyed by namespace/name, backs off
+	until map[string]time.Time
+	lock  sync.Mutex
+}
+
+func newReconcileBackoff(maxDelay time.Duration) *reconcileBackoff {
+	if maxDelay < reconcileBackoffBaseDelay {
+		maxDelay = reconcileBackoffBaseDelay
+	}
+	return &reconcileBackoff{
+		rateLimiter: workqueue.NewItemExponentialFailureRateLimiter(reconcileBackoffBaseDelay, maxDelay),
+		until:       map[string]time.Time{},
+	}
+}
+
+// failed records a failure of the image cache, and returns the backoff till its next reconcile
+func (b *reconcileBackoff) failed(key string) time.Duration {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	delay := b.rateLimiter.When(key)
+	b.until[key] = time.Now().Add(delay)
+	return delay
+}
+
+// succeeded resets the backoff of the image cache
+func (b *reconcileBackoff) succeeded(key string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.rateLimiter.Forget(key)
+	delete(b.until, key)
+}
+
+// backingOff returns true if the image cache should not be reconciled since its backoff has not expired
+func (b *reconcileBackoff) backingOff(key string) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	until, ok := b.until[key]
+	return ok && time.Now().Before(until)
+}
+
+// failures returns the no. of consecutive failures of the image cache
+func (b *reconcileBackoff) failures(key string) int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.rateLimiter.NumRequeues(key)
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// reconcileContexts are the contexts of the reconciles of image caches i.e. of the image pulls and
+// deletes queued by a sync, till the status of the image cache is updated with their results. The
+// image manager abandons the outstanding image work of a reconcile once its context is done
+type reconcileContexts struct {
+	// timeout of a reconcile, none if 0
+	timeout time.Duration
+	// cancels are the cancel funcs of the contexts of image caches being reconciled, keyed by namespace/name
+	cancels map[string]context.CancelFunc
+	lock    sync.Mutex
+}
+
+func newReconcileContexts(timeout time.Duration) *reconcileContexts {
+	return &reconcileContexts{
+		timeout: timeout,
+		cancels: map[string]context.CancelFunc{},
+	}
+}
+
+// start returns the context of a new reconcile of the image cache, which is done once the timeout
+// is exceeded. The context of the previous reconcile of the image cache, if any, is cancelled
+func (r *reconcileContexts) start(key string) context.Context {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if cancel, ok := r.cancels[key]; ok {
+		cancel()
+	}
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if r.timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), r.timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	r.cancels[key] = cancel
+	return ctx
+}
+
+// done releases the context of the reconcile of the image cache, once its status is updated
+func (r *reconcileContexts) done(key string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if cancel, ok := r.cancels[key]; ok {
+		cancel()
+		delete(r.cancels, key)
+	}
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/robfig/cron/v3"
+	v1alpha1 "github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha1"
+	"github.com/senthilrch/kube-fledged/pkg/images"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/cache"
+)
+
+// refreshScheduler refreshes image caches on the cron schedule specified in their spec
+type refreshScheduler struct {
+	cron    *cron.Cron
+	entries map[string]refreshScheduleEntry
+	lock    sync.Mutex
+}
+
+// refreshScheduleEntry is the scheduled refresh of an image cache
+type refreshScheduleEntry struct {
+	schedule string
+	id       cron.EntryID
+}
+
+func newRefreshScheduler() *refreshScheduler {
+	return &refreshScheduler{
+		cron:    cron.New(),
+		entries: map[string]refreshScheduleEntry{},
+	}
+}
+
+// syncRefreshSchedule adds, updates or removes the scheduled refresh of an image cache as per
+// its spec. The scheduled refresh is removed when the image cache is deleted.
+func (c *Controller) syncRefreshSchedule(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	schedule := ""
+	if imageCache, ok := obj.(*v1alpha1.ImageCache); ok && imageCache.DeletionTimestamp == nil {
+		schedule = imageCache.Spec.RefreshSchedule
+	}
+
+	s := c.refreshScheduler
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	entry, exists := s.entries[key]
+	if exists && entry.schedule == schedule {
+		return
+	}
+	if exists {
+		s.cron.Remove(entry.id)
+		delete(s.entries, key)
+		glog.Infof("Removed refresh schedule '%s' of image cache %s", entry.schedule, key)
+	}
+	if schedule == "" {
+		return
+	}
+	id, err := s.cron.AddFunc(schedule, func() { c.enqueueScheduledRefresh(key) })
+	if err != nil {
+		glog.Errorf("Error scheduling refresh of image cache %s: invalid refresh schedule '%s': %v", key, schedule, err)
+		return
+	}
+	s.entries[key] = refreshScheduleEntry{schedule: schedule, id: id}
+	glog.Infof("Scheduled refresh of image cache %s on '%s'", key, schedule)
+}
+
+// enqueueScheduledRefresh enqueues a refresh of the image cache, that pulls the images
+// even if they are already present in the nodes
+func (c *Controller) enqueueScheduledRefresh(key string) {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	imageCache, err := c.imageCachesLister.ImageCaches(namespace).Get(name)
+	if err != nil {
+		glog.Errorf("Error getting imagecache(%s) for scheduled refresh: %v", key, err)
+		return
+	}
+	if !refreshable(imageCache) {
+		glog.Infof("Skipping scheduled refresh of image cache %s", key)
+		return
+	}
+	c.workqueue.AddRateLimited(images.WorkQueueKey{
+		WorkType:        images.ImageCacheCreate,
+		ObjKey:          key,
+		ImagePullPolicy: string(corev1.PullAlways),
+	})
+	glog.V(4).Infof("enqueueScheduledRefresh::ImageCache %s queued for scheduled refresh", key)
+}
@@ -0,0 +1,203 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/golang/glog"
+	v1alpha1 "github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha1"
+	clientset "github.com/senthilrch/kube-fledged/pkg/client/clientset/versioned"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/cache"
+)
+
+// replicaLabelKey labels the replicas of image caches in remote clusters. Image caches of remote clusters
+// without this label are never updated or deleted by the controller
+const replicaLabelKey = "kubefledged.k8s.io/replica"
+
+// eventReasonReplicationFailed is the reason of the event of an image cache that could not be replicated
+// to a remote cluster
+const eventReasonReplicationFailed = "ReplicationFailed"
+
+// lastAppliedConfigAnnotationKey is the annotation of kubectl apply, which is not replicated
+const lastAppliedConfigAnnotationKey = "kubectl.kubernetes.io/last-applied-configuration"
+
+// RemoteCluster is a cluster to which the image caches handled by the controller are replicated. The images
+// of the replicas are cached in the nodes of the cluster by the kube-fledged controller of the cluster
+type RemoteCluster struct {
+	// Name of the cluster, used in logs and events
+	Name string
+	// Client is a clientset for the kubefledged.k8s.io API group of the cluster
+	Client clientset.Interface
+}
+
+// enqueueReplication queues the image cache to be replicated to the remote clusters
+func (c *Controller) enqueueReplication(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	c.replicationqueue.Add(key)
+}
+
+// runReplicationWorker replicates the image caches queued in replicationqueue until the queue is shut down
+func (c *Controller) runReplicationWorker() {
+	for c.processNextReplication() {
+	}
+}
+
+// processNextReplication replicates the next image cache queued in replicationqueue. Replications that
+// failed for any remote cluster are retried with a backoff
+func (c *Controller) processNextReplication() bool {
+	obj, shutdown := c.replicationqueue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.replicationqueue.Done(obj)
+	key := obj.(string)
+	if err := c.replicateImageCache(key); err != nil {
+		runtime.HandleError(fmt.Errorf("error replicating image cache %s: %v", key, err))
+		c.replicationqueue.AddRateLimited(key)
+		return true
+	}
+	c.replicationqueue.Forget(key)
+	return true
+}
+
+// replicateImageCache creates or updates the replicas of the image cache in the remote clusters, or deletes
+// them once the image cache is deleted. Replicas are deleted as soon as the deletion of the image cache starts,
+// so that the images are purged from the nodes of the remote clusters along with those of this cluster
+func (c *Controller) replicateImageCache(key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	imageCache, err := c.imageCachesLister.ImageCaches(namespace).Get(name)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	deleted := apierrors.IsNotFound(err) || imageCache.DeletionTimestamp != nil
+	var failed []string
+	for _, cluster := range c.remoteClusters {
+		if deleted {
+			err = deleteReplica(cluster, namespace, name)
+		} else {
+			err = syncReplica(cluster, imageCache)
+		}
+		if err != nil {
+			glog.Errorf("Error replicating image cache %s to cluster %s: %v", key, cluster.Name, err)
+			failed = append(failed, cluster.Name)
+			if !deleted {
+				c.recorder.Eventf(imageCache, corev1.EventTypeWarning, eventReasonReplicationFailed,
+					"Image cache could not be replicated to cluster %s: %v", cluster.Name, err)
+			}
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("replication to clusters %s failed", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// newReplica returns the replica of the image cache i.e. its spec, labels and annotations. Its status is not replicated
+func newReplica(imageCache *v1alpha1.ImageCache) *v1alpha1.ImageCache {
+	replica := &v1alpha1.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        imageCache.Name,
+			Namespace:   imageCache.Namespace,
+			Labels:      map[string]string{},
+			Annotations: map[string]string{},
+		},
+		Spec: *imageCache.Spec.DeepCopy(),
+	}
+	for k, v := range imageCache.Labels {
+		replica.Labels[k] = v
+	}
+	replica.Labels[replicaLabelKey] = "true"
+	for k, v := range imageCache.Annotations {
+		if k != lastAppliedConfigAnnotationKey {
+			replica.Annotations[k] = v
+		}
+	}
+	return replica
+}
+
+// syncReplica creates the replica of the image cache in the remote cluster, or updates it if the image cache
+// changed. The annotations requesting on-demand actions (refresh, purge) are removed from a replica by the
+// controller of the remote cluster once done, so they are added to the replica, but never removed from it
+func syncReplica(cluster RemoteCluster, imageCache *v1alpha1.ImageCache) error {
+	replica := newReplica(imageCache)
+	imageCaches := cluster.Client.FledgedV1alpha1().ImageCaches(imageCache.Namespace)
+	existing, err := imageCaches.Get(imageCache.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		if _, err = imageCaches.Create(replica); err == nil {
+			glog.Infof("Image cache %s/%s replicated to cluster %s", imageCache.Namespace, imageCache.Name, cluster.Name)
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if existing.Labels[replicaLabelKey] != "true" {
+		return fmt.Errorf("image cache %s/%s of the cluster is not a replica (label %s)", imageCache.Namespace, imageCache.Name, replicaLabelKey)
+	}
+	for _, key := range []string{v1alpha1.ImageCacheRefreshAnnotationKey, v1alpha1.ImageCachePurgeAnnotationKey, v1alpha1.ImageCachePurgeImageAnnotationKey} {
+		if value, ok := existing.Annotations[key]; ok {
+			if _, requested := replica.Annotations[key]; !requested {
+				replica.Annotations[key] = value
+			}
+		}
+	}
+	if reflect.DeepEqual(existing.Spec, replica.Spec) && reflect.DeepEqual(existing.Labels, replica.Labels) &&
+		reflect.DeepEqual(existing.Annotations, replica.Annotations) {
+		return nil
+	}
+	updated := existing.DeepCopy()
+	updated.Labels, updated.Annotations, updated.Spec = replica.Labels, replica.Annotations, replica.Spec
+	if _, err = imageCaches.Update(updated); err == nil {
+		glog.Infof("Replica of image cache %s/%s updated in cluster %s", imageCache.Namespace, imageCache.Name, cluster.Name)
+	}
+	return err
+}
+
+// deleteReplica deletes the replica of the image cache from the remote cluster, if any
+func deleteReplica(cluster RemoteCluster, namespace, name string) error {
+	imageCaches := cluster.Client.FledgedV1alpha1().ImageCaches(namespace)
+	existing, err := imageCaches.Get(name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if existing.Labels[replicaLabelKey] != "true" {
+		glog.Warningf("Image cache %s/%s of cluster %s is not a replica, so not deleted", namespace, name, cluster.Name)
+		return nil
+	}
+	if err = imageCaches.Delete(name, &metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	glog.Infof("Replica of image cache %s/%s deleted from cluster %s", namespace, name, cluster.Name)
+	return nil
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	v1alpha1 "github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// drainPollInterval is the interval at which the image caches under processing are checked while draining
+var drainPollInterval = time.Second
+
+// drain stops the controller from syncing image caches, other than updating the status of those under
+// processing, and waits up to the shutdown grace period for the image work of the image caches under
+// processing to complete and their status to be updated. Image caches still under processing once the
+// grace period expires are marked as aborted when the controller starts again
+func (c *Controller) drain() {
+	close(c.draining)
+	if c.shutdownGracePeriod <= 0 {
+		return
+	}
+	glog.Infof("Draining image caches under processing (grace period: %s)", c.shutdownGracePeriod)
+	var processing []string
+	err := wait.PollImmediate(drainPollInterval, c.shutdownGracePeriod, func() (bool, error) {
+		processing = c.imageCachesUnderProcessing()
+		return len(processing) == 0, nil
+	})
+	if err != nil {
+		glog.Warningf("Shutdown grace period expired, image caches still under processing: %s", strings.Join(processing, ", "))
+		return
+	}
+	glog.Info("Drained image caches under processing")
+}
+
+// isDraining returns true once the controller started draining the image caches under processing
+func (c *Controller) isDraining() bool {
+	select {
+	case <-c.draining:
+		return true
+	default:
+		return false
+	}
+}
+
+// imageCachesUnderProcessing returns the namespace/name of the watched image caches under processing
+func (c *Controller) imageCachesUnderProcessing() []string {
+	imageCaches, err := c.imageCachesLister.List(labels.Everything())
+	if err != nil {
+		glog.Errorf("Error listing image caches: %v", err)
+		return nil
+	}
+	var processing []string
+	for _, imageCache := range imageCaches {
+		if c.watched(imageCache) && imageCache.Status.Status == v1alpha1.ImageCacheActionStatusProcessing {
+			processing = append(processing, imageCache.Namespace+"/"+imageCache.Name)
+		}
+	}
+	return processing
+}
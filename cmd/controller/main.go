@@ -17,20 +17,34 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/golang/glog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kubeinformers "k8s.io/client-go/informers"
+	appsinformers "k8s.io/client-go/informers/apps/v1"
+	coreinformers "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
 
 	// Uncomment the following line to load the gcp plugin (only required to authenticate against GKE clusters).
 	// _ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	"github.com/senthilrch/kube-fledged/cmd/controller/app"
 	clientset "github.com/senthilrch/kube-fledged/pkg/client/clientset/versioned"
 	informers "github.com/senthilrch/kube-fledged/pkg/client/informers/externalversions"
+	"github.com/senthilrch/kube-fledged/pkg/criagent"
+	"github.com/senthilrch/kube-fledged/pkg/images"
+	"github.com/senthilrch/kube-fledged/pkg/logging"
+	"github.com/senthilrch/kube-fledged/pkg/metrics"
 	"github.com/senthilrch/kube-fledged/pkg/signals"
 )
 
@@ -39,50 +53,370 @@ var (
 	imagePullDeadlineDuration  time.Duration
 	dockerClientImage          string
 	imagePullPolicy            string
+	imagePullMaxRetries        int
+	maxConcurrentPulls         int
+	maxPullsPerNode            int
+	maxTotalJobs               int
+	jobBackoffLimit            int
+	jobRestartPolicy           string
+	jobCompletions             int
+	jobParallelism             int
+	jobTTLAfterFinished        time.Duration
+	jobRetention               time.Duration
+	nodeReadinessWait          time.Duration
+	shutdownGracePeriod        time.Duration
+	imageWorkJitter            time.Duration
+	containerdNamespace        string
+	insecureRegistries         string
+	jobPropagatedLabels        string
+	jobPropagatedAnnotations   string
 	fledgedNameSpace           string
 	webhookServerPort          int
+	metricsBindAddress         string
+	statusBindAddress          string
+	watchNamespaces            string
+	includeUnschedulableNodes  bool
+	imageCacheMaxBackoff       time.Duration
+	reconcileTimeout           time.Duration
+	logFormat                  string
+	pullStrategy               string
+	criAgentPort               int
+	criAgentCAFile             string
+	pullEstimateTimeout        time.Duration
+	cacheNewNodes              bool
+	deduplicatePulls           bool
+	nodeAnnotations            bool
+	jobsInImageCacheNamespace  bool
+	disablePurge               bool
+	pullJobContainerImages     string
+	pullJobContainerSocket     bool
+	keepFailedJobs             bool
+	adoptJobs                  bool
+	registryFailureThreshold   int
+	registryCircuitCooldown    time.Duration
+	deploymentWarmUp           bool
+	checkImagesInUse           bool
+	imagesFromPods             bool
+	imagesFromPodsAnyNamespace bool
+	completionWebhook          string
+	completionWebhookHosts     string
+	defaultPullSecret          string
+	jobPodSecurityPolicy       string
+	jobServiceAccounts         string
+	healthBindAddress          string
+	workQueueStallThreshold    time.Duration
+	remoteKubeconfigs          string
+	leaderElect                bool
+	leaderElectionLeaseName    string
+	leaseDuration              time.Duration
+	renewDeadline              time.Duration
+	retryPeriod                time.Duration
+)
+
+// Strategies of pulling and deleting images
+const (
+	pullStrategyJob          = "job"
+	pullStrategyCRIDaemonSet = "cri-daemonset"
 )
 
 func main() {
 	flag.Parse()
 
+	if err := logging.SetFormat(logFormat); err != nil {
+		logging.Fatalf("Error setting log format: %s", err.Error())
+	}
+	defer logging.Flush()
+
+	var criAgentClient *criagent.Client
+	switch pullStrategy {
+	case pullStrategyJob:
+	case pullStrategyCRIDaemonSet:
+		token := os.Getenv(criagent.TokenEnvVar)
+		if token == "" {
+			logging.Fatalf("Environment variable %s must be set with --pull-strategy=%s", criagent.TokenEnvVar, pullStrategyCRIDaemonSet)
+		}
+		if criAgentCAFile == "" {
+			logging.Fatalf("--cri-agent-ca-file must be set with --pull-strategy=%s", pullStrategyCRIDaemonSet)
+		}
+		tlsConfig, err := criagent.ClientTLSConfig(criAgentCAFile)
+		if err != nil {
+			logging.Fatalf("Error loading CA certificates of the CRI agents: %s", err.Error())
+		}
+		criAgentClient = criagent.NewClient(criAgentPort, token, tlsConfig)
+	default:
+		logging.Fatalf("Invalid pull strategy %q: possible values are '%s' and '%s'", pullStrategy, pullStrategyJob, pullStrategyCRIDaemonSet)
+	}
+
+	if err := images.ValidateJobRunPolicy(jobRestartPolicy, jobCompletions, jobParallelism); err != nil {
+		logging.Fatalf("Error validating job flags: %s", err.Error())
+	}
+
 	// set up signals so we handle the first shutdown signal gracefully
 	stopCh := signals.SetupSignalHandler()
 
 	cfg, err := rest.InClusterConfig()
 	if err != nil {
-		glog.Fatalf("Error building kubeconfig: %s", err.Error())
+		logging.Fatalf("Error building kubeconfig: %s", err.Error())
 	}
 
 	kubeClient, err := kubernetes.NewForConfig(cfg)
 	if err != nil {
-		glog.Fatalf("Error building kubernetes clientset: %s", err.Error())
+		logging.Fatalf("Error building kubernetes clientset: %s", err.Error())
 	}
 
 	fledgedClient, err := clientset.NewForConfig(cfg)
 	if err != nil {
-		glog.Fatalf("Error building fledged clientset: %s", err.Error())
+		logging.Fatalf("Error building fledged clientset: %s", err.Error())
 	}
 
 	kubeInformerFactory := kubeinformers.NewSharedInformerFactory(kubeClient, time.Second*30)
-	fledgedInformerFactory := informers.NewSharedInformerFactory(fledgedClient, time.Second*30)
+	// ConfigMaps of images are read from the namespace of kube-fledged only
+	fledgedNamespaceInformerFactory := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, time.Second*30,
+		kubeinformers.WithNamespace(fledgedNameSpace))
+	// The informer of image caches is scoped to the namespace when a single namespace is watched
+	namespaces := splitList(watchNamespaces)
+	var fledgedInformerOptions []informers.SharedInformerOption
+	if len(namespaces) == 1 {
+		fledgedInformerOptions = append(fledgedInformerOptions, informers.WithNamespace(namespaces[0]))
+	}
+	fledgedInformerFactory := informers.NewSharedInformerFactoryWithOptions(fledgedClient, time.Second*30, fledgedInformerOptions...)
+	remoteClusters, err := newRemoteClusters(splitList(remoteKubeconfigs))
+	if err != nil {
+		logging.Fatalf("Error building clientsets of remote clusters: %s", err.Error())
+	}
+	// Deployments are watched only if they are warmed up
+	var deploymentInformer appsinformers.DeploymentInformer
+	if deploymentWarmUp {
+		deploymentInformer = kubeInformerFactory.Apps().V1().Deployments()
+	}
+	// Pods are watched only if image caches may skip the images in use by them
+	var podInformer coreinformers.PodInformer
+	if checkImagesInUse || imagesFromPods {
+		podInformer = kubeInformerFactory.Core().V1().Pods()
+	}
 
-	controller := app.NewController(kubeClient, fledgedClient, fledgedNameSpace,
+	controller := app.NewController(kubeClient, fledgedClient,
 		kubeInformerFactory.Core().V1().Nodes(),
 		fledgedInformerFactory.Fledged().V1alpha1().ImageCaches(),
-		imageCacheRefreshFrequency, imagePullDeadlineDuration, dockerClientImage, imagePullPolicy)
+		fledgedNamespaceInformerFactory.Core().V1().ConfigMaps(),
+		podInformer, deploymentInformer,
+		app.ControllerConfig{
+			ImageManagerOptions: images.ImageManagerOptions{
+				Namespace:                     fledgedNameSpace,
+				ImagePullDeadlineDuration:     imagePullDeadlineDuration,
+				DockerClientImage:             dockerClientImage,
+				ImagePullPolicy:               imagePullPolicy,
+				MaxRetries:                    imagePullMaxRetries,
+				MaxConcurrentPulls:            maxConcurrentPulls,
+				MaxPullsPerNode:               maxPullsPerNode,
+				MaxTotalJobs:                  maxTotalJobs,
+				JobBackoffLimit:               jobBackoffLimit,
+				JobCompletions:                jobCompletions,
+				JobParallelism:                jobParallelism,
+				JobRestartPolicy:              jobRestartPolicy,
+				DefaultPullSecret:             defaultPullSecret,
+				JobTTLAfterFinished:           jobTTLAfterFinished,
+				JobRetention:                  jobRetention,
+				NodeReadinessWait:             nodeReadinessWait,
+				InsecureRegistries:            splitList(insecureRegistries),
+				PropagatedLabels:              splitList(jobPropagatedLabels),
+				PropagatedAnnotations:         splitList(jobPropagatedAnnotations),
+				CRIAgentClient:                criAgentClient,
+				JobsInImageCacheNamespace:     jobsInImageCacheNamespace,
+				DisablePurge:                  disablePurge,
+				PullJobContainerImages:        splitList(pullJobContainerImages),
+				PullJobContainerRuntimeSocket: pullJobContainerSocket,
+				KeepFailedJobs:                keepFailedJobs,
+				RegistryFailureThreshold:      registryFailureThreshold,
+				RegistryCircuitCooldown:       registryCircuitCooldown,
+			},
+			ImageCacheRefreshFrequency: imageCacheRefreshFrequency,
+			ContainerdNamespace:        containerdNamespace,
+			WatchNamespaces:            namespaces,
+			IncludeUnschedulableNodes:  includeUnschedulableNodes,
+			ImagesFromPodsAnyNamespace: imagesFromPodsAnyNamespace,
+			MaxReconcileBackoff:        imageCacheMaxBackoff,
+			ReconcileTimeout:           reconcileTimeout,
+			PullEstimateTimeout:        pullEstimateTimeout,
+			CacheNewNodes:              cacheNewNodes,
+			DeduplicatePulls:           deduplicatePulls,
+			NodeAnnotations:            nodeAnnotations,
+			AdoptJobs:                  adoptJobs,
+			ShutdownGracePeriod:        shutdownGracePeriod,
+			ImageWorkJitter:            imageWorkJitter,
+			CompletionWebhook:          completionWebhook,
+			CompletionWebhookHosts:     splitList(completionWebhookHosts),
+			JobPodSecurityPolicy:       jobPodSecurityPolicy,
+			JobServiceAccounts:         splitList(jobServiceAccounts),
+			RemoteClusters:             remoteClusters,
+		})
+
+	if metricsBindAddress != "" {
+		go serveMetrics(metricsBindAddress)
+	}
 
-	glog.Info("Starting pre-flight checks")
-	if err = controller.PreFlightChecks(); err != nil {
-		glog.Fatalf("Error running pre-flight checks: %s", err.Error())
+	if statusBindAddress != "" {
+		go serveStatus(statusBindAddress, controller.StatusHandler())
 	}
-	glog.Info("Pre-flight checks completed")
 
-	go kubeInformerFactory.Start(stopCh)
-	go fledgedInformerFactory.Start(stopCh)
+	if healthBindAddress != "" {
+		go serveHealth(healthBindAddress, controller.LivenessHandler(workQueueStallThreshold), controller.ReadinessHandler())
+	}
+
+	// The informers run until the controller exits, so that the image caches under processing are
+	// drained with up to date informer caches once the shutdown signal is caught
+	informerStopCh := make(chan struct{})
+	defer close(informerStopCh)
+	go kubeInformerFactory.Start(informerStopCh)
+	go fledgedNamespaceInformerFactory.Start(informerStopCh)
+	go fledgedInformerFactory.Start(informerStopCh)
+
+	run := func(stopCh <-chan struct{}) {
+		glog.Info("Starting pre-flight checks")
+		if err := controller.PreFlightChecks(); err != nil {
+			logging.Fatalf("Error running pre-flight checks: %s", err.Error())
+		}
+		glog.Info("Pre-flight checks completed")
+
+		if err := controller.Run(1, stopCh); err != nil {
+			logging.Fatalf("Error running controller: %s", err.Error())
+		}
+	}
+	if !leaderElect {
+		run(stopCh)
+		return
+	}
+	controller.StandBy()
+	runLeaderElection(kubeClient, func(stopCh <-chan struct{}) {
+		controller.Lead()
+		run(stopCh)
+	}, stopCh)
+}
+
+// runLeaderElection runs the controller once this replica acquires the lease of the leader, in the
+// namespace of kube-fledged, standing by until then. The replica exits once it loses the lease, so
+// that image caches are never reconciled by two replicas at a time
+func runLeaderElection(kubeClient kubernetes.Interface, run func(stopCh <-chan struct{}), stopCh <-chan struct{}) {
+	id, err := os.Hostname()
+	if err != nil {
+		logging.Fatalf("Error getting hostname for leader election: %s", err.Error())
+	}
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta:  metav1.ObjectMeta{Name: leaderElectionLeaseName, Namespace: fledgedNameSpace},
+		Client:     kubeClient.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: id},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// The lease is released as soon as the shutdown signal is caught while standing by, or else once
+	// the leader has drained the image caches under processing
+	leading := make(chan struct{})
+	go func() {
+		<-stopCh
+		select {
+		case <-leading:
+		default:
+			cancel()
+		}
+	}()
+	glog.Infof("Standing by for leadership of lease %s/%s (identity: %s)", fledgedNameSpace, leaderElectionLeaseName, id)
+	leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		Name:            leaderElectionLeaseName,
+		LeaseDuration:   leaseDuration,
+		RenewDeadline:   renewDeadline,
+		RetryPeriod:     retryPeriod,
+		ReleaseOnCancel: true,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(context.Context) {
+				close(leading)
+				glog.Infof("Elected leader of lease %s/%s", fledgedNameSpace, leaderElectionLeaseName)
+				run(stopCh)
+				cancel()
+			},
+			OnStoppedLeading: func() {
+				if ctx.Err() != nil {
+					glog.Infof("Released leadership of lease %s/%s", fledgedNameSpace, leaderElectionLeaseName)
+					return
+				}
+				logging.Fatalf("Lost leadership of lease %s/%s", fledgedNameSpace, leaderElectionLeaseName)
+			},
+			OnNewLeader: func(identity string) {
+				if identity != id {
+					glog.Infof("New leader of lease %s/%s: %s", fledgedNameSpace, leaderElectionLeaseName, identity)
+				}
+			},
+		},
+	})
+}
+
+// splitList splits a comma separated list of values, dropping empty values
+func splitList(list string) []string {
+	values := []string{}
+	for _, v := range strings.Split(list, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// newRemoteClusters returns the remote clusters of the kubeconfigs, each in <kubeconfig>[#<context>] format.
+// The current context of the kubeconfig is used if no context is specified. Clusters are named by their
+// context, or else by the file name of their kubeconfig
+func newRemoteClusters(kubeconfigs []string) ([]app.RemoteCluster, error) {
+	var clusters []app.RemoteCluster
+	for _, kubeconfig := range kubeconfigs {
+		path, context := kubeconfig, ""
+		if i := strings.LastIndex(kubeconfig, "#"); i >= 0 {
+			path, context = kubeconfig[:i], kubeconfig[i+1:]
+		}
+		name := context
+		if name == "" {
+			name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		}
+		cfg, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(&clientcmd.ClientConfigLoadingRules{ExplicitPath: path},
+			&clientcmd.ConfigOverrides{CurrentContext: context}).ClientConfig()
+		if err != nil {
+			return nil, err
+		}
+		client, err := clientset.NewForConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		clusters = append(clusters, app.RemoteCluster{Name: name, Client: client})
+	}
+	return clusters, nil
+}
+
+// serveMetrics exposes the prometheus metrics of the controller on /metrics
+func serveMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	glog.Infof("Serving metrics on %s/metrics", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		glog.Errorf("Error serving metrics: %s", err.Error())
+	}
+}
+
+// serveStatus exposes the in-flight image pulls and deletes of the controller on /status
+func serveStatus(addr string, handler http.Handler) {
+	mux := http.NewServeMux()
+	mux.Handle("/status", handler)
+	glog.Infof("Serving status on %s/status", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		glog.Errorf("Error serving status: %s", err.Error())
+	}
+}
 
-	if err = controller.Run(1, stopCh); err != nil {
-		glog.Fatalf("Error running controller: %s", err.Error())
+// serveHealth exposes the liveness and readiness probe endpoints of the controller on /healthz and /readyz
+func serveHealth(addr string, liveness, readiness http.Handler) {
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", liveness)
+	mux.Handle("/readyz", readiness)
+	glog.Infof("Serving health probes on %s/healthz and %s/readyz", addr, addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		glog.Errorf("Error serving health probes: %s", err.Error())
 	}
 }
 
@@ -91,6 +425,62 @@ func init() {
 	flag.DurationVar(&imageCacheRefreshFrequency, "image-cache-refresh-frequency", time.Minute*15, "The image cache is refreshed periodically to ensure the cache is up to date. Setting this flag to 0s will disable refresh")
 	flag.StringVar(&dockerClientImage, "cri-client-image", "senthilrch/kubefledged-cri-client:latest", "The image name of the cri client. the cri client is used when deleting images during purging the cache")
 	flag.StringVar(&imagePullPolicy, "image-pull-policy", "IfNotPresent", "Image pull policy for pulling images into the cache. Possible values are 'IfNotPresent' and 'Always'. Default value is 'IfNotPresent'. Images with no or ':latest' tag are always pulled")
+	flag.IntVar(&imagePullMaxRetries, "image-pull-max-retries", 0, "Maximum no. of times a failed image pull is retried, with exponential backoff, before it is considered to have failed. Retries are bounded by the image pull deadline duration")
+	flag.IntVar(&maxConcurrentPulls, "max-concurrent-pulls", 0, "Maximum no. of image pull jobs outstanding at a time. Creation of further jobs is deferred until outstanding jobs complete. Setting this flag to 0 will not limit the no. of jobs")
+	flag.IntVar(&maxPullsPerNode, "max-pulls-per-node", 0, "Maximum no. of image pull jobs outstanding at a time to the same node. Creation of further jobs to the node is deferred until its outstanding jobs complete. Setting this flag to 0 will not limit the no. of jobs per node")
+	flag.IntVar(&maxTotalJobs, "max-total-jobs", 0, "Maximum no. of image pull and delete jobs outstanding at a time, across all image caches. Creation of further jobs is deferred until outstanding jobs complete. Setting this flag to 0 will not limit the no. of jobs")
+	flag.IntVar(&jobBackoffLimit, "job-backoff-limit", 0, "No. of times the failed pod of an image pull or delete job is retried by the job controller, within the image pull deadline duration. Setting this flag to 0 will not retry the pod")
+	flag.StringVar(&jobRestartPolicy, "job-restart-policy", "Never", "Restart policy of the pods of image pull and delete jobs. Possible values are 'Never' and 'OnFailure'. With 'OnFailure', a failed container is restarted by the kubelet in the same pod, and the restarts count towards the job backoff limit")
+	flag.IntVar(&jobCompletions, "job-completions", 1, "No. of pods of an image pull or delete job that should succeed for the job to complete. The image work is considered to have succeeded once the first pod succeeds")
+	flag.IntVar(&jobParallelism, "job-parallelism", 1, "Maximum no. of pods of an image pull or delete job running at a time. Should be between 1 and the no. of job completions")
+	flag.DurationVar(&jobRetention, "job-retention", 0, "Duration for which completed image pull and delete jobs are kept, along with their pods, before they are deleted by the controller, to inspect the logs of their pods. Setting this flag to 0s will delete jobs as soon as the image cache is processed")
+	flag.DurationVar(&shutdownGracePeriod, "shutdown-grace-period", 0, "Maximum duration for which the controller, once it catches the shutdown signal, waits for the image pulls and deletes of the image caches under processing to complete and their status to be updated, before it exits. New image caches are not synced meanwhile. Setting this flag to 0s will abandon the image caches under processing right away")
+	flag.DurationVar(&imageWorkJitter, "image-work-jitter", 0, "Window within which the image pulls and deletes of image caches are spread, by delaying each of them by a random jitter within the window, so that image caches created or refreshed together do not pull from the registries all at once. Setting this flag to 0s will do the image pulls and deletes right away")
+	flag.DurationVar(&nodeReadinessWait, "node-readiness-wait", 0, "Duration after the image pull deadline for which image pulls are retried, if their jobs did not start since their nodes were not ready e.g. nodes added by a cluster scale-up. Setting this flag to 0s will fail such pulls at the deadline")
+	flag.DurationVar(&jobTTLAfterFinished, "job-ttl-after-finished", time.Hour, "Duration after which finished image pull and delete jobs are deleted by the TTL controller of kubernetes, in case they are not deleted by the controller. Setting this flag to 0s will not set the TTL of jobs")
+	flag.StringVar(&containerdNamespace, "containerd-namespace", "k8s.io", "The containerd namespace from which images are deleted during purging the cache, on nodes with containerd runtime")
+	flag.StringVar(&insecureRegistries, "insecure-registries", "", "Comma separated list of hosts (host[:port]) of registries from which images are pulled over plain HTTP. Images with no registry are from 'docker.io'")
+	flag.StringVar(&jobPropagatedLabels, "job-propagated-labels", "", "Comma separated list of keys of labels copied from the image cache to its image pull and delete jobs and their pods. Labels used by kube-fledged are not overwritten")
+	flag.StringVar(&jobPropagatedAnnotations, "job-propagated-annotations", "", "Comma separated list of keys of annotations copied from the image cache to its image pull and delete jobs and their pods")
+	flag.StringVar(&metricsBindAddress, "metrics-bind-address", ":8080", "The address the prometheus metrics endpoint binds to. Setting this flag to empty string will disable the metrics endpoint")
+	flag.StringVar(&watchNamespaces, "watch-namespaces", "", "Comma separated list of namespaces whose image caches are handled by the controller. Setting this flag to empty string will handle the image caches of all namespaces")
+	flag.DurationVar(&imageCacheMaxBackoff, "image-cache-max-backoff", time.Hour, "Maximum backoff of an image cache that fails persistently. A failed image cache is synced again, or refreshed periodically, after an exponential backoff that doubles with each failure up to this duration, and is reset once the image cache succeeds")
+	flag.DurationVar(&reconcileTimeout, "reconcile-timeout", 0, "Maximum duration of the reconcile of an image cache i.e. of its image pulls and deletes. After this duration, outstanding image pulls and deletes are abandoned, the image cache fails and is refreshed again after its backoff. Setting this flag to 0 will not time out reconciles")
+	flag.BoolVar(&includeUnschedulableNodes, "include-unschedulable-nodes", false, "Cache images in unschedulable (cordoned) and not ready nodes as well. By default, such nodes are skipped and reported in the status of the image cache")
+	flag.StringVar(&statusBindAddress, "status-bind-address", "", "The address the read-only status endpoint, serving the in-flight image pulls and deletes as JSON, binds to. Setting this flag to empty string will disable the status endpoint")
+	flag.StringVar(&logFormat, "log-format", logging.FormatText, "Format of the logs. Possible values are 'text' and 'json'. In 'json' format, the logs of image pull and purge jobs include the image cache, image, node, work type and status as fields")
+	flag.StringVar(&pullStrategy, "pull-strategy", pullStrategyJob, "Strategy of pulling and deleting images. Possible values are 'job' and 'cri-daemonset'. With 'cri-daemonset', images are pulled and deleted by the CRI agent DaemonSet over the CRI of containerd and cri-o nodes, instead of a job per image per node. Work not supported by the CRI agent, and work on nodes without a ready CRI agent, uses jobs")
+	flag.IntVar(&criAgentPort, "cri-agent-port", criagent.DefaultPort, "Port that the CRI agents listen on, with --pull-strategy=cri-daemonset")
+	flag.StringVar(&criAgentCAFile, "cri-agent-ca-file", "", "File containing the CA certificates that the serving certificates of the CRI agents are verified against, with --pull-strategy=cri-daemonset")
+	flag.DurationVar(&pullEstimateTimeout, "pull-estimate-timeout", 0, "Maximum duration of estimating the bytes pulled to each node by an image cache, from the sizes of its images queried from their registries. Images whose size is not known within this duration are reported as unknown. Setting this flag to 0s will disable the estimate")
+	flag.BoolVar(&cacheNewNodes, "cache-new-nodes", true, "Cache the images of image caches in nodes as soon as they join the cluster and become ready, instead of at the next refresh of the image caches")
+	flag.BoolVar(&nodeAnnotations, "annotate-nodes", false, "Annotate nodes with the images cached in them by each image cache (kubefledged.k8s.io/cached-images), e.g. for schedulers to prefer nodes that already have an image. Requires permission to update nodes")
+	flag.BoolVar(&deduplicatePulls, "deduplicate-pulls", false, "Pull the images of an image cache resolving to the same digest in their registries (e.g. an image referenced by both a tag and its digest) only once per node, with a single job whose result is shared by the images")
+	flag.BoolVar(&jobsInImageCacheNamespace, "jobs-in-imagecache-namespace", false, "Create the image pull and delete jobs of image caches in the namespaces of the image caches, instead of the namespace of kube-fledged")
+	flag.BoolVar(&disablePurge, "disable-purge", false, "Never delete images from nodes. Image purges of image caches, including purges on deletion and of removed or expired images, fail with reason 'PurgeDisabled' without creating jobs, while images are still pulled")
+	flag.StringVar(&pullJobContainerImages, "pull-job-container-images", "", "Comma-separated list of the images allowed in the pullJobContainer of image caches. An image without tag or digest allows any of its tags and digests. Pulls of image caches with any other pullJobContainer fail with reason 'PullJobContainerNotAllowed'. By default, no pullJobContainer is allowed")
+	flag.BoolVar(&pullJobContainerSocket, "pull-job-container-runtime-socket", false, "Mount the container runtime socket of the node into pullJobContainers. The socket grants full control of the container runtime, and thereby of the node, to the allowed pullJobContainer images")
+	flag.BoolVar(&keepFailedJobs, "keep-failed-jobs", false, "Keep failed image pull and delete jobs, along with their pods, for post-mortem of the failures, instead of deleting them once the image cache is processed. Succeeded jobs are still deleted. Failed jobs are then to be deleted manually, unless --job-ttl-after-finished is set")
+	flag.BoolVar(&adoptJobs, "adopt-jobs", false, "Adopt the image pull and delete jobs found when the controller starts, instead of deleting them, and refresh the image caches left under processing right away. The jobs are reused by the same image pulls and deletes, and the results of jobs that completed while the controller was down are used, instead of creating jobs again")
+	flag.IntVar(&registryFailureThreshold, "registry-failure-threshold", 0, "No. of consecutive failed image pulls from a registry after which pulls from the registry are suspended for --registry-circuit-cooldown. Suspended pulls fail with reason 'RegistryCircuitOpen' without creating jobs, and the image cache reports condition 'RegistryCircuitOpen'. Setting this flag to 0 will never suspend pulls")
+	flag.DurationVar(&registryCircuitCooldown, "registry-circuit-cooldown", time.Minute*5, "Duration for which pulls from a registry are suspended after --registry-failure-threshold consecutive failures")
+	flag.StringVar(&completionWebhook, "completion-webhook", "", "URL to which a JSON summary of an image cache is POSTed whenever its processing completes, unless the image cache has its own completion webhook e.g. for ChatOps notifications")
+	flag.StringVar(&completionWebhookHosts, "completion-webhook-hosts", "", "Comma-separated list of the hosts (host or host:port) allowed in the completion webhooks of image caches. Image caches with a completion webhook of another host are notified to the completion webhook of the controller, if any")
+	flag.StringVar(&defaultPullSecret, "default-pull-secret", "", "Name of the image pull secret of the image pull jobs of image caches whose spec and image list specify no image pull secrets. The secret is looked up in the namespace of the jobs. Setting this flag to \"\" will not set a default pull secret")
+	flag.StringVar(&jobPodSecurityPolicy, "job-pod-security-policy", "", "Pod security policy allowing the hostPath mounts of image pull jobs. For image caches with a service account, a Role allowing the use of the policy and a RoleBinding to the service account are provisioned in the namespace of the jobs, and deleted along with the image cache. Setting this flag to \"\" will not provision them")
+	flag.StringVar(&jobServiceAccounts, "job-service-accounts", "", "Comma-separated list of the service accounts, in the namespace of the jobs, approved to be bound to the pod security policy of jobs (--job-pod-security-policy). The RBAC is not provisioned for image caches with any other service account")
+	flag.BoolVar(&checkImagesInUse, "check-images-in-use", false, "Watch the pods of the cluster, so that image caches with 'skipImagesInUse' do not cache images in the nodes where pods run or ran them e.g. pods of DaemonSets. Watching all pods adds load on the controller and the API server")
+	flag.BoolVar(&imagesFromPods, "images-from-pods", false, "Watch the pods of the cluster, so that image lists with 'imagesFromPods' cache the images of the running pods of their namespace, and image caches are refreshed as soon as pods run new images. Watching all pods adds load on the controller and the API server")
+	flag.BoolVar(&imagesFromPodsAnyNamespace, "images-from-pods-any-namespace", false, "Allow 'imagesFromPods' of image caches to reference the pods of any namespace, instead of only the namespace of the image cache. Image caches may then cache, and purge once no longer used, the images of the pods of other namespaces")
+	flag.BoolVar(&deploymentWarmUp, "deployment-warm-up", false, "Cache the new images of Deployments annotated with 'kubefledged.k8s.io/warm-up: \"true\"' in the nodes selected by their pod template, as soon as their images change")
+	flag.StringVar(&healthBindAddress, "health-bind-address", ":8082", "The address the liveness (/healthz) and readiness (/readyz) probe endpoints bind to. Setting this flag to empty string will disable the probe endpoints")
+	flag.DurationVar(&workQueueStallThreshold, "work-queue-stall-threshold", time.Minute*10, "Maximum duration a work queue of the controller may go without progress, while work items are queued or under processing, or the informer caches may take to sync, before the liveness probe reports the controller as unhealthy")
+	flag.StringVar(&remoteKubeconfigs, "remote-kubeconfigs", "", "Comma separated list of kubeconfigs of remote clusters, each in <kubeconfig>[#<context>] format, to which the image caches handled by the controller are replicated. The images of the replicas are cached by the kube-fledged controllers of the remote clusters")
+	flag.BoolVar(&leaderElect, "leader-elect", false, "Elect a leader among the replicas of the controller, using a lease in the namespace of kube-fledged, so that only the leader reconciles image caches. The other replicas stand by until they acquire the lease. Enable this flag to run more than one replica for high availability")
+	flag.StringVar(&leaderElectionLeaseName, "leader-election-lease-name", "kubefledged-controller", "Name of the lease used for leader election")
+	flag.DurationVar(&leaseDuration, "leader-election-lease-duration", time.Second*15, "Duration for which standby replicas wait, after the leader last renewed the lease, before acquiring it")
+	flag.DurationVar(&renewDeadline, "leader-election-renew-deadline", time.Second*10, "Duration within which the leader must renew the lease, failing which it gives up leadership and exits. Must be less than the lease duration")
+	flag.DurationVar(&retryPeriod, "leader-election-retry-period", time.Second*2, "Interval at which replicas attempt to acquire or renew the lease")
 	if fledgedNameSpace = os.Getenv("KUBEFLEDGED_NAMESPACE"); fledgedNameSpace == "" {
 		fledgedNameSpace = "kube-fledged"
 	}
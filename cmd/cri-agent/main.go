@@ -0,0 +1,64 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/golang/glog"
+	"github.com/senthilrch/kube-fledged/pkg/criagent"
+)
+
+var (
+	port            int
+	runtimeEndpoint string
+	tlsCertFile     string
+	tlsKeyFile      string
+)
+
+func init() {
+	flag.IntVar(&port, "port", criagent.DefaultPort, "Port that the CRI agent listens on. Should be the same as the --cri-agent-port flag of the controller")
+	flag.StringVar(&runtimeEndpoint, "runtime-endpoint", "unix:///run/containerd/containerd.sock", "Endpoint of the CRI ImageService of the container runtime of the node e.g. 'unix:///var/run/crio/crio.sock' for cri-o")
+	flag.StringVar(&tlsCertFile, "tls-cert-file", "", "File containing the serving certificate of the CRI agent, issued for the name 'kubefledged-cri-agent'")
+	flag.StringVar(&tlsKeyFile, "tls-key-file", "", "File containing the private key of the serving certificate of the CRI agent")
+}
+
+func main() {
+	flag.Parse()
+
+	token := os.Getenv(criagent.TokenEnvVar)
+	if token == "" {
+		glog.Fatalf("Environment variable %s is not set", criagent.TokenEnvVar)
+	}
+	if tlsCertFile == "" || tlsKeyFile == "" {
+		glog.Fatalf("--tls-cert-file and --tls-key-file must be set")
+	}
+	agent := criagent.NewAgent(runtimeEndpoint, token)
+	server := &http.Server{
+		Addr:      ":" + strconv.Itoa(port),
+		Handler:   agent.Handler(),
+		TLSConfig: &tls.Config{MinVersion: tls.VersionTLS12},
+	}
+	glog.Infof("CRI agent listening on port %d (runtime endpoint: %s)", port, runtimeEndpoint)
+	if err := server.ListenAndServeTLS(tlsCertFile, tlsKeyFile); err != nil {
+		glog.Fatalf("Error serving CRI agent: %s", err.Error())
+	}
+}
@@ -0,0 +1,249 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// kubectl-fledged is a kubectl plugin for requesting on-demand actions on image caches
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha1"
+	clientset "github.com/senthilrch/kube-fledged/pkg/client/clientset/versioned"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const usage = `Usage: kubectl fledged refresh <imagecache> [flags]
+       kubectl fledged purge <imagecache> --image <image> --node <node> [flags]
+       kubectl fledged images [flags]
+
+Commands:
+  refresh    Refresh the image cache i.e. pull the images of the cache to the nodes again
+  purge      Purge a single image of the image cache from a node e.g. when the cached image is corrupt
+  images     List the images cached by all image caches across the cluster, and the nodes caching them
+
+Flags:
+`
+
+func main() {
+	flags := flag.NewFlagSet("kubectl-fledged", flag.ExitOnError)
+	kubeconfig := flags.String("kubeconfig", "", "Path to the kubeconfig file. Defaults to $KUBECONFIG or ~/.kube/config")
+	namespace := flags.String("namespace", "", "Namespace of the image cache. Defaults to the namespace of the current context")
+	flags.StringVar(namespace, "n", "", "Shorthand for --namespace")
+	image := flags.String("image", "", "Image to be purged, as listed in the status of the image cache (purge only)")
+	node := flags.String("node", "", "Node from which the image is purged (purge only)")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flags.PrintDefaults()
+	}
+
+	args := os.Args[1:]
+	command, name := "", ""
+	switch {
+	case len(args) >= 1 && args[0] == "images":
+		command, args = args[0], args[1:]
+	case len(args) >= 2 && (args[0] == "refresh" || args[0] == "purge"):
+		command, name, args = args[0], args[1], args[2:]
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+	flags.Parse(args)
+	if command == "purge" && (*image == "" || *node == "") {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = *kubeconfig
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{})
+	if *namespace == "" {
+		ns, _, err := clientConfig.Namespace()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error getting namespace of current context: %s\n", err.Error())
+			os.Exit(1)
+		}
+		*namespace = ns
+	}
+	cfg, err := clientConfig.ClientConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error building kubeconfig: %s\n", err.Error())
+		os.Exit(1)
+	}
+	fledgedClient, err := clientset.NewForConfig(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error building fledged clientset: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	if command == "images" {
+		cachedImages, err := listCachedImages(fledgedClient)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error listing cached images: %s\n", err.Error())
+			os.Exit(1)
+		}
+		printCachedImages(os.Stdout, cachedImages)
+		return
+	}
+	if command == "purge" {
+		if err := purgeImage(fledgedClient, *namespace, name, *image, *node); err != nil {
+			fmt.Fprintf(os.Stderr, "Error purging image %s from node %s: %s\n", *image, *node, err.Error())
+			os.Exit(1)
+		}
+		fmt.Printf("imagecache.kubefledged.k8s.io/%s purge of image %s from node %s requested\n", name, *image, *node)
+		return
+	}
+	if err := refreshImageCache(fledgedClient, *namespace, name); err != nil {
+		fmt.Fprintf(os.Stderr, "Error refreshing image cache %s/%s: %s\n", *namespace, name, err.Error())
+		os.Exit(1)
+	}
+	fmt.Printf("imagecache.kubefledged.k8s.io/%s refresh requested\n", name)
+}
+
+// refreshImageCache annotates the image cache to request the controller to refresh it. The
+// controller removes the annotation once the refresh completes, so a refresh cannot be requested
+// while another one is in progress
+func refreshImageCache(fledgedClient clientset.Interface, namespace, name string) error {
+	imageCache, err := fledgedClient.FledgedV1alpha1().ImageCaches(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if _, exists := imageCache.Annotations[v1alpha1.ImageCacheRefreshAnnotationKey]; exists {
+		return fmt.Errorf("refresh is already in progress")
+	}
+	if imageCache.Status.Status == v1alpha1.ImageCacheActionStatusProcessing {
+		return fmt.Errorf("image cache is under processing, retry after some time")
+	}
+	return annotateImageCache(fledgedClient, namespace, name, v1alpha1.ImageCacheRefreshAnnotationKey, "")
+}
+
+// purgeImage annotates the image cache to request the controller to purge a single image from a node.
+// The image should be cached in the node as per the status of the image cache
+func purgeImage(fledgedClient clientset.Interface, namespace, name, image, node string) error {
+	imageCache, err := fledgedClient.FledgedV1alpha1().ImageCaches(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if _, exists := imageCache.Annotations[v1alpha1.ImageCachePurgeImageAnnotationKey]; exists {
+		return fmt.Errorf("purge of an image is already in progress")
+	}
+	if imageCache.Status.Status == v1alpha1.ImageCacheActionStatusProcessing {
+		return fmt.Errorf("image cache is under processing, retry after some time")
+	}
+	cached := false
+	for _, s := range imageCache.Status.Images {
+		for _, i := range append([]string{s.Image}, s.Aliases...) {
+			if i == image && s.Node == node && s.Phase != v1alpha1.ImagePhaseDeleted {
+				cached = true
+			}
+		}
+	}
+	if !cached {
+		return fmt.Errorf("image is not cached in the node by the image cache")
+	}
+	return annotateImageCache(fledgedClient, namespace, name, v1alpha1.ImageCachePurgeImageAnnotationKey, image+"@"+node)
+}
+
+// annotateImageCache adds the annotation to the image cache
+func annotateImageCache(fledgedClient clientset.Interface, namespace, name, key, value string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				key: value,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = fledgedClient.FledgedV1alpha1().ImageCaches(namespace).Patch(name, types.MergePatchType, patch)
+	return err
+}
+
+// cachedImage is an image cached by one or more image caches across the cluster
+type cachedImage struct {
+	Image string
+	// Nodes in which the image is cached
+	Nodes []string
+	// ImageCaches caching the image, in namespace/name format
+	ImageCaches []string
+}
+
+// listCachedImages walks the statuses of all image caches across the cluster, and returns the distinct
+// images currently cached sorted by image, along with the nodes and image caches caching each image.
+// Images cached by more than one image cache indicate redundant caching
+func listCachedImages(fledgedClient clientset.Interface) ([]cachedImage, error) {
+	imageCacheList, err := fledgedClient.FledgedV1alpha1().ImageCaches(metav1.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	nodes := map[string]map[string]bool{}
+	imageCaches := map[string]map[string]bool{}
+	for _, imageCache := range imageCacheList.Items {
+		for _, s := range imageCache.Status.Images {
+			if s.Phase != v1alpha1.ImagePhaseCached {
+				continue
+			}
+			// Aliases of an image are listed as distinct images, as they are referred to by their own names
+			for _, image := range append([]string{s.Image}, s.Aliases...) {
+				if nodes[image] == nil {
+					nodes[image] = map[string]bool{}
+					imageCaches[image] = map[string]bool{}
+				}
+				nodes[image][s.Node] = true
+				imageCaches[image][imageCache.Namespace+"/"+imageCache.Name] = true
+			}
+		}
+	}
+	cachedImages := make([]cachedImage, 0, len(nodes))
+	for image := range nodes {
+		cachedImages = append(cachedImages, cachedImage{
+			Image:       image,
+			Nodes:       sortedKeys(nodes[image]),
+			ImageCaches: sortedKeys(imageCaches[image]),
+		})
+	}
+	sort.Slice(cachedImages, func(i, j int) bool { return cachedImages[i].Image < cachedImages[j].Image })
+	return cachedImages, nil
+}
+
+// sortedKeys returns the keys of the set in sorted order
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// printCachedImages prints the cached images as a table with the no. of nodes caching each image
+func printCachedImages(out io.Writer, cachedImages []cachedImage) {
+	w := tabwriter.NewWriter(out, 0, 8, 3, ' ', 0)
+	fmt.Fprintln(w, "IMAGE\tNODES\tIMAGECACHES")
+	for _, i := range cachedImages {
+		fmt.Fprintf(w, "%s\t%d\t%s\n", i.Image, len(i.Nodes), strings.Join(i.ImageCaches, ","))
+	}
+	w.Flush()
+}
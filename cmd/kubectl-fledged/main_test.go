@@ -0,0 +1,235 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha1"
+	kubefledgedclientsetfake "github.com/senthilrch/kube-fledged/pkg/client/clientset/versioned/fake"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	core "k8s.io/client-go/testing"
+)
+
+func TestRefreshImageCache(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		status      v1alpha1.ImageCacheActionStatus
+		imageCache  string
+		expectErr   bool
+	}{
+		{
+			name:       "#1: Refresh requested",
+			status:     v1alpha1.ImageCacheActionStatusSucceeded,
+			imageCache: "foo",
+		},
+		{
+			name:        "#2: Refresh already in progress",
+			annotations: map[string]string{v1alpha1.ImageCacheRefreshAnnotationKey: ""},
+			status:      v1alpha1.ImageCacheActionStatusSucceeded,
+			imageCache:  "foo",
+			expectErr:   true,
+		},
+		{
+			name:       "#3: Image cache under processing",
+			status:     v1alpha1.ImageCacheActionStatusProcessing,
+			imageCache: "foo",
+			expectErr:  true,
+		},
+		{
+			name:       "#4: Image cache not found",
+			status:     v1alpha1.ImageCacheActionStatusSucceeded,
+			imageCache: "bar",
+			expectErr:  true,
+		},
+	}
+	for _, test := range tests {
+		imageCache := &v1alpha1.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "foo",
+				Namespace:   "kube-fledged",
+				Annotations: test.annotations,
+			},
+			Status: v1alpha1.ImageCacheStatus{
+				Status: test.status,
+			},
+		}
+		var patch []byte
+		fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
+		fakefledgedclientset.AddReactor("get", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			if action.(core.GetAction).GetName() != imageCache.Name {
+				return true, nil, apierrors.NewNotFound(v1alpha1.Resource("imagecaches"), action.(core.GetAction).GetName())
+			}
+			return true, imageCache, nil
+		})
+		fakefledgedclientset.AddReactor("patch", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			patch = action.(core.PatchAction).GetPatch()
+			return true, imageCache, nil
+		})
+		err := refreshImageCache(fakefledgedclientset, "kube-fledged", test.imageCache)
+		if (err != nil) != test.expectErr {
+			t.Errorf("Test: %s failed: expectErr=%t, actualErr=%v", test.name, test.expectErr, err)
+			continue
+		}
+		expectedPatch := ""
+		if !test.expectErr {
+			expectedPatch = `{"metadata":{"annotations":{"kubefledged.k8s.io/refresh-imagecache":""}}}`
+		}
+		if string(patch) != expectedPatch {
+			t.Errorf("Test: %s failed: expectedPatch=%q, actualPatch=%q", test.name, expectedPatch, string(patch))
+		}
+	}
+}
+
+func TestPurgeImage(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		status      v1alpha1.ImageCacheActionStatus
+		image       string
+		node        string
+		expectErr   bool
+	}{
+		{
+			name:   "#1: Purge requested",
+			status: v1alpha1.ImageCacheActionStatusSucceeded,
+			image:  "nginx:1.17",
+			node:   "node1",
+		},
+		{
+			name:        "#2: Purge already in progress",
+			annotations: map[string]string{v1alpha1.ImageCachePurgeImageAnnotationKey: "nginx:1.17@node2"},
+			status:      v1alpha1.ImageCacheActionStatusSucceeded,
+			image:       "nginx:1.17",
+			node:        "node1",
+			expectErr:   true,
+		},
+		{
+			name:      "#3: Image cache under processing",
+			status:    v1alpha1.ImageCacheActionStatusProcessing,
+			image:     "nginx:1.17",
+			node:      "node1",
+			expectErr: true,
+		},
+		{
+			name:      "#4: Image not cached in node",
+			status:    v1alpha1.ImageCacheActionStatusSucceeded,
+			image:     "nginx:1.17",
+			node:      "node2",
+			expectErr: true,
+		},
+		{
+			name:      "#5: Image already deleted from node",
+			status:    v1alpha1.ImageCacheActionStatusSucceeded,
+			image:     "redis:5",
+			node:      "node1",
+			expectErr: true,
+		},
+	}
+	for _, test := range tests {
+		imageCache := &v1alpha1.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "foo",
+				Namespace:   "kube-fledged",
+				Annotations: test.annotations,
+			},
+			Status: v1alpha1.ImageCacheStatus{
+				Status: test.status,
+				Images: []v1alpha1.ImageNodeStatus{
+					{Image: "nginx:1.17", Node: "node1", Phase: v1alpha1.ImagePhaseCached},
+					{Image: "redis:5", Node: "node1", Phase: v1alpha1.ImagePhaseDeleted},
+				},
+			},
+		}
+		var patch []byte
+		fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
+		fakefledgedclientset.AddReactor("get", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			return true, imageCache, nil
+		})
+		fakefledgedclientset.AddReactor("patch", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			patch = action.(core.PatchAction).GetPatch()
+			return true, imageCache, nil
+		})
+		err := purgeImage(fakefledgedclientset, "kube-fledged", "foo", test.image, test.node)
+		if (err != nil) != test.expectErr {
+			t.Errorf("Test: %s failed: expectErr=%t, actualErr=%v", test.name, test.expectErr, err)
+			continue
+		}
+		expectedPatch := ""
+		if !test.expectErr {
+			expectedPatch = `{"metadata":{"annotations":{"kubefledged.k8s.io/purge-image":"nginx:1.17@node1"}}}`
+		}
+		if string(patch) != expectedPatch {
+			t.Errorf("Test: %s failed: expectedPatch=%q, actualPatch=%q", test.name, expectedPatch, string(patch))
+		}
+	}
+}
+
+func TestListCachedImages(t *testing.T) {
+	imageCacheList := &v1alpha1.ImageCacheList{
+		Items: []v1alpha1.ImageCache{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "team-a"},
+				Status: v1alpha1.ImageCacheStatus{
+					Images: []v1alpha1.ImageNodeStatus{
+						{Image: "nginx:1.17", Node: "node1", Phase: v1alpha1.ImagePhaseCached},
+						{Image: "nginx:1.17", Node: "node2", Phase: v1alpha1.ImagePhaseCached},
+						{Image: "redis:5", Node: "node1", Phase: v1alpha1.ImagePhaseFailed},
+					},
+				},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "bar", Namespace: "team-b"},
+				Status: v1alpha1.ImageCacheStatus{
+					Images: []v1alpha1.ImageNodeStatus{
+						{Image: "nginx:1.17", Node: "node2", Phase: v1alpha1.ImagePhaseCached},
+						{Image: "busybox:1.31", Node: "node1", Phase: v1alpha1.ImagePhaseCached},
+						{Image: "redis:5", Node: "node2", Phase: v1alpha1.ImagePhaseDeleted},
+					},
+				},
+			},
+		},
+	}
+	fakefledgedclientset := &kubefledgedclientsetfake.Clientset{}
+	fakefledgedclientset.AddReactor("list", "imagecaches", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+		return true, imageCacheList, nil
+	})
+	cachedImages, err := listCachedImages(fakefledgedclientset)
+	if err != nil {
+		t.Fatalf("Test failed: expectedError=nil, actualError=%s", err.Error())
+	}
+	expected := []cachedImage{
+		{Image: "busybox:1.31", Nodes: []string{"node1"}, ImageCaches: []string{"team-b/bar"}},
+		{Image: "nginx:1.17", Nodes: []string{"node1", "node2"}, ImageCaches: []string{"team-a/foo", "team-b/bar"}},
+	}
+	if !reflect.DeepEqual(cachedImages, expected) {
+		t.Errorf("Test failed: expected %+v, actual %+v", expected, cachedImages)
+	}
+	var out bytes.Buffer
+	printCachedImages(&out, cachedImages)
+	expectedOut := "IMAGE          NODES   IMAGECACHES\n" +
+		"busybox:1.31   1       team-b/bar\n" +
+		"nginx:1.17     2       team-a/foo,team-b/bar\n"
+	if out.String() != expectedOut {
+		t.Errorf("Test failed: expected output %q, actual %q", expectedOut, out.String())
+	}
+}
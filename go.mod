@@ -3,8 +3,12 @@ module github.com/senthilrch/kube-fledged
 go 1.13
 
 require (
+	github.com/docker/distribution v2.7.1+incompatible
 	github.com/golang/glog v0.0.0-20160126235308-23def4e6c14b
 	github.com/imdario/mergo v0.3.8 // indirect
+	github.com/opencontainers/go-digest v1.0.0 // indirect
+	github.com/prometheus/client_golang v1.2.1
+	github.com/robfig/cron/v3 v3.0.1
 	golang.org/x/oauth2 v0.0.0-20200107190931-bf48bf16ab8d // indirect
 	golang.org/x/time v0.0.0-20191024005414-555d28b269f0 // indirect
 	k8s.io/api v0.17.2
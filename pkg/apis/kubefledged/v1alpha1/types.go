@@ -33,37 +33,387 @@ type ImageCache struct {
 	Status ImageCacheStatus `json:"status,omitempty"`
 }
 
+// Annotations that request an on-demand action on an image cache. The controller removes
+// the annotation once the action completes
+const (
+	// ImageCacheRefreshAnnotationKey requests the image cache to be refreshed
+	ImageCacheRefreshAnnotationKey = "kubefledged.k8s.io/refresh-imagecache"
+	// ImageCachePurgeAnnotationKey requests the images in the image cache to be purged
+	ImageCachePurgeAnnotationKey = "kubefledged.k8s.io/purge-imagecache"
+	// ImageCachePurgeImageAnnotationKey requests a single image to be purged from a node. The value
+	// of the annotation is the image and the node in <image>@<node> format e.g. nginx:1.17@node1
+	ImageCachePurgeImageAnnotationKey = "kubefledged.k8s.io/purge-image"
+)
+
+// NodeCachedImagesAnnotationKey is the annotation of nodes listing the images cached in the node, if node
+// annotations are enabled in the controller. The value of the annotation is a JSON object mapping the
+// namespace/name of each image cache to the images of the image cache cached in the node
+const NodeCachedImagesAnnotationKey = "kubefledged.k8s.io/cached-images"
+
+// DeploymentWarmUpAnnotationKey opts a Deployment in to having the new images of its pod template
+// cached in the nodes when they change, if deployment warm-up is enabled in the controller. The
+// value of the annotation must be "true"
+const DeploymentWarmUpAnnotationKey = "kubefledged.k8s.io/warm-up"
+
+// CredentialsSecretLabelKey is the label of secrets in the namespace of kube-fledged that may be used as the
+// credentials secret of image caches. The value of the label must be "true". Secrets in the namespaces of image
+// caches, with the image pull jobs in those namespaces, need no label
+const CredentialsSecretLabelKey = "kubefledged.k8s.io/credentials-secret"
+
 // CacheSpecImages specifies the Images to be cached
 type CacheSpecImages struct {
-	Images       []string          `json:"images"`
-	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	Images []string `json:"images,omitempty"`
+	// ImagesFrom references a key of a ConfigMap in the namespace of kube-fledged, whose value is a newline
+	// separated list of images. The images are cached in addition to Images. Blank lines and lines starting
+	// with '#' are ignored
+	ImagesFrom *corev1.ConfigMapKeySelector `json:"imagesFrom,omitempty"`
+	// ImagesFromPods references a namespace, the images of whose running pods are discovered when the image cache
+	// is created, updated or refreshed. The images are cached in addition to Images, and images no longer used by
+	// the pods are purged when the image cache is refreshed
+	ImagesFromPods *PodImagesSource `json:"imagesFromPods,omitempty"`
+	// ImagePatterns are images whose tag is a glob pattern e.g. myrepo/app:v1.*, resolved to the images of the
+	// matching tags in the registry of the repository when the image cache is created, updated or refreshed.
+	// The images are cached in addition to Images
+	ImagePatterns []string          `json:"imagePatterns,omitempty"`
+	NodeSelector  map[string]string `json:"nodeSelector,omitempty"`
+	// NodeNames restricts the images of this list to the nodes with these names, out of the nodes selected
+	// by NodeSelector. Names of nodes not found are reported in the skipped nodes of the status
+	NodeNames []string `json:"nodeNames,omitempty"`
+	// ImagePullSecrets are used in addition to the ones in ImageCacheSpec when pulling the images of this list
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+	// PullDeadline overrides the controller's image pull deadline duration for the images of this list
+	PullDeadline *metav1.Duration `json:"pullDeadline,omitempty"`
+	// ImagePullPolicy overrides the controller's image pull policy for the images of this list
+	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
+	// Platform (os/arch[/variant]) of the images of this list to be pulled, instead of the native platform of the nodes
+	Platform string `json:"platform,omitempty"`
+	// Mirrors are registries (with an optional path prefix e.g. mirror.local:5000/dockerhub) tried in order
+	// when the images of this list cannot be pulled from their own registries. An image is pulled from a
+	// mirror by its path and tag or digest, and tagged with its own name once pulled
+	Mirrors []string `json:"mirrors,omitempty"`
+	// MaxAge is the duration after which the images of this list are purged from the nodes. Expiry is
+	// checked when the image cache is refreshed, and images still referenced by other image lists are retained
+	MaxAge *metav1.Duration `json:"maxAge,omitempty"`
+	// ImageArchive loads the images of this list from image archives on a volume, instead of pulling them from registries
+	ImageArchive *ImageArchive `json:"imageArchive,omitempty"`
+	// Optional images are cached on a best effort basis: failures to pull them are reported in the status,
+	// but the image cache does not fail due to them
+	Optional bool `json:"optional,omitempty"`
+	// Priority of the images of this list. Images of lists with higher priority are queued to be pulled
+	// before those of lists with lower priority, and lists with the same priority in the order of the spec
+	Priority int32 `json:"priority,omitempty"`
+	// DeviceResources are extended resources (e.g. nvidia.com/gpu) requested by the image pull jobs of this list, for
+	// images that need a device plugin to be pulled. Images of this list are cached only in the selected nodes with
+	// the resources allocatable, and the jobs tolerate the taints of the resources
+	DeviceResources corev1.ResourceList `json:"deviceResources,omitempty"`
+}
+
+// ImageArchive is a volume of image archives (docker save tarballs or OCI image layouts in tar format) from which
+// images are loaded into the nodes. Exactly one of HostPath and PersistentVolumeClaim should be specified. The
+// volume is mounted at /var/lib/kubefledged/archives, and the archive of an image is expected at the path
+// <image>.tar relative to the mount path, with '/', ':' and '@' in the image replaced by '_'
+type ImageArchive struct {
+	// HostPath is the directory of the archives on the nodes
+	HostPath string `json:"hostPath,omitempty"`
+	// PersistentVolumeClaim is the name of the claim of the archives, in the namespace of kube-fledged
+	PersistentVolumeClaim string `json:"persistentVolumeClaim,omitempty"`
+	// Command overrides the command that loads the archive of the image. The image and the path of its
+	// archive are available in the IMAGE and IMAGE_ARCHIVE environment variables
+	Command []string `json:"command,omitempty"`
+}
+
+// PodImagesSource references the pods whose images are cached by an image list
+type PodImagesSource struct {
+	// Namespace of the pods
+	Namespace string `json:"namespace"`
 }
 
 // ImageCacheSpec is the spec for a ImageCache resource
 type ImageCacheSpec struct {
 	CacheSpec        []CacheSpecImages             `json:"cacheSpec"`
 	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+	// PullDeadline overrides the controller's image pull deadline duration for the images of all the lists of this
+	// image cache. The pull deadline of an image list takes precedence
+	PullDeadline *metav1.Duration `json:"pullDeadline,omitempty"`
+	// JobResources are the compute resources of the containers of image pull and delete jobs
+	JobResources *corev1.ResourceRequirements `json:"jobResources,omitempty"`
+	// Tolerations of image pull and delete jobs. Jobs tolerate all taints if not specified
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+	// RefreshSchedule is a cron expression on which the images are pulled again, irrespective of the image pull policy
+	RefreshSchedule string `json:"refreshSchedule,omitempty"`
+	// DryRun plans the image pull and delete jobs in the status without creating them
+	DryRun bool `json:"dryRun,omitempty"`
+	// PullJobContainer overrides the container that pulls the images in image pull jobs
+	PullJobContainer *PullJobContainer `json:"pullJobContainer,omitempty"`
+	// PriorityClassName is the priority class of the pods of image pull and delete jobs
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+	// ServiceAccountName is the service account of the pods of image pull jobs e.g. one bound to a cloud
+	// IAM role for pulling images from the registry of the cloud provider without image pull secrets
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+	// SecurityContext of the containers of image pull and delete jobs
+	SecurityContext *corev1.SecurityContext `json:"securityContext,omitempty"`
+	// PodSecurityContext of the pods of image pull and delete jobs
+	PodSecurityContext *corev1.PodSecurityContext `json:"podSecurityContext,omitempty"`
+	// DNSPolicy of the pods of image pull jobs e.g. None, with DNSConfig, for registries resolvable only via a specific DNS
+	DNSPolicy corev1.DNSPolicy `json:"dnsPolicy,omitempty"`
+	// DNSConfig of the pods of image pull jobs
+	DNSConfig *corev1.PodDNSConfig `json:"dnsConfig,omitempty"`
+	// PurgeOnly image caches only purge their images from the nodes (e.g. known vulnerable images), and never cache them
+	PurgeOnly bool `json:"purgeOnly,omitempty"`
+	// Paused image caches are not reconciled: no image pull or delete jobs are created for them, and their
+	// status is retained. Jobs already created are allowed to complete. Deleted image caches are purged even if paused
+	Paused bool `json:"paused,omitempty"`
+	// CredentialsSecret is mounted into the containers of image pull jobs, for registries whose credentials
+	// are files (e.g. a GCR JSON key) that image pull secrets cannot express
+	CredentialsSecret *CredentialsSecret `json:"credentialsSecret,omitempty"`
+	// ClientTLSSecret is a Secret, in the namespace of the image pull jobs, with the client certificate (tls.crt),
+	// key (tls.key) and optionally the CA certificate (ca.crt) used to pull from registries requiring mutual TLS
+	ClientTLSSecret string `json:"clientTLSSecret,omitempty"`
+	// CABundle is a ConfigMap or Secret with the certificates of the private CAs of registries, trusted by
+	// the image pull jobs in addition to the CAs of the system
+	CABundle *CABundle `json:"caBundle,omitempty"`
+	// Snapshotter is the containerd snapshotter (e.g. stargz) the images are unpacked into, for lazy pulling.
+	// It applies only to nodes with containerd runtime, and is ignored for other runtimes
+	Snapshotter string `json:"snapshotter,omitempty"`
+	// SkipImagesInUse skips caching an image in the nodes where a pod (e.g. of a DaemonSet) already runs or ran
+	// the image, as the image is present in those nodes. It requires the controller to watch pods (--check-images-in-use)
+	SkipImagesInUse bool `json:"skipImagesInUse,omitempty"`
+	// CompletionWebhook is an http(s) URL to which a JSON summary of the image cache is POSTed whenever its processing
+	// completes, e.g. for ChatOps. It overrides the completion webhook of the controller (--completion-webhook)
+	CompletionWebhook string `json:"completionWebhook,omitempty"`
+	// ExcludeImages are images not cached even though they are in the image lists, e.g. images listed in ConfigMaps or
+	// resolved from image patterns. Each is either an image or a pattern with '*' wildcards e.g. "myrepo/*:debug"
+	ExcludeImages []string `json:"excludeImages,omitempty"`
+	// CanaryPercentage is the percentage of the selected nodes of each image list in which the images are cached
+	// first, when the image cache is created or updated. The images are cached in the other nodes only once they
+	// are cached in all the canary nodes
+	CanaryPercentage int32 `json:"canaryPercentage,omitempty"`
+}
+
+// CredentialsSecret is a Secret, in the namespace of the image pull jobs, mounted as a volume into the
+// containers of image pull jobs. The env variable EnvName points to the mounted Secret, or to its key Key.
+// Secrets in the namespace of kube-fledged must be labeled with CredentialsSecretLabelKey
+type CredentialsSecret struct {
+	SecretName string `json:"secretName"`
+	MountPath  string `json:"mountPath"`
+	// Key of the Secret pointed to by the env variable, instead of the directory of the mounted Secret
+	Key string `json:"key,omitempty"`
+	// EnvName is the name of the env variable. Defaults to REGISTRY_CREDENTIALS
+	EnvName string `json:"envName,omitempty"`
+}
+
+// CABundle is a ConfigMap or Secret, in the namespace of the image pull jobs, holding PEM encoded CA
+// certificates. Exactly one of ConfigMapName and SecretName is specified
+type CABundle struct {
+	ConfigMapName string `json:"configMapName,omitempty"`
+	SecretName    string `json:"secretName,omitempty"`
+	// Key of the ConfigMap or Secret holding the certificates. Defaults to ca.crt
+	Key string `json:"key,omitempty"`
+}
+
+// PullJobContainer is a container that pulls an image to a node. The image to be pulled is
+// available in the IMAGE environment variable, and the container runtime socket is mounted
+// at the default path of the container runtime of the node.
+type PullJobContainer struct {
+	Image   string   `json:"image"`
+	Command []string `json:"command,omitempty"`
+	Args    []string `json:"args,omitempty"`
 }
 
 // ImageCacheStatus is the status for a ImageCache resource
 type ImageCacheStatus struct {
+	// Status is the status of the latest processing of the image cache.
+	// Deprecated: use the Validated, JobsCreated, Pulling, Completed and Failed conditions instead
 	Status         ImageCacheActionStatus           `json:"status"`
 	Reason         string                           `json:"reason"`
 	Message        string                           `json:"message"`
 	Failures       map[string]NodeReasonMessageList `json:"failures,omitempty"`
 	StartTime      *metav1.Time                     `json:"startTime"`
 	CompletionTime *metav1.Time                     `json:"completionTime,omitempty"`
+	// PlannedJobs are the jobs that would have been created, if the image cache was not a dry run
+	PlannedJobs []PlannedJob `json:"plannedJobs,omitempty"`
+	// SkippedNodes are the selected nodes in which images are not cached, since they are unschedulable or not ready,
+	// or were not found
+	SkippedNodes []NodeReasonMessage `json:"skippedNodes,omitempty"`
+	// Images is the status of each image on each node of the image cache
+	Images []ImageNodeStatus `json:"images,omitempty"`
+	// PullEstimates are the estimated bytes to be pulled to each node, if estimated by the controller
+	PullEstimates []NodePullEstimate `json:"pullEstimates,omitempty"`
+	// Coverage is the no. of images on nodes of the image cache in each phase, recomputed on each status update
+	Coverage *ImageCacheCoverage `json:"coverage,omitempty"`
+	// ResolvedPatterns are the images the image patterns of the image lists resolved to, when last resolved
+	ResolvedPatterns []ResolvedImagePattern `json:"resolvedPatterns,omitempty"`
+	// PodImages are the images of the running pods of the namespaces of the image lists, when last discovered
+	PodImages []DiscoveredPodImages `json:"podImages,omitempty"`
+	// ExcludedImages are the images of the image lists not cached since they match the exclusions of the image cache
+	ExcludedImages []string `json:"excludedImages,omitempty"`
+	// InvalidImages are the lines of the ConfigMaps of the image lists not cached since they are not valid images
+	InvalidImages []string `json:"invalidImages,omitempty"`
+	// NotifiedStatus is the status of the image cache last notified to the completion webhook. Refreshes are notified
+	// only if they change the status
+	NotifiedStatus ImageCacheActionStatus `json:"notifiedStatus,omitempty"`
+	// Conditions are the latest observations of the image cache's state
+	Conditions []ImageCacheCondition `json:"conditions,omitempty"`
+}
+
+// ResolvedImagePattern is the images an image pattern resolved to i.e. the images of the tags matching the pattern
+type ResolvedImagePattern struct {
+	Pattern string   `json:"pattern"`
+	Images  []string `json:"images"`
+	// ResolvedTime is the time the pattern was resolved
+	ResolvedTime metav1.Time `json:"resolvedTime"`
+}
+
+// DiscoveredPodImages is the images of the running pods of a namespace
+type DiscoveredPodImages struct {
+	Namespace string   `json:"namespace"`
+	Images    []string `json:"images"`
+	// DiscoveredTime is the time the images were discovered
+	DiscoveredTime metav1.Time `json:"discoveredTime"`
 }
 
+// ImageCacheCondition describes the state of an image cache at a certain point
+type ImageCacheCondition struct {
+	Type               ImageCacheConditionType `json:"type"`
+	Status             corev1.ConditionStatus  `json:"status"`
+	LastTransitionTime metav1.Time             `json:"lastTransitionTime,omitempty"`
+	Reason             string                  `json:"reason,omitempty"`
+	Message            string                  `json:"message,omitempty"`
+}
+
+// ImageCacheConditionType defines the type of ImageCacheCondition
+type ImageCacheConditionType string
+
+// List of constants for ImageCacheConditionType
+const (
+	// ImageCacheConditionAllImagesCached is true when every image is cached in every selected node
+	ImageCacheConditionAllImagesCached ImageCacheConditionType = "AllImagesCached"
+	// ImageCacheConditionImageDigestMismatch is true when an image was pulled with different digests on different nodes
+	ImageCacheConditionImageDigestMismatch ImageCacheConditionType = "ImageDigestMismatch"
+	// ImageCacheConditionRegistryCircuitOpen is true when image pulls were not done since pulls from their registry are
+	// suspended after consecutive failures
+	ImageCacheConditionRegistryCircuitOpen ImageCacheConditionType = "RegistryCircuitOpen"
+	// ImageCacheConditionPaused is true when the image cache is paused
+	ImageCacheConditionPaused ImageCacheConditionType = "Paused"
+	// ImageCacheConditionValidated is false when the image cache failed validation e.g. an image pull secret was not found
+	ImageCacheConditionValidated ImageCacheConditionType = "Validated"
+	// ImageCacheConditionJobsCreated is true when the image pulls and deletes of the latest processing are queued
+	ImageCacheConditionJobsCreated ImageCacheConditionType = "JobsCreated"
+	// ImageCacheConditionPulling is true while the images are being pulled to (or deleted from) the nodes
+	ImageCacheConditionPulling ImageCacheConditionType = "Pulling"
+	// ImageCacheConditionCompleted is true when the latest processing of the image cache succeeded
+	ImageCacheConditionCompleted ImageCacheConditionType = "Completed"
+	// ImageCacheConditionFailed is true when the latest processing of the image cache failed or was aborted
+	ImageCacheConditionFailed ImageCacheConditionType = "Failed"
+	// ImageCacheConditionCanaryPassed is true when the images were cached in the canary nodes, unknown while
+	// the canary is running and false when the canary failed
+	ImageCacheConditionCanaryPassed ImageCacheConditionType = "CanaryPassed"
+)
+
 // NodeReasonMessage has failure reason and message for a node
 type NodeReasonMessage struct {
 	Node    string `json:"node"`
 	Reason  string `json:"reason"`
 	Message string `json:"message"`
+	// FailureCategory classifies the failure of an image on the node, in the failures of the status
+	FailureCategory FailureCategory `json:"failureCategory,omitempty"`
 }
 
 type NodeReasonMessageList []NodeReasonMessage
 
+// ImageCacheCoverage counts the images on nodes i.e. the (image, node) pairs of an image cache, by phase. Images
+// deleted from nodes are not counted
+type ImageCacheCoverage struct {
+	// Total is the no. of images on nodes
+	Total int32 `json:"total"`
+	// Cached is the no. of images cached on nodes
+	Cached int32 `json:"cached"`
+	// Failed is the no. of images that failed to be pulled to nodes
+	Failed int32 `json:"failed"`
+	// Pending is the no. of images queued or being pulled to nodes
+	Pending int32 `json:"pending"`
+	// Percentage of the images on nodes that are cached, rounded down. It is 0 if there are no images on nodes
+	Percentage int32 `json:"percentage"`
+}
+
+// NodePullEstimate is the estimated no. of bytes to be pulled to a node
+type NodePullEstimate struct {
+	Node string `json:"node"`
+	// Bytes is the total compressed size of the images to be pulled to the node, whose size is known
+	Bytes int64 `json:"bytes"`
+	// UnknownImages is the no. of images to be pulled to the node, whose size could not be queried
+	UnknownImages int32 `json:"unknownImages,omitempty"`
+}
+
+// ImageNodeStatus is the status of an image on a node
+type ImageNodeStatus struct {
+	Image   string     `json:"image"`
+	Node    string     `json:"node"`
+	Phase   ImagePhase `json:"phase"`
+	Reason  string     `json:"reason,omitempty"`
+	Message string     `json:"message,omitempty"`
+	// FailureCategory classifies the failure of the image on the node, from the reason and message of the failure
+	FailureCategory FailureCategory `json:"failureCategory,omitempty"`
+	// Digest is the digest the image resolved to when it was pulled to the node, if known
+	Digest string `json:"digest,omitempty"`
+	// Source is the image pulled to the node, either the image itself or its image in a mirror, if the image list has mirrors
+	Source string `json:"source,omitempty"`
+	// Aliases are the other images of the image lists with the same identity as the image on the node i.e. the
+	// same repository and digest, e.g. the image referenced by digest as well as by tag, reported by this status
+	Aliases []string `json:"aliases,omitempty"`
+	// CachedTime is the time the image was cached on the node
+	CachedTime *metav1.Time `json:"cachedTime,omitempty"`
+	// PullDuration is the wall-clock time the latest pull of the image to the node took, from the creation of its
+	// job until it succeeded or failed. It is empty if the image was not pulled e.g. it was already present
+	PullDuration *metav1.Duration `json:"pullDuration,omitempty"`
+	// Pulled is true if the image was pulled to the node by kube-fledged, rather than already present on the node
+	// when it was first cached. Images no longer used by pods are purged from the node only if pulled
+	Pulled bool `json:"pulled,omitempty"`
+	// Job is the name of the last job that pulled or deleted the image on the node, if the work was done by a job
+	Job string `json:"job,omitempty"`
+	// Pod is the name of the last pod of the job, once the pod is known
+	Pod string `json:"pod,omitempty"`
+}
+
+// ImagePhase defines the phase of an image on a node
+type ImagePhase string
+
+// List of constants for ImagePhase
+const (
+	ImagePhaseQueued  ImagePhase = "Queued"
+	ImagePhaseCached  ImagePhase = "Cached"
+	ImagePhaseDeleted ImagePhase = "Deleted"
+	ImagePhaseFailed  ImagePhase = "Failed"
+)
+
+// FailureCategory classifies the failure of an image pull or delete, e.g. to tell a bad credential from a down registry
+type FailureCategory string
+
+// List of constants for FailureCategory
+const (
+	FailureCategoryUnauthorized   FailureCategory = "Unauthorized"
+	FailureCategoryNotFound       FailureCategory = "NotFound"
+	FailureCategoryNetworkTimeout FailureCategory = "NetworkTimeout"
+	FailureCategoryDiskPressure   FailureCategory = "DiskPressure"
+	FailureCategoryUnknown        FailureCategory = "Unknown"
+)
+
+// PlannedJob is an image pull or delete job planned during a dry run
+type PlannedJob struct {
+	Node   string           `json:"node"`
+	Image  string           `json:"image"`
+	Action PlannedJobAction `json:"action"`
+}
+
+// PlannedJobAction defines the action of a PlannedJob
+type PlannedJobAction string
+
+// List of constants for PlannedJobAction
+const (
+	PlannedJobActionPull   PlannedJobAction = "Pull"
+	PlannedJobActionDelete PlannedJobAction = "Delete"
+)
+
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
 // ImageCacheList is a list of ImageCache resources
@@ -103,6 +453,39 @@ const (
 	ImageCacheReasonCacheSpecValidationFailed      = "CacheSpecValidationFailed"
 	ImageCacheReasonOldImageCacheNotFound          = "OldImageCacheNotFound"
 	ImageCacheReasonNotSupportedUpdates            = "NotSupportedUpdates"
+	ImageCacheReasonImagePullSecretNotFound        = "ImagePullSecretNotFound"
+	ImageCacheReasonClientTLSSecretInvalid         = "ClientTLSSecretInvalid"
+	ImageCacheReasonCredentialsSecretNotAllowed    = "CredentialsSecretNotAllowed"
+	ImageCacheReasonJobServiceAccountNotApproved   = "JobServiceAccountNotApproved"
+	ImageCacheReasonCompletionWebhookNotAllowed    = "CompletionWebhookNotAllowed"
+	ImageCacheReasonCABundleInvalid                = "CABundleInvalid"
+	ImageCacheReasonDryRun                         = "DryRun"
+	ImageCacheReasonImageDigestMismatch            = "ImageDigestMismatch"
+	ImageCacheReasonImageDigestsMatch              = "ImageDigestsMatch"
+	ImageCacheReasonRegistryCircuitOpen            = "RegistryCircuitOpen"
+	ImageCacheReasonRegistriesAvailable            = "RegistriesAvailable"
+	ImageCacheReasonImagesExpired                  = "ImagesExpired"
+	ImageCacheReasonImageCachePurgeImage           = "ImageCachePurgeImage"
+	ImageCacheReasonPurgeImageNotCached            = "PurgeImageNotCached"
+	ImageCacheReasonNodeUnschedulable              = "NodeUnschedulable"
+	ImageCacheReasonNodeNotReady                   = "NodeNotReady"
+	ImageCacheReasonNodesSkipped                   = "NodesSkipped"
+	ImageCacheReasonNodeNotFound                   = "NodeNotFound"
+	ImageCacheReasonNoSchedulableNodes             = "NoSchedulableNodes"
+	ImageCacheReasonImagesConfigMapNotFound        = "ImagesConfigMapNotFound"
+	ImageCacheReasonImagePatternNotResolved        = "ImagePatternNotResolved"
+	ImageCacheReasonOptionalImagePullFailed        = "OptionalImagePullFailed"
+	ImageCacheReasonMutableImageTag                = "MutableImageTag"
+	ImageCacheReasonInvalidImages                  = "InvalidImages"
+	ImageCacheReasonPurgeOnly                      = "PurgeOnly"
+	ImageCacheReasonPaused                         = "Paused"
+	ImageCacheReasonResumed                        = "Resumed"
+	ImageCacheReasonNodeAdded                      = "NodeAdded"
+	ImageCacheReasonValidated                      = "Validated"
+	ImageCacheReasonJobsCreated                    = "JobsCreated"
+	ImageCacheReasonCanaryRunning                  = "CanaryRunning"
+	ImageCacheReasonCanaryPassed                   = "CanaryPassed"
+	ImageCacheReasonCanaryFailed                   = "CanaryFailed"
 )
 
 // List of constants for ImageCacheMessage
@@ -121,4 +504,39 @@ const (
 	ImageCacheMessageImagePullAborted               = "Image cache processing aborted. Image cache will get refreshed during next refresh cycle"
 	ImageCacheMessageOldImageCacheNotFound          = "Unable to fetch the previous version of Image cache spec before update action."
 	ImageCacheMessageNotSupportedUpdates            = "The updates performed to image cache spec is not supported. Only addition or removal of images in a image list is supported."
+	ImageCacheMessageImagePullSecretNotFound        = "Image pull secret not found in the namespace of the image pull jobs: "
+	ImageCacheMessageClientTLSSecretInvalid         = "Client TLS secret does not contain the client certificate and key: "
+	ImageCacheMessageCredentialsSecretNotAllowed    = "Credentials secret in the namespace of kube-fledged is not labeled " + CredentialsSecretLabelKey + "=true: "
+	ImageCacheMessageJobServiceAccountNotApproved   = "Service account is not approved to use the pod security policy of image pull jobs: "
+	ImageCacheMessageCompletionWebhookNotAllowed    = "Host of the completion webhook is not allowed by the controller: "
+	ImageCacheMessageCABundleInvalid                = "CA bundle not found or does not contain the CA certificates: "
+	ImageCacheMessageDryRun                         = "Dry run: no jobs were created. Please see \"plannedJobs\" section"
+	ImageCacheMessageImageDigestMismatch            = "Images pulled with different digests on different nodes. Please see \"images\" section: "
+	ImageCacheMessageImageDigestsMatch              = "Images pulled with the same digest on all nodes"
+	ImageCacheMessageRegistryCircuitOpen            = "Image pulls not done since pulls from their registries are suspended after consecutive failures. Please see \"failures\" section: "
+	ImageCacheMessageRegistriesAvailable            = "Image pulls from all registries were done"
+	ImageCacheMessageImagesExpired                  = "Images older than maxAge purged from the nodes. They will be pulled again during next refresh cycle"
+	ImageCacheMessagePurgeImage                     = "Image is being purged from the node. Please view the status after some time"
+	ImageCacheMessagePurgeImageNotCached            = "Image requested to be purged is not cached in the node by the image cache: "
+	ImageCacheMessageNodeUnschedulable              = "Node is cordoned"
+	ImageCacheMessageNodeNotReady                   = "Node is not ready"
+	ImageCacheMessageNodesSkipped                   = "Images not cached in unschedulable, not ready or not found nodes. Please see \"skippedNodes\" section"
+	ImageCacheMessageNodeNotFound                   = "Node in nodeNames of image list not found"
+	ImageCacheMessageNoSchedulableNodes             = "None of the selected nodes are schedulable and ready. Please see \"skippedNodes\" section"
+	ImageCacheMessageImagesConfigMapNotFound        = "ConfigMap (or its key) of images not found in the kube-fledged namespace: "
+	ImageCacheMessageImagePatternNotResolved        = "Image patterns could not be resolved against the tags in their registries: "
+	ImageCacheMessageOptionalImagePullFailed        = "All required images pulled succesfully, but image pull failed for some optional images. Please see \"failures\" section"
+	ImageCacheMessageReconcileTimeout               = "Image cache processing timed out, outstanding image pulls/deletes were abandoned. Please see \"failures\" section"
+	ImageCacheMessagePurgeOnly                      = "Image cache is purge-only: images are being purged from the nodes. Please view the status after some time"
+	ImageCacheMessagePurgeOnlyNotCached             = "Images of a purge-only image cache are never cached"
+	ImageCacheMessagePaused                         = "Image cache is paused: images are not pulled or purged, and refresh and purge requests are skipped"
+	ImageCacheMessageResumed                        = "Image cache is resumed"
+	ImageCacheMessageNodeAdded                      = "Images are being cached in a new node. Please view the status after some time"
+	ImageCacheMessageValidated                      = "Image cache is valid"
+	ImageCacheMessageJobsCreated                    = "Image pulls and deletes are queued for the nodes. Please see \"images\" section"
+	ImageCacheMessageMutableImageTag                = "Images with mutable tags are pulled with IfNotPresent policy and will not be updated in the nodes. Consider imagePullPolicy Always or a refreshSchedule: "
+	ImageCacheMessageInvalidImages                  = "Lines of ConfigMaps of images that are not valid images are not cached: "
+	ImageCacheMessageCanaryRunning                  = "Images are being cached in the canary nodes, before the other nodes"
+	ImageCacheMessageCanaryPassed                   = "Images were cached in the canary nodes, so they are being cached in the other nodes"
+	ImageCacheMessageCanaryFailed                   = "Images could not be cached in the canary nodes, so they are not cached in the other nodes. Please see \"failures\" section"
 )
@@ -22,6 +22,7 @@ package v1alpha1
 
 import (
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -33,6 +34,21 @@ func (in *CacheSpecImages) DeepCopyInto(out *CacheSpecImages) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.ImagesFrom != nil {
+		in, out := &in.ImagesFrom, &out.ImagesFrom
+		*out = new(v1.ConfigMapKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ImagesFromPods != nil {
+		in, out := &in.ImagesFromPods, &out.ImagesFromPods
+		*out = new(PodImagesSource)
+		**out = **in
+	}
+	if in.ImagePatterns != nil {
+		in, out := &in.ImagePatterns, &out.ImagePatterns
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	if in.NodeSelector != nil {
 		in, out := &in.NodeSelector, &out.NodeSelector
 		*out = make(map[string]string, len(*in))
@@ -40,6 +56,43 @@ func (in *CacheSpecImages) DeepCopyInto(out *CacheSpecImages) {
 			(*out)[key] = val
 		}
 	}
+	if in.NodeNames != nil {
+		in, out := &in.NodeNames, &out.NodeNames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ImagePullSecrets != nil {
+		in, out := &in.ImagePullSecrets, &out.ImagePullSecrets
+		*out = make([]v1.LocalObjectReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.PullDeadline != nil {
+		in, out := &in.PullDeadline, &out.PullDeadline
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.MaxAge != nil {
+		in, out := &in.MaxAge, &out.MaxAge
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.Mirrors != nil {
+		in, out := &in.Mirrors, &out.Mirrors
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ImageArchive != nil {
+		in, out := &in.ImageArchive, &out.ImageArchive
+		*out = new(ImageArchive)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DeviceResources != nil {
+		in, out := &in.DeviceResources, &out.DeviceResources
+		*out = make(v1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
 	return
 }
 
@@ -53,6 +106,81 @@ func (in *CacheSpecImages) DeepCopy() *CacheSpecImages {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CABundle) DeepCopyInto(out *CABundle) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CABundle.
+func (in *CABundle) DeepCopy() *CABundle {
+	if in == nil {
+		return nil
+	}
+	out := new(CABundle)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CredentialsSecret) DeepCopyInto(out *CredentialsSecret) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CredentialsSecret.
+func (in *CredentialsSecret) DeepCopy() *CredentialsSecret {
+	if in == nil {
+		return nil
+	}
+	out := new(CredentialsSecret)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DiscoveredPodImages) DeepCopyInto(out *DiscoveredPodImages) {
+	*out = *in
+	if in.Images != nil {
+		in, out := &in.Images, &out.Images
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	in.DiscoveredTime.DeepCopyInto(&out.DiscoveredTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DiscoveredPodImages.
+func (in *DiscoveredPodImages) DeepCopy() *DiscoveredPodImages {
+	if in == nil {
+		return nil
+	}
+	out := new(DiscoveredPodImages)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ImageArchive) DeepCopyInto(out *ImageArchive) {
+	*out = *in
+	if in.Command != nil {
+		in, out := &in.Command, &out.Command
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImageArchive.
+func (in *ImageArchive) DeepCopy() *ImageArchive {
+	if in == nil {
+		return nil
+	}
+	out := new(ImageArchive)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ImageCache) DeepCopyInto(out *ImageCache) {
 	*out = *in
@@ -81,6 +209,39 @@ func (in *ImageCache) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ImageCacheCondition) DeepCopyInto(out *ImageCacheCondition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImageCacheCondition.
+func (in *ImageCacheCondition) DeepCopy() *ImageCacheCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(ImageCacheCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ImageCacheCoverage) DeepCopyInto(out *ImageCacheCoverage) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImageCacheCoverage.
+func (in *ImageCacheCoverage) DeepCopy() *ImageCacheCoverage {
+	if in == nil {
+		return nil
+	}
+	out := new(ImageCacheCoverage)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ImageCacheList) DeepCopyInto(out *ImageCacheList) {
 	*out = *in
@@ -129,6 +290,58 @@ func (in *ImageCacheSpec) DeepCopyInto(out *ImageCacheSpec) {
 		*out = make([]v1.LocalObjectReference, len(*in))
 		copy(*out, *in)
 	}
+	if in.PullDeadline != nil {
+		in, out := &in.PullDeadline, &out.PullDeadline
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.JobResources != nil {
+		in, out := &in.JobResources, &out.JobResources
+		*out = new(v1.ResourceRequirements)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Tolerations != nil {
+		in, out := &in.Tolerations, &out.Tolerations
+		*out = make([]v1.Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.PullJobContainer != nil {
+		in, out := &in.PullJobContainer, &out.PullJobContainer
+		*out = new(PullJobContainer)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SecurityContext != nil {
+		in, out := &in.SecurityContext, &out.SecurityContext
+		*out = new(v1.SecurityContext)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PodSecurityContext != nil {
+		in, out := &in.PodSecurityContext, &out.PodSecurityContext
+		*out = new(v1.PodSecurityContext)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DNSConfig != nil {
+		in, out := &in.DNSConfig, &out.DNSConfig
+		*out = new(v1.PodDNSConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CredentialsSecret != nil {
+		in, out := &in.CredentialsSecret, &out.CredentialsSecret
+		*out = new(CredentialsSecret)
+		**out = **in
+	}
+	if in.CABundle != nil {
+		in, out := &in.CABundle, &out.CABundle
+		*out = new(CABundle)
+		**out = **in
+	}
+	if in.ExcludeImages != nil {
+		in, out := &in.ExcludeImages, &out.ExcludeImages
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -168,6 +381,64 @@ func (in *ImageCacheStatus) DeepCopyInto(out *ImageCacheStatus) {
 		in, out := &in.CompletionTime, &out.CompletionTime
 		*out = (*in).DeepCopy()
 	}
+	if in.PlannedJobs != nil {
+		in, out := &in.PlannedJobs, &out.PlannedJobs
+		*out = make([]PlannedJob, len(*in))
+		copy(*out, *in)
+	}
+	if in.SkippedNodes != nil {
+		in, out := &in.SkippedNodes, &out.SkippedNodes
+		*out = make([]NodeReasonMessage, len(*in))
+		copy(*out, *in)
+	}
+	if in.Images != nil {
+		in, out := &in.Images, &out.Images
+		*out = make([]ImageNodeStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.PullEstimates != nil {
+		in, out := &in.PullEstimates, &out.PullEstimates
+		*out = make([]NodePullEstimate, len(*in))
+		copy(*out, *in)
+	}
+	if in.Coverage != nil {
+		in, out := &in.Coverage, &out.Coverage
+		*out = new(ImageCacheCoverage)
+		**out = **in
+	}
+	if in.ResolvedPatterns != nil {
+		in, out := &in.ResolvedPatterns, &out.ResolvedPatterns
+		*out = make([]ResolvedImagePattern, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.PodImages != nil {
+		in, out := &in.PodImages, &out.PodImages
+		*out = make([]DiscoveredPodImages, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ExcludedImages != nil {
+		in, out := &in.ExcludedImages, &out.ExcludedImages
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.InvalidImages != nil {
+		in, out := &in.InvalidImages, &out.InvalidImages
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]ImageCacheCondition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -181,6 +452,52 @@ func (in *ImageCacheStatus) DeepCopy() *ImageCacheStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ImageNodeStatus) DeepCopyInto(out *ImageNodeStatus) {
+	*out = *in
+	if in.Aliases != nil {
+		in, out := &in.Aliases, &out.Aliases
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.CachedTime != nil {
+		in, out := &in.CachedTime, &out.CachedTime
+		*out = (*in).DeepCopy()
+	}
+	if in.PullDuration != nil {
+		in, out := &in.PullDuration, &out.PullDuration
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImageNodeStatus.
+func (in *ImageNodeStatus) DeepCopy() *ImageNodeStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ImageNodeStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodePullEstimate) DeepCopyInto(out *NodePullEstimate) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodePullEstimate.
+func (in *NodePullEstimate) DeepCopy() *NodePullEstimate {
+	if in == nil {
+		return nil
+	}
+	out := new(NodePullEstimate)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NodeReasonMessage) DeepCopyInto(out *NodeReasonMessage) {
 	*out = *in
@@ -216,3 +533,83 @@ func (in NodeReasonMessageList) DeepCopy() NodeReasonMessageList {
 	in.DeepCopyInto(out)
 	return *out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlannedJob) DeepCopyInto(out *PlannedJob) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlannedJob.
+func (in *PlannedJob) DeepCopy() *PlannedJob {
+	if in == nil {
+		return nil
+	}
+	out := new(PlannedJob)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodImagesSource) DeepCopyInto(out *PodImagesSource) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodImagesSource.
+func (in *PodImagesSource) DeepCopy() *PodImagesSource {
+	if in == nil {
+		return nil
+	}
+	out := new(PodImagesSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PullJobContainer) DeepCopyInto(out *PullJobContainer) {
+	*out = *in
+	if in.Command != nil {
+		in, out := &in.Command, &out.Command
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Args != nil {
+		in, out := &in.Args, &out.Args
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PullJobContainer.
+func (in *PullJobContainer) DeepCopy() *PullJobContainer {
+	if in == nil {
+		return nil
+	}
+	out := new(PullJobContainer)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResolvedImagePattern) DeepCopyInto(out *ResolvedImagePattern) {
+	*out = *in
+	if in.Images != nil {
+		in, out := &in.Images, &out.Images
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	in.ResolvedTime.DeepCopyInto(&out.ResolvedTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResolvedImagePattern.
+func (in *ResolvedImagePattern) DeepCopy() *ResolvedImagePattern {
+	if in == nil {
+		return nil
+	}
+	out := new(ResolvedImagePattern)
+	in.DeepCopyInto(out)
+	return out
+}
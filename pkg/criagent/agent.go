@@ -0,0 +1,130 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package criagent
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"os/exec"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+	"github.com/golang/glog"
+)
+
+const (
+	// PullPath is the path of the endpoint of the CRI agent that pulls an image
+	PullPath = "/pull"
+	// RemovePath is the path of the endpoint of the CRI agent that removes an image
+	RemovePath = "/remove"
+	// TokenEnvVar is the env variable of the bearer token shared by the controller and the CRI agents
+	TokenEnvVar = "KUBEFLEDGED_CRI_AGENT_TOKEN"
+	// DefaultPort is the default port that the CRI agents listen on
+	DefaultPort = 8090
+	// ServerName is the name in the serving certificates of the CRI agents, verified by the controller
+	ServerName = "kubefledged-cri-agent"
+)
+
+// PodLabels are the labels of the pods of the CRI agent DaemonSet
+var PodLabels = map[string]string{"kubefledged": "kubefledged-cri-agent"}
+
+// Request is a request to pull or remove an image, sent to the CRI agent of a node
+type Request struct {
+	Image string `json:"image"`
+}
+
+// Response is the response of the CRI agent i.e. the output of crictl
+type Response struct {
+	Message string `json:"message,omitempty"`
+}
+
+// Agent pulls and removes the images of a node using crictl, which talks to the CRI
+// ImageService of the container runtime listening on the runtime endpoint
+type Agent struct {
+	runtimeEndpoint string
+	token           string
+	// runCommand runs crictl, and is replaced in tests
+	runCommand func(ctx context.Context, name string, args ...string) ([]byte, error)
+}
+
+// NewAgent returns a new CRI agent
+func NewAgent(runtimeEndpoint, token string) *Agent {
+	return &Agent{
+		runtimeEndpoint: runtimeEndpoint,
+		token:           token,
+		runCommand: func(ctx context.Context, name string, args ...string) ([]byte, error) {
+			return exec.CommandContext(ctx, name, args...).CombinedOutput()
+		},
+	}
+}
+
+// Handler returns the HTTP handler of the CRI agent. Images are pulled and removed
+// on POST to PullPath and RemovePath respectively, with the bearer token of the agent
+func (a *Agent) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(PullPath, func(w http.ResponseWriter, r *http.Request) {
+		a.handle(w, r, "pull")
+	})
+	mux.HandleFunc(RemovePath, func(w http.ResponseWriter, r *http.Request) {
+		a.handle(w, r, "rmi")
+	})
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	return mux
+}
+
+// handle runs the crictl command on the image of the request. The command is killed
+// if the request is cancelled i.e. the controller gave up on the image work
+func (a *Agent) handle(w http.ResponseWriter, r *http.Request, command string) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+a.token)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := reference.ParseNormalizedNamed(req.Image); err != nil {
+		http.Error(w, "invalid image: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	out, err := a.runCommand(r.Context(), "/usr/bin/crictl", "--runtime-endpoint", a.runtimeEndpoint,
+		"--image-endpoint", a.runtimeEndpoint, command, req.Image)
+	resp := Response{Message: strings.TrimSpace(string(out))}
+	status := http.StatusOK
+	if err != nil {
+		glog.Errorf("Error running crictl %s %s: %v: %s", command, req.Image, err, resp.Message)
+		if resp.Message == "" {
+			resp.Message = err.Error()
+		}
+		status = http.StatusInternalServerError
+	} else {
+		glog.Infof("crictl %s %s succeeded", command, req.Image)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
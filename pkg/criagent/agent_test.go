@@ -0,0 +1,129 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package criagent
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestAgent(t *testing.T) {
+	tests := []struct {
+		name            string
+		remove          bool
+		image           string
+		token           string
+		output          string
+		commandErr      error
+		expectedArgs    []string
+		expectedErrText string
+	}{
+		{
+			name:         "#1: Image pulled",
+			image:        "nginx:1.17",
+			token:        "secret",
+			output:       "Image is up to date for sha256:abc",
+			expectedArgs: []string{"--runtime-endpoint", "unix:///run/containerd/containerd.sock", "--image-endpoint", "unix:///run/containerd/containerd.sock", "pull", "nginx:1.17"},
+		},
+		{
+			name:         "#2: Image removed",
+			remove:       true,
+			image:        "nginx:1.17",
+			token:        "secret",
+			expectedArgs: []string{"--runtime-endpoint", "unix:///run/containerd/containerd.sock", "--image-endpoint", "unix:///run/containerd/containerd.sock", "rmi", "nginx:1.17"},
+		},
+		{
+			name:            "#3: Image pull failed",
+			image:           "nginx:1.17",
+			token:           "secret",
+			output:          "pulling image: not found\n",
+			commandErr:      fmt.Errorf("exit status 1"),
+			expectedArgs:    []string{"--runtime-endpoint", "unix:///run/containerd/containerd.sock", "--image-endpoint", "unix:///run/containerd/containerd.sock", "pull", "nginx:1.17"},
+			expectedErrText: "pulling image: not found",
+		},
+		{
+			name:            "#4: Wrong token",
+			image:           "nginx:1.17",
+			token:           "wrong",
+			expectedErrText: "401 Unauthorized",
+		},
+		{
+			name:            "#5: Invalid image",
+			image:           "--help",
+			token:           "secret",
+			expectedErrText: "400 Bad Request",
+		},
+	}
+	for _, test := range tests {
+		var args []string
+		agent := NewAgent("unix:///run/containerd/containerd.sock", "secret")
+		agent.runCommand = func(ctx context.Context, name string, a ...string) ([]byte, error) {
+			args = a
+			return []byte(test.output), test.commandErr
+		}
+		server := httptest.NewServer(agent.Handler())
+		host, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+		p, _ := strconv.Atoi(port)
+		client := NewClient(p, test.token, nil)
+		var err error
+		if test.remove {
+			err = client.Remove(context.Background(), host, test.image)
+		} else {
+			err = client.Pull(context.Background(), host, test.image)
+		}
+		server.Close()
+		if test.expectedErrText == "" && err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%v", test.name, err)
+		}
+		if test.expectedErrText != "" && (err == nil || !strings.Contains(err.Error(), test.expectedErrText)) {
+			t.Errorf("Test: %s failed: expectedError=%s, actualError=%v", test.name, test.expectedErrText, err)
+		}
+		if !reflect.DeepEqual(args, test.expectedArgs) {
+			t.Errorf("Test: %s failed: expectedArgs=%v, actualArgs=%v", test.name, test.expectedArgs, args)
+		}
+	}
+}
+
+func TestAgentTLS(t *testing.T) {
+	agent := NewAgent("unix:///run/containerd/containerd.sock", "secret")
+	agent.runCommand = func(ctx context.Context, name string, a ...string) ([]byte, error) {
+		return nil, nil
+	}
+	server := httptest.NewTLSServer(agent.Handler())
+	defer server.Close()
+	host, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "https://"))
+	p, _ := strconv.Atoi(port)
+	if err := NewClient(p, "secret", nil).Pull(context.Background(), host, "nginx:1.17"); err == nil {
+		t.Errorf("Test: plain HTTP failed: expected an error from the TLS server")
+	}
+	tlsConfig := server.Client().Transport.(*http.Transport).TLSClientConfig
+	if err := NewClient(p, "secret", tlsConfig).Pull(context.Background(), host, "nginx:1.17"); err != nil {
+		t.Errorf("Test: TLS failed: expectedError=nil, actualError=%v", err)
+	}
+	untrusted := &tls.Config{ServerName: ServerName}
+	if err := NewClient(p, "secret", untrusted).Pull(context.Background(), host, "nginx:1.17"); err == nil {
+		t.Errorf("Test: untrusted certificate failed: expected a certificate error")
+	}
+}
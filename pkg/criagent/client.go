@@ -0,0 +1,106 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package criagent
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// Client sends image pulls and removes to the CRI agents of nodes
+type Client struct {
+	httpClient *http.Client
+	scheme     string
+	port       int
+	token      string
+}
+
+// NewClient returns a new client of the CRI agents listening on the port. The agents are
+// reached over TLS with the TLS config, or over plain HTTP if it is nil
+func NewClient(port int, token string, tlsConfig *tls.Config) *Client {
+	client := &Client{
+		httpClient: &http.Client{},
+		scheme:     "http",
+		port:       port,
+		token:      token,
+	}
+	if tlsConfig != nil {
+		client.httpClient.Transport = &http.Transport{TLSClientConfig: tlsConfig}
+		client.scheme = "https"
+	}
+	return client
+}
+
+// ClientTLSConfig returns the TLS config of clients of the CRI agents, trusting the CA certificates in
+// the CA file. The agents are reached by the IPs of their pods, so their certificates are verified
+// against ServerName rather than the IPs
+func ClientTLSConfig(caFile string) (*tls.Config, error) {
+	ca, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no CA certificates found in %s", caFile)
+	}
+	return &tls.Config{RootCAs: pool, ServerName: ServerName, MinVersion: tls.VersionTLS12}, nil
+}
+
+// Pull pulls the image using the CRI agent on the host, until the context is done
+func (c *Client) Pull(ctx context.Context, host, image string) error {
+	return c.do(ctx, host, PullPath, image)
+}
+
+// Remove removes the image using the CRI agent on the host, until the context is done
+func (c *Client) Remove(ctx context.Context, host, image string) error {
+	return c.do(ctx, host, RemovePath, image)
+}
+
+func (c *Client) do(ctx context.Context, host, path, image string) error {
+	body, err := json.Marshal(Request{Image: image})
+	if err != nil {
+		return err
+	}
+	url := c.scheme + "://" + net.JoinHostPort(host, strconv.Itoa(c.port)) + path
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	resp, err := c.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	var agentResp Response
+	if err := json.NewDecoder(resp.Body).Decode(&agentResp); err != nil || agentResp.Message == "" {
+		return fmt.Errorf("CRI agent on %s responded with status %s", host, resp.Status)
+	}
+	return fmt.Errorf("%s", agentResp.Message)
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/senthilrch/kube-fledged/pkg/criagent"
+	"github.com/senthilrch/kube-fledged/pkg/logging"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// criAgentWorkSupported returns true if the image work request can be done by the CRI agent of
+// the node. The CRI agent only pulls and removes images by name, in the k8s.io containerd namespace,
+// on nodes with containerd or cri-o runtime. Pulls that need features of jobs (e.g. mirrors) use jobs instead
+func criAgentWorkSupported(iwr ImageWorkRequest, insecure bool) bool {
+	runtime := iwr.ContainerRuntimeVersion
+	if !strings.Contains(runtime, "containerd") && !strings.Contains(runtime, "crio") && !strings.Contains(runtime, "cri-o") {
+		return false
+	}
+	if iwr.ContainerdNamespace != "" && iwr.ContainerdNamespace != defaultContainerdNamespace {
+		return false
+	}
+	if iwr.WorkType == ImageCachePurge {
+		return true
+	}
+	return !insecure && iwr.ImageArchive == nil && iwr.Platform == "" && (iwr.Mirrors == nil || len(*iwr.Mirrors) == 0) &&
+		(iwr.DeviceResources == nil || len(*iwr.DeviceResources) == 0) &&
+		iwr.Imagecache.Spec.PullJobContainer == nil && iwr.Imagecache.Spec.CredentialsSecret == nil && iwr.Imagecache.Spec.ClientTLSSecret == "" &&
+		iwr.Imagecache.Spec.CABundle == nil && iwr.Imagecache.Spec.Snapshotter == "" && len(imagePullSecrets(iwr)) == 0
+}
+
+// criAgentHost returns the IP of the ready CRI agent pod on the node of the image work request,
+// if the work is to be done by the CRI agent. Empty string is returned if a job is to be used i.e.
+// if the pull strategy is not cri-daemonset, the work is not supported or no CRI agent is ready
+func (m *ImageManager) criAgentHost(iwr ImageWorkRequest) string {
+	// The CRI agent pulls without credentials, hence not with the default pull secret either
+	if m.criAgentClient == nil || m.defaultPullSecret != "" {
+		return ""
+	}
+	insecure, err := isInsecureRegistry(iwr.Image, m.insecureRegistries)
+	if err != nil || !criAgentWorkSupported(iwr, insecure) {
+		return ""
+	}
+	pods, err := m.podsLister.Pods(m.fledgedNameSpace).List(labels.Set(criagent.PodLabels).AsSelector())
+	if err != nil {
+		glog.Errorf("Error listing CRI agent pods: %v", err)
+		return ""
+	}
+	for _, pod := range pods {
+		if pod.Spec.NodeName == iwr.Node.Name && pod.Status.PodIP != "" && podReady(pod) {
+			return pod.Status.PodIP
+		}
+	}
+	glog.V(4).Infof("No ready CRI agent in node %s, using a job (%s)", iwr.Node.Labels["kubernetes.io/hostname"], iwr.Image)
+	return ""
+}
+
+// podReady returns true if the pod is running and ready
+func podReady(pod *corev1.Pod) bool {
+	if pod.Status.Phase != corev1.PodRunning {
+		return false
+	}
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// doCRIAgentWork pulls or deletes the image of the work request using the CRI agent on the host, and
+// records the result of the work. The work is abandoned once its deadline expires or its reconcile
+// times out, in which case the result is recorded by updatePendingImageWorkResults. The result of
+// work abandoned since the context of the image manager is cancelled is not recorded
+func (m *ImageManager) doCRIAgentWork(managerCtx context.Context, workName, host string, iwr ImageWorkRequest) {
+	ctx, cancel := context.WithTimeout(managerCtx, m.pullDeadline(iwr))
+	defer cancel()
+	if iwr.Context != nil {
+		go func() {
+			select {
+			case <-iwr.Context.Done():
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+	var err error
+	if iwr.WorkType == ImageCachePurge {
+		err = m.criAgentClient.Remove(ctx, host, iwr.Image)
+	} else {
+		err = m.criAgentClient.Pull(ctx, host, iwr.Image)
+	}
+	if managerCtx.Err() != nil {
+		return
+	}
+	m.lock.Lock()
+	iwres, ok := m.imageworkstatus[workName]
+	if !ok || iwres.Status != ImageWorkResultStatusJobCreated {
+		m.lock.Unlock()
+		return
+	}
+	hostname := iwr.Node.Labels["kubernetes.io/hostname"]
+	if err == nil {
+		iwres.Status = ImageWorkResultStatusSucceeded
+		logging.Infof(imageWorkFields(iwr, workName, iwres.Status), "CRI agent work %s succeeded (%s:- %s --> %s, runtime: %s)", workName, criAgentCommand(iwr), iwr.Image, hostname, iwr.ContainerRuntimeVersion)
+	} else {
+		iwres.Status = ImageWorkResultStatusFailed
+		iwres.Reason, iwres.Message = "CRIAgentFailed", err.Error()
+		iwres.FailureCategory = classifyFailure(iwres.Reason, iwres.Message)
+		if ctx.Err() != nil {
+			iwres.Reason = "DeadlineExceeded"
+			if reconcileDone(iwr) {
+				iwres.Reason = ImageWorkResultReasonReconcileTimeout
+			}
+		}
+		if retries := m.imageworkqueue.NumRequeues(iwr); iwr.WorkType != ImageCachePurge && ctx.Err() == nil && retries < m.maxRetries {
+			iwres.Status = ImageWorkResultStatusRetrying
+			logging.Infof(imageWorkFields(iwr, workName, iwres.Status), "CRI agent work %s failed, retrying %d/%d (pull: %s --> %s)", workName, retries+1, m.maxRetries, iwr.Image, hostname)
+			m.imageworkqueue.AddRateLimited(iwr)
+			if !iwr.WarmUp {
+				m.recorder.Eventf(iwr.Imagecache, corev1.EventTypeWarning, EventReasonImagePullRetrying,
+					"Image %s could not be pulled to node %s, retrying %d/%d: %s: %s", iwr.Image, hostname, retries+1, m.maxRetries, iwres.Reason, iwres.Message)
+			}
+		} else {
+			logging.Infof(imageWorkFields(iwr, workName, iwres.Status), "CRI agent work %s failed (%s: %s --> %s): %s", workName, criAgentCommand(iwr), iwr.Image, hostname, iwres.Message)
+		}
+	}
+	if iwres.Status != ImageWorkResultStatusRetrying {
+		iwres.CompletionTime = time.Now()
+	}
+	m.imageworkstatus[workName] = iwres
+	m.lock.Unlock()
+	m.recordRegistryResult(iwres)
+	if iwres.Status != ImageWorkResultStatusRetrying {
+		m.imageworkqueue.Forget(iwr)
+		m.recordImageWorkResult(&iwres)
+	}
+}
+
+// criAgentCommand returns the kind of work done by the CRI agent, for logging
+func criAgentCommand(iwr ImageWorkRequest) string {
+	if iwr.WorkType == ImageCachePurge {
+		return "delete"
+	}
+	return "pull"
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"strings"
+
+	fledgedv1alpha1 "github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha1"
+)
+
+// failureCategoryMessages are the substrings of the (lower case) messages of the kubelet and of the container
+// runtimes (and their registry clients) that classify a failure, in the order they are matched. Disk pressure is
+// matched first, since its messages may quote the image or registry being written, and authorization before not
+// found, since registries deny access to repositories that do not exist rather than leak their existence
+var failureCategoryMessages = []struct {
+	category   fledgedv1alpha1.FailureCategory
+	substrings []string
+}{
+	{fledgedv1alpha1.FailureCategoryDiskPressure, []string{"no space left on device", "diskpressure", "disk pressure",
+		"low on resource: ephemeral-storage", "disk quota exceeded"}},
+	{fledgedv1alpha1.FailureCategoryUnauthorized, []string{"unauthorized", "authentication required", "access denied",
+		"insufficient_scope", "no basic auth credentials", "requested access to the resource is denied", "authorization failed",
+		"failed to authorize", "403 forbidden", "code = unauthenticated"}},
+	{fledgedv1alpha1.FailureCategoryNotFound, []string{"not found", "manifest unknown", "name unknown", "no such image",
+		"does not exist", "no matching manifest", "is not present with pull policy", "code = notfound"}},
+	{fledgedv1alpha1.FailureCategoryNetworkTimeout, []string{"timeout", "timed out", "deadline exceeded", "connection refused",
+		"connection reset", "no such host", "network is unreachable", "no route to host", "temporary failure in name resolution",
+		"tls handshake", "unexpected eof", "502 bad gateway", "503 service unavailable", "504 gateway", "code = deadlineexceeded",
+		"code = unavailable"}},
+}
+
+// failureCategoryReasons are the reasons of the waiting state of a container, reported by the kubelet, that
+// classify a failure whose message does not
+var failureCategoryReasons = map[string]fledgedv1alpha1.FailureCategory{
+	"ErrImageNeverPull":   fledgedv1alpha1.FailureCategoryNotFound,
+	"InvalidImageName":    fledgedv1alpha1.FailureCategoryNotFound,
+	"RegistryUnavailable": fledgedv1alpha1.FailureCategoryNetworkTimeout,
+}
+
+// classifyFailure classifies the failure of an image pull or delete by the message and reason of the failure,
+// as reported in the status of the container of the job, or by the CRI agent
+func classifyFailure(reason, message string) fledgedv1alpha1.FailureCategory {
+	message = strings.ToLower(message)
+	for _, m := range failureCategoryMessages {
+		for _, s := range m.substrings {
+			if strings.Contains(message, s) {
+				return m.category
+			}
+		}
+	}
+	if category, ok := failureCategoryReasons[reason]; ok {
+		return category
+	}
+	return fledgedv1alpha1.FailureCategoryUnknown
+}
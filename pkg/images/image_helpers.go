@@ -17,11 +17,15 @@ limitations under the License.
 package images
 
 import (
-	"encoding/json"
+	"crypto/sha256"
 	"fmt"
+	"math"
+	"path"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/docker/distribution/reference"
 	"github.com/golang/glog"
 	fledgedv1alpha1 "github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha1"
 	batchv1 "k8s.io/api/batch/v1"
@@ -30,16 +34,40 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
-// newImagePullJob constructs a job manifest for pulling an image to a node
-func newImagePullJob(imagecache *fledgedv1alpha1.ImageCache, image string, node *corev1.Node, imagePullPolicy string) (*batchv1.Job, error) {
+// defaultContainerdNamespace is the containerd namespace of images pulled by kubelet
+const defaultContainerdNamespace = "k8s.io"
+
+// imageArchivesMountPath is the path at which the volume of image archives is mounted in image pull jobs
+const imageArchivesMountPath = "/var/lib/kubefledged/archives"
+
+// defaultCredentialsEnvName is the env variable pointing to the credentials secret mounted into image pull jobs
+const defaultCredentialsEnvName = "REGISTRY_CREDENTIALS"
+
+// clientTLSMountPath is the path the client TLS secret is mounted at in cri client containers
+const clientTLSMountPath = "/etc/kubefledged/client-tls"
+
+// caBundleMountPath is the path the CA bundle is mounted at in cri client containers
+const caBundleMountPath = "/etc/kubefledged/ca-bundle"
+
+// newImagePullJob constructs a job manifest for pulling an image to a node. With Never policy, the
+// job only verifies that the image is present in the node, and its pod fails to start otherwise.
+// The image is pulled by the kubelet as the image of the container of the pod, which is never restarted.
+// A failed pull leaves the pod pending while the kubelet retries the pull with a backoff of up to minutes,
+// so the image work is failed as soon as the pull errors (see imagePullErrored), instead of at its deadline
+func newImagePullJob(iwr ImageWorkRequest, imagePullPolicy string) (*batchv1.Job, error) {
 	var pullPolicy corev1.PullPolicy = corev1.PullIfNotPresent
-	hostname := node.Labels["kubernetes.io/hostname"]
+	message := "Image pulled successfully!"
+	imagecache, image := iwr.Imagecache, iwr.Image
+	hostname := iwr.Node.Labels["kubernetes.io/hostname"]
 	if imagecache == nil {
 		glog.Error("imagecache pointer is nil")
 		return nil, fmt.Errorf("imagecache pointer is nil")
 	}
 	if imagePullPolicy == string(corev1.PullAlways) {
 		pullPolicy = corev1.PullAlways
+	} else if imagePullPolicy == string(corev1.PullNever) {
+		pullPolicy = corev1.PullNever
+		message = "Image present in node!"
 	} else if imagePullPolicy == string(corev1.PullIfNotPresent) {
 		pullPolicy = corev1.PullIfNotPresent
 		if latestimage := strings.Contains(image, ":latest") || !strings.Contains(image, ":"); latestimage {
@@ -60,14 +88,7 @@ func newImagePullJob(imagecache *fledgedv1alpha1.ImageCache, image string, node
 		ObjectMeta: metav1.ObjectMeta{
 			GenerateName: imagecache.Name + "-",
 			Namespace:    imagecache.Namespace,
-			OwnerReferences: []metav1.OwnerReference{
-				*metav1.NewControllerRef(imagecache, schema.GroupVersionKind{
-					Group:   fledgedv1alpha1.SchemeGroupVersion.Group,
-					Version: fledgedv1alpha1.SchemeGroupVersion.Version,
-					Kind:    "ImageCache",
-				}),
-			},
-			Labels: labels,
+			Labels:       labels,
 		},
 		Spec: batchv1.JobSpec{
 			BackoffLimit:          &backoffLimit,
@@ -93,13 +114,14 @@ func newImagePullJob(imagecache *fledgedv1alpha1.ImageCache, image string, node
 								},
 							},
 							ImagePullPolicy: corev1.PullIfNotPresent,
+							Resources:       jobResources(imagecache),
 						},
 					},
 					Containers: []corev1.Container{
 						{
 							Name:    "imagepuller",
 							Image:   image,
-							Command: []string{"/tmp/bin/echo", "Image pulled successfully!"},
+							Command: []string{"/tmp/bin/echo", message},
 							VolumeMounts: []corev1.VolumeMount{
 								{
 									Name:      "tmp-bin",
@@ -107,6 +129,7 @@ func newImagePullJob(imagecache *fledgedv1alpha1.ImageCache, image string, node
 								},
 							},
 							ImagePullPolicy: pullPolicy,
+							Resources:       jobResources(imagecache),
 						},
 					},
 					Volumes: []corev1.Volume{
@@ -117,23 +140,792 @@ func newImagePullJob(imagecache *fledgedv1alpha1.ImageCache, image string, node
 							},
 						},
 					},
-					RestartPolicy:    corev1.RestartPolicyNever,
-					ImagePullSecrets: imagecache.Spec.ImagePullSecrets,
-					Tolerations: []corev1.Toleration{
-						{
-							Operator: corev1.TolerationOpExists,
-						},
-					},
+					RestartPolicy:      corev1.RestartPolicyNever,
+					ImagePullSecrets:   imagePullSecrets(iwr),
+					Tolerations:        jobTolerations(iwr),
+					PriorityClassName:  iwr.PriorityClassName,
+					ServiceAccountName: iwr.ServiceAccountName,
+					DNSPolicy:          iwr.DNSPolicy,
+					DNSConfig:          iwr.DNSConfig.DeepCopy(),
 				},
 			},
 		},
 	}
+	// The synthetic image cache of a warm-up does not exist, so cannot own the job
+	if !iwr.WarmUp {
+		job.OwnerReferences = []metav1.OwnerReference{
+			*metav1.NewControllerRef(imagecache, schema.GroupVersionKind{
+				Group:   fledgedv1alpha1.SchemeGroupVersion.Group,
+				Version: fledgedv1alpha1.SchemeGroupVersion.Version,
+				Kind:    "ImageCache",
+			}),
+		}
+	}
+	if imagecache.Spec.PullJobContainer != nil && pullPolicy != corev1.PullNever {
+		overridePullJobContainer(job, iwr)
+	}
 	return job, nil
 }
 
+// overridePullJobContainer replaces the containers of an image pull job with the pull job
+// container specified in the image cache. The image to be pulled is passed in IMAGE env variable
+// (along with its platform, if any, in PLATFORM env variable, and the mirrors of its image list,
+// if any, comma-separated in MIRRORS env variable)
+func overridePullJobContainer(job *batchv1.Job, iwr ImageWorkRequest) {
+	override := iwr.Imagecache.Spec.PullJobContainer
+	podSpec := &job.Spec.Template.Spec
+	podSpec.InitContainers = nil
+	podSpec.Containers = []corev1.Container{
+		{
+			Name:    "imagepuller",
+			Image:   override.Image,
+			Command: override.Command,
+			Args:    override.Args,
+			Env: []corev1.EnvVar{
+				{
+					Name:  "IMAGE",
+					Value: iwr.Image,
+				},
+			},
+			ImagePullPolicy: corev1.PullIfNotPresent,
+			Resources:       jobResources(iwr.Imagecache),
+		},
+	}
+	if iwr.Platform != "" {
+		podSpec.Containers[0].Env = append(podSpec.Containers[0].Env, corev1.EnvVar{Name: "PLATFORM", Value: iwr.Platform})
+	}
+	if iwr.Mirrors != nil && len(*iwr.Mirrors) > 0 {
+		podSpec.Containers[0].Env = append(podSpec.Containers[0].Env, corev1.EnvVar{Name: "MIRRORS", Value: strings.Join(*iwr.Mirrors, ",")})
+	}
+	podSpec.Volumes = nil
+}
+
+// mountRuntimeSocket mounts the container runtime socket of the node into the overridden pull job
+// container. The socket grants full control of the container runtime, and thereby of the node (e.g.
+// to run privileged containers), to the container, so it is mounted only if enabled in the controller
+func mountRuntimeSocket(job *batchv1.Job, iwr ImageWorkRequest) {
+	hostpathtype := corev1.HostPathSocket
+	socketPath := runtimeSocketPath(iwr.ContainerRuntimeVersion)
+	podSpec := &job.Spec.Template.Spec
+	podSpec.Containers[0].VolumeMounts = append(podSpec.Containers[0].VolumeMounts, corev1.VolumeMount{
+		Name:      "runtime-sock",
+		MountPath: socketPath,
+	})
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: "runtime-sock",
+		VolumeSource: corev1.VolumeSource{
+			HostPath: &corev1.HostPathVolumeSource{
+				Path: socketPath,
+				Type: &hostpathtype,
+			},
+		},
+	})
+}
+
+// pullJobContainerAllowed returns true if the image of a pull job container is one of the allowed images.
+// An allowed image without a tag or digest allows any tag or digest of its repository
+func pullJobContainerAllowed(image string, allowed []string) bool {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return false
+	}
+	for _, a := range allowed {
+		allowedNamed, err := reference.ParseNormalizedNamed(a)
+		if err != nil {
+			continue
+		}
+		if reference.IsNameOnly(allowedNamed) {
+			if allowedNamed.Name() == named.Name() {
+				return true
+			}
+		} else if allowedNamed.String() == named.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// mountCredentialsSecret mounts the credentials secret of the image cache into the containers of an
+// image pull job, and sets the env variable of the secret to its mount path, or to the path of its key
+func mountCredentialsSecret(job *batchv1.Job, iwr ImageWorkRequest) {
+	secret := iwr.Imagecache.Spec.CredentialsSecret
+	podSpec := &job.Spec.Template.Spec
+	env := corev1.EnvVar{Name: secret.EnvName, Value: secret.MountPath}
+	if env.Name == "" {
+		env.Name = defaultCredentialsEnvName
+	}
+	if secret.Key != "" {
+		env.Value = path.Join(secret.MountPath, secret.Key)
+	}
+	for i := range podSpec.Containers {
+		podSpec.Containers[i].VolumeMounts = append(podSpec.Containers[i].VolumeMounts, corev1.VolumeMount{
+			Name:      "registry-credentials",
+			MountPath: secret.MountPath,
+			ReadOnly:  true,
+		})
+		podSpec.Containers[i].Env = append(podSpec.Containers[i].Env, env)
+	}
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: "registry-credentials",
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: secret.SecretName,
+			},
+		},
+	})
+}
+
+// podFailureReasonMessage returns the reason and message of failure of an image work job's pod,
+// from the waiting and terminated states of its init containers and containers. The reason is
+// that of the first failed container. If more than one container failed, the message lists the
+// reason and message of each failed container. Empty strings are returned if no container failed
+func podFailureReasonMessage(pod *corev1.Pod) (string, string) {
+	type failure struct{ container, reason, message string }
+	failures := []failure{}
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, cs := range statuses {
+		if w := cs.State.Waiting; w != nil && w.Reason != "" && w.Reason != "PodInitializing" && w.Reason != "ContainerCreating" {
+			failures = append(failures, failure{cs.Name, w.Reason, w.Message})
+		}
+		if t := cs.State.Terminated; t != nil && (t.ExitCode != 0 || (t.Reason != "" && t.Reason != "Completed")) {
+			reason := t.Reason
+			if reason == "" {
+				reason = "Error"
+			}
+			failures = append(failures, failure{cs.Name, reason, t.Message})
+		}
+	}
+	if len(failures) == 0 {
+		return "", ""
+	}
+	if len(failures) == 1 {
+		return failures[0].reason, failures[0].message
+	}
+	messages := []string{}
+	for _, f := range failures {
+		messages = append(messages, fmt.Sprintf("%s: %s: %s", f.container, f.reason, f.message))
+	}
+	return failures[0].reason, strings.Join(messages, "; ")
+}
+
+// podNotStarted returns true if the image work job's pod has not been started by the kubelet of its
+// node, along with the reason, i.e. if the pod could not be scheduled (e.g. the node is tainted as not
+// ready), or the kubelet has not reported the status of any container of the pod, as when the node is
+// not ready. Pods that started and are pending due to image pull errors are not included
+func podNotStarted(pod *corev1.Pod) (bool, string) {
+	if pod.Status.Phase != corev1.PodPending {
+		return false, ""
+	}
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodScheduled && c.Status == corev1.ConditionFalse {
+			return true, fmt.Sprintf("Pod not scheduled: %s", c.Message)
+		}
+	}
+	if len(pod.Status.InitContainerStatuses) == 0 && len(pod.Status.ContainerStatuses) == 0 {
+		return true, "Pod not started by the kubelet, check if node is ready"
+	}
+	return false, ""
+}
+
+// podNeverScheduled returns true, along with a message, if the pod of a job was never scheduled i.e. the
+// latest pod of the job is pending without being bound to a node. pods are the pods of the job, latest first
+func podNeverScheduled(pods []*corev1.Pod) (bool, string) {
+	if len(pods) == 0 || pods[0].Status.Phase != corev1.PodPending || pods[0].Spec.NodeName != "" {
+		return false, ""
+	}
+	for _, c := range pods[0].Status.Conditions {
+		if c.Type == corev1.PodScheduled && c.Status == corev1.ConditionFalse && c.Message != "" {
+			return true, "Pod never scheduled: " + c.Message
+		}
+	}
+	return true, "Pod never scheduled"
+}
+
+// imageNeverPulled returns true if the image pull job's pod cannot start since the image is not
+// present in the node and its pull policy is Never
+func imageNeverPulled(pod *corev1.Pod) bool {
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.Name == "imagepuller" && cs.State.Waiting != nil && cs.State.Waiting.Reason == "ErrImageNeverPull" {
+			return true
+		}
+	}
+	return false
+}
+
+// imagePullErrorReasons are the reasons of the waiting state of a container whose image the kubelet
+// could not pull. The kubelet retries the pull of such a container with a backoff
+var imagePullErrorReasons = map[string]bool{
+	"ErrImagePull":        true,
+	"ImagePullBackOff":    true,
+	"InvalidImageName":    true,
+	"ErrImageInspect":     true,
+	"RegistryUnavailable": true,
+}
+
+// imagePullErrored returns true if the image pull job's pod cannot start since the kubelet failed to
+// pull the image of its container, and keeps the pod pending while it retries the pull
+func imagePullErrored(pod *corev1.Pod) bool {
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.Name == "imagepuller" && cs.State.Waiting != nil && imagePullErrorReasons[cs.State.Waiting.Reason] {
+			return true
+		}
+	}
+	return false
+}
+
+// pulledImageDigest returns the digest the image resolved to in the image pull job's pod, from the
+// image id of its container. An empty string is returned if the container of the pod does not run
+// the image (e.g. an overridden pull job container) or the image id is not a repository digest
+func pulledImageDigest(pod *corev1.Pod, image string) string {
+	for _, c := range pod.Spec.Containers {
+		if c.Name == "imagepuller" && c.Image != image {
+			return ""
+		}
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.Name != "imagepuller" {
+			continue
+		}
+		if i := strings.LastIndex(cs.ImageID, "@"); i >= 0 {
+			return cs.ImageID[i+1:]
+		}
+	}
+	return ""
+}
+
+// isInsecureRegistry returns true if the registry of the image is one of the insecure registries.
+// Registries are matched by host (and port), images without a registry are from docker.io
+func isInsecureRegistry(image string, insecureRegistries []string) (bool, error) {
+	if len(insecureRegistries) == 0 {
+		return false, nil
+	}
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return false, err
+	}
+	domain := reference.Domain(named)
+	for _, registry := range insecureRegistries {
+		if registry == domain {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// containerdImageName returns the fully qualified name of the image, with "latest" tag if it has
+// neither tag nor digest, as required by the containerd CLI
+func containerdImageName(image string) string {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return image
+	}
+	return reference.TagNameOnly(named).String()
+}
+
+// mirrorImage returns the image in the mirror with the path and the tag (or digest) of the image
+// e.g. mirror.local:5000/library/nginx:1.17 for nginx:1.17 in mirror mirror.local:5000
+func mirrorImage(image, mirror string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", err
+	}
+	mirrored := strings.TrimSuffix(mirror, "/") + "/" + reference.Path(named)
+	if digested, ok := named.(reference.Digested); ok {
+		return mirrored + "@" + digested.Digest().String(), nil
+	}
+	return mirrored + ":" + reference.TagNameOnly(named).(reference.Tagged).Tag(), nil
+}
+
+// pullsFromMirrors returns true if the image pull job of the request tries the mirrors of its image
+// list. Mirrors are tried using the client of the container runtime, on nodes with containerd or
+// docker runtime. Overridden pull job containers are passed the mirrors instead
+func pullsFromMirrors(iwr ImageWorkRequest) bool {
+	return iwr.Mirrors != nil && len(*iwr.Mirrors) > 0 && iwr.ImageArchive == nil && iwr.Imagecache.Spec.PullJobContainer == nil &&
+		!strings.Contains(iwr.ContainerRuntimeVersion, "crio") && !strings.Contains(iwr.ContainerRuntimeVersion, "cri-o")
+}
+
+// pulledImageSource returns the source pulled by the image pull job's pod that tried the mirrors
+// of the image, from the termination message of its container
+func pulledImageSource(pod *corev1.Pod) string {
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.Name == "imagepuller" && cs.State.Terminated != nil {
+			return strings.TrimSpace(cs.State.Terminated.Message)
+		}
+	}
+	return ""
+}
+
+// setJobLimits sets the active deadline of the job to the deadline of the image work request, so that
+// the job controller terminates the pods of the job once the deadline is exceeded, and the no. of times
+// the job controller retries the failed pod of the job. The TTL of the job, if set, has the finished job
+// deleted by kubernetes even if the controller fails to delete it
+func setJobLimits(job *batchv1.Job, deadline time.Duration, backoffLimit int32, ttlAfterFinished time.Duration) {
+	activeDeadlineSeconds := int64(math.Ceil(deadline.Seconds()))
+	job.Spec.ActiveDeadlineSeconds = &activeDeadlineSeconds
+	job.Spec.BackoffLimit = &backoffLimit
+	if ttlAfterFinished > 0 {
+		ttlSecondsAfterFinished := int32(math.Ceil(ttlAfterFinished.Seconds()))
+		job.Spec.TTLSecondsAfterFinished = &ttlSecondsAfterFinished
+	}
+}
+
+// setJobRunPolicy sets the restart policy of the pod of the job, and the no. of completions and
+// parallelism of the job. Completions and parallelism are left unset, i.e. 1, unless greater than 1
+func setJobRunPolicy(job *batchv1.Job, restartPolicy corev1.RestartPolicy, completions, parallelism int32) {
+	if restartPolicy != "" {
+		job.Spec.Template.Spec.RestartPolicy = restartPolicy
+	}
+	if completions > 1 {
+		job.Spec.Completions = &completions
+	}
+	if parallelism > 1 {
+		job.Spec.Parallelism = &parallelism
+	}
+}
+
+// ValidateJobRunPolicy returns an error unless the restart policy, completions and parallelism of
+// image pull and delete jobs are a valid combination: the restart policy is Never or OnFailure, and
+// the parallelism is between 1 and the no. of completions
+func ValidateJobRunPolicy(restartPolicy string, completions, parallelism int) error {
+	if restartPolicy != string(corev1.RestartPolicyNever) && restartPolicy != string(corev1.RestartPolicyOnFailure) {
+		return fmt.Errorf("invalid restart policy %q: possible values are '%s' and '%s'", restartPolicy, corev1.RestartPolicyNever, corev1.RestartPolicyOnFailure)
+	}
+	if completions < 1 {
+		return fmt.Errorf("invalid completions %d: must be at least 1", completions)
+	}
+	if parallelism < 1 || parallelism > completions {
+		return fmt.Errorf("invalid parallelism %d: must be between 1 and the completions %d", parallelism, completions)
+	}
+	return nil
+}
+
+// setJobSecurityContext sets the security context of the request on the pod and on each
+// container of the job, so that jobs can comply with the pod security policies of the cluster
+func setJobSecurityContext(job *batchv1.Job, iwr ImageWorkRequest) {
+	podSpec := &job.Spec.Template.Spec
+	if iwr.PodSecurityContext != nil {
+		podSpec.SecurityContext = iwr.PodSecurityContext.DeepCopy()
+	}
+	if iwr.SecurityContext == nil {
+		return
+	}
+	for i := range podSpec.InitContainers {
+		podSpec.InitContainers[i].SecurityContext = iwr.SecurityContext.DeepCopy()
+	}
+	for i := range podSpec.Containers {
+		podSpec.Containers[i].SecurityContext = iwr.SecurityContext.DeepCopy()
+	}
+}
+
+// toleratesKey returns true if any of the tolerations tolerates the NoSchedule taints with the key
+func toleratesKey(tolerations []corev1.Toleration, key string) bool {
+	for _, t := range tolerations {
+		if (t.Key == key || (t.Key == "" && t.Operator == corev1.TolerationOpExists)) && (t.Effect == "" || t.Effect == corev1.TaintEffectNoSchedule) {
+			return true
+		}
+	}
+	return false
+}
+
+// setJobDeviceResources requests the device resources of the image list in the container pulling the image.
+// Extended resources cannot be overcommitted, so their requests and limits must be equal
+func setJobDeviceResources(job *batchv1.Job, iwr ImageWorkRequest) {
+	if iwr.DeviceResources == nil || len(*iwr.DeviceResources) == 0 {
+		return
+	}
+	container := &job.Spec.Template.Spec.Containers[0]
+	if container.Resources.Requests == nil {
+		container.Resources.Requests = corev1.ResourceList{}
+	}
+	if container.Resources.Limits == nil {
+		container.Resources.Limits = corev1.ResourceList{}
+	}
+	for name, quantity := range *iwr.DeviceResources {
+		container.Resources.Requests[name] = quantity.DeepCopy()
+		container.Resources.Limits[name] = quantity.DeepCopy()
+	}
+}
+
+// propagateMetadata copies the labels and annotations with the given keys, if present in the image cache,
+// to the job and its pod template. Labels and annotations of the job set by kube-fledged are not overwritten
+func propagateMetadata(job *batchv1.Job, imagecache *fledgedv1alpha1.ImageCache, labelKeys, annotationKeys []string) {
+	for _, meta := range []*metav1.ObjectMeta{&job.ObjectMeta, &job.Spec.Template.ObjectMeta} {
+		meta.Labels = mergeMetadata(meta.Labels, imagecache.Labels, labelKeys)
+		meta.Annotations = mergeMetadata(meta.Annotations, imagecache.Annotations, annotationKeys)
+	}
+}
+
+// mergeMetadata returns a copy of the labels (or annotations) of the job with the given keys of the
+// image cache added, unless already set
+func mergeMetadata(jobMetadata, imagecacheMetadata map[string]string, keys []string) map[string]string {
+	if len(keys) == 0 {
+		return jobMetadata
+	}
+	merged := make(map[string]string, len(jobMetadata)+len(keys))
+	for k, v := range jobMetadata {
+		merged[k] = v
+	}
+	for _, k := range keys {
+		if _, set := merged[k]; set {
+			continue
+		}
+		if v, ok := imagecacheMetadata[k]; ok {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+// pullSource is an image pulled by an image pull job i.e. the image of the request or its image in a
+// mirror, and whether it is pulled over plain HTTP from an insecure registry (containerd only)
+type pullSource struct {
+	image     string
+	plainHTTP bool
+}
+
+// useCRIClientPull replaces the containers of an image pull job with a cri client container that
+// pulls the image using the client of the container runtime, over plain HTTP (containerd only),
+// with the client certificate of the client TLS secret (containerd only), trusting the CAs of the CA bundle
+// (containerd only) and for the platform of the request. Images are pulled into the containerd namespace of the request.
+// The first source is the image of the request. If there are more sources (mirrors), each source is
+// tried in order until one is pulled, which is then tagged with the name of the image. The source
+// pulled is written to the termination log of the container
+func useCRIClientPull(job *batchv1.Job, iwr ImageWorkRequest, criClientImage string, sources []pullSource) {
+	socketPath := runtimeSocketPath(iwr.ContainerRuntimeVersion)
+	containerd := strings.Contains(iwr.ContainerRuntimeVersion, "containerd")
+	namespace := iwr.ContainerdNamespace
+	if namespace == "" {
+		namespace = defaultContainerdNamespace
+	}
+	ctr := "/usr/bin/ctr --address " + socketPath + " --namespace " + namespace
+	clientTLS := containerd && iwr.Imagecache.Spec.ClientTLSSecret != ""
+	caBundle := containerd && iwr.Imagecache.Spec.CABundle != nil
+	snapshotter := ""
+	if containerd {
+		snapshotter = iwr.Imagecache.Spec.Snapshotter
+	}
+	var env []corev1.EnvVar
+	if !containerd && iwr.Platform != "" {
+		// docker CLI prior to 20.10 requires experimental features for selecting the platform
+		env = []corev1.EnvVar{{Name: "DOCKER_CLI_EXPERIMENTAL", Value: "enabled"}}
+	}
+	pullCommand := func(source pullSource) string {
+		if !containerd {
+			if iwr.Platform == "" {
+				return "/usr/bin/docker pull " + source.image
+			}
+			return "/usr/bin/docker pull --platform " + iwr.Platform + " " + source.image
+		}
+		command := ctr + " images pull"
+		if source.plainHTTP {
+			command += " --plain-http"
+		}
+		if iwr.Platform != "" {
+			command += " --platform " + iwr.Platform
+		}
+		if clientTLS {
+			command += " --tlscert " + path.Join(clientTLSMountPath, corev1.TLSCertKey) + " --tlskey " + path.Join(clientTLSMountPath, corev1.TLSPrivateKeyKey)
+		}
+		if caBundle {
+			command += " --tlscacert " + path.Join(caBundleMountPath, corev1.ServiceAccountRootCAKey)
+		} else if clientTLS {
+			command += " $TLS_CA"
+		}
+		if snapshotter != "" {
+			command += " --snapshotter " + snapshotter
+		}
+		return command + " " + containerdImageName(source.image)
+	}
+	command := "exec " + pullCommand(sources[0]) + " > /dev/termination-log 2>&1"
+	if len(sources) > 1 {
+		attempts := make([]string, 0, len(sources))
+		for i, source := range sources {
+			attempt := pullCommand(source) + " >> /dev/termination-log 2>&1"
+			if i > 0 && containerd {
+				attempt += " && " + ctr + " images tag " + containerdImageName(source.image) + " " + containerdImageName(iwr.Image) + " >> /dev/termination-log 2>&1"
+			} else if i > 0 {
+				attempt += " && /usr/bin/docker tag " + source.image + " " + iwr.Image + " >> /dev/termination-log 2>&1"
+			}
+			attempts = append(attempts, "{ "+attempt+" && echo -n "+source.image+" > /dev/termination-log; }")
+		}
+		command = strings.Join(attempts, " || ")
+	}
+	if clientTLS && !caBundle {
+		// The CA certificate is optional in the secret, and is passed only if present
+		caPath := path.Join(clientTLSMountPath, corev1.ServiceAccountRootCAKey)
+		command = "TLS_CA=; if [ -f " + caPath + " ]; then TLS_CA=\"--tlscacert " + caPath + "\"; fi; " + command
+	}
+	hostpathtype := corev1.HostPathSocket
+	podSpec := &job.Spec.Template.Spec
+	podSpec.InitContainers = nil
+	podSpec.Containers = []corev1.Container{
+		{
+			Name:    "imagepuller",
+			Image:   criClientImage,
+			Command: []string{"/bin/bash"},
+			Args:    []string{"-c", command},
+			Env:     env,
+			VolumeMounts: []corev1.VolumeMount{
+				{
+					Name:      "runtime-sock",
+					MountPath: socketPath,
+				},
+			},
+			ImagePullPolicy: corev1.PullIfNotPresent,
+			Resources:       jobResources(iwr.Imagecache),
+		},
+	}
+	podSpec.Volumes = []corev1.Volume{
+		{
+			Name: "runtime-sock",
+			VolumeSource: corev1.VolumeSource{
+				HostPath: &corev1.HostPathVolumeSource{
+					Path: socketPath,
+					Type: &hostpathtype,
+				},
+			},
+		},
+	}
+	if clientTLS {
+		podSpec.Containers[0].VolumeMounts = append(podSpec.Containers[0].VolumeMounts, corev1.VolumeMount{
+			Name:      "client-tls",
+			MountPath: clientTLSMountPath,
+			ReadOnly:  true,
+		})
+		podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+			Name: "client-tls",
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: iwr.Imagecache.Spec.ClientTLSSecret,
+				},
+			},
+		})
+	}
+	if caBundle {
+		podSpec.Containers[0].VolumeMounts = append(podSpec.Containers[0].VolumeMounts, corev1.VolumeMount{
+			Name:      "ca-bundle",
+			MountPath: caBundleMountPath,
+			ReadOnly:  true,
+		})
+		podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+			Name:         "ca-bundle",
+			VolumeSource: caBundleVolumeSource(iwr.Imagecache.Spec.CABundle),
+		})
+	}
+}
+
+// caBundleVolumeSource returns the volume source of the ConfigMap or Secret of the CA bundle. The key
+// of the certificates is mounted as ca.crt, irrespective of the key
+func caBundleVolumeSource(bundle *fledgedv1alpha1.CABundle) corev1.VolumeSource {
+	items := []corev1.KeyToPath{{Key: caBundleKey(bundle), Path: corev1.ServiceAccountRootCAKey}}
+	if bundle.SecretName != "" {
+		return corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: bundle.SecretName, Items: items}}
+	}
+	return corev1.VolumeSource{
+		ConfigMap: &corev1.ConfigMapVolumeSource{
+			LocalObjectReference: corev1.LocalObjectReference{Name: bundle.ConfigMapName},
+			Items:                items,
+		},
+	}
+}
+
+// caBundleKey returns the key of the certificates in the ConfigMap or Secret of the CA bundle
+func caBundleKey(bundle *fledgedv1alpha1.CABundle) string {
+	if bundle.Key == "" {
+		return corev1.ServiceAccountRootCAKey
+	}
+	return bundle.Key
+}
+
+// useImageArchiveLoad replaces the containers of an image pull job with a cri client container that
+// loads the image from its archive in the volume of image archives of the request, instead of pulling
+// it from its registry. The image and the path of its archive are passed in IMAGE and IMAGE_ARCHIVE env
+// variables. Unless the load command is specified, the archive is imported into the containerd namespace
+// of the request on nodes with containerd runtime, and loaded using docker CLI otherwise
+func useImageArchiveLoad(job *batchv1.Job, iwr ImageWorkRequest, criClientImage string) {
+	socketPath := runtimeSocketPath(iwr.ContainerRuntimeVersion)
+	archive := iwr.ImageArchive
+	command := archive.Command
+	var args []string
+	if len(command) == 0 {
+		var loadCommand string
+		if strings.Contains(iwr.ContainerRuntimeVersion, "containerd") {
+			namespace := iwr.ContainerdNamespace
+			if namespace == "" {
+				namespace = defaultContainerdNamespace
+			}
+			loadCommand = "/usr/bin/ctr --address " + socketPath + " --namespace " + namespace + " images import \"$IMAGE_ARCHIVE\""
+		} else {
+			loadCommand = "/usr/bin/docker load -i \"$IMAGE_ARCHIVE\""
+		}
+		command = []string{"/bin/bash"}
+		args = []string{"-c", "exec " + loadCommand + " > /dev/termination-log 2>&1"}
+	}
+	archiveVolume := corev1.VolumeSource{
+		HostPath: &corev1.HostPathVolumeSource{
+			Path: archive.HostPath,
+		},
+	}
+	if archive.PersistentVolumeClaim != "" {
+		archiveVolume = corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: archive.PersistentVolumeClaim,
+				ReadOnly:  true,
+			},
+		}
+	}
+	hostpathtype := corev1.HostPathSocket
+	podSpec := &job.Spec.Template.Spec
+	podSpec.InitContainers = nil
+	podSpec.Containers = []corev1.Container{
+		{
+			Name:    "imagepuller",
+			Image:   criClientImage,
+			Command: command,
+			Args:    args,
+			Env: []corev1.EnvVar{
+				{
+					Name:  "IMAGE",
+					Value: iwr.Image,
+				},
+				{
+					Name:  "IMAGE_ARCHIVE",
+					Value: imageArchivesMountPath + "/" + imageArchiveFileName(iwr.Image),
+				},
+			},
+			VolumeMounts: []corev1.VolumeMount{
+				{
+					Name:      "runtime-sock",
+					MountPath: socketPath,
+				},
+				{
+					Name:      "image-archives",
+					MountPath: imageArchivesMountPath,
+					ReadOnly:  true,
+				},
+			},
+			ImagePullPolicy: corev1.PullIfNotPresent,
+			Resources:       jobResources(iwr.Imagecache),
+		},
+	}
+	podSpec.Volumes = []corev1.Volume{
+		{
+			Name: "runtime-sock",
+			VolumeSource: corev1.VolumeSource{
+				HostPath: &corev1.HostPathVolumeSource{
+					Path: socketPath,
+					Type: &hostpathtype,
+				},
+			},
+		},
+		{
+			Name:         "image-archives",
+			VolumeSource: archiveVolume,
+		},
+	}
+}
+
+// imageArchiveFileName returns the file name of the archive of the image in the volume of image
+// archives i.e. the image with '/', ':' and '@' replaced by '_', suffixed with .tar
+func imageArchiveFileName(image string) string {
+	return strings.NewReplacer("/", "_", ":", "_", "@", "_").Replace(image) + ".tar"
+}
+
+// archiveLoadSupported returns true if images can be loaded from image archives using the
+// client of the container runtime
+func archiveLoadSupported(containerRuntimeVersion string) bool {
+	return !strings.Contains(containerRuntimeVersion, "crio") && !strings.Contains(containerRuntimeVersion, "cri-o")
+}
+
+// platformPullSupported returns true if the image of a platform other than the native platform
+// of the node can be pulled using the client of the container runtime
+func platformPullSupported(containerRuntimeVersion string) bool {
+	return !strings.Contains(containerRuntimeVersion, "crio") && !strings.Contains(containerRuntimeVersion, "cri-o")
+}
+
+// runtimeSocketPath returns the default socket path of the container runtime
+func runtimeSocketPath(containerRuntimeVersion string) string {
+	if strings.Contains(containerRuntimeVersion, "containerd") {
+		return "/run/containerd/containerd.sock"
+	}
+	if strings.Contains(containerRuntimeVersion, "crio") || strings.Contains(containerRuntimeVersion, "cri-o") {
+		return "/var/run/crio/crio.sock"
+	}
+	return "/var/run/docker.sock"
+}
+
+// imagePullSecrets returns the image pull secrets of the image cache merged with the
+// ones specified for the image list of the request. Duplicate secrets are dropped.
+func imagePullSecrets(iwr ImageWorkRequest) []corev1.LocalObjectReference {
+	if iwr.ImagePullSecrets == nil || len(*iwr.ImagePullSecrets) == 0 {
+		return iwr.Imagecache.Spec.ImagePullSecrets
+	}
+	secrets := []corev1.LocalObjectReference{}
+	seen := map[string]bool{}
+	for _, secret := range append(append(secrets, iwr.Imagecache.Spec.ImagePullSecrets...), *iwr.ImagePullSecrets...) {
+		if !seen[secret.Name] {
+			seen[secret.Name] = true
+			secrets = append(secrets, secret)
+		}
+	}
+	return secrets
+}
+
+// setDefaultPullSecret sets the default image pull secret of the controller on the pod of the image pull job,
+// if neither the image cache nor the image list of the request specify image pull secrets. The secret is
+// referred to by the pod, hence it is looked up in the namespace of the job
+func setDefaultPullSecret(job *batchv1.Job, iwr ImageWorkRequest, secret string) {
+	if secret == "" || len(imagePullSecrets(iwr)) > 0 {
+		return
+	}
+	job.Spec.Template.Spec.ImagePullSecrets = []corev1.LocalObjectReference{{Name: secret}}
+}
+
+// jobTolerations returns the tolerations of the image cache. If none are specified,
+// the job tolerates all taints so that images are cached in every selected node.
+// Otherwise, the job also tolerates the taints of the device resources it requests
+func jobTolerations(iwr ImageWorkRequest) []corev1.Toleration {
+	if iwr.Tolerations == nil || len(*iwr.Tolerations) == 0 {
+		return []corev1.Toleration{
+			{
+				Operator: corev1.TolerationOpExists,
+			},
+		}
+	}
+	tolerations := append([]corev1.Toleration{}, *iwr.Tolerations...)
+	if iwr.WorkType != ImageCachePurge && iwr.DeviceResources != nil {
+		names := make([]string, 0, len(*iwr.DeviceResources))
+		for name := range *iwr.DeviceResources {
+			names = append(names, string(name))
+		}
+		sort.Strings(names)
+		// Nodes with extended resources are tainted with the names of the resources as keys
+		for _, name := range names {
+			if toleratesKey(tolerations, name) {
+				continue
+			}
+			tolerations = append(tolerations, corev1.Toleration{
+				Key:      name,
+				Operator: corev1.TolerationOpExists,
+				Effect:   corev1.TaintEffectNoSchedule,
+			})
+		}
+	}
+	return tolerations
+}
+
+// jobResources returns the compute resources of job containers specified in the image cache
+func jobResources(imagecache *fledgedv1alpha1.ImageCache) corev1.ResourceRequirements {
+	if imagecache.Spec.JobResources == nil {
+		return corev1.ResourceRequirements{}
+	}
+	return *imagecache.Spec.JobResources.DeepCopy()
+}
+
 // newImageDeleteJob constructs a job manifest to delete an image from a node
-func newImageDeleteJob(imagecache *fledgedv1alpha1.ImageCache, image string, node *corev1.Node, containerRuntimeVersion string, dockerclientimage string) (*batchv1.Job, error) {
-	hostname := node.Labels["kubernetes.io/hostname"]
+func newImageDeleteJob(iwr ImageWorkRequest, dockerclientimage string) (*batchv1.Job, error) {
+	imagecache, image, containerRuntimeVersion := iwr.Imagecache, iwr.Image, iwr.ContainerRuntimeVersion
+	hostname := iwr.Node.Labels["kubernetes.io/hostname"]
 	if imagecache == nil {
 		glog.Error("imagecache pointer is nil")
 		return nil, fmt.Errorf("imagecache pointer is nil")
@@ -187,6 +979,7 @@ func newImageDeleteJob(imagecache *fledgedv1alpha1.ImageCache, image string, nod
 								},
 							},
 							ImagePullPolicy: corev1.PullIfNotPresent,
+							Resources:       jobResources(imagecache),
 						},
 					},
 					Volumes: []corev1.Volume{
@@ -200,13 +993,10 @@ func newImageDeleteJob(imagecache *fledgedv1alpha1.ImageCache, image string, nod
 							},
 						},
 					},
-					RestartPolicy:    corev1.RestartPolicyNever,
-					ImagePullSecrets: imagecache.Spec.ImagePullSecrets,
-					Tolerations: []corev1.Toleration{
-						{
-							Operator: corev1.TolerationOpExists,
-						},
-					},
+					RestartPolicy:     corev1.RestartPolicyNever,
+					ImagePullSecrets:  imagecache.Spec.ImagePullSecrets,
+					Tolerations:       jobTolerations(iwr),
+					PriorityClassName: iwr.PriorityClassName,
 				},
 			},
 		},
@@ -216,6 +1006,15 @@ func newImageDeleteJob(imagecache *fledgedv1alpha1.ImageCache, image string, nod
 	}
 	if strings.Contains(containerRuntimeVersion, "containerd") {
 		job.Spec.Template.Spec.Containers[0].Args = []string{"-c", "exec /usr/bin/crictl --runtime-endpoint=unix:///run/containerd/containerd.sock  --image-endpoint=unix:///run/containerd/containerd.sock rmi " + image + " > /dev/termination-log 2>&1"}
+		// crictl only manages images of the k8s.io namespace, so ctr is used for other namespaces
+		if iwr.ContainerdNamespace != "" && iwr.ContainerdNamespace != defaultContainerdNamespace {
+			named, err := reference.ParseNormalizedNamed(image)
+			if err != nil {
+				glog.Errorf("Error parsing image %s: %v", image, err)
+				return nil, err
+			}
+			job.Spec.Template.Spec.Containers[0].Args = []string{"-c", "exec /usr/bin/ctr --address /run/containerd/containerd.sock --namespace " + iwr.ContainerdNamespace + " images rm " + reference.TagNameOnly(named).String() + " > /dev/termination-log 2>&1"}
+		}
 		job.Spec.Template.Spec.Containers[0].VolumeMounts[0].MountPath = "/run/containerd/containerd.sock"
 		job.Spec.Template.Spec.Volumes[0].VolumeSource.HostPath.Path = "/run/containerd/containerd.sock"
 	}
@@ -228,6 +1027,14 @@ func newImageDeleteJob(imagecache *fledgedv1alpha1.ImageCache, image string, nod
 }
 
 func checkIfImageNeedsToBePulled(imagePullPolicy string, image string, node *corev1.Node) (bool, error) {
+	// With Never policy, a job is created only to report that the image is not present
+	if imagePullPolicy == string(corev1.PullNever) {
+		imageAlreadyPresent, err := ImageAlreadyPresentInNode(image, node)
+		if err != nil {
+			return false, err
+		}
+		return !imageAlreadyPresent, nil
+	}
 	if imagePullPolicy == string(corev1.PullIfNotPresent) {
 		if !strings.Contains(image, ":") && !strings.Contains(image, "@sha") {
 			return true, nil
@@ -235,7 +1042,7 @@ func checkIfImageNeedsToBePulled(imagePullPolicy string, image string, node *cor
 		if strings.Contains(image, ":latest") {
 			return true, nil
 		}
-		imageAlreadyPresent, err := imageAlreadyPresentInNode(image, node)
+		imageAlreadyPresent, err := ImageAlreadyPresentInNode(image, node)
 		if err != nil {
 			return false, err
 		}
@@ -246,13 +1053,134 @@ func checkIfImageNeedsToBePulled(imagePullPolicy string, image string, node *cor
 	return true, nil
 }
 
-func imageAlreadyPresentInNode(image string, node *corev1.Node) (bool, error) {
-	imagesByteSlice, err := json.Marshal(node.Status.Images)
+// ImageAlreadyPresentInNode returns true if the image is one of the images reported in the node
+// status. Node status lists each image by its repository tags and digests in normalized form (e.g.
+// "docker.io/library/nginx:1.17", "docker.io/library/nginx@sha256:..."), so the image is normalized
+// and matched by repository along with its digest, if any, or else its tag. Kubelet reports only
+// the largest images in node status (50 by default), other images are considered not present
+func ImageAlreadyPresentInNode(image string, node *corev1.Node) (bool, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return false, err
+	}
+	digested, isDigested := named.(reference.Digested)
+	tagged, isTagged := reference.TagNameOnly(named).(reference.Tagged)
+	for _, nodeImage := range node.Status.Images {
+		for _, name := range nodeImage.Names {
+			nodeNamed, err := reference.ParseNormalizedNamed(name)
+			if err != nil || nodeNamed.Name() != named.Name() {
+				continue
+			}
+			if isDigested {
+				if d, ok := nodeNamed.(reference.Digested); ok && d.Digest() == digested.Digest() {
+					return true, nil
+				}
+				continue
+			}
+			if t, ok := nodeNamed.(reference.Tagged); ok && isTagged && t.Tag() == tagged.Tag() {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// ImageUsedByPod returns true if a container of the pod runs or ran the image, i.e. the image is present in the
+// node of the pod. Images are compared by their normalized references (e.g. "nginx" is "docker.io/library/nginx:latest"):
+// an image referenced by digest matches the image id of a container, and a tagged image the image of a container
+func ImageUsedByPod(image string, pod *corev1.Pod) (bool, error) {
+	named, err := reference.ParseNormalizedNamed(image)
 	if err != nil {
 		return false, err
 	}
-	if strings.Contains(string(imagesByteSlice), image) {
-		return true, nil
+	named = reference.TagNameOnly(named)
+	specImages := map[string]string{}
+	for _, c := range append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...) {
+		specImages[c.Name] = c.Image
+	}
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, cs := range statuses {
+		if cs.State.Running == nil && cs.State.Terminated == nil && cs.LastTerminationState.Terminated == nil {
+			continue
+		}
+		for _, ref := range []string{specImages[cs.Name], cs.Image, strings.TrimPrefix(cs.ImageID, "docker-pullable://")} {
+			if sameImage(named, ref) {
+				return true, nil
+			}
+		}
 	}
 	return false, nil
 }
+
+// ImageNeededByPod returns true if the pod is neither succeeded nor failed, and a container of the pod runs or
+// is to run the image, e.g. a pending pod whose containers are being created or whose node is not yet assigned
+func ImageNeededByPod(image string, pod *corev1.Pod) (bool, error) {
+	if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		return false, nil
+	}
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return false, err
+	}
+	named = reference.TagNameOnly(named)
+	for _, c := range append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...) {
+		if sameImage(named, c.Image) {
+			return true, nil
+		}
+	}
+	return ImageUsedByPod(image, pod)
+}
+
+// sameImage returns true if the reference is of the normalized named image, i.e. of the same name, and the same
+// digest if the image is referenced by digest, or else the same tag. Image ids and invalid references do not match
+func sameImage(named reference.Named, ref string) bool {
+	other, err := reference.ParseNormalizedNamed(ref)
+	if err != nil || other.Name() != named.Name() {
+		return false
+	}
+	if digested, ok := named.(reference.Digested); ok {
+		d, ok := other.(reference.Digested)
+		return ok && d.Digest() == digested.Digest()
+	}
+	t, ok := reference.TagNameOnly(other).(reference.Tagged)
+	return ok && t.Tag() == named.(reference.Tagged).Tag()
+}
+
+// imageWorkAnnotationKey is the annotation of image pull and delete jobs with the key of their image work
+const imageWorkAnnotationKey = "kubefledged.k8s.io/image-work"
+
+// imageWorkKey returns the key of the image work of the request i.e. the image pulled to or deleted from
+// the node for the image cache, irrespective of the work type of the reconcile and of retries
+func imageWorkKey(iwr ImageWorkRequest) string {
+	action := "pull"
+	if iwr.WorkType == ImageCachePurge {
+		action = "delete"
+	}
+	return fmt.Sprintf("%s %s/%s %s %s", action, iwr.Imagecache.Namespace, iwr.Imagecache.Name, iwr.Node.Name, iwr.Image)
+}
+
+// maxJobNamePrefixLength is the max. length of the image cache name prefixing the names of jobs, so that
+// job names fit in the 63 characters of the job-name label of their pods
+const maxJobNamePrefixLength = 52
+
+// jobName returns the name of the job of an attempt of the image work request, which is the same for every
+// reconcile of the image cache requesting the same work e.g. "foo-3f2a9c61d0" for image cache foo
+func jobName(iwr ImageWorkRequest, attempt int) string {
+	prefix := iwr.Imagecache.Name
+	if len(prefix) > maxJobNamePrefixLength {
+		prefix = prefix[:maxJobNamePrefixLength]
+	}
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%s/%s\x00%s\x00%s\x00%s\x00%d", iwr.Imagecache.Namespace, iwr.Imagecache.Name,
+		iwr.Image, iwr.Node.Name, iwr.WorkType, attempt)))
+	return fmt.Sprintf("%s-%x", strings.TrimRight(prefix, "-."), hash[:5])
+}
+
+// jobFinished returns true if the job has completed or failed
+func jobFinished(job *batchv1.Job) bool {
+	for _, condition := range job.Status.Conditions {
+		if (condition.Type == batchv1.JobComplete || condition.Type == batchv1.JobFailed) && condition.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
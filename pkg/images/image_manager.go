@@ -17,15 +17,22 @@ limitations under the License.
 package images
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/golang/glog"
 	fledgedv1alpha1 "github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha1"
+	"github.com/senthilrch/kube-fledged/pkg/criagent"
+	"github.com/senthilrch/kube-fledged/pkg/logging"
+	"github.com/senthilrch/kube-fledged/pkg/metrics"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
@@ -37,29 +44,70 @@ import (
 	"k8s.io/client-go/kubernetes"
 	corelisters "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
 )
 
 const controllerAgentName = "fledged"
+
+// JobLabels are the labels common to the image pull and delete jobs, and their pods
+var JobLabels = map[string]string{"app": "imagecache", "controller": controllerAgentName}
+
 const fakeJobPrefix = "fakejob-"
 
+// criAgentWorkPrefix is the prefix of the names of image work done by CRI agents instead of jobs
+const criAgentWorkPrefix = "criagent-"
+
+// Reasons of events recorded on the image cache for image work results
 const (
-	// ImageWorkResultStatusSucceeded means image pull/delete succeeded
-	ImageWorkResultStatusSucceeded = "succeeded"
-	// ImageWorkResultStatusFailed means image pull/delete failed
-	ImageWorkResultStatusFailed = "failed"
-	// ImageWorkResultStatusJobCreated means job for image pull/delete created
-	ImageWorkResultStatusJobCreated = "jobcreated"
-	//ImageWorkResultStatusAlreadyPulled  means image is already present in the node
-	ImageWorkResultStatusAlreadyPulled = "alreadypulled"
+	EventReasonImagePulled       = "ImagePulled"
+	EventReasonImagePullFailed   = "ImagePullFailed"
+	EventReasonImagePullRetrying = "ImagePullRetrying"
+	EventReasonImageDeleted      = "ImageDeleted"
+	EventReasonImageDeleteFailed = "ImageDeleteFailed"
 )
 
+// throttledRequeueDelay is the delay after which an image work request deferred
+// due to concurrency limits is processed again
+const throttledRequeueDelay = time.Second
+
+// ImageWorkResultReasonReconcileTimeout is the reason of a failed image pull/delete abandoned since
+// the reconcile of the image cache timed out
+const ImageWorkResultReasonReconcileTimeout = "ReconcileTimeout"
+
+// ImageWorkResultReasonNodeNotReady is the reason of an image pull whose job did not start before
+// its deadline since the node of the job was not ready
+const ImageWorkResultReasonNodeNotReady = "NodeNotReady"
+
+// ImageWorkResultReasonPodNeverScheduled is the reason of an image pull/delete whose job's pod was never
+// scheduled to a node before its deadline, e.g. since no node had the capacity for the pod
+const ImageWorkResultReasonPodNeverScheduled = "PodNeverScheduled"
+
+// ImageWorkResultReasonImageInUse is the reason of an image not pulled to a node since a pod runs or ran
+// the image in the node
+const ImageWorkResultReasonImageInUse = "ImageInUse"
+
+// WarmUpImageCachePrefix is the prefix of the name of the synthetic image cache of a Deployment warm-up
+const WarmUpImageCachePrefix = "warmup-"
+
+// ImageWorkResultReasonPurgeDisabled is the reason of a failed image delete not done since purge is
+// disabled in the controller
+const ImageWorkResultReasonPurgeDisabled = "PurgeDisabled"
+
+// ImageWorkResultReasonPullJobContainerNotAllowed is the reason of a failed image pull not done since the
+// pull job container of the image cache is not allowed by the controller
+const ImageWorkResultReasonPullJobContainerNotAllowed = "PullJobContainerNotAllowed"
+
+// errPurgeDisabled is returned when deleting an image while purge is disabled
+var errPurgeDisabled = errors.New("image purge is disabled")
+
 // ImageManager provides the functionalities for pulling and deleting images
 type ImageManager struct {
 	fledgedNameSpace          string
 	workqueue                 workqueue.RateLimitingInterface
 	imageworkqueue            workqueue.RateLimitingInterface
 	kubeclientset             kubernetes.Interface
+	recorder                  record.EventRecorder
 	imageworkstatus           map[string]ImageWorkResult
 	kubeInformerFactory       kubeinformers.SharedInformerFactory
 	podsLister                corelisters.PodLister
@@ -67,7 +115,66 @@ type ImageManager struct {
 	imagePullDeadlineDuration time.Duration
 	dockerClientImage         string
 	imagePullPolicy           string
-	lock                      sync.RWMutex
+	maxRetries                int
+	maxConcurrentPulls        int
+	// maxPullsPerNode is the limit on outstanding image pulls to the same node, so as not to fill the
+	// disk or saturate the disk I/O of a node by pulling many images to it at once
+	maxPullsPerNode int
+	// maxTotalJobs is the limit on outstanding image pull and delete jobs across all image caches
+	maxTotalJobs int
+	// jobBackoffLimit is the no. of times the job controller retries the failed pod of a job
+	jobBackoffLimit int32
+	// jobRestartPolicy, jobCompletions and jobParallelism are the restart policy of the pods, and the
+	// no. of completions and parallelism of image pull and delete jobs
+	jobRestartPolicy corev1.RestartPolicy
+	jobCompletions   int32
+	jobParallelism   int32
+	// defaultPullSecret is the image pull secret of the pull jobs of image caches and image lists
+	// specifying no image pull secrets
+	defaultPullSecret string
+	// jobTTLAfterFinished is the TTL of finished jobs, after which they are deleted by kubernetes
+	jobTTLAfterFinished time.Duration
+	// jobRetention is the duration for which completed jobs are kept before they are deleted
+	jobRetention time.Duration
+	// nodeReadinessWait is the duration after the deadline of an image cache for which image pulls
+	// whose jobs did not start since their nodes were not ready are retried
+	nodeReadinessWait time.Duration
+	// insecureRegistries are the hosts of registries from which images are pulled over plain HTTP
+	insecureRegistries []string
+	// propagatedLabels and propagatedAnnotations are the keys of the labels and annotations copied
+	// from the image cache to its jobs
+	propagatedLabels      []string
+	propagatedAnnotations []string
+	// jobKubeInformerFactory watches the pods of jobs. It is kubeInformerFactory itself, unless jobs
+	// are created in the namespaces of image caches
+	jobKubeInformerFactory kubeinformers.SharedInformerFactory
+	jobPodsLister          corelisters.PodLister
+	jobPodsSynced          cache.InformerSynced
+	// jobsInImageCacheNamespace creates jobs in the namespace of their image cache instead of fledgedNameSpace
+	jobsInImageCacheNamespace bool
+	// disablePurge never deletes images from nodes. Image delete requests fail without creating jobs
+	disablePurge bool
+	// keepFailedJobs keeps failed jobs along with their pods, instead of deleting them once processed
+	keepFailedJobs bool
+	// pullJobContainerImages are the images allowed in the pull job containers of image caches. Image
+	// caches with other pull job containers fail to pull, and none are allowed if empty
+	pullJobContainerImages []string
+	// pullJobContainerRuntimeSocket mounts the container runtime socket of nodes into pull job containers
+	pullJobContainerRuntimeSocket bool
+	// adoptedJobs are the jobs found when the controller started (--adopt-jobs), by the key of their image
+	// work, which are claimed by the same image work instead of creating jobs
+	adoptedJobs map[string]*batchv1.Job
+	// registryBreaker suspends the image pulls from registries whose pulls fail consecutively
+	registryBreaker *registryBreaker
+	// progress tracks the progress of the worker of imageworkqueue
+	progress *QueueProgress
+	// deferredImageWork holds the image work requests deferred due to concurrency limits
+	deferredImageWork map[ImageWorkRequest]bool
+	// waitingForNodes holds the image work requests retried since the nodes of their jobs were not ready
+	waitingForNodes map[ImageWorkRequest]bool
+	// criAgentClient pulls and deletes images using the CRI agents of nodes instead of jobs, if set
+	criAgentClient *criagent.Client
+	lock           sync.RWMutex
 }
 
 // ImageWorkRequest has image name, node name, work type and imagecache
@@ -77,6 +184,54 @@ type ImageWorkRequest struct {
 	ContainerRuntimeVersion string
 	WorkType                WorkType
 	Imagecache              *fledgedv1alpha1.ImageCache
+	// ImagePullSecrets of the image list this image belongs to. A pointer is used since
+	// the request is queued in imageworkqueue and must remain comparable
+	ImagePullSecrets *[]corev1.LocalObjectReference
+	// PullDeadline overrides imagePullDeadlineDuration of the image manager, if set
+	PullDeadline *metav1.Duration
+	// Tolerations of the image cache
+	Tolerations *[]corev1.Toleration
+	// PriorityClassName of the pods of the job
+	PriorityClassName string
+	// ServiceAccountName of the pods of the job, applicable to image pull jobs only
+	ServiceAccountName string
+	// DNSPolicy of the pods of the job, applicable to image pull jobs only
+	DNSPolicy corev1.DNSPolicy
+	// DNSConfig of the pods of the job, applicable to image pull jobs only
+	DNSConfig *corev1.PodDNSConfig
+	// SecurityContext of the containers of the job
+	SecurityContext *corev1.SecurityContext
+	// PodSecurityContext of the pods of the job
+	PodSecurityContext *corev1.PodSecurityContext
+	// ImagePullPolicy overrides imagePullPolicy of the image manager, if set
+	ImagePullPolicy string
+	// ContainerdNamespace from which the image is deleted on nodes with containerd runtime
+	ContainerdNamespace string
+	// Platform (os/arch[/variant]) of the image to be pulled. The native platform of the node is pulled, if not set
+	Platform string
+	// ImageArchive from which the image is loaded instead of being pulled from its registry, if set
+	ImageArchive *fledgedv1alpha1.ImageArchive
+	// Mirrors of the image list this image belongs to, tried in order if the image cannot be pulled from its registry
+	Mirrors *[]string
+	// Optional image pulls do not fail the image cache
+	Optional bool
+	// DeviceResources of the image list this image belongs to, requested by the pull job. A pointer
+	// is used since the request must remain comparable
+	DeviceResources *corev1.ResourceList
+	// InUseBy is the pod (namespace/name) that runs or ran the image in the node, if any. The image is not
+	// pulled to the node, unless it is pulled always or for a platform
+	InUseBy string
+	// Aliases are the other images of the image cache resolving to the same digest as the image, which
+	// are cached in the node by the pull of the image and share its result. A pointer is used since the
+	// request must remain comparable
+	Aliases *[]string
+	// Expired purges are of images cached for longer than the max age of their image list
+	Expired bool
+	// WarmUp requests are transient work of a Deployment whose images changed, of a synthetic image cache
+	// named after the Deployment. Their results are logged, and not reported in the status of an image cache
+	WarmUp bool
+	// Context of the reconcile of the image cache. Outstanding work is abandoned once it is done
+	Context context.Context
 }
 
 // ImageWorkResult stores the result of pulling and deleting image
@@ -85,6 +240,31 @@ type ImageWorkResult struct {
 	Status           string
 	Reason           string
 	Message          string
+	// JobCreationTime is the time at which the job for the request was created
+	JobCreationTime time.Time
+	// CompletionTime is the time at which the result became final
+	CompletionTime time.Time
+	// Digest is the digest the image resolved to when it was pulled by the job, if known
+	Digest string
+	// Source is the image pulled by the job that tried the mirrors of the image i.e. the image or its image in a mirror
+	Source string
+	// JobName is the name of the job of the request, empty if the work is done without a job e.g. by the CRI agent
+	JobName string
+	// PodName is the name of the last pod of the job, once the pod is known
+	PodName string
+	// FailureCategory classifies the failure of the work, from the reason and message of the failure reported
+	// by the kubelet or the container runtime. It is empty for failures not reported by them e.g. deadlines
+	FailureCategory fledgedv1alpha1.FailureCategory
+}
+
+// PullDuration returns the wall-clock time from the creation of the job of an image pull (or the start of
+// the work of the CRI agent) until its result became final. Zero is returned for image deletes, and for
+// results without a job or not yet final
+func (iwres ImageWorkResult) PullDuration() time.Duration {
+	if iwres.ImageWorkRequest.WorkType == ImageCachePurge || iwres.JobCreationTime.IsZero() || iwres.CompletionTime.IsZero() {
+		return 0
+	}
+	return iwres.CompletionTime.Sub(iwres.JobCreationTime)
 }
 
 // WorkType refers to type of work to be done by sync handler
@@ -106,6 +286,47 @@ type WorkQueueKey struct {
 	ObjKey        string
 	Status        *map[string]ImageWorkResult
 	OldImageCache *fledgedv1alpha1.ImageCache
+	// ImagePullPolicy overrides the image pull policy of the image manager, if set
+	ImagePullPolicy string
+	// Image and Node restrict a purge to a single image on a node, if set. Node alone restricts
+	// a refresh to a new node
+	Image string
+	Node  string
+}
+
+// ImageManagerOptions are the options of an image manager
+type ImageManagerOptions struct {
+	// Namespace is the namespace of kube-fledged, in which jobs are created by default
+	Namespace                 string
+	ImagePullDeadlineDuration time.Duration
+	DockerClientImage         string
+	ImagePullPolicy           string
+	MaxRetries                int
+	MaxConcurrentPulls        int
+	MaxPullsPerNode           int
+	MaxTotalJobs              int
+	JobBackoffLimit           int
+	JobCompletions            int
+	JobParallelism            int
+	JobRestartPolicy          string
+	DefaultPullSecret         string
+	JobTTLAfterFinished       time.Duration
+	JobRetention              time.Duration
+	NodeReadinessWait         time.Duration
+	InsecureRegistries        []string
+	PropagatedLabels          []string
+	PropagatedAnnotations     []string
+	// CRIAgentClient pulls and deletes images through the CRI agents of nodes instead of jobs, if set
+	CRIAgentClient            *criagent.Client
+	JobsInImageCacheNamespace bool
+	DisablePurge              bool
+	KeepFailedJobs            bool
+	RegistryFailureThreshold  int
+	RegistryCircuitCooldown   time.Duration
+	// PullJobContainerImages are the images allowed in the pull job containers of image caches
+	PullJobContainerImages []string
+	// PullJobContainerRuntimeSocket mounts the container runtime socket of nodes into pull job containers
+	PullJobContainerRuntimeSocket bool
 }
 
 // NewImageManager returns a new image manager object
@@ -113,30 +334,70 @@ func NewImageManager(
 	workqueue workqueue.RateLimitingInterface,
 	imageworkqueue workqueue.RateLimitingInterface,
 	kubeclientset kubernetes.Interface,
-	namespace string,
-	imagePullDeadlineDuration time.Duration,
-	dockerClientImage, imagePullPolicy string) (*ImageManager, coreinformers.PodInformer) {
+	recorder record.EventRecorder,
+	opts ImageManagerOptions) (*ImageManager, coreinformers.PodInformer) {
 
 	kubeInformerFactory := kubeinformers.NewSharedInformerFactoryWithOptions(
 		kubeclientset,
 		time.Second*30,
-		kubeinformers.WithNamespace(namespace))
+		kubeinformers.WithNamespace(opts.Namespace))
 	podInformer := kubeInformerFactory.Core().V1().Pods()
+	jobKubeInformerFactory, jobPodInformer := kubeInformerFactory, podInformer
+	if opts.JobsInImageCacheNamespace {
+		// Pods of jobs in the namespaces of image caches are watched across namespaces, selected by their labels
+		jobKubeInformerFactory = kubeinformers.NewSharedInformerFactoryWithOptions(
+			kubeclientset,
+			time.Second*30,
+			kubeinformers.WithTweakListOptions(func(options *metav1.ListOptions) {
+				options.LabelSelector = labels.Set(JobLabels).String()
+			}))
+		jobPodInformer = jobKubeInformerFactory.Core().V1().Pods()
+	}
 
 	imagemanager := &ImageManager{
-		fledgedNameSpace:          namespace,
-		workqueue:                 workqueue,
-		imageworkqueue:            imageworkqueue,
-		kubeclientset:             kubeclientset,
-		imageworkstatus:           make(map[string]ImageWorkResult),
-		kubeInformerFactory:       kubeInformerFactory,
-		podsLister:                podInformer.Lister(),
-		podsSynced:                podInformer.Informer().HasSynced,
-		imagePullDeadlineDuration: imagePullDeadlineDuration,
-		dockerClientImage:         dockerClientImage,
-		imagePullPolicy:           imagePullPolicy,
-	}
-	podInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		fledgedNameSpace:              opts.Namespace,
+		workqueue:                     workqueue,
+		imageworkqueue:                imageworkqueue,
+		kubeclientset:                 kubeclientset,
+		recorder:                      recorder,
+		imageworkstatus:               make(map[string]ImageWorkResult),
+		kubeInformerFactory:           kubeInformerFactory,
+		podsLister:                    podInformer.Lister(),
+		podsSynced:                    podInformer.Informer().HasSynced,
+		jobKubeInformerFactory:        jobKubeInformerFactory,
+		jobPodsLister:                 jobPodInformer.Lister(),
+		jobPodsSynced:                 jobPodInformer.Informer().HasSynced,
+		jobsInImageCacheNamespace:     opts.JobsInImageCacheNamespace,
+		disablePurge:                  opts.DisablePurge,
+		keepFailedJobs:                opts.KeepFailedJobs,
+		pullJobContainerImages:        opts.PullJobContainerImages,
+		pullJobContainerRuntimeSocket: opts.PullJobContainerRuntimeSocket,
+		registryBreaker:               newRegistryBreaker(opts.RegistryFailureThreshold, opts.RegistryCircuitCooldown),
+		imagePullDeadlineDuration:     opts.ImagePullDeadlineDuration,
+		dockerClientImage:             opts.DockerClientImage,
+		imagePullPolicy:               opts.ImagePullPolicy,
+		maxRetries:                    opts.MaxRetries,
+		maxConcurrentPulls:            opts.MaxConcurrentPulls,
+		maxPullsPerNode:               opts.MaxPullsPerNode,
+		maxTotalJobs:                  opts.MaxTotalJobs,
+		jobBackoffLimit:               int32(opts.JobBackoffLimit),
+		jobRestartPolicy:              corev1.RestartPolicy(opts.JobRestartPolicy),
+		defaultPullSecret:             opts.DefaultPullSecret,
+		jobCompletions:                int32(opts.JobCompletions),
+		jobParallelism:                int32(opts.JobParallelism),
+		jobTTLAfterFinished:           opts.JobTTLAfterFinished,
+		jobRetention:                  opts.JobRetention,
+		nodeReadinessWait:             opts.NodeReadinessWait,
+		insecureRegistries:            opts.InsecureRegistries,
+		propagatedLabels:              opts.PropagatedLabels,
+		propagatedAnnotations:         opts.PropagatedAnnotations,
+		deferredImageWork:             make(map[ImageWorkRequest]bool),
+		waitingForNodes:               make(map[ImageWorkRequest]bool),
+		adoptedJobs:                   make(map[string]*batchv1.Job),
+		criAgentClient:                opts.CRIAgentClient,
+		progress:                      NewQueueProgress(),
+	}
+	jobPodInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
 		//AddFunc: ,
 		UpdateFunc: func(old, new interface{}) {
 			newPod := new.(*corev1.Pod)
@@ -150,11 +411,23 @@ func NewImageManager(
 			if (newPod.Status.Phase == corev1.PodSucceeded || newPod.Status.Phase == corev1.PodFailed) &&
 				(oldPod.Status.Phase != corev1.PodSucceeded && oldPod.Status.Phase != corev1.PodFailed) {
 				imagemanager.handlePodStatusChange(newPod)
+			} else if imageNeverPulled(newPod) && !imageNeverPulled(oldPod) {
+				imagemanager.handlePodStatusChange(newPod)
+			} else if imagePullErrored(newPod) && !imagePullErrored(oldPod) {
+				imagemanager.handlePodStatusChange(newPod)
 			}
 		},
 		//DeleteFunc: ,
 	})
-	return imagemanager, podInformer
+	return imagemanager, jobPodInformer
+}
+
+// jobNamespace returns the namespace of the jobs of the image work request
+func (m *ImageManager) jobNamespace(iwr ImageWorkRequest) string {
+	if m.jobsInImageCacheNamespace && iwr.Imagecache != nil {
+		return iwr.Imagecache.Namespace
+	}
+	return m.fledgedNameSpace
 }
 
 func (m *ImageManager) handlePodStatusChange(pod *corev1.Pod) {
@@ -168,39 +441,182 @@ func (m *ImageManager) handlePodStatusChange(pod *corev1.Pod) {
 		return
 	}
 
+	// Only the pod of a job whose result is pending changes the result. The informer may deliver the
+	// same status change more than once, and the result of a job may already be final (e.g. a job that
+	// expired) or be retried with a new job, in which case the pod of the job does not change the result
+	status := iwres.Status
+	if status != ImageWorkResultStatusJobCreated {
+		glog.V(4).Infof("Ignoring pod %s of job %s: image work result is already %q", pod.Name, pod.Labels["job-name"], status)
+		return
+	}
+	iwres.PodName = pod.Name
+
 	if pod.Status.Phase == corev1.PodSucceeded {
 		iwres.Status = ImageWorkResultStatusSucceeded
+		if iwres.ImageWorkRequest.WorkType != ImageCachePurge {
+			iwres.Digest = pulledImageDigest(pod, iwres.ImageWorkRequest.Image)
+			if pullsFromMirrors(iwres.ImageWorkRequest) && m.pullPolicy(iwres.ImageWorkRequest) != string(corev1.PullNever) {
+				iwres.Source = pulledImageSource(pod)
+			}
+		}
 		if iwres.ImageWorkRequest.WorkType == ImageCachePurge {
-			glog.Infof("Job %s succeeded (delete:- %s --> %s, runtime: %s)", pod.Labels["job-name"], iwres.ImageWorkRequest.Image, iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"], iwres.ImageWorkRequest.ContainerRuntimeVersion)
+			logging.Infof(imageWorkFields(iwres.ImageWorkRequest, pod.Labels["job-name"], iwres.Status), "Job %s succeeded (delete:- %s --> %s, runtime: %s)", pod.Labels["job-name"], iwres.ImageWorkRequest.Image, iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"], iwres.ImageWorkRequest.ContainerRuntimeVersion)
 		} else {
-			glog.Infof("Job %s succeeded (pull:- %s --> %s, runtime: %s)", pod.Labels["job-name"], iwres.ImageWorkRequest.Image, iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"], iwres.ImageWorkRequest.ContainerRuntimeVersion)
+			logging.Infof(imageWorkFields(iwres.ImageWorkRequest, pod.Labels["job-name"], iwres.Status), "Job %s succeeded (pull:- %s --> %s, runtime: %s)", pod.Labels["job-name"], iwres.ImageWorkRequest.Image, iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"], iwres.ImageWorkRequest.ContainerRuntimeVersion)
 		}
 	}
-	if pod.Status.Phase == corev1.PodFailed {
+	// With Never policy, the pod of the job stays pending if the image is not present in the node.
+	// Such a job is failed right away and not retried, since the image is not going to be pulled
+	neverPulled := imageNeverPulled(pod)
+	// A pull the kubelet failed is failed right away rather than left to the backoff of the kubelet, so
+	// that it is retried as per the retries of the image manager, or fails before its deadline
+	pullErrored := pod.Status.Phase == corev1.PodPending && !neverPulled && imagePullErrored(pod)
+	if pod.Status.Phase == corev1.PodFailed && !neverPulled && m.retriedByJob(pod.Namespace, pod.Labels["job-name"]) {
+		logging.Infof(imageWorkFields(iwres.ImageWorkRequest, pod.Labels["job-name"], iwres.Status), "Pod %s of job %s failed, to be retried by the job (%s --> %s)", pod.Name, pod.Labels["job-name"], iwres.ImageWorkRequest.Image, iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"])
+		return
+	}
+	if pod.Status.Phase == corev1.PodFailed || neverPulled || pullErrored {
 		iwres.Status = ImageWorkResultStatusFailed
-		if pod.Status.ContainerStatuses[0].State.Terminated != nil {
-			iwres.Reason = pod.Status.ContainerStatuses[0].State.Terminated.Reason
-			iwres.Message = pod.Status.ContainerStatuses[0].State.Terminated.Message
+		if reason, message := podFailureReasonMessage(pod); reason != "" {
+			iwres.Reason, iwres.Message = reason, message
+			iwres.FailureCategory = classifyFailure(reason, message)
 		}
 		if iwres.ImageWorkRequest.WorkType == ImageCachePurge {
-			glog.Infof("Job %s failed (delete: %s --> %s)", pod.Labels["job-name"], iwres.ImageWorkRequest.Image, iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"])
+			logging.Infof(imageWorkFields(iwres.ImageWorkRequest, pod.Labels["job-name"], iwres.Status), "Job %s failed (delete: %s --> %s)", pod.Labels["job-name"], iwres.ImageWorkRequest.Image, iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"])
+		} else if neverPulled {
+			logging.Infof(imageWorkFields(iwres.ImageWorkRequest, pod.Labels["job-name"], iwres.Status), "Job %s failed, image not present (verify: %s --> %s)", pod.Labels["job-name"], iwres.ImageWorkRequest.Image, iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"])
+		} else if retries := m.imageworkqueue.NumRequeues(iwres.ImageWorkRequest); retries < m.maxRetries {
+			// The image work request is queued again with a backoff as per the rate limiter of
+			// imageworkqueue. The request is forgotten only once it succeeds or retries are exhausted
+			iwres.Status = ImageWorkResultStatusRetrying
+			logging.Infof(imageWorkFields(iwres.ImageWorkRequest, pod.Labels["job-name"], iwres.Status), "Job %s failed, retrying %d/%d (pull: %s --> %s)", pod.Labels["job-name"], retries+1, m.maxRetries, iwres.ImageWorkRequest.Image, iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"])
 		} else {
-			glog.Infof("Job %s failed (pull: %s --> %s)", pod.Labels["job-name"], iwres.ImageWorkRequest.Image, iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"])
+			logging.Infof(imageWorkFields(iwres.ImageWorkRequest, pod.Labels["job-name"], iwres.Status), "Job %s failed (pull: %s --> %s)", pod.Labels["job-name"], iwres.ImageWorkRequest.Image, iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"])
 		}
 	}
+	// The result is changed only if no other event changed it in the meantime, so that the result
+	// is recorded, and the image work request retried, only once per job
 	m.lock.Lock()
+	if current, ok := m.imageworkstatus[pod.Labels["job-name"]]; !ok || current.Status != status {
+		m.lock.Unlock()
+		glog.V(4).Infof("Ignoring pod %s of job %s: image work result changed to %q", pod.Name, pod.Labels["job-name"], current.Status)
+		return
+	}
+	if iwres.Status != ImageWorkResultStatusRetrying {
+		iwres.CompletionTime = time.Now()
+	}
 	m.imageworkstatus[pod.Labels["job-name"]] = iwres
 	m.lock.Unlock()
-	return
+	if !neverPulled {
+		m.recordRegistryResult(iwres)
+	}
+	if iwres.Status == ImageWorkResultStatusRetrying {
+		m.imageworkqueue.AddRateLimited(iwres.ImageWorkRequest)
+		if iwres.ImageWorkRequest.Imagecache != nil && !iwres.ImageWorkRequest.WarmUp {
+			m.recorder.Eventf(iwres.ImageWorkRequest.Imagecache, corev1.EventTypeWarning, EventReasonImagePullRetrying,
+				"Image %s could not be pulled to node %s, retrying %d/%d: %s: %s", iwres.ImageWorkRequest.Image,
+				iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"], m.imageworkqueue.NumRequeues(iwres.ImageWorkRequest), m.maxRetries, iwres.Reason, iwres.Message)
+		}
+		return
+	}
+	m.imageworkqueue.Forget(iwres.ImageWorkRequest)
+	m.recordImageWorkResult(&iwres)
 }
 
-func (m *ImageManager) updatePendingImageWorkResults(imageCacheName string) error {
+// imageWorkFields are the structured log fields of an image work request and its job
+func imageWorkFields(iwr ImageWorkRequest, job, status string) logging.Fields {
+	fields := logging.Fields{
+		"image":    iwr.Image,
+		"worktype": iwr.WorkType,
+		"status":   status,
+	}
+	if iwr.Node != nil {
+		fields["node"] = iwr.Node.Labels["kubernetes.io/hostname"]
+	}
+	if iwr.Imagecache != nil {
+		fields["imagecache"] = iwr.Imagecache.Namespace + "/" + iwr.Imagecache.Name
+	}
+	if iwr.ContainerRuntimeVersion != "" {
+		fields["runtime"] = iwr.ContainerRuntimeVersion
+	}
+	if job != "" {
+		fields["job"] = job
+	}
+	return fields
+}
+
+// recordImageWorkResult records the completed image work result in the metrics, and as an event
+// of the image cache. The completion time of the result is set, unless already set
+func (m *ImageManager) recordImageWorkResult(iwres *ImageWorkResult) {
+	if iwres.CompletionTime.IsZero() {
+		iwres.CompletionTime = time.Now()
+	}
+	operation := metrics.OperationPull
+	if iwres.ImageWorkRequest.WorkType == ImageCachePurge {
+		operation = metrics.OperationPurge
+	}
+	metrics.ObserveImageWorkResult(operation, iwres.Status, iwres.JobCreationTime)
+	if iwres.Status == ImageWorkResultStatusFailed && iwres.FailureCategory != "" {
+		metrics.ObserveImageWorkFailure(operation, string(iwres.FailureCategory))
+	}
+	if duration := iwres.PullDuration(); duration > 0 && iwres.Status == ImageWorkResultStatusSucceeded {
+		metrics.ObserveImagePullDuration(iwres.ImageWorkRequest.Image, duration)
+	}
+
+	if iwres.ImageWorkRequest.Imagecache == nil || iwres.ImageWorkRequest.WarmUp {
+		return
+	}
+	eventType, reason := corev1.EventTypeNormal, EventReasonImagePulled
+	message := fmt.Sprintf("Image %s pulled to node %s", iwres.ImageWorkRequest.Image, iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"])
+	if iwres.ImageWorkRequest.WorkType == ImageCachePurge {
+		reason = EventReasonImageDeleted
+		message = fmt.Sprintf("Image %s deleted from node %s", iwres.ImageWorkRequest.Image, iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"])
+	}
+	if iwres.Status == ImageWorkResultStatusFailed {
+		eventType, reason = corev1.EventTypeWarning, EventReasonImagePullFailed
+		message = fmt.Sprintf("Image %s could not be pulled to node %s: %s: %s", iwres.ImageWorkRequest.Image, iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"], iwres.Reason, iwres.Message)
+		if iwres.ImageWorkRequest.WorkType == ImageCachePurge {
+			reason = EventReasonImageDeleteFailed
+			message = fmt.Sprintf("Image %s could not be deleted from node %s: %s: %s", iwres.ImageWorkRequest.Image, iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"], iwres.Reason, iwres.Message)
+		}
+	}
+	m.recorder.Event(iwres.ImageWorkRequest.Imagecache, eventType, reason, message)
+}
+
+func (m *ImageManager) updatePendingImageWorkResults(objKey string) error {
 	m.lock.Lock()
 	defer m.lock.Unlock()
 	for job, iwres := range m.imageworkstatus {
-		if iwres.ImageWorkRequest.Imagecache.Name == imageCacheName {
+		if imageCacheObjKey(iwres.ImageWorkRequest.Imagecache) == objKey {
+			if iwres.Status == ImageWorkResultStatusJobCreated && reconcileDone(iwres.ImageWorkRequest) {
+				iwres.Status = ImageWorkResultStatusFailed
+				iwres.Reason = ImageWorkResultReasonReconcileTimeout
+				iwres.Message = "Image cache reconcile timed out before the job completed"
+				logging.Infof(imageWorkFields(iwres.ImageWorkRequest, job, iwres.Status), "Job %s abandoned since reconcile timed out (%s --> %s)", job, iwres.ImageWorkRequest.Image, iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"])
+				m.recordImageWorkResult(&iwres)
+				m.imageworkstatus[job] = iwres
+				continue
+			}
+			if iwres.Status == ImageWorkResultStatusRetrying {
+				// Retry did not complete before the deadline. Reason and message of
+				// the last failed attempt are retained
+				iwres.Status = ImageWorkResultStatusFailed
+				logging.Infof(imageWorkFields(iwres.ImageWorkRequest, job, iwres.Status), "Job %s expired while retrying (pull: %s --> %s)", job, iwres.ImageWorkRequest.Image, iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"])
+				m.imageworkqueue.Forget(iwres.ImageWorkRequest)
+				m.recordImageWorkResult(&iwres)
+				m.imageworkstatus[job] = iwres
+			}
+			if iwres.Status == ImageWorkResultStatusJobCreated && !isJob(job) {
+				iwres.Status = ImageWorkResultStatusFailed
+				iwres.Reason = "DeadlineExceeded"
+				iwres.Message = "CRI agent did not complete the image work before the deadline"
+				logging.Infof(imageWorkFields(iwres.ImageWorkRequest, job, iwres.Status), "CRI agent work %s expired (%s --> %s)", job, iwres.ImageWorkRequest.Image, iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"])
+				m.recordImageWorkResult(&iwres)
+				m.imageworkstatus[job] = iwres
+				continue
+			}
 			if iwres.Status == ImageWorkResultStatusJobCreated {
-				pods, err := m.podsLister.Pods(m.fledgedNameSpace).
+				pods, err := m.jobPodsLister.Pods(m.jobNamespace(iwres.ImageWorkRequest)).
 					List(labels.Set(map[string]string{"job-name": job}).AsSelector())
 				if err != nil {
 					glog.Errorf("Error listing Pods: %v", err)
@@ -210,26 +626,26 @@ func (m *ImageManager) updatePendingImageWorkResults(imageCacheName string) erro
 					glog.Errorf("No pods matched job %s", job)
 					return fmt.Errorf("No pods matched job %s", job)
 				}
-				if len(pods) > 1 {
+				if len(pods) > 1 && m.jobBackoffLimit == 0 && m.jobCompletions <= 1 {
 					glog.Errorf("More than one pod matched job %s", job)
 					return fmt.Errorf("More than one pod matched job %s", job)
 				}
+				// Pods of a job retried by the job controller are created one after another
+				sort.Slice(pods, func(i, j int) bool {
+					return pods[j].CreationTimestamp.Before(&pods[i].CreationTimestamp)
+				})
 				iwres.Status = ImageWorkResultStatusFailed
+				iwres.PodName = pods[0].Name
 				if iwres.ImageWorkRequest.WorkType == ImageCachePurge {
-					glog.Infof("Job %s expired (delete: %s --> %s)", job, iwres.ImageWorkRequest.Image, iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"])
+					logging.Infof(imageWorkFields(iwres.ImageWorkRequest, job, iwres.Status), "Job %s expired (delete: %s --> %s)", job, iwres.ImageWorkRequest.Image, iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"])
 				} else {
-					glog.Infof("Job %s expired (pull: %s --> %s)", job, iwres.ImageWorkRequest.Image, iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"])
+					logging.Infof(imageWorkFields(iwres.ImageWorkRequest, job, iwres.Status), "Job %s expired (pull: %s --> %s)", job, iwres.ImageWorkRequest.Image, iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"])
 				}
 				if pods[0].Status.Phase == corev1.PodPending {
-					if len(pods[0].Status.ContainerStatuses) == 1 {
-						if pods[0].Status.ContainerStatuses[0].State.Waiting != nil {
-							iwres.Reason = pods[0].Status.ContainerStatuses[0].State.Waiting.Reason
-							iwres.Message = pods[0].Status.ContainerStatuses[0].State.Waiting.Message
-						}
-						if pods[0].Status.ContainerStatuses[0].State.Terminated != nil {
-							iwres.Reason = pods[0].Status.ContainerStatuses[0].State.Terminated.Reason
-							iwres.Message = pods[0].Status.ContainerStatuses[0].State.Terminated.Message
-						}
+					if reason, message := podFailureReasonMessage(pods[0]); reason != "" {
+						iwres.Reason, iwres.Message = reason, message
+					} else if notStarted, message := podNotStarted(pods[0]); notStarted {
+						iwres.Reason, iwres.Message = ImageWorkResultReasonNodeNotReady, message
 					} else {
 						iwres.Reason = "Pending"
 						iwres.Message = "Check if node is ready"
@@ -239,11 +655,11 @@ func (m *ImageManager) updatePendingImageWorkResults(imageCacheName string) erro
 					fieldSelector := fields.Set{
 						"involvedObject.kind":      "Pod",
 						"involvedObject.name":      pods[0].Name,
-						"involvedObject.namespace": m.fledgedNameSpace,
+						"involvedObject.namespace": pods[0].Namespace,
 						"reason":                   "Failed",
 					}.AsSelector().String()
 
-					eventlist, err := m.kubeclientset.CoreV1().Events(m.fledgedNameSpace).
+					eventlist, err := m.kubeclientset.CoreV1().Events(pods[0].Namespace).
 						List(metav1.ListOptions{FieldSelector: fieldSelector})
 					if err != nil {
 						glog.Errorf("Error listing events for pod (%s): %v", pods[0].Name, err)
@@ -254,6 +670,7 @@ func (m *ImageManager) updatePendingImageWorkResults(imageCacheName string) erro
 						iwres.Message = iwres.Message + ":" + v.Message
 					}
 				}
+				m.recordImageWorkResult(&iwres)
 				m.imageworkstatus[job] = iwres
 			}
 		}
@@ -262,24 +679,211 @@ func (m *ImageManager) updatePendingImageWorkResults(imageCacheName string) erro
 	return nil
 }
 
-func (m *ImageManager) updateImageCacheStatus(imageCacheName string, errCh chan<- error) {
-	wait.Poll(time.Second, m.imagePullDeadlineDuration,
+// retriedByJob returns true if the failed pod of the job is retried by the job controller i.e. the
+// no. of failed pods of the job is within the backoff limit of the job
+func (m *ImageManager) retriedByJob(namespace, job string) bool {
+	if m.jobBackoffLimit == 0 {
+		return false
+	}
+	pods, err := m.jobPodsLister.Pods(namespace).List(labels.Set(map[string]string{"job-name": job}).AsSelector())
+	if err != nil {
+		glog.Errorf("Error listing Pods: %v", err)
+		return false
+	}
+	failed := int32(0)
+	for _, pod := range pods {
+		if pod.Status.Phase == corev1.PodFailed {
+			failed++
+		}
+	}
+	return failed <= m.jobBackoffLimit
+}
+
+// pullPolicy returns the image pull policy of the work request
+func (m *ImageManager) pullPolicy(iwr ImageWorkRequest) string {
+	if iwr.ImagePullPolicy != "" {
+		return iwr.ImagePullPolicy
+	}
+	return m.imagePullPolicy
+}
+
+// pullDeadline returns the deadline within which the work request should complete.
+// The deadline of an image pull can be overridden in the image cache spec, or in its image lists
+func (m *ImageManager) pullDeadline(iwr ImageWorkRequest) time.Duration {
+	if iwr.WorkType != ImageCachePurge && iwr.PullDeadline != nil && iwr.PullDeadline.Duration > 0 {
+		return iwr.PullDeadline.Duration
+	}
+	return m.imagePullDeadlineDuration
+}
+
+// reconcileDone returns true if the reconcile of the image cache that requested the image work timed out
+func reconcileDone(iwr ImageWorkRequest) bool {
+	return iwr.Context != nil && iwr.Context.Err() != nil
+}
+
+// isJob returns true if the image work result is of a job i.e. not of image work done without
+// creating a job, or by the CRI agent of the node
+func isJob(name string) bool {
+	return !strings.HasPrefix(name, fakeJobPrefix) && !strings.HasPrefix(name, criAgentWorkPrefix)
+}
+
+// isPending returns true if the image work result is yet to reach a final status
+func isPending(iwres ImageWorkResult) bool {
+	return !IsTerminalImageWorkResultStatus(iwres.Status)
+}
+
+// imageCacheObjKey returns the namespace/name key of the image cache, as returned by cache.MetaNamespaceKeyFunc.
+// Image work results are matched to their image cache on the key, since image caches of different namespaces
+// may have the same name
+func imageCacheObjKey(imageCache *fledgedv1alpha1.ImageCache) string {
+	if imageCache.Namespace == "" {
+		return imageCache.Name
+	}
+	return imageCache.Namespace + "/" + imageCache.Name
+}
+
+// imageCacheDeadline returns the longest deadline among the pending work results of the image cache
+func (m *ImageManager) imageCacheDeadline(objKey string) time.Duration {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	deadline := m.imagePullDeadlineDuration
+	for _, iwres := range m.imageworkstatus {
+		if imageCacheObjKey(iwres.ImageWorkRequest.Imagecache) == objKey && isPending(iwres) {
+			if d := m.pullDeadline(iwres.ImageWorkRequest); d > deadline {
+				deadline = d
+			}
+		}
+	}
+	return deadline
+}
+
+// retryNodeNotReadyWork retries the image pulls of the image cache whose jobs did not start before
+// their deadline since their nodes were not ready, e.g. nodes just added by a cluster scale-up, instead
+// of letting them fail. Pulls are retried until the node readiness wait after their deadline expires,
+// and the retries are not counted against the max retries of failed pulls
+func (m *ImageManager) retryNodeNotReadyWork(objKey string, start time.Time) {
+	if m.nodeReadinessWait <= 0 {
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for job, iwres := range m.imageworkstatus {
+		iwr := iwres.ImageWorkRequest
+		if imageCacheObjKey(iwr.Imagecache) != objKey || iwr.WorkType == ImageCachePurge || iwres.Status != ImageWorkResultStatusJobCreated ||
+			!isJob(job) || reconcileDone(iwr) {
+			continue
+		}
+		deadline := m.pullDeadline(iwr)
+		if time.Since(iwres.JobCreationTime) < deadline || time.Since(start) >= deadline+m.nodeReadinessWait {
+			continue
+		}
+		pods, err := m.jobPodsLister.Pods(m.jobNamespace(iwr)).List(labels.Set(map[string]string{"job-name": job}).AsSelector())
+		if err != nil {
+			glog.Errorf("Error listing pods of job %s: %v", job, err)
+			continue
+		}
+		if len(pods) == 0 {
+			continue
+		}
+		sort.Slice(pods, func(i, j int) bool {
+			return pods[j].CreationTimestamp.Before(&pods[i].CreationTimestamp)
+		})
+		notStarted, message := podNotStarted(pods[0])
+		if !notStarted {
+			continue
+		}
+		iwres.Status = ImageWorkResultStatusRetrying
+		iwres.Reason, iwres.Message = ImageWorkResultReasonNodeNotReady, message
+		iwres.PodName = pods[0].Name
+		m.imageworkstatus[job] = iwres
+		m.waitingForNodes[iwr] = true
+		hostname := iwr.Node.Labels["kubernetes.io/hostname"]
+		logging.Infof(imageWorkFields(iwr, job, iwres.Status), "Job %s did not start since node was not ready, retrying (pull: %s --> %s): %s", job, iwr.Image, hostname, message)
+		m.imageworkqueue.Add(iwr)
+		if !iwr.WarmUp {
+			m.recorder.Eventf(iwr.Imagecache, corev1.EventTypeWarning, EventReasonImagePullRetrying,
+				"Image %s could not be pulled to node %s since the node was not ready, retrying: %s", iwr.Image, hostname, message)
+		}
+	}
+}
+
+// failUnscheduledWork fails the image work of the image cache whose job's pod was never scheduled, i.e. the latest
+// pod of the job is pending without a node, once the deadline of the work expires. Such a pod may stay pending
+// indefinitely, e.g. if no node has the capacity for it, irrespective of its container statuses, hence the job
+// and its pods are force deleted. expired is true if the deadline of all the work of the image cache expired.
+// Work whose node is not ready is retried by retryNodeNotReadyWork instead, within the node readiness wait
+func (m *ImageManager) failUnscheduledWork(objKey string, expired bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for job, iwres := range m.imageworkstatus {
+		iwr := iwres.ImageWorkRequest
+		if imageCacheObjKey(iwr.Imagecache) != objKey || iwres.Status != ImageWorkResultStatusJobCreated || !isJob(job) || reconcileDone(iwr) {
+			continue
+		}
+		if !expired && time.Since(iwres.JobCreationTime) < m.pullDeadline(iwr) {
+			continue
+		}
+		namespace := m.jobNamespace(iwr)
+		pods, err := m.jobPodsLister.Pods(namespace).List(labels.Set(map[string]string{"job-name": job}).AsSelector())
+		if err != nil {
+			glog.Errorf("Error listing pods of job %s: %v", job, err)
+			continue
+		}
+		sort.Slice(pods, func(i, j int) bool {
+			return pods[j].CreationTimestamp.Before(&pods[i].CreationTimestamp)
+		})
+		neverScheduled, message := podNeverScheduled(pods)
+		if !neverScheduled {
+			continue
+		}
+		iwres.Status = ImageWorkResultStatusFailed
+		iwres.Reason, iwres.Message = ImageWorkResultReasonPodNeverScheduled, message
+		iwres.PodName = pods[0].Name
+		logging.Infof(imageWorkFields(iwr, job, iwres.Status), "Job %s expired since its pod was never scheduled, force deleting it (%s --> %s): %s", job, iwr.Image, iwr.Node.Labels["kubernetes.io/hostname"], message)
+		if err := m.forceDeleteJob(namespace, job, pods); err != nil {
+			glog.Errorf("Error force deleting job %s: %v", job, err)
+		}
+		m.recordImageWorkResult(&iwres)
+		m.imageworkstatus[job] = iwres
+	}
+}
+
+// updateImageCacheStatus waits for the image work of the image cache to complete, and queues the
+// results for updating the status of the image cache. If the context is cancelled e.g. when the
+// controller is shutting down, the results are not queued and the jobs are left to complete
+func (m *ImageManager) updateImageCacheStatus(ctx context.Context, objKey string, errCh chan<- error) {
+	start := time.Now()
+	pollCtx, cancel := context.WithTimeout(ctx, m.imageCacheDeadline(objKey)+m.nodeReadinessWait)
+	defer cancel()
+	wait.PollUntil(time.Second,
 		func() (done bool, err error) {
+			m.retryNodeNotReadyWork(objKey, start)
+			m.failUnscheduledWork(objKey, false)
 			m.lock.RLock()
 			defer m.lock.RUnlock()
 			done, err = true, nil
 			for _, iwres := range m.imageworkstatus {
-				if iwres.ImageWorkRequest.Imagecache.Name == imageCacheName {
-					if iwres.Status == ImageWorkResultStatusJobCreated {
+				if imageCacheObjKey(iwres.ImageWorkRequest.Imagecache) == objKey {
+					deadline := m.pullDeadline(iwres.ImageWorkRequest)
+					if m.waitingForNodes[iwres.ImageWorkRequest] {
+						deadline += m.nodeReadinessWait
+					}
+					if isPending(iwres) && time.Since(start) < deadline && !reconcileDone(iwres.ImageWorkRequest) {
 						done, err = false, nil
 						return
 					}
 				}
 			}
 			return
-		})
+		}, pollCtx.Done())
+	if err := ctx.Err(); err != nil {
+		glog.Infof("Status update of image cache %s abandoned: %v", objKey, err)
+		errCh <- err
+		return
+	}
 	glog.V(4).Info("wait.Poll exited successfully")
-	err := m.updatePendingImageWorkResults(imageCacheName)
+	m.failUnscheduledWork(objKey, true)
+	err := m.updatePendingImageWorkResults(objKey)
 	if err != nil {
 		glog.Errorf("Error from updatePendingImageWorkResults(): %v", err)
 		errCh <- err
@@ -289,21 +893,26 @@ func (m *ImageManager) updateImageCacheStatus(imageCacheName string, errCh chan<
 	//m.lock.Lock()
 	iwstatus := map[string]ImageWorkResult{}
 	//m.lock.Unlock()
-	deletePropagation := metav1.DeletePropagationBackground
 	var iwstatusLock sync.RWMutex
 	var imageCache *fledgedv1alpha1.ImageCache
+	warmUp := false
 	m.lock.Lock()
 	for job, iwres := range m.imageworkstatus {
-		if iwres.ImageWorkRequest.Imagecache.Name == imageCacheName {
+		if imageCacheObjKey(iwres.ImageWorkRequest.Imagecache) == objKey {
+			warmUp = iwres.ImageWorkRequest.WarmUp
 			iwstatusLock.Lock()
 			iwstatus[job] = iwres
 			iwstatusLock.Unlock()
 			imageCache = iwres.ImageWorkRequest.Imagecache
 			delete(m.imageworkstatus, job)
-			// delete jobs
-			if !strings.HasPrefix(job, fakeJobPrefix) {
-				if err := m.kubeclientset.BatchV1().Jobs(m.fledgedNameSpace).
-					Delete(job, &metav1.DeleteOptions{PropagationPolicy: &deletePropagation}); err != nil {
+			delete(m.waitingForNodes, iwres.ImageWorkRequest)
+			// delete jobs. Jobs are owned by the image cache, so a job may already have been
+			// garbage collected if the image cache was deleted. A failed job that is kept is no
+			// longer tracked, so that it is not counted as outstanding by later reconciles
+			if isJob(job) && m.keepFailedJobs && iwres.Status == ImageWorkResultStatusFailed {
+				glog.Infof("Failed job %s kept (%s --> %s)", job, iwres.ImageWorkRequest.Image, iwres.ImageWorkRequest.Node.Labels["kubernetes.io/hostname"])
+			} else if isJob(job) {
+				if err := m.deleteJob(m.jobNamespace(iwres.ImageWorkRequest), job); err != nil {
 					glog.Errorf("Error deleting job %s: %v", job, err)
 					m.lock.Unlock()
 					errCh <- err
@@ -318,10 +927,17 @@ func (m *ImageManager) updateImageCacheStatus(imageCacheName string, errCh chan<
 		errCh <- fmt.Errorf("Unable to obtain reference to image cache")
 		return
 	}
-	objKey, err := cache.MetaNamespaceKeyFunc(imageCache)
-	if err != nil {
-		glog.Errorf("Error from cache.MetaNamespaceKeyFunc(imageCache): %v", err)
-		errCh <- err
+	// The synthetic image cache of a warm-up does not exist, so its results are only logged
+	if warmUp {
+		failed := 0
+		for _, iwres := range iwstatus {
+			if iwres.Status == ImageWorkResultStatusFailed {
+				failed++
+			}
+		}
+		glog.Infof("Warm-up of deployment %s/%s completed: %d image pulls, %d failed", imageCache.Namespace,
+			strings.TrimPrefix(imageCache.Name, WarmUpImageCachePrefix), len(iwstatus), failed)
+		errCh <- nil
 		return
 	}
 	m.workqueue.AddRateLimited(WorkQueueKey{
@@ -334,36 +950,59 @@ func (m *ImageManager) updateImageCacheStatus(imageCacheName string, errCh chan<
 	return
 }
 
-// Run starts the Image Manager go routine
+// Run starts the Image Manager go routine. Once stopCh is closed, the context of the workers is
+// cancelled, so that jobs are no longer created and in-flight image work is abandoned
 func (m *ImageManager) Run(stopCh <-chan struct{}) error {
 	defer runtime.HandleCrash()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stopCh
+		cancel()
+	}()
 	glog.Info("Starting image manager")
 	go m.kubeInformerFactory.Start(stopCh)
+	if m.jobsInImageCacheNamespace {
+		go m.jobKubeInformerFactory.Start(stopCh)
+	}
 	// Wait for the caches to be synced before starting workers
 	glog.Info("Waiting for informer caches to sync")
-	if ok := cache.WaitForCacheSync(stopCh, m.podsSynced); !ok {
+	if ok := cache.WaitForCacheSync(stopCh, m.podsSynced, m.jobPodsSynced); !ok {
 		return fmt.Errorf("failed to wait for caches to sync")
 	}
-	go wait.Until(m.runWorker, time.Second, stopCh)
+	go wait.Until(func() { m.runWorker(ctx) }, time.Second, stopCh)
 	glog.Info("Started image manager")
 	<-stopCh
 	glog.Info("Shutting down image manager")
 	return nil
 }
 
+// Stalled returns an error if the worker of the image manager made no progress within the threshold
+func (m *ImageManager) Stalled(threshold time.Duration) error {
+	return m.progress.Stalled(m.imageworkqueue.Len(), threshold)
+}
+
+// InformersSynced returns true once the pod informer caches of the image manager have synced
+func (m *ImageManager) InformersSynced() bool {
+	return m.podsSynced() && m.jobPodsSynced()
+}
+
 // runWorker is a long-running function that will continually call the
 // processNextWorkItem function in order to read and process a message on the
 // workqueue.
-func (m *ImageManager) runWorker() {
-	for m.processNextWorkItem() {
+func (m *ImageManager) runWorker(ctx context.Context) {
+	for m.processNextWorkItem(ctx) {
 	}
 }
 
 // processNextWorkItem will read a single work item off the workqueue and
-// attempt to process it, by calling the syncHandler.
-func (m *ImageManager) processNextWorkItem() bool {
+// attempt to process it, by calling the syncHandler. No jobs are created once the context is cancelled.
+func (m *ImageManager) processNextWorkItem(ctx context.Context) bool {
 	//glog.Info("processNextWorkItem::Beginning...")
+	m.progress.Waiting()
 	obj, shutdown := m.imageworkqueue.Get()
+	m.progress.Started()
+	defer m.progress.Done()
 
 	if shutdown {
 		return false
@@ -394,52 +1033,180 @@ func (m *ImageManager) processNextWorkItem() bool {
 			return nil
 		}
 
+		// The controller is shutting down, so the work is dropped. Image caches left under processing
+		// are marked as aborted when the controller starts again
+		if ctx.Err() != nil {
+			m.imageworkqueue.Forget(obj)
+			return nil
+		}
+
 		if iwr.Image == "" && iwr.Node == nil {
+			// Status of the image cache is updated only after deferred requests have been processed
+			if m.hasDeferredImageWork(imageCacheObjKey(iwr.Imagecache)) {
+				m.imageworkqueue.AddAfter(iwr, throttledRequeueDelay)
+				return nil
+			}
 			m.imageworkqueue.Forget(obj)
 			errCh := make(chan error)
-			go m.updateImageCacheStatus(iwr.Imagecache.Name, errCh)
+			go m.updateImageCacheStatus(ctx, imageCacheObjKey(iwr.Imagecache), errCh)
+			return nil
+		}
+		// Work of a reconcile that timed out is abandoned, without creating its job
+		if reconcileDone(iwr) {
+			m.abandonImageWork(iwr)
+			m.imageworkqueue.Forget(obj)
 			return nil
 		}
 		// Run the syncHandler, passing it the namespace/name string of the
 		// ImageCache resource to be synced.
 		var job *batchv1.Job
 		var err error
-		var pull, delete bool
+		var pull, delete, inUse bool
+		// adopted is the job found when the controller started, claimed by the image work
+		var adopted *batchv1.Job
+		// workName is the name of the job, or of the work of the CRI agent on agentHost
+		var workName, agentHost string
 		if iwr.WorkType == ImageCachePurge {
+			if m.disablePurge {
+				m.failImageWork(iwr, ImageWorkResultReasonPurgeDisabled, "Images are not deleted from nodes since purge is disabled in the controller (--disable-purge)")
+				m.imageworkqueue.Forget(obj)
+				return nil
+			}
+			if m.deferImageWork(iwr) {
+				glog.V(4).Infof("Job creation deferred (delete:- %s --> %s): max total jobs reached", iwr.Image, iwr.Node.Labels["kubernetes.io/hostname"])
+				m.imageworkqueue.AddAfter(iwr, throttledRequeueDelay)
+				return nil
+			}
 			delete = true
-			job, err = m.deleteImage(iwr)
-			if err != nil {
-				return fmt.Errorf("error deleting image '%s' from node '%s': %s", iwr.Image, iwr.Node.Labels["kubernetes.io/hostname"], err.Error())
+			if agentHost = m.criAgentHost(iwr); agentHost != "" {
+				workName = names.SimpleNameGenerator.GenerateName(criAgentWorkPrefix)
+				logging.Infof(imageWorkFields(iwr, workName, ImageWorkResultStatusJobCreated), "CRI agent work %s started (delete:- %s --> %s, runtime: %s)", workName, iwr.Image, iwr.Node.Labels["kubernetes.io/hostname"], iwr.ContainerRuntimeVersion)
+			} else if adopted = m.claimAdoptedJob(iwr); adopted != nil {
+				job, workName = adopted, adopted.Name
+				logging.Infof(imageWorkFields(iwr, job.Name, ImageWorkResultStatusJobCreated), "Job %s adopted (delete:- %s --> %s, runtime: %s)", job.Name, iwr.Image, iwr.Node.Labels["kubernetes.io/hostname"], iwr.ContainerRuntimeVersion)
+			} else {
+				job, err = m.deleteImage(ctx, iwr)
+				if err != nil {
+					return fmt.Errorf("error deleting image '%s' from node '%s': %s", iwr.Image, iwr.Node.Labels["kubernetes.io/hostname"], err.Error())
+				}
+				workName = job.Name
+				logging.Infof(imageWorkFields(iwr, job.Name, ImageWorkResultStatusJobCreated), "Job %s created (delete:- %s --> %s, runtime: %s)", job.Name, iwr.Image, iwr.Node.Labels["kubernetes.io/hostname"], iwr.ContainerRuntimeVersion)
 			}
-			glog.Infof("Job %s created (delete:- %s --> %s, runtime: %s)", job.Name, iwr.Image, iwr.Node.Labels["kubernetes.io/hostname"], iwr.ContainerRuntimeVersion)
 		} else {
 			pull = true
-			pull, err = checkIfImageNeedsToBePulled(m.imagePullPolicy, iwr.Image, iwr.Node)
+			pull, err = checkIfImageNeedsToBePulled(m.pullPolicy(iwr), iwr.Image, iwr.Node)
 			if err != nil {
 				glog.Errorf("Error from checkIfImageNeedsToBePulled(): %+v", err)
 				return fmt.Errorf("Error from checkIfImageNeedsToBePulled(): %+v", err)
 			}
-			if pull {
-				job, err = m.pullImage(iwr)
-				if err != nil {
-					return fmt.Errorf("error pulling image '%s' to node '%s': %s", iwr.Image, iwr.Node.Labels["kubernetes.io/hostname"], err.Error())
+			// An image in use by a pod is present in the node, as of the native platform of the node
+			if pull && iwr.InUseBy != "" && iwr.Platform == "" && iwr.ImageArchive == nil && m.pullPolicy(iwr) != string(corev1.PullAlways) {
+				pull, inUse = false, true
+			}
+			// With Never policy, the job only verifies that the image is present in the node
+			verifyOnly := m.pullPolicy(iwr) == string(corev1.PullNever)
+			// Presence of the image in the node is known only by name, not by platform
+			if iwr.Platform != "" && !verifyOnly {
+				pull = true
+			}
+			if pull && !verifyOnly && iwr.ImageArchive != nil && len(iwr.ImageArchive.Command) == 0 && !archiveLoadSupported(iwr.ContainerRuntimeVersion) {
+				m.failImageWork(iwr, "ImageArchiveNotSupported",
+					fmt.Sprintf("Loading image archives is not supported by container runtime %s, unless the load command is specified", iwr.ContainerRuntimeVersion))
+				m.imageworkqueue.Forget(obj)
+				return nil
+			}
+			if pull && !verifyOnly && iwr.ImageArchive == nil && iwr.Imagecache.Spec.PullJobContainer != nil && !pullJobContainerAllowed(iwr.Imagecache.Spec.PullJobContainer.Image, m.pullJobContainerImages) {
+				m.failImageWork(iwr, ImageWorkResultReasonPullJobContainerNotAllowed,
+					fmt.Sprintf("Pull job container image %s is not allowed by the controller (--pull-job-container-images)", iwr.Imagecache.Spec.PullJobContainer.Image))
+				m.imageworkqueue.Forget(obj)
+				return nil
+			}
+			if pull && !verifyOnly && iwr.ImageArchive == nil && iwr.Platform != "" && iwr.Imagecache.Spec.PullJobContainer == nil && !platformPullSupported(iwr.ContainerRuntimeVersion) {
+				m.failImageWork(iwr, "PlatformNotSupported",
+					fmt.Sprintf("Pulling platform %s is not supported by container runtime %s", iwr.Platform, iwr.ContainerRuntimeVersion))
+				m.imageworkqueue.Forget(obj)
+				return nil
+			}
+			if pull && !verifyOnly && iwr.ImageArchive == nil {
+				if host := RegistryHost(iwr.Image); host != "" {
+					if allowed, until := m.registryBreaker.allow(host); !allowed {
+						m.lock.Lock()
+						retriedJob, _ := m.removeRetryingImageWorkResult(iwr)
+						m.lock.Unlock()
+						if err := m.deleteRetriedJob(iwr, retriedJob); err != nil {
+							glog.Errorf("Error removing result of retried image work: %v", err)
+						}
+						m.failImageWork(iwr, ImageWorkResultReasonRegistryCircuitOpen,
+							fmt.Sprintf("Pulls from registry %s are suspended after %d consecutive failures, until %s", host, m.registryBreaker.threshold, until.Format(time.RFC3339)))
+						m.imageworkqueue.Forget(obj)
+						return nil
+					}
+				}
+			}
+			if pull && m.deferImageWork(iwr) {
+				glog.V(4).Infof("Job creation deferred (pull:- %s --> %s): max concurrent pulls, max pulls per node or max total jobs reached", iwr.Image, iwr.Node.Labels["kubernetes.io/hostname"])
+				m.imageworkqueue.AddAfter(iwr, throttledRequeueDelay)
+				return nil
+			}
+			if pull && !verifyOnly {
+				agentHost = m.criAgentHost(iwr)
+			}
+			if agentHost != "" {
+				workName = names.SimpleNameGenerator.GenerateName(criAgentWorkPrefix)
+				logging.Infof(imageWorkFields(iwr, workName, ImageWorkResultStatusJobCreated), "CRI agent work %s started (pull:- %s --> %s, runtime: %s)", workName, iwr.Image, iwr.Node.Labels["kubernetes.io/hostname"], iwr.ContainerRuntimeVersion)
+			} else if pull {
+				if adopted = m.claimAdoptedJob(iwr); adopted != nil {
+					job = adopted
+					logging.Infof(imageWorkFields(iwr, job.Name, ImageWorkResultStatusJobCreated), "Job %s adopted (pull:- %s --> %s, runtime: %s)", job.Name, iwr.Image, iwr.Node.Labels["kubernetes.io/hostname"], iwr.ContainerRuntimeVersion)
+				} else {
+					job, err = m.pullImage(ctx, iwr)
+					if err != nil {
+						return fmt.Errorf("error pulling image '%s' to node '%s': %s", iwr.Image, iwr.Node.Labels["kubernetes.io/hostname"], err.Error())
+					}
+					logging.Infof(imageWorkFields(iwr, job.Name, ImageWorkResultStatusJobCreated), "Job %s created (pull:- %s --> %s, runtime: %s)", job.Name, iwr.Image, iwr.Node.Labels["kubernetes.io/hostname"], iwr.ContainerRuntimeVersion)
 				}
-				glog.Infof("Job %s created (pull:- %s --> %s, runtime: %s)", job.Name, iwr.Image, iwr.Node.Labels["kubernetes.io/hostname"], iwr.ContainerRuntimeVersion)
+				workName = job.Name
+			} else if inUse {
+				logging.Infof(imageWorkFields(iwr, "", ImageWorkResultStatusAlreadyPulled), "Job not created (image-in-use:- %s --> %s, pod: %s)", iwr.Image, iwr.Node.Labels["kubernetes.io/hostname"], iwr.InUseBy)
 			} else {
-				glog.Infof("Job not created (image-already-present:- %s --> %s, runtime: %s)", iwr.Image, iwr.Node.Labels["kubernetes.io/hostname"], iwr.ContainerRuntimeVersion)
+				logging.Infof(imageWorkFields(iwr, "", ImageWorkResultStatusAlreadyPulled), "Job not created (image-already-present:- %s --> %s, runtime: %s)", iwr.Image, iwr.Node.Labels["kubernetes.io/hostname"], iwr.ContainerRuntimeVersion)
 			}
 		}
 		// Finally, if no error occurs we Forget this item so it does not
-		// get queued again until another change happens.
+		// get queued again until another change happens. A retried item is
+		// not forgotten, so that the no. of retries is tracked by the rate limiter
 		m.lock.Lock()
+		retriedJob, retry := m.removeRetryingImageWorkResult(iwr)
 		if pull || delete {
-			m.imageworkstatus[job.Name] = ImageWorkResult{ImageWorkRequest: iwr, Status: ImageWorkResultStatusJobCreated}
+			iwres := ImageWorkResult{ImageWorkRequest: iwr, Status: ImageWorkResultStatusJobCreated, JobCreationTime: time.Now()}
+			if agentHost == "" {
+				iwres.JobName = workName
+			}
+			m.imageworkstatus[workName] = iwres
 		} else {
 			// generate a random fake job name
-			m.imageworkstatus[names.SimpleNameGenerator.GenerateName(fakeJobPrefix)] = ImageWorkResult{ImageWorkRequest: iwr, Status: ImageWorkResultStatusAlreadyPulled}
+			iwres := ImageWorkResult{ImageWorkRequest: iwr, Status: ImageWorkResultStatusAlreadyPulled}
+			if inUse {
+				iwres.Reason = ImageWorkResultReasonImageInUse
+				iwres.Message = fmt.Sprintf("Image is in use by pod %s in the node", iwr.InUseBy)
+			}
+			m.imageworkstatus[names.SimpleNameGenerator.GenerateName(fakeJobPrefix)] = iwres
+			retry = false
 		}
 		m.lock.Unlock()
-		m.imageworkqueue.Forget(obj)
+		err = m.deleteRetriedJob(iwr, retriedJob)
+		if agentHost != "" {
+			go m.doCRIAgentWork(ctx, workName, agentHost, iwr)
+		}
+		if adopted != nil {
+			m.syncAdoptedJob(adopted)
+		}
+		if err != nil {
+			return err
+		}
+		if !retry {
+			m.imageworkqueue.Forget(obj)
+		}
 		return nil
 	}(obj)
 
@@ -451,16 +1218,294 @@ func (m *ImageManager) processNextWorkItem() bool {
 	return true
 }
 
+// failImageWork records the image work request as failed without creating a job for it
+func (m *ImageManager) failImageWork(iwr ImageWorkRequest, reason, message string) {
+	iwres := ImageWorkResult{ImageWorkRequest: iwr, Status: ImageWorkResultStatusFailed, Reason: reason, Message: message}
+	logging.Infof(imageWorkFields(iwr, "", iwres.Status), "Job not created (%s:- %s --> %s): %s", reason, iwr.Image, iwr.Node.Labels["kubernetes.io/hostname"], message)
+	m.lock.Lock()
+	m.imageworkstatus[names.SimpleNameGenerator.GenerateName(fakeJobPrefix)] = iwres
+	m.lock.Unlock()
+	m.recordImageWorkResult(&iwres)
+}
+
+// recordRegistryResult records the result of an image pull in the circuit breaker of the registry of the image.
+// Results of image deletes, and of pulls from image archives, are not recorded
+func (m *ImageManager) recordRegistryResult(iwres ImageWorkResult) {
+	iwr := iwres.ImageWorkRequest
+	if iwr.WorkType == ImageCachePurge || iwr.ImageArchive != nil {
+		return
+	}
+	host := RegistryHost(iwr.Image)
+	if host == "" {
+		return
+	}
+	switch iwres.Status {
+	case ImageWorkResultStatusSucceeded:
+		m.registryBreaker.succeeded(host)
+	case ImageWorkResultStatusFailed, ImageWorkResultStatusRetrying:
+		if iwres.Reason == ImageWorkResultReasonReconcileTimeout {
+			return
+		}
+		if m.registryBreaker.failed(host) {
+			glog.Warningf("Suspending pulls from registry %s for %s after %d consecutive failures", host, m.registryBreaker.cooldown, m.registryBreaker.threshold)
+		}
+	}
+}
+
+// abandonImageWork records the image work request of a reconcile that timed out as failed. The request
+// is no longer deferred, and the result of the failed job it retries, if any, is replaced
+func (m *ImageManager) abandonImageWork(iwr ImageWorkRequest) {
+	m.lock.Lock()
+	delete(m.deferredImageWork, iwr)
+	retriedJob, _ := m.removeRetryingImageWorkResult(iwr)
+	m.lock.Unlock()
+	if err := m.deleteRetriedJob(iwr, retriedJob); err != nil {
+		glog.Errorf("Error removing result of retried image work: %v", err)
+	}
+	m.failImageWork(iwr, ImageWorkResultReasonReconcileTimeout, "Image cache reconcile timed out before the job was created")
+}
+
+// deferImageWork returns true if creating the job for the image work request should be deferred
+// since the no. of outstanding pull jobs, of pull jobs to its node, or of all jobs, has reached the limit
+func (m *ImageManager) deferImageWork(iwr ImageWorkRequest) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.maxConcurrentPulls > 0 || m.maxPullsPerNode > 0 || m.maxTotalJobs > 0 {
+		pulls, nodePulls, jobs := 0, 0, 0
+		for _, iwres := range m.imageworkstatus {
+			if iwres.Status == ImageWorkResultStatusJobCreated {
+				jobs++
+				if iwres.ImageWorkRequest.WorkType != ImageCachePurge {
+					pulls++
+					if iwres.ImageWorkRequest.Node != nil && iwres.ImageWorkRequest.Node.Name == iwr.Node.Name {
+						nodePulls++
+					}
+				}
+			}
+		}
+		if iwr.WorkType != ImageCachePurge && ((m.maxConcurrentPulls > 0 && pulls >= m.maxConcurrentPulls) ||
+			(m.maxPullsPerNode > 0 && nodePulls >= m.maxPullsPerNode)) ||
+			(m.maxTotalJobs > 0 && jobs >= m.maxTotalJobs) {
+			m.deferredImageWork[iwr] = true
+			return true
+		}
+	}
+	delete(m.deferredImageWork, iwr)
+	return false
+}
+
+// hasDeferredImageWork returns true if any image work request of the image cache is deferred
+func (m *ImageManager) hasDeferredImageWork(objKey string) bool {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	for iwr := range m.deferredImageWork {
+		if imageCacheObjKey(iwr.Imagecache) == objKey {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteJob deletes the completed job along with its pods. With a job retention, the deletion is scheduled
+// after the retention instead, so that the logs of the pods can be inspected in the meantime. Jobs not
+// deleted due to a restart of the controller are deleted by its pre-flight checks
+func (m *ImageManager) deleteJob(namespace, job string) error {
+	deletePropagation := metav1.DeletePropagationBackground
+	deleteJob := func() error {
+		err := m.kubeclientset.BatchV1().Jobs(namespace).Delete(job, &metav1.DeleteOptions{PropagationPolicy: &deletePropagation})
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if m.jobRetention <= 0 {
+		return deleteJob()
+	}
+	glog.V(4).Infof("Job %s to be deleted after %s", job, m.jobRetention)
+	time.AfterFunc(m.jobRetention, func() {
+		if err := deleteJob(); err != nil {
+			glog.Errorf("Error deleting retained job %s: %v", job, err)
+		}
+	})
+	return nil
+}
+
+// forceDeleteJob deletes the job and its pods right away, without waiting for the pods to terminate
+// gracefully nor retaining the job. Job and pods already deleted are ignored
+func (m *ImageManager) forceDeleteJob(namespace, job string, pods []*corev1.Pod) error {
+	gracePeriod := int64(0)
+	deletePropagation := metav1.DeletePropagationBackground
+	err := m.kubeclientset.BatchV1().Jobs(namespace).Delete(job, &metav1.DeleteOptions{GracePeriodSeconds: &gracePeriod, PropagationPolicy: &deletePropagation})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	for _, pod := range pods {
+		err := m.kubeclientset.CoreV1().Pods(pod.Namespace).Delete(pod.Name, &metav1.DeleteOptions{GracePeriodSeconds: &gracePeriod})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// createJob creates the job of the image work request. Jobs are named after the image cache, image, node and
+// attempt of the work, so that work requested again by a concurrent reconcile reuses the job still running
+// instead of creating a duplicate job. A finished job of the same name, e.g. a retained job of an earlier
+// processing of the image cache, is not reused: the job is created with a generated name instead
+func (m *ImageManager) createJob(newjob *batchv1.Job, iwr ImageWorkRequest) (*batchv1.Job, error) {
+	jobs := m.kubeclientset.BatchV1().Jobs(m.jobNamespace(iwr))
+	newjob.Name = jobName(iwr, m.imageworkqueue.NumRequeues(iwr))
+	if newjob.Annotations == nil {
+		newjob.Annotations = map[string]string{}
+	}
+	newjob.Annotations[imageWorkAnnotationKey] = imageWorkKey(iwr)
+	job, err := jobs.Create(newjob)
+	if !apierrors.IsAlreadyExists(err) {
+		return job, err
+	}
+	if job, err = jobs.Get(newjob.Name, metav1.GetOptions{}); err != nil {
+		return nil, err
+	}
+	if !jobFinished(job) {
+		glog.Infof("Job %s already exists, so reusing it (%s --> %s)", job.Name, iwr.Image, iwr.Node.Labels["kubernetes.io/hostname"])
+		return job, nil
+	}
+	glog.V(4).Infof("Job %s already exists and is finished, so creating a job with a generated name", newjob.Name)
+	newjob.Name = ""
+	return jobs.Create(newjob)
+}
+
+// AdoptJob adopts a job found when the controller starts, to be claimed by the same image work instead
+// of creating a job for it. Returns false if the job is not of image work i.e. it was not created by a
+// controller annotating its jobs with their image work
+func (m *ImageManager) AdoptJob(job *batchv1.Job) bool {
+	key, ok := job.Annotations[imageWorkAnnotationKey]
+	if !ok {
+		return false
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.adoptedJobs[key] = job.DeepCopy()
+	return true
+}
+
+// claimAdoptedJob returns the adopted job of the image work of the request, if any, which is no longer
+// adopted. Adopted jobs not claimed are left to be deleted by kubernetes once their TTL expires
+func (m *ImageManager) claimAdoptedJob(iwr ImageWorkRequest) *batchv1.Job {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	key := imageWorkKey(iwr)
+	job, ok := m.adoptedJobs[key]
+	if !ok {
+		return nil
+	}
+	delete(m.adoptedJobs, key)
+	return job
+}
+
+// syncAdoptedJob updates the result of the claimed adopted job as per the status of its pods, since the
+// pods of a job that completed while the controller was down do not change status any more
+func (m *ImageManager) syncAdoptedJob(job *batchv1.Job) {
+	pods, err := m.jobPodsLister.Pods(job.Namespace).List(labels.Set(map[string]string{"job-name": job.Name}).AsSelector())
+	if err != nil {
+		glog.Errorf("Error listing pods of adopted job %s: %v", job.Name, err)
+		return
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[i].CreationTimestamp.Before(&pods[j].CreationTimestamp)
+	})
+	for _, pod := range pods {
+		m.handlePodStatusChange(pod)
+	}
+}
+
+// removeRetryingImageWorkResult removes the result of the failed job being retried by
+// the image work request. It returns the name of the failed job, which the caller deletes
+// with deleteRetriedJob after releasing the lock. Caller must hold the lock.
+func (m *ImageManager) removeRetryingImageWorkResult(iwr ImageWorkRequest) (string, bool) {
+	for job, iwres := range m.imageworkstatus {
+		if iwres.Status == ImageWorkResultStatusRetrying && iwres.ImageWorkRequest == iwr {
+			delete(m.imageworkstatus, job)
+			if !isJob(job) {
+				return "", true
+			}
+			return job, true
+		}
+	}
+	return "", false
+}
+
+// deleteRetriedJob deletes the failed job retried by the image work request, if any
+func (m *ImageManager) deleteRetriedJob(iwr ImageWorkRequest, job string) error {
+	if job == "" {
+		return nil
+	}
+	if err := m.deleteJob(m.jobNamespace(iwr), job); err != nil {
+		glog.Errorf("Error deleting job %s: %v", job, err)
+		return err
+	}
+	return nil
+}
+
 // pullImage pulls the image to the node
-func (m *ImageManager) pullImage(iwr ImageWorkRequest) (*batchv1.Job, error) {
+func (m *ImageManager) pullImage(ctx context.Context, iwr ImageWorkRequest) (*batchv1.Job, error) {
 	// Construct the Job manifest
-	newjob, err := newImagePullJob(iwr.Imagecache, iwr.Image, iwr.Node, m.imagePullPolicy)
+	newjob, err := newImagePullJob(iwr, m.pullPolicy(iwr))
 	if err != nil {
 		glog.Errorf("Error when constructing job manifest: %v", err)
 		return nil, err
 	}
+	insecure, err := isInsecureRegistry(iwr.Image, m.insecureRegistries)
+	if err != nil {
+		glog.Errorf("Error parsing image %s: %v", iwr.Image, err)
+		return nil, err
+	}
+	// An overridden pull job container is responsible for pulling from insecure registries, with
+	// client certificates and for pulling the platform of the request. Images of image archives are not pulled at all,
+	// and neither are images with Never policy whose job only verifies presence in the node
+	if m.pullPolicy(iwr) == string(corev1.PullNever) {
+		glog.V(4).Infof("Job only verifies presence of image %s in node %s", iwr.Image, iwr.Node.Labels["kubernetes.io/hostname"])
+	} else if iwr.ImageArchive != nil {
+		useImageArchiveLoad(newjob, iwr, m.dockerClientImage)
+	} else if iwr.Imagecache.Spec.PullJobContainer == nil {
+		sources := []pullSource{{image: iwr.Image, plainHTTP: pullsPlainHTTP(iwr, iwr.Image, insecure)}}
+		if pullsFromMirrors(iwr) {
+			for _, mirror := range *iwr.Mirrors {
+				image, err := mirrorImage(iwr.Image, mirror)
+				if err == nil {
+					insecure, err = isInsecureRegistry(image, m.insecureRegistries)
+				}
+				if err != nil {
+					glog.Errorf("Error parsing image %s in mirror %s: %v", iwr.Image, mirror, err)
+					return nil, err
+				}
+				sources = append(sources, pullSource{image: image, plainHTTP: pullsPlainHTTP(iwr, image, insecure)})
+			}
+		} else if iwr.Mirrors != nil && len(*iwr.Mirrors) > 0 {
+			glog.Warningf("Mirrors of image %s are not supported by the container runtime of node %s (%s), pulling from its registry only",
+				iwr.Image, iwr.Node.Labels["kubernetes.io/hostname"], iwr.ContainerRuntimeVersion)
+		}
+		if sources[0].plainHTTP || iwr.Platform != "" || len(sources) > 1 || pullsClientTLS(iwr) || pullsCABundle(iwr) || pullsSnapshotter(iwr) {
+			useCRIClientPull(newjob, iwr, m.dockerClientImage, sources)
+		}
+	}
+	if iwr.Imagecache.Spec.PullJobContainer != nil && iwr.ImageArchive == nil && m.pullJobContainerRuntimeSocket && m.pullPolicy(iwr) != string(corev1.PullNever) {
+		mountRuntimeSocket(newjob, iwr)
+	}
+	if iwr.Imagecache.Spec.CredentialsSecret != nil && m.pullPolicy(iwr) != string(corev1.PullNever) {
+		mountCredentialsSecret(newjob, iwr)
+	}
+	setDefaultPullSecret(newjob, iwr, m.defaultPullSecret)
+	setJobLimits(newjob, m.pullDeadline(iwr), m.jobBackoffLimit, m.jobTTLAfterFinished)
+	setJobRunPolicy(newjob, m.jobRestartPolicy, m.jobCompletions, m.jobParallelism)
+	setJobSecurityContext(newjob, iwr)
+	setJobDeviceResources(newjob, iwr)
+	propagateMetadata(newjob, iwr.Imagecache, m.propagatedLabels, m.propagatedAnnotations)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	// Create a Job to pull the image into the node
-	job, err := m.kubeclientset.BatchV1().Jobs(m.fledgedNameSpace).Create(newjob)
+	job, err := m.createJob(newjob, iwr)
 	if err != nil {
 		glog.Errorf("Error creating job in node %s: %v", iwr.Node, err)
 		return nil, err
@@ -468,16 +1513,83 @@ func (m *ImageManager) pullImage(iwr ImageWorkRequest) (*batchv1.Job, error) {
 	return job, nil
 }
 
+// pullsPlainHTTP returns true if the image is pulled over plain HTTP i.e. it is from an insecure
+// registry and the node has containerd runtime. Other runtimes should be configured to pull it
+func pullsPlainHTTP(iwr ImageWorkRequest, image string, insecure bool) bool {
+	if !insecure {
+		return false
+	}
+	if strings.Contains(iwr.ContainerRuntimeVersion, "containerd") {
+		return true
+	}
+	glog.Warningf("Image %s is from an insecure registry: the container runtime of node %s should be configured to pull it",
+		image, iwr.Node.Labels["kubernetes.io/hostname"])
+	return false
+}
+
+// pullsClientTLS returns true if the image is pulled by the cri client with the client certificate of
+// the client TLS secret of the image cache. Only ctr supports client certificates, the container runtime
+// of other nodes should be configured with the client certificate of the registry
+func pullsClientTLS(iwr ImageWorkRequest) bool {
+	if iwr.Imagecache.Spec.ClientTLSSecret == "" {
+		return false
+	}
+	if strings.Contains(iwr.ContainerRuntimeVersion, "containerd") {
+		return true
+	}
+	glog.Warningf("Image %s is pulled with a client certificate: the container runtime of node %s should be configured to pull it",
+		iwr.Image, iwr.Node.Labels["kubernetes.io/hostname"])
+	return false
+}
+
+// pullsCABundle returns true if the image is pulled by the cri client trusting the CAs of the CA bundle
+// of the image cache. The container runtime of nodes other than containerd should be configured to trust the CAs
+func pullsCABundle(iwr ImageWorkRequest) bool {
+	if iwr.Imagecache.Spec.CABundle == nil {
+		return false
+	}
+	if strings.Contains(iwr.ContainerRuntimeVersion, "containerd") {
+		return true
+	}
+	glog.Warningf("Image %s is pulled with a CA bundle: the container runtime of node %s should be configured to trust its CAs",
+		iwr.Image, iwr.Node.Labels["kubernetes.io/hostname"])
+	return false
+}
+
+// pullsSnapshotter returns true if the image is pulled by the cri client into the snapshotter of the image
+// cache. The snapshotter is specific to containerd, and is ignored for nodes with other runtimes
+func pullsSnapshotter(iwr ImageWorkRequest) bool {
+	if iwr.Imagecache.Spec.Snapshotter == "" {
+		return false
+	}
+	if strings.Contains(iwr.ContainerRuntimeVersion, "containerd") {
+		return true
+	}
+	glog.Warningf("Snapshotter %s of image %s is ignored: the container runtime of node %s is not containerd",
+		iwr.Imagecache.Spec.Snapshotter, iwr.Image, iwr.Node.Labels["kubernetes.io/hostname"])
+	return false
+}
+
 // deleteImage deletes the image from the node
-func (m *ImageManager) deleteImage(iwr ImageWorkRequest) (*batchv1.Job, error) {
+func (m *ImageManager) deleteImage(ctx context.Context, iwr ImageWorkRequest) (*batchv1.Job, error) {
+	if m.disablePurge {
+		return nil, errPurgeDisabled
+	}
 	// Construct the Job manifest
-	newjob, err := newImageDeleteJob(iwr.Imagecache, iwr.Image, iwr.Node, iwr.ContainerRuntimeVersion, m.dockerClientImage)
+	newjob, err := newImageDeleteJob(iwr, m.dockerClientImage)
 	if err != nil {
 		glog.Errorf("Error when constructing job manifest: %v", err)
 		return nil, err
 	}
+	setJobLimits(newjob, m.pullDeadline(iwr), m.jobBackoffLimit, m.jobTTLAfterFinished)
+	setJobRunPolicy(newjob, m.jobRestartPolicy, m.jobCompletions, m.jobParallelism)
+	setJobSecurityContext(newjob, iwr)
+	propagateMetadata(newjob, iwr.Imagecache, m.propagatedLabels, m.propagatedAnnotations)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	// Create a Job to delete the image from the node
-	job, err := m.kubeclientset.BatchV1().Jobs(m.fledgedNameSpace).Create(newjob)
+	job, err := m.createJob(newjob, iwr)
 	if err != nil {
 		glog.Errorf("Error creating job in node %s: %v", iwr.Node, err)
 		return nil, err
@@ -17,22 +17,35 @@ limitations under the License.
 package images
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	fledgedv1alpha1 "github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha1"
+	"github.com/senthilrch/kube-fledged/pkg/criagent"
+	"github.com/senthilrch/kube-fledged/pkg/metrics"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	coreinformers "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
 	fakeclientset "k8s.io/client-go/kubernetes/fake"
 	core "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
 )
 
@@ -51,9 +64,17 @@ func newTestImageManager(kubeclientset kubernetes.Interface, imagepullpolicy str
 	imagecacheworkqueue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ImageCaches")
 	imageworkqueue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ImagePullerStatus")
 
-	imagemanager, podInformer := NewImageManager(imagecacheworkqueue, imageworkqueue, kubeclientset, fledgedNameSpace,
-		imagePullDeadlineDuration, dockerClientImage, imagePullPolicy)
+	imagemanager, podInformer := NewImageManager(imagecacheworkqueue, imageworkqueue, kubeclientset, record.NewFakeRecorder(100), ImageManagerOptions{
+		Namespace:                 fledgedNameSpace,
+		ImagePullDeadlineDuration: imagePullDeadlineDuration,
+		DockerClientImage:         dockerClientImage,
+		ImagePullPolicy:           imagePullPolicy,
+		JobCompletions:            1,
+		JobParallelism:            1,
+		JobRestartPolicy:          "Never",
+	})
 	imagemanager.podsSynced = func() bool { return true }
+	imagemanager.jobPodsSynced = func() bool { return true }
 
 	return imagemanager, podInformer
 }
@@ -207,10 +228,10 @@ func TestPullDeleteImage(t *testing.T) {
 		imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent")
 		var err error
 		if test.action == "pullimage" {
-			_, err = imagemanager.pullImage(test.iwr)
+			_, err = imagemanager.pullImage(context.Background(), test.iwr)
 		}
 		if test.action == "deleteimage" {
-			_, err = imagemanager.deleteImage(test.iwr)
+			_, err = imagemanager.deleteImage(context.Background(), test.iwr)
 		}
 		if test.expectError {
 			if err == nil {
@@ -225,696 +246,4987 @@ func TestPullDeleteImage(t *testing.T) {
 	}
 }
 
-func TestHandlePodStatusChange(t *testing.T) {
+func TestNewImagePullJobImagePullSecrets(t *testing.T) {
+	imagecache := fledgedv1alpha1.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+		Spec: fledgedv1alpha1.ImageCacheSpec{
+			CacheSpec: []fledgedv1alpha1.CacheSpecImages{
+				{
+					Images: []string{"foo"},
+				},
+			},
+			ImagePullSecrets: []corev1.LocalObjectReference{{Name: "foo"}},
+		},
+	}
 	tests := []struct {
-		name     string
-		worktype WorkType
-		pod      corev1.Pod
+		name            string
+		secrets         *[]corev1.LocalObjectReference
+		expectedSecrets []corev1.LocalObjectReference
 	}{
 		{
-			name:     "#1: Create - Pod succeeded",
-			worktype: ImageCacheCreate,
-			pod: corev1.Pod{
-				ObjectMeta: metav1.ObjectMeta{
-					Labels: map[string]string{"job-name": "fakejob"},
-				},
-				Status: corev1.PodStatus{
-					Phase: corev1.PodSucceeded,
-				},
-			},
+			name:            "#1 No image list secrets",
+			secrets:         nil,
+			expectedSecrets: []corev1.LocalObjectReference{{Name: "foo"}},
 		},
 		{
-			name:     "#2: Purge - Pod succeeded",
-			worktype: ImageCachePurge,
-			pod: corev1.Pod{
-				ObjectMeta: metav1.ObjectMeta{
-					Labels: map[string]string{"job-name": "fakejob"},
-				},
-				Status: corev1.PodStatus{
-					Phase: corev1.PodSucceeded,
-				},
-			},
+			name:            "#2 Image list secrets are added",
+			secrets:         &[]corev1.LocalObjectReference{{Name: "bar"}},
+			expectedSecrets: []corev1.LocalObjectReference{{Name: "foo"}, {Name: "bar"}},
 		},
 		{
-			name:     "#3: Create - Pod failed",
-			worktype: ImageCacheCreate,
-			pod: corev1.Pod{
-				ObjectMeta: metav1.ObjectMeta{
-					Labels: map[string]string{"job-name": "fakejob"},
-				},
-				Status: corev1.PodStatus{
-					Phase: corev1.PodFailed,
-					ContainerStatuses: []corev1.ContainerStatus{
-						{
-							State: corev1.ContainerState{
-								Terminated: &corev1.ContainerStateTerminated{
-									Reason:  "fakereason",
-									Message: "fakemessage",
-								},
-							},
-						},
-					},
-				},
-			},
+			name:            "#3 Duplicate secrets are dropped",
+			secrets:         &[]corev1.LocalObjectReference{{Name: "bar"}, {Name: "foo"}},
+			expectedSecrets: []corev1.LocalObjectReference{{Name: "foo"}, {Name: "bar"}},
+		},
+	}
+	for _, test := range tests {
+		iwr := ImageWorkRequest{
+			Image:            "foo",
+			Node:             &node,
+			WorkType:         ImageCacheCreate,
+			Imagecache:       &imagecache,
+			ImagePullSecrets: test.secrets,
+		}
+		job, err := newImagePullJob(iwr, "IfNotPresent")
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		if !reflect.DeepEqual(job.Spec.Template.Spec.ImagePullSecrets, test.expectedSecrets) {
+			t.Errorf("Test: %s failed: expectedSecrets=%+v, actualSecrets=%+v", test.name, test.expectedSecrets, job.Spec.Template.Spec.ImagePullSecrets)
+		}
+	}
+}
+
+func TestNewImageDeleteJobContainerdNamespace(t *testing.T) {
+	imagecache := &fledgedv1alpha1.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
 		},
+	}
+	tests := []struct {
+		name                    string
+		containerRuntimeVersion string
+		containerdNamespace     string
+		expectedCommand         string
+	}{
 		{
-			name:     "#4: Purge - Pod failed",
-			worktype: ImageCachePurge,
-			pod: corev1.Pod{
-				ObjectMeta: metav1.ObjectMeta{
-					Labels: map[string]string{"job-name": "fakejob"},
-				},
-				Status: corev1.PodStatus{
-					Phase: corev1.PodFailed,
-					ContainerStatuses: []corev1.ContainerStatus{
-						{
-							State: corev1.ContainerState{
-								Terminated: &corev1.ContainerStateTerminated{
-									Reason:  "fakereason",
-									Message: "fakemessage",
-								},
-							},
-						},
-					},
-				},
-			},
+			name:                    "#1 Default containerd namespace",
+			containerRuntimeVersion: "containerd://1.3.3",
+			containerdNamespace:     "k8s.io",
+			expectedCommand:         "exec /usr/bin/crictl --runtime-endpoint=unix:///run/containerd/containerd.sock  --image-endpoint=unix:///run/containerd/containerd.sock rmi nginx > /dev/termination-log 2>&1",
+		},
+		{
+			name:                    "#2 Containerd namespace not specified",
+			containerRuntimeVersion: "containerd://1.3.3",
+			containerdNamespace:     "",
+			expectedCommand:         "exec /usr/bin/crictl --runtime-endpoint=unix:///run/containerd/containerd.sock  --image-endpoint=unix:///run/containerd/containerd.sock rmi nginx > /dev/termination-log 2>&1",
+		},
+		{
+			name:                    "#3 Custom containerd namespace",
+			containerRuntimeVersion: "containerd://1.3.3",
+			containerdNamespace:     "custom",
+			expectedCommand:         "exec /usr/bin/ctr --address /run/containerd/containerd.sock --namespace custom images rm docker.io/library/nginx:latest > /dev/termination-log 2>&1",
+		},
+		{
+			name:                    "#4 Containerd namespace not applicable to docker",
+			containerRuntimeVersion: "docker://19.3.8",
+			containerdNamespace:     "custom",
+			expectedCommand:         "exec /usr/bin/docker image rm -f nginx > /dev/termination-log 2>&1",
 		},
 	}
 	for _, test := range tests {
-		fakekubeclientset := &fakeclientset.Clientset{}
-		imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent")
-		imagemanager.imageworkstatus[test.pod.Labels["job-name"]] = ImageWorkResult{
-			Status: ImageWorkResultStatusJobCreated,
-			ImageWorkRequest: ImageWorkRequest{
-				WorkType: test.worktype,
-				Node:     &node,
-			},
+		iwr := ImageWorkRequest{
+			Image:                   "nginx",
+			Node:                    &node,
+			ContainerRuntimeVersion: test.containerRuntimeVersion,
+			WorkType:                ImageCachePurge,
+			Imagecache:              imagecache,
+			ContainerdNamespace:     test.containerdNamespace,
 		}
-		imagemanager.handlePodStatusChange(&test.pod)
+		job, err := newImageDeleteJob(iwr, "senthilrch/fledged-docker-client:latest")
+		if err != nil {
+			t.Errorf("Test: %s failed: %v", test.name, err)
+			continue
+		}
+		if command := job.Spec.Template.Spec.Containers[0].Args[1]; command != test.expectedCommand {
+			t.Errorf("Test: %s failed: expected command %q, actual %q", test.name, test.expectedCommand, command)
+		}
+	}
+}
 
-		if test.pod.Status.Phase == corev1.PodSucceeded {
-			if !(imagemanager.imageworkstatus[test.pod.Labels["job-name"]].Status == ImageWorkResultStatusSucceeded) {
-				t.Errorf("Test: %s failed: expectedWorkResult=%s, actualWorkResult=%s", test.name, ImageWorkResultStatusSucceeded, imagemanager.imageworkstatus[test.pod.Labels["job-name"]].Status)
-			}
+func TestNewImagePullJobOverridePullJobContainer(t *testing.T) {
+	imagecache := &fledgedv1alpha1.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+		Spec: fledgedv1alpha1.ImageCacheSpec{
+			PullJobContainer: &fledgedv1alpha1.PullJobContainer{
+				Image:   "mirror-puller:v1",
+				Command: []string{"/bin/pull"},
+				Args:    []string{"--mirror=registry.local", "$(IMAGE)"},
+			},
+		},
+	}
+	tests := []struct {
+		name                    string
+		imagecache              *fledgedv1alpha1.ImageCache
+		containerRuntimeVersion string
+		expectedImage           string
+		expectedSocketPath      string
+	}{
+		{
+			name:          "#1 Pull job container not overridden",
+			imagecache:    &fledgedv1alpha1.ImageCache{ObjectMeta: imagecache.ObjectMeta},
+			expectedImage: "nginx",
+		},
+		{
+			name:                    "#2 Pull job container overridden on docker node",
+			imagecache:              imagecache,
+			containerRuntimeVersion: "docker://19.3.8",
+			expectedImage:           "mirror-puller:v1",
+			expectedSocketPath:      "/var/run/docker.sock",
+		},
+		{
+			name:                    "#3 Pull job container overridden on containerd node",
+			imagecache:              imagecache,
+			containerRuntimeVersion: "containerd://1.3.3",
+			expectedImage:           "mirror-puller:v1",
+			expectedSocketPath:      "/run/containerd/containerd.sock",
+		},
+	}
+	for _, test := range tests {
+		iwr := ImageWorkRequest{
+			Image:                   "nginx",
+			Node:                    &node,
+			ContainerRuntimeVersion: test.containerRuntimeVersion,
+			WorkType:                ImageCacheCreate,
+			Imagecache:              test.imagecache,
 		}
-		if test.pod.Status.Phase == corev1.PodFailed {
-			if !(imagemanager.imageworkstatus[test.pod.Labels["job-name"]].Status == ImageWorkResultStatusFailed) {
-				t.Errorf("Test: %s failed: expectedWorkResult=%s, actualWorkResult=%s", test.name, ImageWorkResultStatusFailed, imagemanager.imageworkstatus[test.pod.Labels["job-name"]].Status)
-			}
+		job, err := newImagePullJob(iwr, "IfNotPresent")
+		if err != nil {
+			t.Errorf("Test: %s failed: %v", test.name, err)
+			continue
+		}
+		podSpec := job.Spec.Template.Spec
+		container := podSpec.Containers[0]
+		if container.Image != test.expectedImage {
+			t.Errorf("Test: %s failed: expected image %s, actual %s", test.name, test.expectedImage, container.Image)
+		}
+		if test.expectedSocketPath == "" {
+			continue
+		}
+		if len(podSpec.InitContainers) != 0 {
+			t.Errorf("Test: %s failed: expected no init containers, actual %d", test.name, len(podSpec.InitContainers))
+		}
+		if !reflect.DeepEqual(container.Command, imagecache.Spec.PullJobContainer.Command) || !reflect.DeepEqual(container.Args, imagecache.Spec.PullJobContainer.Args) {
+			t.Errorf("Test: %s failed: expected command %v %v, actual %v %v", test.name, imagecache.Spec.PullJobContainer.Command,
+				imagecache.Spec.PullJobContainer.Args, container.Command, container.Args)
+		}
+		if len(container.Env) != 1 || container.Env[0].Name != "IMAGE" || container.Env[0].Value != "nginx" {
+			t.Errorf("Test: %s failed: expected IMAGE env variable, actual %+v", test.name, container.Env)
+		}
+		// The runtime socket is mounted only if enabled in the controller
+		if len(container.VolumeMounts) != 0 || len(podSpec.Volumes) != 0 {
+			t.Errorf("Test: %s failed: expected no volumes, actual %+v", test.name, podSpec.Volumes)
+		}
+		mountRuntimeSocket(job, iwr)
+		podSpec = job.Spec.Template.Spec
+		container = podSpec.Containers[0]
+		if container.VolumeMounts[0].MountPath != test.expectedSocketPath || podSpec.Volumes[0].HostPath.Path != test.expectedSocketPath {
+			t.Errorf("Test: %s failed: expected socket %s, actual %s", test.name, test.expectedSocketPath, podSpec.Volumes[0].HostPath.Path)
 		}
 	}
 }
 
-func TestUpdateImageCacheStatus(t *testing.T) {
-	imageCacheName := "fakeimagecache"
+func TestPullJobContainerAllowed(t *testing.T) {
+	allowed := []string{"mirror-puller", "registry.local:5000/tools/puller:v1", "invalid image"}
 	tests := []struct {
-		name                string
-		imageworkstatus     map[string]ImageWorkResult
-		pods                []corev1.Pod
-		eventListErr        bool
-		jobDeleteErr        bool
-		expectError         bool
-		expectedErrorString string
+		image    string
+		expected bool
+	}{
+		{image: "mirror-puller:v1", expected: true},
+		{image: "docker.io/library/mirror-puller@sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", expected: true},
+		{image: "registry.local:5000/tools/puller:v1", expected: true},
+		{image: "registry.local:5000/tools/puller:v2", expected: false},
+		{image: "other/mirror-puller:v1", expected: false},
+		{image: "Invalid", expected: false},
+	}
+	for k, test := range tests {
+		if actual := pullJobContainerAllowed(test.image, allowed); actual != test.expected {
+			t.Errorf("Test: #%d failed: expected %t, actual %t", k+1, test.expected, actual)
+		}
+	}
+	if pullJobContainerAllowed("mirror-puller:v1", nil) {
+		t.Errorf("Test failed: pull job container allowed with no allowed images")
+	}
+}
+
+func TestIsInsecureRegistry(t *testing.T) {
+	insecureRegistries := []string{"registry.local:5000", "docker.io"}
+	tests := []struct {
+		name           string
+		image          string
+		expectInsecure bool
+		expectErr      bool
 	}{
 		{
-			name: "#1: Successful",
-			imageworkstatus: map[string]ImageWorkResult{
-				"fakejob": {
-					ImageWorkRequest: ImageWorkRequest{
-						Imagecache: &fledgedv1alpha1.ImageCache{
-							ObjectMeta: metav1.ObjectMeta{
-								Name: imageCacheName,
-							},
-						},
-						Node: &node,
-					},
-					Status: ImageWorkResultStatusSucceeded,
-				},
-			},
-			pods:        []corev1.Pod{},
-			expectError: false,
+			name:           "#1 Registry with port matched",
+			image:          "registry.local:5000/app:v1",
+			expectInsecure: true,
 		},
 		{
-			name: "#2: Create - Successful",
-			imageworkstatus: map[string]ImageWorkResult{
-				"fakejob": {
-					ImageWorkRequest: ImageWorkRequest{
-						Imagecache: &fledgedv1alpha1.ImageCache{
-							ObjectMeta: metav1.ObjectMeta{
-								Name: imageCacheName,
-							},
-						},
-						Node: &node,
-					},
-					Status: ImageWorkResultStatusJobCreated,
-				},
-			},
-			pods: []corev1.Pod{
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Namespace: fledgedNameSpace,
-						Labels:    map[string]string{"job-name": "fakejob"},
-					},
-					Status: corev1.PodStatus{
-						Phase: corev1.PodPending,
-						ContainerStatuses: []corev1.ContainerStatus{
-							{
-								State: corev1.ContainerState{
-									Waiting: &corev1.ContainerStateWaiting{
-										Reason:  "fakereason",
-										Message: "fakemessage",
-									},
-								},
-							},
-						},
-					},
-				},
-			},
-			expectError: false,
+			name:           "#2 Registry matched by host and port",
+			image:          "registry.local/app:v1",
+			expectInsecure: false,
 		},
 		{
-			name: "#3: Create - Successful (Node not ready, hence empty containerstatuses)",
-			imageworkstatus: map[string]ImageWorkResult{
-				"fakejob": {
-					ImageWorkRequest: ImageWorkRequest{
-						Imagecache: &fledgedv1alpha1.ImageCache{
-							ObjectMeta: metav1.ObjectMeta{
-								Name: imageCacheName,
-							},
-						},
-						Node: &node,
-					},
-					Status: ImageWorkResultStatusJobCreated,
-				},
+			name:           "#3 Image with no registry is from docker.io",
+			image:          "nginx:1.17",
+			expectInsecure: true,
+		},
+		{
+			name:           "#4 Registry not matched",
+			image:          "gcr.io/google-containers/pause:3.1",
+			expectInsecure: false,
+		},
+		{
+			name:      "#5 Invalid image reference",
+			image:     "Nginx",
+			expectErr: true,
+		},
+	}
+	for _, test := range tests {
+		insecure, err := isInsecureRegistry(test.image, insecureRegistries)
+		if (err != nil) != test.expectErr {
+			t.Errorf("Test: %s failed: expectErr=%t, actualErr=%v", test.name, test.expectErr, err)
+			continue
+		}
+		if insecure != test.expectInsecure {
+			t.Errorf("Test: %s failed: expectInsecure=%t, actualInsecure=%t", test.name, test.expectInsecure, insecure)
+		}
+	}
+	if insecure, _ := isInsecureRegistry("nginx", nil); insecure {
+		t.Errorf("Test failed: no insecure registries, but image was from insecure registry")
+	}
+}
+
+func TestPulledImageDigest(t *testing.T) {
+	newPod := func(containerImage, imageID string) *corev1.Pod {
+		return &corev1.Pod{
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "imagepuller", Image: containerImage}},
 			},
-			pods: []corev1.Pod{
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Namespace: fledgedNameSpace,
-						Labels:    map[string]string{"job-name": "fakejob"},
-					},
-					Status: corev1.PodStatus{
-						Phase:             corev1.PodPending,
-						ContainerStatuses: []corev1.ContainerStatus{},
-					},
-				},
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{{Name: "imagepuller", ImageID: imageID}},
 			},
-			expectError: false,
+		}
+	}
+	tests := []struct {
+		name           string
+		pod            *corev1.Pod
+		expectedDigest string
+	}{
+		{
+			name:           "#1 Docker image id",
+			pod:            newPod("nginx:latest", "docker-pullable://nginx@sha256:aaa"),
+			expectedDigest: "sha256:aaa",
 		},
 		{
-			name: "#4: Purge - Successful",
-			imageworkstatus: map[string]ImageWorkResult{
-				"fakejob": {
-					ImageWorkRequest: ImageWorkRequest{
-						WorkType: ImageCachePurge,
-						Imagecache: &fledgedv1alpha1.ImageCache{
-							ObjectMeta: metav1.ObjectMeta{
-								Name: imageCacheName,
-							},
-						},
-						Node: &node,
-					},
-					Status: ImageWorkResultStatusJobCreated,
-				},
-			},
-			pods: []corev1.Pod{
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Namespace: fledgedNameSpace,
-						Labels:    map[string]string{"job-name": "fakejob"},
-					},
-					Status: corev1.PodStatus{
-						Phase: corev1.PodPending,
-						ContainerStatuses: []corev1.ContainerStatus{
-							{
-								State: corev1.ContainerState{
-									Waiting: &corev1.ContainerStateWaiting{
-										Reason:  "fakereason",
-										Message: "fakemessage",
-									},
-								},
-							},
-						},
-					},
-				},
-			},
-			expectError: false,
+			name:           "#2 Containerd image id",
+			pod:            newPod("nginx:latest", "docker.io/library/nginx@sha256:bbb"),
+			expectedDigest: "sha256:bbb",
 		},
 		{
-			name: "#5: Purge - Successful",
-			imageworkstatus: map[string]ImageWorkResult{
-				"fakejob": {
-					ImageWorkRequest: ImageWorkRequest{
-						WorkType: ImageCachePurge,
-						Imagecache: &fledgedv1alpha1.ImageCache{
-							ObjectMeta: metav1.ObjectMeta{
-								Name: imageCacheName,
-							},
-						},
-						Node: &node,
-					},
-					Status: ImageWorkResultStatusJobCreated,
-				},
-			},
-			pods: []corev1.Pod{
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Namespace: fledgedNameSpace,
-						Labels:    map[string]string{"job-name": "fakejob"},
-					},
-					Status: corev1.PodStatus{
-						Phase: corev1.PodPending,
-						ContainerStatuses: []corev1.ContainerStatus{
-							{
-								State: corev1.ContainerState{
-									Terminated: &corev1.ContainerStateTerminated{
-										Reason:  "fakereason",
-										Message: "fakemessage",
-									},
-								},
-							},
-						},
-					},
-				},
-			},
-			expectError: false,
+			name:           "#3 Image id is not a repository digest",
+			pod:            newPod("nginx:latest", "docker://sha256:ccc"),
+			expectedDigest: "",
 		},
 		{
-			name: "#6: Purge - Unsuccessful",
-			imageworkstatus: map[string]ImageWorkResult{
-				"fakejob": {
-					ImageWorkRequest: ImageWorkRequest{
-						WorkType: ImageCachePurge,
-						Imagecache: &fledgedv1alpha1.ImageCache{
-							ObjectMeta: metav1.ObjectMeta{
-								Name: imageCacheName,
-							},
-						},
-						Node: &node,
-					},
-					Status: ImageWorkResultStatusJobCreated,
-				},
-			},
-			pods: []corev1.Pod{
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Namespace: fledgedNameSpace,
-					},
-				},
-			},
-			expectError:         true,
-			expectedErrorString: "No pods matched job",
+			name:           "#4 Container does not run the image",
+			pod:            newPod("senthilrch/kubefledged-cri-client:latest", "docker.io/senthilrch/kubefledged-cri-client@sha256:ddd"),
+			expectedDigest: "",
+		},
+	}
+	for _, test := range tests {
+		if digest := pulledImageDigest(test.pod, "nginx:latest"); digest != test.expectedDigest {
+			t.Errorf("Test: %s failed: expectedDigest=%q, actualDigest=%q", test.name, test.expectedDigest, digest)
+		}
+	}
+}
+
+func TestPullImageInsecureRegistry(t *testing.T) {
+	imagecache := &fledgedv1alpha1.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
 		},
+	}
+	tests := []struct {
+		name                    string
+		image                   string
+		containerRuntimeVersion string
+		expectedCommand         string
+	}{
 		{
-			name: "#7: Purge - Unsuccessful",
-			imageworkstatus: map[string]ImageWorkResult{
-				"fakejob": {
-					ImageWorkRequest: ImageWorkRequest{
-						WorkType: ImageCachePurge,
-						Imagecache: &fledgedv1alpha1.ImageCache{
-							ObjectMeta: metav1.ObjectMeta{
-								Name: imageCacheName,
-							},
-						},
-						Node: &node,
-					},
-					Status: ImageWorkResultStatusJobCreated,
-				},
-			},
-			pods: []corev1.Pod{
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Name:      "pod1",
-						Namespace: fledgedNameSpace,
-						Labels:    map[string]string{"job-name": "fakejob"},
-					},
-				},
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Name:      "pod2",
-						Namespace: fledgedNameSpace,
-						Labels:    map[string]string{"job-name": "fakejob"},
-					},
-				},
-			},
-			expectError:         true,
-			expectedErrorString: "More than one pod matched job",
+			name:                    "#1 Image from insecure registry pulled over plain HTTP",
+			image:                   "registry.local:5000/app:v1",
+			containerRuntimeVersion: "containerd://1.3.3",
+			expectedCommand:         "exec /usr/bin/ctr --address /run/containerd/containerd.sock --namespace k8s.io images pull --plain-http registry.local:5000/app:v1 > /dev/termination-log 2>&1",
 		},
 		{
-			name: "#8: Create - Unsuccessful",
-			imageworkstatus: map[string]ImageWorkResult{
-				"fakejob": {
-					ImageWorkRequest: ImageWorkRequest{
-						Imagecache: &fledgedv1alpha1.ImageCache{
-							ObjectMeta: metav1.ObjectMeta{
-								Name: imageCacheName,
-							},
-						},
-						Node: &node,
-					},
-					Status: ImageWorkResultStatusSucceeded,
-				},
-			},
-			pods: []corev1.Pod{
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Namespace: fledgedNameSpace,
-						Labels:    map[string]string{"job-name": "fakejob"},
-					},
-					Status: corev1.PodStatus{
-						Phase: corev1.PodPending,
-						ContainerStatuses: []corev1.ContainerStatus{
-							{
-								State: corev1.ContainerState{
-									Waiting: &corev1.ContainerStateWaiting{
-										Reason:  "fakereason",
-										Message: "fakemessage",
-									},
-								},
-							},
-						},
-					},
-				},
-			},
-			jobDeleteErr:        true,
-			expectError:         true,
-			expectedErrorString: "Internal error occurred: fake error",
+			name:                    "#2 Image from secure registry",
+			image:                   "gcr.io/app:v1",
+			containerRuntimeVersion: "containerd://1.3.3",
+		},
+		{
+			name:                    "#3 Docker runtime should be configured with insecure registry",
+			image:                   "registry.local:5000/app:v1",
+			containerRuntimeVersion: "docker://19.3.8",
 		},
 	}
-
 	for _, test := range tests {
 		fakekubeclientset := &fakeclientset.Clientset{}
-		if test.eventListErr {
-			fakekubeclientset.AddReactor("list", "events", func(action core.Action) (handled bool, ret runtime.Object, err error) {
-				return true, nil, apierrors.NewInternalError(fmt.Errorf("fake error"))
-			})
+		var created *batchv1.Job
+		fakekubeclientset.AddReactor("create", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			created = action.(core.CreateAction).GetObject().(*batchv1.Job)
+			return true, created, nil
+		})
+		imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent")
+		imagemanager.insecureRegistries = []string{"registry.local:5000"}
+		iwr := ImageWorkRequest{
+			Image:                   test.image,
+			Node:                    &node,
+			ContainerRuntimeVersion: test.containerRuntimeVersion,
+			WorkType:                ImageCacheCreate,
+			Imagecache:              imagecache,
 		}
-		if test.jobDeleteErr {
-			fakekubeclientset.AddReactor("delete", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
-				return true, nil, apierrors.NewInternalError(fmt.Errorf("fake error"))
-			})
+		if _, err := imagemanager.pullImage(context.Background(), iwr); err != nil {
+			t.Errorf("Test: %s failed: %v", test.name, err)
+			continue
 		}
-		imagemanager, podInformer := newTestImageManager(fakekubeclientset, "IfNotPresent")
-		for _, pod := range test.pods {
-			if !reflect.DeepEqual(pod, corev1.Pod{}) {
-				podInformer.Informer().GetIndexer().Add(&pod)
+		container := created.Spec.Template.Spec.Containers[0]
+		if test.expectedCommand == "" {
+			if container.Image != test.image {
+				t.Errorf("Test: %s failed: expected image %s, actual %s", test.name, test.image, container.Image)
 			}
+			continue
 		}
-		imagemanager.imageworkstatus = test.imageworkstatus
-		errCh := make(chan error)
-		go imagemanager.updateImageCacheStatus(imageCacheName, errCh)
-		err := <-errCh
-		if err != nil {
-			t.Logf("err=%s", err.Error())
-		}
-		if test.expectError {
-			if err == nil {
-				t.Errorf("Test: %s failed: expectedError=%s, actualError=nil", test.name, test.expectedErrorString)
-			}
-			if err != nil && !strings.HasPrefix(err.Error(), test.expectedErrorString) {
-				t.Errorf("Test: %s failed: expectedError=%s, actualError=%s", test.name, test.expectedErrorString, err.Error())
-			}
-		} else if err != nil {
-			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+		if container.Image != imagemanager.dockerClientImage || container.Args[1] != test.expectedCommand {
+			t.Errorf("Test: %s failed: expected command %q, actual %s %q", test.name, test.expectedCommand, container.Image, container.Args)
 		}
 	}
 }
 
-func TestProcessNextWorkItem(t *testing.T) {
-	defaultImageCache := fledgedv1alpha1.ImageCache{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      "foo",
-			Namespace: "kube-fledged",
+func TestPullImagePlatform(t *testing.T) {
+	tests := []struct {
+		name                    string
+		image                   string
+		containerRuntimeVersion string
+		pullJobContainer        *fledgedv1alpha1.PullJobContainer
+		expectedCommand         string
+		expectedEnv             []corev1.EnvVar
+	}{
+		{
+			name:                    "#1 Containerd pulls the platform",
+			image:                   "nginx:1.17",
+			containerRuntimeVersion: "containerd://1.3.3",
+			expectedCommand:         "exec /usr/bin/ctr --address /run/containerd/containerd.sock --namespace k8s.io images pull --platform linux/arm64 docker.io/library/nginx:1.17 > /dev/termination-log 2>&1",
 		},
-		Spec: fledgedv1alpha1.ImageCacheSpec{
-			CacheSpec: []fledgedv1alpha1.CacheSpecImages{
-				{
-					Images: []string{"foo"},
-				},
-			},
+		{
+			name:                    "#2 Containerd pulls the platform from insecure registry",
+			image:                   "registry.local:5000/app:v1",
+			containerRuntimeVersion: "containerd://1.3.3",
+			expectedCommand:         "exec /usr/bin/ctr --address /run/containerd/containerd.sock --namespace k8s.io images pull --plain-http --platform linux/arm64 registry.local:5000/app:v1 > /dev/termination-log 2>&1",
 		},
-	}
-	testnode := node
-	testnode.Status.Images = []corev1.ContainerImage{
 		{
-			Names: []string{"foo:v1"},
+			name:                    "#3 Docker pulls the platform",
+			image:                   "nginx:1.17",
+			containerRuntimeVersion: "docker://19.3.8",
+			expectedCommand:         "exec /usr/bin/docker pull --platform linux/arm64 nginx:1.17 > /dev/termination-log 2>&1",
+			expectedEnv:             []corev1.EnvVar{{Name: "DOCKER_CLI_EXPERIMENTAL", Value: "enabled"}},
+		},
+		{
+			name:                    "#4 Overridden pull job container is passed the platform",
+			image:                   "nginx:1.17",
+			containerRuntimeVersion: "containerd://1.3.3",
+			pullJobContainer:        &fledgedv1alpha1.PullJobContainer{Image: "mirror-puller:v1"},
+			expectedEnv:             []corev1.EnvVar{{Name: "IMAGE", Value: "nginx:1.17"}, {Name: "PLATFORM", Value: "linux/arm64"}},
 		},
 	}
+	for _, test := range tests {
+		fakekubeclientset := &fakeclientset.Clientset{}
+		var created *batchv1.Job
+		fakekubeclientset.AddReactor("create", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			created = action.(core.CreateAction).GetObject().(*batchv1.Job)
+			return true, created, nil
+		})
+		imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent")
+		imagemanager.insecureRegistries = []string{"registry.local:5000"}
+		iwr := ImageWorkRequest{
+			Image:                   test.image,
+			Node:                    &node,
+			ContainerRuntimeVersion: test.containerRuntimeVersion,
+			WorkType:                ImageCacheCreate,
+			Imagecache: &fledgedv1alpha1.ImageCache{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "kube-fledged",
+				},
+				Spec: fledgedv1alpha1.ImageCacheSpec{
+					PullJobContainer: test.pullJobContainer,
+				},
+			},
+			Platform: "linux/arm64",
+		}
+		if _, err := imagemanager.pullImage(context.Background(), iwr); err != nil {
+			t.Errorf("Test: %s failed: %v", test.name, err)
+			continue
+		}
+		container := created.Spec.Template.Spec.Containers[0]
+		if test.expectedCommand != "" && (container.Image != imagemanager.dockerClientImage || container.Args[1] != test.expectedCommand) {
+			t.Errorf("Test: %s failed: expected command %q, actual %s %q", test.name, test.expectedCommand, container.Image, container.Args)
+		}
+		if !reflect.DeepEqual(container.Env, test.expectedEnv) {
+			t.Errorf("Test: %s failed: expected env %+v, actual %+v", test.name, test.expectedEnv, container.Env)
+		}
+	}
+	if platformPullSupported("cri-o://1.17.0") {
+		t.Errorf("Test failed: pulling platform should not be supported by cri-o")
+	}
+}
+
+func TestPullImageMirrors(t *testing.T) {
+	ctr := "/usr/bin/ctr --address /run/containerd/containerd.sock --namespace k8s.io"
 	tests := []struct {
-		name                string
-		iwr                 ImageWorkRequest
-		imageworkstatus     map[string]ImageWorkResult
-		pods                []corev1.Pod
-		imagepullpolicy     string
-		expectError         bool
-		expectedErrorString string
+		name                    string
+		image                   string
+		containerRuntimeVersion string
+		pullJobContainer        *fledgedv1alpha1.PullJobContainer
+		expectedImage           string
+		expectedCommand         string
+		expectedEnv             []corev1.EnvVar
 	}{
 		{
-			name: "#1: Create - Successful",
-			iwr: ImageWorkRequest{
-				Image:      "fakeimage",
-				Node:       &node,
-				WorkType:   ImageCacheCreate,
-				Imagecache: &defaultImageCache,
+			name:                    "#1 Containerd tries the mirrors",
+			image:                   "nginx:1.17",
+			containerRuntimeVersion: "containerd://1.3.3",
+			expectedImage:           "senthilrch/fledged-docker-client:latest",
+			expectedCommand: "{ " + ctr + " images pull docker.io/library/nginx:1.17 >> /dev/termination-log 2>&1 && echo -n nginx:1.17 > /dev/termination-log; } || " +
+				"{ " + ctr + " images pull --plain-http registry.local:5000/library/nginx:1.17 >> /dev/termination-log 2>&1 && " +
+				ctr + " images tag registry.local:5000/library/nginx:1.17 docker.io/library/nginx:1.17 >> /dev/termination-log 2>&1 && echo -n registry.local:5000/library/nginx:1.17 > /dev/termination-log; } || " +
+				"{ " + ctr + " images pull mirror.example.com/dockerhub/library/nginx:1.17 >> /dev/termination-log 2>&1 && " +
+				ctr + " images tag mirror.example.com/dockerhub/library/nginx:1.17 docker.io/library/nginx:1.17 >> /dev/termination-log 2>&1 && echo -n mirror.example.com/dockerhub/library/nginx:1.17 > /dev/termination-log; }",
+		},
+		{
+			name:                    "#2 Docker tries the mirrors by digest",
+			image:                   "nginx@sha256:0000000000000000000000000000000000000000000000000000000000000000",
+			containerRuntimeVersion: "docker://19.3.8",
+			expectedImage:           "senthilrch/fledged-docker-client:latest",
+			expectedCommand: "{ /usr/bin/docker pull nginx@sha256:0000000000000000000000000000000000000000000000000000000000000000 >> /dev/termination-log 2>&1 && " +
+				"echo -n nginx@sha256:0000000000000000000000000000000000000000000000000000000000000000 > /dev/termination-log; } || " +
+				"{ /usr/bin/docker pull registry.local:5000/library/nginx@sha256:0000000000000000000000000000000000000000000000000000000000000000 >> /dev/termination-log 2>&1 && " +
+				"/usr/bin/docker tag registry.local:5000/library/nginx@sha256:0000000000000000000000000000000000000000000000000000000000000000 nginx@sha256:0000000000000000000000000000000000000000000000000000000000000000 >> /dev/termination-log 2>&1 && " +
+				"echo -n registry.local:5000/library/nginx@sha256:0000000000000000000000000000000000000000000000000000000000000000 > /dev/termination-log; } || " +
+				"{ /usr/bin/docker pull mirror.example.com/dockerhub/library/nginx@sha256:0000000000000000000000000000000000000000000000000000000000000000 >> /dev/termination-log 2>&1 && " +
+				"/usr/bin/docker tag mirror.example.com/dockerhub/library/nginx@sha256:0000000000000000000000000000000000000000000000000000000000000000 nginx@sha256:0000000000000000000000000000000000000000000000000000000000000000 >> /dev/termination-log 2>&1 && " +
+				"echo -n mirror.example.com/dockerhub/library/nginx@sha256:0000000000000000000000000000000000000000000000000000000000000000 > /dev/termination-log; }",
+		},
+		{
+			name:                    "#3 Cri-o pulls from the registry of the image only",
+			image:                   "nginx:1.17",
+			containerRuntimeVersion: "cri-o://1.17.0",
+			expectedImage:           "nginx:1.17",
+		},
+		{
+			name:                    "#4 Overridden pull job container is passed the mirrors",
+			image:                   "nginx:1.17",
+			containerRuntimeVersion: "containerd://1.3.3",
+			pullJobContainer:        &fledgedv1alpha1.PullJobContainer{Image: "mirror-puller:v1"},
+			expectedImage:           "mirror-puller:v1",
+			expectedEnv:             []corev1.EnvVar{{Name: "IMAGE", Value: "nginx:1.17"}, {Name: "MIRRORS", Value: "registry.local:5000,mirror.example.com/dockerhub"}},
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := &fakeclientset.Clientset{}
+		var created *batchv1.Job
+		fakekubeclientset.AddReactor("create", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			created = action.(core.CreateAction).GetObject().(*batchv1.Job)
+			return true, created, nil
+		})
+		imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent")
+		imagemanager.insecureRegistries = []string{"registry.local:5000"}
+		mirrors := []string{"registry.local:5000", "mirror.example.com/dockerhub"}
+		iwr := ImageWorkRequest{
+			Image:                   test.image,
+			Node:                    &node,
+			ContainerRuntimeVersion: test.containerRuntimeVersion,
+			WorkType:                ImageCacheCreate,
+			Imagecache: &fledgedv1alpha1.ImageCache{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "kube-fledged",
+				},
+				Spec: fledgedv1alpha1.ImageCacheSpec{
+					PullJobContainer: test.pullJobContainer,
+				},
 			},
-			imageworkstatus: map[string]ImageWorkResult{
-				"fakejob": {
-					ImageWorkRequest: ImageWorkRequest{
-						Imagecache: &fledgedv1alpha1.ImageCache{
-							ObjectMeta: metav1.ObjectMeta{
-								Name: defaultImageCache.Name,
-							},
-						},
-					},
-					Status: ImageWorkResultStatusSucceeded,
+			Mirrors: &mirrors,
+		}
+		if _, err := imagemanager.pullImage(context.Background(), iwr); err != nil {
+			t.Errorf("Test: %s failed: %v", test.name, err)
+			continue
+		}
+		container := created.Spec.Template.Spec.Containers[0]
+		if container.Image != test.expectedImage {
+			t.Errorf("Test: %s failed: expected image %s, actual %s", test.name, test.expectedImage, container.Image)
+		}
+		if test.expectedCommand != "" && (len(container.Args) != 2 || container.Args[1] != test.expectedCommand) {
+			t.Errorf("Test: %s failed: expected command %q, actual %q", test.name, test.expectedCommand, container.Args)
+		}
+		if !reflect.DeepEqual(container.Env, test.expectedEnv) {
+			t.Errorf("Test: %s failed: expected env %+v, actual %+v", test.name, test.expectedEnv, container.Env)
+		}
+	}
+	pod := &corev1.Pod{Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+		Name:  "imagepuller",
+		State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Message: "registry.local:5000/library/nginx:1.17"}},
+	}}}}
+	if source := pulledImageSource(pod); source != "registry.local:5000/library/nginx:1.17" {
+		t.Errorf("Test failed: expected source registry.local:5000/library/nginx:1.17, actual %s", source)
+	}
+}
+
+func TestJobsInImageCacheNamespace(t *testing.T) {
+	fakekubeclientset := &fakeclientset.Clientset{}
+	var created []string
+	fakekubeclientset.AddReactor("create", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+		created = append(created, action.GetNamespace())
+		return true, action.(core.CreateAction).GetObject(), nil
+	})
+	imagecacheworkqueue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ImageCaches")
+	imageworkqueue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ImagePullerStatus")
+	imagemanager, podInformer := NewImageManager(imagecacheworkqueue, imageworkqueue, fakekubeclientset, record.NewFakeRecorder(100), ImageManagerOptions{
+		Namespace:                 fledgedNameSpace,
+		ImagePullDeadlineDuration: time.Millisecond * 10,
+		DockerClientImage:         "senthilrch/fledged-docker-client:latest",
+		ImagePullPolicy:           "IfNotPresent",
+		JobBackoffLimit:           1,
+		JobCompletions:            1,
+		JobParallelism:            1,
+		JobRestartPolicy:          "Never",
+		JobsInImageCacheNamespace: true,
+	})
+	iwr := ImageWorkRequest{
+		Image:                   "foo",
+		Node:                    &node,
+		ContainerRuntimeVersion: "containerd://1.3.3",
+		WorkType:                ImageCacheCreate,
+		Imagecache: &fledgedv1alpha1.ImageCache{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "tenant-a",
+			},
+		},
+	}
+	if _, err := imagemanager.pullImage(context.Background(), iwr); err != nil {
+		t.Fatalf("Test failed: %v", err)
+	}
+	iwr.WorkType = ImageCachePurge
+	if _, err := imagemanager.deleteImage(context.Background(), iwr); err != nil {
+		t.Fatalf("Test failed: %v", err)
+	}
+	if expected := []string{"tenant-a", "tenant-a"}; !reflect.DeepEqual(created, expected) {
+		t.Errorf("Test failed: expected jobs created in namespaces %v, actual %v", expected, created)
+	}
+	// Pods of jobs are looked up in the namespace of the image cache
+	podInformer.Informer().GetIndexer().Add(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:      "foo-pod",
+		Namespace: "tenant-a",
+		Labels:    map[string]string{"job-name": "foo"},
+	}, Status: corev1.PodStatus{Phase: corev1.PodFailed}})
+	if !imagemanager.retriedByJob("tenant-a", "foo") {
+		t.Errorf("Test failed: failed pod of job in namespace tenant-a should be retried by the job")
+	}
+	if imagemanager.podsLister == imagemanager.jobPodsLister {
+		t.Errorf("Test failed: pods of jobs should be watched across namespaces")
+	}
+}
+
+func TestPullImageArchive(t *testing.T) {
+	tests := []struct {
+		name                    string
+		containerRuntimeVersion string
+		imageArchive            fledgedv1alpha1.ImageArchive
+		expectedCommand         []string
+		expectedArgs            []string
+		expectedVolume          corev1.VolumeSource
+	}{
+		{
+			name:                    "#1 Containerd imports the archive from hostPath",
+			containerRuntimeVersion: "containerd://1.3.3",
+			imageArchive:            fledgedv1alpha1.ImageArchive{HostPath: "/mnt/archives"},
+			expectedCommand:         []string{"/bin/bash"},
+			expectedArgs:            []string{"-c", "exec /usr/bin/ctr --address /run/containerd/containerd.sock --namespace k8s.io images import \"$IMAGE_ARCHIVE\" > /dev/termination-log 2>&1"},
+			expectedVolume:          corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: "/mnt/archives"}},
+		},
+		{
+			name:                    "#2 Docker loads the archive from PVC",
+			containerRuntimeVersion: "docker://19.3.8",
+			imageArchive:            fledgedv1alpha1.ImageArchive{PersistentVolumeClaim: "archives"},
+			expectedCommand:         []string{"/bin/bash"},
+			expectedArgs:            []string{"-c", "exec /usr/bin/docker load -i \"$IMAGE_ARCHIVE\" > /dev/termination-log 2>&1"},
+			expectedVolume:          corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "archives", ReadOnly: true}},
+		},
+		{
+			name:                    "#3 Load command specified",
+			containerRuntimeVersion: "cri-o://1.17.0",
+			imageArchive:            fledgedv1alpha1.ImageArchive{HostPath: "/mnt/archives", Command: []string{"/bin/load"}},
+			expectedCommand:         []string{"/bin/load"},
+			expectedVolume:          corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: "/mnt/archives"}},
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := &fakeclientset.Clientset{}
+		var created *batchv1.Job
+		fakekubeclientset.AddReactor("create", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			created = action.(core.CreateAction).GetObject().(*batchv1.Job)
+			return true, created, nil
+		})
+		imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent")
+		imageArchive := test.imageArchive
+		iwr := ImageWorkRequest{
+			Image:                   "myregistry/myapp:1.0",
+			Node:                    &node,
+			ContainerRuntimeVersion: test.containerRuntimeVersion,
+			WorkType:                ImageCacheCreate,
+			Imagecache: &fledgedv1alpha1.ImageCache{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "kube-fledged",
 				},
 			},
-			pods: []corev1.Pod{
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Namespace: fledgedNameSpace,
-						Labels:    map[string]string{"job-name": "fakejob"},
-					},
-					Status: corev1.PodStatus{
-						Phase: corev1.PodPending,
-						ContainerStatuses: []corev1.ContainerStatus{
-							{
-								State: corev1.ContainerState{
-									Terminated: &corev1.ContainerStateTerminated{
-										Reason:  "fakereason",
-										Message: "fakemessage",
-									},
-								},
-							},
-						},
-					},
+			ImageArchive: &imageArchive,
+		}
+		if _, err := imagemanager.pullImage(context.Background(), iwr); err != nil {
+			t.Errorf("Test: %s failed: %v", test.name, err)
+			continue
+		}
+		podSpec := created.Spec.Template.Spec
+		container := podSpec.Containers[0]
+		if container.Image != imagemanager.dockerClientImage || !reflect.DeepEqual(container.Command, test.expectedCommand) || !reflect.DeepEqual(container.Args, test.expectedArgs) {
+			t.Errorf("Test: %s failed: expected command %q %q, actual %s %q %q", test.name, test.expectedCommand, test.expectedArgs, container.Image, container.Command, container.Args)
+		}
+		expectedEnv := []corev1.EnvVar{{Name: "IMAGE", Value: "myregistry/myapp:1.0"}, {Name: "IMAGE_ARCHIVE", Value: "/var/lib/kubefledged/archives/myregistry_myapp_1.0.tar"}}
+		if !reflect.DeepEqual(container.Env, expectedEnv) {
+			t.Errorf("Test: %s failed: expected env %+v, actual %+v", test.name, expectedEnv, container.Env)
+		}
+		if len(podSpec.Volumes) != 2 || !reflect.DeepEqual(podSpec.Volumes[1].VolumeSource, test.expectedVolume) {
+			t.Errorf("Test: %s failed: expected archive volume %+v, actual %+v", test.name, test.expectedVolume, podSpec.Volumes)
+		}
+	}
+	if archiveLoadSupported("cri-o://1.17.0") {
+		t.Errorf("Test failed: loading image archives should not be supported by cri-o")
+	}
+}
+
+func TestPullImageNever(t *testing.T) {
+	tests := []struct {
+		name             string
+		imageArchive     *fledgedv1alpha1.ImageArchive
+		pullJobContainer *fledgedv1alpha1.PullJobContainer
+		platform         string
+	}{
+		{
+			name: "#1 Image presence verified",
+		},
+		{
+			name:         "#2 Image archive not loaded",
+			imageArchive: &fledgedv1alpha1.ImageArchive{HostPath: "/opt/images"},
+		},
+		{
+			name:             "#3 Overridden pull job container not used",
+			pullJobContainer: &fledgedv1alpha1.PullJobContainer{Image: "mirror-puller:v1"},
+		},
+		{
+			name:     "#4 Platform not pulled",
+			platform: "linux/arm64",
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := &fakeclientset.Clientset{}
+		var created *batchv1.Job
+		fakekubeclientset.AddReactor("create", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			created = action.(core.CreateAction).GetObject().(*batchv1.Job)
+			return true, created, nil
+		})
+		imagemanager, _ := newTestImageManager(fakekubeclientset, "Never")
+		iwr := ImageWorkRequest{
+			Image:                   "nginx:1.17",
+			Node:                    &node,
+			ContainerRuntimeVersion: "containerd://1.3.3",
+			WorkType:                ImageCacheCreate,
+			Imagecache: &fledgedv1alpha1.ImageCache{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "kube-fledged",
+				},
+				Spec: fledgedv1alpha1.ImageCacheSpec{
+					PullJobContainer: test.pullJobContainer,
+				},
+			},
+			ImageArchive: test.imageArchive,
+			Platform:     test.platform,
+		}
+		if _, err := imagemanager.pullImage(context.Background(), iwr); err != nil {
+			t.Errorf("Test: %s failed: %v", test.name, err)
+			continue
+		}
+		container := created.Spec.Template.Spec.Containers[0]
+		if container.Image != iwr.Image || container.ImagePullPolicy != corev1.PullNever {
+			t.Errorf("Test: %s failed: expected image %s with pull policy Never, actual %s with pull policy %s", test.name, iwr.Image, container.Image, container.ImagePullPolicy)
+		}
+		if !reflect.DeepEqual(container.Command, []string{"/tmp/bin/echo", "Image present in node!"}) {
+			t.Errorf("Test: %s failed: unexpected command %q", test.name, container.Command)
+		}
+	}
+}
+
+func TestPullImageCredentialsSecret(t *testing.T) {
+	tests := []struct {
+		name              string
+		credentialsSecret *fledgedv1alpha1.CredentialsSecret
+		pullJobContainer  *fledgedv1alpha1.PullJobContainer
+		expectedEnv       corev1.EnvVar
+	}{
+		{
+			name:              "#1 Env variable points to key of secret",
+			credentialsSecret: &fledgedv1alpha1.CredentialsSecret{SecretName: "gcr-key", MountPath: "/var/run/secrets/gcr", Key: "key.json", EnvName: "GOOGLE_APPLICATION_CREDENTIALS"},
+			pullJobContainer:  &fledgedv1alpha1.PullJobContainer{Image: "gcr-puller:v1"},
+			expectedEnv:       corev1.EnvVar{Name: "GOOGLE_APPLICATION_CREDENTIALS", Value: "/var/run/secrets/gcr/key.json"},
+		},
+		{
+			name:              "#2 Default env variable points to mounted secret",
+			credentialsSecret: &fledgedv1alpha1.CredentialsSecret{SecretName: "registry-auth", MountPath: "/auth"},
+			expectedEnv:       corev1.EnvVar{Name: "REGISTRY_CREDENTIALS", Value: "/auth"},
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := &fakeclientset.Clientset{}
+		var created *batchv1.Job
+		fakekubeclientset.AddReactor("create", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			created = action.(core.CreateAction).GetObject().(*batchv1.Job)
+			return true, created, nil
+		})
+		imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent")
+		iwr := ImageWorkRequest{
+			Image:                   "gcr.io/foo/bar:1.0",
+			Node:                    &node,
+			ContainerRuntimeVersion: "containerd://1.3.3",
+			WorkType:                ImageCacheCreate,
+			Imagecache: &fledgedv1alpha1.ImageCache{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "kube-fledged",
+				},
+				Spec: fledgedv1alpha1.ImageCacheSpec{
+					PullJobContainer:  test.pullJobContainer,
+					CredentialsSecret: test.credentialsSecret,
+				},
+			},
+		}
+		if _, err := imagemanager.pullImage(context.Background(), iwr); err != nil {
+			t.Errorf("Test: %s failed: %v", test.name, err)
+			continue
+		}
+		podSpec := created.Spec.Template.Spec
+		volume := podSpec.Volumes[len(podSpec.Volumes)-1]
+		if volume.Secret == nil || volume.Secret.SecretName != test.credentialsSecret.SecretName {
+			t.Errorf("Test: %s failed: expected volume of secret %s, actual %+v", test.name, test.credentialsSecret.SecretName, volume)
+		}
+		container := podSpec.Containers[0]
+		mount := container.VolumeMounts[len(container.VolumeMounts)-1]
+		if mount.Name != volume.Name || mount.MountPath != test.credentialsSecret.MountPath || !mount.ReadOnly {
+			t.Errorf("Test: %s failed: expected read-only mount of %s at %s, actual %+v", test.name, volume.Name, test.credentialsSecret.MountPath, mount)
+		}
+		if env := container.Env[len(container.Env)-1]; env != test.expectedEnv {
+			t.Errorf("Test: %s failed: expected env %+v, actual %+v", test.name, test.expectedEnv, env)
+		}
+	}
+}
+
+func TestPullImageClientTLSSecret(t *testing.T) {
+	tests := []struct {
+		name                    string
+		containerRuntimeVersion string
+		expectedCommand         string
+	}{
+		{
+			name:                    "#1 Containerd pulls with the client certificate",
+			containerRuntimeVersion: "containerd://1.3.3",
+			expectedCommand:         "TLS_CA=; if [ -f /etc/kubefledged/client-tls/ca.crt ]; then TLS_CA=\"--tlscacert /etc/kubefledged/client-tls/ca.crt\"; fi; exec /usr/bin/ctr --address /run/containerd/containerd.sock --namespace k8s.io images pull --tlscert /etc/kubefledged/client-tls/tls.crt --tlskey /etc/kubefledged/client-tls/tls.key $TLS_CA registry.corp:5000/app:v1 > /dev/termination-log 2>&1",
+		},
+		{
+			name:                    "#2 Docker runtime should be configured with the client certificate",
+			containerRuntimeVersion: "docker://19.3.8",
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := &fakeclientset.Clientset{}
+		var created *batchv1.Job
+		fakekubeclientset.AddReactor("create", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			created = action.(core.CreateAction).GetObject().(*batchv1.Job)
+			return true, created, nil
+		})
+		imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent")
+		iwr := ImageWorkRequest{
+			Image:                   "registry.corp:5000/app:v1",
+			Node:                    &node,
+			ContainerRuntimeVersion: test.containerRuntimeVersion,
+			WorkType:                ImageCacheCreate,
+			Imagecache: &fledgedv1alpha1.ImageCache{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "kube-fledged",
+				},
+				Spec: fledgedv1alpha1.ImageCacheSpec{
+					ClientTLSSecret: "client-tls",
+				},
+			},
+		}
+		if _, err := imagemanager.pullImage(context.Background(), iwr); err != nil {
+			t.Errorf("Test: %s failed: %v", test.name, err)
+			continue
+		}
+		podSpec := created.Spec.Template.Spec
+		container := podSpec.Containers[0]
+		if test.expectedCommand == "" {
+			if container.Image != iwr.Image {
+				t.Errorf("Test: %s failed: expected image %s, actual %s", test.name, iwr.Image, container.Image)
+			}
+			for _, volume := range podSpec.Volumes {
+				if volume.Secret != nil {
+					t.Errorf("Test: %s failed: unexpected volume of secret %s", test.name, volume.Secret.SecretName)
+				}
+			}
+			continue
+		}
+		if container.Image != imagemanager.dockerClientImage || container.Args[1] != test.expectedCommand {
+			t.Errorf("Test: %s failed: expected command %q, actual %s %q", test.name, test.expectedCommand, container.Image, container.Args)
+		}
+		volume := podSpec.Volumes[len(podSpec.Volumes)-1]
+		if volume.Secret == nil || volume.Secret.SecretName != "client-tls" {
+			t.Errorf("Test: %s failed: expected volume of secret client-tls, actual %+v", test.name, volume)
+		}
+		mount := container.VolumeMounts[len(container.VolumeMounts)-1]
+		if mount.Name != volume.Name || mount.MountPath != clientTLSMountPath || !mount.ReadOnly {
+			t.Errorf("Test: %s failed: expected read-only mount of %s at %s, actual %+v", test.name, volume.Name, clientTLSMountPath, mount)
+		}
+	}
+}
+
+func TestPullImageCABundle(t *testing.T) {
+	tests := []struct {
+		name                    string
+		containerRuntimeVersion string
+		caBundle                fledgedv1alpha1.CABundle
+		clientTLSSecret         string
+		expectedCommand         string
+	}{
+		{
+			name:                    "#1 Containerd pulls trusting the CAs of a ConfigMap",
+			containerRuntimeVersion: "containerd://1.3.3",
+			caBundle:                fledgedv1alpha1.CABundle{ConfigMapName: "registry-ca", Key: "ca.pem"},
+			expectedCommand:         "exec /usr/bin/ctr --address /run/containerd/containerd.sock --namespace k8s.io images pull --tlscacert /etc/kubefledged/ca-bundle/ca.crt registry.corp:5000/app:v1 > /dev/termination-log 2>&1",
+		},
+		{
+			name:                    "#2 Containerd pulls with the client certificate trusting the CAs of a Secret",
+			containerRuntimeVersion: "containerd://1.3.3",
+			caBundle:                fledgedv1alpha1.CABundle{SecretName: "registry-ca"},
+			clientTLSSecret:         "client-tls",
+			expectedCommand:         "exec /usr/bin/ctr --address /run/containerd/containerd.sock --namespace k8s.io images pull --tlscert /etc/kubefledged/client-tls/tls.crt --tlskey /etc/kubefledged/client-tls/tls.key --tlscacert /etc/kubefledged/ca-bundle/ca.crt registry.corp:5000/app:v1 > /dev/termination-log 2>&1",
+		},
+		{
+			name:                    "#3 Docker runtime should be configured to trust the CAs",
+			containerRuntimeVersion: "docker://19.3.8",
+			caBundle:                fledgedv1alpha1.CABundle{ConfigMapName: "registry-ca"},
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := &fakeclientset.Clientset{}
+		var created *batchv1.Job
+		fakekubeclientset.AddReactor("create", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			created = action.(core.CreateAction).GetObject().(*batchv1.Job)
+			return true, created, nil
+		})
+		imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent")
+		caBundle := test.caBundle
+		iwr := ImageWorkRequest{
+			Image:                   "registry.corp:5000/app:v1",
+			Node:                    &node,
+			ContainerRuntimeVersion: test.containerRuntimeVersion,
+			WorkType:                ImageCacheCreate,
+			Imagecache: &fledgedv1alpha1.ImageCache{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "kube-fledged",
+				},
+				Spec: fledgedv1alpha1.ImageCacheSpec{
+					CABundle:        &caBundle,
+					ClientTLSSecret: test.clientTLSSecret,
+				},
+			},
+		}
+		if _, err := imagemanager.pullImage(context.Background(), iwr); err != nil {
+			t.Errorf("Test: %s failed: %v", test.name, err)
+			continue
+		}
+		podSpec := created.Spec.Template.Spec
+		container := podSpec.Containers[0]
+		if test.expectedCommand == "" {
+			if container.Image != iwr.Image {
+				t.Errorf("Test: %s failed: expected image %s, actual %s", test.name, iwr.Image, container.Image)
+			}
+			for _, volume := range podSpec.Volumes {
+				if volume.ConfigMap != nil {
+					t.Errorf("Test: %s failed: unexpected volume of configmap %s", test.name, volume.ConfigMap.Name)
+				}
+			}
+			continue
+		}
+		if container.Image != imagemanager.dockerClientImage || container.Args[1] != test.expectedCommand {
+			t.Errorf("Test: %s failed: expected command %q, actual %s %q", test.name, test.expectedCommand, container.Image, container.Args)
+		}
+		volume := podSpec.Volumes[len(podSpec.Volumes)-1]
+		expectedItems := []corev1.KeyToPath{{Key: caBundleKey(&caBundle), Path: "ca.crt"}}
+		var name string
+		var items []corev1.KeyToPath
+		if volume.ConfigMap != nil {
+			name, items = volume.ConfigMap.Name, volume.ConfigMap.Items
+		} else if volume.Secret != nil {
+			name, items = volume.Secret.SecretName, volume.Secret.Items
+		}
+		if name != "registry-ca" || !reflect.DeepEqual(items, expectedItems) || (volume.Secret != nil) != (caBundle.SecretName != "") {
+			t.Errorf("Test: %s failed: expected volume of %+v with items %+v, actual %+v", test.name, caBundle, expectedItems, volume)
+		}
+		mount := container.VolumeMounts[len(container.VolumeMounts)-1]
+		if mount.Name != volume.Name || mount.MountPath != caBundleMountPath || !mount.ReadOnly {
+			t.Errorf("Test: %s failed: expected read-only mount of %s at %s, actual %+v", test.name, volume.Name, caBundleMountPath, mount)
+		}
+	}
+}
+
+func TestDefaultPullSecret(t *testing.T) {
+	tests := []struct {
+		name              string
+		defaultPullSecret string
+		imageCacheSecrets []corev1.LocalObjectReference
+		imageListSecrets  *[]corev1.LocalObjectReference
+		expectedSecrets   []corev1.LocalObjectReference
+	}{
+		{
+			name:              "#1: Default pull secret set when no secrets are specified",
+			defaultPullSecret: "registry-creds",
+			expectedSecrets:   []corev1.LocalObjectReference{{Name: "registry-creds"}},
+		},
+		{
+			name:              "#2: Secrets of the image cache override the default pull secret",
+			defaultPullSecret: "registry-creds",
+			imageCacheSecrets: []corev1.LocalObjectReference{{Name: "cache-creds"}},
+			expectedSecrets:   []corev1.LocalObjectReference{{Name: "cache-creds"}},
+		},
+		{
+			name:              "#3: Secrets of the image list override the default pull secret",
+			defaultPullSecret: "registry-creds",
+			imageListSecrets:  &[]corev1.LocalObjectReference{{Name: "list-creds"}},
+			expectedSecrets:   []corev1.LocalObjectReference{{Name: "list-creds"}},
+		},
+		{
+			name: "#4: No default pull secret",
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := &fakeclientset.Clientset{}
+		var created *batchv1.Job
+		fakekubeclientset.AddReactor("create", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			created = action.(core.CreateAction).GetObject().(*batchv1.Job)
+			return true, created, nil
+		})
+		imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent")
+		imagemanager.defaultPullSecret = test.defaultPullSecret
+		iwr := ImageWorkRequest{
+			Image:                   "registry.corp/app:v1",
+			Node:                    &node,
+			ContainerRuntimeVersion: "containerd://1.4.3",
+			WorkType:                ImageCacheCreate,
+			ImagePullSecrets:        test.imageListSecrets,
+			Imagecache: &fledgedv1alpha1.ImageCache{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "kube-fledged",
+				},
+				Spec: fledgedv1alpha1.ImageCacheSpec{
+					ImagePullSecrets: test.imageCacheSecrets,
+				},
+			},
+		}
+		if _, err := imagemanager.pullImage(context.Background(), iwr); err != nil {
+			t.Errorf("Test: %s failed: %v", test.name, err)
+			continue
+		}
+		if actual := created.Spec.Template.Spec.ImagePullSecrets; !reflect.DeepEqual(actual, test.expectedSecrets) {
+			t.Errorf("Test: %s failed: expected image pull secrets %v, actual %v", test.name, test.expectedSecrets, actual)
+		}
+	}
+}
+
+func TestPullImageSnapshotter(t *testing.T) {
+	tests := []struct {
+		name                    string
+		containerRuntimeVersion string
+		platform                string
+		expectedCommand         string
+	}{
+		{
+			name:                    "#1 Containerd pulls into the snapshotter",
+			containerRuntimeVersion: "containerd://1.4.3",
+			expectedCommand:         "exec /usr/bin/ctr --address /run/containerd/containerd.sock --namespace k8s.io images pull --snapshotter stargz docker.io/library/nginx:latest > /dev/termination-log 2>&1",
+		},
+		{
+			name:                    "#2 Containerd pulls the platform into the snapshotter",
+			containerRuntimeVersion: "containerd://1.4.3",
+			platform:                "linux/arm64",
+			expectedCommand:         "exec /usr/bin/ctr --address /run/containerd/containerd.sock --namespace k8s.io images pull --platform linux/arm64 --snapshotter stargz docker.io/library/nginx:latest > /dev/termination-log 2>&1",
+		},
+		{
+			name:                    "#3 Snapshotter is ignored for docker runtime",
+			containerRuntimeVersion: "docker://19.3.8",
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := &fakeclientset.Clientset{}
+		var created *batchv1.Job
+		fakekubeclientset.AddReactor("create", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			created = action.(core.CreateAction).GetObject().(*batchv1.Job)
+			return true, created, nil
+		})
+		imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent")
+		iwr := ImageWorkRequest{
+			Image:                   "nginx",
+			Node:                    &node,
+			ContainerRuntimeVersion: test.containerRuntimeVersion,
+			Platform:                test.platform,
+			WorkType:                ImageCacheCreate,
+			Imagecache: &fledgedv1alpha1.ImageCache{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "kube-fledged",
+				},
+				Spec: fledgedv1alpha1.ImageCacheSpec{
+					Snapshotter: "stargz",
 				},
 			},
-			imagepullpolicy: "IfNotPresent",
-			expectError:     false,
+		}
+		if criAgentWorkSupported(iwr, false) {
+			t.Errorf("Test: %s failed: expected pull into the snapshotter not to be done by the CRI agent", test.name)
+		}
+		if _, err := imagemanager.pullImage(context.Background(), iwr); err != nil {
+			t.Errorf("Test: %s failed: %v", test.name, err)
+			continue
+		}
+		container := created.Spec.Template.Spec.Containers[0]
+		if test.expectedCommand == "" {
+			if container.Image != iwr.Image {
+				t.Errorf("Test: %s failed: expected image %s, actual %s", test.name, iwr.Image, container.Image)
+			}
+			continue
+		}
+		if container.Image != imagemanager.dockerClientImage || container.Args[1] != test.expectedCommand {
+			t.Errorf("Test: %s failed: expected command %q, actual %s %q", test.name, test.expectedCommand, container.Image, container.Args)
+		}
+	}
+}
+
+func TestCheckIfImageNeedsToBePulled(t *testing.T) {
+	nodeWithImage := corev1.Node{
+		Status: corev1.NodeStatus{
+			Images: []corev1.ContainerImage{
+				{Names: []string{"docker.io/library/nginx:1.17"}},
+				{Names: []string{"docker.io/library/mynginx:1.17", "docker.io/library/redis:5.0.7", "docker.io/library/redis@sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}},
+			},
+		},
+	}
+	tests := []struct {
+		name            string
+		imagePullPolicy string
+		image           string
+		node            *corev1.Node
+		expectPull      bool
+	}{
+		{
+			name:            "#1 Always pulled",
+			imagePullPolicy: "Always",
+			image:           "nginx:1.17",
+			node:            &nodeWithImage,
+			expectPull:      true,
+		},
+		{
+			name:            "#2 IfNotPresent - Image present",
+			imagePullPolicy: "IfNotPresent",
+			image:           "nginx:1.17",
+			node:            &nodeWithImage,
+			expectPull:      false,
+		},
+		{
+			name:            "#3 IfNotPresent - Image not present",
+			imagePullPolicy: "IfNotPresent",
+			image:           "nginx:1.17",
+			node:            &node,
+			expectPull:      true,
+		},
+		{
+			name:            "#4 Never - Image present",
+			imagePullPolicy: "Never",
+			image:           "nginx:latest",
+			node:            &corev1.Node{Status: corev1.NodeStatus{Images: []corev1.ContainerImage{{Names: []string{"nginx:latest"}}}}},
+			expectPull:      false,
+		},
+		{
+			name:            "#5 Never - Job reports image not present",
+			imagePullPolicy: "Never",
+			image:           "nginx:1.17",
+			node:            &node,
+			expectPull:      true,
+		},
+		{
+			name:            "#6 IfNotPresent - Image with similar name or tag not present",
+			imagePullPolicy: "IfNotPresent",
+			image:           "nginx:1.1",
+			node:            &nodeWithImage,
+			expectPull:      true,
+		},
+		{
+			name:            "#7 IfNotPresent - Image present in other registry",
+			imagePullPolicy: "IfNotPresent",
+			image:           "registry.local:5000/nginx:1.17",
+			node:            &nodeWithImage,
+			expectPull:      true,
+		},
+		{
+			name:            "#8 IfNotPresent - Image present by digest",
+			imagePullPolicy: "IfNotPresent",
+			image:           "redis@sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+			node:            &nodeWithImage,
+			expectPull:      false,
+		},
+		{
+			name:            "#9 IfNotPresent - Image with other digest not present",
+			imagePullPolicy: "IfNotPresent",
+			image:           "redis:5.0.7@sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb",
+			node:            &nodeWithImage,
+			expectPull:      true,
+		},
+		{
+			name:            "#10 IfNotPresent - Image present by fully qualified name",
+			imagePullPolicy: "IfNotPresent",
+			image:           "docker.io/library/mynginx:1.17",
+			node:            &nodeWithImage,
+			expectPull:      false,
+		},
+	}
+	for _, test := range tests {
+		pull, err := checkIfImageNeedsToBePulled(test.imagePullPolicy, test.image, test.node)
+		if err != nil {
+			t.Errorf("Test: %s failed: %v", test.name, err)
+			continue
+		}
+		if pull != test.expectPull {
+			t.Errorf("Test: %s failed: expectPull=%t, actualPull=%t", test.name, test.expectPull, pull)
+		}
+	}
+	job, _ := newImagePullJob(ImageWorkRequest{Image: "nginx:1.17", Node: &node, Imagecache: &fledgedv1alpha1.ImageCache{}}, "Never")
+	if policy := job.Spec.Template.Spec.Containers[0].ImagePullPolicy; policy != corev1.PullNever {
+		t.Errorf("Test failed: expected pull policy Never for the job, actual %s", policy)
+	}
+}
+
+func TestJobResources(t *testing.T) {
+	resources := corev1.ResourceRequirements{
+		Limits: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("100m"),
+			corev1.ResourceMemory: resource.MustParse("64Mi"),
+		},
+	}
+	tests := []struct {
+		name              string
+		jobResources      *corev1.ResourceRequirements
+		expectedResources corev1.ResourceRequirements
+	}{
+		{
+			name:              "#1 Job resources not specified",
+			jobResources:      nil,
+			expectedResources: corev1.ResourceRequirements{},
+		},
+		{
+			name:              "#2 Job resources specified",
+			jobResources:      &resources,
+			expectedResources: resources,
+		},
+	}
+	for _, test := range tests {
+		iwr := ImageWorkRequest{
+			Image: "foo",
+			Node:  &node,
+			Imagecache: &fledgedv1alpha1.ImageCache{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "kube-fledged",
+				},
+				Spec: fledgedv1alpha1.ImageCacheSpec{
+					JobResources: test.jobResources,
+				},
+			},
+		}
+		pulljob, err := newImagePullJob(iwr, "IfNotPresent")
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		deletejob, err := newImageDeleteJob(iwr, "senthilrch/fledged-docker-client:latest")
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		containers := append(pulljob.Spec.Template.Spec.InitContainers, pulljob.Spec.Template.Spec.Containers...)
+		containers = append(containers, deletejob.Spec.Template.Spec.Containers...)
+		for _, container := range containers {
+			if !reflect.DeepEqual(container.Resources, test.expectedResources) {
+				t.Errorf("Test: %s failed: container %s expectedResources=%+v, actualResources=%+v", test.name, container.Name, test.expectedResources, container.Resources)
+			}
+		}
+	}
+}
+
+func TestJobTolerations(t *testing.T) {
+	imagecache := fledgedv1alpha1.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+	}
+	tolerations := []corev1.Toleration{
+		{
+			Key:      "nvidia.com/gpu",
+			Operator: corev1.TolerationOpExists,
+			Effect:   corev1.TaintEffectNoSchedule,
+		},
+	}
+	tests := []struct {
+		name                string
+		tolerations         *[]corev1.Toleration
+		expectedTolerations []corev1.Toleration
+	}{
+		{
+			name:                "#1 Tolerations not specified",
+			tolerations:         nil,
+			expectedTolerations: []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+		},
+		{
+			name:                "#2 Empty tolerations",
+			tolerations:         &[]corev1.Toleration{},
+			expectedTolerations: []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+		},
+		{
+			name:                "#3 Tolerations specified",
+			tolerations:         &tolerations,
+			expectedTolerations: tolerations,
+		},
+	}
+	for _, test := range tests {
+		iwr := ImageWorkRequest{
+			Image:       "foo",
+			Node:        &node,
+			Imagecache:  &imagecache,
+			Tolerations: test.tolerations,
+		}
+		pulljob, err := newImagePullJob(iwr, "IfNotPresent")
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		if !reflect.DeepEqual(pulljob.Spec.Template.Spec.Tolerations, test.expectedTolerations) {
+			t.Errorf("Test: %s failed: expectedTolerations=%+v, actualTolerations=%+v", test.name, test.expectedTolerations, pulljob.Spec.Template.Spec.Tolerations)
+		}
+		iwr.WorkType = ImageCachePurge
+		deletejob, err := newImageDeleteJob(iwr, "senthilrch/fledged-docker-client:latest")
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		if !reflect.DeepEqual(deletejob.Spec.Template.Spec.Tolerations, test.expectedTolerations) {
+			t.Errorf("Test: %s failed: expectedTolerations=%+v, actualTolerations=%+v", test.name, test.expectedTolerations, deletejob.Spec.Template.Spec.Tolerations)
+		}
+	}
+}
+
+func TestJobDeviceResources(t *testing.T) {
+	imagecache := fledgedv1alpha1.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+		Spec: fledgedv1alpha1.ImageCacheSpec{
+			JobResources: &corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")},
+			},
+		},
+	}
+	deviceResources := corev1.ResourceList{"nvidia.com/gpu": resource.MustParse("1"), "example.com/fpga": resource.MustParse("2")}
+	gpuToleration := corev1.Toleration{Key: "nvidia.com/gpu", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule}
+	fpgaToleration := corev1.Toleration{Key: "example.com/fpga", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule}
+	dedicated := corev1.Toleration{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "ml", Effect: corev1.TaintEffectNoSchedule}
+	tests := []struct {
+		name                string
+		deviceResources     *corev1.ResourceList
+		tolerations         *[]corev1.Toleration
+		expectedTolerations []corev1.Toleration
+		expectedRequests    corev1.ResourceList
+		expectedLimits      corev1.ResourceList
+	}{
+		{
+			name:                "#1 Device resources not specified",
+			tolerations:         &[]corev1.Toleration{dedicated},
+			expectedTolerations: []corev1.Toleration{dedicated},
+			expectedRequests:    corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")},
+		},
+		{
+			name:                "#2 Device resources with all taints tolerated",
+			deviceResources:     &deviceResources,
+			expectedTolerations: []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+			expectedRequests:    corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m"), "nvidia.com/gpu": resource.MustParse("1"), "example.com/fpga": resource.MustParse("2")},
+			expectedLimits:      deviceResources,
+		},
+		{
+			name:                "#3 Taints of device resources tolerated in addition to tolerations",
+			deviceResources:     &deviceResources,
+			tolerations:         &[]corev1.Toleration{dedicated},
+			expectedTolerations: []corev1.Toleration{dedicated, fpgaToleration, gpuToleration},
+			expectedRequests:    corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m"), "nvidia.com/gpu": resource.MustParse("1"), "example.com/fpga": resource.MustParse("2")},
+			expectedLimits:      deviceResources,
+		},
+		{
+			name:                "#4 Taint of device resource already tolerated",
+			deviceResources:     &deviceResources,
+			tolerations:         &[]corev1.Toleration{gpuToleration},
+			expectedTolerations: []corev1.Toleration{gpuToleration, fpgaToleration},
+			expectedRequests:    corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m"), "nvidia.com/gpu": resource.MustParse("1"), "example.com/fpga": resource.MustParse("2")},
+			expectedLimits:      deviceResources,
+		},
+	}
+	for _, test := range tests {
+		iwr := ImageWorkRequest{
+			Image:           "foo",
+			Node:            &node,
+			Imagecache:      &imagecache,
+			Tolerations:     test.tolerations,
+			DeviceResources: test.deviceResources,
+		}
+		pulljob, err := newImagePullJob(iwr, "IfNotPresent")
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		setJobDeviceResources(pulljob, iwr)
+		podSpec := pulljob.Spec.Template.Spec
+		if !reflect.DeepEqual(podSpec.Tolerations, test.expectedTolerations) {
+			t.Errorf("Test: %s failed: expectedTolerations=%+v, actualTolerations=%+v", test.name, test.expectedTolerations, podSpec.Tolerations)
+		}
+		if !reflect.DeepEqual(podSpec.Containers[0].Resources.Requests, test.expectedRequests) || !reflect.DeepEqual(podSpec.Containers[0].Resources.Limits, test.expectedLimits) {
+			t.Errorf("Test: %s failed: expectedRequests=%v, expectedLimits=%v, actualResources=%+v", test.name, test.expectedRequests, test.expectedLimits, podSpec.Containers[0].Resources)
+		}
+		// Job resources of the image cache are not modified
+		if imagecache.Spec.JobResources.Limits != nil || len(imagecache.Spec.JobResources.Requests) != 1 {
+			t.Errorf("Test: %s failed: job resources of image cache modified: %+v", test.name, imagecache.Spec.JobResources)
+		}
+		// Device resources are requested only to pull images
+		iwr.WorkType = ImageCachePurge
+		deletejob, err := newImageDeleteJob(iwr, "senthilrch/fledged-docker-client:latest")
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		if _, ok := deletejob.Spec.Template.Spec.Containers[0].Resources.Requests["nvidia.com/gpu"]; ok {
+			t.Errorf("Test: %s failed: device resources requested by delete job", test.name)
+		}
+		if test.tolerations != nil && len(deletejob.Spec.Template.Spec.Tolerations) != len(*test.tolerations) {
+			t.Errorf("Test: %s failed: expectedTolerations=%+v, actualTolerations=%+v", test.name, *test.tolerations, deletejob.Spec.Template.Spec.Tolerations)
+		}
+	}
+}
+
+func TestJobPriorityClassName(t *testing.T) {
+	imagecache := fledgedv1alpha1.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+	}
+	tests := []struct {
+		name              string
+		priorityClassName string
+	}{
+		{
+			name:              "#1 Priority class not specified",
+			priorityClassName: "",
+		},
+		{
+			name:              "#2 Priority class specified",
+			priorityClassName: "imagecache-low",
+		},
+	}
+	for _, test := range tests {
+		iwr := ImageWorkRequest{
+			Image:             "foo",
+			Node:              &node,
+			Imagecache:        &imagecache,
+			PriorityClassName: test.priorityClassName,
+		}
+		pulljob, err := newImagePullJob(iwr, "IfNotPresent")
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		if pulljob.Spec.Template.Spec.PriorityClassName != test.priorityClassName {
+			t.Errorf("Test: %s failed: expectedPriorityClassName=%s, actualPriorityClassName=%s", test.name, test.priorityClassName, pulljob.Spec.Template.Spec.PriorityClassName)
+		}
+		iwr.WorkType = ImageCachePurge
+		deletejob, err := newImageDeleteJob(iwr, "senthilrch/fledged-docker-client:latest")
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		if deletejob.Spec.Template.Spec.PriorityClassName != test.priorityClassName {
+			t.Errorf("Test: %s failed: expectedPriorityClassName=%s, actualPriorityClassName=%s", test.name, test.priorityClassName, deletejob.Spec.Template.Spec.PriorityClassName)
+		}
+	}
+}
+
+func TestJobSecurityContext(t *testing.T) {
+	imagecache := fledgedv1alpha1.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+	}
+	runAsUser, allowPrivilegeEscalation := int64(0), false
+	securityContext := &corev1.SecurityContext{
+		RunAsUser:                &runAsUser,
+		AllowPrivilegeEscalation: &allowPrivilegeEscalation,
+		Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+	}
+	podSecurityContext := &corev1.PodSecurityContext{SupplementalGroups: []int64{999}}
+	tests := []struct {
+		name               string
+		securityContext    *corev1.SecurityContext
+		podSecurityContext *corev1.PodSecurityContext
+	}{
+		{
+			name: "#1 Security context not specified",
+		},
+		{
+			name:            "#2 Container security context specified",
+			securityContext: securityContext,
+		},
+		{
+			name:               "#3 Container and pod security context specified",
+			securityContext:    securityContext,
+			podSecurityContext: podSecurityContext,
+		},
+	}
+	for _, test := range tests {
+		iwr := ImageWorkRequest{
+			Image:                   "foo",
+			Node:                    &node,
+			ContainerRuntimeVersion: "containerd://1.3.3",
+			Imagecache:              &imagecache,
+			SecurityContext:         test.securityContext,
+			PodSecurityContext:      test.podSecurityContext,
+		}
+		pulljob, err := newImagePullJob(iwr, "IfNotPresent")
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		iwr.WorkType = ImageCachePurge
+		deletejob, err := newImageDeleteJob(iwr, "senthilrch/fledged-docker-client:latest")
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		for _, job := range []*batchv1.Job{pulljob, deletejob} {
+			setJobSecurityContext(job, iwr)
+			podSpec := job.Spec.Template.Spec
+			if !reflect.DeepEqual(podSpec.SecurityContext, test.podSecurityContext) {
+				t.Errorf("Test: %s failed: expectedPodSecurityContext=%+v, actualPodSecurityContext=%+v", test.name, test.podSecurityContext, podSpec.SecurityContext)
+			}
+			for _, c := range append(append([]corev1.Container{}, podSpec.InitContainers...), podSpec.Containers...) {
+				if !reflect.DeepEqual(c.SecurityContext, test.securityContext) {
+					t.Errorf("Test: %s failed: container %s: expectedSecurityContext=%+v, actualSecurityContext=%+v", test.name, c.Name, test.securityContext, c.SecurityContext)
+				}
+			}
+		}
+	}
+}
+
+func TestJobServiceAccountName(t *testing.T) {
+	imagecache := fledgedv1alpha1.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+	}
+	tests := []struct {
+		name               string
+		serviceAccountName string
+		pullJobContainer   *fledgedv1alpha1.PullJobContainer
+	}{
+		{
+			name:               "#1 Service account not specified",
+			serviceAccountName: "",
+		},
+		{
+			name:               "#2 Service account specified",
+			serviceAccountName: "ecr-puller",
+		},
+		{
+			name:               "#3 Service account specified with overridden pull job container",
+			serviceAccountName: "ecr-puller",
+			pullJobContainer:   &fledgedv1alpha1.PullJobContainer{Image: "mirror-puller:v1"},
+		},
+	}
+	for _, test := range tests {
+		imagecache.Spec.PullJobContainer = test.pullJobContainer
+		iwr := ImageWorkRequest{
+			Image:              "foo",
+			Node:               &node,
+			Imagecache:         &imagecache,
+			ServiceAccountName: test.serviceAccountName,
+		}
+		pulljob, err := newImagePullJob(iwr, "IfNotPresent")
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		if pulljob.Spec.Template.Spec.ServiceAccountName != test.serviceAccountName {
+			t.Errorf("Test: %s failed: expectedServiceAccountName=%s, actualServiceAccountName=%s", test.name, test.serviceAccountName, pulljob.Spec.Template.Spec.ServiceAccountName)
+		}
+		iwr.WorkType = ImageCachePurge
+		deletejob, err := newImageDeleteJob(iwr, "senthilrch/fledged-docker-client:latest")
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		if deletejob.Spec.Template.Spec.ServiceAccountName != "" {
+			t.Errorf("Test: %s failed: expectedServiceAccountName=, actualServiceAccountName=%s", test.name, deletejob.Spec.Template.Spec.ServiceAccountName)
+		}
+	}
+}
+
+func TestJobDNSConfig(t *testing.T) {
+	imagecache := fledgedv1alpha1.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+	}
+	dnsConfig := &corev1.PodDNSConfig{
+		Nameservers: []string{"10.0.0.10"},
+		Searches:    []string{"corp.internal"},
+	}
+	tests := []struct {
+		name             string
+		dnsPolicy        corev1.DNSPolicy
+		dnsConfig        *corev1.PodDNSConfig
+		pullJobContainer *fledgedv1alpha1.PullJobContainer
+	}{
+		{
+			name: "#1 DNS policy and config not specified",
+		},
+		{
+			name:      "#2 DNS policy and config specified",
+			dnsPolicy: corev1.DNSNone,
+			dnsConfig: dnsConfig,
+		},
+		{
+			name:             "#3 DNS policy and config specified with overridden pull job container",
+			dnsPolicy:        corev1.DNSNone,
+			dnsConfig:        dnsConfig,
+			pullJobContainer: &fledgedv1alpha1.PullJobContainer{Image: "mirror-puller:v1"},
+		},
+	}
+	for _, test := range tests {
+		imagecache.Spec.PullJobContainer = test.pullJobContainer
+		iwr := ImageWorkRequest{
+			Image:      "foo",
+			Node:       &node,
+			Imagecache: &imagecache,
+			DNSPolicy:  test.dnsPolicy,
+			DNSConfig:  test.dnsConfig,
+		}
+		pulljob, err := newImagePullJob(iwr, "IfNotPresent")
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		podSpec := pulljob.Spec.Template.Spec
+		if podSpec.DNSPolicy != test.dnsPolicy {
+			t.Errorf("Test: %s failed: expectedDNSPolicy=%s, actualDNSPolicy=%s", test.name, test.dnsPolicy, podSpec.DNSPolicy)
+		}
+		if !reflect.DeepEqual(podSpec.DNSConfig, test.dnsConfig) {
+			t.Errorf("Test: %s failed: expectedDNSConfig=%+v, actualDNSConfig=%+v", test.name, test.dnsConfig, podSpec.DNSConfig)
+		}
+		iwr.WorkType = ImageCachePurge
+		deletejob, err := newImageDeleteJob(iwr, "senthilrch/fledged-docker-client:latest")
+		if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+			continue
+		}
+		if deletejob.Spec.Template.Spec.DNSPolicy != "" || deletejob.Spec.Template.Spec.DNSConfig != nil {
+			t.Errorf("Test: %s failed: expected default DNS policy and config of delete job, actual %s, %+v", test.name,
+				deletejob.Spec.Template.Spec.DNSPolicy, deletejob.Spec.Template.Spec.DNSConfig)
+		}
+	}
+}
+
+func TestJobLimits(t *testing.T) {
+	tests := []struct {
+		name                            string
+		workType                        WorkType
+		pullDeadline                    *metav1.Duration
+		jobBackoffLimit                 int32
+		jobTTLAfterFinished             time.Duration
+		expectedActiveDeadlineSeconds   int64
+		expectedTTLSecondsAfterFinished *int32
+	}{
+		{
+			name:                          "#1 Pull job deadline of image manager",
+			workType:                      ImageCacheCreate,
+			expectedActiveDeadlineSeconds: 300,
+		},
+		{
+			name:                          "#2 Pull job deadline of image list, retried by job",
+			workType:                      ImageCacheCreate,
+			pullDeadline:                  &metav1.Duration{Duration: 90500 * time.Millisecond},
+			jobBackoffLimit:               2,
+			expectedActiveDeadlineSeconds: 91,
+		},
+		{
+			name:                          "#3 Delete job deadline of image manager",
+			workType:                      ImageCachePurge,
+			pullDeadline:                  &metav1.Duration{Duration: 90 * time.Second},
+			jobBackoffLimit:               1,
+			expectedActiveDeadlineSeconds: 300,
+		},
+		{
+			name:                            "#4 Pull job TTL after finished",
+			workType:                        ImageCacheCreate,
+			jobTTLAfterFinished:             90500 * time.Millisecond,
+			expectedActiveDeadlineSeconds:   300,
+			expectedTTLSecondsAfterFinished: func() *int32 { ttl := int32(91); return &ttl }(),
+		},
+		{
+			name:                            "#5 Delete job TTL after finished",
+			workType:                        ImageCachePurge,
+			jobTTLAfterFinished:             time.Hour,
+			expectedActiveDeadlineSeconds:   300,
+			expectedTTLSecondsAfterFinished: func() *int32 { ttl := int32(3600); return &ttl }(),
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := &fakeclientset.Clientset{}
+		var created *batchv1.Job
+		fakekubeclientset.AddReactor("create", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			created = action.(core.CreateAction).GetObject().(*batchv1.Job)
+			return true, created, nil
+		})
+		imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent")
+		imagemanager.imagePullDeadlineDuration = 5 * time.Minute
+		imagemanager.jobBackoffLimit = test.jobBackoffLimit
+		imagemanager.jobTTLAfterFinished = test.jobTTLAfterFinished
+		iwr := ImageWorkRequest{
+			Image:                   "nginx:1.17",
+			Node:                    &node,
+			ContainerRuntimeVersion: "containerd://1.3.3",
+			WorkType:                test.workType,
+			Imagecache: &fledgedv1alpha1.ImageCache{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "kube-fledged",
+				},
+			},
+			PullDeadline: test.pullDeadline,
+		}
+		var err error
+		if test.workType == ImageCachePurge {
+			_, err = imagemanager.deleteImage(context.Background(), iwr)
+		} else {
+			_, err = imagemanager.pullImage(context.Background(), iwr)
+		}
+		if err != nil {
+			t.Errorf("Test: %s failed: %v", test.name, err)
+			continue
+		}
+		if *created.Spec.ActiveDeadlineSeconds != test.expectedActiveDeadlineSeconds || *created.Spec.BackoffLimit != test.jobBackoffLimit {
+			t.Errorf("Test: %s failed: expected activeDeadlineSeconds=%d, backoffLimit=%d, actual %d, %d", test.name,
+				test.expectedActiveDeadlineSeconds, test.jobBackoffLimit, *created.Spec.ActiveDeadlineSeconds, *created.Spec.BackoffLimit)
+		}
+		if !reflect.DeepEqual(created.Spec.TTLSecondsAfterFinished, test.expectedTTLSecondsAfterFinished) {
+			t.Errorf("Test: %s failed: expected ttlSecondsAfterFinished=%v, actual %v", test.name,
+				test.expectedTTLSecondsAfterFinished, created.Spec.TTLSecondsAfterFinished)
+		}
+	}
+}
+
+func TestJobRunPolicy(t *testing.T) {
+	int32Ptr := func(i int32) *int32 { return &i }
+	tests := []struct {
+		name                string
+		workType            WorkType
+		restartPolicy       corev1.RestartPolicy
+		completions         int32
+		parallelism         int32
+		expectedCompletions *int32
+		expectedParallelism *int32
+	}{
+		{
+			name:          "#1 Pull job with defaults",
+			workType:      ImageCacheCreate,
+			restartPolicy: corev1.RestartPolicyNever,
+			completions:   1,
+			parallelism:   1,
+		},
+		{
+			name:          "#2 Pull job restarted on failure",
+			workType:      ImageCacheCreate,
+			restartPolicy: corev1.RestartPolicyOnFailure,
+			completions:   1,
+			parallelism:   1,
+		},
+		{
+			name:                "#3 Pull job with completions",
+			workType:            ImageCacheCreate,
+			restartPolicy:       corev1.RestartPolicyOnFailure,
+			completions:         3,
+			parallelism:         1,
+			expectedCompletions: int32Ptr(3),
+		},
+		{
+			name:                "#4 Delete job with completions and parallelism",
+			workType:            ImageCachePurge,
+			restartPolicy:       corev1.RestartPolicyNever,
+			completions:         2,
+			parallelism:         2,
+			expectedCompletions: int32Ptr(2),
+			expectedParallelism: int32Ptr(2),
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := &fakeclientset.Clientset{}
+		var created *batchv1.Job
+		fakekubeclientset.AddReactor("create", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			created = action.(core.CreateAction).GetObject().(*batchv1.Job)
+			return true, created, nil
+		})
+		imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent")
+		imagemanager.jobRestartPolicy = test.restartPolicy
+		imagemanager.jobCompletions = test.completions
+		imagemanager.jobParallelism = test.parallelism
+		iwr := ImageWorkRequest{
+			Image:                   "nginx:1.17",
+			Node:                    &node,
+			ContainerRuntimeVersion: "containerd://1.3.3",
+			WorkType:                test.workType,
+			Imagecache: &fledgedv1alpha1.ImageCache{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "kube-fledged",
+				},
+			},
+		}
+		var err error
+		if test.workType == ImageCachePurge {
+			_, err = imagemanager.deleteImage(context.Background(), iwr)
+		} else {
+			_, err = imagemanager.pullImage(context.Background(), iwr)
+		}
+		if err != nil {
+			t.Errorf("Test: %s failed: %v", test.name, err)
+			continue
+		}
+		if created.Spec.Template.Spec.RestartPolicy != test.restartPolicy {
+			t.Errorf("Test: %s failed: expected restartPolicy=%s, actual %s", test.name, test.restartPolicy, created.Spec.Template.Spec.RestartPolicy)
+		}
+		if !reflect.DeepEqual(created.Spec.Completions, test.expectedCompletions) || !reflect.DeepEqual(created.Spec.Parallelism, test.expectedParallelism) {
+			t.Errorf("Test: %s failed: expected completions=%v, parallelism=%v, actual %v, %v", test.name,
+				test.expectedCompletions, test.expectedParallelism, created.Spec.Completions, created.Spec.Parallelism)
+		}
+	}
+}
+
+func TestValidateJobRunPolicy(t *testing.T) {
+	tests := []struct {
+		name          string
+		restartPolicy string
+		completions   int
+		parallelism   int
+		expectedErr   string
+	}{
+		{name: "#1 Defaults", restartPolicy: "Never", completions: 1, parallelism: 1},
+		{name: "#2 Restarted on failure", restartPolicy: "OnFailure", completions: 1, parallelism: 1},
+		{name: "#3 Completions in sequence", restartPolicy: "OnFailure", completions: 3, parallelism: 1},
+		{name: "#4 Completions in parallel", restartPolicy: "Never", completions: 3, parallelism: 3},
+		{name: "#5 Always restarted", restartPolicy: "Always", completions: 1, parallelism: 1, expectedErr: "invalid restart policy \"Always\": possible values are 'Never' and 'OnFailure'"},
+		{name: "#6 No completions", restartPolicy: "Never", completions: 0, parallelism: 1, expectedErr: "invalid completions 0: must be at least 1"},
+		{name: "#7 Parallelism above completions", restartPolicy: "Never", completions: 2, parallelism: 3, expectedErr: "invalid parallelism 3: must be between 1 and the completions 2"},
+		{name: "#8 No parallelism", restartPolicy: "Never", completions: 1, parallelism: 0, expectedErr: "invalid parallelism 0: must be between 1 and the completions 1"},
+	}
+	for _, test := range tests {
+		err := ValidateJobRunPolicy(test.restartPolicy, test.completions, test.parallelism)
+		if (err == nil && test.expectedErr != "") || (err != nil && err.Error() != test.expectedErr) {
+			t.Errorf("Test: %s failed: expected error %q, actual %v", test.name, test.expectedErr, err)
+		}
+	}
+}
+
+func TestPropagateMetadata(t *testing.T) {
+	tests := []struct {
+		name                string
+		workType            WorkType
+		expectedLabels      map[string]string
+		expectedAnnotations map[string]string
+	}{
+		{
+			name:     "#1 Pull job",
+			workType: ImageCacheCreate,
+			expectedLabels: map[string]string{
+				"app":        "imagecache",
+				"imagecache": "foo",
+				"controller": controllerAgentName,
+				"team":       "payments",
+			},
+			expectedAnnotations: map[string]string{"billing/cost-center": "cc-42"},
+		},
+		{
+			name:     "#2 Delete job",
+			workType: ImageCachePurge,
+			expectedLabels: map[string]string{
+				"app":        "imagecache",
+				"imagecache": "foo",
+				"controller": controllerAgentName,
+				"team":       "payments",
+			},
+			expectedAnnotations: map[string]string{"billing/cost-center": "cc-42"},
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := &fakeclientset.Clientset{}
+		var created *batchv1.Job
+		fakekubeclientset.AddReactor("create", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			created = action.(core.CreateAction).GetObject().(*batchv1.Job)
+			return true, created, nil
+		})
+		imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent")
+		imagemanager.propagatedLabels = []string{"team", "app", "controller", "missing"}
+		imagemanager.propagatedAnnotations = []string{"billing/cost-center"}
+		iwr := ImageWorkRequest{
+			Image:                   "nginx:1.17",
+			Node:                    &node,
+			ContainerRuntimeVersion: "containerd://1.3.3",
+			WorkType:                test.workType,
+			Imagecache: &fledgedv1alpha1.ImageCache{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "kube-fledged",
+					Labels: map[string]string{
+						"team":       "payments",
+						"app":        "checkout",
+						"controller": "other",
+						"unlisted":   "value",
+					},
+					Annotations: map[string]string{
+						"billing/cost-center": "cc-42",
+						"unlisted":            "value",
+					},
+				},
+			},
+		}
+		var err error
+		if test.workType == ImageCachePurge {
+			_, err = imagemanager.deleteImage(context.Background(), iwr)
+		} else {
+			_, err = imagemanager.pullImage(context.Background(), iwr)
+		}
+		if err != nil {
+			t.Errorf("Test: %s failed: %v", test.name, err)
+			continue
+		}
+		// The job is also annotated with its image work
+		jobAnnotations := map[string]string{imageWorkAnnotationKey: imageWorkKey(iwr)}
+		for k, v := range test.expectedAnnotations {
+			jobAnnotations[k] = v
+		}
+		for i, meta := range []metav1.ObjectMeta{created.ObjectMeta, created.Spec.Template.ObjectMeta} {
+			if !reflect.DeepEqual(meta.Labels, test.expectedLabels) {
+				t.Errorf("Test: %s failed: expected labels %v, actual %v", test.name, test.expectedLabels, meta.Labels)
+			}
+			if i == 0 && !reflect.DeepEqual(meta.Annotations, jobAnnotations) {
+				t.Errorf("Test: %s failed: expected job annotations %v, actual %v", test.name, jobAnnotations, meta.Annotations)
+			}
+			if i == 1 && !reflect.DeepEqual(meta.Annotations, test.expectedAnnotations) {
+				t.Errorf("Test: %s failed: expected annotations %v, actual %v", test.name, test.expectedAnnotations, meta.Annotations)
+			}
+		}
+	}
+}
+
+func TestJobOwnerReference(t *testing.T) {
+	imagecache := &fledgedv1alpha1.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+			UID:       "6e1f6d3a-4b1c-4f3e-9d8a-2f1b7c9e0a11",
+		},
+	}
+	controller, blockOwnerDeletion := true, true
+	expectedOwnerReferences := []metav1.OwnerReference{
+		{
+			APIVersion:         "kubefledged.k8s.io/v1alpha1",
+			Kind:               "ImageCache",
+			Name:               "foo",
+			UID:                "6e1f6d3a-4b1c-4f3e-9d8a-2f1b7c9e0a11",
+			Controller:         &controller,
+			BlockOwnerDeletion: &blockOwnerDeletion,
+		},
+	}
+	for _, workType := range []WorkType{ImageCacheCreate, ImageCachePurge} {
+		fakekubeclientset := &fakeclientset.Clientset{}
+		var created *batchv1.Job
+		fakekubeclientset.AddReactor("create", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			created = action.(core.CreateAction).GetObject().(*batchv1.Job)
+			return true, created, nil
+		})
+		imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent")
+		iwr := ImageWorkRequest{
+			Image:                   "nginx:1.17",
+			Node:                    &node,
+			ContainerRuntimeVersion: "containerd://1.3.3",
+			WorkType:                workType,
+			Imagecache:              imagecache,
+		}
+		var err error
+		if workType == ImageCachePurge {
+			_, err = imagemanager.deleteImage(context.Background(), iwr)
+		} else {
+			_, err = imagemanager.pullImage(context.Background(), iwr)
+		}
+		if err != nil {
+			t.Errorf("Test: %s job failed: %v", workType, err)
+			continue
+		}
+		if !reflect.DeepEqual(created.OwnerReferences, expectedOwnerReferences) {
+			t.Errorf("Test: %s job failed: expected owner references %+v, actual %+v", workType, expectedOwnerReferences, created.OwnerReferences)
+		}
+	}
+}
+
+func TestStatusHandler(t *testing.T) {
+	imagemanager, _ := newTestImageManager(&fakeclientset.Clientset{}, "IfNotPresent")
+	imagecache := &fledgedv1alpha1.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+	}
+	jobCreationTime := time.Date(2020, time.February, 14, 10, 31, 2, 0, time.UTC)
+	imagemanager.imageworkstatus["foo-abcde"] = ImageWorkResult{
+		ImageWorkRequest: ImageWorkRequest{Image: "redis:5", Node: &node, WorkType: ImageCacheCreate, Imagecache: imagecache},
+		Status:           ImageWorkResultStatusJobCreated,
+		JobCreationTime:  jobCreationTime,
+		PodName:          "foo-abcde-xyz12",
+	}
+	imagemanager.imageworkstatus[fakeJobPrefix+"fghij"] = ImageWorkResult{
+		ImageWorkRequest: ImageWorkRequest{Image: "nginx:1.17", Node: &node, WorkType: ImageCacheCreate, Imagecache: imagecache},
+		Status:           ImageWorkResultStatusAlreadyPulled,
+	}
+	tests := []struct {
+		name           string
+		method         string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "#1: Snapshot of image work",
+			method:         http.MethodGet,
+			expectedStatus: http.StatusOK,
+			expectedBody: `[{"imageCache":"kube-fledged/foo","image":"nginx:1.17","node":"bar","workType":"create","status":"alreadypulled"},` +
+				`{"imageCache":"kube-fledged/foo","image":"redis:5","node":"bar","workType":"create","status":"jobcreated","job":"foo-abcde","pod":"foo-abcde-xyz12","jobCreationTime":"2020-02-14T10:31:02Z"}]`,
+		},
+		{
+			name:           "#2: Method not allowed",
+			method:         http.MethodPost,
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+	}
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		imagemanager.StatusHandler().ServeHTTP(rec, httptest.NewRequest(test.method, "/status", nil))
+		if rec.Code != test.expectedStatus {
+			t.Errorf("Test: %s failed: expected status %d, actual %d", test.name, test.expectedStatus, rec.Code)
+			continue
+		}
+		if test.expectedBody == "" {
+			continue
+		}
+		body := struct {
+			Items json.RawMessage `json:"items"`
+		}{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Errorf("Test: %s failed: %v", test.name, err)
+			continue
+		}
+		if string(body.Items) != test.expectedBody {
+			t.Errorf("Test: %s failed: expected items %s, actual %s", test.name, test.expectedBody, string(body.Items))
+		}
+	}
+}
+
+func TestHandlePodStatusChangeJobBackoff(t *testing.T) {
+	failedPod := func(name string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: fledgedNameSpace,
+				Labels:    map[string]string{"job-name": "fakejob"},
+			},
+			Status: corev1.PodStatus{
+				Phase: corev1.PodFailed,
+			},
+		}
+	}
+	tests := []struct {
+		name           string
+		failedPods     int
+		expectedStatus string
+	}{
+		{
+			name:           "#1: Failed pod retried by job",
+			failedPods:     1,
+			expectedStatus: ImageWorkResultStatusJobCreated,
+		},
+		{
+			name:           "#2: Backoff limit of job reached",
+			failedPods:     2,
+			expectedStatus: ImageWorkResultStatusFailed,
+		},
+	}
+	for _, test := range tests {
+		imagemanager, podInformer := newTestImageManager(&fakeclientset.Clientset{}, "IfNotPresent")
+		imagemanager.jobBackoffLimit = 1
+		imagemanager.imageworkstatus["fakejob"] = ImageWorkResult{
+			Status: ImageWorkResultStatusJobCreated,
+			ImageWorkRequest: ImageWorkRequest{
+				WorkType: ImageCacheCreate,
+				Node:     &node,
+			},
+		}
+		var pod *corev1.Pod
+		for i := 0; i < test.failedPods; i++ {
+			pod = failedPod(fmt.Sprintf("fakejob-%d", i))
+			podInformer.Informer().GetIndexer().Add(pod)
+		}
+		imagemanager.handlePodStatusChange(pod)
+		if status := imagemanager.imageworkstatus["fakejob"].Status; status != test.expectedStatus {
+			t.Errorf("Test: %s failed: expectedWorkResult=%s, actualWorkResult=%s", test.name, test.expectedStatus, status)
+		}
+	}
+}
+
+func TestHandlePodStatusChange(t *testing.T) {
+	tests := []struct {
+		name             string
+		worktype         WorkType
+		pod              corev1.Pod
+		expectedReason   string
+		expectedMessage  string
+		expectedCategory fledgedv1alpha1.FailureCategory
+	}{
+		{
+			name:     "#1: Create - Pod succeeded",
+			worktype: ImageCacheCreate,
+			pod: corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   "fakejob-abcde",
+					Labels: map[string]string{"job-name": "fakejob"},
+				},
+				Status: corev1.PodStatus{
+					Phase: corev1.PodSucceeded,
+				},
+			},
+		},
+		{
+			name:     "#2: Purge - Pod succeeded",
+			worktype: ImageCachePurge,
+			pod: corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{"job-name": "fakejob"},
+				},
+				Status: corev1.PodStatus{
+					Phase: corev1.PodSucceeded,
+				},
+			},
+		},
+		{
+			name:     "#3: Create - Pod failed",
+			worktype: ImageCacheCreate,
+			pod: corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   "fakejob-fghij",
+					Labels: map[string]string{"job-name": "fakejob"},
+				},
+				Status: corev1.PodStatus{
+					Phase: corev1.PodFailed,
+					ContainerStatuses: []corev1.ContainerStatus{
+						{
+							State: corev1.ContainerState{
+								Terminated: &corev1.ContainerStateTerminated{
+									Reason:  "fakereason",
+									Message: "fakemessage",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:     "#4: Create - Init container failed",
+			worktype: ImageCacheCreate,
+			pod: corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{"job-name": "fakejob"},
+				},
+				Status: corev1.PodStatus{
+					Phase: corev1.PodFailed,
+					InitContainerStatuses: []corev1.ContainerStatus{
+						{
+							Name: "busybox",
+							State: corev1.ContainerState{
+								Terminated: &corev1.ContainerStateTerminated{
+									ExitCode: 1,
+									Reason:   "Error",
+									Message:  "cp: can't create '/tmp/bin/echo': Permission denied",
+								},
+							},
+						},
+					},
+				},
+			},
+			expectedReason:   "Error",
+			expectedMessage:  "cp: can't create '/tmp/bin/echo': Permission denied",
+			expectedCategory: fledgedv1alpha1.FailureCategoryUnknown,
+		},
+		{
+			name:     "#5: Purge - Pod failed",
+			worktype: ImageCachePurge,
+			pod: corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{"job-name": "fakejob"},
+				},
+				Status: corev1.PodStatus{
+					Phase: corev1.PodFailed,
+					ContainerStatuses: []corev1.ContainerStatus{
+						{
+							State: corev1.ContainerState{
+								Terminated: &corev1.ContainerStateTerminated{
+									Reason:  "fakereason",
+									Message: "fakemessage",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:     "#6: Create - Image not present with Never policy",
+			worktype: ImageCacheCreate,
+			pod: corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{"job-name": "fakejob"},
+				},
+				Status: corev1.PodStatus{
+					Phase: corev1.PodPending,
+					ContainerStatuses: []corev1.ContainerStatus{
+						{
+							Name: "imagepuller",
+							State: corev1.ContainerState{
+								Waiting: &corev1.ContainerStateWaiting{
+									Reason:  "ErrImageNeverPull",
+									Message: "Container image \"nginx:1.17\" is not present with pull policy of Never",
+								},
+							},
+						},
+					},
+				},
+			},
+			expectedReason:   "ErrImageNeverPull",
+			expectedMessage:  "Container image \"nginx:1.17\" is not present with pull policy of Never",
+			expectedCategory: fledgedv1alpha1.FailureCategoryNotFound,
+		},
+		{
+			name:     "#7: Create - Image pull failed by kubelet",
+			worktype: ImageCacheCreate,
+			pod: corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{"job-name": "fakejob"},
+				},
+				Status: corev1.PodStatus{
+					Phase: corev1.PodPending,
+					ContainerStatuses: []corev1.ContainerStatus{
+						{
+							Name: "imagepuller",
+							State: corev1.ContainerState{
+								Waiting: &corev1.ContainerStateWaiting{
+									Reason:  "ErrImagePull",
+									Message: "rpc error: code = NotFound desc = failed to pull and unpack image \"docker.io/library/nginx:1.99\"",
+								},
+							},
+						},
+					},
+				},
+			},
+			expectedReason:   "ErrImagePull",
+			expectedMessage:  "rpc error: code = NotFound desc = failed to pull and unpack image \"docker.io/library/nginx:1.99\"",
+			expectedCategory: fledgedv1alpha1.FailureCategoryNotFound,
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := &fakeclientset.Clientset{}
+		imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent")
+		imagemanager.imageworkstatus[test.pod.Labels["job-name"]] = ImageWorkResult{
+			Status: ImageWorkResultStatusJobCreated,
+			ImageWorkRequest: ImageWorkRequest{
+				WorkType: test.worktype,
+				Node:     &node,
+			},
+		}
+		operation := metrics.OperationPull
+		if test.worktype == ImageCachePurge {
+			operation = metrics.OperationPurge
+		}
+		failed := test.pod.Status.Phase == corev1.PodFailed || imageNeverPulled(&test.pod) || imagePullErrored(&test.pod)
+		status := ImageWorkResultStatusSucceeded
+		if failed {
+			status = ImageWorkResultStatusFailed
+		}
+		observedResults := testutil.ToFloat64(metrics.ImageWorkResults.WithLabelValues(operation, status))
+		observedFailures := testutil.ToFloat64(metrics.ImageWorkFailures.WithLabelValues(operation, string(test.expectedCategory)))
+		imagemanager.handlePodStatusChange(&test.pod)
+
+		if testutil.ToFloat64(metrics.ImageWorkResults.WithLabelValues(operation, status)) != observedResults+1 {
+			t.Errorf("Test: %s failed: expected %s/%s image work results metric to be incremented", test.name, operation, status)
+		}
+		if podName := imagemanager.imageworkstatus[test.pod.Labels["job-name"]].PodName; podName != test.pod.Name {
+			t.Errorf("Test: %s failed: expectedPodName=%s, actualPodName=%s", test.name, test.pod.Name, podName)
+		}
+		if test.pod.Status.Phase == corev1.PodSucceeded {
+			if !(imagemanager.imageworkstatus[test.pod.Labels["job-name"]].Status == ImageWorkResultStatusSucceeded) {
+				t.Errorf("Test: %s failed: expectedWorkResult=%s, actualWorkResult=%s", test.name, ImageWorkResultStatusSucceeded, imagemanager.imageworkstatus[test.pod.Labels["job-name"]].Status)
+			}
+		}
+		if failed {
+			if !(imagemanager.imageworkstatus[test.pod.Labels["job-name"]].Status == ImageWorkResultStatusFailed) {
+				t.Errorf("Test: %s failed: expectedWorkResult=%s, actualWorkResult=%s", test.name, ImageWorkResultStatusFailed, imagemanager.imageworkstatus[test.pod.Labels["job-name"]].Status)
+			}
+			iwres := imagemanager.imageworkstatus[test.pod.Labels["job-name"]]
+			if test.expectedReason != "" && (iwres.Reason != test.expectedReason || iwres.Message != test.expectedMessage) {
+				t.Errorf("Test: %s failed: expected %s/%s, actual %s/%s", test.name, test.expectedReason, test.expectedMessage, iwres.Reason, iwres.Message)
+			}
+			if test.expectedCategory != "" {
+				if iwres.FailureCategory != test.expectedCategory {
+					t.Errorf("Test: %s failed: expected failure category %s, actual %s", test.name, test.expectedCategory, iwres.FailureCategory)
+				}
+				if testutil.ToFloat64(metrics.ImageWorkFailures.WithLabelValues(operation, string(test.expectedCategory))) != observedFailures+1 {
+					t.Errorf("Test: %s failed: expected %s/%s image work failures metric to be incremented", test.name, operation, test.expectedCategory)
+				}
+			}
+		}
+	}
+}
+
+func TestHandlePodStatusChangeFinalResult(t *testing.T) {
+	imagemanager, _ := newTestImageManager(&fakeclientset.Clientset{}, "IfNotPresent")
+	imagemanager.imageworkstatus["fakejob"] = ImageWorkResult{
+		Status: ImageWorkResultStatusFailed,
+		Reason: "DeadlineExceeded",
+		ImageWorkRequest: ImageWorkRequest{
+			WorkType: ImageCacheCreate,
+			Node:     &node,
+		},
+	}
+	observedResults := testutil.ToFloat64(metrics.ImageWorkResults.WithLabelValues(metrics.OperationPull, ImageWorkResultStatusSucceeded))
+	imagemanager.handlePodStatusChange(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"job-name": "fakejob"}},
+		Status:     corev1.PodStatus{Phase: corev1.PodSucceeded},
+	})
+	if iwres := imagemanager.imageworkstatus["fakejob"]; iwres.Status != ImageWorkResultStatusFailed || iwres.Reason != "DeadlineExceeded" {
+		t.Errorf("Test failed: expected final result to be retained, actual %s/%s", iwres.Status, iwres.Reason)
+	}
+	if testutil.ToFloat64(metrics.ImageWorkResults.WithLabelValues(metrics.OperationPull, ImageWorkResultStatusSucceeded)) != observedResults {
+		t.Errorf("Test failed: expected image work results metric not to be incremented")
+	}
+}
+
+func TestHandlePodStatusChangeDuplicateEvents(t *testing.T) {
+	imagecache := fledgedv1alpha1.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+	}
+	tests := []struct {
+		name              string
+		phase             corev1.PodPhase
+		containerStatuses []corev1.ContainerStatus
+		expectedStatus    string
+		expectedRequeues  int
+	}{
+		{
+			name:           "#1: Pod succeeded",
+			phase:          corev1.PodSucceeded,
+			expectedStatus: ImageWorkResultStatusSucceeded,
+		},
+		{
+			name:             "#2: Pod failed and retried",
+			phase:            corev1.PodFailed,
+			expectedStatus:   ImageWorkResultStatusRetrying,
+			expectedRequeues: 1,
+		},
+		{
+			name:  "#3: Image pull failed by kubelet and retried",
+			phase: corev1.PodPending,
+			containerStatuses: []corev1.ContainerStatus{
+				{Name: "imagepuller", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff"}}},
+			},
+			expectedStatus:   ImageWorkResultStatusRetrying,
+			expectedRequeues: 1,
+		},
+	}
+	for _, test := range tests {
+		imagemanager, _ := newTestImageManager(&fakeclientset.Clientset{}, "IfNotPresent")
+		imagemanager.maxRetries = 3
+		iwr := ImageWorkRequest{Image: "foo", Node: &node, WorkType: ImageCacheCreate, Imagecache: &imagecache}
+		imagemanager.imageworkstatus["fakejob"] = ImageWorkResult{Status: ImageWorkResultStatusJobCreated, ImageWorkRequest: iwr}
+		observedResults := testutil.ToFloat64(metrics.ImageWorkResults.WithLabelValues(metrics.OperationPull, test.expectedStatus))
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "fakepod", Labels: map[string]string{"job-name": "fakejob"}},
+			Status:     corev1.PodStatus{Phase: test.phase, ContainerStatuses: test.containerStatuses},
+		}
+		imagemanager.handlePodStatusChange(pod)
+		imagemanager.handlePodStatusChange(pod.DeepCopy())
+		if iwres := imagemanager.imageworkstatus["fakejob"]; iwres.Status != test.expectedStatus {
+			t.Errorf("Test: %s failed: expectedStatus=%s, actualStatus=%s", test.name, test.expectedStatus, iwres.Status)
+		}
+		if requeues := imagemanager.imageworkqueue.NumRequeues(iwr); requeues != test.expectedRequeues {
+			t.Errorf("Test: %s failed: expectedRequeues=%d, actualRequeues=%d", test.name, test.expectedRequeues, requeues)
+		}
+		expectedResults := observedResults
+		if test.expectedStatus != ImageWorkResultStatusRetrying {
+			expectedResults++
+		}
+		if results := testutil.ToFloat64(metrics.ImageWorkResults.WithLabelValues(metrics.OperationPull, test.expectedStatus)); results != expectedResults {
+			t.Errorf("Test: %s failed: expected image work results metric %v, actual %v", test.name, expectedResults, results)
+		}
+		if events := len(imagemanager.recorder.(*record.FakeRecorder).Events); events != 1 {
+			t.Errorf("Test: %s failed: expected 1 event, actual %d", test.name, events)
+		}
+	}
+}
+
+func TestImageWorkResultStatusTransitions(t *testing.T) {
+	statuses := []string{"", ImageWorkResultStatusJobCreated, ImageWorkResultStatusRetrying, ImageWorkResultStatusSucceeded,
+		ImageWorkResultStatusFailed, ImageWorkResultStatusAlreadyPulled}
+	valid := map[string]map[string]bool{
+		"":                              {ImageWorkResultStatusJobCreated: true, ImageWorkResultStatusAlreadyPulled: true, ImageWorkResultStatusFailed: true},
+		ImageWorkResultStatusJobCreated: {ImageWorkResultStatusSucceeded: true, ImageWorkResultStatusFailed: true, ImageWorkResultStatusRetrying: true},
+		ImageWorkResultStatusRetrying:   {ImageWorkResultStatusJobCreated: true, ImageWorkResultStatusAlreadyPulled: true, ImageWorkResultStatusFailed: true},
+	}
+	terminal := map[string]bool{ImageWorkResultStatusSucceeded: true, ImageWorkResultStatusFailed: true, ImageWorkResultStatusAlreadyPulled: true}
+	for _, from := range statuses {
+		for _, to := range statuses {
+			if actual := ValidImageWorkResultStatusTransition(from, to); actual != valid[from][to] {
+				t.Errorf("Test: %q --> %q failed: expected valid=%t, actual valid=%t", from, to, valid[from][to], actual)
+			}
+		}
+		if actual := IsTerminalImageWorkResultStatus(from); actual != terminal[from] {
+			t.Errorf("Test: %q failed: expected terminal=%t, actual terminal=%t", from, terminal[from], actual)
+		}
+		if terminal[from] && len(ImageWorkResultStatusTransitions(from)) > 0 {
+			t.Errorf("Test: %q failed: expected no transitions from final status, actual %v", from, ImageWorkResultStatusTransitions(from))
+		}
+	}
+}
+
+func TestPodFailureReasonMessage(t *testing.T) {
+	tests := []struct {
+		name            string
+		status          corev1.PodStatus
+		expectedReason  string
+		expectedMessage string
+	}{
+		{
+			name: "#1: No container failed",
+			status: corev1.PodStatus{
+				InitContainerStatuses: []corev1.ContainerStatus{
+					{Name: "busybox", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "Completed"}}},
+				},
+				ContainerStatuses: []corev1.ContainerStatus{
+					{Name: "imagepuller", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ContainerCreating"}}},
+				},
+			},
+		},
+		{
+			name: "#2: Image pull back off",
+			status: corev1.PodStatus{
+				InitContainerStatuses: []corev1.ContainerStatus{
+					{Name: "busybox", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "Completed"}}},
+				},
+				ContainerStatuses: []corev1.ContainerStatus{
+					{Name: "imagepuller", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff", Message: "Back-off pulling image \"foo\""}}},
+				},
+			},
+			expectedReason:  "ImagePullBackOff",
+			expectedMessage: "Back-off pulling image \"foo\"",
+		},
+		{
+			name: "#3: Init container failed",
+			status: corev1.PodStatus{
+				InitContainerStatuses: []corev1.ContainerStatus{
+					{Name: "busybox", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1}}},
+				},
+				ContainerStatuses: []corev1.ContainerStatus{
+					{Name: "imagepuller", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "PodInitializing"}}},
+				},
+			},
+			expectedReason: "Error",
+		},
+		{
+			name: "#4: Init container and container failed",
+			status: corev1.PodStatus{
+				InitContainerStatuses: []corev1.ContainerStatus{
+					{Name: "busybox", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ErrImagePull", Message: "busybox not found"}}},
+				},
+				ContainerStatuses: []corev1.ContainerStatus{
+					{Name: "imagepuller", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff", Message: "Back-off pulling image \"foo\""}}},
+				},
+			},
+			expectedReason:  "ErrImagePull",
+			expectedMessage: "busybox: ErrImagePull: busybox not found; imagepuller: ImagePullBackOff: Back-off pulling image \"foo\"",
+		},
+	}
+	for _, test := range tests {
+		reason, message := podFailureReasonMessage(&corev1.Pod{Status: test.status})
+		if reason != test.expectedReason || message != test.expectedMessage {
+			t.Errorf("Test: %s failed: expected %q/%q, actual %q/%q", test.name, test.expectedReason, test.expectedMessage, reason, message)
+		}
+	}
+}
+
+func TestClassifyFailure(t *testing.T) {
+	tests := []struct {
+		name     string
+		reason   string
+		message  string
+		expected fledgedv1alpha1.FailureCategory
+	}{
+		{
+			name:     "#1: containerd unauthorized",
+			reason:   "ErrImagePull",
+			message:  `rpc error: code = Unknown desc = failed to pull and unpack image "registry.corp/app:v1": failed to resolve reference "registry.corp/app:v1": pulling from host registry.corp failed with status code [manifests v1]: 401 Unauthorized`,
+			expected: fledgedv1alpha1.FailureCategoryUnauthorized,
+		},
+		{
+			name:     "#2: docker pull access denied",
+			reason:   "ErrImagePull",
+			message:  "Error response from daemon: pull access denied for private/app, repository does not exist or may require 'docker login': denied: requested access to the resource is denied",
+			expected: fledgedv1alpha1.FailureCategoryUnauthorized,
+		},
+		{
+			name:     "#3: cri-o authentication required",
+			reason:   "ErrImagePull",
+			message:  "rpc error: code = Unknown desc = reading manifest v1 in quay.io/private/app: unauthorized: access to the requested resource is not authorized",
+			expected: fledgedv1alpha1.FailureCategoryUnauthorized,
+		},
+		{
+			name:     "#4: containerd tag not found",
+			reason:   "ErrImagePull",
+			message:  `rpc error: code = NotFound desc = failed to pull and unpack image "docker.io/library/nginx:1.99": failed to resolve reference "docker.io/library/nginx:1.99": docker.io/library/nginx:1.99: not found`,
+			expected: fledgedv1alpha1.FailureCategoryNotFound,
+		},
+		{
+			name:     "#5: cri-o manifest unknown",
+			reason:   "ErrImagePull",
+			message:  "rpc error: code = Unknown desc = reading manifest 1.99 in docker.io/library/nginx: manifest unknown: manifest unknown",
+			expected: fledgedv1alpha1.FailureCategoryNotFound,
+		},
+		{
+			name:     "#6: docker delete of image not present",
+			reason:   "Error",
+			message:  "Error: No such image: nginx:1.17",
+			expected: fledgedv1alpha1.FailureCategoryNotFound,
+		},
+		{
+			name:     "#7: Invalid image name",
+			reason:   "InvalidImageName",
+			message:  `Failed to apply default image tag "Nginx": couldn't parse image reference "Nginx": invalid reference format: repository name must be lowercase`,
+			expected: fledgedv1alpha1.FailureCategoryNotFound,
+		},
+		{
+			name:     "#8: Registry i/o timeout",
+			reason:   "ErrImagePull",
+			message:  `rpc error: code = Unknown desc = failed to pull and unpack image "registry.corp/app:v1": failed to resolve reference "registry.corp/app:v1": failed to do request: Head "https://registry.corp/v2/app/manifests/v1": dial tcp 10.0.0.5:443: i/o timeout`,
+			expected: fledgedv1alpha1.FailureCategoryNetworkTimeout,
+		},
+		{
+			name:     "#9: Registry host not resolved",
+			reason:   "ErrImagePull",
+			message:  "Error response from daemon: Get https://registry.corp/v2/: dial tcp: lookup registry.corp on 10.96.0.10:53: no such host",
+			expected: fledgedv1alpha1.FailureCategoryNetworkTimeout,
+		},
+		{
+			name:     "#10: Registry unavailable",
+			reason:   "ErrImagePull",
+			message:  "received unexpected HTTP status: 503 Service Unavailable",
+			expected: fledgedv1alpha1.FailureCategoryNetworkTimeout,
+		},
+		{
+			name:     "#11: Registry unavailable reason without message",
+			reason:   "RegistryUnavailable",
+			expected: fledgedv1alpha1.FailureCategoryNetworkTimeout,
+		},
+		{
+			name:     "#12: CRI agent deadline exceeded",
+			reason:   "CRIAgentFailed",
+			message:  "rpc error: code = DeadlineExceeded desc = context deadline exceeded",
+			expected: fledgedv1alpha1.FailureCategoryNetworkTimeout,
+		},
+		{
+			name:     "#13: No space left on device",
+			reason:   "ErrImagePull",
+			message:  `rpc error: code = Unknown desc = failed to pull and unpack image "docker.io/library/nginx:1.17": failed to extract layer sha256:6f1b: write /var/lib/containerd/io.containerd.snapshotter.v1.overlayfs/snapshots/42/fs/usr/lib/x: no space left on device: unknown`,
+			expected: fledgedv1alpha1.FailureCategoryDiskPressure,
+		},
+		{
+			name:     "#14: Pod evicted for disk pressure",
+			reason:   "Evicted",
+			message:  "The node was low on resource: ephemeral-storage. Container imagepuller was using 12Ki, which exceeds its request of 0.",
+			expected: fledgedv1alpha1.FailureCategoryDiskPressure,
+		},
+		{
+			name:     "#15: Unknown failure",
+			reason:   "Error",
+			message:  "exit status 1",
+			expected: fledgedv1alpha1.FailureCategoryUnknown,
+		},
+	}
+	for _, test := range tests {
+		if actual := classifyFailure(test.reason, test.message); actual != test.expected {
+			t.Errorf("Test: %s failed: expected %s, actual %s", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestPullDuration(t *testing.T) {
+	jobCreationTime := time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name             string
+		iwres            ImageWorkResult
+		expectedDuration time.Duration
+	}{
+		{
+			name: "#1: Completed pull",
+			iwres: ImageWorkResult{ImageWorkRequest: ImageWorkRequest{WorkType: ImageCacheCreate}, Status: ImageWorkResultStatusSucceeded,
+				JobCreationTime: jobCreationTime, CompletionTime: jobCreationTime.Add(time.Minute)},
+			expectedDuration: time.Minute,
+		},
+		{
+			name: "#2: Pull not completed",
+			iwres: ImageWorkResult{ImageWorkRequest: ImageWorkRequest{WorkType: ImageCacheCreate}, Status: ImageWorkResultStatusJobCreated,
+				JobCreationTime: jobCreationTime},
+		},
+		{
+			name:  "#3: Image already pulled",
+			iwres: ImageWorkResult{ImageWorkRequest: ImageWorkRequest{WorkType: ImageCacheRefresh}, Status: ImageWorkResultStatusAlreadyPulled},
+		},
+		{
+			name: "#4: Image delete",
+			iwres: ImageWorkResult{ImageWorkRequest: ImageWorkRequest{WorkType: ImageCachePurge}, Status: ImageWorkResultStatusSucceeded,
+				JobCreationTime: jobCreationTime, CompletionTime: jobCreationTime.Add(time.Minute)},
+		},
+	}
+	for _, test := range tests {
+		if duration := test.iwres.PullDuration(); duration != test.expectedDuration {
+			t.Errorf("Test: %s failed: expected pull duration %s, actual %s", test.name, test.expectedDuration, duration)
+		}
+	}
+}
+
+func TestRecordImageWorkResult(t *testing.T) {
+	imagecache := fledgedv1alpha1.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+	}
+	tests := []struct {
+		name          string
+		worktype      WorkType
+		status        string
+		expectedEvent string
+	}{
+		{
+			name:          "#1: Create - Pull succeeded",
+			worktype:      ImageCacheCreate,
+			status:        ImageWorkResultStatusSucceeded,
+			expectedEvent: "Normal ImagePulled Image foo pulled to node bar",
+		},
+		{
+			name:          "#2: Refresh - Pull failed",
+			worktype:      ImageCacheRefresh,
+			status:        ImageWorkResultStatusFailed,
+			expectedEvent: "Warning ImagePullFailed Image foo could not be pulled to node bar: fakereason: fakemessage",
+		},
+		{
+			name:          "#3: Purge - Delete succeeded",
+			worktype:      ImageCachePurge,
+			status:        ImageWorkResultStatusSucceeded,
+			expectedEvent: "Normal ImageDeleted Image foo deleted from node bar",
+		},
+		{
+			name:          "#4: Purge - Delete failed",
+			worktype:      ImageCachePurge,
+			status:        ImageWorkResultStatusFailed,
+			expectedEvent: "Warning ImageDeleteFailed Image foo could not be deleted from node bar: fakereason: fakemessage",
+		},
+	}
+	for _, test := range tests {
+		imagemanager, _ := newTestImageManager(&fakeclientset.Clientset{}, "IfNotPresent")
+		imagemanager.recordImageWorkResult(&ImageWorkResult{
+			ImageWorkRequest: ImageWorkRequest{Image: "foo", Node: &node, WorkType: test.worktype, Imagecache: &imagecache},
+			Status:           test.status,
+			Reason:           "fakereason",
+			Message:          "fakemessage",
+		})
+		select {
+		case event := <-imagemanager.recorder.(*record.FakeRecorder).Events:
+			if event != test.expectedEvent {
+				t.Errorf("Test: %s failed: expectedEvent=%s, actualEvent=%s", test.name, test.expectedEvent, event)
+			}
+		default:
+			t.Errorf("Test: %s failed: expectedEvent=%s, actualEvent=nil", test.name, test.expectedEvent)
+		}
+	}
+}
+
+func TestUpdateImageCacheStatus(t *testing.T) {
+	imageCacheName := "fakeimagecache"
+	tests := []struct {
+		name                string
+		imageworkstatus     map[string]ImageWorkResult
+		pods                []corev1.Pod
+		eventListErr        bool
+		jobDeleteErr        bool
+		jobNotFound         bool
+		expectError         bool
+		expectedErrorString string
+	}{
+		{
+			name: "#1: Successful",
+			imageworkstatus: map[string]ImageWorkResult{
+				"fakejob": {
+					ImageWorkRequest: ImageWorkRequest{
+						Imagecache: &fledgedv1alpha1.ImageCache{
+							ObjectMeta: metav1.ObjectMeta{
+								Name: imageCacheName,
+							},
+						},
+						Node: &node,
+					},
+					Status: ImageWorkResultStatusSucceeded,
+				},
+			},
+			pods:        []corev1.Pod{},
+			expectError: false,
+		},
+		{
+			name: "#2: Create - Successful",
+			imageworkstatus: map[string]ImageWorkResult{
+				"fakejob": {
+					ImageWorkRequest: ImageWorkRequest{
+						Imagecache: &fledgedv1alpha1.ImageCache{
+							ObjectMeta: metav1.ObjectMeta{
+								Name: imageCacheName,
+							},
+						},
+						Node: &node,
+					},
+					Status: ImageWorkResultStatusJobCreated,
+				},
+			},
+			pods: []corev1.Pod{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: fledgedNameSpace,
+						Labels:    map[string]string{"job-name": "fakejob"},
+					},
+					Status: corev1.PodStatus{
+						Phase: corev1.PodPending,
+						ContainerStatuses: []corev1.ContainerStatus{
+							{
+								State: corev1.ContainerState{
+									Waiting: &corev1.ContainerStateWaiting{
+										Reason:  "fakereason",
+										Message: "fakemessage",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "#3: Create - Successful (Node not ready, hence empty containerstatuses)",
+			imageworkstatus: map[string]ImageWorkResult{
+				"fakejob": {
+					ImageWorkRequest: ImageWorkRequest{
+						Imagecache: &fledgedv1alpha1.ImageCache{
+							ObjectMeta: metav1.ObjectMeta{
+								Name: imageCacheName,
+							},
+						},
+						Node: &node,
+					},
+					Status: ImageWorkResultStatusJobCreated,
+				},
+			},
+			pods: []corev1.Pod{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: fledgedNameSpace,
+						Labels:    map[string]string{"job-name": "fakejob"},
+					},
+					Status: corev1.PodStatus{
+						Phase:             corev1.PodPending,
+						ContainerStatuses: []corev1.ContainerStatus{},
+					},
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "#4: Purge - Successful",
+			imageworkstatus: map[string]ImageWorkResult{
+				"fakejob": {
+					ImageWorkRequest: ImageWorkRequest{
+						WorkType: ImageCachePurge,
+						Imagecache: &fledgedv1alpha1.ImageCache{
+							ObjectMeta: metav1.ObjectMeta{
+								Name: imageCacheName,
+							},
+						},
+						Node: &node,
+					},
+					Status: ImageWorkResultStatusJobCreated,
+				},
+			},
+			pods: []corev1.Pod{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: fledgedNameSpace,
+						Labels:    map[string]string{"job-name": "fakejob"},
+					},
+					Status: corev1.PodStatus{
+						Phase: corev1.PodPending,
+						ContainerStatuses: []corev1.ContainerStatus{
+							{
+								State: corev1.ContainerState{
+									Waiting: &corev1.ContainerStateWaiting{
+										Reason:  "fakereason",
+										Message: "fakemessage",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "#5: Purge - Successful",
+			imageworkstatus: map[string]ImageWorkResult{
+				"fakejob": {
+					ImageWorkRequest: ImageWorkRequest{
+						WorkType: ImageCachePurge,
+						Imagecache: &fledgedv1alpha1.ImageCache{
+							ObjectMeta: metav1.ObjectMeta{
+								Name: imageCacheName,
+							},
+						},
+						Node: &node,
+					},
+					Status: ImageWorkResultStatusJobCreated,
+				},
+			},
+			pods: []corev1.Pod{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: fledgedNameSpace,
+						Labels:    map[string]string{"job-name": "fakejob"},
+					},
+					Status: corev1.PodStatus{
+						Phase: corev1.PodPending,
+						ContainerStatuses: []corev1.ContainerStatus{
+							{
+								State: corev1.ContainerState{
+									Terminated: &corev1.ContainerStateTerminated{
+										Reason:  "fakereason",
+										Message: "fakemessage",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "#6: Purge - Unsuccessful",
+			imageworkstatus: map[string]ImageWorkResult{
+				"fakejob": {
+					ImageWorkRequest: ImageWorkRequest{
+						WorkType: ImageCachePurge,
+						Imagecache: &fledgedv1alpha1.ImageCache{
+							ObjectMeta: metav1.ObjectMeta{
+								Name: imageCacheName,
+							},
+						},
+						Node: &node,
+					},
+					Status: ImageWorkResultStatusJobCreated,
+				},
+			},
+			pods: []corev1.Pod{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: fledgedNameSpace,
+					},
+				},
+			},
+			expectError:         true,
+			expectedErrorString: "No pods matched job",
+		},
+		{
+			name: "#7: Purge - Unsuccessful",
+			imageworkstatus: map[string]ImageWorkResult{
+				"fakejob": {
+					ImageWorkRequest: ImageWorkRequest{
+						WorkType: ImageCachePurge,
+						Imagecache: &fledgedv1alpha1.ImageCache{
+							ObjectMeta: metav1.ObjectMeta{
+								Name: imageCacheName,
+							},
+						},
+						Node: &node,
+					},
+					Status: ImageWorkResultStatusJobCreated,
+				},
+			},
+			pods: []corev1.Pod{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "pod1",
+						Namespace: fledgedNameSpace,
+						Labels:    map[string]string{"job-name": "fakejob"},
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "pod2",
+						Namespace: fledgedNameSpace,
+						Labels:    map[string]string{"job-name": "fakejob"},
+					},
+				},
+			},
+			expectError:         true,
+			expectedErrorString: "More than one pod matched job",
+		},
+		{
+			name: "#8: Create - Unsuccessful",
+			imageworkstatus: map[string]ImageWorkResult{
+				"fakejob": {
+					ImageWorkRequest: ImageWorkRequest{
+						Imagecache: &fledgedv1alpha1.ImageCache{
+							ObjectMeta: metav1.ObjectMeta{
+								Name: imageCacheName,
+							},
+						},
+						Node: &node,
+					},
+					Status: ImageWorkResultStatusSucceeded,
+				},
+			},
+			pods: []corev1.Pod{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: fledgedNameSpace,
+						Labels:    map[string]string{"job-name": "fakejob"},
+					},
+					Status: corev1.PodStatus{
+						Phase: corev1.PodPending,
+						ContainerStatuses: []corev1.ContainerStatus{
+							{
+								State: corev1.ContainerState{
+									Waiting: &corev1.ContainerStateWaiting{
+										Reason:  "fakereason",
+										Message: "fakemessage",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			jobDeleteErr:        true,
+			expectError:         true,
+			expectedErrorString: "Internal error occurred: fake error",
+		},
+		{
+			name: "#9: Job already garbage collected",
+			imageworkstatus: map[string]ImageWorkResult{
+				"fakejob": {
+					ImageWorkRequest: ImageWorkRequest{
+						Imagecache: &fledgedv1alpha1.ImageCache{
+							ObjectMeta: metav1.ObjectMeta{
+								Name: imageCacheName,
+							},
+						},
+						Node: &node,
+					},
+					Status: ImageWorkResultStatusSucceeded,
+				},
+			},
+			pods:        []corev1.Pod{},
+			jobNotFound: true,
+			expectError: false,
+		},
+	}
+
+	for _, test := range tests {
+		fakekubeclientset := &fakeclientset.Clientset{}
+		if test.eventListErr {
+			fakekubeclientset.AddReactor("list", "events", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+				return true, nil, apierrors.NewInternalError(fmt.Errorf("fake error"))
+			})
+		}
+		if test.jobDeleteErr {
+			fakekubeclientset.AddReactor("delete", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+				return true, nil, apierrors.NewInternalError(fmt.Errorf("fake error"))
+			})
+		}
+		if test.jobNotFound {
+			fakekubeclientset.AddReactor("delete", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+				return true, nil, apierrors.NewNotFound(batchv1.Resource("jobs"), action.(core.DeleteAction).GetName())
+			})
+		}
+		imagemanager, podInformer := newTestImageManager(fakekubeclientset, "IfNotPresent")
+		for _, pod := range test.pods {
+			if !reflect.DeepEqual(pod, corev1.Pod{}) {
+				podInformer.Informer().GetIndexer().Add(&pod)
+			}
+		}
+		imagemanager.imageworkstatus = test.imageworkstatus
+		errCh := make(chan error)
+		go imagemanager.updateImageCacheStatus(context.Background(), imageCacheName, errCh)
+		err := <-errCh
+		if err != nil {
+			t.Logf("err=%s", err.Error())
+		}
+		if test.expectError {
+			if err == nil {
+				t.Errorf("Test: %s failed: expectedError=%s, actualError=nil", test.name, test.expectedErrorString)
+			}
+			if err != nil && !strings.HasPrefix(err.Error(), test.expectedErrorString) {
+				t.Errorf("Test: %s failed: expectedError=%s, actualError=%s", test.name, test.expectedErrorString, err.Error())
+			}
+		} else if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+		}
+	}
+}
+
+func TestUpdateImageCacheStatusSameNameOtherNamespace(t *testing.T) {
+	newImageCache := func(namespace string) *fledgedv1alpha1.ImageCache {
+		return &fledgedv1alpha1.ImageCache{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: namespace}}
+	}
+	imageCacheA, imageCacheB := newImageCache("ns-a"), newImageCache("ns-b")
+	imagemanager, _ := newTestImageManager(&fakeclientset.Clientset{}, "IfNotPresent")
+	newResult := func(imageCache *fledgedv1alpha1.ImageCache, status string) ImageWorkResult {
+		return ImageWorkResult{
+			ImageWorkRequest: ImageWorkRequest{Image: "foo:v1", Node: &node, WorkType: ImageCacheCreate, Imagecache: imageCache},
+			Status:           status,
+		}
+	}
+	imagemanager.imageworkstatus["job-a"] = newResult(imageCacheA, ImageWorkResultStatusSucceeded)
+	imagemanager.imageworkstatus["job-b"] = newResult(imageCacheB, ImageWorkResultStatusJobCreated)
+	deferred := newResult(imageCacheB, ImageWorkResultStatusJobCreated).ImageWorkRequest
+	deferred.Image = "foo:v2"
+	imagemanager.deferredImageWork[deferred] = true
+	if imagemanager.hasDeferredImageWork(imageCacheObjKey(imageCacheA)) {
+		t.Errorf("Test failed: expected no deferred image work of %s", imageCacheObjKey(imageCacheA))
+	}
+	errCh := make(chan error)
+	go imagemanager.updateImageCacheStatus(context.Background(), imageCacheObjKey(imageCacheA), errCh)
+	if err := <-errCh; err != nil {
+		t.Errorf("Test failed: %v", err)
+	}
+	// Pending work of the image cache of the same name in the other namespace is neither collected nor failed
+	if iwres, ok := imagemanager.imageworkstatus["job-b"]; !ok || iwres.Status != ImageWorkResultStatusJobCreated {
+		t.Errorf("Test failed: expected result of job-b to be pending, actual %+v", imagemanager.imageworkstatus)
+	}
+	if _, ok := imagemanager.imageworkstatus["job-a"]; ok {
+		t.Errorf("Test failed: expected result of job-a to be collected")
+	}
+	// Status updates are queued with the delay of the rate limiter
+	time.Sleep(50 * time.Millisecond)
+	if imagemanager.workqueue.Len() != 1 {
+		t.Fatalf("Test failed: expected 1 status update, actual %d", imagemanager.workqueue.Len())
+	}
+	item, _ := imagemanager.workqueue.Get()
+	if key := item.(WorkQueueKey); key.ObjKey != "ns-a/foo" || len(*key.Status) != 1 {
+		t.Errorf("Test failed: expected status update of ns-a/foo with 1 result, actual %s with %d", key.ObjKey, len(*key.Status))
+	}
+}
+
+func TestWarmUp(t *testing.T) {
+	imagecache := &fledgedv1alpha1.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      WarmUpImageCachePrefix + "app",
+			Namespace: "default",
+		},
+	}
+	fakekubeclientset := &fakeclientset.Clientset{}
+	var created *batchv1.Job
+	fakekubeclientset.AddReactor("create", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+		created = action.(core.CreateAction).GetObject().(*batchv1.Job)
+		created.Name = "fakejob"
+		return true, created, nil
+	})
+	imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent")
+	iwr := ImageWorkRequest{
+		Image:                   "app:v2",
+		Node:                    &node,
+		ContainerRuntimeVersion: "containerd://1.3.3",
+		WorkType:                ImageCacheCreate,
+		Imagecache:              imagecache,
+		WarmUp:                  true,
+	}
+	if _, err := imagemanager.pullImage(context.Background(), iwr); err != nil {
+		t.Fatalf("Test failed: %v", err)
+	}
+	if len(created.OwnerReferences) != 0 {
+		t.Errorf("Test failed: expected no owner references of warm-up job, actual %+v", created.OwnerReferences)
+	}
+	imagemanager.imageworkstatus["fakejob"] = ImageWorkResult{ImageWorkRequest: iwr, Status: ImageWorkResultStatusSucceeded}
+	errCh := make(chan error)
+	go imagemanager.updateImageCacheStatus(context.Background(), imageCacheObjKey(imagecache), errCh)
+	if err := <-errCh; err != nil {
+		t.Errorf("Test failed: %v", err)
+	}
+	if len(imagemanager.imageworkstatus) != 0 {
+		t.Errorf("Test failed: expected results of warm-up to be removed, actual %+v", imagemanager.imageworkstatus)
+	}
+	if imagemanager.workqueue.Len() != 0 {
+		t.Errorf("Test failed: expected no status update of the image cache of warm-up, actual %d", imagemanager.workqueue.Len())
+	}
+	if events := len(imagemanager.recorder.(*record.FakeRecorder).Events); events != 0 {
+		t.Errorf("Test failed: expected no events of the image cache of warm-up, actual %d", events)
+	}
+}
+
+func TestImagePullRetry(t *testing.T) {
+	imagecache := fledgedv1alpha1.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+	}
+	failedPod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{"job-name": "fakejob"},
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodFailed,
+			ContainerStatuses: []corev1.ContainerStatus{
+				{
+					State: corev1.ContainerState{
+						Terminated: &corev1.ContainerStateTerminated{
+							Reason:  "fakereason",
+							Message: "fakemessage",
+						},
+					},
+				},
+			},
+		},
+	}
+	tests := []struct {
+		name                string
+		worktype            WorkType
+		maxRetries          int
+		previousRetries     int
+		expectedStatus      string
+		expectedNumRequeues int
+	}{
+		{
+			name:                "#1: Create - Retries disabled",
+			worktype:            ImageCacheCreate,
+			maxRetries:          0,
+			expectedStatus:      ImageWorkResultStatusFailed,
+			expectedNumRequeues: 0,
+		},
+		{
+			name:                "#2: Create - Pull retried",
+			worktype:            ImageCacheCreate,
+			maxRetries:          2,
+			previousRetries:     1,
+			expectedStatus:      ImageWorkResultStatusRetrying,
+			expectedNumRequeues: 2,
+		},
+		{
+			name:                "#3: Create - Retries exhausted",
+			worktype:            ImageCacheCreate,
+			maxRetries:          2,
+			previousRetries:     2,
+			expectedStatus:      ImageWorkResultStatusFailed,
+			expectedNumRequeues: 0,
+		},
+		{
+			name:                "#4: Purge - Not retried",
+			worktype:            ImageCachePurge,
+			maxRetries:          2,
+			expectedStatus:      ImageWorkResultStatusFailed,
+			expectedNumRequeues: 0,
+		},
+	}
+	for _, test := range tests {
+		imagemanager, _ := newTestImageManager(&fakeclientset.Clientset{}, "IfNotPresent")
+		imagemanager.maxRetries = test.maxRetries
+		iwr := ImageWorkRequest{
+			Image:      "foo",
+			Node:       &node,
+			WorkType:   test.worktype,
+			Imagecache: &imagecache,
+		}
+		for i := 0; i < test.previousRetries; i++ {
+			imagemanager.imageworkqueue.AddRateLimited(iwr)
+		}
+		imagemanager.imageworkstatus["fakejob"] = ImageWorkResult{ImageWorkRequest: iwr, Status: ImageWorkResultStatusJobCreated}
+		imagemanager.handlePodStatusChange(&failedPod)
+		if status := imagemanager.imageworkstatus["fakejob"].Status; status != test.expectedStatus {
+			t.Errorf("Test: %s failed: expectedWorkResult=%s, actualWorkResult=%s", test.name, test.expectedStatus, status)
+		}
+		if numRequeues := imagemanager.imageworkqueue.NumRequeues(iwr); numRequeues != test.expectedNumRequeues {
+			t.Errorf("Test: %s failed: expectedNumRequeues=%d, actualNumRequeues=%d", test.name, test.expectedNumRequeues, numRequeues)
+		}
+		if test.expectedStatus != ImageWorkResultStatusRetrying {
+			continue
+		}
+
+		// The retried request replaces the result of the failed job, without resetting the no. of retries
+		imagemanager.processNextWorkItem(context.Background())
+		if _, ok := imagemanager.imageworkstatus["fakejob"]; ok {
+			t.Errorf("Test: %s failed: result of failed job not removed after retry", test.name)
+		}
+		if len(imagemanager.imageworkstatus) != 1 {
+			t.Errorf("Test: %s failed: expected result of retried job, actual results=%+v", test.name, imagemanager.imageworkstatus)
+		}
+		for _, iwres := range imagemanager.imageworkstatus {
+			if iwres.Status != ImageWorkResultStatusJobCreated {
+				t.Errorf("Test: %s failed: expectedWorkResult=%s, actualWorkResult=%s", test.name, ImageWorkResultStatusJobCreated, iwres.Status)
+			}
+		}
+		if numRequeues := imagemanager.imageworkqueue.NumRequeues(iwr); numRequeues != test.expectedNumRequeues {
+			t.Errorf("Test: %s failed: expectedNumRequeues=%d, actualNumRequeues=%d", test.name, test.expectedNumRequeues, numRequeues)
+		}
+
+		// A retry that does not complete before the deadline is considered to have failed
+		imagemanager.imageworkstatus = map[string]ImageWorkResult{
+			"fakejob": {ImageWorkRequest: iwr, Status: ImageWorkResultStatusRetrying},
+		}
+		if err := imagemanager.updatePendingImageWorkResults(imageCacheObjKey(&imagecache)); err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+		}
+		if status := imagemanager.imageworkstatus["fakejob"].Status; status != ImageWorkResultStatusFailed {
+			t.Errorf("Test: %s failed: expectedWorkResult=%s, actualWorkResult=%s", test.name, ImageWorkResultStatusFailed, status)
+		}
+	}
+}
+
+func TestReconcileTimeout(t *testing.T) {
+	imagecache := fledgedv1alpha1.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name           string
+		ctx            context.Context
+		status         string
+		expectedStatus string
+		expectedReason string
+	}{
+		{
+			name:           "#1: Reconcile not timed out - Job created",
+			ctx:            context.Background(),
+			expectedStatus: ImageWorkResultStatusJobCreated,
+		},
+		{
+			name:           "#2: Reconcile timed out - Job not created",
+			ctx:            ctx,
+			expectedStatus: ImageWorkResultStatusFailed,
+			expectedReason: ImageWorkResultReasonReconcileTimeout,
+		},
+		{
+			name:           "#3: Reconcile timed out - Retried job not created",
+			ctx:            ctx,
+			status:         ImageWorkResultStatusRetrying,
+			expectedStatus: ImageWorkResultStatusFailed,
+			expectedReason: ImageWorkResultReasonReconcileTimeout,
+		},
+	}
+	for _, test := range tests {
+		imagemanager, _ := newTestImageManager(&fakeclientset.Clientset{}, "Always")
+		iwr := ImageWorkRequest{
+			Image:      "foo",
+			Node:       &node,
+			WorkType:   ImageCacheCreate,
+			Imagecache: &imagecache,
+			Context:    test.ctx,
+		}
+		if test.status != "" {
+			imagemanager.imageworkstatus["fakejob"] = ImageWorkResult{ImageWorkRequest: iwr, Status: test.status}
+		}
+		imagemanager.imageworkqueue.Add(iwr)
+		imagemanager.processNextWorkItem(context.Background())
+		if len(imagemanager.imageworkstatus) != 1 {
+			t.Errorf("Test: %s failed: expected a single result, actual results=%+v", test.name, imagemanager.imageworkstatus)
+			continue
+		}
+		for _, iwres := range imagemanager.imageworkstatus {
+			if iwres.Status != test.expectedStatus || iwres.Reason != test.expectedReason {
+				t.Errorf("Test: %s failed: expectedWorkResult=%s/%s, actualWorkResult=%s/%s", test.name,
+					test.expectedStatus, test.expectedReason, iwres.Status, iwres.Reason)
+			}
+		}
+	}
+
+	// Pending jobs of a reconcile that timed out are abandoned
+	imagemanager, _ := newTestImageManager(&fakeclientset.Clientset{}, "Always")
+	imagemanager.imageworkstatus["job1"] = ImageWorkResult{
+		ImageWorkRequest: ImageWorkRequest{Image: "foo", Node: &node, WorkType: ImageCacheCreate, Imagecache: &imagecache, Context: ctx},
+		Status:           ImageWorkResultStatusJobCreated,
+	}
+	if err := imagemanager.updatePendingImageWorkResults(imageCacheObjKey(&imagecache)); err != nil {
+		t.Errorf("Test failed. expectedError=nil, actualError=%s", err.Error())
+	}
+	if iwres := imagemanager.imageworkstatus["job1"]; iwres.Status != ImageWorkResultStatusFailed || iwres.Reason != ImageWorkResultReasonReconcileTimeout {
+		t.Errorf("Test failed: expectedWorkResult=%s/%s, actualWorkResult=%s/%s", ImageWorkResultStatusFailed,
+			ImageWorkResultReasonReconcileTimeout, iwres.Status, iwres.Reason)
+	}
+}
+
+func TestDeleteRetriedJob(t *testing.T) {
+	imagecache := fledgedv1alpha1.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	fakekubeclientset := &fakeclientset.Clientset{}
+	imagemanager, _ := newTestImageManager(fakekubeclientset, "Always")
+	var deleted []string
+	locked := true
+	fakekubeclientset.AddReactor("delete", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+		deleted = append(deleted, action.(core.DeleteAction).GetName())
+		// The failed job is deleted after the lock of the image manager is released
+		acquired := make(chan struct{})
+		go func() {
+			imagemanager.lock.Lock()
+			imagemanager.lock.Unlock()
+			close(acquired)
+		}()
+		select {
+		case <-acquired:
+			locked = false
+		case <-time.After(time.Second):
+		}
+		return true, nil, nil
+	})
+	iwr := ImageWorkRequest{Image: "foo", Node: &node, WorkType: ImageCacheCreate, Imagecache: &imagecache, Context: ctx}
+	imagemanager.imageworkstatus["job1"] = ImageWorkResult{ImageWorkRequest: iwr, Status: ImageWorkResultStatusRetrying}
+	imagemanager.abandonImageWork(iwr)
+	if len(deleted) != 1 || deleted[0] != "job1" {
+		t.Errorf("Test failed: expectedDeletedJobs=[job1], actualDeletedJobs=%v", deleted)
+	}
+	if locked {
+		t.Errorf("Test failed: retried job deleted while holding the lock")
+	}
+	if _, ok := imagemanager.imageworkstatus["job1"]; ok {
+		t.Errorf("Test failed: result of retried job not removed")
+	}
+}
+
+func TestImageManagerShutdown(t *testing.T) {
+	imagecache := fledgedv1alpha1.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	fakekubeclientset := &fakeclientset.Clientset{}
+	var actions []string
+	fakekubeclientset.AddReactor("*", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+		actions = append(actions, action.GetVerb())
+		return true, &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "foo"}}, nil
+	})
+	imagemanager, _ := newTestImageManager(fakekubeclientset, "Always")
+	iwr := ImageWorkRequest{
+		Image:      "foo",
+		Node:       &node,
+		WorkType:   ImageCacheCreate,
+		Imagecache: &imagecache,
+	}
+
+	// No job is created once the image manager is shutting down
+	if _, err := imagemanager.pullImage(ctx, iwr); err != context.Canceled {
+		t.Errorf("Test: pullImage failed: expectedError=%v, actualError=%v", context.Canceled, err)
+	}
+	if _, err := imagemanager.deleteImage(ctx, iwr); err != context.Canceled {
+		t.Errorf("Test: deleteImage failed: expectedError=%v, actualError=%v", context.Canceled, err)
+	}
+	imagemanager.imageworkqueue.Add(iwr)
+	imagemanager.processNextWorkItem(ctx)
+	if len(imagemanager.imageworkstatus) != 0 || imagemanager.imageworkqueue.Len() != 0 {
+		t.Errorf("Test: processNextWorkItem failed: expected work to be dropped, actual results=%+v, queue length=%d",
+			imagemanager.imageworkstatus, imagemanager.imageworkqueue.Len())
+	}
+
+	// Jobs of the image cache are left to complete, and its status is not updated
+	imagemanager.imageworkstatus["job1"] = ImageWorkResult{ImageWorkRequest: iwr, Status: ImageWorkResultStatusJobCreated}
+	errCh := make(chan error)
+	go imagemanager.updateImageCacheStatus(ctx, imageCacheObjKey(&imagecache), errCh)
+	if err := <-errCh; err != context.Canceled {
+		t.Errorf("Test: updateImageCacheStatus failed: expectedError=%v, actualError=%v", context.Canceled, err)
+	}
+	if _, ok := imagemanager.imageworkstatus["job1"]; !ok || imagemanager.workqueue.Len() != 0 {
+		t.Errorf("Test: updateImageCacheStatus failed: expected status of image cache not to be updated")
+	}
+	if len(actions) != 0 {
+		t.Errorf("Test failed: expected no job actions, actual %v", actions)
+	}
+}
+
+func TestMaxConcurrentPulls(t *testing.T) {
+	imagecache := fledgedv1alpha1.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+	}
+	tests := []struct {
+		name               string
+		maxConcurrentPulls int
+		maxPullsPerNode    int
+		maxTotalJobs       int
+		outstandingWork    WorkType
+		outstandingNode    string
+		worktype           WorkType
+		expectDeferred     bool
+	}{
+		{
+			name:               "#1: Create - No limit on concurrent pulls",
+			maxConcurrentPulls: 0,
+			worktype:           ImageCacheCreate,
+			expectDeferred:     false,
+		},
+		{
+			name:               "#2: Create - Max concurrent pulls reached",
+			maxConcurrentPulls: 1,
+			worktype:           ImageCacheCreate,
+			expectDeferred:     true,
+		},
+		{
+			name:               "#3: Create - Below max concurrent pulls",
+			maxConcurrentPulls: 2,
+			worktype:           ImageCacheCreate,
+			expectDeferred:     false,
+		},
+		{
+			name:               "#4: Purge - Not limited by max concurrent pulls",
+			maxConcurrentPulls: 1,
+			worktype:           ImageCachePurge,
+			expectDeferred:     false,
+		},
+		{
+			name:           "#5: Purge - Max total jobs reached",
+			maxTotalJobs:   1,
+			worktype:       ImageCachePurge,
+			expectDeferred: true,
+		},
+		{
+			name:            "#6: Create - Max total jobs reached by outstanding purge",
+			maxTotalJobs:    1,
+			outstandingWork: ImageCachePurge,
+			worktype:        ImageCacheCreate,
+			expectDeferred:  true,
+		},
+		{
+			name:               "#7: Create - Outstanding purge not counted in max concurrent pulls",
+			maxConcurrentPulls: 1,
+			maxTotalJobs:       2,
+			outstandingWork:    ImageCachePurge,
+			worktype:           ImageCacheCreate,
+			expectDeferred:     false,
+		},
+		{
+			name:            "#8: Create - Max pulls per node reached",
+			maxPullsPerNode: 1,
+			worktype:        ImageCacheCreate,
+			expectDeferred:  true,
+		},
+		{
+			name:            "#9: Create - Outstanding pull to another node not counted in max pulls per node",
+			maxPullsPerNode: 1,
+			outstandingNode: "baz",
+			worktype:        ImageCacheCreate,
+			expectDeferred:  false,
+		},
+		{
+			name:            "#10: Create - Below max pulls per node",
+			maxPullsPerNode: 2,
+			worktype:        ImageCacheCreate,
+			expectDeferred:  false,
+		},
+		{
+			name:            "#11: Purge - Not limited by max pulls per node",
+			maxPullsPerNode: 1,
+			worktype:        ImageCachePurge,
+			expectDeferred:  false,
+		},
+	}
+	for _, test := range tests {
+		imagemanager, _ := newTestImageManager(&fakeclientset.Clientset{}, "Always")
+		imagemanager.maxConcurrentPulls = test.maxConcurrentPulls
+		imagemanager.maxPullsPerNode = test.maxPullsPerNode
+		imagemanager.maxTotalJobs = test.maxTotalJobs
+		outstandingWork := ImageCacheCreate
+		if test.outstandingWork != "" {
+			outstandingWork = test.outstandingWork
+		}
+		outstandingNode := &node
+		if test.outstandingNode != "" {
+			outstandingNode = node.DeepCopy()
+			outstandingNode.Name = test.outstandingNode
+		}
+		imagemanager.imageworkstatus["fakejob"] = ImageWorkResult{
+			ImageWorkRequest: ImageWorkRequest{Image: "bar", Node: outstandingNode, WorkType: outstandingWork, Imagecache: &imagecache},
+			Status:           ImageWorkResultStatusJobCreated,
+		}
+		iwr := ImageWorkRequest{Image: "foo", Node: &node, WorkType: test.worktype, Imagecache: &imagecache}
+		imagemanager.imageworkqueue.Add(iwr)
+		imagemanager.processNextWorkItem(context.Background())
+		if deferred := imagemanager.hasDeferredImageWork(imageCacheObjKey(&imagecache)); deferred != test.expectDeferred {
+			t.Errorf("Test: %s failed: expectedDeferred=%t, actualDeferred=%t", test.name, test.expectDeferred, deferred)
+		}
+		if !test.expectDeferred {
+			if len(imagemanager.imageworkstatus) != 2 {
+				t.Errorf("Test: %s failed: expected job to be created, actual results=%+v", test.name, imagemanager.imageworkstatus)
+			}
+			continue
+		}
+		if len(imagemanager.imageworkstatus) != 1 {
+			t.Errorf("Test: %s failed: expected job creation to be deferred, actual results=%+v", test.name, imagemanager.imageworkstatus)
+		}
+
+		// Deferred request is processed once the outstanding job completes
+		imagemanager.imageworkstatus["fakejob"] = ImageWorkResult{
+			ImageWorkRequest: imagemanager.imageworkstatus["fakejob"].ImageWorkRequest,
+			Status:           ImageWorkResultStatusSucceeded,
+		}
+		imagemanager.processNextWorkItem(context.Background())
+		if imagemanager.hasDeferredImageWork(imageCacheObjKey(&imagecache)) {
+			t.Errorf("Test: %s failed: expected deferred request to be processed", test.name)
+		}
+		if len(imagemanager.imageworkstatus) != 2 {
+			t.Errorf("Test: %s failed: expected job to be created, actual results=%+v", test.name, imagemanager.imageworkstatus)
+		}
+	}
+}
+
+func TestPullDeadline(t *testing.T) {
+	tests := []struct {
+		name             string
+		iwr              ImageWorkRequest
+		expectedDeadline time.Duration
+	}{
+		{
+			name:             "#1 Pull deadline not specified in image list",
+			iwr:              ImageWorkRequest{WorkType: ImageCacheCreate},
+			expectedDeadline: time.Millisecond * 10,
+		},
+		{
+			name:             "#2 Pull deadline overridden in image list",
+			iwr:              ImageWorkRequest{WorkType: ImageCacheCreate, PullDeadline: &metav1.Duration{Duration: time.Minute}},
+			expectedDeadline: time.Minute,
+		},
+		{
+			name:             "#3 Zero pull deadline in image list",
+			iwr:              ImageWorkRequest{WorkType: ImageCacheRefresh, PullDeadline: &metav1.Duration{}},
+			expectedDeadline: time.Millisecond * 10,
+		},
+		{
+			name:             "#4 Pull deadline not applicable to purge",
+			iwr:              ImageWorkRequest{WorkType: ImageCachePurge, PullDeadline: &metav1.Duration{Duration: time.Minute}},
+			expectedDeadline: time.Millisecond * 10,
+		},
+	}
+	imagemanager, _ := newTestImageManager(&fakeclientset.Clientset{}, "IfNotPresent")
+	for _, test := range tests {
+		if deadline := imagemanager.pullDeadline(test.iwr); deadline != test.expectedDeadline {
+			t.Errorf("Test: %s failed: expectedDeadline=%s, actualDeadline=%s", test.name, test.expectedDeadline, deadline)
+		}
+	}
+}
+
+func TestPullPolicy(t *testing.T) {
+	tests := []struct {
+		name               string
+		iwr                ImageWorkRequest
+		expectedPullPolicy string
+	}{
+		{
+			name:               "#1 Pull policy of image manager",
+			iwr:                ImageWorkRequest{WorkType: ImageCacheCreate},
+			expectedPullPolicy: "IfNotPresent",
+		},
+		{
+			name:               "#2 Pull policy overridden for scheduled refresh",
+			iwr:                ImageWorkRequest{WorkType: ImageCacheCreate, ImagePullPolicy: "Always"},
+			expectedPullPolicy: "Always",
+		},
+	}
+	imagemanager, _ := newTestImageManager(&fakeclientset.Clientset{}, "IfNotPresent")
+	for _, test := range tests {
+		if pullPolicy := imagemanager.pullPolicy(test.iwr); pullPolicy != test.expectedPullPolicy {
+			t.Errorf("Test: %s failed: expectedPullPolicy=%s, actualPullPolicy=%s", test.name, test.expectedPullPolicy, pullPolicy)
+		}
+	}
+}
+
+func TestUpdateImageCacheStatusPullDeadline(t *testing.T) {
+	imageCacheName := "fakeimagecache"
+	tests := []struct {
+		name         string
+		pullDeadline *metav1.Duration
+		minDuration  time.Duration
+		maxDuration  time.Duration
+	}{
+		{
+			name:         "#1 Fall back to image pull deadline duration of image manager",
+			pullDeadline: nil,
+			minDuration:  0,
+			maxDuration:  time.Second,
+		},
+		{
+			name:         "#2 Wait for pull deadline of image list",
+			pullDeadline: &metav1.Duration{Duration: time.Millisecond * 1500},
+			minDuration:  time.Second,
+			maxDuration:  time.Second * 3,
+		},
+	}
+	for _, test := range tests {
+		imagemanager, podInformer := newTestImageManager(&fakeclientset.Clientset{}, "IfNotPresent")
+		podInformer.Informer().GetIndexer().Add(&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: fledgedNameSpace,
+				Labels:    map[string]string{"job-name": "fakejob"},
+			},
+			Status: corev1.PodStatus{
+				Phase: corev1.PodPending,
+			},
+		})
+		imagemanager.imageworkstatus = map[string]ImageWorkResult{
+			"fakejob": {
+				ImageWorkRequest: ImageWorkRequest{
+					Imagecache: &fledgedv1alpha1.ImageCache{
+						ObjectMeta: metav1.ObjectMeta{
+							Name: imageCacheName,
+						},
+					},
+					Node:         &node,
+					WorkType:     ImageCacheCreate,
+					PullDeadline: test.pullDeadline,
+				},
+				Status: ImageWorkResultStatusJobCreated,
+			},
+		}
+		start := time.Now()
+		errCh := make(chan error)
+		go imagemanager.updateImageCacheStatus(context.Background(), imageCacheName, errCh)
+		if err := <-errCh; err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+		}
+		if elapsed := time.Since(start); elapsed < test.minDuration || elapsed > test.maxDuration {
+			t.Errorf("Test: %s failed: expected duration between %s and %s, actual duration=%s", test.name, test.minDuration, test.maxDuration, elapsed)
+		}
+		key, _ := imagemanager.workqueue.Get()
+		if iwres := (*key.(WorkQueueKey).Status)["fakejob"]; iwres.Status != ImageWorkResultStatusFailed {
+			t.Errorf("Test: %s failed: expectedStatus=%s, actualStatus=%s", test.name, ImageWorkResultStatusFailed, iwres.Status)
+		}
+	}
+}
+
+func TestProcessNextWorkItem(t *testing.T) {
+	defaultImageCache := fledgedv1alpha1.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+		Spec: fledgedv1alpha1.ImageCacheSpec{
+			CacheSpec: []fledgedv1alpha1.CacheSpecImages{
+				{
+					Images: []string{"foo"},
+				},
+			},
+		},
+	}
+	testnode := node
+	testnode.Status.Images = []corev1.ContainerImage{
+		{
+			Names: []string{"foo:v1"},
+		},
+	}
+	tests := []struct {
+		name                string
+		iwr                 ImageWorkRequest
+		imageworkstatus     map[string]ImageWorkResult
+		pods                []corev1.Pod
+		imagepullpolicy     string
+		expectError         bool
+		expectedErrorString string
+	}{
+		{
+			name: "#1: Create - Successful",
+			iwr: ImageWorkRequest{
+				Image:      "fakeimage",
+				Node:       &node,
+				WorkType:   ImageCacheCreate,
+				Imagecache: &defaultImageCache,
+			},
+			imageworkstatus: map[string]ImageWorkResult{
+				"fakejob": {
+					ImageWorkRequest: ImageWorkRequest{
+						Imagecache: &fledgedv1alpha1.ImageCache{
+							ObjectMeta: metav1.ObjectMeta{
+								Name: defaultImageCache.Name,
+							},
+						},
+					},
+					Status: ImageWorkResultStatusSucceeded,
+				},
+			},
+			pods: []corev1.Pod{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: fledgedNameSpace,
+						Labels:    map[string]string{"job-name": "fakejob"},
+					},
+					Status: corev1.PodStatus{
+						Phase: corev1.PodPending,
+						ContainerStatuses: []corev1.ContainerStatus{
+							{
+								State: corev1.ContainerState{
+									Terminated: &corev1.ContainerStateTerminated{
+										Reason:  "fakereason",
+										Message: "fakemessage",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			imagepullpolicy: "IfNotPresent",
+			expectError:     false,
+		},
+		{
+			name: "#2: Purge - Successful",
+			iwr: ImageWorkRequest{
+				Image:      "fakeimage",
+				Node:       &node,
+				WorkType:   ImageCachePurge,
+				Imagecache: &defaultImageCache,
+			},
+			imageworkstatus: map[string]ImageWorkResult{
+				"fakejob": {
+					ImageWorkRequest: ImageWorkRequest{
+						Imagecache: &fledgedv1alpha1.ImageCache{
+							ObjectMeta: metav1.ObjectMeta{
+								Name: defaultImageCache.Name,
+							},
+						},
+					},
+					Status: ImageWorkResultStatusSucceeded,
+				},
+			},
+			pods: []corev1.Pod{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: fledgedNameSpace,
+						Labels:    map[string]string{"job-name": "fakejob"},
+					},
+					Status: corev1.PodStatus{
+						Phase: corev1.PodPending,
+						ContainerStatuses: []corev1.ContainerStatus{
+							{
+								State: corev1.ContainerState{
+									Terminated: &corev1.ContainerStateTerminated{
+										Reason:  "fakereason",
+										Message: "fakemessage",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "#3: Statusupdate - Successful",
+			iwr: ImageWorkRequest{
+				WorkType:   ImageCacheCreate,
+				Imagecache: &defaultImageCache,
+			},
+			imageworkstatus: map[string]ImageWorkResult{
+				"fakejob": {
+					ImageWorkRequest: ImageWorkRequest{
+						Imagecache: &fledgedv1alpha1.ImageCache{
+							ObjectMeta: metav1.ObjectMeta{
+								Name: defaultImageCache.Name,
+							},
+						},
+					},
+					Status: ImageWorkResultStatusSucceeded,
+				},
+			},
+			pods: []corev1.Pod{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: fledgedNameSpace,
+						Labels:    map[string]string{"job-name": "fakejob"},
+					},
+					Status: corev1.PodStatus{
+						Phase: corev1.PodPending,
+						ContainerStatuses: []corev1.ContainerStatus{
+							{
+								State: corev1.ContainerState{
+									Terminated: &corev1.ContainerStateTerminated{
+										Reason:  "fakereason",
+										Message: "fakemessage",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			expectError: false,
+		},
+		{
+			name:                "#4: Create - Unsuccessful",
+			expectError:         false,
+			expectedErrorString: "Unexpected type in workqueue",
+		},
+		{
+			name: "#5: Create - Successful (Image not present in Node)",
+			iwr: ImageWorkRequest{
+				Image:      "foo:v1",
+				Node:       &node,
+				WorkType:   ImageCacheCreate,
+				Imagecache: &defaultImageCache,
+			},
+			imageworkstatus: map[string]ImageWorkResult{
+				"fakejob": {
+					ImageWorkRequest: ImageWorkRequest{
+						Imagecache: &fledgedv1alpha1.ImageCache{
+							ObjectMeta: metav1.ObjectMeta{
+								Name: defaultImageCache.Name,
+							},
+						},
+					},
+					Status: ImageWorkResultStatusSucceeded,
+				},
+			},
+			pods: []corev1.Pod{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: fledgedNameSpace,
+						Labels:    map[string]string{"job-name": "fakejob"},
+					},
+					Status: corev1.PodStatus{
+						Phase: corev1.PodPending,
+						ContainerStatuses: []corev1.ContainerStatus{
+							{
+								State: corev1.ContainerState{
+									Terminated: &corev1.ContainerStateTerminated{
+										Reason:  "fakereason",
+										Message: "fakemessage",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			imagepullpolicy: "IfNotPresent",
+			expectError:     false,
+		},
+		{
+			name: "#6: Create - Successful (Image already present in Node)",
+			iwr: ImageWorkRequest{
+				Image:      "foo:v1",
+				Node:       &testnode,
+				WorkType:   ImageCacheCreate,
+				Imagecache: &defaultImageCache,
+			},
+			imageworkstatus: map[string]ImageWorkResult{
+				"fakejob": {
+					ImageWorkRequest: ImageWorkRequest{
+						Imagecache: &fledgedv1alpha1.ImageCache{
+							ObjectMeta: metav1.ObjectMeta{
+								Name: defaultImageCache.Name,
+							},
+						},
+					},
+					Status: ImageWorkResultStatusSucceeded,
+				},
+			},
+			pods: []corev1.Pod{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: fledgedNameSpace,
+						Labels:    map[string]string{"job-name": "fakejob"},
+					},
+					Status: corev1.PodStatus{
+						Phase: corev1.PodPending,
+						ContainerStatuses: []corev1.ContainerStatus{
+							{
+								State: corev1.ContainerState{
+									Terminated: &corev1.ContainerStateTerminated{
+										Reason:  "fakereason",
+										Message: "fakemessage",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			imagepullpolicy: "IfNotPresent",
+			expectError:     false,
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := &fakeclientset.Clientset{}
+		imagemanager, podInformer := newTestImageManager(fakekubeclientset, test.imagepullpolicy)
+		for _, pod := range test.pods {
+			if !reflect.DeepEqual(pod, corev1.Pod{}) {
+				podInformer.Informer().GetIndexer().Add(&pod)
+			}
+		}
+		imagemanager.imageworkstatus = test.imageworkstatus
+		if test.expectedErrorString == "Unexpected type in workqueue" {
+			imagemanager.imageworkqueue.Add(struct{}{})
+		}
+		imagemanager.imageworkqueue.Add(test.iwr)
+		imagemanager.processNextWorkItem(context.Background())
+		var err error
+		if test.expectError {
+			if err == nil {
+				t.Errorf("Test: %s failed: expectedError=%s, actualError=nil", test.name, test.expectedErrorString)
+			}
+			if err != nil && !strings.HasPrefix(err.Error(), test.expectedErrorString) {
+				t.Errorf("Test: %s failed: expectedError=%s, actualError=%s", test.name, test.expectedErrorString, err.Error())
+			}
+		} else if err != nil {
+			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+		}
+	}
+}
+
+func TestDisablePurge(t *testing.T) {
+	imagecache := fledgedv1alpha1.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+	}
+	tests := []struct {
+		name           string
+		workType       WorkType
+		expectedJobs   int
+		expectedStatus string
+		expectedReason string
+	}{
+		{
+			name:           "#1: Purge fails without creating a job",
+			workType:       ImageCachePurge,
+			expectedStatus: ImageWorkResultStatusFailed,
+			expectedReason: ImageWorkResultReasonPurgeDisabled,
+		},
+		{
+			name:           "#2: Pull creates a job",
+			workType:       ImageCacheCreate,
+			expectedJobs:   1,
+			expectedStatus: ImageWorkResultStatusJobCreated,
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := &fakeclientset.Clientset{}
+		jobs := 0
+		fakekubeclientset.AddReactor("create", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			jobs++
+			job := action.(core.CreateAction).GetObject().(*batchv1.Job)
+			job.Name = "fakejob"
+			return true, job, nil
+		})
+		imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent")
+		imagemanager.disablePurge = true
+		iwr := ImageWorkRequest{Image: "foo", Node: &node, ContainerRuntimeVersion: "containerd://1.3.3", WorkType: test.workType, Imagecache: &imagecache}
+		imagemanager.imageworkqueue.Add(iwr)
+		imagemanager.processNextWorkItem(context.Background())
+		if jobs != test.expectedJobs {
+			t.Errorf("Test: %s failed: expectedJobs=%d, actualJobs=%d", test.name, test.expectedJobs, jobs)
+		}
+		if len(imagemanager.imageworkstatus) != 1 {
+			t.Errorf("Test: %s failed: expected 1 image work result, actual %d", test.name, len(imagemanager.imageworkstatus))
+			continue
+		}
+		for _, iwres := range imagemanager.imageworkstatus {
+			if iwres.Status != test.expectedStatus || iwres.Reason != test.expectedReason {
+				t.Errorf("Test: %s failed: expected %s/%s, actual %s/%s", test.name, test.expectedStatus, test.expectedReason, iwres.Status, iwres.Reason)
+			}
+		}
+		if test.workType == ImageCachePurge {
+			if _, err := imagemanager.deleteImage(context.Background(), iwr); err != errPurgeDisabled {
+				t.Errorf("Test: %s failed: expected deleteImage error %v, actual %v", test.name, errPurgeDisabled, err)
+			}
+		}
+	}
+}
+
+func TestPullJobContainerImages(t *testing.T) {
+	imagecache := fledgedv1alpha1.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+		Spec: fledgedv1alpha1.ImageCacheSpec{
+			PullJobContainer: &fledgedv1alpha1.PullJobContainer{Image: "mirror-puller:v1"},
+		},
+	}
+	tests := []struct {
+		name           string
+		allowedImages  []string
+		runtimeSocket  bool
+		expectedJobs   int
+		expectedStatus string
+		expectedReason string
+		expectedSocket bool
+	}{
+		{
+			name:           "#1: Pull job container not allowed by default",
+			expectedStatus: ImageWorkResultStatusFailed,
+			expectedReason: ImageWorkResultReasonPullJobContainerNotAllowed,
+		},
+		{
+			name:           "#2: Pull job container not allowed",
+			allowedImages:  []string{"other-puller"},
+			expectedStatus: ImageWorkResultStatusFailed,
+			expectedReason: ImageWorkResultReasonPullJobContainerNotAllowed,
+		},
+		{
+			name:           "#3: Pull job container allowed, without the runtime socket",
+			allowedImages:  []string{"mirror-puller"},
+			expectedJobs:   1,
+			expectedStatus: ImageWorkResultStatusJobCreated,
+		},
+		{
+			name:           "#4: Pull job container allowed, with the runtime socket",
+			allowedImages:  []string{"mirror-puller:v1"},
+			runtimeSocket:  true,
+			expectedJobs:   1,
+			expectedStatus: ImageWorkResultStatusJobCreated,
+			expectedSocket: true,
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := &fakeclientset.Clientset{}
+		var jobs []*batchv1.Job
+		fakekubeclientset.AddReactor("create", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			job := action.(core.CreateAction).GetObject().(*batchv1.Job)
+			job.Name = "fakejob"
+			jobs = append(jobs, job)
+			return true, job, nil
+		})
+		imagemanager, _ := newTestImageManager(fakekubeclientset, "Always")
+		imagemanager.pullJobContainerImages = test.allowedImages
+		imagemanager.pullJobContainerRuntimeSocket = test.runtimeSocket
+		iwr := ImageWorkRequest{Image: "foo", Node: &node, ContainerRuntimeVersion: "containerd://1.3.3", WorkType: ImageCacheCreate, Imagecache: &imagecache}
+		imagemanager.imageworkqueue.Add(iwr)
+		imagemanager.processNextWorkItem(context.Background())
+		if len(jobs) != test.expectedJobs {
+			t.Errorf("Test: %s failed: expectedJobs=%d, actualJobs=%d", test.name, test.expectedJobs, len(jobs))
+			continue
+		}
+		for _, iwres := range imagemanager.imageworkstatus {
+			if iwres.Status != test.expectedStatus || iwres.Reason != test.expectedReason {
+				t.Errorf("Test: %s failed: expected %s/%s, actual %s/%s", test.name, test.expectedStatus, test.expectedReason, iwres.Status, iwres.Reason)
+			}
+		}
+		if len(jobs) == 1 {
+			if socket := len(jobs[0].Spec.Template.Spec.Volumes) == 1; socket != test.expectedSocket {
+				t.Errorf("Test: %s failed: expectedSocket=%t, actual volumes %+v", test.name, test.expectedSocket, jobs[0].Spec.Template.Spec.Volumes)
+			}
+		}
+	}
+}
+
+func TestCRIAgentWork(t *testing.T) {
+	imagecache := fledgedv1alpha1.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+	}
+	agentNode := corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "bar",
+			Labels: map[string]string{"kubernetes.io/hostname": "bar"},
+		},
+	}
+	tests := []struct {
+		name            string
+		workType        WorkType
+		runtime         string
+		agentReady      bool
+		agentFails      bool
+		expectedPath    string
+		expectedJob     bool
+		expectedStatus  string
+		expectedMessage string
+	}{
+		{
+			name:           "#1: Image pulled by CRI agent",
+			workType:       ImageCacheCreate,
+			runtime:        "containerd://1.3.3",
+			agentReady:     true,
+			expectedPath:   criagent.PullPath,
+			expectedStatus: ImageWorkResultStatusSucceeded,
+		},
+		{
+			name:            "#2: Image pull by CRI agent failed",
+			workType:        ImageCacheCreate,
+			runtime:         "containerd://1.3.3",
+			agentReady:      true,
+			agentFails:      true,
+			expectedPath:    criagent.PullPath,
+			expectedStatus:  ImageWorkResultStatusFailed,
+			expectedMessage: "pulling image: not found",
+		},
+		{
+			name:           "#3: Image deleted by CRI agent",
+			workType:       ImageCachePurge,
+			runtime:        "cri-o://1.18.0",
+			agentReady:     true,
+			expectedPath:   criagent.RemovePath,
+			expectedStatus: ImageWorkResultStatusSucceeded,
+		},
+		{
+			name:           "#4: Docker runtime - Job created",
+			workType:       ImageCacheCreate,
+			runtime:        "docker://19.3.8",
+			agentReady:     true,
+			expectedJob:    true,
+			expectedStatus: ImageWorkResultStatusJobCreated,
+		},
+		{
+			name:           "#5: CRI agent not ready - Job created",
+			workType:       ImageCacheCreate,
+			runtime:        "containerd://1.3.3",
+			expectedJob:    true,
+			expectedStatus: ImageWorkResultStatusJobCreated,
+		},
+	}
+	for _, test := range tests {
+		var path string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path = r.URL.Path
+			if test.agentFails {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(criagent.Response{Message: "pulling image: not found"})
+			}
+		}))
+		host, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+		p, _ := strconv.Atoi(port)
+
+		jobCreated := false
+		fakekubeclientset := &fakeclientset.Clientset{}
+		fakekubeclientset.AddReactor("create", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			jobCreated = true
+			return true, &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "job1"}}, nil
+		})
+		imagemanager, podInformer := newTestImageManager(fakekubeclientset, "Always")
+		imagemanager.criAgentClient = criagent.NewClient(p, "token", nil)
+		podStatus := corev1.ConditionFalse
+		if test.agentReady {
+			podStatus = corev1.ConditionTrue
+		}
+		podInformer.Informer().GetIndexer().Add(&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "agent", Namespace: fledgedNameSpace, Labels: criagent.PodLabels},
+			Spec:       corev1.PodSpec{NodeName: agentNode.Name},
+			Status: corev1.PodStatus{
+				Phase:      corev1.PodRunning,
+				PodIP:      host,
+				Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: podStatus}},
+			},
+		})
+		imagemanager.imageworkqueue.Add(ImageWorkRequest{
+			Image:                   "foo:1.0",
+			Node:                    &agentNode,
+			ContainerRuntimeVersion: test.runtime,
+			WorkType:                test.workType,
+			Imagecache:              &imagecache,
+		})
+		imagemanager.processNextWorkItem(context.Background())
+		var iwres ImageWorkResult
+		for i := 0; i < 100; i++ {
+			imagemanager.lock.RLock()
+			for _, r := range imagemanager.imageworkstatus {
+				iwres = r
+			}
+			imagemanager.lock.RUnlock()
+			if iwres.Status != ImageWorkResultStatusJobCreated || test.expectedJob {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		server.Close()
+		if jobCreated != test.expectedJob {
+			t.Errorf("Test: %s failed: expectedJob=%t, actualJob=%t", test.name, test.expectedJob, jobCreated)
+		}
+		if path != test.expectedPath {
+			t.Errorf("Test: %s failed: expectedPath=%q, actualPath=%q", test.name, test.expectedPath, path)
+		}
+		if iwres.Status != test.expectedStatus || iwres.Message != test.expectedMessage {
+			t.Errorf("Test: %s failed: expectedWorkResult=%s/%s, actualWorkResult=%s/%s", test.name,
+				test.expectedStatus, test.expectedMessage, iwres.Status, iwres.Message)
+		}
+	}
+}
+
+func TestQueueProgress(t *testing.T) {
+	tests := []struct {
+		name         string
+		waiting      bool
+		processing   bool
+		queued       int
+		lastProgress time.Duration
+		expectErr    bool
+	}{
+		{
+			name:         "#1: Idle queue",
+			waiting:      true,
+			lastProgress: time.Hour,
+		},
+		{
+			name:         "#2: Items queued while worker waits",
+			waiting:      true,
+			queued:       3,
+			lastProgress: time.Hour,
+		},
+		{
+			name:         "#3: Items queued without worker since longer than threshold",
+			queued:       3,
+			lastProgress: time.Hour,
+			expectErr:    true,
+		},
+		{
+			name:         "#4: Items queued without worker within threshold",
+			queued:       3,
+			lastProgress: time.Second,
+		},
+		{
+			name:         "#5: Item under processing since longer than threshold",
+			processing:   true,
+			lastProgress: time.Hour,
+			expectErr:    true,
+		},
+		{
+			name:         "#6: Item under processing within threshold",
+			processing:   true,
+			queued:       1,
+			lastProgress: time.Second,
+		},
+	}
+	for _, test := range tests {
+		p := NewQueueProgress()
+		if test.waiting || test.processing {
+			p.Waiting()
+		}
+		if test.processing {
+			p.Started()
+		}
+		p.lastProgress = time.Now().Add(-test.lastProgress)
+		if err := p.Stalled(test.queued, time.Minute); (err != nil) != test.expectErr {
+			t.Errorf("Test: %s failed: expectErr=%t, actualErr=%v", test.name, test.expectErr, err)
+		}
+	}
+}
+
+func TestRegistryBreaker(t *testing.T) {
+	breaker := newRegistryBreaker(2, time.Hour)
+	if breaker.failed("docker.io") {
+		t.Errorf("Test failed: circuit opened after 1 failure")
+	}
+	if !breaker.failed("docker.io") {
+		t.Errorf("Test failed: circuit not opened after 2 failures")
+	}
+	if breaker.failed("docker.io") {
+		t.Errorf("Test failed: circuit opened again while open")
+	}
+	if allowed, until := breaker.allow("docker.io"); allowed || until.IsZero() {
+		t.Errorf("Test failed: pulls allowed while circuit is open")
+	}
+	if allowed, _ := breaker.allow("quay.io"); !allowed {
+		t.Errorf("Test failed: pulls from other registry not allowed")
+	}
+	breaker.succeeded("docker.io")
+	if allowed, _ := breaker.allow("docker.io"); !allowed {
+		t.Errorf("Test failed: pulls not allowed after success")
+	}
+	if breaker.failed("docker.io") {
+		t.Errorf("Test failed: failures not reset after success")
+	}
+
+	breaker = newRegistryBreaker(1, 0)
+	breaker.failed("docker.io")
+	if allowed, _ := breaker.allow("docker.io"); !allowed {
+		t.Errorf("Test failed: pulls not allowed after cooldown")
+	}
+
+	breaker = newRegistryBreaker(0, time.Hour)
+	if breaker.failed("docker.io") {
+		t.Errorf("Test failed: circuit opened with breaker disabled")
+	}
+}
+
+func TestRegistryHost(t *testing.T) {
+	tests := map[string]string{
+		"nginx:1.17":          "docker.io",
+		"quay.io/foo/bar:1.0": "quay.io",
+		"registry.local:5000/foo/bar@sha256:" + strings.Repeat("a", 64): "registry.local:5000",
+		"Invalid:Image": "",
+	}
+	for image, expected := range tests {
+		if host := RegistryHost(image); host != expected {
+			t.Errorf("Test failed: image %s: expected host %q, actual %q", image, expected, host)
+		}
+	}
+}
+
+func TestRegistryCircuitOpen(t *testing.T) {
+	imagecache := fledgedv1alpha1.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+	}
+	tests := []struct {
+		name           string
+		image          string
+		workType       WorkType
+		expectedJobs   int
+		expectedStatus string
+		expectedReason string
+	}{
+		{
+			name:           "#1: Pull from registry with open circuit fails without creating a job",
+			image:          "foo",
+			workType:       ImageCacheCreate,
+			expectedStatus: ImageWorkResultStatusFailed,
+			expectedReason: ImageWorkResultReasonRegistryCircuitOpen,
+		},
+		{
+			name:           "#2: Pull from other registry creates a job",
+			image:          "quay.io/foo",
+			workType:       ImageCacheCreate,
+			expectedJobs:   1,
+			expectedStatus: ImageWorkResultStatusJobCreated,
+		},
+		{
+			name:           "#3: Purge from registry with open circuit creates a job",
+			image:          "foo",
+			workType:       ImageCachePurge,
+			expectedJobs:   1,
+			expectedStatus: ImageWorkResultStatusJobCreated,
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := &fakeclientset.Clientset{}
+		jobs := 0
+		fakekubeclientset.AddReactor("create", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			jobs++
+			job := action.(core.CreateAction).GetObject().(*batchv1.Job)
+			job.Name = "fakejob"
+			return true, job, nil
+		})
+		imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent")
+		imagemanager.registryBreaker = newRegistryBreaker(1, time.Hour)
+		imagemanager.registryBreaker.failed("docker.io")
+		iwr := ImageWorkRequest{Image: test.image, Node: &node, ContainerRuntimeVersion: "containerd://1.3.3", WorkType: test.workType, Imagecache: &imagecache}
+		imagemanager.imageworkqueue.Add(iwr)
+		imagemanager.processNextWorkItem(context.Background())
+		if jobs != test.expectedJobs {
+			t.Errorf("Test: %s failed: expectedJobs=%d, actualJobs=%d", test.name, test.expectedJobs, jobs)
+		}
+		if len(imagemanager.imageworkstatus) != 1 {
+			t.Errorf("Test: %s failed: expected 1 image work result, actual %d", test.name, len(imagemanager.imageworkstatus))
+			continue
+		}
+		for _, iwres := range imagemanager.imageworkstatus {
+			if iwres.Status != test.expectedStatus || iwres.Reason != test.expectedReason {
+				t.Errorf("Test: %s failed: expected %s/%s, actual %s/%s", test.name, test.expectedStatus, test.expectedReason, iwres.Status, iwres.Reason)
+			}
+		}
+	}
+}
+
+func TestJobRetention(t *testing.T) {
+	tests := []struct {
+		name         string
+		jobRetention time.Duration
+	}{
+		{
+			name: "#1: No retention - Job deleted right away",
+		},
+		{
+			name:         "#2: Retention - Job deletion scheduled",
+			jobRetention: 100 * time.Millisecond,
+		},
+	}
+	for _, test := range tests {
+		deleted := make(chan time.Time, 1)
+		fakekubeclientset := &fakeclientset.Clientset{}
+		fakekubeclientset.AddReactor("delete", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			deleted <- time.Now()
+			return true, nil, nil
+		})
+		imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent")
+		imagemanager.jobRetention = test.jobRetention
+		start := time.Now()
+		if err := imagemanager.deleteJob(fledgedNameSpace, "foo-abcde"); err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%v", test.name, err)
+			continue
+		}
+		select {
+		case deletedTime := <-deleted:
+			if deletedTime.Sub(start) < test.jobRetention {
+				t.Errorf("Test: %s failed: job deleted after %s, before retention of %s", test.name, deletedTime.Sub(start), test.jobRetention)
+			}
+		case <-time.After(test.jobRetention + time.Second):
+			t.Errorf("Test: %s failed: job not deleted", test.name)
+		}
+	}
+}
+
+func TestKeepFailedJobs(t *testing.T) {
+	imageCacheName := "fakeimagecache"
+	tests := []struct {
+		name           string
+		keepFailedJobs bool
+		expectedJobs   []string
+	}{
+		{name: "#1: All jobs deleted", expectedJobs: []string{"failedjob", "succeededjob"}},
+		{name: "#2: Failed job kept", keepFailedJobs: true, expectedJobs: []string{"succeededjob"}},
+	}
+	for _, test := range tests {
+		fakekubeclientset := &fakeclientset.Clientset{}
+		var lock sync.Mutex
+		deleted := []string{}
+		fakekubeclientset.AddReactor("delete", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			lock.Lock()
+			defer lock.Unlock()
+			deleted = append(deleted, action.(core.DeleteAction).GetName())
+			return true, nil, nil
+		})
+		imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent")
+		imagemanager.keepFailedJobs = test.keepFailedJobs
+		imageCache := &fledgedv1alpha1.ImageCache{ObjectMeta: metav1.ObjectMeta{Name: imageCacheName}}
+		imagemanager.imageworkstatus = map[string]ImageWorkResult{
+			"succeededjob": {ImageWorkRequest: ImageWorkRequest{Image: "foo", Imagecache: imageCache, Node: &node}, Status: ImageWorkResultStatusSucceeded},
+			"failedjob":    {ImageWorkRequest: ImageWorkRequest{Image: "bar", Imagecache: imageCache, Node: &node}, Status: ImageWorkResultStatusFailed},
+		}
+		errCh := make(chan error)
+		go imagemanager.updateImageCacheStatus(context.Background(), imageCacheName, errCh)
+		if err := <-errCh; err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%v", test.name, err)
+			continue
+		}
+		lock.Lock()
+		sort.Strings(deleted)
+		if !reflect.DeepEqual(deleted, test.expectedJobs) {
+			t.Errorf("Test: %s failed: expected deleted jobs %v, actual %v", test.name, test.expectedJobs, deleted)
+		}
+		lock.Unlock()
+		if len(imagemanager.imageworkstatus) != 0 {
+			t.Errorf("Test: %s failed: expected no outstanding image work, actual %d", test.name, len(imagemanager.imageworkstatus))
+		}
+	}
+}
+
+func TestJobName(t *testing.T) {
+	imageCache := &fledgedv1alpha1.ImageCache{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "kube-fledged"}}
+	otherNode := corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "othernode"}}
+	iwr := ImageWorkRequest{Image: "nginx:1.17", Node: &node, WorkType: ImageCacheCreate, Imagecache: imageCache}
+	name := jobName(iwr, 0)
+	if !strings.HasPrefix(name, "foo-") || len(name) != len("foo-")+10 {
+		t.Errorf("Test failed: unexpected job name %s", name)
+	}
+	if again := jobName(iwr, 0); again != name {
+		t.Errorf("Test failed: expected the same job name %s for the same work, actual %s", name, again)
+	}
+	for _, other := range []ImageWorkRequest{
+		{Image: "nginx:1.18", Node: &node, WorkType: ImageCacheCreate, Imagecache: imageCache},
+		{Image: "nginx:1.17", Node: &otherNode, WorkType: ImageCacheCreate, Imagecache: imageCache},
+		{Image: "nginx:1.17", Node: &node, WorkType: ImageCachePurge, Imagecache: imageCache},
+	} {
+		if jobName(other, 0) == name {
+			t.Errorf("Test failed: expected different job names for %s --> %s (%s)", other.Image, other.Node.Name, other.WorkType)
+		}
+	}
+	if jobName(iwr, 1) == name {
+		t.Errorf("Test failed: expected different job names for different attempts")
+	}
+	longImageCache := &fledgedv1alpha1.ImageCache{ObjectMeta: metav1.ObjectMeta{Name: strings.Repeat("a", 100), Namespace: "kube-fledged"}}
+	if name := jobName(ImageWorkRequest{Image: "nginx", Node: &node, Imagecache: longImageCache}, 0); len(name) > 63 {
+		t.Errorf("Test failed: job name %s longer than 63 characters", name)
+	}
+}
+
+func TestCreateJob(t *testing.T) {
+	imageCache := &fledgedv1alpha1.ImageCache{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace}}
+	iwr := ImageWorkRequest{Image: "nginx:1.17", Node: &node, WorkType: ImageCacheCreate, Imagecache: imageCache}
+	tests := []struct {
+		name             string
+		existingJob      *batchv1.Job
+		expectReused     bool
+		expectedJobNames []string
+	}{
+		{
+			name:             "#1: Job created with deterministic name",
+			expectedJobNames: []string{jobName(iwr, 0)},
+		},
+		{
+			name:             "#2: Running job reused",
+			existingJob:      &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: jobName(iwr, 0), Namespace: fledgedNameSpace}},
+			expectReused:     true,
+			expectedJobNames: []string{jobName(iwr, 0)},
+		},
+		{
+			name: "#3: Finished job not reused",
+			existingJob: &batchv1.Job{
+				ObjectMeta: metav1.ObjectMeta{Name: jobName(iwr, 0), Namespace: fledgedNameSpace},
+				Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{
+					{Type: batchv1.JobFailed, Status: corev1.ConditionTrue},
+				}},
+			},
+			expectedJobNames: []string{"", jobName(iwr, 0)},
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := fakeclientset.NewSimpleClientset()
+		if test.existingJob != nil {
+			fakekubeclientset = fakeclientset.NewSimpleClientset(test.existingJob)
+		}
+		imagemanager, _ := newTestImageManager(fakekubeclientset, "IfNotPresent")
+		newjob, err := newImagePullJob(iwr, "IfNotPresent")
+		if err != nil {
+			t.Fatalf("Test: %s failed: %v", test.name, err)
+		}
+		job, err := imagemanager.createJob(newjob, iwr)
+		if err != nil {
+			t.Errorf("Test: %s failed: expectedError=nil, actualError=%v", test.name, err)
+			continue
+		}
+		if reused := job.Name == jobName(iwr, 0) && test.existingJob != nil; reused != test.expectReused {
+			t.Errorf("Test: %s failed: expected job reused %t, actual %t", test.name, test.expectReused, reused)
+		}
+		jobs, _ := fakekubeclientset.BatchV1().Jobs(fledgedNameSpace).List(metav1.ListOptions{})
+		jobNames := []string{}
+		for _, j := range jobs.Items {
+			jobNames = append(jobNames, j.Name)
+		}
+		sort.Strings(jobNames)
+		if !reflect.DeepEqual(jobNames, test.expectedJobNames) {
+			t.Errorf("Test: %s failed: expected jobs %v, actual %v", test.name, test.expectedJobNames, jobNames)
+		}
+	}
+}
+
+func TestAdoptJob(t *testing.T) {
+	imageCache := &fledgedv1alpha1.ImageCache{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: fledgedNameSpace}}
+	iwr := ImageWorkRequest{Image: "foo", Node: &node, ContainerRuntimeVersion: "containerd://1.5.0", WorkType: ImageCacheRefresh, Imagecache: imageCache}
+	// The job was created by a reconcile of another work type
+	createIWR := iwr
+	createIWR.WorkType = ImageCacheCreate
+	tests := []struct {
+		name           string
+		annotations    map[string]string
+		podPhase       corev1.PodPhase
+		expectAdopted  bool
+		expectedJobs   int
+		expectedStatus string
+	}{
+		{
+			name:           "#1: Running job adopted",
+			annotations:    map[string]string{imageWorkAnnotationKey: imageWorkKey(createIWR)},
+			podPhase:       corev1.PodRunning,
+			expectAdopted:  true,
+			expectedStatus: ImageWorkResultStatusJobCreated,
+		},
+		{
+			name:           "#2: Job whose pod succeeded adopted",
+			annotations:    map[string]string{imageWorkAnnotationKey: imageWorkKey(createIWR)},
+			podPhase:       corev1.PodSucceeded,
+			expectAdopted:  true,
+			expectedStatus: ImageWorkResultStatusSucceeded,
+		},
+		{
+			name:           "#3: Job whose pod failed adopted",
+			annotations:    map[string]string{imageWorkAnnotationKey: imageWorkKey(createIWR)},
+			podPhase:       corev1.PodFailed,
+			expectAdopted:  true,
+			expectedStatus: ImageWorkResultStatusFailed,
+		},
+		{
+			name:           "#4: Job of other image work not reused",
+			annotations:    map[string]string{imageWorkAnnotationKey: "pull kube-fledged/foo bar nginx:1.17"},
+			podPhase:       corev1.PodRunning,
+			expectAdopted:  true,
+			expectedJobs:   1,
+			expectedStatus: ImageWorkResultStatusJobCreated,
+		},
+		{
+			name:           "#5: Job without image work not adopted",
+			podPhase:       corev1.PodRunning,
+			expectedJobs:   1,
+			expectedStatus: ImageWorkResultStatusJobCreated,
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := &fakeclientset.Clientset{}
+		jobs := 0
+		fakekubeclientset.AddReactor("create", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			jobs++
+			return true, action.(core.CreateAction).GetObject(), nil
+		})
+		imagemanager, podInformer := newTestImageManager(fakekubeclientset, "IfNotPresent")
+		job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "foo-adopted", Namespace: fledgedNameSpace, Annotations: test.annotations}}
+		podInformer.Informer().GetIndexer().Add(&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "foo-adopted-abcde", Namespace: fledgedNameSpace, Labels: map[string]string{"job-name": job.Name}},
+			Status:     corev1.PodStatus{Phase: test.podPhase},
+		})
+		if adopted := imagemanager.AdoptJob(job); adopted != test.expectAdopted {
+			t.Errorf("Test: %s failed: expected adopted %t, actual %t", test.name, test.expectAdopted, adopted)
+		}
+		imagemanager.imageworkqueue.Add(iwr)
+		imagemanager.processNextWorkItem(context.Background())
+		if jobs != test.expectedJobs {
+			t.Errorf("Test: %s failed: expectedJobs=%d, actualJobs=%d", test.name, test.expectedJobs, jobs)
+		}
+		for workName, iwres := range imagemanager.imageworkstatus {
+			if iwres.Status != test.expectedStatus {
+				t.Errorf("Test: %s failed: expected status %s, actual %s", test.name, test.expectedStatus, iwres.Status)
+			}
+			if reused := workName == job.Name; reused != (test.expectedJobs == 0) {
+				t.Errorf("Test: %s failed: expected job reused %t, actual job %s", test.name, test.expectedJobs == 0, workName)
+			}
+		}
+	}
+}
+
+func TestRetryNodeNotReadyWork(t *testing.T) {
+	tests := []struct {
+		name              string
+		podStatus         corev1.PodStatus
+		jobAge            time.Duration
+		sinceStart        time.Duration
+		nodeReadinessWait time.Duration
+		expectRetry       bool
+	}{
+		{
+			name: "#1: Pod not scheduled - Retried",
+			podStatus: corev1.PodStatus{
+				Phase:      corev1.PodPending,
+				Conditions: []corev1.PodCondition{{Type: corev1.PodScheduled, Status: corev1.ConditionFalse, Message: "node(s) had taint node.kubernetes.io/not-ready"}},
+			},
+			jobAge:            time.Second,
+			sinceStart:        time.Second,
+			nodeReadinessWait: time.Minute,
+			expectRetry:       true,
 		},
 		{
-			name: "#2: Purge - Successful",
-			iwr: ImageWorkRequest{
-				Image:      "fakeimage",
-				Node:       &node,
-				WorkType:   ImageCachePurge,
-				Imagecache: &defaultImageCache,
-			},
-			imageworkstatus: map[string]ImageWorkResult{
-				"fakejob": {
-					ImageWorkRequest: ImageWorkRequest{
-						Imagecache: &fledgedv1alpha1.ImageCache{
-							ObjectMeta: metav1.ObjectMeta{
-								Name: defaultImageCache.Name,
-							},
-						},
-					},
-					Status: ImageWorkResultStatusSucceeded,
-				},
-			},
-			pods: []corev1.Pod{
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Namespace: fledgedNameSpace,
-						Labels:    map[string]string{"job-name": "fakejob"},
-					},
-					Status: corev1.PodStatus{
-						Phase: corev1.PodPending,
-						ContainerStatuses: []corev1.ContainerStatus{
-							{
-								State: corev1.ContainerState{
-									Terminated: &corev1.ContainerStateTerminated{
-										Reason:  "fakereason",
-										Message: "fakemessage",
-									},
-								},
-							},
-						},
-					},
-				},
-			},
-			expectError: false,
+			name:              "#2: Pod not started by kubelet - Retried",
+			podStatus:         corev1.PodStatus{Phase: corev1.PodPending},
+			jobAge:            time.Second,
+			sinceStart:        time.Second,
+			nodeReadinessWait: time.Minute,
+			expectRetry:       true,
 		},
 		{
-			name: "#3: Statusupdate - Successful",
-			iwr: ImageWorkRequest{
-				WorkType:   ImageCacheCreate,
-				Imagecache: &defaultImageCache,
-			},
-			imageworkstatus: map[string]ImageWorkResult{
-				"fakejob": {
-					ImageWorkRequest: ImageWorkRequest{
-						Imagecache: &fledgedv1alpha1.ImageCache{
-							ObjectMeta: metav1.ObjectMeta{
-								Name: defaultImageCache.Name,
-							},
-						},
-					},
-					Status: ImageWorkResultStatusSucceeded,
-				},
-			},
-			pods: []corev1.Pod{
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Namespace: fledgedNameSpace,
-						Labels:    map[string]string{"job-name": "fakejob"},
-					},
-					Status: corev1.PodStatus{
-						Phase: corev1.PodPending,
-						ContainerStatuses: []corev1.ContainerStatus{
-							{
-								State: corev1.ContainerState{
-									Terminated: &corev1.ContainerStateTerminated{
-										Reason:  "fakereason",
-										Message: "fakemessage",
-									},
-								},
-							},
-						},
-					},
+			name: "#3: Pod pending on image pull error - Not retried",
+			podStatus: corev1.PodStatus{
+				Phase: corev1.PodPending,
+				ContainerStatuses: []corev1.ContainerStatus{
+					{Name: "imagepuller", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ErrImagePull"}}},
 				},
 			},
-			expectError: false,
+			jobAge:            time.Second,
+			sinceStart:        time.Second,
+			nodeReadinessWait: time.Minute,
 		},
 		{
-			name:                "#4: Create - Unsuccessful",
-			expectError:         false,
-			expectedErrorString: "Unexpected type in workqueue",
+			name:              "#4: Node readiness wait expired - Not retried",
+			podStatus:         corev1.PodStatus{Phase: corev1.PodPending},
+			jobAge:            time.Second,
+			sinceStart:        time.Minute * 2,
+			nodeReadinessWait: time.Minute,
 		},
 		{
-			name: "#5: Create - Successful (Image not present in Node)",
-			iwr: ImageWorkRequest{
-				Image:      "foo:v1",
-				Node:       &node,
-				WorkType:   ImageCacheCreate,
-				Imagecache: &defaultImageCache,
+			name:              "#5: Job within pull deadline - Not retried",
+			podStatus:         corev1.PodStatus{Phase: corev1.PodPending},
+			sinceStart:        time.Second,
+			nodeReadinessWait: time.Minute,
+		},
+		{
+			name:       "#6: No node readiness wait - Not retried",
+			podStatus:  corev1.PodStatus{Phase: corev1.PodPending},
+			jobAge:     time.Second,
+			sinceStart: time.Second,
+		},
+	}
+	for _, test := range tests {
+		imagemanager, podInformer := newTestImageManager(&fakeclientset.Clientset{}, "IfNotPresent")
+		imagemanager.nodeReadinessWait = test.nodeReadinessWait
+		podInformer.Informer().GetIndexer().Add(&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "fakejob-abcde",
+				Namespace: fledgedNameSpace,
+				Labels:    map[string]string{"job-name": "fakejob"},
 			},
-			imageworkstatus: map[string]ImageWorkResult{
-				"fakejob": {
-					ImageWorkRequest: ImageWorkRequest{
-						Imagecache: &fledgedv1alpha1.ImageCache{
-							ObjectMeta: metav1.ObjectMeta{
-								Name: defaultImageCache.Name,
-							},
-						},
-					},
-					Status: ImageWorkResultStatusSucceeded,
-				},
+			Status: test.podStatus,
+		})
+		iwr := ImageWorkRequest{
+			Image:      "foo",
+			Node:       &node,
+			WorkType:   ImageCacheCreate,
+			Imagecache: &fledgedv1alpha1.ImageCache{ObjectMeta: metav1.ObjectMeta{Name: "fakeimagecache"}},
+		}
+		imagemanager.imageworkstatus = map[string]ImageWorkResult{
+			"fakejob": {
+				ImageWorkRequest: iwr,
+				Status:           ImageWorkResultStatusJobCreated,
+				JobCreationTime:  time.Now().Add(-test.jobAge),
 			},
-			pods: []corev1.Pod{
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Namespace: fledgedNameSpace,
-						Labels:    map[string]string{"job-name": "fakejob"},
-					},
-					Status: corev1.PodStatus{
-						Phase: corev1.PodPending,
-						ContainerStatuses: []corev1.ContainerStatus{
-							{
-								State: corev1.ContainerState{
-									Terminated: &corev1.ContainerStateTerminated{
-										Reason:  "fakereason",
-										Message: "fakemessage",
-									},
-								},
-							},
-						},
-					},
+		}
+		imagemanager.retryNodeNotReadyWork("fakeimagecache", time.Now().Add(-test.sinceStart))
+		iwres := imagemanager.imageworkstatus["fakejob"]
+		if retried := iwres.Status == ImageWorkResultStatusRetrying; retried != test.expectRetry {
+			t.Errorf("Test: %s failed: expectRetry=%t, actualStatus=%s", test.name, test.expectRetry, iwres.Status)
+			continue
+		}
+		if !test.expectRetry {
+			continue
+		}
+		if iwres.Reason != ImageWorkResultReasonNodeNotReady || !imagemanager.waitingForNodes[iwr] {
+			t.Errorf("Test: %s failed: expectedReason=%s, actualReason=%s, waitingForNode=%t", test.name, ImageWorkResultReasonNodeNotReady, iwres.Reason, imagemanager.waitingForNodes[iwr])
+		}
+		if imagemanager.imageworkqueue.Len() != 1 {
+			t.Errorf("Test: %s failed: image work request not queued for retry", test.name)
+		}
+	}
+}
+
+func TestFailUnscheduledWork(t *testing.T) {
+	tests := []struct {
+		name              string
+		pod               corev1.Pod
+		jobAge            time.Duration
+		expired           bool
+		expectedMessage   string
+		expectForceDelete bool
+	}{
+		{
+			name: "#1: Pod never scheduled - Failed",
+			pod: corev1.Pod{
+				Status: corev1.PodStatus{
+					Phase:      corev1.PodPending,
+					Conditions: []corev1.PodCondition{{Type: corev1.PodScheduled, Status: corev1.ConditionFalse, Message: "0/3 nodes are available: 3 Insufficient memory."}},
 				},
 			},
-			imagepullpolicy: "IfNotPresent",
-			expectError:     false,
+			jobAge:            time.Second,
+			expectedMessage:   "Pod never scheduled: 0/3 nodes are available: 3 Insufficient memory.",
+			expectForceDelete: true,
 		},
 		{
-			name: "#6: Create - Successful (Image already present in Node)",
-			iwr: ImageWorkRequest{
-				Image:      "foo:v1",
-				Node:       &testnode,
-				WorkType:   ImageCacheCreate,
-				Imagecache: &defaultImageCache,
-			},
-			imageworkstatus: map[string]ImageWorkResult{
-				"fakejob": {
-					ImageWorkRequest: ImageWorkRequest{
-						Imagecache: &fledgedv1alpha1.ImageCache{
-							ObjectMeta: metav1.ObjectMeta{
-								Name: defaultImageCache.Name,
-							},
-						},
-					},
-					Status: ImageWorkResultStatusSucceeded,
-				},
-			},
-			pods: []corev1.Pod{
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Namespace: fledgedNameSpace,
-						Labels:    map[string]string{"job-name": "fakejob"},
-					},
-					Status: corev1.PodStatus{
-						Phase: corev1.PodPending,
-						ContainerStatuses: []corev1.ContainerStatus{
-							{
-								State: corev1.ContainerState{
-									Terminated: &corev1.ContainerStateTerminated{
-										Reason:  "fakereason",
-										Message: "fakemessage",
-									},
-								},
-							},
-						},
-					},
-				},
+			name:              "#2: Perpetually pending pod without container statuses - Failed",
+			pod:               corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodPending}},
+			jobAge:            time.Second,
+			expectedMessage:   "Pod never scheduled",
+			expectForceDelete: true,
+		},
+		{
+			name:              "#3: Deadline of all work expired - Failed",
+			pod:               corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodPending}},
+			expired:           true,
+			expectedMessage:   "Pod never scheduled",
+			expectForceDelete: true,
+		},
+		{
+			name: "#4: Job within pull deadline - Not failed",
+			pod:  corev1.Pod{Status: corev1.PodStatus{Phase: corev1.PodPending}},
+		},
+		{
+			name: "#5: Pod scheduled to a node - Not failed",
+			pod: corev1.Pod{
+				Spec:   corev1.PodSpec{NodeName: "fakenode"},
+				Status: corev1.PodStatus{Phase: corev1.PodPending},
 			},
-			imagepullpolicy: "IfNotPresent",
-			expectError:     false,
+			jobAge: time.Second,
 		},
 	}
 	for _, test := range tests {
 		fakekubeclientset := &fakeclientset.Clientset{}
-		imagemanager, podInformer := newTestImageManager(fakekubeclientset, test.imagepullpolicy)
-		for _, pod := range test.pods {
-			if !reflect.DeepEqual(pod, corev1.Pod{}) {
-				podInformer.Informer().GetIndexer().Add(&pod)
-			}
+		imagemanager, podInformer := newTestImageManager(fakekubeclientset, "IfNotPresent")
+		imagemanager.imagePullDeadlineDuration = 100 * time.Millisecond
+		pod := test.pod
+		pod.ObjectMeta = metav1.ObjectMeta{
+			Name:      "fakejob-abcde",
+			Namespace: fledgedNameSpace,
+			Labels:    map[string]string{"job-name": "fakejob"},
 		}
-		imagemanager.imageworkstatus = test.imageworkstatus
-		if test.expectedErrorString == "Unexpected type in workqueue" {
-			imagemanager.imageworkqueue.Add(struct{}{})
+		podInformer.Informer().GetIndexer().Add(&pod)
+		iwr := ImageWorkRequest{
+			Image:      "foo",
+			Node:       &node,
+			WorkType:   ImageCacheCreate,
+			Imagecache: &fledgedv1alpha1.ImageCache{ObjectMeta: metav1.ObjectMeta{Name: "fakeimagecache"}},
 		}
-		imagemanager.imageworkqueue.Add(test.iwr)
-		imagemanager.processNextWorkItem()
-		var err error
-		if test.expectError {
-			if err == nil {
-				t.Errorf("Test: %s failed: expectedError=%s, actualError=nil", test.name, test.expectedErrorString)
+		imagemanager.imageworkstatus = map[string]ImageWorkResult{
+			"fakejob": {
+				ImageWorkRequest: iwr,
+				Status:           ImageWorkResultStatusJobCreated,
+				JobCreationTime:  time.Now().Add(-test.jobAge),
+			},
+		}
+		imagemanager.failUnscheduledWork("fakeimagecache", test.expired)
+		iwres := imagemanager.imageworkstatus["fakejob"]
+		if test.expectedMessage == "" {
+			if iwres.Status != ImageWorkResultStatusJobCreated {
+				t.Errorf("Test: %s failed: expected status %s, actual %s", test.name, ImageWorkResultStatusJobCreated, iwres.Status)
 			}
-			if err != nil && !strings.HasPrefix(err.Error(), test.expectedErrorString) {
-				t.Errorf("Test: %s failed: expectedError=%s, actualError=%s", test.name, test.expectedErrorString, err.Error())
+		} else if iwres.Status != ImageWorkResultStatusFailed || iwres.Reason != ImageWorkResultReasonPodNeverScheduled ||
+			iwres.Message != test.expectedMessage || iwres.PodName != "fakejob-abcde" {
+			t.Errorf("Test: %s failed: expected failure %s: %s, actual %s %s: %s (pod %s)", test.name, ImageWorkResultReasonPodNeverScheduled,
+				test.expectedMessage, iwres.Status, iwres.Reason, iwres.Message, iwres.PodName)
+		}
+		var deleted []string
+		for _, action := range fakekubeclientset.Actions() {
+			if action.GetVerb() == "delete" {
+				deleted = append(deleted, action.GetResource().Resource+"/"+action.(core.DeleteAction).GetName())
 			}
-		} else if err != nil {
-			t.Errorf("Test: %s failed. expectedError=nil, actualError=%s", test.name, err.Error())
+		}
+		if expected := []string{"jobs/fakejob", "pods/fakejob-abcde"}; test.expectForceDelete != reflect.DeepEqual(deleted, expected) {
+			t.Errorf("Test: %s failed: expectForceDelete=%t, actual deletes %v", test.name, test.expectForceDelete, deleted)
+		}
+	}
+}
+
+func TestImageInUse(t *testing.T) {
+	imagecache := fledgedv1alpha1.ImageCache{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "kube-fledged",
+		},
+	}
+	tests := []struct {
+		name           string
+		inUseBy        string
+		pullPolicy     string
+		platform       string
+		expectedJobs   int
+		expectedStatus string
+		expectedReason string
+	}{
+		{
+			name:           "#1: Image in use - Job not created",
+			inUseBy:        "kube-system/foo-ds-abcde",
+			pullPolicy:     "IfNotPresent",
+			expectedStatus: ImageWorkResultStatusAlreadyPulled,
+			expectedReason: ImageWorkResultReasonImageInUse,
+		},
+		{
+			name:           "#2: Image not in use - Job created",
+			pullPolicy:     "IfNotPresent",
+			expectedJobs:   1,
+			expectedStatus: ImageWorkResultStatusJobCreated,
+		},
+		{
+			name:           "#3: Image in use pulled always - Job created",
+			inUseBy:        "kube-system/foo-ds-abcde",
+			pullPolicy:     "Always",
+			expectedJobs:   1,
+			expectedStatus: ImageWorkResultStatusJobCreated,
+		},
+		{
+			name:           "#4: Image in use pulled for a platform - Job created",
+			inUseBy:        "kube-system/foo-ds-abcde",
+			pullPolicy:     "IfNotPresent",
+			platform:       "linux/arm64",
+			expectedJobs:   1,
+			expectedStatus: ImageWorkResultStatusJobCreated,
+		},
+	}
+	for _, test := range tests {
+		fakekubeclientset := &fakeclientset.Clientset{}
+		jobs := 0
+		fakekubeclientset.AddReactor("create", "jobs", func(action core.Action) (handled bool, ret runtime.Object, err error) {
+			jobs++
+			job := action.(core.CreateAction).GetObject().(*batchv1.Job)
+			job.Name = "fakejob"
+			return true, job, nil
+		})
+		imagemanager, _ := newTestImageManager(fakekubeclientset, test.pullPolicy)
+		iwr := ImageWorkRequest{Image: "foo", Node: &node, ContainerRuntimeVersion: "containerd://1.5.0", WorkType: ImageCacheCreate,
+			Imagecache: &imagecache, InUseBy: test.inUseBy, Platform: test.platform}
+		imagemanager.imageworkqueue.Add(iwr)
+		imagemanager.processNextWorkItem(context.Background())
+		if jobs != test.expectedJobs {
+			t.Errorf("Test: %s failed: expectedJobs=%d, actualJobs=%d", test.name, test.expectedJobs, jobs)
+		}
+		for _, iwres := range imagemanager.imageworkstatus {
+			if iwres.Status != test.expectedStatus || iwres.Reason != test.expectedReason {
+				t.Errorf("Test: %s failed: expected %s/%s, actual %s/%s", test.name, test.expectedStatus, test.expectedReason, iwres.Status, iwres.Reason)
+			}
+		}
+	}
+}
+
+func TestImageUsedByPod(t *testing.T) {
+	running := corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}
+	waiting := corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ErrImagePull"}}
+	digest := "sha256:" + strings.Repeat("a", 64)
+	tests := []struct {
+		name     string
+		image    string
+		spec     string
+		status   corev1.ContainerStatus
+		expected bool
+	}{
+		{
+			name:     "#1: Tag matches normalized image of container",
+			image:    "nginx",
+			spec:     "docker.io/library/nginx:latest",
+			status:   corev1.ContainerStatus{Name: "app", State: running},
+			expected: true,
+		},
+		{
+			name:     "#2: Digest matches image id of container",
+			image:    "nginx@" + digest,
+			spec:     "nginx:1.25",
+			status:   corev1.ContainerStatus{Name: "app", State: running, ImageID: "docker-pullable://nginx@" + digest},
+			expected: true,
+		},
+		{
+			name:   "#3: Different tag",
+			image:  "nginx:1.24",
+			spec:   "nginx:1.25",
+			status: corev1.ContainerStatus{Name: "app", State: running, Image: "docker.io/library/nginx:1.25", ImageID: "docker.io/library/nginx@" + digest},
+		},
+		{
+			name:   "#4: Tag does not match digest of container",
+			image:  "nginx:1.25",
+			spec:   "nginx@" + digest,
+			status: corev1.ContainerStatus{Name: "app", State: running, ImageID: "docker.io/library/nginx@" + digest},
+		},
+		{
+			name:   "#5: Container never started",
+			image:  "nginx:1.25",
+			spec:   "nginx:1.25",
+			status: corev1.ContainerStatus{Name: "app", State: waiting},
+		},
+		{
+			name:     "#6: Container restarting after it terminated",
+			image:    "quay.io/foo/bar:v1",
+			spec:     "quay.io/foo/bar:v1",
+			status:   corev1.ContainerStatus{Name: "app", State: waiting, LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1}}},
+			expected: true,
+		},
+	}
+	for _, test := range tests {
+		pod := &corev1.Pod{
+			Spec:   corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: test.spec}}},
+			Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{test.status}},
+		}
+		if used, err := ImageUsedByPod(test.image, pod); err != nil || used != test.expected {
+			t.Errorf("Test: %s failed: expected %t, actual %t (err: %v)", test.name, test.expected, used, err)
 		}
 	}
 }
@@ -0,0 +1,117 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// ImageWorkStatus is the point-in-time status of an image pull or delete tracked by the image manager
+type ImageWorkStatus struct {
+	ImageCache string   `json:"imageCache"`
+	Image      string   `json:"image"`
+	Node       string   `json:"node"`
+	WorkType   WorkType `json:"workType"`
+	Status     string   `json:"status"`
+	Reason     string   `json:"reason,omitempty"`
+	Message    string   `json:"message,omitempty"`
+	// Job is empty if no job was created for the image work e.g. the image is already present in the node
+	Job string `json:"job,omitempty"`
+	// Pod is the last pod of the job, once known
+	Pod             string     `json:"pod,omitempty"`
+	JobCreationTime *time.Time `json:"jobCreationTime,omitempty"`
+	CompletionTime  *time.Time `json:"completionTime,omitempty"`
+	Digest          string     `json:"digest,omitempty"`
+	Source          string     `json:"source,omitempty"`
+}
+
+// ImageWorkStatuses returns a snapshot of the statuses of the image pulls and deletes tracked by the
+// image manager i.e. those of image caches under processing, sorted by image cache, image and node
+func (m *ImageManager) ImageWorkStatuses() []ImageWorkStatus {
+	m.lock.RLock()
+	statuses := make([]ImageWorkStatus, 0, len(m.imageworkstatus))
+	for job, iwres := range m.imageworkstatus {
+		iwr := iwres.ImageWorkRequest
+		s := ImageWorkStatus{
+			Image:    iwr.Image,
+			WorkType: iwr.WorkType,
+			Status:   iwres.Status,
+			Reason:   iwres.Reason,
+			Message:  iwres.Message,
+			Digest:   iwres.Digest,
+			Source:   iwres.Source,
+			Pod:      iwres.PodName,
+		}
+		if iwr.Imagecache != nil {
+			s.ImageCache = iwr.Imagecache.Namespace + "/" + iwr.Imagecache.Name
+		}
+		if iwr.Node != nil {
+			s.Node = iwr.Node.Labels["kubernetes.io/hostname"]
+		}
+		if isJob(job) {
+			s.Job = job
+		}
+		if !iwres.JobCreationTime.IsZero() {
+			jobCreationTime := iwres.JobCreationTime
+			s.JobCreationTime = &jobCreationTime
+		}
+		if !iwres.CompletionTime.IsZero() {
+			completionTime := iwres.CompletionTime
+			s.CompletionTime = &completionTime
+		}
+		statuses = append(statuses, s)
+	}
+	m.lock.RUnlock()
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].ImageCache != statuses[j].ImageCache {
+			return statuses[i].ImageCache < statuses[j].ImageCache
+		}
+		if statuses[i].Image != statuses[j].Image {
+			return statuses[i].Image < statuses[j].Image
+		}
+		return statuses[i].Node < statuses[j].Node
+	})
+	return statuses
+}
+
+// StatusHandler returns a read-only HTTP handler that serves the snapshot of the statuses of
+// the image pulls and deletes tracked by the image manager as JSON
+func (m *ImageManager) StatusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		data, err := json.Marshal(struct {
+			Time  time.Time         `json:"time"`
+			Items []ImageWorkStatus `json:"items"`
+		}{time.Now(), m.ImageWorkStatuses()})
+		if err != nil {
+			glog.Errorf("Error encoding image work statuses: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	})
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+// Statuses of image work results
+const (
+	// ImageWorkResultStatusSucceeded means image pull/delete succeeded
+	ImageWorkResultStatusSucceeded = "succeeded"
+	// ImageWorkResultStatusFailed means image pull/delete failed
+	ImageWorkResultStatusFailed = "failed"
+	// ImageWorkResultStatusJobCreated means job for image pull/delete created, or the
+	// image pull/delete is under way by the CRI agent of the node
+	ImageWorkResultStatusJobCreated = "jobcreated"
+	//ImageWorkResultStatusAlreadyPulled  means image is already present in the node
+	ImageWorkResultStatusAlreadyPulled = "alreadypulled"
+	// ImageWorkResultStatusRetrying means image pull failed and is queued to be retried
+	ImageWorkResultStatusRetrying = "retrying"
+)
+
+// imageWorkResultStatusTransitions are the statuses to which each status of an image work result may
+// change. Image work not yet started has the empty status, and fails without a job e.g. if the image
+// cannot be pulled in the node. A retried image pull creates a new job, unless it is abandoned. Final
+// statuses do not change
+var imageWorkResultStatusTransitions = map[string][]string{
+	"":                              {ImageWorkResultStatusJobCreated, ImageWorkResultStatusAlreadyPulled, ImageWorkResultStatusFailed},
+	ImageWorkResultStatusJobCreated: {ImageWorkResultStatusSucceeded, ImageWorkResultStatusFailed, ImageWorkResultStatusRetrying},
+	ImageWorkResultStatusRetrying:   {ImageWorkResultStatusJobCreated, ImageWorkResultStatusAlreadyPulled, ImageWorkResultStatusFailed},
+}
+
+// ImageWorkResultStatusTransitions returns the statuses to which an image work result of the status may change
+func ImageWorkResultStatusTransitions(status string) []string {
+	return append([]string{}, imageWorkResultStatusTransitions[status]...)
+}
+
+// ValidImageWorkResultStatusTransition returns true if an image work result of status from may change to status to
+func ValidImageWorkResultStatusTransition(from, to string) bool {
+	for _, s := range imageWorkResultStatusTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTerminalImageWorkResultStatus returns true if the status of an image work result is final i.e.
+// the image pull/delete succeeded, failed or was not needed since the image is already present
+func IsTerminalImageWorkResultStatus(status string) bool {
+	switch status {
+	case ImageWorkResultStatusSucceeded, ImageWorkResultStatusFailed, ImageWorkResultStatusAlreadyPulled:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// QueueProgress tracks the progress of the workers of a work queue, so that a wedged worker can be
+// detected. Workers report when they wait for, start and finish processing an item of the queue
+type QueueProgress struct {
+	lock       sync.Mutex
+	waiting    int
+	processing int
+	// lastProgress is the time a worker last started or finished processing an item
+	lastProgress time.Time
+}
+
+// NewQueueProgress returns a new work queue progress tracker
+func NewQueueProgress() *QueueProgress {
+	return &QueueProgress{lastProgress: time.Now()}
+}
+
+// Waiting is reported by a worker that waits for the next item of the queue
+func (p *QueueProgress) Waiting() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.waiting++
+}
+
+// Started is reported by a worker that got an item of the queue
+func (p *QueueProgress) Started() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.waiting--
+	p.processing++
+	p.lastProgress = time.Now()
+}
+
+// Done is reported by a worker that finished processing an item of the queue
+func (p *QueueProgress) Done() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.processing--
+	p.lastProgress = time.Now()
+}
+
+// Stalled returns an error if the workers made no progress within the threshold i.e. if an item is
+// under processing, or items are queued while no worker waits for them, since longer than the
+// threshold. An idle queue, whose workers wait for items, is never stalled
+func (p *QueueProgress) Stalled(queued int, threshold time.Duration) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.processing == 0 && (queued == 0 || p.waiting > 0) {
+		return nil
+	}
+	since := time.Since(p.lastProgress)
+	if since <= threshold {
+		return nil
+	}
+	if p.processing > 0 {
+		return fmt.Errorf("no work item processed in %s (%d under processing, %d queued)", since.Round(time.Second), p.processing, queued)
+	}
+	return fmt.Errorf("%d work items queued, but no worker processed them in %s", queued, since.Round(time.Second))
+}
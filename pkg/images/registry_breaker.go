@@ -0,0 +1,106 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"sync"
+	"time"
+
+	"github.com/docker/distribution/reference"
+)
+
+// ImageWorkResultReasonRegistryCircuitOpen is the reason of a failed image pull not done since pulls
+// from the registry of the image are suspended after consecutive failures
+const ImageWorkResultReasonRegistryCircuitOpen = "RegistryCircuitOpen"
+
+// registryBreaker is a circuit breaker of the registries images are pulled from. Once the image pulls
+// from a registry fail consecutively a threshold number of times, the circuit of the registry opens and
+// no more pulls from it are allowed for a cooldown period. The first pull allowed after the cooldown
+// opens the circuit again if it fails, and closes it if it succeeds. A zero threshold disables the breaker
+type registryBreaker struct {
+	lock      sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	// failures are the consecutive failures of pulls from each registry host
+	failures map[string]int
+	// openUntil is the end of the cooldown of each registry host whose circuit is open
+	openUntil map[string]time.Time
+}
+
+// newRegistryBreaker returns a new circuit breaker of registries
+func newRegistryBreaker(threshold int, cooldown time.Duration) *registryBreaker {
+	return &registryBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		failures:  map[string]int{},
+		openUntil: map[string]time.Time{},
+	}
+}
+
+// allow returns true if pulls from the registry host are allowed, or else the end of its cooldown
+func (b *registryBreaker) allow(host string) (bool, time.Time) {
+	if b.threshold <= 0 {
+		return true, time.Time{}
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	until, ok := b.openUntil[host]
+	if !ok || time.Now().After(until) {
+		return true, time.Time{}
+	}
+	return false, until
+}
+
+// succeeded records a successful pull from the registry host, which closes its circuit
+func (b *registryBreaker) succeeded(host string) {
+	if b.threshold <= 0 {
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	delete(b.failures, host)
+	delete(b.openUntil, host)
+}
+
+// failed records a failed pull from the registry host, and returns true if the failure opened its circuit.
+// Failures of pulls that were under way when the circuit opened do not extend the cooldown
+func (b *registryBreaker) failed(host string) bool {
+	if b.threshold <= 0 {
+		return false
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.failures[host]++
+	if b.failures[host] < b.threshold {
+		return false
+	}
+	if until, ok := b.openUntil[host]; ok && time.Now().Before(until) {
+		return false
+	}
+	b.openUntil[host] = time.Now().Add(b.cooldown)
+	return true
+}
+
+// RegistryHost returns the host of the registry of the image e.g. "docker.io" for "nginx:1.17", or
+// empty string if the image cannot be parsed
+func RegistryHost(image string) string {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return ""
+	}
+	return reference.Domain(named)
+}
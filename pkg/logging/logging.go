@@ -0,0 +1,226 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logging
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// Formats of the logs
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Fields are the structured fields of a log entry
+type Fields map[string]interface{}
+
+var (
+	lock sync.Mutex
+	// format is the format of the logs
+	format = FormatText
+	// out is where JSON entries are written
+	out io.Writer = os.Stderr
+	// glogStderr is the pipe that replaces stderr for glog in json format, and converted
+	// is closed once the lines written to it by glog are all converted
+	glogStderr *os.File
+	converted  chan struct{}
+)
+
+// glogHeader matches the header of a glog line i.e. "Lmmdd hh:mm:ss.uuuuuu threadid file:line] msg"
+var glogHeader = regexp.MustCompile(`^([IWEF])(\d{4} \d{2}:\d{2}:\d{2}\.\d{6})\s+\d+ ([^\]]+)\] (.*)$`)
+
+var glogLevels = map[string]string{
+	"I": "info",
+	"W": "warning",
+	"E": "error",
+	"F": "fatal",
+}
+
+// SetFormat sets the format of the logs. In json format, the lines written by glog
+// to stderr are converted to JSON as well.
+func SetFormat(f string) error {
+	switch f {
+	case FormatText:
+		return nil
+	case FormatJSON:
+	default:
+		return fmt.Errorf("unsupported log format %q, must be one of %q or %q", f, FormatText, FormatJSON)
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	lock.Lock()
+	format = FormatJSON
+	out = os.Stderr
+	glogStderr = w
+	converted = make(chan struct{})
+	go convertGlogLines(r, converted)
+	lock.Unlock()
+	os.Stderr = w
+	return nil
+}
+
+// Flush converts the lines written by glog so far, in json format. Since glog writes to
+// stderr rather than to a writer of its own, its lines are converted as they are read from
+// a pipe, so Flush is called before exiting to not lose them. Lines written by glog after
+// Flush are not converted.
+func Flush() {
+	lock.Lock()
+	w, done := glogStderr, converted
+	glogStderr = nil
+	if w != nil {
+		os.Stderr = out.(*os.File)
+	}
+	lock.Unlock()
+	if w == nil {
+		return
+	}
+	glog.Flush()
+	w.Close()
+	<-done
+}
+
+// Fatalf logs a fatal message and exits. Unlike glog.Fatalf, in json format the message is
+// written synchronously, after the lines written by glog before it, so that none are lost.
+func Fatalf(msgFormat string, args ...interface{}) {
+	msg := fmt.Sprintf(msgFormat, args...)
+	lock.Lock()
+	f := format
+	lock.Unlock()
+	if f == FormatText {
+		glog.FatalDepth(1, msg)
+		return
+	}
+	Flush()
+	caller := "???:1"
+	if _, file, line, ok := runtime.Caller(1); ok {
+		caller = fmt.Sprintf("%s:%d", filepath.Base(file), line)
+	}
+	writeEntry("fatal", time.Now(), caller, msg, nil)
+	os.Exit(255)
+}
+
+// Infof logs an informational message along with fields. The fields are logged
+// only in json format; in text format the message is logged by glog.
+func Infof(fields Fields, msgFormat string, args ...interface{}) {
+	logf("info", fields, msgFormat, args...)
+}
+
+// Errorf logs an error message along with fields. The fields are logged
+// only in json format; in text format the message is logged by glog.
+func Errorf(fields Fields, msgFormat string, args ...interface{}) {
+	logf("error", fields, msgFormat, args...)
+}
+
+func logf(level string, fields Fields, msgFormat string, args ...interface{}) {
+	msg := fmt.Sprintf(msgFormat, args...)
+	lock.Lock()
+	f := format
+	lock.Unlock()
+	if f == FormatText {
+		if level == "error" {
+			glog.ErrorDepth(2, msg)
+		} else {
+			glog.InfoDepth(2, msg)
+		}
+		return
+	}
+	caller := "???:1"
+	if _, file, line, ok := runtime.Caller(2); ok {
+		caller = fmt.Sprintf("%s:%d", filepath.Base(file), line)
+	}
+	writeEntry(level, time.Now(), caller, msg, fields)
+}
+
+// convertGlogLines writes each glog line read from r as a JSON entry, and closes done at the end of r
+func convertGlogLines(r io.Reader, done chan<- struct{}) {
+	defer close(done)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		level, ts, caller, msg := parseGlogLine(scanner.Text(), time.Now())
+		writeEntry(level, ts, caller, msg, nil)
+	}
+}
+
+// parseGlogLine returns the level, time, caller and message of a glog line. Lines
+// without a glog header, such as continuation lines of multi-line messages, are
+// returned as informational messages logged at now.
+func parseGlogLine(line string, now time.Time) (string, time.Time, string, string) {
+	m := glogHeader.FindStringSubmatch(line)
+	if m == nil {
+		return "info", now, "", line
+	}
+	ts, err := time.ParseInLocation("0102 15:04:05.000000", m[2], now.Location())
+	if err != nil {
+		return glogLevels[m[1]], now, m[3], m[4]
+	}
+	return glogLevels[m[1]], closestYear(ts, now), m[3], m[4]
+}
+
+// closestYear returns the time of a glog header, which has no year, in the year that puts it
+// closest to now. Lines are read right after they are written, so a line written on December 31
+// and read on January 1 is of the previous year, rather than of the current one
+func closestYear(ts, now time.Time) time.Time {
+	closest := ts.AddDate(now.Year()-ts.Year(), 0, 0)
+	for _, years := range []int{-1, 1} {
+		if t := closest.AddDate(years, 0, 0); absDuration(t.Sub(now)) < absDuration(closest.Sub(now)) {
+			closest = t
+		}
+	}
+	return closest
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+func writeEntry(level string, ts time.Time, caller, msg string, fields Fields) {
+	entry := make(map[string]interface{}, len(fields)+4)
+	for k, v := range fields {
+		entry[k] = v
+	}
+	entry["level"] = level
+	entry["ts"] = ts.Format(time.RFC3339Nano)
+	entry["msg"] = msg
+	if caller != "" {
+		entry["caller"] = caller
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		data, _ = json.Marshal(map[string]interface{}{"level": level, "ts": entry["ts"], "msg": msg})
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	out.Write(append(data, '\n'))
+}
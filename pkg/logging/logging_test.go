@@ -0,0 +1,169 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseGlogLine(t *testing.T) {
+	now := time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name           string
+		line           string
+		expectedLevel  string
+		expectedTime   time.Time
+		expectedCaller string
+		expectedMsg    string
+	}{
+		{
+			name:           "#1: Info",
+			line:           "I0214 10:31:02.123456       1 controller.go:153] Starting fledged controller",
+			expectedLevel:  "info",
+			expectedTime:   time.Date(2020, time.February, 14, 10, 31, 2, 123456000, time.UTC),
+			expectedCaller: "controller.go:153",
+			expectedMsg:    "Starting fledged controller",
+		},
+		{
+			name:           "#2: Error",
+			line:           "E0214 10:31:02.000001   12345 image_manager.go:306] Error listing Pods: timeout",
+			expectedLevel:  "error",
+			expectedTime:   time.Date(2020, time.February, 14, 10, 31, 2, 1000, time.UTC),
+			expectedCaller: "image_manager.go:306",
+			expectedMsg:    "Error listing Pods: timeout",
+		},
+		{
+			name:          "#3: Continuation line",
+			line:          "  more details",
+			expectedLevel: "info",
+			expectedTime:  now,
+			expectedMsg:   "  more details",
+		},
+	}
+	for _, test := range tests {
+		level, ts, caller, msg := parseGlogLine(test.line, now)
+		if level != test.expectedLevel || !ts.Equal(test.expectedTime) || caller != test.expectedCaller || msg != test.expectedMsg {
+			t.Errorf("Test: %s failed: expected (%s, %s, %s, %s), actual (%s, %s, %s, %s)", test.name,
+				test.expectedLevel, test.expectedTime, test.expectedCaller, test.expectedMsg, level, ts, caller, msg)
+		}
+	}
+}
+
+func TestClosestYear(t *testing.T) {
+	tests := []struct {
+		name         string
+		ts           time.Time
+		now          time.Time
+		expectedTime time.Time
+	}{
+		{
+			name:         "#1: Same year",
+			ts:           time.Date(0, time.February, 14, 10, 31, 2, 0, time.UTC),
+			now:          time.Date(2020, time.February, 14, 10, 31, 3, 0, time.UTC),
+			expectedTime: time.Date(2020, time.February, 14, 10, 31, 2, 0, time.UTC),
+		},
+		{
+			name:         "#2: Line of the previous year read on January 1",
+			ts:           time.Date(0, time.December, 31, 23, 59, 59, 0, time.UTC),
+			now:          time.Date(2021, time.January, 1, 0, 0, 1, 0, time.UTC),
+			expectedTime: time.Date(2020, time.December, 31, 23, 59, 59, 0, time.UTC),
+		},
+		{
+			name:         "#3: Line of the next year read on December 31",
+			ts:           time.Date(0, time.January, 1, 0, 0, 1, 0, time.UTC),
+			now:          time.Date(2020, time.December, 31, 23, 59, 59, 0, time.UTC),
+			expectedTime: time.Date(2021, time.January, 1, 0, 0, 1, 0, time.UTC),
+		},
+	}
+	for _, test := range tests {
+		if actual := closestYear(test.ts, test.now); !actual.Equal(test.expectedTime) {
+			t.Errorf("Test: %s failed: expected %s, actual %s", test.name, test.expectedTime, actual)
+		}
+	}
+}
+
+func TestFlush(t *testing.T) {
+	stderr := os.Stderr
+	defer func() {
+		os.Stderr = stderr
+		out = stderr
+		format = FormatText
+	}()
+	f, err := ioutil.TempFile("", "stderr")
+	if err != nil {
+		t.Fatalf("Test failed: %v", err)
+	}
+	defer os.Remove(f.Name())
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Test failed: %v", err)
+	}
+	out, format, glogStderr, converted = f, FormatJSON, w, make(chan struct{})
+	os.Stderr = w
+	go convertGlogLines(r, converted)
+	w.WriteString("E0214 10:31:02.000001   12345 main.go:120] Error building kubeconfig\n")
+	Flush()
+	if os.Stderr != f {
+		t.Errorf("Test failed: stderr not restored")
+	}
+	data, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatalf("Test failed: %v", err)
+	}
+	if !strings.Contains(string(data), `"msg":"Error building kubeconfig"`) {
+		t.Errorf("Test failed: glog line not converted before Flush returned, actual %q", data)
+	}
+	// Flush is a no-op once the lines are converted
+	Flush()
+}
+
+func TestWriteEntry(t *testing.T) {
+	var buf bytes.Buffer
+	out = &buf
+	ts := time.Date(2020, time.February, 14, 10, 31, 2, 0, time.UTC)
+	writeEntry("info", ts, "image_manager.go:221", "Job foo succeeded", Fields{
+		"image":  "nginx",
+		"status": "succeeded",
+		"msg":    "overridden",
+	})
+	entry := map[string]interface{}{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Test failed: entry is not JSON: %v", err)
+	}
+	expected := map[string]interface{}{
+		"level":  "info",
+		"ts":     "2020-02-14T10:31:02Z",
+		"caller": "image_manager.go:221",
+		"msg":    "Job foo succeeded",
+		"image":  "nginx",
+		"status": "succeeded",
+	}
+	if len(entry) != len(expected) {
+		t.Errorf("Test failed: expected %v, actual %v", expected, entry)
+	}
+	for k, v := range expected {
+		if entry[k] != v {
+			t.Errorf("Test failed: expected %s=%v, actual %v", k, v, entry[k])
+		}
+	}
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "kubefledged"
+
+// Operations performed by image work jobs
+const (
+	OperationPull  = "pull"
+	OperationPurge = "purge"
+)
+
+var (
+	// ImageWorkResults counts the image pulls and purges that completed, by operation and status
+	ImageWorkResults = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "image_work_results_total",
+			Help:      "Number of image pulls and purges, partitioned by operation and status",
+		},
+		[]string{"operation", "status"},
+	)
+	// ImageWorkFailures counts the image pulls and purges that failed, by operation and category of the failure
+	ImageWorkFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "image_work_failures_total",
+			Help:      "Number of failed image pulls and purges, partitioned by operation and failure category",
+		},
+		[]string{"operation", "category"},
+	)
+	// ImageWorkDuration observes the time from job creation until the image pull or purge completed
+	ImageWorkDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "image_work_duration_seconds",
+			Help:      "Time taken from job creation until an image pull or purge completed, partitioned by operation and status",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+		},
+		[]string{"operation", "status"},
+	)
+	// ImagePullDuration observes the time from job creation until an image was pulled, so as to find the images
+	// slowest to cache
+	ImagePullDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "image_pull_duration_seconds",
+			Help:      "Time taken from job creation until an image was pulled successfully, partitioned by image",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+		},
+		[]string{"image"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(ImageWorkResults, ImageWorkFailures, ImageWorkDuration, ImagePullDuration)
+}
+
+// ObserveImageWorkResult records the outcome of an image pull or purge job created at jobCreationTime.
+// The duration is not observed if the creation time of the job is unknown.
+func ObserveImageWorkResult(operation, status string, jobCreationTime time.Time) {
+	ImageWorkResults.WithLabelValues(operation, status).Inc()
+	if !jobCreationTime.IsZero() {
+		ImageWorkDuration.WithLabelValues(operation, status).Observe(time.Since(jobCreationTime).Seconds())
+	}
+}
+
+// ObserveImageWorkFailure records the category of the failure of an image pull or purge
+func ObserveImageWorkFailure(operation, category string) {
+	ImageWorkFailures.WithLabelValues(operation, category).Inc()
+}
+
+// ObserveImagePullDuration records the duration of a successful pull of the image
+func ObserveImagePullDuration(image string, duration time.Duration) {
+	ImagePullDuration.WithLabelValues(image).Observe(duration.Seconds())
+}
+
+// Handler returns the http handler serving the registered metrics
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,505 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Media types of the manifests accepted from registries
+const (
+	mediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeOCIManifest        = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+)
+
+// dockerHubHost is the host of the registry API of docker hub, whose images have "docker.io" domain
+const dockerHubHost = "registry-1.docker.io"
+
+// maxTagListPages is the max. no. of pages of a tag list followed, in case a registry keeps linking pages
+const maxTagListPages = 100
+
+// Credentials are the credentials of a registry
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// Platform is the platform of a node, whose image is selected from a manifest list
+type Platform struct {
+	OS           string
+	Architecture string
+	Variant      string
+}
+
+// ParsePlatform parses a platform in os/arch[/variant] format
+func ParsePlatform(platform string) Platform {
+	parts := strings.SplitN(platform, "/", 3)
+	p := Platform{OS: parts[0]}
+	if len(parts) > 1 {
+		p.Architecture = parts[1]
+	}
+	if len(parts) > 2 {
+		p.Variant = parts[2]
+	}
+	return p
+}
+
+type descriptor struct {
+	MediaType string `json:"mediaType"`
+	Size      int64  `json:"size"`
+	Digest    string `json:"digest"`
+	Platform  *struct {
+		OS           string `json:"os"`
+		Architecture string `json:"architecture"`
+		Variant      string `json:"variant"`
+	} `json:"platform,omitempty"`
+}
+
+type manifest struct {
+	MediaType string       `json:"mediaType"`
+	Config    descriptor   `json:"config"`
+	Layers    []descriptor `json:"layers"`
+	Manifests []descriptor `json:"manifests"`
+}
+
+// Client queries the manifests of images from their registries
+type Client struct {
+	httpClient *http.Client
+}
+
+// NewClient returns a new registry client that sends requests using the HTTP client
+func NewClient(httpClient *http.Client) *Client {
+	return &Client{httpClient: httpClient}
+}
+
+// ImageSize returns the size of the image of the platform i.e. the total compressed size of its
+// layers and config, as per its manifest in the registry. The credentials of the registry are
+// used, if the registry requires authentication
+func (c *Client) ImageSize(ctx context.Context, image string, platform Platform, credentials map[string]Credentials) (int64, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return 0, err
+	}
+	ref := ""
+	if digested, ok := named.(reference.Digested); ok {
+		ref = digested.Digest().String()
+	} else {
+		ref = reference.TagNameOnly(named).(reference.Tagged).Tag()
+	}
+	r := c.repository(named, credentials)
+	m, err := r.manifest(ctx, ref)
+	if err != nil {
+		return 0, err
+	}
+	if m.MediaType == mediaTypeDockerManifestList || m.MediaType == mediaTypeOCIIndex || len(m.Manifests) > 0 {
+		var selected *descriptor
+		for i, d := range m.Manifests {
+			if d.Platform == nil || d.Platform.OS != platform.OS || d.Platform.Architecture != platform.Architecture {
+				continue
+			}
+			if platform.Variant == "" || d.Platform.Variant == platform.Variant {
+				selected = &m.Manifests[i]
+				break
+			}
+		}
+		if selected == nil {
+			return 0, fmt.Errorf("no manifest of platform %s/%s in manifest list of %s", platform.OS, platform.Architecture, image)
+		}
+		if m, err = r.manifest(ctx, selected.Digest); err != nil {
+			return 0, err
+		}
+	}
+	if len(m.Layers) == 0 {
+		return 0, fmt.Errorf("manifest of %s has no layers", image)
+	}
+	size := m.Config.Size
+	for _, layer := range m.Layers {
+		size += layer.Size
+	}
+	return size, nil
+}
+
+// ImageDigest returns the digest of the manifest (or manifest list) the tag of the image resolves to in its
+// registry, from the Docker-Content-Digest header of the manifest or else its content. The digest of an image
+// referenced by digest is returned as is. The credentials of the registry are used, if the registry requires
+// authentication
+func (c *Client) ImageDigest(ctx context.Context, image string, credentials map[string]Credentials) (string, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", err
+	}
+	if digested, ok := named.(reference.Digested); ok {
+		return digested.Digest().String(), nil
+	}
+	tag := reference.TagNameOnly(named).(reference.Tagged).Tag()
+	r := c.repository(named, credentials)
+	resp, err := r.fetch(ctx, "https://"+r.host+"/v2/"+r.path+"/manifests/"+tag)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("getting manifest %s of %s/%s: %s", tag, r.host, r.path, resp.Status)
+	}
+	if digest := resp.Header.Get("Docker-Content-Digest"); digest != "" {
+		return digest, nil
+	}
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("reading manifest %s of %s/%s: %v", tag, r.host, r.path, err)
+	}
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(content)), nil
+}
+
+// ListTags returns the tags of the repository (e.g. "myrepo/app") in its registry, following the pages of the
+// tag list of the registry. The credentials of the registry are used, if the registry requires authentication
+func (c *Client) ListTags(ctx context.Context, repository string, credentials map[string]Credentials) ([]string, error) {
+	named, err := reference.ParseNormalizedNamed(repository)
+	if err != nil {
+		return nil, err
+	}
+	if !reference.IsNameOnly(named) {
+		return nil, fmt.Errorf("repository %s has a tag or digest", repository)
+	}
+	r := c.repository(named, credentials)
+	tags := []string{}
+	next := "https://" + r.host + "/v2/" + r.path + "/tags/list"
+	for page := 0; next != ""; page++ {
+		if page == maxTagListPages {
+			return nil, fmt.Errorf("tag list of %s/%s has more than %d pages", r.host, r.path, maxTagListPages)
+		}
+		requestURL, err := url.Parse(next)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := r.fetch(ctx, next)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("getting tags of %s/%s: %s", r.host, r.path, resp.Status)
+		}
+		var list struct {
+			Tags []string `json:"tags"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&list)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("decoding tags of %s/%s: %v", r.host, r.path, err)
+		}
+		tags = append(tags, list.Tags...)
+		if next, err = nextLink(requestURL, resp.Header.Get("Link")); err != nil {
+			return nil, fmt.Errorf("invalid link to next page of tags of %s/%s: %v", r.host, r.path, err)
+		}
+	}
+	return tags, nil
+}
+
+// ParseImagePattern parses an image pattern in <repository>:<tag pattern> format e.g. "myrepo/app:v1.*", where
+// the tag pattern is a glob pattern matched against the tags of the repository (see path.Match)
+func ParseImagePattern(pattern string) (string, string, error) {
+	i := strings.LastIndex(pattern, ":")
+	if i < 0 || i < strings.LastIndex(pattern, "/") || i == len(pattern)-1 {
+		return "", "", fmt.Errorf("no tag pattern in image pattern %s", pattern)
+	}
+	repository, tagPattern := pattern[:i], pattern[i+1:]
+	named, err := reference.ParseNormalizedNamed(repository)
+	if err != nil {
+		return "", "", err
+	}
+	if !reference.IsNameOnly(named) {
+		return "", "", fmt.Errorf("repository of image pattern %s has a tag or digest", pattern)
+	}
+	if _, err := path.Match(tagPattern, ""); err != nil {
+		return "", "", fmt.Errorf("invalid tag pattern in image pattern %s: %v", pattern, err)
+	}
+	return repository, tagPattern, nil
+}
+
+// nextLink returns the URL of the next page in the Link header of a paginated response e.g.
+// `</v2/foo/bar/tags/list?n=100&last=v1.2>; rel="next"`, resolved against the URL of the request.
+// Empty string is returned if there is no next page. Since the credentials of the registry are sent
+// along with the request of the next page, links to another scheme or host are rejected
+func nextLink(requestURL *url.URL, link string) (string, error) {
+	for _, l := range strings.Split(link, ",") {
+		parts := strings.Split(l, ";")
+		target := strings.TrimSpace(parts[0])
+		if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+			continue
+		}
+		for _, param := range parts[1:] {
+			if strings.ReplaceAll(strings.TrimSpace(param), " ", "") != `rel="next"` {
+				continue
+			}
+			next, err := url.Parse(strings.Trim(target, "<>"))
+			if err != nil {
+				return "", err
+			}
+			resolved := requestURL.ResolveReference(next)
+			if resolved.Scheme != requestURL.Scheme || resolved.Host != requestURL.Host {
+				return "", fmt.Errorf("link to next page %s is not on %s://%s", resolved, requestURL.Scheme, requestURL.Host)
+			}
+			return resolved.String(), nil
+		}
+	}
+	return "", nil
+}
+
+// repository returns the repository of the named image in its registry, with the credentials of the registry if any
+func (c *Client) repository(named reference.Named, credentials map[string]Credentials) *repository {
+	domain := reference.Domain(named)
+	host := domain
+	if host == "docker.io" {
+		host = dockerHubHost
+	}
+	var creds *Credentials
+	if cred, ok := credentials[domain]; ok {
+		creds = &cred
+	}
+	return &repository{client: c, host: host, path: reference.Path(named), credentials: creds}
+}
+
+// repository is a repository of a registry, and the authorization of pulls from it, if any
+type repository struct {
+	client        *Client
+	host          string
+	path          string
+	credentials   *Credentials
+	authorization string
+}
+
+// manifest gets the manifest of the reference (tag or digest) of the repository
+func (r *repository) manifest(ctx context.Context, ref string) (*manifest, error) {
+	resp, err := r.fetch(ctx, "https://"+r.host+"/v2/"+r.path+"/manifests/"+ref)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("getting manifest %s of %s/%s: %s", ref, r.host, r.path, resp.Status)
+	}
+	m := &manifest{}
+	if err := json.NewDecoder(resp.Body).Decode(m); err != nil {
+		return nil, fmt.Errorf("decoding manifest %s of %s/%s: %v", ref, r.host, r.path, err)
+	}
+	if m.MediaType == "" {
+		m.MediaType = resp.Header.Get("Content-Type")
+	}
+	return m, nil
+}
+
+// fetch gets the URL of the repository. If the registry requires authentication, the request is retried
+// with basic auth, or with a bearer token obtained from the auth server of the registry as per the
+// challenge of the registry
+func (r *repository) fetch(ctx context.Context, url string) (*http.Response, error) {
+	resp, err := r.get(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized && r.authorization == "" {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		if r.authorization, err = r.authorize(ctx, challenge); err != nil {
+			return nil, err
+		}
+		return r.get(ctx, url)
+	}
+	return resp, nil
+}
+
+func (r *repository) get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", strings.Join([]string{mediaTypeDockerManifest, mediaTypeDockerManifestList, mediaTypeOCIManifest, mediaTypeOCIIndex}, ", "))
+	if r.authorization != "" {
+		req.Header.Set("Authorization", r.authorization)
+	}
+	return r.client.httpClient.Do(req.WithContext(ctx))
+}
+
+// authorize returns the authorization header of the repository as per the challenge of the registry
+func (r *repository) authorize(ctx context.Context, challenge string) (string, error) {
+	scheme, params := parseChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if r.credentials == nil {
+			return "", fmt.Errorf("registry %s requires credentials", r.host)
+		}
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(r.credentials.Username+":"+r.credentials.Password)), nil
+	case "bearer":
+	default:
+		return "", fmt.Errorf("unsupported authentication challenge of registry %s: %q", r.host, challenge)
+	}
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return "", fmt.Errorf("invalid realm in authentication challenge of registry %s: %q", r.host, challenge)
+	}
+	query := realm.Query()
+	if service, ok := params["service"]; ok {
+		query.Set("service", service)
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = "repository:" + r.path + ":pull"
+	}
+	query.Set("scope", scope)
+	realm.RawQuery = query.Encode()
+	req, err := http.NewRequest(http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if r.credentials != nil {
+		req.SetBasicAuth(r.credentials.Username, r.credentials.Password)
+	}
+	resp, err := r.client.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("getting token of %s/%s: %s", r.host, r.path, resp.Status)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("decoding token of %s/%s: %v", r.host, r.path, err)
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	if token.Token == "" {
+		return "", fmt.Errorf("no token of %s/%s", r.host, r.path)
+	}
+	return "Bearer " + token.Token, nil
+}
+
+// parseChallenge parses the scheme and the params of a WWW-Authenticate header
+// e.g. `Bearer realm="https://auth.docker.io/token",service="registry.docker.io"`
+func parseChallenge(challenge string) (string, map[string]string) {
+	params := map[string]string{}
+	parts := strings.SplitN(strings.TrimSpace(challenge), " ", 2)
+	if len(parts) < 2 {
+		return parts[0], params
+	}
+	rest := parts[1]
+	for rest != "" {
+		eq := strings.Index(rest, "=")
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = strings.TrimSpace(rest[eq+1:])
+		value := ""
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				break
+			}
+			value, rest = rest[1:end+1], rest[end+2:]
+		} else if comma := strings.Index(rest, ","); comma >= 0 {
+			value, rest = rest[:comma], rest[comma:]
+		} else {
+			value, rest = rest, ""
+		}
+		params[key] = value
+		rest = strings.TrimPrefix(strings.TrimSpace(rest), ",")
+	}
+	return parts[0], params
+}
+
+// dockerConfigEntry is an entry of the auths of a docker config
+type dockerConfigEntry struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Auth     string `json:"auth"`
+}
+
+// CredentialsFromSecrets returns the credentials of registries, keyed by the domain of their
+// images (e.g. "docker.io"), in the docker config of the image pull secrets. The credentials
+// of a registry in an earlier secret take precedence
+func CredentialsFromSecrets(secrets []*corev1.Secret) map[string]Credentials {
+	credentials := map[string]Credentials{}
+	for _, secret := range secrets {
+		auths := map[string]dockerConfigEntry{}
+		switch secret.Type {
+		case corev1.SecretTypeDockerConfigJson:
+			var config struct {
+				Auths map[string]dockerConfigEntry `json:"auths"`
+			}
+			if err := json.Unmarshal(secret.Data[corev1.DockerConfigJsonKey], &config); err != nil {
+				continue
+			}
+			auths = config.Auths
+		case corev1.SecretTypeDockercfg:
+			if err := json.Unmarshal(secret.Data[corev1.DockerConfigKey], &auths); err != nil {
+				continue
+			}
+		}
+		for server, entry := range auths {
+			domain := registryDomain(server)
+			if _, ok := credentials[domain]; ok {
+				continue
+			}
+			cred := Credentials{Username: entry.Username, Password: entry.Password}
+			if entry.Auth != "" {
+				if decoded, err := base64.StdEncoding.DecodeString(entry.Auth); err == nil {
+					if parts := strings.SplitN(string(decoded), ":", 2); len(parts) == 2 {
+						cred = Credentials{Username: parts[0], Password: parts[1]}
+					}
+				}
+			}
+			credentials[domain] = cred
+		}
+	}
+	return credentials
+}
+
+// registryDomain returns the domain of the images of the registry server of a docker config
+// e.g. "docker.io" for "https://index.docker.io/v1/"
+func registryDomain(server string) string {
+	domain := server
+	if i := strings.Index(domain, "://"); i >= 0 {
+		domain = domain[i+3:]
+	}
+	if i := strings.Index(domain, "/"); i >= 0 {
+		domain = domain[:i]
+	}
+	switch domain {
+	case "index.docker.io", dockerHubHost:
+		return "docker.io"
+	}
+	return domain
+}
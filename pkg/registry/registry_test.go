@@ -0,0 +1,362 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const testManifestList = `{"mediaType":"application/vnd.docker.distribution.manifest.list.v2+json","manifests":[
+{"digest":"sha256:amd64","platform":{"os":"linux","architecture":"amd64"}},
+{"digest":"sha256:arm64","platform":{"os":"linux","architecture":"arm64","variant":"v8"}}]}`
+
+const testManifest = `{"mediaType":"application/vnd.docker.distribution.manifest.v2+json",
+"config":{"size":100},"layers":[{"size":1000},{"size":2000}]}`
+
+// newTestRegistry returns a registry serving the manifests of foo/bar, with a manifest list for tag
+// "multi" (with its Docker-Content-Digest header "sha256:multi") and a manifest for tag "single" and the
+// digests of the manifest list, and its tags in two
+// pages (linked by a relative URL) with two more tags "v1.0" and "v1.1". Unless auth is empty,
+// requests must be authorized with bearer token "token" issued by the registry for user:password
+// (auth "bearer"), or with basic auth of user:password (auth "basic")
+func newTestRegistry(auth string) *httptest.Server {
+	var server *httptest.Server
+	basic := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:password"))
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if r.Header.Get("Authorization") != basic || r.URL.Query().Get("scope") != "repository:foo/bar:pull" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, `{"token":"token"}`)
+			return
+		}
+		switch {
+		case auth == "bearer" && r.Header.Get("Authorization") != "Bearer token":
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/token",service="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		case auth == "basic" && r.Header.Get("Authorization") != basic:
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v2/foo/bar/manifests/multi":
+			w.Header().Set("Docker-Content-Digest", "sha256:multi")
+			fmt.Fprint(w, testManifestList)
+		case "/v2/foo/bar/manifests/single", "/v2/foo/bar/manifests/sha256:amd64", "/v2/foo/bar/manifests/sha256:arm64":
+			fmt.Fprint(w, testManifest)
+		case "/v2/foo/bar/tags/list":
+			if r.URL.Query().Get("last") == "single" {
+				fmt.Fprint(w, `{"name":"foo/bar","tags":["v1.0","v1.1"]}`)
+				return
+			}
+			w.Header().Set("Link", `</v2/foo/bar/tags/list?n=2&last=single>; rel="next"`)
+			fmt.Fprint(w, `{"name":"foo/bar","tags":["multi","single"]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return server
+}
+
+func TestImageSize(t *testing.T) {
+	tests := []struct {
+		name         string
+		auth         string
+		tag          string
+		platform     Platform
+		credentials  bool
+		expectedSize int64
+		expectErr    bool
+	}{
+		{
+			name:         "#1: Manifest",
+			tag:          "single",
+			platform:     Platform{OS: "linux", Architecture: "amd64"},
+			expectedSize: 3100,
+		},
+		{
+			name:         "#2: Manifest list",
+			tag:          "multi",
+			platform:     Platform{OS: "linux", Architecture: "arm64", Variant: "v8"},
+			expectedSize: 3100,
+		},
+		{
+			name:      "#3: Manifest list without platform",
+			tag:       "multi",
+			platform:  Platform{OS: "linux", Architecture: "s390x"},
+			expectErr: true,
+		},
+		{
+			name:         "#4: Bearer token",
+			auth:         "bearer",
+			tag:          "multi",
+			platform:     Platform{OS: "linux", Architecture: "amd64"},
+			credentials:  true,
+			expectedSize: 3100,
+		},
+		{
+			name:      "#5: Bearer token without credentials",
+			auth:      "bearer",
+			tag:       "single",
+			platform:  Platform{OS: "linux", Architecture: "amd64"},
+			expectErr: true,
+		},
+		{
+			name:         "#6: Basic auth",
+			auth:         "basic",
+			tag:          "single",
+			platform:     Platform{OS: "linux", Architecture: "amd64"},
+			credentials:  true,
+			expectedSize: 3100,
+		},
+		{
+			name:      "#7: Manifest not found",
+			tag:       "missing",
+			platform:  Platform{OS: "linux", Architecture: "amd64"},
+			expectErr: true,
+		},
+	}
+	for _, test := range tests {
+		server := newTestRegistry(test.auth)
+		host := strings.TrimPrefix(server.URL, "https://")
+		credentials := map[string]Credentials{}
+		if test.credentials {
+			credentials[host] = Credentials{Username: "user", Password: "password"}
+		}
+		client := NewClient(server.Client())
+		size, err := client.ImageSize(context.Background(), host+"/foo/bar:"+test.tag, test.platform, credentials)
+		server.Close()
+		if (err != nil) != test.expectErr {
+			t.Errorf("Test: %s failed: expectErr=%t, actualErr=%v", test.name, test.expectErr, err)
+			continue
+		}
+		if size != test.expectedSize {
+			t.Errorf("Test: %s failed: expectedSize=%d, actualSize=%d", test.name, test.expectedSize, size)
+		}
+	}
+}
+
+func TestImageDigest(t *testing.T) {
+	tests := []struct {
+		name           string
+		auth           string
+		image          string
+		credentials    bool
+		expectedDigest string
+		expectErr      bool
+	}{
+		{
+			name:           "#1: Docker-Content-Digest header",
+			image:          "foo/bar:multi",
+			expectedDigest: "sha256:multi",
+		},
+		{
+			name:           "#2: Digest of manifest content",
+			auth:           "bearer",
+			image:          "foo/bar:single",
+			credentials:    true,
+			expectedDigest: fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(testManifest))),
+		},
+		{
+			name:           "#3: Image referenced by digest",
+			image:          "foo/bar@sha256:" + strings.Repeat("a", 64),
+			expectedDigest: "sha256:" + strings.Repeat("a", 64),
+		},
+		{
+			name:      "#4: Manifest not found",
+			image:     "foo/bar:missing",
+			expectErr: true,
+		},
+	}
+	for _, test := range tests {
+		server := newTestRegistry(test.auth)
+		host := strings.TrimPrefix(server.URL, "https://")
+		credentials := map[string]Credentials{}
+		if test.credentials {
+			credentials[host] = Credentials{Username: "user", Password: "password"}
+		}
+		client := NewClient(server.Client())
+		digest, err := client.ImageDigest(context.Background(), host+"/"+test.image, credentials)
+		server.Close()
+		if (err != nil) != test.expectErr {
+			t.Errorf("Test: %s failed: expectErr=%t, actualErr=%v", test.name, test.expectErr, err)
+			continue
+		}
+		if digest != test.expectedDigest {
+			t.Errorf("Test: %s failed: expectedDigest=%s, actualDigest=%s", test.name, test.expectedDigest, digest)
+		}
+	}
+}
+
+func TestListTags(t *testing.T) {
+	tests := []struct {
+		name         string
+		auth         string
+		repository   string
+		credentials  bool
+		expectedTags []string
+		expectErr    bool
+	}{
+		{
+			name:         "#1: Tags in two pages",
+			repository:   "foo/bar",
+			expectedTags: []string{"multi", "single", "v1.0", "v1.1"},
+		},
+		{
+			name:         "#2: Bearer token",
+			auth:         "bearer",
+			repository:   "foo/bar",
+			credentials:  true,
+			expectedTags: []string{"multi", "single", "v1.0", "v1.1"},
+		},
+		{
+			name:        "#3: Basic auth with wrong repository",
+			auth:        "basic",
+			repository:  "foo/baz",
+			credentials: true,
+			expectErr:   true,
+		},
+		{
+			name:       "#4: Repository with tag",
+			repository: "foo/bar:single",
+			expectErr:  true,
+		},
+	}
+	for _, test := range tests {
+		server := newTestRegistry(test.auth)
+		host := strings.TrimPrefix(server.URL, "https://")
+		credentials := map[string]Credentials{}
+		if test.credentials {
+			credentials[host] = Credentials{Username: "user", Password: "password"}
+		}
+		client := NewClient(server.Client())
+		tags, err := client.ListTags(context.Background(), host+"/"+test.repository, credentials)
+		server.Close()
+		if (err != nil) != test.expectErr {
+			t.Errorf("Test: %s failed: expectErr=%t, actualErr=%v", test.name, test.expectErr, err)
+			continue
+		}
+		if !test.expectErr && !reflect.DeepEqual(tags, test.expectedTags) {
+			t.Errorf("Test: %s failed: expectedTags=%v, actualTags=%v", test.name, test.expectedTags, tags)
+		}
+	}
+}
+
+func TestParseImagePattern(t *testing.T) {
+	tests := []struct {
+		pattern            string
+		expectedRepository string
+		expectedTagPattern string
+		expectErr          bool
+	}{
+		{pattern: "myrepo/app:v1.*", expectedRepository: "myrepo/app", expectedTagPattern: "v1.*"},
+		{pattern: "registry.local:5000/app:1.[0-9]", expectedRepository: "registry.local:5000/app", expectedTagPattern: "1.[0-9]"},
+		{pattern: "registry.local:5000/app", expectErr: true},
+		{pattern: "myrepo/app:", expectErr: true},
+		{pattern: "myrepo/app:v1.[", expectErr: true},
+		{pattern: "myrepo/App:v1.*", expectErr: true},
+	}
+	for k, test := range tests {
+		repository, tagPattern, err := ParseImagePattern(test.pattern)
+		if (err != nil) != test.expectErr {
+			t.Errorf("Test: #%d failed: expectErr=%t, actualErr=%v", k+1, test.expectErr, err)
+			continue
+		}
+		if repository != test.expectedRepository || tagPattern != test.expectedTagPattern {
+			t.Errorf("Test: #%d failed: expected %s %s, actual %s %s", k+1, test.expectedRepository, test.expectedTagPattern, repository, tagPattern)
+		}
+	}
+}
+
+func TestNextLink(t *testing.T) {
+	requestURL, _ := url.Parse("https://registry.local:5000/v2/foo/bar/tags/list")
+	tests := []struct {
+		link      string
+		expected  string
+		expectErr bool
+	}{
+		{link: "", expected: ""},
+		{link: `</v2/foo/bar/tags/list?n=2&last=b>; rel="next"`, expected: "https://registry.local:5000/v2/foo/bar/tags/list?n=2&last=b"},
+		{link: `<https://registry.local:5000/v2/foo/bar/tags/list?last=b>; rel="prev", <https://registry.local:5000/v2/foo/bar/tags/list?last=c>; rel="next"`,
+			expected: "https://registry.local:5000/v2/foo/bar/tags/list?last=c"},
+		{link: `</v2/foo/bar/tags/list?last=b>; rel="prev"`, expected: ""},
+		{link: `<https://other.local/v2/foo/bar/tags/list?last=c>; rel="next"`, expectErr: true},
+		{link: `<//other.local/v2/foo/bar/tags/list?last=c>; rel="next"`, expectErr: true},
+		{link: `<http://registry.local:5000/v2/foo/bar/tags/list?last=c>; rel="next"`, expectErr: true},
+	}
+	for k, test := range tests {
+		next, err := nextLink(requestURL, test.link)
+		if (err != nil) != test.expectErr || next != test.expected {
+			t.Errorf("Test: #%d failed: expected %q (expectErr=%t), actual %q (err: %v)", k+1, test.expected, test.expectErr, next, err)
+		}
+	}
+}
+
+func TestCredentialsFromSecrets(t *testing.T) {
+	secrets := []*corev1.Secret{
+		{
+			Type: corev1.SecretTypeDockerConfigJson,
+			Data: map[string][]byte{corev1.DockerConfigJsonKey: []byte(`{"auths":{
+				"https://index.docker.io/v1/":{"auth":"` + base64.StdEncoding.EncodeToString([]byte("hub:secret")) + `"},
+				"registry.local:5000":{"username":"local","password":"secret"}}}`)},
+		},
+		{
+			Type: corev1.SecretTypeDockercfg,
+			Data: map[string][]byte{corev1.DockerConfigKey: []byte(`{
+				"registry.local:5000":{"username":"other","password":"secret"},
+				"quay.io":{"username":"quay","password":"secret"}}`)},
+		},
+		{
+			Type: corev1.SecretTypeOpaque,
+			Data: map[string][]byte{"foo": []byte("bar")},
+		},
+	}
+	expected := map[string]Credentials{
+		"docker.io":           {Username: "hub", Password: "secret"},
+		"registry.local:5000": {Username: "local", Password: "secret"},
+		"quay.io":             {Username: "quay", Password: "secret"},
+	}
+	if credentials := CredentialsFromSecrets(secrets); !reflect.DeepEqual(credentials, expected) {
+		t.Errorf("Test failed: expected %+v, actual %+v", expected, credentials)
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	scheme, params := parseChallenge(`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/nginx:pull"`)
+	expected := map[string]string{
+		"realm":   "https://auth.docker.io/token",
+		"service": "registry.docker.io",
+		"scope":   "repository:library/nginx:pull",
+	}
+	if scheme != "Bearer" || !reflect.DeepEqual(params, expected) {
+		t.Errorf("Test failed: expected Bearer %+v, actual %s %+v", expected, scheme, params)
+	}
+}
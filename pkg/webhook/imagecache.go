@@ -19,12 +19,21 @@ package webhook
 import (
 	"encoding/json"
 	"fmt"
+	"net/url"
+	"path"
 	"reflect"
+	"regexp"
+	"strings"
 
+	"github.com/docker/distribution/reference"
 	"github.com/golang/glog"
+	"github.com/robfig/cron/v3"
 	fledgedv1alpha1 "github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha1"
+	"github.com/senthilrch/kube-fledged/pkg/registry"
 	v1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 const (
@@ -36,6 +45,15 @@ const (
      ]`
 )
 
+// platformPattern matches a platform in os/arch[/variant] format e.g. linux/arm64/v8
+var platformPattern = regexp.MustCompile(`^[a-z0-9]+/[a-z0-9_]+(/[a-z0-9]+)?$`)
+
+// envNamePattern matches the name of an env variable
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// snapshotterPattern matches the name of a containerd snapshotter e.g. overlayfs, stargz
+var snapshotterPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
 // MutateImageCache modifies image cache resource
 /*
 func MutateImageCache(ar v1.AdmissionReview) *v1.AdmissionResponse {
@@ -101,13 +119,43 @@ func ValidateImageCache(ar v1.AdmissionReview) *v1.AdmissionResponse {
 	cacheSpec := imageCache.Spec.CacheSpec
 	glog.V(4).Infof("cacheSpec: %+v", cacheSpec)
 
-	for _, i := range cacheSpec {
-		if len(i.Images) == 0 {
-			glog.Error("No images specified within image list")
-			return toV1AdmissionResponse(fmt.Errorf("No images specified within image list"))
+	if imageCache.Spec.PullDeadline != nil && imageCache.Spec.PullDeadline.Duration <= 0 {
+		glog.Errorf("Invalid pull deadline of image cache: %s", imageCache.Spec.PullDeadline.Duration)
+		return toV1AdmissionResponse(fmt.Errorf("Invalid pull deadline of image cache: %s", imageCache.Spec.PullDeadline.Duration))
+	}
+
+	if len(cacheSpec) == 0 {
+		glog.Error("No image lists specified in cacheSpec")
+		return toV1AdmissionResponse(fmt.Errorf("No image lists specified in cacheSpec"))
+	}
+
+	for k, i := range cacheSpec {
+		if len(i.Images) == 0 && i.ImagesFrom == nil && i.ImagesFromPods == nil && len(i.ImagePatterns) == 0 {
+			glog.Errorf("No images specified within image list %d", k)
+			return toV1AdmissionResponse(fmt.Errorf("No images specified within image list %d", k))
+		}
+
+		if i.ImagesFrom != nil && (i.ImagesFrom.Name == "" || i.ImagesFrom.Key == "") {
+			glog.Error("Both name and key of configmap should be specified for imagesFrom within image list")
+			return toV1AdmissionResponse(fmt.Errorf("Both name and key of configmap should be specified for imagesFrom within image list"))
+		}
+
+		if i.ImagesFromPods != nil {
+			if errs := validation.IsDNS1123Label(i.ImagesFromPods.Namespace); len(errs) > 0 {
+				glog.Errorf("Invalid namespace of imagesFromPods within image list %d: %s", k, i.ImagesFromPods.Namespace)
+				return toV1AdmissionResponse(fmt.Errorf("Invalid namespace of imagesFromPods within image list %d: %s: %s", k, i.ImagesFromPods.Namespace, strings.Join(errs, ", ")))
+			}
 		}
 
 		for m := range i.Images {
+			if strings.TrimSpace(i.Images[m]) == "" {
+				glog.Errorf("Blank image at index %d of image list %d", m, k)
+				return toV1AdmissionResponse(fmt.Errorf("Blank image at index %d of image list %d", m, k))
+			}
+			if _, err := reference.ParseNormalizedNamed(i.Images[m]); err != nil {
+				glog.Errorf("Invalid image reference within image list: %s: %v", i.Images[m], err)
+				return toV1AdmissionResponse(fmt.Errorf("Invalid image reference within image list: %s: %v", i.Images[m], err))
+			}
 			for p := 0; p < m; p++ {
 				if i.Images[p] == i.Images[m] {
 					glog.Errorf("Duplicate image names within image list: %s", i.Images[m])
@@ -115,6 +163,57 @@ func ValidateImageCache(ar v1.AdmissionReview) *v1.AdmissionResponse {
 				}
 			}
 		}
+
+		for m := range i.ImagePatterns {
+			if strings.TrimSpace(i.ImagePatterns[m]) == "" {
+				glog.Errorf("Blank image pattern at index %d of image list %d", m, k)
+				return toV1AdmissionResponse(fmt.Errorf("Blank image pattern at index %d of image list %d", m, k))
+			}
+			if _, _, err := registry.ParseImagePattern(i.ImagePatterns[m]); err != nil {
+				glog.Errorf("Invalid image pattern within image list: %s: %v", i.ImagePatterns[m], err)
+				return toV1AdmissionResponse(fmt.Errorf("Invalid image pattern within image list: %s: %v", i.ImagePatterns[m], err))
+			}
+		}
+
+		for name, quantity := range i.DeviceResources {
+			if !strings.Contains(string(name), "/") || strings.HasPrefix(string(name), "kubernetes.io/") {
+				glog.Errorf("Invalid device resource within image list: %s", name)
+				return toV1AdmissionResponse(fmt.Errorf("Invalid device resource within image list: %s: an extended resource e.g. nvidia.com/gpu must be specified", name))
+			}
+			if quantity.Sign() <= 0 || quantity.MilliValue()%1000 != 0 {
+				glog.Errorf("Invalid quantity of device resource within image list: %s: %s", name, quantity.String())
+				return toV1AdmissionResponse(fmt.Errorf("Invalid quantity of device resource within image list: %s: %s: a positive integer must be specified", name, quantity.String()))
+			}
+		}
+
+		switch i.ImagePullPolicy {
+		case "", corev1.PullAlways, corev1.PullIfNotPresent, corev1.PullNever:
+		default:
+			glog.Errorf("Invalid image pull policy within image list: %s", i.ImagePullPolicy)
+			return toV1AdmissionResponse(fmt.Errorf("Invalid image pull policy within image list: %s", i.ImagePullPolicy))
+		}
+
+		if i.Platform != "" && !platformPattern.MatchString(i.Platform) {
+			glog.Errorf("Invalid platform within image list: %s", i.Platform)
+			return toV1AdmissionResponse(fmt.Errorf("Invalid platform within image list: %s, must be in os/arch[/variant] format", i.Platform))
+		}
+
+		for _, mirror := range i.Mirrors {
+			if _, err := reference.ParseNormalizedNamed(mirror + "/image"); err != nil {
+				glog.Errorf("Invalid mirror within image list: %s", mirror)
+				return toV1AdmissionResponse(fmt.Errorf("Invalid mirror within image list: %s, must be a registry with an optional path prefix", mirror))
+			}
+		}
+
+		if i.ImageArchive != nil && (i.ImageArchive.HostPath == "") == (i.ImageArchive.PersistentVolumeClaim == "") {
+			glog.Error("Exactly one of hostPath and persistentVolumeClaim should be specified for image archive within image list")
+			return toV1AdmissionResponse(fmt.Errorf("Exactly one of hostPath and persistentVolumeClaim should be specified for image archive within image list"))
+		}
+
+		if i.PullDeadline != nil && i.PullDeadline.Duration <= 0 {
+			glog.Errorf("Invalid pull deadline within image list: %s", i.PullDeadline.Duration)
+			return toV1AdmissionResponse(fmt.Errorf("Invalid pull deadline within image list: %s", i.PullDeadline.Duration))
+		}
 		/*
 			if len(i.NodeSelector) > 0 {
 				if nodes, err = c.nodesLister.List(labels.Set(i.NodeSelector).AsSelector()); err != nil {
@@ -135,6 +234,66 @@ func ValidateImageCache(ar v1.AdmissionReview) *v1.AdmissionResponse {
 		*/
 	}
 
+	if imageCache.Spec.PullJobContainer != nil && imageCache.Spec.PullJobContainer.Image == "" {
+		glog.Error("No image specified for pull job container")
+		return toV1AdmissionResponse(fmt.Errorf("No image specified for pull job container"))
+	}
+
+	if secret := imageCache.Spec.CredentialsSecret; secret != nil {
+		if secret.SecretName == "" || !path.IsAbs(secret.MountPath) {
+			glog.Errorf("Invalid credentials secret %+v", *secret)
+			return toV1AdmissionResponse(fmt.Errorf("Invalid credentials secret: secretName and an absolute mountPath must be specified"))
+		}
+		if secret.EnvName != "" && !envNamePattern.MatchString(secret.EnvName) {
+			glog.Errorf("Invalid env name %s of credentials secret", secret.EnvName)
+			return toV1AdmissionResponse(fmt.Errorf("Invalid env name %s of credentials secret", secret.EnvName))
+		}
+		if imageCache.Spec.PullJobContainer == nil {
+			glog.Errorf("Credentials secret %s specified without pull job container", secret.SecretName)
+			return toV1AdmissionResponse(fmt.Errorf("Credentials secret requires a pull job container: images pulled by the container runtime of the node do not use it"))
+		}
+	}
+
+	if bundle := imageCache.Spec.CABundle; bundle != nil && (bundle.ConfigMapName == "") == (bundle.SecretName == "") {
+		glog.Errorf("Invalid CA bundle %+v", *bundle)
+		return toV1AdmissionResponse(fmt.Errorf("Invalid CA bundle: exactly one of configMapName and secretName must be specified"))
+	}
+
+	if snapshotter := imageCache.Spec.Snapshotter; snapshotter != "" && !snapshotterPattern.MatchString(snapshotter) {
+		glog.Errorf("Invalid snapshotter %s", snapshotter)
+		return toV1AdmissionResponse(fmt.Errorf("Invalid snapshotter %s: must be the name of a containerd snapshotter e.g. stargz", snapshotter))
+	}
+
+	if imageCache.Spec.RefreshSchedule != "" {
+		if _, err := cron.ParseStandard(imageCache.Spec.RefreshSchedule); err != nil {
+			glog.Errorf("Invalid refresh schedule %s: %v", imageCache.Spec.RefreshSchedule, err)
+			return toV1AdmissionResponse(fmt.Errorf("Invalid refresh schedule %s: %v", imageCache.Spec.RefreshSchedule, err))
+		}
+	}
+
+	if webhook := imageCache.Spec.CompletionWebhook; webhook != "" {
+		if u, err := url.Parse(webhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			glog.Errorf("Invalid completion webhook %s", webhook)
+			return toV1AdmissionResponse(fmt.Errorf("Invalid completion webhook %s: an absolute http(s) URL must be specified", webhook))
+		}
+	}
+
+	for m, e := range imageCache.Spec.ExcludeImages {
+		if strings.TrimSpace(e) == "" {
+			glog.Errorf("Blank image at index %d of excludeImages", m)
+			return toV1AdmissionResponse(fmt.Errorf("Blank image at index %d of excludeImages", m))
+		}
+		if _, err := path.Match(e, ""); err != nil {
+			glog.Errorf("Invalid image pattern within excludeImages: %s: %v", e, err)
+			return toV1AdmissionResponse(fmt.Errorf("Invalid image pattern within excludeImages: %s: %v", e, err))
+		}
+	}
+
+	if imageCache.Spec.CanaryPercentage < 0 || imageCache.Spec.CanaryPercentage > 100 {
+		glog.Errorf("Invalid canary percentage %d", imageCache.Spec.CanaryPercentage)
+		return toV1AdmissionResponse(fmt.Errorf("Invalid canary percentage %d: must be between 0 and 100", imageCache.Spec.CanaryPercentage))
+	}
+
 	if ar.Request.Operation == v1.Update {
 		if len(oldImageCache.Spec.CacheSpec) != len(imageCache.Spec.CacheSpec) {
 			glog.Errorf("Mismatch in no. of image lists")
@@ -146,6 +305,15 @@ func ValidateImageCache(ar v1.AdmissionReview) *v1.AdmissionResponse {
 				glog.Errorf("Mismatch in node selector")
 				return toV1AdmissionResponse(fmt.Errorf("Mismatch in node selector"))
 			}
+			if !reflect.DeepEqual(oldImageCache.Spec.CacheSpec[i].NodeNames, imageCache.Spec.CacheSpec[i].NodeNames) {
+				glog.Errorf("Mismatch in node names")
+				return toV1AdmissionResponse(fmt.Errorf("Mismatch in node names"))
+			}
+		}
+
+		if oldImageCache.Spec.PurgeOnly != imageCache.Spec.PurgeOnly {
+			glog.Errorf("Mismatch in purge-only")
+			return toV1AdmissionResponse(fmt.Errorf("Mismatch in purge-only: an image cache cannot be changed to or from purge-only"))
 		}
 	}
 
@@ -0,0 +1,470 @@
+/*
+Copyright 2018 The kube-fledged authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	fledgedv1alpha1 "github.com/senthilrch/kube-fledged/pkg/apis/kubefledged/v1alpha1"
+	v1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestValidateImageCache(t *testing.T) {
+	tests := []struct {
+		name              string
+		images            []string
+		imagePullPolicy   corev1.PullPolicy
+		platform          string
+		pullJobContainer  *fledgedv1alpha1.PullJobContainer
+		imageArchive      *fledgedv1alpha1.ImageArchive
+		imagesFrom        *corev1.ConfigMapKeySelector
+		imagesFromPods    *fledgedv1alpha1.PodImagesSource
+		imagePatterns     []string
+		mirrors           []string
+		credentialsSecret *fledgedv1alpha1.CredentialsSecret
+		pullDeadline      *metav1.Duration
+		completionWebhook string
+		cacheSpec         []fledgedv1alpha1.CacheSpecImages
+		excludeImages     []string
+		deviceResources   corev1.ResourceList
+		canaryPercentage  int32
+		caBundle          *fledgedv1alpha1.CABundle
+		snapshotter       string
+		expectAllowed     bool
+		expectedErrString string
+	}{
+		{
+			name:          "#1: Valid image references",
+			images:        []string{"nginx", "nginx:1.17", "gcr.io/google-containers/pause:3.1", "busybox@sha256:bd3f0b4ab5c2c8f27a3dd2ed8a88e0c2a2fe2e6a7ba6ee0e5d8a4c1e5a2b8c3d"},
+			expectAllowed: true,
+		},
+		{
+			name:              "#2: Upper case repository name",
+			images:            []string{"Nginx:latest"},
+			expectAllowed:     false,
+			expectedErrString: "Invalid image reference within image list: Nginx:latest",
+		},
+		{
+			name:              "#3: Invalid tag",
+			images:            []string{"nginx:1.17:latest"},
+			expectAllowed:     false,
+			expectedErrString: "Invalid image reference within image list: nginx:1.17:latest",
+		},
+		{
+			name:              "#4: Empty image reference",
+			images:            []string{""},
+			expectAllowed:     false,
+			expectedErrString: "Blank image at index 0 of image list 0",
+		},
+		{
+			name:             "#5: Pull job container overridden",
+			images:           []string{"nginx"},
+			pullJobContainer: &fledgedv1alpha1.PullJobContainer{Image: "mirror-puller:v1", Args: []string{"$(IMAGE)"}},
+			expectAllowed:    true,
+		},
+		{
+			name:              "#6: No image specified for pull job container",
+			images:            []string{"nginx"},
+			pullJobContainer:  &fledgedv1alpha1.PullJobContainer{Args: []string{"$(IMAGE)"}},
+			expectAllowed:     false,
+			expectedErrString: "No image specified for pull job container",
+		},
+		{
+			name:            "#7: Image pull policy overridden in image list",
+			images:          []string{"nginx"},
+			imagePullPolicy: corev1.PullNever,
+			expectAllowed:   true,
+		},
+		{
+			name:              "#8: Invalid image pull policy",
+			images:            []string{"nginx"},
+			imagePullPolicy:   "Sometimes",
+			expectAllowed:     false,
+			expectedErrString: "Invalid image pull policy within image list: Sometimes",
+		},
+		{
+			name:          "#9: Platform specified in image list",
+			images:        []string{"nginx"},
+			platform:      "linux/arm64/v8",
+			expectAllowed: true,
+		},
+		{
+			name:              "#10: Invalid platform",
+			images:            []string{"nginx"},
+			platform:          "arm64",
+			expectAllowed:     false,
+			expectedErrString: "Invalid platform within image list: arm64",
+		},
+		{
+			name:          "#11: Image archive on hostPath",
+			images:        []string{"nginx"},
+			imageArchive:  &fledgedv1alpha1.ImageArchive{HostPath: "/mnt/archives"},
+			expectAllowed: true,
+		},
+		{
+			name:              "#12: Image archive on both hostPath and PVC",
+			images:            []string{"nginx"},
+			imageArchive:      &fledgedv1alpha1.ImageArchive{HostPath: "/mnt/archives", PersistentVolumeClaim: "archives"},
+			expectAllowed:     false,
+			expectedErrString: "Exactly one of hostPath and persistentVolumeClaim should be specified for image archive within image list",
+		},
+		{
+			name:          "#13: Images listed in configmap only",
+			imagesFrom:    &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "ci-images"}, Key: "images"},
+			expectAllowed: true,
+		},
+		{
+			name:              "#14: No key specified for configmap of images",
+			imagesFrom:        &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "ci-images"}},
+			expectAllowed:     false,
+			expectedErrString: "Both name and key of configmap should be specified for imagesFrom within image list",
+		},
+		{
+			name:              "#15: No images specified",
+			expectAllowed:     false,
+			expectedErrString: "No images specified within image list",
+		},
+		{
+			name:          "#16: Mirrors specified in image list",
+			images:        []string{"nginx"},
+			mirrors:       []string{"mirror.local:5000", "mirror.example.com/dockerhub"},
+			expectAllowed: true,
+		},
+		{
+			name:              "#17: Invalid mirror",
+			images:            []string{"nginx"},
+			mirrors:           []string{"mirror.local:5000/dockerhub:v1"},
+			expectAllowed:     false,
+			expectedErrString: "Invalid mirror within image list: mirror.local:5000/dockerhub:v1",
+		},
+		{
+			name:              "#18: Credentials secret specified",
+			images:            []string{"gcr.io/foo/bar"},
+			pullJobContainer:  &fledgedv1alpha1.PullJobContainer{Image: "gcr-puller:v1"},
+			credentialsSecret: &fledgedv1alpha1.CredentialsSecret{SecretName: "gcr-key", MountPath: "/var/run/secrets/gcr", Key: "key.json", EnvName: "GOOGLE_APPLICATION_CREDENTIALS"},
+			expectAllowed:     true,
+		},
+		{
+			name:              "#19: Credentials secret with relative mount path",
+			images:            []string{"gcr.io/foo/bar"},
+			pullJobContainer:  &fledgedv1alpha1.PullJobContainer{Image: "gcr-puller:v1"},
+			credentialsSecret: &fledgedv1alpha1.CredentialsSecret{SecretName: "gcr-key", MountPath: "gcr"},
+			expectAllowed:     false,
+			expectedErrString: "Invalid credentials secret",
+		},
+		{
+			name:              "#20: Credentials secret with invalid env name",
+			images:            []string{"gcr.io/foo/bar"},
+			pullJobContainer:  &fledgedv1alpha1.PullJobContainer{Image: "gcr-puller:v1"},
+			credentialsSecret: &fledgedv1alpha1.CredentialsSecret{SecretName: "gcr-key", MountPath: "/gcr", EnvName: "GCR-KEY"},
+			expectAllowed:     false,
+			expectedErrString: "Invalid env name GCR-KEY of credentials secret",
+		},
+		{
+			name:          "#21: Pull deadline of image cache specified",
+			images:        []string{"nginx"},
+			pullDeadline:  &metav1.Duration{Duration: 30 * time.Minute},
+			expectAllowed: true,
+		},
+		{
+			name:              "#22: Negative pull deadline of image cache",
+			images:            []string{"nginx"},
+			pullDeadline:      &metav1.Duration{Duration: -time.Minute},
+			expectAllowed:     false,
+			expectedErrString: "Invalid pull deadline of image cache: -1m0s",
+		},
+		{
+			name:          "#23: Only image patterns specified",
+			imagePatterns: []string{"myrepo/app:v1.*"},
+			expectAllowed: true,
+		},
+		{
+			name:              "#24: Image pattern without tag pattern",
+			images:            []string{"nginx"},
+			imagePatterns:     []string{"myrepo/app"},
+			expectAllowed:     false,
+			expectedErrString: "Invalid image pattern within image list: myrepo/app",
+		},
+		{
+			name:              "#25: Completion webhook",
+			images:            []string{"nginx"},
+			completionWebhook: "https://chatops.example.com/hooks/kubefledged",
+			expectAllowed:     true,
+		},
+		{
+			name:              "#26: Completion webhook without scheme",
+			images:            []string{"nginx"},
+			completionWebhook: "chatops.example.com/hooks/kubefledged",
+			expectAllowed:     false,
+			expectedErrString: "Invalid completion webhook chatops.example.com/hooks/kubefledged: an absolute http(s) URL must be specified",
+		},
+		{
+			name:              "#27: Empty cacheSpec",
+			cacheSpec:         []fledgedv1alpha1.CacheSpecImages{},
+			expectAllowed:     false,
+			expectedErrString: "No image lists specified in cacheSpec",
+		},
+		{
+			name:              "#28: Empty images in second image list",
+			cacheSpec:         []fledgedv1alpha1.CacheSpecImages{{Images: []string{"nginx"}}, {Images: []string{}}},
+			expectAllowed:     false,
+			expectedErrString: "No images specified within image list 1",
+		},
+		{
+			name:              "#29: Whitespace image in second image list",
+			cacheSpec:         []fledgedv1alpha1.CacheSpecImages{{Images: []string{"nginx"}}, {Images: []string{"redis", "  "}}},
+			expectAllowed:     false,
+			expectedErrString: "Blank image at index 1 of image list 1",
+		},
+		{
+			name:              "#30: Blank image pattern",
+			images:            []string{"nginx"},
+			imagePatterns:     []string{" "},
+			expectAllowed:     false,
+			expectedErrString: "Blank image pattern at index 0 of image list 0",
+		},
+		{
+			name:          "#31: Exclude images",
+			images:        []string{"nginx"},
+			excludeImages: []string{"nginx:1.17", "myrepo/*:debug"},
+			expectAllowed: true,
+		},
+		{
+			name:              "#32: Invalid exclude images pattern",
+			images:            []string{"nginx"},
+			excludeImages:     []string{"myrepo/[app"},
+			expectAllowed:     false,
+			expectedErrString: "Invalid image pattern within excludeImages: myrepo/[app",
+		},
+		{
+			name:            "#33: Device resources",
+			images:          []string{"nvcr.io/nvidia/cuda:11.0-base"},
+			deviceResources: corev1.ResourceList{"nvidia.com/gpu": resource.MustParse("1")},
+			expectAllowed:   true,
+		},
+		{
+			name:              "#34: Compute resource as device resource",
+			images:            []string{"nginx"},
+			deviceResources:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")},
+			expectAllowed:     false,
+			expectedErrString: "Invalid device resource within image list: cpu",
+		},
+		{
+			name:              "#35: Fractional quantity of device resource",
+			images:            []string{"nginx"},
+			deviceResources:   corev1.ResourceList{"nvidia.com/gpu": resource.MustParse("500m")},
+			expectAllowed:     false,
+			expectedErrString: "Invalid quantity of device resource within image list: nvidia.com/gpu: 500m",
+		},
+		{
+			name:             "#36: Canary percentage",
+			images:           []string{"nginx"},
+			canaryPercentage: 10,
+			expectAllowed:    true,
+		},
+		{
+			name:              "#37: Canary percentage above 100",
+			images:            []string{"nginx"},
+			canaryPercentage:  110,
+			expectAllowed:     false,
+			expectedErrString: "Invalid canary percentage 110: must be between 0 and 100",
+		},
+		{
+			name:          "#38: CA bundle in a ConfigMap",
+			images:        []string{"nginx"},
+			caBundle:      &fledgedv1alpha1.CABundle{ConfigMapName: "registry-ca", Key: "ca.pem"},
+			expectAllowed: true,
+		},
+		{
+			name:              "#39: CA bundle in both a ConfigMap and a Secret",
+			images:            []string{"nginx"},
+			caBundle:          &fledgedv1alpha1.CABundle{ConfigMapName: "registry-ca", SecretName: "registry-ca"},
+			expectAllowed:     false,
+			expectedErrString: "Invalid CA bundle: exactly one of configMapName and secretName must be specified",
+		},
+		{
+			name:              "#40: CA bundle in neither a ConfigMap nor a Secret",
+			images:            []string{"nginx"},
+			caBundle:          &fledgedv1alpha1.CABundle{Key: "ca.pem"},
+			expectAllowed:     false,
+			expectedErrString: "Invalid CA bundle: exactly one of configMapName and secretName must be specified",
+		},
+		{
+			name:          "#41: Stargz snapshotter",
+			images:        []string{"nginx"},
+			snapshotter:   "stargz",
+			expectAllowed: true,
+		},
+		{
+			name:              "#42: Invalid snapshotter",
+			images:            []string{"nginx"},
+			snapshotter:       "stargz; rm -rf /",
+			expectAllowed:     false,
+			expectedErrString: "Invalid snapshotter stargz; rm -rf /: must be the name of a containerd snapshotter e.g. stargz",
+		},
+		{
+			name:           "#43: Images from pods of a namespace",
+			imagesFromPods: &fledgedv1alpha1.PodImagesSource{Namespace: "shop"},
+			expectAllowed:  true,
+		},
+		{
+			name:              "#44: Images from pods of an invalid namespace",
+			imagesFromPods:    &fledgedv1alpha1.PodImagesSource{Namespace: "Shop"},
+			expectAllowed:     false,
+			expectedErrString: "Invalid namespace of imagesFromPods within image list 0: Shop",
+		},
+		{
+			name:              "#45: Credentials secret without pull job container",
+			images:            []string{"gcr.io/foo/bar"},
+			credentialsSecret: &fledgedv1alpha1.CredentialsSecret{SecretName: "gcr-key", MountPath: "/var/run/secrets/gcr"},
+			expectAllowed:     false,
+			expectedErrString: "Credentials secret requires a pull job container",
+		},
+	}
+
+	for _, test := range tests {
+		imageCache := fledgedv1alpha1.ImageCache{
+			Spec: fledgedv1alpha1.ImageCacheSpec{
+				CacheSpec: []fledgedv1alpha1.CacheSpecImages{
+					{
+						Images:          test.images,
+						ImagePullPolicy: test.imagePullPolicy,
+						Platform:        test.platform,
+						ImageArchive:    test.imageArchive,
+						ImagesFrom:      test.imagesFrom,
+						ImagesFromPods:  test.imagesFromPods,
+						ImagePatterns:   test.imagePatterns,
+						Mirrors:         test.mirrors,
+						DeviceResources: test.deviceResources,
+					},
+				},
+				PullJobContainer:  test.pullJobContainer,
+				CredentialsSecret: test.credentialsSecret,
+				PullDeadline:      test.pullDeadline,
+				CompletionWebhook: test.completionWebhook,
+				ExcludeImages:     test.excludeImages,
+				CanaryPercentage:  test.canaryPercentage,
+				CABundle:          test.caBundle,
+				Snapshotter:       test.snapshotter,
+			},
+		}
+		if test.cacheSpec != nil {
+			imageCache.Spec.CacheSpec = test.cacheSpec
+		}
+		raw, err := json.Marshal(imageCache)
+		if err != nil {
+			t.Fatalf("Test: %s failed: %v", test.name, err)
+		}
+		ar := v1.AdmissionReview{
+			Request: &v1.AdmissionRequest{
+				Operation: v1.Create,
+				Object:    runtime.RawExtension{Raw: raw},
+			},
+		}
+		response := ValidateImageCache(ar)
+		if response.Allowed != test.expectAllowed {
+			t.Errorf("Test: %s failed: expectAllowed=%t, actualAllowed=%t", test.name, test.expectAllowed, response.Allowed)
+			continue
+		}
+		if !test.expectAllowed && !strings.HasPrefix(response.Result.Message, test.expectedErrString) {
+			t.Errorf("Test: %s failed: expectedError=%s, actualError=%s", test.name, test.expectedErrString, response.Result.Message)
+		}
+	}
+}
+
+func TestValidateImageCacheUpdate(t *testing.T) {
+	tests := []struct {
+		name              string
+		oldPurgeOnly      bool
+		purgeOnly         bool
+		oldNodeNames      []string
+		nodeNames         []string
+		expectAllowed     bool
+		expectedErrString string
+	}{
+		{
+			name:          "#1: Images of purge-only image cache updated",
+			oldPurgeOnly:  true,
+			purgeOnly:     true,
+			expectAllowed: true,
+		},
+		{
+			name:              "#2: Changed to purge-only",
+			purgeOnly:         true,
+			expectAllowed:     false,
+			expectedErrString: "Mismatch in purge-only",
+		},
+		{
+			name:              "#3: Changed from purge-only",
+			oldPurgeOnly:      true,
+			expectAllowed:     false,
+			expectedErrString: "Mismatch in purge-only",
+		},
+		{
+			name:              "#4: Node names changed",
+			oldNodeNames:      []string{"canary-1"},
+			nodeNames:         []string{"canary-1", "canary-2"},
+			expectAllowed:     false,
+			expectedErrString: "Mismatch in node names",
+		},
+	}
+
+	for _, test := range tests {
+		oldImageCache := fledgedv1alpha1.ImageCache{
+			Spec: fledgedv1alpha1.ImageCacheSpec{
+				CacheSpec: []fledgedv1alpha1.CacheSpecImages{{Images: []string{"nginx:1.17"}, NodeNames: test.oldNodeNames}},
+				PurgeOnly: test.oldPurgeOnly,
+			},
+		}
+		imageCache := fledgedv1alpha1.ImageCache{
+			Spec: fledgedv1alpha1.ImageCacheSpec{
+				CacheSpec: []fledgedv1alpha1.CacheSpecImages{{Images: []string{"nginx:1.17", "redis:5"}, NodeNames: test.nodeNames}},
+				PurgeOnly: test.purgeOnly,
+			},
+		}
+		oldRaw, err := json.Marshal(oldImageCache)
+		if err != nil {
+			t.Fatalf("Test: %s failed: %v", test.name, err)
+		}
+		raw, err := json.Marshal(imageCache)
+		if err != nil {
+			t.Fatalf("Test: %s failed: %v", test.name, err)
+		}
+		ar := v1.AdmissionReview{
+			Request: &v1.AdmissionRequest{
+				Operation: v1.Update,
+				Object:    runtime.RawExtension{Raw: raw},
+				OldObject: runtime.RawExtension{Raw: oldRaw},
+			},
+		}
+		response := ValidateImageCache(ar)
+		if response.Allowed != test.expectAllowed {
+			t.Errorf("Test: %s failed: expectAllowed=%t, actualAllowed=%t", test.name, test.expectAllowed, response.Allowed)
+			continue
+		}
+		if !test.expectAllowed && !strings.HasPrefix(response.Result.Message, test.expectedErrString) {
+			t.Errorf("Test: %s failed: expectedError=%s, actualError=%s", test.name, test.expectedErrString, response.Result.Message)
+		}
+	}
+}